@@ -1,7 +1,10 @@
 package api
 
 import (
+	"time"
+
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/auth"
 	"github.com/weaveworks/flux/jobs"
 	"github.com/weaveworks/flux/platform"
 )
@@ -12,13 +15,35 @@ type ClientService interface {
 	ListImages(flux.InstanceID, flux.ServiceSpec) ([]flux.ImageStatus, error)
 	PostRelease(flux.InstanceID, jobs.ReleaseJobParams) (jobs.JobID, error)
 	GetRelease(flux.InstanceID, jobs.JobID) (jobs.Job, error)
+	GetReleaseLog(flux.InstanceID, jobs.JobID) ([]jobs.LogEntry, error)
+	GetReleasePlan(_ flux.InstanceID, _ jobs.JobID, colour bool) (string, error)
+	ListJobs(flux.InstanceID, jobs.JobQuery) (jobs.JobPage, error)
+	AbortSelfUpgrade(flux.InstanceID, jobs.JobID) (jobs.JobID, error)
 	Automate(flux.InstanceID, flux.ServiceID) error
 	Deautomate(flux.InstanceID, flux.ServiceID) error
+	ConfirmImage(flux.InstanceID, flux.ServiceID, flux.ImageID) error
 	Lock(flux.InstanceID, flux.ServiceID) error
 	Unlock(flux.InstanceID, flux.ServiceID) error
+	UpdatePolicies(flux.InstanceID, flux.PolicyUpdate) ([]flux.PolicyResult, error)
 	History(flux.InstanceID, flux.ServiceSpec) ([]flux.HistoryEntry, error)
+	ImagesAt(flux.InstanceID, flux.ServiceID, time.Time) ([]flux.ImageRelease, error)
+	Timeline(flux.InstanceID, flux.TimelineQuery) ([]flux.ImageRelease, error)
+	DeploymentReport(_ flux.InstanceID, since, until time.Time) (flux.DeploymentReport, error)
+	UsageReport(_ flux.InstanceID, since, until time.Time) (flux.UsageReport, error)
 	GetConfig(_ flux.InstanceID) (flux.InstanceConfig, error)
+	DebugBundle(flux.InstanceID) (DebugBundle, error)
+	RegistryStatus(flux.InstanceID) ([]flux.RegistryHostState, error)
+	CheckRegistryCredentials(flux.InstanceID) ([]flux.RegistryCredentialCheck, error)
+	UnmanagedResources(flux.InstanceID) ([]flux.UnmanagedResource, error)
+	ExplainAutomation(flux.InstanceID) ([]flux.AutomationCheck, error)
+	Export(flux.InstanceID) (flux.DesiredState, error)
 	SetConfig(flux.InstanceID, flux.UnsafeInstanceConfig) error
+	GetTemplate(flux.InstanceID) (InstanceTemplate, error)
+	ApplyTemplate(flux.InstanceID, InstanceTemplate) error
+	ListTokens(flux.InstanceID) ([]auth.Token, error)
+	CreateToken(flux.InstanceID, auth.TokenSpec) (NewToken, error)
+	RotateToken(flux.InstanceID, auth.TokenID) (NewToken, error)
+	RevokeToken(flux.InstanceID, auth.TokenID) error
 }
 
 type DaemonService interface {
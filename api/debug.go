@@ -0,0 +1,31 @@
+package api
+
+import (
+	"time"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+)
+
+// DebugBundle is a snapshot of what the service knows about an
+// instance, for attaching to support tickets. Secrets are redacted.
+type DebugBundle struct {
+	Generated time.Time                `json:"generated"`
+	Instance  flux.InstanceID          `json:"instance"`
+	Version   string                   `json:"version"` // of the service
+	Config    *flux.SafeInstanceConfig `json:"config,omitempty"`
+	Daemon    DaemonHeartbeat          `json:"daemon"`
+	Jobs      []jobs.Job               `json:"jobs"`   // most recent first
+	Events    []flux.HistoryEntry      `json:"events"` // most recent first
+	// Errors records anything that couldn't be gathered, so that the
+	// rest of the bundle can still be returned.
+	Errors []string `json:"errors,omitempty"`
+}
+
+type DaemonHeartbeat struct {
+	Connected      bool       `json:"connected"`
+	ConnectedSince *time.Time `json:"connectedSince,omitempty"`
+	Version        string     `json:"version,omitempty"`
+	PingSeconds    float64    `json:"pingSeconds,omitempty"`
+	Error          string     `json:"error,omitempty"`
+}
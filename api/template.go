@@ -0,0 +1,15 @@
+package api
+
+import (
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+)
+
+// InstanceTemplate is the configuration of an instance, less its
+// secrets, from which other instances can be set up the same way: its
+// settings (notifications, automation, release checks, and so on),
+// and the policies of its services.
+type InstanceTemplate struct {
+	Settings flux.UnsafeInstanceConfig                 `json:"settings" yaml:"settings"`
+	Services map[flux.ServiceID]instance.ServiceConfig `json:"services,omitempty" yaml:"services,omitempty"`
+}
@@ -0,0 +1,13 @@
+package api
+
+import (
+	"github.com/weaveworks/flux/auth"
+)
+
+// NewToken is a token as it's created or rotated, with its secret.
+// The secret isn't kept by the service, so this is the only chance to
+// get it.
+type NewToken struct {
+	auth.Token
+	Secret string
+}
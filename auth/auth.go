@@ -0,0 +1,175 @@
+// Package auth has the API tokens with which clients of the service
+// say which instance they're acting for, and what they may do.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+// Scope is something a token allows its bearer to do.
+type Scope string
+
+// Each of read, release and admin also allows everything the scopes
+// before it do. The daemon scope is apart from them: it's only for
+// daemons connecting to the service.
+const (
+	ScopeRead    Scope = "read"    // list services, images, jobs and history
+	ScopeRelease Scope = "release" // release, and change the policies of services
+	ScopeAdmin   Scope = "admin"   // change the instance's config, and manage tokens
+	ScopeDaemon  Scope = "daemon"  // connect a daemon
+)
+
+var KnownScopes = []Scope{ScopeRead, ScopeRelease, ScopeAdmin, ScopeDaemon}
+
+func ParseScope(s string) (Scope, error) {
+	for _, scope := range KnownScopes {
+		if s == string(scope) {
+			return scope, nil
+		}
+	}
+	return "", fmt.Errorf("unknown token scope %q", s)
+}
+
+// Includes says whether a token with this scope may do what needs the
+// other scope.
+func (s Scope) Includes(other Scope) bool {
+	rank := func(s Scope) int {
+		switch s {
+		case ScopeRead:
+			return 1
+		case ScopeRelease:
+			return 2
+		case ScopeAdmin:
+			return 3
+		}
+		return 0
+	}
+	if s == other {
+		return true
+	}
+	return rank(other) > 0 && rank(s) > rank(other)
+}
+
+var (
+	ErrNoSuchToken = errors.New("no such token")
+	// ErrUnauthenticated means a secret isn't that of any token, or
+	// the token has been revoked.
+	ErrUnauthenticated = errors.New("token not recognised")
+)
+
+type TokenID string
+
+// Token describes an API token. The secret itself isn't kept, only a
+// hash of it, so it can only be given out when the token is created
+// or rotated.
+type Token struct {
+	ID       TokenID
+	Instance flux.InstanceID
+	Name     string
+	Scopes   []Scope
+	// RateLimit is how many requests a minute may be made with the
+	// token; zero means the service's default.
+	RateLimit int `json:",omitempty"`
+	CreatedAt time.Time
+	RotatedAt *time.Time `json:",omitempty"`
+}
+
+// Allows says whether the token may be used for what needs the scope
+// given.
+func (t Token) Allows(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s.Includes(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenSpec is what's asked for when creating a token.
+type TokenSpec struct {
+	Name      string
+	Scopes    []Scope
+	RateLimit int `json:",omitempty"`
+}
+
+func (s TokenSpec) Validate() error {
+	if s.Name == "" {
+		return errors.New("a token needs a name")
+	}
+	if len(s.Scopes) == 0 {
+		return errors.New("a token needs at least one scope")
+	}
+	for _, scope := range s.Scopes {
+		if _, err := ParseScope(string(scope)); err != nil {
+			return err
+		}
+	}
+	if s.RateLimit < 0 {
+		return errors.New("a token's rate limit can't be negative")
+	}
+	return nil
+}
+
+// Store keeps tokens, each for an instance.
+type Store interface {
+	// Create makes a new token, giving it and its secret.
+	Create(flux.InstanceID, TokenSpec) (Token, string, error)
+	// Rotate gives the token a new secret, after which the old one
+	// is no longer accepted.
+	Rotate(flux.InstanceID, TokenID) (Token, string, error)
+	// Revoke stops the token from being accepted at all.
+	Revoke(flux.InstanceID, TokenID) error
+	// List gives the instance's tokens, less those revoked, oldest
+	// first.
+	List(flux.InstanceID) ([]Token, error)
+	// Authenticate gives the token with the secret given, or
+	// ErrUnauthenticated.
+	Authenticate(secret string) (Token, error)
+}
+
+// secretPrefix marks secrets as flux API tokens, so they're easy to
+// recognise (e.g., when they're accidentally committed).
+const secretPrefix = "flux_"
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generating token secret")
+	}
+	return secretPrefix + hex.EncodeToString(b), nil
+}
+
+// hashSecret gives what's kept of a secret, by which it's looked up.
+// Secrets are random, and long, so they don't need a salt or a slow
+// hash.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func formatScopes(scopes []Scope) string {
+	var strs []string
+	for _, s := range scopes {
+		strs = append(strs, string(s))
+	}
+	return strings.Join(strs, ",")
+}
+
+func parseScopes(s string) []Scope {
+	var scopes []Scope
+	for _, str := range strings.Split(s, ",") {
+		if str != "" {
+			scopes = append(scopes, Scope(str))
+		}
+	}
+	return scopes
+}
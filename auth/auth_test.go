@@ -0,0 +1,39 @@
+package auth
+
+import "testing"
+
+func TestScopeIncludes(t *testing.T) {
+	for _, c := range []struct {
+		have, need Scope
+		ok         bool
+	}{
+		{ScopeRead, ScopeRead, true},
+		{ScopeRelease, ScopeRead, true},
+		{ScopeAdmin, ScopeRelease, true},
+		{ScopeRead, ScopeRelease, false},
+		{ScopeRelease, ScopeAdmin, false},
+		{ScopeAdmin, ScopeDaemon, false},
+		{ScopeDaemon, ScopeRead, false},
+		{ScopeDaemon, ScopeDaemon, true},
+	} {
+		if got := c.have.Includes(c.need); got != c.ok {
+			t.Errorf("%s includes %s: expected %v, got %v", c.have, c.need, c.ok, got)
+		}
+	}
+}
+
+func TestTokenSpecValidate(t *testing.T) {
+	if err := (TokenSpec{Name: "ci", Scopes: []Scope{ScopeRelease}}).Validate(); err != nil {
+		t.Error(err)
+	}
+	for _, spec := range []TokenSpec{
+		{Scopes: []Scope{ScopeRead}},
+		{Name: "ci"},
+		{Name: "ci", Scopes: []Scope{"root"}},
+		{Name: "ci", Scopes: []Scope{ScopeRead}, RateLimit: -1},
+	} {
+		if err := spec.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", spec)
+		}
+	}
+}
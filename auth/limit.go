@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter limits the rate of requests made with each token, letting
+// a minute's worth through at once, then one at a time as the rate
+// allows.
+type Limiter struct {
+	perMinute int // for tokens which don't say
+	now       func() time.Time
+
+	mu      sync.Mutex
+	buckets map[TokenID]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter makes a limiter allowing the rate given, a minute, for
+// tokens without a rate limit of their own. Zero means those tokens
+// aren't limited.
+func NewLimiter(perMinute int) *Limiter {
+	return &Limiter{
+		perMinute: perMinute,
+		now:       time.Now,
+		buckets:   map[TokenID]*bucket{},
+	}
+}
+
+// Allow says whether a request can be made with the token now, and
+// if not, how long to wait before trying again.
+func (l *Limiter) Allow(t Token) (bool, time.Duration) {
+	rate := t.RateLimit
+	if rate == 0 {
+		rate = l.perMinute
+	}
+	if rate <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b, ok := l.buckets[t.ID]
+	if !ok {
+		b = &bucket{tokens: float64(rate), last: now}
+		l.buckets[t.ID] = b
+	}
+	perSecond := float64(rate) / 60
+	b.tokens += now.Sub(b.last).Seconds() * perSecond
+	if b.tokens > float64(rate) {
+		b.tokens = float64(rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	return false, wait
+}
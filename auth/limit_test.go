@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterAllowsBurstThenRate(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(60)
+	l.now = func() time.Time { return now }
+	tok := Token{ID: "a"}
+
+	for i := 0; i < 60; i++ {
+		if ok, _ := l.Allow(tok); !ok {
+			t.Fatalf("request %d refused within burst", i)
+		}
+	}
+	ok, wait := l.Allow(tok)
+	if ok {
+		t.Fatal("expected request beyond burst to be refused")
+	}
+	if wait != time.Second {
+		t.Errorf("expected to be told to wait a second, got %s", wait)
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := l.Allow(tok); !ok {
+		t.Error("expected request to be allowed once the rate allows")
+	}
+}
+
+func TestLimiterPerToken(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(1)
+	l.now = func() time.Time { return now }
+
+	if ok, _ := l.Allow(Token{ID: "a"}); !ok {
+		t.Fatal("first request refused")
+	}
+	if ok, _ := l.Allow(Token{ID: "a"}); ok {
+		t.Error("expected second request with the same token to be refused")
+	}
+	if ok, _ := l.Allow(Token{ID: "b"}); !ok {
+		t.Error("expected request with another token to be allowed")
+	}
+	// A token's own limit takes precedence over the default.
+	for i := 0; i < 5; i++ {
+		if ok, _ := l.Allow(Token{ID: "c", RateLimit: 5}); !ok {
+			t.Fatalf("request %d refused within token's own limit", i)
+		}
+	}
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := NewLimiter(0)
+	for i := 0; i < 1000; i++ {
+		if ok, _ := l.Allow(Token{ID: "a"}); !ok {
+			t.Fatal("expected no limit")
+		}
+	}
+}
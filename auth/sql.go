@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"database/sql"
+	"time"
+
+	_ "github.com/cznic/ql/driver"
+	_ "github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/guid"
+)
+
+// SQLStore keeps tokens in the api_tokens table. Revoked tokens are
+// kept, marked as such, so it's known what they were.
+type SQLStore struct {
+	conn *sql.DB
+	now  func() time.Time
+}
+
+func NewSQLStore(driver, datasource string) (*SQLStore, error) {
+	conn, err := sql.Open(driver, datasource)
+	if err != nil {
+		return nil, err
+	}
+	s := &SQLStore{
+		conn: conn,
+		now:  func() time.Time { return time.Now().UTC() },
+	}
+	return s, s.sanityCheck()
+}
+
+func (s *SQLStore) Create(inst flux.InstanceID, spec TokenSpec) (Token, string, error) {
+	if err := spec.Validate(); err != nil {
+		return Token{}, "", err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return Token{}, "", err
+	}
+	t := Token{
+		ID:        TokenID(guid.New()),
+		Instance:  inst,
+		Name:      spec.Name,
+		Scopes:    spec.Scopes,
+		RateLimit: spec.RateLimit,
+		CreatedAt: s.now(),
+	}
+	err = s.transaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO api_tokens (id, instance_id, name, scopes, rate_limit, secret_hash, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, string(t.ID), string(inst), t.Name, formatScopes(t.Scopes), t.RateLimit, hashSecret(secret), t.CreatedAt)
+		return err
+	})
+	if err != nil {
+		return Token{}, "", errors.Wrap(err, "creating token")
+	}
+	return t, secret, nil
+}
+
+func (s *SQLStore) Rotate(inst flux.InstanceID, id TokenID) (Token, string, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return Token{}, "", err
+	}
+	now := s.now()
+	err = s.transaction(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`
+			UPDATE api_tokens SET secret_hash = $1, rotated_at = $2
+			 WHERE id = $3 AND instance_id = $4 AND revoked_at IS NULL
+		`, hashSecret(secret), now, string(id), string(inst))
+		return affectedOne(res, err)
+	})
+	if err != nil {
+		return Token{}, "", err
+	}
+	t, err := s.get(inst, id)
+	return t, secret, err
+}
+
+func (s *SQLStore) Revoke(inst flux.InstanceID, id TokenID) error {
+	now := s.now()
+	return s.transaction(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`
+			UPDATE api_tokens SET revoked_at = $1
+			 WHERE id = $2 AND instance_id = $3 AND revoked_at IS NULL
+		`, now, string(id), string(inst))
+		return affectedOne(res, err)
+	})
+}
+
+func (s *SQLStore) List(inst flux.InstanceID) ([]Token, error) {
+	rows, err := s.conn.Query(`
+		SELECT id, instance_id, name, scopes, rate_limit, created_at, rotated_at
+		  FROM api_tokens
+		 WHERE instance_id = $1 AND revoked_at IS NULL
+		 ORDER BY created_at
+	`, string(inst))
+	if err != nil {
+		return nil, errors.Wrap(err, "listing tokens")
+	}
+	defer rows.Close()
+	tokens := []Token{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *SQLStore) Authenticate(secret string) (Token, error) {
+	t, err := scanToken(s.conn.QueryRow(`
+		SELECT id, instance_id, name, scopes, rate_limit, created_at, rotated_at
+		  FROM api_tokens
+		 WHERE secret_hash = $1 AND revoked_at IS NULL
+	`, hashSecret(secret)))
+	if err == sql.ErrNoRows {
+		return Token{}, ErrUnauthenticated
+	}
+	return t, err
+}
+
+func (s *SQLStore) get(inst flux.InstanceID, id TokenID) (Token, error) {
+	t, err := scanToken(s.conn.QueryRow(`
+		SELECT id, instance_id, name, scopes, rate_limit, created_at, rotated_at
+		  FROM api_tokens
+		 WHERE id = $1 AND instance_id = $2
+	`, string(id), string(inst)))
+	if err == sql.ErrNoRows {
+		return Token{}, ErrNoSuchToken
+	}
+	return t, err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanToken(row scanner) (Token, error) {
+	var (
+		t                    Token
+		id, instance, scopes string
+		rateLimit            int64
+	)
+	if err := row.Scan(&id, &instance, &t.Name, &scopes, &rateLimit, &t.CreatedAt, &t.RotatedAt); err != nil {
+		return Token{}, err
+	}
+	t.ID, t.Instance, t.Scopes, t.RateLimit = TokenID(id), flux.InstanceID(instance), parseScopes(scopes), int(rateLimit)
+	return t, nil
+}
+
+// affectedOne turns an update of no rows into ErrNoSuchToken.
+func affectedOne(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoSuchToken
+	}
+	return nil
+}
+
+func (s *SQLStore) transaction(f func(*sql.Tx) error) error {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Ping checks the database can be reached.
+func (s *SQLStore) Ping() error {
+	return s.conn.Ping()
+}
+
+func (s *SQLStore) sanityCheck() error {
+	_, err := s.conn.Query(`SELECT id FROM api_tokens LIMIT 1`)
+	if err != nil {
+		return errors.Wrap(err, "failed sanity check for api_tokens table")
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/db"
+)
+
+func newStore(t *testing.T) *SQLStore {
+	f, err := ioutil.TempFile("", "fluxy-testdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbsource := "file://" + f.Name()
+	if _, err = db.Migrate(dbsource, "../db/migrations"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSQLStore("ql", dbsource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestCreateAuthenticate(t *testing.T) {
+	s := newStore(t)
+	inst := flux.InstanceID("floaty-womble-abc123")
+
+	created, secret, err := s.Create(inst, TokenSpec{Name: "ci", Scopes: []Scope{ScopeRelease}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Authenticate(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != created.ID || got.Instance != inst || !got.Allows(ScopeRead) || got.Allows(ScopeAdmin) {
+		t.Errorf("unexpected token %+v", got)
+	}
+	if _, err := s.Authenticate(secret + "x"); err != ErrUnauthenticated {
+		t.Errorf("expected a wrong secret to be refused, got %v", err)
+	}
+}
+
+func TestRotateRevoke(t *testing.T) {
+	s := newStore(t)
+	inst := flux.InstanceID("floaty-womble-abc123")
+
+	created, oldSecret, err := s.Create(inst, TokenSpec{Name: "ci", Scopes: []Scope{ScopeRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, newSecret, err := s.Rotate(inst, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.RotatedAt == nil {
+		t.Error("expected rotated token to say when it was rotated")
+	}
+	if _, err := s.Authenticate(oldSecret); err != ErrUnauthenticated {
+		t.Errorf("expected old secret to be refused, got %v", err)
+	}
+	if _, err := s.Authenticate(newSecret); err != nil {
+		t.Errorf("expected new secret to be accepted, got %v", err)
+	}
+
+	// Another instance can't touch the token.
+	if err := s.Revoke("other", created.ID); err != ErrNoSuchToken {
+		t.Errorf("expected ErrNoSuchToken revoking another instance's token, got %v", err)
+	}
+
+	if err := s.Revoke(inst, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(newSecret); err != ErrUnauthenticated {
+		t.Errorf("expected revoked token to be refused, got %v", err)
+	}
+	tokens, err := s.List(inst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 0 {
+		t.Errorf("expected no tokens listed once revoked, got %+v", tokens)
+	}
+	if _, _, err := s.Rotate(inst, created.ID); err != ErrNoSuchToken {
+		t.Errorf("expected ErrNoSuchToken rotating a revoked token, got %v", err)
+	}
+}
@@ -1,7 +1,9 @@
 package automator
 
 import (
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -11,6 +13,7 @@ import (
 	"github.com/weaveworks/flux/instance"
 	"github.com/weaveworks/flux/jobs"
 	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/release"
 )
 
@@ -21,6 +24,13 @@ const (
 // Automator orchestrates continuous deployment for specific services.
 type Automator struct {
 	cfg Config
+
+	// The latest images resolved for each instance in its last
+	// cycle, to reuse while the images are unchanged.
+	mu     sync.Mutex
+	latest map[flux.InstanceID]*release.LatestImages
+
+	polls *pollSchedule
 }
 
 // New creates a new automator.
@@ -29,7 +39,9 @@ func New(cfg Config) (*Automator, error) {
 		return nil, err
 	}
 	return &Automator{
-		cfg: cfg,
+		cfg:    cfg,
+		latest: map[flux.InstanceID]*release.LatestImages{},
+		polls:  newPollSchedule(),
 	}, nil
 }
 
@@ -95,6 +107,7 @@ func (a *Automator) handleAutomatedInstanceJob(logger log.Logger, j *jobs.Job) (
 	}
 
 	if len(automatedServiceIDs) == 0 {
+		a.forget(params.InstanceID)
 		return nil, nil
 	}
 
@@ -111,9 +124,13 @@ func (a *Automator) handleAutomatedInstanceJob(logger log.Logger, j *jobs.Job) (
 		return followUps, errors.Wrap(err, "getting services")
 	}
 
-	// Get just the automated services we can release.
+	// Get just the automated services we can release. Flux's own
+	// services are only released if self-upgrade is enabled.
 	var services []platform.Service
 	for _, service := range allServices {
+		if release.IsFluxService(service.ID) && config.Settings.SelfUpgrade == nil {
+			continue
+		}
 		if automatedServiceIDs.Contains(service.ID) {
 			services = append(services, service)
 		}
@@ -121,30 +138,98 @@ func (a *Automator) handleAutomatedInstanceJob(logger log.Logger, j *jobs.Job) (
 
 	if len(services) == 0 {
 		// No automated services are defined, don't reschedule.
+		a.forget(params.InstanceID)
 		return nil, nil
 	}
 
 	// Get the images used for each automated service. We have to do this
 	// ourselves, so that any individual failure doesn't error out the whole
-	// job.
+	// job. Each repository is only polled when it's due; until then,
+	// the images it had last time stand.
 	images := instance.ImageMap{}
+	priority := map[string]bool{}
 	for _, service := range services {
+		namespace, _ := service.ID.Components()
 		for _, container := range service.ContainersOrNil() {
-			repo := flux.ParseImageID(container.Image).Repository()
-			images[repo] = nil
+			id, err := flux.ParseImageID(container.Image)
+			if err != nil {
+				logger.Log("service", service.ID, "container", container.Name, "err", err)
+				continue
+			}
+			images[id.Repository()] = nil
+			if config.Settings.Automation.IsPriorityNamespace(namespace) {
+				priority[id.Repository()] = true
+			}
 		}
 	}
+	a.polls.retain(params.InstanceID, images)
+	now := time.Now()
 	for repo := range images {
+		if cached, ok := a.polls.cached(params.InstanceID, repo, now); ok {
+			images[repo] = cached
+			continue
+		}
 		imageRepo, err := inst.GetRepository(repo)
 		if err != nil {
 			logger.Log("err", errors.Wrapf(err, "fetching image metadata for %s", repo))
 			continue
 		}
+		a.polls.polled(params.InstanceID, repo, imageRepo, priority[repo], a.hostState(repo), now)
 		images[repo] = imageRepo
 	}
 
-	// Calculate which services need releasing.
-	updateMap := release.CalculateUpdates(services, images, func(format string, args ...interface{}) { /* noop */ })
+	// Calculate which services need releasing. Services with a tag
+	// filter only get the images matching it. Where the images are
+	// those seen last time (e.g., from the registry cache), so are
+	// the latest of them.
+	latest := release.NewLatestImages(images)
+	a.mu.Lock()
+	latest.Reuse(a.latest[params.InstanceID])
+	a.latest[params.InstanceID] = latest
+	a.mu.Unlock()
+	noop := func(jobs.Skip, string, ...interface{}) {}
+	updateMap := release.CalculateLatestUpdates(services, latest, config, noop)
+
+	// Services released more recently than their release interval
+	// allows are held back, to be looked at again in later cycles.
+	var updating []flux.ServiceID
+	for id := range updateMap {
+		updating = append(updating, id)
+	}
+	held, err := heldBack(updating, config, func(id flux.ServiceID, since time.Time) ([]flux.ImageRelease, error) {
+		return inst.Timeline(flux.TimelineQuery{Service: id, Since: since})
+	}, time.Now())
+	if err != nil {
+		return followUps, err
+	}
+	for id, until := range held {
+		logger.Log("service", id, "deferred", "release interval", "until", until.Format(time.RFC3339))
+		delete(updateMap, id)
+	}
+
+	// If the instance batches releases, hold back the updates until
+	// the window since they were first found has passed, then
+	// release everything found by then together.
+	if batch := config.Settings.Automation.BatchWindow; batch != "" && len(updateMap) > 0 {
+		window, err := time.ParseDuration(batch)
+		if err != nil {
+			return followUps, errors.Wrap(err, "parsing automation batch window")
+		}
+		now := time.Now()
+		since := params.PendingSince
+		if since.IsZero() {
+			since = now
+		}
+		if now.Sub(since) < window {
+			followUps[0].Params = jobs.AutomatedInstanceJobParams{
+				InstanceID:   params.InstanceID,
+				PendingSince: since,
+			}
+			return followUps, nil
+		}
+		return append(followUps, batchedReleaseJob(params.InstanceID, updateMap)), nil
+	}
+
 	releases := map[flux.ImageID]flux.ServiceIDSet{}
 	for serviceID, updates := range updateMap {
 		for _, update := range updates {
@@ -169,15 +254,16 @@ func (a *Automator) handleAutomatedInstanceJob(logger log.Logger, j *jobs.Job) (
 			Key: strings.Join([]string{
 				jobs.ReleaseJob,
 				string(params.InstanceID),
-				string(imageID),
+				imageID.String(),
 				"automated",
 			}, "|"),
 			Method:   jobs.ReleaseJob,
 			Priority: jobs.PriorityBackground,
 			Params: jobs.ReleaseJobParams{
 				ServiceSpecs: serviceSpecs,
-				ImageSpec:    flux.ImageSpec(imageID),
+				ImageSpec:    flux.ImageSpec(imageID.String()),
 				Kind:         flux.ReleaseKindExecute,
+				User:         "automator",
 			},
 		})
 	}
@@ -185,6 +271,59 @@ func (a *Automator) handleAutomatedInstanceJob(logger log.Logger, j *jobs.Job) (
 	return followUps, nil
 }
 
+func (a *Automator) forget(instID flux.InstanceID) {
+	a.mu.Lock()
+	delete(a.latest, instID)
+	a.mu.Unlock()
+	a.polls.forget(instID)
+}
+
+// hostState gives what's known about the registry host of the
+// repository, if anything.
+func (a *Automator) hostState(repo string) *flux.RegistryHostState {
+	states := a.cfg.Throttle.State(registry.HostOf(repo))
+	if len(states) == 0 {
+		return nil
+	}
+	return &states[0]
+}
+
+// batchedReleaseJob releases all the updates given, in a single
+// commit.
+func batchedReleaseJob(instanceID flux.InstanceID, updateMap map[flux.ServiceID][]release.ContainerUpdate) jobs.Job {
+	var ids []string
+	for id := range updateMap {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+	var targets []jobs.ContainerTarget
+	for _, id := range ids {
+		for _, update := range updateMap[flux.ServiceID(id)] {
+			targets = append(targets, jobs.ContainerTarget{
+				Service:   flux.ServiceID(id),
+				Container: update.Container,
+				Image:     update.Target,
+			})
+		}
+	}
+	return jobs.Job{
+		Queue: jobs.ReleaseJob,
+		// Key stops us getting two batches queued for the instance.
+		Key: strings.Join([]string{
+			jobs.ReleaseJob,
+			string(instanceID),
+			"automated-batch",
+		}, "|"),
+		Method:   jobs.ReleaseJob,
+		Priority: jobs.PriorityBackground,
+		Params: jobs.ReleaseJobParams{
+			ContainerTargets: targets,
+			Kind:             flux.ReleaseKindExecute,
+			User:             "automator",
+		},
+	}
+}
+
 func automatedInstanceJob(instanceID flux.InstanceID, now time.Time) jobs.Job {
 	return jobs.Job{
 		Queue: jobs.AutomatedInstanceJob,
@@ -0,0 +1,192 @@
+package automator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/registry"
+)
+
+type nopHistogram struct{}
+
+func (h nopHistogram) With(...string) metrics.Histogram { return h }
+func (h nopHistogram) Observe(float64)                  {}
+
+type nopHistory struct {
+	history.EventReader
+	history.EventWriter
+}
+
+func (nopHistory) LogImageReleases([]flux.ImageRelease) error                      { return nil }
+func (nopHistory) ImagesAt(flux.ServiceID, time.Time) ([]flux.ImageRelease, error) { return nil, nil }
+func (nopHistory) Timeline(flux.TimelineQuery) ([]flux.ImageRelease, error)        { return nil, nil }
+
+// staticConfig is both the instance DB and the instance's own
+// config, which never changes.
+type staticConfig struct {
+	instance.DB
+	config instance.Config
+}
+
+func (c staticConfig) GetConfig(flux.InstanceID) (instance.Config, error) { return c.config, nil }
+func (c staticConfig) Get() (instance.Config, error)                      { return c.config, nil }
+func (c staticConfig) Update(instance.UpdateFunc) error                   { return nil }
+func (c staticConfig) UpdateAt(int64, instance.UpdateFunc) error          { return nil }
+
+// nopJobs is never used, since handling a job gives the jobs to
+// follow rather than queueing them.
+type nopJobs struct {
+	jobs.JobReadPusher
+}
+
+type staticInstancer struct {
+	inst *instance.Instance
+}
+
+func (i staticInstancer) Get(flux.InstanceID) (*instance.Instance, error) {
+	return i.inst, nil
+}
+
+// batchingAutomator gives an automator for an instance batching its
+// releases over the window given, with two automated services each
+// running an image which has a newer tag.
+func batchingAutomator(t *testing.T, window string) *Automator {
+	service := func(id flux.ServiceID, image string) platform.Service {
+		return platform.Service{ID: id, Containers: platform.ContainersOrExcuse{
+			Containers: []platform.Container{{Name: "main", Image: image}},
+		}}
+	}
+	p := platform.NewFake(
+		service("default/helloworld", "quay.io/weaveworks/helloworld:v1"),
+		service("default/sidecar", "quay.io/weaveworks/sidecar:v1"),
+	)
+	images := registry.NewFake()
+	for _, repo := range []string{"quay.io/weaveworks/helloworld", "quay.io/weaveworks/sidecar"} {
+		if err := images.AddTags(repo, time.Now().Add(-time.Hour), "v1", "v2"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := staticConfig{config: instance.MakeConfig()}
+	config.config.Services["default/helloworld"] = instance.ServiceConfig{Automated: true}
+	config.config.Services["default/sidecar"] = instance.ServiceConfig{Automated: true}
+	config.config.Settings.Automation.BatchWindow = window
+
+	inst := instance.New(p, images, config, git.Repo{}, log.NewNopLogger(), nopHistogram{}, nopHistory{}, nopHistory{}, nopHistory{}, history.NopAnnotator{})
+	a, err := New(Config{
+		Jobs:       nopJobs{},
+		InstanceDB: config,
+		Instancer:  staticInstancer{inst},
+		Logger:     log.NewNopLogger(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func automatedJob(pendingSince time.Time) *jobs.Job {
+	return &jobs.Job{
+		ID:       jobs.NewJobID(),
+		Instance: "instance",
+		Method:   jobs.AutomatedInstanceJob,
+		Params:   jobs.AutomatedInstanceJobParams{InstanceID: "instance", PendingSince: pendingSince},
+	}
+}
+
+// split gives the automated instance job to come next, and the
+// release jobs, from the follow-ups given.
+func split(t *testing.T, followUps []jobs.Job) (jobs.AutomatedInstanceJobParams, []jobs.Job) {
+	if len(followUps) == 0 || followUps[0].Method != jobs.AutomatedInstanceJob {
+		t.Fatalf("expected the automated instance job to be followed up, got %+v", followUps)
+	}
+	return followUps[0].Params.(jobs.AutomatedInstanceJobParams), followUps[1:]
+}
+
+func TestBatchWindowHoldsUpdates(t *testing.T) {
+	a := batchingAutomator(t, "10m")
+
+	// Updates found for the first time are held, and the window
+	// starts then.
+	before := time.Now()
+	followUps, err := a.Handle(automatedJob(time.Time{}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, releases := split(t, followUps)
+	if len(releases) != 0 {
+		t.Errorf("expected updates to be held within the window, got %+v", releases)
+	}
+	if next.PendingSince.Before(before) || next.PendingSince.After(time.Now()) {
+		t.Errorf("expected the updates to be pending since they were found, got %s", next.PendingSince)
+	}
+
+	// Later in the window, they're still held, and the window stays
+	// where it started.
+	since := time.Now().Add(-5 * time.Minute)
+	followUps, err = a.Handle(automatedJob(since), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, releases = split(t, followUps)
+	if len(releases) != 0 {
+		t.Errorf("expected updates to be held within the window, got %+v", releases)
+	}
+	if !next.PendingSince.Equal(since) {
+		t.Errorf("expected the updates to be pending since %s, got %s", since, next.PendingSince)
+	}
+}
+
+func TestBatchWindowReleasesTogether(t *testing.T) {
+	a := batchingAutomator(t, "10m")
+
+	followUps, err := a.Handle(automatedJob(time.Now().Add(-11*time.Minute)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, releases := split(t, followUps)
+	if !next.PendingSince.IsZero() {
+		t.Errorf("expected nothing to be pending once the batch is released, got %s", next.PendingSince)
+	}
+	if len(releases) != 1 {
+		t.Fatalf("expected a single batched release, got %+v", releases)
+	}
+	params := releases[0].Params.(jobs.ReleaseJobParams)
+	expected := []jobs.ContainerTarget{
+		{Service: "default/helloworld", Container: "main", Image: mustParseImageID(t, "quay.io/weaveworks/helloworld:v2")},
+		{Service: "default/sidecar", Container: "main", Image: mustParseImageID(t, "quay.io/weaveworks/sidecar:v2")},
+	}
+	if !reflect.DeepEqual(params.ContainerTargets, expected) {
+		t.Errorf("expected the batch to release %+v, got %+v", expected, params.ContainerTargets)
+	}
+	if params.Kind != flux.ReleaseKindExecute || len(params.ServiceSpecs) != 0 {
+		t.Errorf("expected the batch to be executed, for exactly the containers given, got %+v", params)
+	}
+}
+
+func TestNoBatchWindowReleasesEachImage(t *testing.T) {
+	a := batchingAutomator(t, "")
+
+	followUps, err := a.Handle(automatedJob(time.Time{}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, releases := split(t, followUps)
+	if len(releases) != 2 {
+		t.Fatalf("expected a release for each image, got %+v", releases)
+	}
+	for _, r := range releases {
+		if params := r.Params.(jobs.ReleaseJobParams); len(params.ContainerTargets) != 0 || len(params.ServiceSpecs) != 1 {
+			t.Errorf("expected a release of an image to a service, got %+v", params)
+		}
+	}
+}
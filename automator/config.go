@@ -8,14 +8,19 @@ import (
 
 	"github.com/weaveworks/flux/instance"
 	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/registry"
 )
 
-// Config collects the parameters to the automator. All fields are mandatory.
+// Config collects the parameters to the automator. All fields are
+// mandatory, except Throttle: if given, it's consulted about the rate
+// limits of registry hosts, so they're polled less often when running
+// short.
 type Config struct {
 	Jobs       jobs.JobReadPusher
 	InstanceDB instance.DB
 	Instancer  instance.Instancer
 	Logger     log.Logger
+	Throttle   *registry.Throttle
 }
 
 // Validate returns an error if the config is underspecified.
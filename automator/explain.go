@@ -0,0 +1,183 @@
+package automator
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/release"
+)
+
+// Explain works out what automation would do for the instance, were
+// it to run now: which containers of its automated services would be
+// released, to which images, and why the others wouldn't. Nothing is
+// released. The images are fetched from the registry afresh, rather
+// than when they're next due, so that (e.g.) an image just pushed is
+// taken into account.
+func Explain(inst *instance.Instance) ([]flux.AutomationCheck, error) {
+	config, err := inst.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting instance config")
+	}
+	allServices, err := release.AllServicesExcept(nil).SelectServices(inst)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting services")
+	}
+
+	// Each failure to fetch images is reported against the
+	// containers using them, rather than failing everything.
+	images := instance.ImageMap{}
+	fetchErrs := map[string]error{}
+	for _, service := range allServices {
+		if !config.Services[service.ID].Automated {
+			continue
+		}
+		for _, container := range service.ContainersOrNil() {
+			if id, err := flux.ParseImageID(container.Image); err == nil {
+				images[id.Repository()] = nil
+			}
+		}
+	}
+	for repo := range images {
+		imageRepo, err := inst.GetRepository(repo)
+		if err != nil {
+			fetchErrs[repo] = err
+			continue
+		}
+		images[repo] = imageRepo
+	}
+
+	return explain(config, allServices, images, fetchErrs, func(id flux.ServiceID, since time.Time) ([]flux.ImageRelease, error) {
+		return inst.Timeline(flux.TimelineQuery{Service: id, Since: since})
+	}, time.Now())
+}
+
+// explain makes the same decisions as an automation cycle, given the
+// services running and the images in the registry, and says for each
+// automated service (and its containers) what was decided and why.
+func explain(config instance.Config, allServices []platform.Service, images instance.ImageMap, fetchErrs map[string]error, timeline timelineFunc, now time.Time) ([]flux.AutomationCheck, error) {
+	running := map[flux.ServiceID]platform.Service{}
+	for _, service := range allServices {
+		running[service.ID] = service
+	}
+
+	var ids []string
+	for id, conf := range config.Services {
+		if conf.Automated {
+			ids = append(ids, string(id))
+		}
+	}
+	sort.Strings(ids)
+
+	// Services which automation wouldn't look at are reported as such.
+	var services []platform.Service
+	ignored := map[flux.ServiceID]flux.AutomationCheck{}
+	for _, s := range ids {
+		id := flux.ServiceID(s)
+		service, ok := running[id]
+		switch {
+		case config.Services[id].Locked:
+			ignored[id] = flux.AutomationCheck{Service: id, Reason: jobs.SkipLocked, Message: "service is locked"}
+		case !ok:
+			ignored[id] = flux.AutomationCheck{Service: id, Reason: flux.AutomationNotRunning, Message: "service is not running"}
+		case release.IsFluxService(id) && config.Settings.SelfUpgrade == nil:
+			ignored[id] = flux.AutomationCheck{Service: id, Reason: jobs.SkipSelfUpgradeDisabled, Message: "flux's own services are only released if self-upgrade is enabled"}
+		default:
+			services = append(services, service)
+		}
+	}
+
+	// Record why each container that isn't updated is skipped; where
+	// it's the service as a whole that's skipped, the container is
+	// empty.
+	type key struct {
+		service   flux.ServiceID
+		container string
+	}
+	skipped := map[key]flux.AutomationCheck{}
+	skip := func(s jobs.Skip, format string, args ...interface{}) {
+		skipped[key{s.Service, s.Container}] = flux.AutomationCheck{
+			Service:   s.Service,
+			Container: s.Container,
+			Reason:    s.Reason,
+			Message:   fmt.Sprintf(format, args...),
+		}
+	}
+	latest := release.NewLatestImages(images)
+	updateMap := release.CalculateLatestUpdates(services, latest, config, skip)
+
+	var updating []flux.ServiceID
+	for id := range updateMap {
+		updating = append(updating, id)
+	}
+	held, err := heldBack(updating, config, timeline, now)
+	if err != nil {
+		return nil, err
+	}
+
+	batchMsg := ""
+	if batch := config.Settings.Automation.BatchWindow; batch != "" {
+		batchMsg = fmt.Sprintf("released together with the other updates found within the batch window of %s", batch)
+	}
+
+	var res []flux.AutomationCheck
+	for _, s := range ids {
+		if check, ok := ignored[flux.ServiceID(s)]; ok {
+			res = append(res, check)
+			continue
+		}
+		service := running[flux.ServiceID(s)]
+		if check, ok := skipped[key{service.ID, ""}]; ok {
+			res = append(res, check)
+			continue
+		}
+		filter := config.Services[service.ID].TagFilter
+		updates := map[string]release.ContainerUpdate{}
+		for _, update := range updateMap[service.ID] {
+			updates[update.Container] = update
+		}
+		for _, container := range service.ContainersOrNil() {
+			check, ok := skipped[key{service.ID, container.Name}]
+			if !ok {
+				check = flux.AutomationCheck{Service: service.ID, Container: container.Name}
+			}
+			current, err := flux.ParseImageID(container.Image)
+			check.Current = current
+			if err == nil {
+				if image := latest.Latest(current.Repository(), filter); image != nil {
+					check.Latest = image.ID
+				}
+			}
+			switch update, updated := updates[container.Name]; {
+			case ok:
+			case updated:
+				check.Latest = update.Target
+				if until, isHeld := held[service.ID]; isHeld {
+					check.Reason = flux.AutomationReleaseInterval
+					check.Message = fmt.Sprintf("service was released less than its release interval of %s ago", config.Services[service.ID].ReleaseInterval)
+					check.HeldUntil = &until
+				} else {
+					check.Release = true
+					check.Message = batchMsg
+				}
+			case fetchErrs[current.Repository()] != nil:
+				check.Reason = flux.AutomationRegistryError
+				check.Message = fetchErrs[current.Repository()].Error()
+			default:
+				check.Reason = flux.AutomationNoMatchingImages
+				check.Message = fmt.Sprintf("no images of %s found", current.Repository())
+				if filter != "" {
+					check.Message = fmt.Sprintf("no images of %s found matching the tag filter %q", current.Repository(), filter)
+				}
+			}
+			res = append(res, check)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,94 @@
+package automator
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform"
+)
+
+func mustParseImageID(t *testing.T, s string) flux.ImageID {
+	id, err := flux.ParseImageID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestExplain(t *testing.T) {
+	now := time.Now()
+	config := instance.Config{Services: map[flux.ServiceID]instance.ServiceConfig{
+		"default/helloworld": {Automated: true},
+		"default/filtered":   {Automated: true, TagFilter: "prod-*"},
+		"default/expensive":  {Automated: true, ReleaseInterval: "1h"},
+		"default/uptodate":   {Automated: true},
+		"default/unreached":  {Automated: true},
+		"default/locked":     {Automated: true, Locked: true},
+		"default/gone":       {Automated: true},
+		"default/manual":     {},
+	}}
+	service := func(id flux.ServiceID, image string) platform.Service {
+		return platform.Service{ID: id, Containers: platform.ContainersOrExcuse{
+			Containers: []platform.Container{{Name: "main", Image: image}},
+		}}
+	}
+	services := []platform.Service{
+		service("default/helloworld", "quay.io/weaveworks/helloworld:v1"),
+		service("default/filtered", "quay.io/weaveworks/helloworld:v1"),
+		service("default/expensive", "quay.io/weaveworks/helloworld:v1"),
+		service("default/uptodate", "quay.io/weaveworks/helloworld:v2"),
+		service("default/unreached", "quay.io/weaveworks/sidecar:v1"),
+		service("default/locked", "quay.io/weaveworks/helloworld:v1"),
+		service("default/manual", "quay.io/weaveworks/helloworld:v1"),
+	}
+	images := instance.ImageMap{"quay.io/weaveworks/helloworld": {
+		{ID: mustParseImageID(t, "quay.io/weaveworks/helloworld:v2")},
+		{ID: mustParseImageID(t, "quay.io/weaveworks/helloworld:v1")},
+	}}
+	fetchErrs := map[string]error{"quay.io/weaveworks/sidecar": errors.New("unauthorized")}
+	timeline := func(id flux.ServiceID, since time.Time) ([]flux.ImageRelease, error) {
+		if id == "default/expensive" {
+			return []flux.ImageRelease{{Service: id, Stamp: now.Add(-10 * time.Minute)}}, nil
+		}
+		return nil, nil
+	}
+
+	checks, err := explain(config, services, images, fetchErrs, timeline, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[flux.ServiceID]struct {
+		release bool
+		reason  string
+	}{
+		"default/expensive":  {false, flux.AutomationReleaseInterval},
+		"default/filtered":   {false, flux.AutomationNoMatchingImages},
+		"default/gone":       {false, flux.AutomationNotRunning},
+		"default/helloworld": {true, ""},
+		"default/locked":     {false, jobs.SkipLocked},
+		"default/unreached":  {false, flux.AutomationRegistryError},
+		"default/uptodate":   {false, jobs.SkipAlreadyLatest},
+	}
+	if len(checks) != len(expected) {
+		t.Fatalf("expected a check for each automated service, got %+v", checks)
+	}
+	for i, c := range checks {
+		if i > 0 && checks[i-1].Service >= c.Service {
+			t.Errorf("expected checks in order of service, got %s after %s", c.Service, checks[i-1].Service)
+		}
+		e := expected[c.Service]
+		if c.Release != e.release || c.Reason != e.reason {
+			t.Errorf("%s: expected release %t with reason %q, got %t with %q (%s)", c.Service, e.release, e.reason, c.Release, c.Reason, c.Message)
+		}
+	}
+	if c := checks[3]; c.Current.String() != "quay.io/weaveworks/helloworld:v1" || c.Latest.String() != "quay.io/weaveworks/helloworld:v2" {
+		t.Errorf("expected default/helloworld to go from v1 to v2, got %+v", c)
+	}
+	if c := checks[0]; c.HeldUntil == nil || !c.HeldUntil.Equal(now.Add(50*time.Minute)) {
+		t.Errorf("expected default/expensive to be held until 50 minutes from now, got %+v", c)
+	}
+}
@@ -0,0 +1,47 @@
+package automator
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+)
+
+// timelineFunc gives the image releases of a service since the time
+// given, most recent first.
+type timelineFunc func(flux.ServiceID, time.Time) ([]flux.ImageRelease, error)
+
+// heldBack gives, for each of the services given which has a release
+// interval and was released less than that long ago, when it may next
+// be released. Those services are left out of automated releases until
+// then; since each cycle looks for updates afresh, they're released
+// once the interval has passed, if there's still something to release.
+func heldBack(services []flux.ServiceID, config instance.Config, timeline timelineFunc, now time.Time) (map[flux.ServiceID]time.Time, error) {
+	res := map[flux.ServiceID]time.Time{}
+	for _, id := range services {
+		interval := config.Services[id].ReleaseInterval
+		if interval == "" {
+			continue
+		}
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing release interval of %s", id)
+		}
+		releases, err := timeline(id, now.Add(-d))
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetching releases of %s", id)
+		}
+		var last time.Time
+		for _, r := range releases {
+			if r.Stamp.After(last) {
+				last = r.Stamp
+			}
+		}
+		if !last.IsZero() && now.Sub(last) < d {
+			res[id] = last.Add(d)
+		}
+	}
+	return res, nil
+}
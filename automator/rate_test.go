@@ -0,0 +1,43 @@
+package automator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+)
+
+func TestHeldBack(t *testing.T) {
+	now := time.Now()
+	config := instance.Config{Services: map[flux.ServiceID]instance.ServiceConfig{
+		"default/expensive": {Automated: true, ReleaseInterval: "30m"},
+		"default/rested":    {Automated: true, ReleaseInterval: "30m"},
+		"default/cheap":     {Automated: true},
+	}}
+	released := map[flux.ServiceID][]flux.ImageRelease{
+		"default/expensive": {{Service: "default/expensive", Stamp: now.Add(-10 * time.Minute)}, {Service: "default/expensive", Stamp: now.Add(-20 * time.Minute)}},
+		"default/rested":    {{Service: "default/rested", Stamp: now.Add(-40 * time.Minute)}},
+		"default/cheap":     {{Service: "default/cheap", Stamp: now.Add(-time.Minute)}},
+	}
+	timeline := func(id flux.ServiceID, since time.Time) ([]flux.ImageRelease, error) {
+		var res []flux.ImageRelease
+		for _, r := range released[id] {
+			if !r.Stamp.Before(since) {
+				res = append(res, r)
+			}
+		}
+		return res, nil
+	}
+
+	held, err := heldBack([]flux.ServiceID{"default/expensive", "default/rested", "default/cheap"}, config, timeline, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(held) != 1 {
+		t.Fatalf("expected only default/expensive to be held back, got %v", held)
+	}
+	if until, ok := held["default/expensive"]; !ok || !until.Equal(now.Add(20*time.Minute)) {
+		t.Errorf("expected default/expensive to be held back until 20 minutes from now, got %v", held)
+	}
+}
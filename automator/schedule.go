@@ -0,0 +1,131 @@
+package automator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+)
+
+const (
+	// pollInterval is how often the images of repositories used by
+	// priority services are polled, at most; others are polled half
+	// as often, and less often still if they haven't changed in a
+	// while, or their registry is running out of requests.
+	pollInterval    = automationCycle
+	maxPollInterval = 30 * time.Minute
+)
+
+// pollSchedule keeps the images last fetched from each repository
+// used by each instance's automated services, and when it's next due
+// to be polled; until then, the images kept stand.
+type pollSchedule struct {
+	mu    sync.Mutex
+	repos map[flux.InstanceID]map[string]*repoPoll
+}
+
+type repoPoll struct {
+	images     []flux.ImageDescription
+	next       time.Time
+	lastChange time.Time
+}
+
+func newPollSchedule() *pollSchedule {
+	return &pollSchedule{
+		repos: map[flux.InstanceID]map[string]*repoPoll{},
+	}
+}
+
+// cached gives the images last fetched from the repository, if it's
+// not yet due to be polled again.
+func (s *pollSchedule) cached(inst flux.InstanceID, repo string, now time.Time) ([]flux.ImageDescription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.repos[inst][repo]
+	if !ok || !now.Before(p.next) {
+		return nil, false
+	}
+	return p.images, true
+}
+
+// polled records the images fetched from the repository, and
+// schedules the next poll.
+func (s *pollSchedule) polled(inst flux.InstanceID, repo string, images []flux.ImageDescription, priority bool, host *flux.RegistryHostState, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.repos[inst] == nil {
+		s.repos[inst] = map[string]*repoPoll{}
+	}
+	p, ok := s.repos[inst][repo]
+	if !ok {
+		p = &repoPoll{lastChange: now}
+		s.repos[inst][repo] = p
+	} else if !sameImageIDs(p.images, images) {
+		p.lastChange = now
+	}
+	p.images = images
+	p.next = now.Add(nextPoll(priority, now.Sub(p.lastChange), host, now))
+}
+
+// retain forgets the repositories no longer used by the instance.
+func (s *pollSchedule) retain(inst flux.InstanceID, repos instance.ImageMap) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for repo := range s.repos[inst] {
+		if _, ok := repos[repo]; !ok {
+			delete(s.repos[inst], repo)
+		}
+	}
+}
+
+func (s *pollSchedule) forget(inst flux.InstanceID) {
+	s.mu.Lock()
+	delete(s.repos, inst)
+	s.mu.Unlock()
+}
+
+// nextPoll says how long to leave a repository before polling it
+// again, given whether it's used by a priority service, how long
+// since its images changed, and the state of its registry host, if
+// known.
+func nextPoll(priority bool, sinceChange time.Duration, host *flux.RegistryHostState, now time.Time) time.Duration {
+	d := pollInterval
+	if !priority {
+		d *= 2
+	}
+	switch {
+	case sinceChange > 24*time.Hour:
+		d *= 4
+	case sinceChange > time.Hour:
+		d *= 2
+	}
+	if host != nil && host.Remaining != nil && host.Limit != nil && *host.Limit > 0 {
+		switch budget := float64(*host.Remaining) / float64(*host.Limit); {
+		case budget < 0.1:
+			d *= 4
+		case budget < 0.25:
+			d *= 2
+		}
+	}
+	if d > maxPollInterval {
+		d = maxPollInterval
+	}
+	// There's no point asking before the host will answer
+	if host != nil && host.BackoffUntil != nil && host.BackoffUntil.Sub(now) > d {
+		d = host.BackoffUntil.Sub(now)
+	}
+	return d
+}
+
+func sameImageIDs(a, b []flux.ImageDescription) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package automator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+func TestNextPoll(t *testing.T) {
+	now := time.Now()
+	remaining, limit := 5, 100
+	backoff := now.Add(time.Hour)
+	for _, c := range []struct {
+		name        string
+		priority    bool
+		sinceChange time.Duration
+		host        *flux.RegistryHostState
+		expected    time.Duration
+	}{
+		{"priority", true, 0, nil, pollInterval},
+		{"other", false, 0, nil, 2 * pollInterval},
+		{"unchanged for hours", true, 2 * time.Hour, nil, 2 * pollInterval},
+		{"unchanged for days", true, 48 * time.Hour, nil, 4 * pollInterval},
+		{"short of requests", true, 0, &flux.RegistryHostState{Remaining: &remaining, Limit: &limit}, 4 * pollInterval},
+		{"capped", false, 48 * time.Hour, &flux.RegistryHostState{Remaining: &remaining, Limit: &limit}, maxPollInterval},
+		{"backing off", true, 0, &flux.RegistryHostState{BackoffUntil: &backoff}, time.Hour},
+	} {
+		if got := nextPoll(c.priority, c.sinceChange, c.host, now); got != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.name, c.expected, got)
+		}
+	}
+}
+
+func TestPollScheduleCached(t *testing.T) {
+	s := newPollSchedule()
+	inst, repo := flux.InstanceID("instance"), "quay.io/weaveworks/helloworld"
+	now := time.Now()
+	if _, ok := s.cached(inst, repo, now); ok {
+		t.Fatal("expected a repository never polled to be due")
+	}
+	id, err := flux.ParseImageID(repo + ":v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := []flux.ImageDescription{{ID: id}}
+	s.polled(inst, repo, images, true, nil, now)
+	if cached, ok := s.cached(inst, repo, now.Add(pollInterval/2)); !ok || len(cached) != 1 {
+		t.Errorf("expected the images polled to stand until the next poll, got %v", cached)
+	}
+	if _, ok := s.cached(inst, repo, now.Add(pollInterval)); ok {
+		t.Error("expected the repository to be due again")
+	}
+}
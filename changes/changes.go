@@ -0,0 +1,162 @@
+// Package changes keeps change tickets, in systems like Jira or
+// ServiceNow, for releases.
+package changes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+// Approval is the state of a ticket, as far as whether the change
+// may go ahead.
+type Approval string
+
+const (
+	Pending  Approval = "pending"
+	Approved Approval = "approved"
+	Rejected Approval = "rejected"
+)
+
+// Change is what a ticket is opened for.
+type Change struct {
+	Instance flux.InstanceID
+	Release  string // the job ID
+	User     string
+	Services []flux.ServiceID
+	// Description says what's to be done, e.g., the release actions.
+	Description string
+}
+
+func (c Change) summary() string {
+	var services []string
+	for _, s := range c.Services {
+		services = append(services, string(s))
+	}
+	return fmt.Sprintf("Release %s of %s", c.Release, strings.Join(services, ", "))
+}
+
+func (c Change) description() string {
+	return fmt.Sprintf("Instance: %s\nRelease: %s\nRequested by: %s\n\n%s", c.Instance, c.Release, c.User, c.Description)
+}
+
+// System is where tickets are kept.
+type System interface {
+	// Open opens a ticket for the change, and gives its ID.
+	Open(Change) (string, error)
+	// Comment adds a comment to the ticket, e.g., with the result of
+	// the release.
+	Comment(id, text string) error
+	// Approval says whether the ticket has been approved.
+	Approval(id string) (Approval, error)
+}
+
+// New gives the system configured.
+func New(config flux.ChangeTicketConfig, d flux.Doer) (System, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	c := client{d: d, config: config}
+	switch config.System {
+	case flux.ChangeTicketsJira:
+		return &jira{c}, nil
+	case flux.ChangeTicketsServiceNow:
+		return &serviceNow{c}, nil
+	}
+	return nil, fmt.Errorf("unknown change ticket system %q", config.System)
+}
+
+// Applies says whether a release of the services given needs a
+// ticket, i.e., whether any of them are production services.
+func Applies(config flux.ChangeTicketConfig, services []flux.ServiceID) (bool, error) {
+	if len(services) == 0 {
+		return false, nil
+	}
+	if len(config.Services) == 0 {
+		return true, nil
+	}
+	for _, spec := range config.Services {
+		match, err := spec.Matcher()
+		if err != nil {
+			return false, errors.Wrapf(err, "parsing service spec %q", spec)
+		}
+		for _, s := range services {
+			if match(s) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// approval gives the approval meant by a ticket's state, given the
+// states configured, or the defaults.
+func approval(state string, approved, rejected, defaultApproved, defaultRejected []string) Approval {
+	if len(approved) == 0 {
+		approved = defaultApproved
+	}
+	if len(rejected) == 0 {
+		rejected = defaultRejected
+	}
+	for _, s := range approved {
+		if s == state {
+			return Approved
+		}
+	}
+	for _, s := range rejected {
+		if s == state {
+			return Rejected
+		}
+	}
+	return Pending
+}
+
+type client struct {
+	d      flux.Doer
+	config flux.ChangeTicketConfig
+}
+
+// call makes a request with a JSON body (if in is not nil), and
+// decodes the JSON response into out (if that's not nil).
+func (c client) call(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		buf := &bytes.Buffer{}
+		if err := json.NewEncoder(buf).Encode(in); err != nil {
+			return errors.Wrap(err, "encoding request")
+		}
+		body = buf
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.config.URL, "/")+path, body)
+	if err != nil {
+		return errors.Wrap(err, "constructing request")
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.config.Username != "" {
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+	resp, err := c.d.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "%s %s", method, path)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+		return fmt.Errorf("%s from %s %s (%s)", resp.Status, method, path, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(out), "decoding response to %s %s", method, path)
+}
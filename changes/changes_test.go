@@ -0,0 +1,69 @@
+package changes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/weaveworks/flux"
+)
+
+func TestApplies(t *testing.T) {
+	services := []flux.ServiceID{"default/frontend", "prod/api"}
+	for i, c := range []struct {
+		specs    []flux.ServiceSpec
+		services []flux.ServiceID
+		applies  bool
+	}{
+		{nil, services, true},
+		{nil, nil, false},
+		{[]flux.ServiceSpec{"prod/*"}, services, true},
+		{[]flux.ServiceSpec{"staging/*"}, services, false},
+	} {
+		applies, err := Applies(flux.ChangeTicketConfig{Services: c.specs}, c.services)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applies != c.applies {
+			t.Errorf("%d: expected %v, got %v", i, c.applies, applies)
+		}
+	}
+}
+
+func TestJiraApproval(t *testing.T) {
+	status := "In Review"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/issue/OPS-1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"fields": {"status": {"name": "` + status + `"}}}`))
+	}))
+	defer server.Close()
+
+	system, err := New(flux.ChangeTicketConfig{
+		System:  flux.ChangeTicketsJira,
+		URL:     server.URL,
+		Project: "OPS",
+	}, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		status   string
+		approval Approval
+	}{
+		{"In Review", Pending},
+		{"Approved", Approved},
+		{"Rejected", Rejected},
+	} {
+		status = c.status
+		approval, err := system.Approval("OPS-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if approval != c.approval {
+			t.Errorf("status %q: expected %s, got %s", c.status, c.approval, approval)
+		}
+	}
+}
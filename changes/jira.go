@@ -0,0 +1,49 @@
+package changes
+
+import (
+	"net/url"
+)
+
+// jira keeps tickets as issues in a Jira project.
+type jira struct {
+	client
+}
+
+func (j *jira) Open(c Change) (string, error) {
+	issueType := j.config.IssueType
+	if issueType == "" {
+		issueType = "Task"
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	err := j.call("POST", "/rest/api/2/issue", map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": j.config.Project},
+			"issuetype":   map[string]string{"name": issueType},
+			"summary":     c.summary(),
+			"description": c.description(),
+		},
+	}, &created)
+	return created.Key, err
+}
+
+func (j *jira) Comment(id, text string) error {
+	return j.call("POST", "/rest/api/2/issue/"+url.QueryEscape(id)+"/comment", map[string]string{
+		"body": text,
+	}, nil)
+}
+
+func (j *jira) Approval(id string) (Approval, error) {
+	var issue struct {
+		Fields struct {
+			Status struct {
+				Name string `json:"name"`
+			} `json:"status"`
+		} `json:"fields"`
+	}
+	if err := j.call("GET", "/rest/api/2/issue/"+url.QueryEscape(id)+"?fields=status", nil, &issue); err != nil {
+		return Pending, err
+	}
+	return approval(issue.Fields.Status.Name, j.config.ApprovedStates, j.config.RejectedStates, []string{"Approved"}, []string{"Rejected"}), nil
+}
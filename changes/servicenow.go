@@ -0,0 +1,42 @@
+package changes
+
+import (
+	"net/url"
+)
+
+const changeRequests = "/api/now/table/change_request"
+
+// serviceNow keeps tickets as change requests in ServiceNow.
+type serviceNow struct {
+	client
+}
+
+type changeRequest struct {
+	Result struct {
+		SysID    string `json:"sys_id"`
+		Approval string `json:"approval"`
+	} `json:"result"`
+}
+
+func (s *serviceNow) Open(c Change) (string, error) {
+	var created changeRequest
+	err := s.call("POST", changeRequests, map[string]string{
+		"short_description": c.summary(),
+		"description":       c.description(),
+	}, &created)
+	return created.Result.SysID, err
+}
+
+func (s *serviceNow) Comment(id, text string) error {
+	return s.call("PATCH", changeRequests+"/"+url.QueryEscape(id), map[string]string{
+		"work_notes": text,
+	}, nil)
+}
+
+func (s *serviceNow) Approval(id string) (Approval, error) {
+	var request changeRequest
+	if err := s.call("GET", changeRequests+"/"+url.QueryEscape(id)+"?sysparm_fields=approval", nil, &request); err != nil {
+		return Pending, err
+	}
+	return approval(request.Result.Approval, s.config.ApprovedStates, s.config.RejectedStates, []string{"approved"}, []string{"rejected"}), nil
+}
@@ -0,0 +1,242 @@
+package chatops
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+)
+
+const inChannel = "in_channel"
+
+// errUsage is returned by commands given the wrong arguments, so the
+// usage can be shown.
+var errUsage = errors.New("wrong arguments")
+
+// How much each role may do; a role may use the commands of any role
+// ranked the same or lower.
+var roleRank = map[string]int{
+	flux.SlackRoleViewer:   1,
+	flux.SlackRoleReleaser: 2,
+	flux.SlackRoleApprover: 3,
+}
+
+type command struct {
+	role  string
+	usage string
+	run   func(h *SlackHandler, inst flux.InstanceID, user flux.SlackUser, args []string) (slackMessage, error)
+}
+
+var commands = map[string]command{
+	"list":    {flux.SlackRoleViewer, "list [namespace] -- list services", listServices},
+	"pending": {flux.SlackRoleViewer, "pending <service spec> -- show newer images available", pendingUpdates},
+	"status":  {flux.SlackRoleViewer, "status <release ID> -- show how a release is going", releaseStatus},
+	"release": {flux.SlackRoleReleaser, "release <service spec> <image spec> -- plan a release, to be approved", planRelease},
+	"approve": {flux.SlackRoleApprover, "approve <release ID> -- run a planned release", approveRelease},
+}
+
+// run runs the command given by text, if the user's role allows it,
+// and gives the reply.
+func (h *SlackHandler) run(inst flux.InstanceID, user flux.SlackUser, text string) slackMessage {
+	args := strings.Fields(text)
+	if len(args) == 0 || args[0] == "help" {
+		return slackMessage{Text: usage(user.Role)}
+	}
+	c, ok := commands[args[0]]
+	if !ok {
+		return slackMessage{Text: fmt.Sprintf("Unknown command %q.\n%s", args[0], usage(user.Role))}
+	}
+	if !allowed(user.Role, c.role) {
+		return slackMessage{Text: fmt.Sprintf("Only %ss may use %q.", c.role, args[0])}
+	}
+	reply, err := c.run(h, inst, user, args[1:])
+	if err == errUsage {
+		return slackMessage{Text: "Usage: `" + c.usage + "`"}
+	}
+	if err != nil {
+		return slackMessage{Text: "Error: " + err.Error()}
+	}
+	return reply
+}
+
+func allowed(have, need string) bool {
+	return roleRank[have] >= roleRank[need]
+}
+
+func usage(role string) string {
+	var lines []string
+	for _, c := range commands {
+		if allowed(role, c.role) {
+			lines = append(lines, "`"+c.usage+"`")
+		}
+	}
+	sort.Strings(lines)
+	return "Commands you can use:\n" + strings.Join(lines, "\n")
+}
+
+func listServices(h *SlackHandler, inst flux.InstanceID, _ flux.SlackUser, args []string) (slackMessage, error) {
+	if len(args) > 1 {
+		return slackMessage{}, errUsage
+	}
+	var namespace string
+	if len(args) == 1 {
+		namespace = args[0]
+	}
+	services, err := h.service.ListServices(inst, namespace)
+	if err != nil {
+		return slackMessage{}, err
+	}
+	if len(services) == 0 {
+		return slackMessage{Text: "No services."}, nil
+	}
+	var buf bytes.Buffer
+	for _, s := range services {
+		fmt.Fprintf(&buf, "*%s* %s", s.ID, s.Status)
+		if policies := s.Policies(); policies != "" {
+			fmt.Fprintf(&buf, " (%s)", policies)
+		}
+		fmt.Fprintln(&buf)
+		for _, c := range s.Containers {
+			fmt.Fprintf(&buf, "  %s: `%s`\n", c.Name, c.Current.ID)
+		}
+	}
+	return slackMessage{Text: buf.String()}, nil
+}
+
+func pendingUpdates(h *SlackHandler, inst flux.InstanceID, _ flux.SlackUser, args []string) (slackMessage, error) {
+	if len(args) != 1 {
+		return slackMessage{}, errUsage
+	}
+	spec, err := flux.ParseServiceSpec(args[0])
+	if err != nil {
+		return slackMessage{}, err
+	}
+	statuses, err := h.service.ListImages(inst, spec)
+	if err != nil {
+		return slackMessage{}, err
+	}
+	var buf bytes.Buffer
+	for _, s := range statuses {
+		for _, c := range s.Containers {
+			// Available images are newest first, so those before the
+			// current one are newer.
+			var newer []flux.ImageDescription
+			for _, image := range c.Available {
+				if image.ID == c.Current.ID {
+					break
+				}
+				newer = append(newer, image)
+			}
+			if len(newer) > 0 {
+				fmt.Fprintf(&buf, "*%s* %s: `%s` -> `%s` (%d newer)\n", s.ID, c.Name, c.Current.ID, newer[0].ID, len(newer))
+			}
+		}
+	}
+	if buf.Len() == 0 {
+		return slackMessage{Text: "Nothing to update."}, nil
+	}
+	return slackMessage{Text: buf.String()}, nil
+}
+
+func releaseStatus(h *SlackHandler, inst flux.InstanceID, _ flux.SlackUser, args []string) (slackMessage, error) {
+	if len(args) != 1 {
+		return slackMessage{}, errUsage
+	}
+	job, err := h.service.GetRelease(inst, jobs.JobID(args[0]))
+	if err != nil {
+		return slackMessage{}, err
+	}
+	state := "in progress"
+	if job.Done {
+		state = "failed"
+		if job.Success {
+			state = "succeeded"
+		}
+	}
+	text := fmt.Sprintf("Release %s %s: %s", job.ID, state, job.Status)
+	if len(job.Log) > 0 {
+		var lines []string
+		for _, entry := range job.Log {
+			lines = append(lines, entry.String())
+		}
+		text += "\n```\n" + strings.Join(lines, "\n") + "\n```"
+	}
+	return slackMessage{Text: text}, nil
+}
+
+func planRelease(h *SlackHandler, inst flux.InstanceID, user flux.SlackUser, args []string) (slackMessage, error) {
+	if len(args) != 2 {
+		return slackMessage{}, errUsage
+	}
+	serviceSpec, err := flux.ParseServiceSpec(args[0])
+	if err != nil {
+		return slackMessage{}, errors.Wrapf(err, "parsing service spec %q", args[0])
+	}
+	imageSpec, err := flux.ParseImageSpec(args[1])
+	if err != nil {
+		return slackMessage{}, errors.Wrapf(err, "parsing image spec %q", args[1])
+	}
+	id, err := h.service.PostRelease(inst, jobs.ReleaseJobParams{
+		ServiceSpecs: []flux.ServiceSpec{serviceSpec},
+		ImageSpec:    imageSpec,
+		Kind:         flux.ReleaseKindPlan,
+		User:         user.Name,
+	})
+	if err != nil {
+		return slackMessage{}, err
+	}
+	return slackMessage{
+		ResponseType: inChannel,
+		Text:         fmt.Sprintf("%s is planning the release of %s to %s, as %s.", user.Name, imageSpec, serviceSpec, id),
+		Attachments: []slackAttachment{{
+			Text:       fmt.Sprintf("Once it's planned, see the plan with `status %s`, and approve it to run it.", id),
+			CallbackID: "approve",
+			Actions: []slackAction{{
+				Name:  "approve",
+				Text:  "Approve",
+				Type:  "button",
+				Style: "primary",
+				Value: "approve " + string(id),
+			}},
+		}},
+	}, nil
+}
+
+func approveRelease(h *SlackHandler, inst flux.InstanceID, user flux.SlackUser, args []string) (slackMessage, error) {
+	if len(args) != 1 {
+		return slackMessage{}, errUsage
+	}
+	job, err := h.service.GetRelease(inst, jobs.JobID(args[0]))
+	if err != nil {
+		return slackMessage{}, err
+	}
+	params, ok := job.Params.(jobs.ReleaseJobParams)
+	switch {
+	case !ok || params.Kind != flux.ReleaseKindPlan:
+		return slackMessage{}, fmt.Errorf("release %s is not a planned release", job.ID)
+	case !job.Done:
+		return slackMessage{}, fmt.Errorf("release %s has not finished planning yet", job.ID)
+	case !job.Success || len(params.Plan) == 0:
+		return slackMessage{}, fmt.Errorf("release %s did not make a plan: %s", job.ID, job.Status)
+	}
+
+	// Run the plan as it was made, rather than whatever it might be
+	// now, since that's what was approved.
+	id, err := h.service.PostRelease(inst, jobs.ReleaseJobParams{
+		Kind:    flux.ReleaseKindExecute,
+		User:    user.Name,
+		PlanJob: job.ID,
+	})
+	if err != nil {
+		return slackMessage{}, err
+	}
+	return slackMessage{
+		ResponseType: inChannel,
+		Text:         fmt.Sprintf("%s approved release %s, which is running as %s.", user.Name, job.ID, id),
+	}, nil
+}
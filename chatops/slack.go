@@ -0,0 +1,177 @@
+package chatops
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api"
+	"github.com/weaveworks/flux/instance"
+)
+
+const (
+	// Slack sends small forms; anything much bigger is not from Slack.
+	maxBodySize = 1 << 16
+	// Requests signed longer ago than this are refused, so they
+	// can't be replayed.
+	maxRequestAge = 5 * time.Minute
+)
+
+// SlackHandler answers Slack slash commands (e.g., `/flux list`), and
+// the buttons on the messages it replies with, for the instance
+// named by the request path. Each instance configures its own
+// signing secret, and which Slack users may do what.
+type SlackHandler struct {
+	service api.ClientService
+	configs instance.DB
+	logger  log.Logger
+	now     func() time.Time
+}
+
+func NewSlackHandler(service api.ClientService, configs instance.DB, logger log.Logger) *SlackHandler {
+	return &SlackHandler{
+		service: service,
+		configs: configs,
+		logger:  logger,
+		now:     time.Now,
+	}
+}
+
+// The payload sent when someone presses a button on a message.
+type interactionPayload struct {
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Actions []slackAction `json:"actions"`
+}
+
+type slackMessage struct {
+	// ResponseType is "in_channel" for replies everyone in the
+	// channel should see; otherwise, only the user sees it.
+	ResponseType    string            `json:"response_type,omitempty"`
+	ReplaceOriginal bool              `json:"replace_original,omitempty"`
+	Text            string            `json:"text"`
+	Attachments     []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Text       string        `json:"text,omitempty"`
+	CallbackID string        `json:"callback_id"`
+	Actions    []slackAction `json:"actions"`
+}
+
+// slackAction is a button. Its value is the command to run when it's
+// pressed, e.g., "approve <release ID>".
+type slackAction struct {
+	Name  string `json:"name"`
+	Text  string `json:"text,omitempty"`
+	Type  string `json:"type,omitempty"`
+	Style string `json:"style,omitempty"`
+	Value string `json:"value"`
+}
+
+func (h *SlackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	inst := flux.InstanceID(strings.Trim(r.URL.Path, "/"))
+	logger := log.NewContext(h.logger).With("instance", inst)
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	config, err := h.configs.GetConfig(inst)
+	if err != nil {
+		logger.Log("err", errors.Wrap(err, "getting instance config"))
+		http.Error(w, "unknown instance", http.StatusNotFound)
+		return
+	}
+	commands := config.Settings.Slack.Commands
+	if commands == nil || commands.SigningSecret == "" {
+		http.Error(w, "Slack commands are not enabled for this instance", http.StatusNotFound)
+		return
+	}
+	if err := h.verify(commands.SigningSecret, r.Header, body); err != nil {
+		logger.Log("err", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var userID, text string
+	interactive := false
+	if payload := form.Get("payload"); payload != "" {
+		var p interactionPayload
+		if err := json.Unmarshal([]byte(payload), &p); err != nil {
+			http.Error(w, errors.Wrap(err, "parsing payload").Error(), http.StatusBadRequest)
+			return
+		}
+		if len(p.Actions) == 0 {
+			http.Error(w, "no action in payload", http.StatusBadRequest)
+			return
+		}
+		userID, text, interactive = p.User.ID, p.Actions[0].Value, true
+	} else {
+		userID, text = form.Get("user_id"), form.Get("text")
+	}
+
+	var reply slackMessage
+	user, ok := commands.Users[userID]
+	if !ok {
+		reply = slackMessage{Text: "You are not allowed to use flux commands."}
+	} else {
+		logger.Log("slack_user", userID, "user", user.Name, "command", text)
+		reply = h.run(inst, user, text)
+	}
+	if interactive && reply.ResponseType == inChannel {
+		// Replace the message with the button, so it can't be
+		// pressed again.
+		reply.ReplaceOriginal = true
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(reply); err != nil {
+		logger.Log("err", errors.Wrap(err, "writing reply"))
+	}
+}
+
+// verify checks the request was signed by Slack, with the secret
+// given, and recently.
+func (h *SlackHandler) verify(secret string, header http.Header, body []byte) error {
+	stamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "parsing request timestamp")
+	}
+	if age := h.now().Sub(time.Unix(seconds, 0)); age > maxRequestAge || age < -maxRequestAge {
+		return fmt.Errorf("request timestamp %s is too far from now", stamp)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", stamp, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return errors.New("request signature does not match")
+	}
+	return nil
+}
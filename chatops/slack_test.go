@@ -0,0 +1,64 @@
+package chatops
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+func sign(secret, stamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", stamp, body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	h := &SlackHandler{now: func() time.Time { return now }}
+	body := []byte("user_id=U1&text=list")
+
+	for i, c := range []struct {
+		stamp, secret string
+		ok            bool
+	}{
+		{"1500000000", "secret", true},
+		{"1500000000", "other secret", false},
+		{"1499999000", "secret", false}, // too old
+		{"", "secret", false},
+	} {
+		header := http.Header{}
+		header.Set("X-Slack-Request-Timestamp", c.stamp)
+		header.Set("X-Slack-Signature", sign(c.secret, c.stamp, body))
+		err := h.verify("secret", header, body)
+		if c.ok && err != nil {
+			t.Errorf("%d: expected request to be verified, got %v", i, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("%d: expected request to be refused", i)
+		}
+	}
+}
+
+func TestRoles(t *testing.T) {
+	h := &SlackHandler{}
+	viewer := flux.SlackUser{Name: "v", Role: flux.SlackRoleViewer}
+	// The role is checked before the arguments, so a viewer is
+	// refused, and the approver gets the usage.
+	if reply := h.run("inst", viewer, "approve"); reply.Text != `Only approvers may use "approve".` {
+		t.Errorf("expected viewer to be refused, got %q", reply.Text)
+	}
+	approver := flux.SlackUser{Name: "a", Role: flux.SlackRoleApprover}
+	if reply := h.run("inst", approver, "approve"); reply.Text != "Usage: `"+commands["approve"].usage+"`" {
+		t.Errorf("expected usage, got %q", reply.Text)
+	}
+	unknown := flux.SlackUser{Name: "u", Role: "admin"}
+	if reply := h.run("inst", unknown, "list"); reply.Text != `Only viewers may use "list".` {
+		t.Errorf("expected unknown role to be refused, got %q", reply.Text)
+	}
+}
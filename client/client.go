@@ -0,0 +1,226 @@
+// Package client is a Go client for the flux service API, for
+// building tooling on top of flux: submitting releases and following
+// them, listing services and images, and updating policies.
+//
+// Calls which only read, or set something to a given state (e.g.,
+// policies), are retried when the service is unavailable or can't be
+// reached; submitting a release is not, since it may have been
+// accepted even though the answer didn't get back.
+package client
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api"
+	transport "github.com/weaveworks/flux/http"
+	"github.com/weaveworks/flux/jobs"
+)
+
+// APIVersion is the version of the API this client uses.
+const APIVersion = "v4"
+
+const (
+	defaultRetries = 3
+	defaultBackoff = time.Second
+)
+
+// ErrUnsupportedVersion is returned when the service doesn't serve
+// the version of the API this client uses.
+var ErrUnsupportedVersion = errors.New("the service does not support API version " + APIVersion)
+
+// noInstanceID is given to the API for the instance; it's the token
+// which says which instance is meant.
+const noInstanceID = flux.InstanceID("")
+
+// Options are those for a client; the zero value gives the defaults.
+type Options struct {
+	// HTTPClient makes the requests; by default, http.DefaultClient.
+	HTTPClient *http.Client
+	// Retries is how many times to retry a call which can be retried,
+	// once it's failed; by default three. Less than zero means calls
+	// aren't retried.
+	Retries int
+	// Backoff is how long to wait before retrying a call, multiplied
+	// by the number of the retry; by default a second.
+	Backoff time.Duration
+}
+
+// Client calls the API of a flux service, for the instance the token
+// belongs to.
+type Client struct {
+	api     api.ClientService
+	retries int
+	backoff time.Duration
+}
+
+// New makes a client for the service at the endpoint given (e.g.,
+// "https://cloud.weave.works/api/flux"), having checked that it
+// serves the version of the API the client uses.
+func New(endpoint string, token flux.Token, opts Options) (*Client, error) {
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	c := &Client{
+		api:     transport.NewClient(httpClient, transport.NewRouter(), endpoint, token),
+		retries: opts.Retries,
+		backoff: opts.Backoff,
+	}
+	if c.retries == 0 {
+		c.retries = defaultRetries
+	}
+	if c.backoff == 0 {
+		c.backoff = defaultBackoff
+	}
+
+	var versions []string
+	err := c.retry(func() (err error) {
+		versions, err = transport.GetAPIVersions(httpClient, transport.NewRouter(), endpoint)
+		return err
+	})
+	if err != nil {
+		if apiErr, ok := errors.Cause(err).(*transport.APIError); ok && apiErr.IsMissing() {
+			// The service is from before versions could be asked
+			// about, when this version was the latest.
+			return c, nil
+		}
+		return nil, errors.Wrap(err, "negotiating API version")
+	}
+	for _, v := range versions {
+		if v == APIVersion {
+			return c, nil
+		}
+	}
+	return nil, ErrUnsupportedVersion
+}
+
+// retry calls f until it succeeds, fails in a way that isn't worth
+// retrying, or it's been retried enough times.
+func (c *Client) retry(f func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = f(); err == nil || !retryable(err) || attempt >= c.retries {
+			return err
+		}
+		time.Sleep(time.Duration(attempt+1) * c.backoff)
+	}
+}
+
+// retryable says whether an error is worth retrying: the service
+// being unavailable, or not being reached at all.
+func retryable(err error) bool {
+	switch err := errors.Cause(err).(type) {
+	case *transport.APIError:
+		return err.IsUnavailable() || err.StatusCode == http.StatusTooManyRequests
+	case net.Error:
+		return true
+	}
+	return false
+}
+
+func (c *Client) Status() (res flux.Status, err error) {
+	err = c.retry(func() (err error) {
+		res, err = c.api.Status(noInstanceID)
+		return err
+	})
+	return res, err
+}
+
+// ListServices lists the services in the namespace given, or in all
+// namespaces if it's empty.
+func (c *Client) ListServices(namespace string) (res []flux.ServiceStatus, err error) {
+	err = c.retry(func() (err error) {
+		res, err = c.api.ListServices(noInstanceID, namespace)
+		return err
+	})
+	return res, err
+}
+
+// ListImages lists the images available for the containers of the
+// services given.
+func (c *Client) ListImages(spec flux.ServiceSpec) (res []flux.ImageStatus, err error) {
+	err = c.retry(func() (err error) {
+		res, err = c.api.ListImages(noInstanceID, spec)
+		return err
+	})
+	return res, err
+}
+
+// Release submits a release, giving the ID of its job; it can be
+// followed with WatchRelease or WaitForRelease. It's not retried.
+func (c *Client) Release(params jobs.ReleaseJobParams) (jobs.JobID, error) {
+	return c.api.PostRelease(noInstanceID, params)
+}
+
+// GetRelease gives the job of a release, with the latest of its log.
+func (c *Client) GetRelease(id jobs.JobID) (res jobs.Job, err error) {
+	err = c.retry(func() (err error) {
+		res, err = c.api.GetRelease(noInstanceID, id)
+		return err
+	})
+	return res, err
+}
+
+// GetReleaseLog gives the whole log of a release, as much as is kept.
+func (c *Client) GetReleaseLog(id jobs.JobID) (res []jobs.LogEntry, err error) {
+	err = c.retry(func() (err error) {
+		res, err = c.api.GetReleaseLog(noInstanceID, id)
+		return err
+	})
+	return res, err
+}
+
+// GetReleasePlan gives the plan of a dry-run release, summarised for
+// a terminal, and coloured if asked for.
+func (c *Client) GetReleasePlan(id jobs.JobID, colour bool) (res string, err error) {
+	err = c.retry(func() (err error) {
+		res, err = c.api.GetReleasePlan(noInstanceID, id, colour)
+		return err
+	})
+	return res, err
+}
+
+// ListJobs gives a page of jobs, as asked for, most recently
+// submitted first; the next page is asked for with the cursor given
+// as the page's Next.
+func (c *Client) ListJobs(q jobs.JobQuery) (res jobs.JobPage, err error) {
+	err = c.retry(func() (err error) {
+		res, err = c.api.ListJobs(noInstanceID, q)
+		return err
+	})
+	return res, err
+}
+
+// UpdatePolicies adds and removes policies for services.
+func (c *Client) UpdatePolicies(update flux.PolicyUpdate) (res []flux.PolicyResult, err error) {
+	err = c.retry(func() (err error) {
+		res, err = c.api.UpdatePolicies(noInstanceID, update)
+		return err
+	})
+	return res, err
+}
+
+func (c *Client) Automate(id flux.ServiceID) error {
+	return c.retry(func() error { return c.api.Automate(noInstanceID, id) })
+}
+
+func (c *Client) ConfirmImage(service flux.ServiceID, image flux.ImageID) error {
+	return c.retry(func() error { return c.api.ConfirmImage(noInstanceID, service, image) })
+}
+
+func (c *Client) Deautomate(id flux.ServiceID) error {
+	return c.retry(func() error { return c.api.Deautomate(noInstanceID, id) })
+}
+
+func (c *Client) Lock(id flux.ServiceID) error {
+	return c.retry(func() error { return c.api.Lock(noInstanceID, id) })
+}
+
+func (c *Client) Unlock(id flux.ServiceID) error {
+	return c.retry(func() error { return c.api.Unlock(noInstanceID, id) })
+}
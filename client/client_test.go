@@ -0,0 +1,91 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	for _, c := range []struct {
+		versions []string // nil means the service doesn't say
+		ok       bool
+	}{
+		{[]string{"v3", APIVersion}, true},
+		{[]string{"v3"}, false},
+		{nil, true},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c.versions == nil {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(c.versions)
+		}))
+		_, err := New(server.URL, "", Options{Retries: -1})
+		server.Close()
+		if c.ok && err != nil {
+			t.Errorf("versions %v: unexpected error: %v", c.versions, err)
+		}
+		if !c.ok && err != ErrUnsupportedVersion {
+			t.Errorf("versions %v: expected ErrUnsupportedVersion, got %v", c.versions, err)
+		}
+	}
+}
+
+func TestRetryWhenUnavailable(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/versions" {
+			json.NewEncoder(w).Encode([]string{APIVersion})
+			return
+		}
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode([]flux.ServiceStatus{{ID: flux.ServiceID("default/helloworld")}})
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL, "", Options{Retries: 3, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	services, err := c.ListServices("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || len(services) != 1 {
+		t.Errorf("expected one service after 3 calls, got %d after %d", len(services), calls)
+	}
+}
+
+func TestNoRetryWhenRefused(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/versions" {
+			json.NewEncoder(w).Encode([]string{APIVersion})
+			return
+		}
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL, "", Options{Retries: 3, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ListServices(""); err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls != 1 {
+		t.Errorf("expected one call, got %d", calls)
+	}
+}
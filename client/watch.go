@@ -0,0 +1,79 @@
+package client
+
+import (
+	"time"
+
+	"github.com/weaveworks/flux/jobs"
+)
+
+// ReleaseUpdate is the state of a release being watched, or the
+// error which stopped it being watched.
+type ReleaseUpdate struct {
+	Job jobs.Job
+	Err error
+}
+
+// WatchRelease polls the release every interval, sending the job each
+// time its status changes, until it's done, fails to be fetched (even
+// with retries), or stop is closed. The channel is closed afterwards;
+// the last thing sent is the finished job, or an error.
+func (c *Client) WatchRelease(id jobs.JobID, interval time.Duration, stop <-chan struct{}) <-chan ReleaseUpdate {
+	updates := make(chan ReleaseUpdate)
+	go func() {
+		defer close(updates)
+		send := func(u ReleaseUpdate) bool {
+			select {
+			case updates <- u:
+				return true
+			case <-stop:
+				return false
+			}
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var (
+			prevStatus string
+			first      = true
+		)
+		for {
+			job, err := c.GetRelease(id)
+			if err != nil {
+				send(ReleaseUpdate{Err: err})
+				return
+			}
+			if first || job.Status != prevStatus || job.Done {
+				if !send(ReleaseUpdate{Job: job}) || job.Done {
+					return
+				}
+			}
+			first, prevStatus = false, job.Status
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return updates
+}
+
+// WaitForRelease polls the release every interval until it's done,
+// calling progress (if not nil) each time its status changes, and
+// gives the finished job.
+func (c *Client) WaitForRelease(id jobs.JobID, interval time.Duration, progress func(jobs.Job)) (jobs.Job, error) {
+	stop := make(chan struct{})
+	defer close(stop)
+	var last jobs.Job
+	for u := range c.WatchRelease(id, interval, stop) {
+		if u.Err != nil {
+			return last, u.Err
+		}
+		last = u.Job
+		if progress != nil {
+			progress(u.Job)
+		}
+	}
+	return last, nil
+}
@@ -26,6 +26,7 @@ type serviceCheckReleaseOpts struct {
 	releaseID string
 	noFollow  bool
 	noTty     bool
+	log       bool
 }
 
 func newServiceCheckRelease(parent *serviceOpts) *serviceCheckReleaseOpts {
@@ -44,6 +45,7 @@ func (opts *serviceCheckReleaseOpts) Command() *cobra.Command {
 	cmd.Flags().StringVarP(&opts.releaseID, "release-id", "r", "", "release ID to check")
 	cmd.Flags().BoolVar(&opts.noFollow, "no-follow", false, "dump release job as JSON to stdout")
 	cmd.Flags().BoolVar(&opts.noTty, "no-tty", false, "forces simpler, non-TTY status output")
+	cmd.Flags().BoolVar(&opts.log, "log", false, "for a dry run, show the log of the release rather than a summary of its plan")
 	return cmd
 }
 
@@ -154,6 +156,15 @@ func (opts *serviceCheckReleaseOpts) RunE(cmd *cobra.Command, args []string) err
 	spec := job.Params.(jobs.ReleaseJobParams)
 
 	fmt.Fprintf(os.Stdout, "\n")
+	if job.Success && spec.Kind == flux.ReleaseKindPlan && !opts.log {
+		colour := !opts.noTty && isatty.IsTerminal(os.Stdout.Fd())
+		plan, err := opts.API.GetReleasePlan(noInstanceID, jobs.JobID(opts.releaseID), colour)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "%s", plan)
+		return nil
+	}
 	if !job.Success {
 		fmt.Fprintf(os.Stdout, "Here's as far as we got:\n")
 	} else if spec.Kind == flux.ReleaseKindPlan {
@@ -161,8 +172,13 @@ func (opts *serviceCheckReleaseOpts) RunE(cmd *cobra.Command, args []string) err
 	} else {
 		fmt.Fprintf(os.Stdout, "Here's what happened:\n")
 	}
-	for i, msg := range job.Log {
-		fmt.Fprintf(os.Stdout, " %d) %s\n", i+1, msg)
+	// The job comes with only the latest of its log
+	log, err := opts.API.GetReleaseLog(noInstanceID, jobs.JobID(opts.releaseID))
+	if err != nil {
+		return err
+	}
+	for i, entry := range log {
+		fmt.Fprintf(os.Stdout, " %d) %s\n", i+1, entry)
 	}
 
 	if spec.Kind == flux.ReleaseKindExecute {
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux"
+)
+
+type confirmImageOpts struct {
+	*serviceOpts
+	service string
+	image   string
+}
+
+func newConfirmImage(parent *serviceOpts) *confirmImageOpts {
+	return &confirmImageOpts{serviceOpts: parent}
+}
+
+func (opts *confirmImageOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "confirm-image",
+		Short: "Confirm an image suspect for a service, since a release of it was rolled back, so it may be released as the latest again.",
+		Example: makeExample(
+			"fluxctl confirm-image --service=default/helloworld --image=quay.io/weaveworks/helloworld:master-a000002",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Service the image is suspect for")
+	cmd.Flags().StringVarP(&opts.image, "image", "i", "", "Image to confirm")
+	return cmd
+}
+
+func (opts *confirmImageOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+	if opts.service == "" {
+		return newUsageError("-s, --service is required")
+	}
+	if opts.image == "" {
+		return newUsageError("-i, --image is required")
+	}
+
+	serviceID, err := flux.ParseServiceID(opts.service)
+	if err != nil {
+		return err
+	}
+	image, err := flux.ParseImageID(opts.image)
+	if err != nil {
+		return err
+	}
+
+	return opts.API.ConfirmImage(noInstanceID, serviceID, image)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type debugBundleOpts struct {
+	*rootOpts
+	output string
+}
+
+func newDebugBundle(parent *rootOpts) *debugBundleOpts {
+	return &debugBundleOpts{rootOpts: parent}
+}
+
+func (opts *debugBundleOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "debug-bundle",
+		Short: "Gather configuration (with secrets redacted), recent jobs and events, and daemon status, to attach to a support ticket",
+		Example: makeExample(
+			"fluxctl debug-bundle --output=flux-debug.json",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "", "File to write the bundle to; if not given, it's printed")
+	return cmd
+}
+
+func (opts *debugBundleOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+
+	bundle, err := opts.API.DebugBundle(noInstanceID)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.output != "" {
+		f, err := os.Create(opts.output)
+		if err != nil {
+			return errors.Wrap(err, "creating bundle file")
+		}
+		defer f.Close()
+		out = f
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(bundle); err != nil {
+		return errors.Wrap(err, "writing bundle")
+	}
+	if opts.output != "" {
+		fmt.Fprintf(os.Stderr, "Wrote debug bundle to %s\n", opts.output)
+		for _, e := range bundle.Errors {
+			fmt.Fprintf(os.Stderr, "Not included: %s\n", e)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+type explainAutomationOpts struct {
+	*serviceOpts
+}
+
+func newExplainAutomation(parent *serviceOpts) *explainAutomationOpts {
+	return &explainAutomationOpts{serviceOpts: parent}
+}
+
+func (opts *explainAutomationOpts) Command() *cobra.Command {
+	return &cobra.Command{
+		Use:   "explain-automation",
+		Short: "Show what automation would release if it ran now, and why it wouldn't release the rest, without releasing anything",
+		Example: makeExample(
+			"fluxctl explain-automation",
+		),
+		RunE: opts.RunE,
+	}
+}
+
+func (opts *explainAutomationOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+	checks, err := opts.API.ExplainAutomation(noInstanceID)
+	if err != nil {
+		return err
+	}
+	if len(checks) == 0 {
+		fmt.Println("No services are automated.")
+		return nil
+	}
+	out := newTabwriter()
+	fmt.Fprintln(out, "SERVICE\tCONTAINER\tCURRENT\tLATEST\tDECISION")
+	for _, c := range checks {
+		decision := "release"
+		if !c.Release {
+			decision = "skip: " + c.Reason
+		}
+		if c.Message != "" {
+			decision += " (" + c.Message + ")"
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\n", c.Service, c.Container, c.Current, c.Latest, decision)
+	}
+	out.Flush()
+	return nil
+}
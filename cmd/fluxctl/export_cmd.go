@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+type exportOpts struct {
+	*serviceOpts
+	output string
+}
+
+func newExport(parent *serviceOpts) *exportOpts {
+	return &exportOpts{serviceOpts: parent}
+}
+
+func (opts *exportOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write out the services defined in the config repo, with their images, policies and files, e.g., as a backup.",
+		Example: makeExample(
+			"fluxctl export > desired.yaml",
+			"fluxctl export --output=json",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "yaml", `The format to output ("yaml" or "json")`)
+	return cmd
+}
+
+func (opts *exportOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+
+	var marshal func(interface{}) ([]byte, error)
+	switch opts.output {
+	case "yaml":
+		marshal = yaml.Marshal
+	case "json":
+		marshal = func(v interface{}) ([]byte, error) {
+			return json.MarshalIndent(v, "", "  ")
+		}
+	default:
+		return newUsageError("unknown output format " + opts.output)
+	}
+
+	state, err := opts.API.Export(noInstanceID)
+	if err != nil {
+		return err
+	}
+	bytes, err := marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "marshalling to output format "+opts.output)
+	}
+	os.Stdout.Write(bytes)
+	return nil
+}
@@ -27,7 +27,7 @@ func (opts *serviceShowOpts) Command() *cobra.Command {
 		Example: makeExample("fluxctl list-images --service=default/foo"),
 		RunE:    opts.RunE,
 	}
-	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Show images for this service")
+	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Show images for this service, or services matching this glob or /regular expression/")
 	cmd.Flags().IntVarP(&opts.limit, "limit", "n", 10, "Number of images to show (0 for all)")
 	return cmd
 }
@@ -93,6 +93,8 @@ func (opts *serviceShowOpts) RunE(_ *cobra.Command, args []string) error {
 					createdAt := ""
 					if available.CreatedAt != nil {
 						createdAt = available.CreatedAt.Format(time.RFC822)
+					} else if available.Warning != "" {
+						createdAt = "(" + available.Warning + ")"
 					}
 					fmt.Fprintf(out, "\t\t%s %s\t%s\n", running, tag, createdAt)
 				}
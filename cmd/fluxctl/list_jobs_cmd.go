@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+)
+
+type listJobsOpts struct {
+	*rootOpts
+	method  string
+	state   string
+	service string
+	user    string
+	since   string
+	until   string
+	cursor  string
+	limit   int
+	output  string
+}
+
+func newListJobs(parent *rootOpts) *listJobsOpts {
+	return &listJobsOpts{rootOpts: parent}
+}
+
+func (opts *listJobsOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list-jobs",
+		Short: "List jobs, most recently submitted first",
+		Example: makeExample(
+			"fluxctl list-jobs --state=running",
+			"fluxctl list-jobs --method=release --service=default/foo --user=alice",
+			"fluxctl list-jobs --cursor=<next, from the previous page>",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVar(&opts.method, "method", "", `Only list jobs of this kind, e.g., "release"`)
+	cmd.Flags().StringVar(&opts.state, "state", "", `Only list jobs in this state: "queued", "running", "succeeded", "failed" or "done"`)
+	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Only list releases including this service")
+	cmd.Flags().StringVar(&opts.user, "user", "", "Only list releases submitted by this user")
+	cmd.Flags().StringVar(&opts.since, "since", "", "Only list jobs submitted at or after this time (RFC3339)")
+	cmd.Flags().StringVar(&opts.until, "until", "", "Only list jobs submitted before this time (RFC3339)")
+	cmd.Flags().StringVar(&opts.cursor, "cursor", "", "Carry on from where the previous page stopped")
+	cmd.Flags().IntVar(&opts.limit, "limit", 0, fmt.Sprintf("How many jobs to list (by default %d)", jobs.DefaultJobPageSize))
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "table", `Output format: "table" or "json"`)
+	return cmd
+}
+
+func (opts *listJobsOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+
+	q := jobs.JobQuery{
+		Method: opts.method,
+		State:  opts.state,
+		User:   opts.user,
+		Cursor: opts.cursor,
+		Limit:  opts.limit,
+	}
+	if opts.service != "" {
+		id, err := flux.ParseServiceID(opts.service)
+		if err != nil {
+			return err
+		}
+		q.Service = id
+	}
+	for _, t := range []struct {
+		flag, value string
+		dest        *time.Time
+	}{
+		{"since", opts.since, &q.Since},
+		{"until", opts.until, &q.Until},
+	} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, t.value)
+		if err != nil {
+			return errors.Wrapf(err, "parsing --%s", t.flag)
+		}
+		*t.dest = parsed
+	}
+	if err := q.Validate(); err != nil {
+		return newUsageError(err.Error())
+	}
+
+	page, err := opts.API.ListJobs(noInstanceID, q)
+	if err != nil {
+		return err
+	}
+
+	switch opts.output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(page)
+	case "table":
+		out := newTabwriter()
+		fmt.Fprintln(out, "SUBMITTED\tID\tMETHOD\tSTATE\tSTATUS")
+		for _, j := range page.Jobs {
+			fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\n", j.Submitted.Format(time.RFC822), j.ID, j.Method, j.State(), j.Status)
+		}
+		out.Flush()
+		if page.Next != "" {
+			fmt.Fprintf(os.Stdout, "\nThere are more; carry on with --cursor=%s\n", page.Next)
+		}
+		return nil
+	default:
+		return newUsageError(fmt.Sprintf("unknown output format %q", opts.output))
+	}
+}
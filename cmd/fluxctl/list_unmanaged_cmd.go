@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux"
+)
+
+type listUnmanagedOpts struct {
+	*serviceOpts
+}
+
+func newListUnmanaged(parent *serviceOpts) *listUnmanagedOpts {
+	return &listUnmanagedOpts{serviceOpts: parent}
+}
+
+func (opts *listUnmanagedOpts) Command() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list-unmanaged",
+		Short: "List services running but not defined in the config repo (with where to define them), or defined but not running",
+		RunE:  opts.RunE,
+	}
+}
+
+func (opts *listUnmanagedOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+	unmanaged, err := opts.API.UnmanagedResources(noInstanceID)
+	if err != nil {
+		return err
+	}
+	if len(unmanaged) == 0 {
+		fmt.Println("Every service running is defined in the config repo, and every service defined is running.")
+		return nil
+	}
+	out := newTabwriter()
+	fmt.Fprintln(out, "SERVICE\tSTATUS\tFILES")
+	for _, u := range unmanaged {
+		switch u.Reason {
+		case flux.UnmanagedNotInRepo:
+			fmt.Fprintf(out, "%s\tnot in config repo\t%s (suggested)\n", u.Service, u.SuggestedPath)
+		default:
+			fmt.Fprintf(out, "%s\tnot running\t%s\n", u.Service, strings.Join(u.Files, ", "))
+		}
+	}
+	out.Flush()
+	return nil
+}
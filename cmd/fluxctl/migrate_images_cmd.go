@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+)
+
+type migrateImagesOpts struct {
+	*serviceOpts
+	from     string
+	to       string
+	user     string
+	dryRun   bool
+	noFollow bool
+	noTty    bool
+}
+
+func newMigrateImages(parent *serviceOpts) *migrateImagesOpts {
+	return &migrateImagesOpts{serviceOpts: parent}
+}
+
+func (opts *migrateImagesOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate-images",
+		Short: "Move the images used throughout the config repo from one registry or repository to another, and release the services changed.",
+		Example: makeExample(
+			"fluxctl migrate-images --from=docker.io --to=registry.example.com/hub --dry-run",
+			"fluxctl migrate-images --from=quay.io/weaveworks --to=registry.example.com/weaveworks",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVar(&opts.from, "from", "", "registry, or repository prefix, to move images from; images without a registry are on Docker Hub (docker.io)")
+	cmd.Flags().StringVar(&opts.to, "to", "", "registry, or repository prefix, to move images to")
+	cmd.Flags().StringVar(&opts.user, "user", os.Getenv("USER"), "who is releasing, for the record kept with the commit, where the config repo is set up for that")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "do not change anything; just report back the changes that would be made to each file")
+	cmd.Flags().BoolVar(&opts.noFollow, "no-follow", false, "just submit the release job, don't invoke check-release afterwards")
+	cmd.Flags().BoolVar(&opts.noTty, "no-tty", false, "if not --no-follow, forces simpler, non-TTY status output")
+	return cmd
+}
+
+func (opts *migrateImagesOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+	migration := flux.ImageMigration{From: opts.from, To: opts.to}
+	if err := migration.Validate(); err != nil {
+		return newUsageError(err.Error())
+	}
+
+	var kind flux.ReleaseKind = flux.ReleaseKindExecute
+	if opts.dryRun {
+		kind = flux.ReleaseKindPlan
+		fmt.Fprintf(os.Stdout, "Submitting dry-run release job...\n")
+	} else {
+		fmt.Fprintf(os.Stdout, "Submitting release job...\n")
+	}
+
+	id, err := opts.API.PostRelease(noInstanceID, jobs.ReleaseJobParams{
+		Kind:          kind,
+		MigrateImages: &migration,
+		User:          opts.user,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "Release job submitted, ID %s\n", id)
+	if opts.noFollow {
+		fmt.Fprintf(os.Stdout, "To check the status of this release job, run\n")
+		fmt.Fprintf(os.Stdout, "\n")
+		fmt.Fprintf(os.Stdout, "\tfluxctl check-release --release-id=%s\n", id)
+		fmt.Fprintf(os.Stdout, "\n")
+		return nil
+	}
+	return (&serviceCheckReleaseOpts{
+		serviceOpts: opts.serviceOpts,
+		releaseID:   string(id),
+		noTty:       opts.noTty,
+	}).RunE(cmd, nil)
+}
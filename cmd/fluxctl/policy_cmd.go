@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux"
+)
+
+type policyOpts struct {
+	*serviceOpts
+	namespace         string
+	labels            []string
+	service           string
+	automate          bool
+	deautomate        bool
+	lock              bool
+	unlock            bool
+	tagFilter         string
+	noTagFilter       bool
+	minImageAge       time.Duration
+	newerOnly         bool
+	allowOlder        bool
+	restartEvery      time.Duration
+	noRestart         bool
+	releaseInterval   time.Duration
+	noReleaseInterval bool
+}
+
+func newPolicy(parent *serviceOpts) *policyOpts {
+	return &policyOpts{serviceOpts: parent}
+}
+
+func (opts *policyOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Set automation, lock, tag filter, image age, restart and release interval policies on many services at once.",
+		Example: makeExample(
+			"fluxctl policy --namespace=staging --automate",
+			"fluxctl policy --label=team=payments --lock",
+			"fluxctl policy --service='prod/*-api' --automate --tag-filter='release-*'",
+			"fluxctl policy --service='<all>' --unlock",
+			"fluxctl policy --namespace=prod --min-image-age=30m --newer-only",
+			"fluxctl policy --service=default/foo --restart-every=24h",
+			"fluxctl policy --service=prod/search --release-interval=30m",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "", "select services in this namespace")
+	cmd.Flags().StringSliceVarP(&opts.labels, "label", "l", []string{}, "select services with this label, given as key=value")
+	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "select this service, or the services matching a glob or /regular expression/, or <all>")
+	cmd.Flags().BoolVar(&opts.automate, "automate", false, "turn on automatic deployment")
+	cmd.Flags().BoolVar(&opts.deautomate, "deautomate", false, "turn off automatic deployment")
+	cmd.Flags().BoolVar(&opts.lock, "lock", false, "lock the services")
+	cmd.Flags().BoolVar(&opts.unlock, "unlock", false, "unlock the services")
+	cmd.Flags().StringVar(&opts.tagFilter, "tag-filter", "", "only automatically deploy images with tags matching this glob")
+	cmd.Flags().BoolVar(&opts.noTagFilter, "no-tag-filter", false, "remove any tag filter")
+	cmd.Flags().DurationVar(&opts.minImageAge, "min-image-age", -1, "only release images as the latest once they're this old, to the minute; 0 removes the minimum")
+	cmd.Flags().BoolVar(&opts.newerOnly, "newer-only", false, "only release images as the latest if they were built after the image running")
+	cmd.Flags().DurationVar(&opts.restartEvery, "restart-every", 0, "restart the services this often, e.g., to pick up rotated secrets; at least an hour")
+	cmd.Flags().BoolVar(&opts.noRestart, "no-restart", false, "stop restarting the services on schedule")
+	cmd.Flags().DurationVar(&opts.releaseInterval, "release-interval", 0, "release the services at most once in this long; automated releases which would come sooner are held back until it's passed")
+	cmd.Flags().BoolVar(&opts.noReleaseInterval, "no-release-interval", false, "let the services be released as often as there are new images")
+	cmd.Flags().BoolVar(&opts.allowOlder, "allow-older", false, "release images as the latest even if they were built before the image running")
+	return cmd
+}
+
+func (opts *policyOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+	if opts.namespace == "" && len(opts.labels) == 0 && opts.service == "" {
+		return newUsageError("at least one of --namespace, --label and --service is required")
+	}
+	if opts.automate && opts.deautomate {
+		return newUsageError("--automate and --deautomate are mutually exclusive")
+	}
+	if opts.lock && opts.unlock {
+		return newUsageError("--lock and --unlock are mutually exclusive")
+	}
+	if opts.tagFilter != "" && opts.noTagFilter {
+		return newUsageError("--tag-filter and --no-tag-filter are mutually exclusive")
+	}
+	if opts.newerOnly && opts.allowOlder {
+		return newUsageError("--newer-only and --allow-older are mutually exclusive")
+	}
+	if opts.restartEvery != 0 && opts.noRestart {
+		return newUsageError("--restart-every and --no-restart are mutually exclusive")
+	}
+	if opts.releaseInterval != 0 && opts.noReleaseInterval {
+		return newUsageError("--release-interval and --no-release-interval are mutually exclusive")
+	}
+
+	update := flux.PolicyUpdate{
+		Namespace: opts.namespace,
+	}
+	if opts.service != "" {
+		spec, err := flux.ParseServiceSpec(opts.service)
+		if err != nil {
+			return err
+		}
+		update.Spec = spec
+	}
+	if len(opts.labels) > 0 {
+		update.Labels = map[string]string{}
+		for _, l := range opts.labels {
+			kv := strings.SplitN(l, "=", 2)
+			if len(kv) != 2 {
+				return newUsageError(fmt.Sprintf("expected --label key=value, got %q", l))
+			}
+			update.Labels[kv[0]] = kv[1]
+		}
+	}
+	if opts.automate || opts.deautomate {
+		update.Automate = &opts.automate
+	}
+	if opts.lock || opts.unlock {
+		update.Lock = &opts.lock
+	}
+	if opts.tagFilter != "" || opts.noTagFilter {
+		update.TagFilter = &opts.tagFilter
+	}
+	if opts.minImageAge >= 0 {
+		minutes := int(opts.minImageAge / time.Minute)
+		update.MinImageAge = &minutes
+	}
+	if opts.newerOnly || opts.allowOlder {
+		update.NewerOnly = &opts.newerOnly
+	}
+	if opts.restartEvery != 0 || opts.noRestart {
+		every := ""
+		if opts.restartEvery != 0 {
+			every = opts.restartEvery.String()
+		}
+		update.RestartEvery = &every
+	}
+	if opts.releaseInterval != 0 || opts.noReleaseInterval {
+		interval := ""
+		if opts.releaseInterval != 0 {
+			interval = opts.releaseInterval.String()
+		}
+		update.ReleaseInterval = &interval
+	}
+	if update.Automate == nil && update.Lock == nil && update.TagFilter == nil && update.MinImageAge == nil && update.NewerOnly == nil && update.RestartEvery == nil && update.ReleaseInterval == nil {
+		return newUsageError("no policy given; use --automate, --deautomate, --lock, --unlock, --tag-filter, --no-tag-filter, --min-image-age, --newer-only, --allow-older, --restart-every, --no-restart, --release-interval or --no-release-interval")
+	}
+
+	results, err := opts.API.UpdatePolicies(noInstanceID, update)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		fmt.Println("No services selected.")
+		return nil
+	}
+
+	out := newTabwriter()
+	fmt.Fprintln(out, "SERVICE\tRESULT")
+	var failed int
+	for _, r := range results {
+		result := "updated"
+		if r.Error != "" {
+			result = "failed: " + r.Error
+			failed++
+		}
+		fmt.Fprintf(out, "%s\t%s\n", r.Service, result)
+	}
+	out.Flush()
+	if failed > 0 {
+		return fmt.Errorf("failed to update %d of %d services", failed, len(results))
+	}
+	return nil
+}
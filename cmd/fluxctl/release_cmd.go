@@ -3,24 +3,39 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform"
 )
 
 type serviceReleaseOpts struct {
 	*serviceOpts
 	service     string
 	allServices bool
+	using       string
+	updateRepo  string
+	container   string
 	image       string
 	allImages   bool
+	allAllowed  bool
 	noUpdate    bool
+	restart     bool
 	exclude     []string
 	dryRun      bool
 	noFollow    bool
 	noTty       bool
+	refuseDrift bool
+	applyRes    bool
+	prune       string
+	serverCheck bool
+	wait        bool
+	waitTimeout time.Duration
+	user        string
+	snapshot    string
 }
 
 func newServiceRelease(parent *serviceOpts) *serviceReleaseOpts {
@@ -36,15 +51,35 @@ func (opts *serviceReleaseOpts) Command() *cobra.Command {
 			"fluxctl release --all --update-image=library/hello:v2",
 			"fluxctl release --service=default/foo --update-all-images",
 			"fluxctl release --service=default/foo --no-update",
+			"fluxctl release --service=default/foo --restart",
+			"fluxctl release --service='prod/*-api' --update-all-images",
+			"fluxctl release --service='/^team-a-/' --update-all-images",
+			"fluxctl release --using=library/hello --update-image=library/hello:v2",
+			"fluxctl release --update-repository=library/hello",
+			"fluxctl release --service=default/foo --container=sidecar --update-image=library/proxy:v3",
+			"fluxctl release --snapshot=cluster.json --all --update-all-images",
 		),
 		RunE: opts.RunE,
 	}
-	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "service to release")
+	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "service to release; or a glob (e.g., prod/*-api), or regular expression between slashes (e.g., /^team-a-/), matching services")
 	cmd.Flags().BoolVar(&opts.allServices, "all", false, "release all services")
+	cmd.Flags().StringVar(&opts.using, "using", "", "release all services running any tag of this image repository")
+	cmd.Flags().StringVar(&opts.container, "container", "", "with --service and --update-image, update only this container of the service")
 	cmd.Flags().StringVarP(&opts.image, "update-image", "i", "", "update a specific image")
 	cmd.Flags().BoolVar(&opts.allImages, "update-all-images", false, "update all images to latest versions")
+	cmd.Flags().BoolVar(&opts.allAllowed, "update-all-allowed", false, "update all images to the latest versions each service is allowed (by its tag filter, if it has one)")
+	cmd.Flags().StringVar(&opts.updateRepo, "update-repository", "", "update every service running any tag of this image repository to the latest tag it's allowed (by its tag filter, if it has one); other images are left alone")
 	cmd.Flags().BoolVar(&opts.noUpdate, "no-update", false, "don't update images; just deploy the service(s) as configured in the git repo")
+	cmd.Flags().BoolVar(&opts.restart, "restart", false, "don't update images; restart the service(s), replacing their pods, e.g., so they pick up rotated secrets")
 	cmd.Flags().StringSliceVar(&opts.exclude, "exclude", []string{}, "exclude a service")
+	cmd.Flags().BoolVar(&opts.refuseDrift, "refuse-drift", false, "fail the release if a service's environment or resources have been changed in the cluster, rather than overwrite the changes")
+	cmd.Flags().BoolVar(&opts.applyRes, "apply-resources", false, "also apply the other resources (ConfigMaps, Services, Ingresses, ...) defined in the config repo")
+	cmd.Flags().StringVar(&opts.prune, "prune", "", "with --apply-resources, delete resources matching this label selector that are no longer defined in the config repo")
+	cmd.Flags().BoolVar(&opts.serverCheck, "server-dry-run", false, "have the cluster validate the updated definitions (including with admission controllers) before committing them, where it's able")
+	cmd.Flags().BoolVar(&opts.wait, "wait", false, "don't finish the release until the services are running the new images")
+	cmd.Flags().DurationVar(&opts.waitTimeout, "wait-timeout", 0, "with --wait, how long to wait for the rollout before failing; 0 means the server's default")
+	cmd.Flags().StringVar(&opts.user, "user", os.Getenv("USER"), "who is releasing, for the record kept with the commit, where the config repo is set up for that")
+	cmd.Flags().StringVar(&opts.snapshot, "snapshot", "", "plan the release against a snapshot recorded with fluxctl snapshot, rather than the live platform; implies --dry-run")
 	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "do not release anything; just report back what would have been done")
 	cmd.Flags().BoolVar(&opts.noFollow, "no-follow", false, "just submit the release job, don't invoke check-release afterwards")
 	cmd.Flags().BoolVar(&opts.noTty, "no-tty", false, "if not --no-follow, forces simpler, non-TTY status output")
@@ -56,29 +91,93 @@ func (opts *serviceReleaseOpts) RunE(cmd *cobra.Command, args []string) error {
 		return errorWantedNoArgs
 	}
 
-	if err := checkExactlyOne("--update-image=<image>, --update-all-images, or --no-update", opts.image != "", opts.allImages, opts.noUpdate); err != nil {
+	if err := checkExactlyOne("--update-image=<image>, --update-all-images, --update-all-allowed, --update-repository=<repository>, --no-update, or --restart", opts.image != "", opts.allImages, opts.allAllowed, opts.updateRepo != "", opts.noUpdate, opts.restart); err != nil {
 		return err
 	}
 
-	if err := checkExactlyOne("--service=<service>, or --all", opts.service != "", opts.allServices); err != nil {
+	if opts.updateRepo != "" {
+		// The services are those using the repository, unless
+		// they're narrowed down.
+		if opts.using != "" {
+			return newUsageError("--update-repository selects the services using the repository; --using is not needed")
+		}
+		if opts.service == "" && !opts.allServices {
+			opts.using = opts.updateRepo
+		}
+	}
+	if err := checkExactlyOne("--service=<service>, --using=<repository>, or --all", opts.service != "", opts.using != "", opts.allServices); err != nil {
 		return err
 	}
 
-	service, err := parseServiceOption(opts.service) // will be "" iff opts.allServices
-	if err != nil {
-		return err
+	var service flux.ServiceSpec
+	if opts.using != "" {
+		service = flux.ServiceSpecUsing(opts.using)
+	} else {
+		var err error
+		service, err = parseServiceOption(opts.service) // will be "" iff opts.allServices
+		if err != nil {
+			return err
+		}
 	}
 
 	var image flux.ImageSpec
 	switch {
 	case opts.image != "":
-		image = flux.ParseImageSpec(opts.image)
+		spec, err := flux.ParseImageSpec(opts.image)
+		if err != nil {
+			return newUsageError(err.Error())
+		}
+		image = spec
 	case opts.allImages:
 		image = flux.ImageSpecLatest
-	case opts.noUpdate:
+	case opts.allAllowed:
+		image = flux.ImageSpecLatestAllowed
+	case opts.updateRepo != "":
+		image = flux.ImageSpecLatestOf(opts.updateRepo)
+	case opts.noUpdate, opts.restart:
 		image = flux.ImageSpecNone
 	}
 
+	var targets []jobs.ContainerTarget
+	if opts.container != "" {
+		if opts.image == "" {
+			return newUsageError("--container can only be used with --update-image")
+		}
+		id, err := flux.ParseServiceID(opts.service)
+		if err != nil {
+			return newUsageError("--container can only be used with a single --service: " + err.Error())
+		}
+		imageID, err := flux.ParseImageID(opts.image)
+		if err != nil {
+			return newUsageError(err.Error())
+		}
+		targets = append(targets, jobs.ContainerTarget{
+			Service:   id,
+			Container: opts.container,
+			Image:     imageID,
+		})
+	}
+
+	if opts.prune != "" && !opts.applyRes {
+		return newUsageError("--prune can only be used with --apply-resources")
+	}
+	var waitTimeout string
+	if opts.waitTimeout != 0 {
+		if !opts.wait {
+			return newUsageError("--wait-timeout can only be used with --wait")
+		}
+		waitTimeout = opts.waitTimeout.String()
+	}
+
+	var snapshot *platform.Snapshot
+	if opts.snapshot != "" {
+		var err error
+		if snapshot, err = readSnapshot(opts.snapshot); err != nil {
+			return err
+		}
+		opts.dryRun = true
+	}
+
 	var kind flux.ReleaseKind = flux.ReleaseKindExecute
 	if opts.dryRun {
 		kind = flux.ReleaseKindPlan
@@ -100,10 +199,20 @@ func (opts *serviceReleaseOpts) RunE(cmd *cobra.Command, args []string) error {
 	}
 
 	id, err := opts.API.PostRelease(noInstanceID, jobs.ReleaseJobParams{
-		ServiceSpec: service,
-		ImageSpec:   image,
-		Kind:        kind,
-		Excludes:    excludes,
+		ServiceSpec:      service,
+		ImageSpec:        image,
+		Kind:             kind,
+		Excludes:         excludes,
+		ContainerTargets: targets,
+		Restart:          opts.restart,
+		RefuseOnDrift:    opts.refuseDrift,
+		ApplyResources:   opts.applyRes,
+		PruneSelector:    opts.prune,
+		ServerDryRun:     opts.serverCheck,
+		WaitForRollout:   opts.wait,
+		RolloutTimeout:   waitTimeout,
+		User:             opts.user,
+		Snapshot:         snapshot,
 	})
 	if err != nil {
 		return err
@@ -62,7 +62,7 @@ func (opts *rootOpts) Command() *cobra.Command {
 	cmd.PersistentFlags().StringVarP(&opts.URL, "url", "u", "https://cloud.weave.works/api/flux",
 		fmt.Sprintf("base URL of the flux service; you can also set the environment variable %s", envVariableURL))
 	cmd.PersistentFlags().StringVarP(&opts.Token, "token", "t", "",
-		fmt.Sprintf("Weave Cloud service token; you can also set the environment variable %s", envVariableToken))
+		fmt.Sprintf("Weave Cloud service token, or API token made with create-token; you can also set the environment variable %s", envVariableToken))
 
 	svcopts := newService(opts)
 
@@ -71,15 +71,31 @@ func (opts *rootOpts) Command() *cobra.Command {
 		newStatus(opts).Command(),
 		newServiceShow(svcopts).Command(),
 		newServiceList(svcopts).Command(),
+		newSnapshot(svcopts).Command(),
+		newListUnmanaged(svcopts).Command(),
+		newExplainAutomation(svcopts).Command(),
+		newExport(svcopts).Command(),
 		newServiceRelease(svcopts).Command(),
 		newServiceCheckRelease(svcopts).Command(),
+		newMigrateImages(svcopts).Command(),
+		newListJobs(opts).Command(),
 		newServiceHistory(svcopts).Command(),
+		newTimeline(svcopts).Command(),
 		newServiceAutomate(svcopts).Command(),
 		newServiceDeautomate(svcopts).Command(),
+		newConfirmImage(svcopts).Command(),
 		newServiceLock(svcopts).Command(),
 		newServiceUnlock(svcopts).Command(),
+		newPolicy(svcopts).Command(),
 		newGetConfig(opts).Command(),
 		newSetConfig(opts).Command(),
+		newGetTemplate(opts).Command(),
+		newApplyTemplate(opts).Command(),
+		newListTokens(opts).Command(),
+		newCreateToken(opts).Command(),
+		newRotateToken(opts).Command(),
+		newRevokeToken(opts).Command(),
+		newDebugBundle(opts).Command(),
 	)
 
 	return cmd
@@ -28,7 +28,7 @@ func (opts *setConfigOpts) Command() *cobra.Command {
 		),
 		RunE: opts.RunE,
 	}
-	cmd.Flags().StringVarP(&opts.file, "file", "f", "", "A file to upload as configuration; this will overwrite all values.")
+	cmd.Flags().StringVarP(&opts.file, "file", "f", "", "A file to upload as configuration; this will overwrite all values. If it gives a version (as from get-config), it is refused if the config has changed since.")
 	return cmd
 }
 
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/platform"
+)
+
+type snapshotOpts struct {
+	*serviceOpts
+	namespace string
+}
+
+func newSnapshot(parent *serviceOpts) *snapshotOpts {
+	return &snapshotOpts{serviceOpts: parent}
+}
+
+func (opts *snapshotOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Record the services running on the platform, to plan releases against later.",
+		Example: makeExample(
+			"fluxctl snapshot > cluster.json",
+			"fluxctl release --snapshot=cluster.json --all --update-all-images",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "", "Namespace to record, blank for all namespaces")
+	return cmd
+}
+
+func (opts *snapshotOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+
+	services, err := opts.API.ListServices(noInstanceID, opts.namespace)
+	if err != nil {
+		return err
+	}
+
+	snapshot := platform.Snapshot{Taken: time.Now().UTC()}
+	for _, s := range services {
+		service := platform.Service{
+			ID:             s.ID,
+			Status:         s.Status,
+			Labels:         s.Labels,
+			Annotations:    s.Annotations,
+			ControllerKind: s.Controller,
+			Replicas:       s.Replicas,
+		}
+		for _, c := range s.Containers {
+			service.Containers.Containers = append(service.Containers.Containers, platform.Container{
+				Name:  c.Name,
+				Image: c.Current.ID.String(),
+			})
+		}
+		snapshot.Services = append(snapshot.Services, service)
+	}
+
+	bytes, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling snapshot")
+	}
+	os.Stdout.Write(bytes)
+	return nil
+}
+
+// readSnapshot reads a snapshot written by `fluxctl snapshot`.
+func readSnapshot(path string) (*platform.Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var snapshot platform.Snapshot
+	if err := json.NewDecoder(f).Decode(&snapshot); err != nil {
+		return nil, errors.Wrapf(err, "decoding snapshot %s", path)
+	}
+	return &snapshot, nil
+}
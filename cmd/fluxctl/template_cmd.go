@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux/api"
+)
+
+type getTemplateOpts struct {
+	*rootOpts
+	output string
+}
+
+func newGetTemplate(parent *rootOpts) *getTemplateOpts {
+	return &getTemplateOpts{rootOpts: parent}
+}
+
+func (opts *getTemplateOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get-template",
+		Short: "display an instance's configuration, less its secrets, as a template for new instances",
+		Example: makeExample(
+			"fluxctl get-template > team-template.yaml",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "yaml", `The format to output ("yaml" or "json")`)
+	return cmd
+}
+
+func (opts *getTemplateOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+
+	var marshal func(interface{}) ([]byte, error)
+	switch opts.output {
+	case "yaml":
+		marshal = yaml.Marshal
+	case "json":
+		marshal = func(v interface{}) ([]byte, error) {
+			return json.MarshalIndent(v, "", "  ")
+		}
+	default:
+		return errors.New("unknown output format " + opts.output)
+	}
+
+	template, err := opts.API.GetTemplate(noInstanceID)
+	if err != nil {
+		return err
+	}
+	bytes, err := marshal(template)
+	if err != nil {
+		return errors.Wrap(err, "marshalling to output format "+opts.output)
+	}
+	os.Stdout.Write(bytes)
+	return nil
+}
+
+type applyTemplateOpts struct {
+	*rootOpts
+	file string
+}
+
+func newApplyTemplate(parent *rootOpts) *applyTemplateOpts {
+	return &applyTemplateOpts{rootOpts: parent}
+}
+
+func (opts *applyTemplateOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply-template",
+		Short: "set up a new instance from a template, as from get-template",
+		Example: makeExample(
+			"fluxctl --token=$OTHER_TOKEN get-template > team-template.yaml",
+			"fluxctl apply-template --file=team-template.yaml",
+			"fluxctl get-config > config.yaml # then fill in the secrets, and",
+			"fluxctl set-config --file=config.yaml",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.file, "file", "f", "", "The template to apply; it is refused if the instance is configured already")
+	return cmd
+}
+
+func (opts *applyTemplateOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+
+	if opts.file == "" {
+		return newUsageError("-f, --file is required")
+	}
+
+	var template api.InstanceTemplate
+	bytes, err := ioutil.ReadFile(opts.file)
+	if err == nil {
+		err = yaml.Unmarshal(bytes, &template)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "reading template from file")
+	}
+
+	return opts.API.ApplyTemplate(noInstanceID, template)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux"
+)
+
+type timelineOpts struct {
+	*serviceOpts
+	service string
+	branch  string
+	since   string
+	until   string
+	at      string
+	output  string
+}
+
+func newTimeline(parent *serviceOpts) *timelineOpts {
+	return &timelineOpts{serviceOpts: parent}
+}
+
+func (opts *timelineOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "timeline",
+		Short: "Show which images were released where, and when",
+		Example: makeExample(
+			"fluxctl timeline --service=default/foo",
+			"fluxctl timeline --branch=production --since=2017-01-01T00:00:00Z --output=csv",
+			"fluxctl timeline --at=2017-01-31T12:00:00Z",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Only show releases of this service")
+	cmd.Flags().StringVarP(&opts.branch, "branch", "b", "", "Only show releases from this branch of the config repo")
+	cmd.Flags().StringVar(&opts.since, "since", "", "Only show releases at or after this time (RFC3339)")
+	cmd.Flags().StringVar(&opts.until, "until", "", "Only show releases at or before this time (RFC3339)")
+	cmd.Flags().StringVar(&opts.at, "at", "", "Show what was deployed at this time (RFC3339), rather than each release")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "table", `Output format: "table", "csv" or "json"`)
+	return cmd
+}
+
+func (opts *timelineOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+
+	var q flux.TimelineQuery
+	if opts.service != "" {
+		id, err := flux.ParseServiceID(opts.service)
+		if err != nil {
+			return err
+		}
+		q.Service = id
+	}
+	q.Branch = opts.branch
+	for _, t := range []struct {
+		flag, value string
+		dest        *time.Time
+	}{
+		{"since", opts.since, &q.Since},
+		{"until", opts.until, &q.Until},
+		{"at", opts.at, &q.Until},
+	} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, t.value)
+		if err != nil {
+			return errors.Wrapf(err, "parsing --%s", t.flag)
+		}
+		*t.dest = parsed
+	}
+	if opts.at != "" && (opts.since != "" || opts.until != "") {
+		return newUsageError("--at cannot be used with --since or --until")
+	}
+
+	releases, err := opts.API.Timeline(noInstanceID, q)
+	if err != nil {
+		return err
+	}
+	if opts.at != "" {
+		releases = deployedAt(releases)
+	}
+
+	switch opts.output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(releases)
+	case "csv":
+		out := csv.NewWriter(os.Stdout)
+		out.Write([]string{"time", "service", "container", "from", "to", "to_digest", "branch", "revision"})
+		for _, r := range releases {
+			out.Write([]string{r.Stamp.Format(time.RFC3339), string(r.Service), r.Container, r.From.String(), r.To.String(), r.ToDigest, r.Branch, r.Revision})
+		}
+		out.Flush()
+		return out.Error()
+	case "table":
+		out := newTabwriter()
+		fmt.Fprintln(out, "TIME\tSERVICE\tCONTAINER\tIMAGE\tBRANCH\tREVISION")
+		for _, r := range releases {
+			fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Stamp.Format(time.RFC822), r.Service, r.Container, r.To, r.Branch, r.Revision)
+		}
+		out.Flush()
+		return nil
+	default:
+		return newUsageError(fmt.Sprintf("unknown output format %q", opts.output))
+	}
+}
+
+// deployedAt reduces a timeline, in ascending order, to the last
+// release of each container (of each service, in each branch).
+func deployedAt(releases []flux.ImageRelease) []flux.ImageRelease {
+	type key struct {
+		service   flux.ServiceID
+		container string
+		branch    string
+	}
+	latest := map[key]int{}
+	var keys []key
+	for i, r := range releases {
+		if r.Failed {
+			continue
+		}
+		k := key{r.Service, r.Container, r.Branch}
+		if _, ok := latest[k]; !ok {
+			keys = append(keys, k)
+		}
+		latest[k] = i
+	}
+	res := make([]flux.ImageRelease, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, releases[latest[k]])
+	}
+	return res
+}
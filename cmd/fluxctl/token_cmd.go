@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/api"
+	"github.com/weaveworks/flux/auth"
+)
+
+type listTokensOpts struct {
+	*rootOpts
+}
+
+func newListTokens(parent *rootOpts) *listTokensOpts {
+	return &listTokensOpts{rootOpts: parent}
+}
+
+func (opts *listTokensOpts) Command() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list-tokens",
+		Short: "List the instance's API tokens",
+		RunE:  opts.RunE,
+	}
+}
+
+func (opts *listTokensOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+	tokens, err := opts.API.ListTokens(noInstanceID)
+	if err != nil {
+		return err
+	}
+	out := newTabwriter()
+	fmt.Fprintln(out, "ID\tNAME\tSCOPES\tRATE LIMIT\tCREATED\tROTATED")
+	for _, t := range tokens {
+		rate, rotated := "default", ""
+		if t.RateLimit > 0 {
+			rate = fmt.Sprintf("%d/min", t.RateLimit)
+		}
+		if t.RotatedAt != nil {
+			rotated = t.RotatedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, scopesString(t.Scopes), rate, t.CreatedAt.Format("2006-01-02 15:04:05"), rotated)
+	}
+	out.Flush()
+	return nil
+}
+
+type createTokenOpts struct {
+	*rootOpts
+	name      string
+	scopes    []string
+	rateLimit int
+}
+
+func newCreateToken(parent *rootOpts) *createTokenOpts {
+	return &createTokenOpts{rootOpts: parent}
+}
+
+func (opts *createTokenOpts) Command() *cobra.Command {
+	var known []string
+	for _, s := range auth.KnownScopes {
+		known = append(known, string(s))
+	}
+	cmd := &cobra.Command{
+		Use:   "create-token",
+		Short: "Create an API token for the instance; its secret is only shown now",
+		Example: makeExample(
+			"fluxctl create-token --name=ci --scope=release",
+			"fluxctl create-token --name=dashboard --scope=read --rate-limit=30",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVar(&opts.name, "name", "", "What the token is for")
+	cmd.Flags().StringSliceVar(&opts.scopes, "scope", nil, fmt.Sprintf("What the token allows (one of %s); may be repeated. Each of read, release and admin includes those before it", strings.Join(known, ", ")))
+	cmd.Flags().IntVar(&opts.rateLimit, "rate-limit", 0, "Requests a minute that may be made with the token; zero means the service's default")
+	return cmd
+}
+
+func (opts *createTokenOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+	spec := auth.TokenSpec{Name: opts.name, RateLimit: opts.rateLimit}
+	for _, s := range opts.scopes {
+		scope, err := auth.ParseScope(s)
+		if err != nil {
+			return newUsageError(err.Error())
+		}
+		spec.Scopes = append(spec.Scopes, scope)
+	}
+	if err := spec.Validate(); err != nil {
+		return newUsageError(err.Error())
+	}
+	t, err := opts.API.CreateToken(noInstanceID, spec)
+	if err != nil {
+		return err
+	}
+	printNewToken(t)
+	return nil
+}
+
+type rotateTokenOpts struct {
+	*rootOpts
+	id string
+}
+
+func newRotateToken(parent *rootOpts) *rotateTokenOpts {
+	return &rotateTokenOpts{rootOpts: parent}
+}
+
+func (opts *rotateTokenOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "rotate-token",
+		Short:   "Give an API token a new secret; the old one is no longer accepted",
+		Example: makeExample("fluxctl rotate-token --id=<ID, from list-tokens>"),
+		RunE:    opts.RunE,
+	}
+	cmd.Flags().StringVar(&opts.id, "id", "", "ID of the token to rotate")
+	return cmd
+}
+
+func (opts *rotateTokenOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+	if opts.id == "" {
+		return newUsageError("--id is required")
+	}
+	t, err := opts.API.RotateToken(noInstanceID, auth.TokenID(opts.id))
+	if err != nil {
+		return err
+	}
+	printNewToken(t)
+	return nil
+}
+
+type revokeTokenOpts struct {
+	*rootOpts
+	id string
+}
+
+func newRevokeToken(parent *rootOpts) *revokeTokenOpts {
+	return &revokeTokenOpts{rootOpts: parent}
+}
+
+func (opts *revokeTokenOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "revoke-token",
+		Short:   "Revoke an API token, so it is no longer accepted",
+		Example: makeExample("fluxctl revoke-token --id=<ID, from list-tokens>"),
+		RunE:    opts.RunE,
+	}
+	cmd.Flags().StringVar(&opts.id, "id", "", "ID of the token to revoke")
+	return cmd
+}
+
+func (opts *revokeTokenOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+	if opts.id == "" {
+		return newUsageError("--id is required")
+	}
+	return opts.API.RevokeToken(noInstanceID, auth.TokenID(opts.id))
+}
+
+func printNewToken(t api.NewToken) {
+	fmt.Printf("Token %q (%s), with scopes %s.\n", t.Name, t.ID, scopesString(t.Scopes))
+	fmt.Println("Keep the secret somewhere safe; it can't be shown again:")
+	fmt.Println(t.Secret)
+}
+
+func scopesString(scopes []auth.Scope) string {
+	var strs []string
+	for _, s := range scopes {
+		strs = append(strs, string(s))
+	}
+	return strings.Join(strs, ",")
+}
@@ -6,8 +6,10 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
 	"github.com/go-kit/kit/metrics/prometheus"
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -15,11 +17,16 @@ import (
 	"k8s.io/kubernetes/pkg/client/restclient"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/health"
 	transport "github.com/weaveworks/flux/http"
 	"github.com/weaveworks/flux/platform"
 	"github.com/weaveworks/flux/platform/kubernetes"
 )
 
+// connectLivenessTimeout is how long the daemon can spend on one
+// attempt to connect to fluxsvc before it's considered stuck.
+const connectLivenessTimeout = 2 * time.Minute
+
 var version string
 
 func main() {
@@ -34,7 +41,7 @@ func main() {
 	}
 	// This mirrors how kubectl extracts information from the environment.
 	var (
-		listenAddr        = fs.StringP("listen", "l", ":3031", "Listen address where /metrics will be served")
+		listenAddr        = fs.StringP("listen", "l", ":3031", "Listen address where /metrics, /healthz and /readyz will be served")
 		fluxsvcAddress    = fs.String("fluxsvc-address", "wss://cloud.weave.works/api/flux", "Address of the fluxsvc to connect to.")
 		token             = fs.String("token", "", "Token to use to authenticate with flux service")
 		kubernetesKubectl = fs.String("kubernetes-kubectl", "", "Optional, explicit path to kubectl tool")
@@ -91,6 +98,7 @@ func main() {
 	// Instrumentation
 	var (
 		daemonMetrics transport.DaemonMetrics
+		healthStatus  metrics.Gauge
 	)
 	{
 		k8s = platform.Instrument(k8s, platform.NewMetrics())
@@ -100,6 +108,12 @@ func main() {
 			Name:      "connection_duration_seconds",
 			Help:      "Duration in seconds of the current connection to fluxsvc. Zero means unconnected.",
 		}, []string{"target"})
+		healthStatus = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "flux",
+			Subsystem: "fluxd",
+			Name:      "health_check_status",
+			Help:      "Result of each health check when last probed; 1 means it passed.",
+		}, []string{"endpoint", health.LabelCheck})
 	}
 
 	// Connect to fluxsvc
@@ -127,11 +141,19 @@ func main() {
 		errc <- fmt.Errorf("%s", <-c)
 	}()
 
-	// HTTP transport component, for metrics
+	// HTTP transport component, for metrics and health checks
 	go func() {
 		logger.Log("addr", *listenAddr)
 		mux := http.NewServeMux()
 		mux.Handle("/metrics", promhttp.Handler())
+		health.Register(mux, health.Checks{
+			"connection loop": func() error {
+				return daemon.Alive(connectLivenessTimeout)
+			},
+		}, health.Checks{
+			"fluxsvc connection": daemon.Connected,
+			"platform":           k8s.Ping,
+		}, healthStatus)
 		errc <- http.ListenAndServe(*listenAddr, mux)
 	}()
 
@@ -0,0 +1,139 @@
+// Package commitstatus posts statuses to the commits of config repos,
+// on GitHub or GitLab, so that those looking at a repo can see which
+// of its commits have been applied to the cluster.
+package commitstatus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+// Status is what's posted to a commit.
+type Status struct {
+	Revision string
+	// Context tells statuses from different sources apart, e.g.,
+	// "flux/production".
+	Context     string
+	Description string
+}
+
+// Poster posts statuses to the commits of a config repo.
+type Poster interface {
+	Post(Status) error
+}
+
+// New gives a poster for the config repo at the URL given, on the host
+// configured.
+func New(config flux.CommitStatusConfig, repoURL string, d flux.Doer) (Poster, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	project := config.Project
+	if project == "" {
+		var err error
+		if project, err = ProjectFromURL(repoURL); err != nil {
+			return nil, err
+		}
+	}
+	c := client{d: d, config: config, project: project}
+	switch config.Host {
+	case flux.CommitStatusGitHub:
+		if c.config.URL == "" {
+			c.config.URL = "https://api.github.com"
+		}
+		return github{c}, nil
+	case flux.CommitStatusGitLab:
+		if c.config.URL == "" {
+			c.config.URL = "https://gitlab.com"
+		}
+		return gitlab{c}, nil
+	}
+	return nil, fmt.Errorf("unknown commit status host %q", config.Host)
+}
+
+// ProjectFromURL gives the path of a repo on its host, e.g.,
+// "myorg/conf", from its URL; either a URL proper, or scp-like, as in
+// "git@github.com:myorg/conf.git".
+func ProjectFromURL(repoURL string) (string, error) {
+	var path string
+	if strings.Contains(repoURL, "://") {
+		u, err := url.Parse(repoURL)
+		if err != nil {
+			return "", errors.Wrapf(err, "parsing repo URL %q", repoURL)
+		}
+		path = u.Path
+	} else if i := strings.Index(repoURL, ":"); i > 0 {
+		path = repoURL[i+1:]
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if !strings.Contains(path, "/") {
+		return "", fmt.Errorf("can't tell the project from the repo URL %q", repoURL)
+	}
+	return path, nil
+}
+
+type client struct {
+	d       flux.Doer
+	config  flux.CommitStatusConfig
+	project string
+}
+
+// post makes a request with a JSON body, and the header given for
+// authentication.
+func (c client) post(path string, in interface{}, authHeader, auth string) error {
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(in); err != nil {
+		return errors.Wrap(err, "encoding request")
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(c.config.URL, "/")+path, buf)
+	if err != nil {
+		return errors.Wrap(err, "constructing request")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(authHeader, auth)
+	resp, err := c.d.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "POST %s", path)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+		return fmt.Errorf("%s from POST %s (%s)", resp.Status, path, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+type github struct {
+	client
+}
+
+func (g github) Post(s Status) error {
+	return g.post(fmt.Sprintf("/repos/%s/statuses/%s", g.project, s.Revision), map[string]string{
+		"state":       "success",
+		"context":     s.Context,
+		"description": s.Description,
+	}, "Authorization", "token "+g.config.Token)
+}
+
+type gitlab struct {
+	client
+}
+
+func (g gitlab) Post(s Status) error {
+	return g.post(fmt.Sprintf("/api/v4/projects/%s/statuses/%s", url.PathEscape(g.project), s.Revision), map[string]string{
+		"state":       "success",
+		"name":        s.Context,
+		"description": s.Description,
+	}, "PRIVATE-TOKEN", g.config.Token)
+}
@@ -0,0 +1,67 @@
+package commitstatus
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/weaveworks/flux"
+)
+
+func TestProjectFromURL(t *testing.T) {
+	for _, c := range []struct {
+		url, project string
+	}{
+		{"git@github.com:myorg/conf.git", "myorg/conf"},
+		{"https://github.com/myorg/conf", "myorg/conf"},
+		{"ssh://git@gitlab.example.com:2222/group/sub/conf.git", "group/sub/conf"},
+	} {
+		project, err := ProjectFromURL(c.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if project != c.project {
+			t.Errorf("%s: expected %s, got %s", c.url, c.project, project)
+		}
+	}
+	if _, err := ProjectFromURL("/srv/conf"); err == nil {
+		t.Error("expected an error for a repo URL without a host")
+	}
+}
+
+func TestPost(t *testing.T) {
+	var (
+		path, auth string
+		body       map[string]string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		auth = r.Header.Get("Authorization") + r.Header.Get("PRIVATE-TOKEN")
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	status := Status{Revision: "abc123", Context: "flux/production", Description: "Applied"}
+	for _, c := range []struct {
+		host, path, auth, nameField string
+	}{
+		{flux.CommitStatusGitHub, "/repos/myorg/conf/statuses/abc123", "token secret", "context"},
+		{flux.CommitStatusGitLab, "/api/v4/projects/myorg%2Fconf/statuses/abc123", "secret", "name"},
+	} {
+		poster, err := New(flux.CommitStatusConfig{Host: c.host, URL: server.URL, Token: "secret"}, "git@example.com:myorg/conf.git", http.DefaultClient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := poster.Post(status); err != nil {
+			t.Fatal(err)
+		}
+		if path != c.path || auth != c.auth {
+			t.Errorf("%s: expected POST to %s with %q, got %s with %q", c.host, c.path, c.auth, path, auth)
+		}
+		if body["state"] != "success" || body[c.nameField] != status.Context {
+			t.Errorf("%s: unexpected body %v", c.host, body)
+		}
+	}
+}
@@ -4,8 +4,14 @@ import (
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -20,11 +26,215 @@ type GitConfig struct {
 	Path   string `json:"path" yaml:"path"`
 	Branch string `json:"branch" yaml:"branch"`
 	Key    string `json:"key" yaml:"key"`
+	// Submodules says whether to initialise the config repo's git
+	// submodules, e.g., if shared manifests are kept in one.
+	Submodules bool `json:"submodules,omitempty" yaml:"submodules,omitempty"`
+	// ReleaseMetadata says how to record who released what with the
+	// commits made for releases: "trailers" (in the commit message)
+	// or "notes" (as git notes); if empty, it isn't recorded.
+	ReleaseMetadata string `json:"releaseMetadata,omitempty" yaml:"releaseMetadata,omitempty"`
+	// ServicePaths narrow down where to look for the definitions of
+	// particular services, e.g., in a monorepo. The first entry
+	// matching a service is used; services not matched by any are
+	// looked for under the whole path.
+	ServicePaths []ServicePath `json:"servicePaths,omitempty" yaml:"servicePaths,omitempty"`
+	// DefaultNamespaces give the namespace for resources defined
+	// without one, for repos which are applied with `kubectl -n`.
+	// Resources not covered by any entry are in "default".
+	DefaultNamespaces []DefaultNamespace `json:"defaultNamespaces,omitempty" yaml:"defaultNamespaces,omitempty"`
+	// SOPS says whether to decrypt files encrypted with SOPS when
+	// reading them, and encrypt them again when they're changed. The
+	// service needs sops, and access to the keys, for this.
+	SOPS bool `json:"sops,omitempty" yaml:"sops,omitempty"`
+	// Ignore, MaxDepth and MaxFiles limit which files under the path
+	// are looked through for resource definitions, for big repos.
+	// Ignore lists patterns, as in .gitignore and relative to the
+	// path, of files and directories to leave out, e.g., "vendor/"
+	// or "crds/"; MaxDepth is how many directories deep to look, and
+	// MaxFiles how many YAML files there may be. Zero means no limit.
+	Ignore   []string `json:"ignore,omitempty" yaml:"ignore,omitempty"`
+	MaxDepth int      `json:"maxDepth,omitempty" yaml:"maxDepth,omitempty"`
+	MaxFiles int      `json:"maxFiles,omitempty" yaml:"maxFiles,omitempty"`
+	// DeployTags, if given, marks the commits applied by successful
+	// releases in the config repo, for other tools to diff against.
+	DeployTags *DeployTagsConfig `json:"deployTags,omitempty" yaml:"deployTags,omitempty"`
+}
+
+// DeployTagsConfig says how to mark the commit applied by a successful
+// release, with a tag for each release, or a ref moved each time, or
+// both.
+type DeployTagsConfig struct {
+	// Prefix, if given, has an annotated tag made for each release,
+	// named by the prefix and when the release was made; e.g.,
+	// "deploy/prod/2018-05-01T10-00-00" for the prefix "deploy/prod/".
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	// Ref, if given, is moved to the commit applied by each release;
+	// e.g., "deployed". It's a tag, unless given in full, as in
+	// "refs/heads/deployed".
+	Ref string `json:"ref,omitempty" yaml:"ref,omitempty"`
+	// Services are those whose releases are marked (e.g., production
+	// services); if none are given, all releases are.
+	Services []ServiceSpec `json:"services,omitempty" yaml:"services,omitempty"`
+}
+
+// Validate checks that there's a prefix or ref, which make valid ref
+// names, and that the services are valid specs.
+func (c DeployTagsConfig) Validate() error {
+	if c.Prefix == "" && c.Ref == "" {
+		return errors.New("a tag prefix or a ref is needed for deploy tags")
+	}
+	for _, name := range []string{c.Prefix, c.Ref} {
+		if strings.ContainsAny(name, " ~^:?*[\\") || strings.Contains(name, "..") || strings.Contains(name, "@{") {
+			return fmt.Errorf("%q can't be used in a ref name", name)
+		}
+	}
+	for _, spec := range c.Services {
+		if _, err := spec.Matcher(); err != nil {
+			return errors.Wrapf(err, "parsing service spec %q", spec)
+		}
+	}
+	return nil
+}
+
+// TagRef gives the ref to move, in full.
+func (c DeployTagsConfig) TagRef() string {
+	if c.Ref == "" || strings.HasPrefix(c.Ref, "refs/") {
+		return c.Ref
+	}
+	return "refs/tags/" + c.Ref
+}
+
+// DefaultNamespace is the namespace for resources defined without
+// one in the files under a directory, relative to the config repo
+// path; "" or "." means all of them.
+type DefaultNamespace struct {
+	Path      string `json:"path" yaml:"path"`
+	Namespace string `json:"namespace" yaml:"namespace"`
+}
+
+// NamespaceFor gives the namespace for resources defined without one
+// in the file given, relative to the config repo path. The entry for
+// the innermost directory holding the file is used; if there's none,
+// it's the empty string.
+func (g GitConfig) NamespaceFor(file string) string {
+	var (
+		namespace string
+		longest   = -1
+	)
+	file = filepath.Clean(file)
+	for _, d := range g.DefaultNamespaces {
+		dir := filepath.Clean(d.Path)
+		if dir != "." && file != dir && !strings.HasPrefix(file, dir+string(filepath.Separator)) {
+			continue
+		}
+		n := len(dir)
+		if dir == "." {
+			n = 0
+		}
+		if n > longest {
+			namespace, longest = d.Namespace, n
+		}
+	}
+	return namespace
+}
+
+// ServicePath gives the directory, relative to the config repo path,
+// holding the definitions of the services matching a spec (a service
+// ID, or a glob or regular expression, as for releases). It may also
+// be a file, to say which to use if a service is defined in more than
+// one.
+type ServicePath struct {
+	Services ServiceSpec `json:"services" yaml:"services"`
+	Path     string      `json:"path" yaml:"path"`
+}
+
+// PathFor gives the directory, relative to the config repo path, in
+// which to look for the definition of the service given; or the empty
+// string if there's no entry for it in ServicePaths.
+func (g GitConfig) PathFor(id ServiceID) (string, error) {
+	for _, p := range g.ServicePaths {
+		match, err := p.Services.Matcher()
+		if err != nil {
+			return "", errors.Wrapf(err, "parsing service path spec %q", p.Services)
+		}
+		if match(id) {
+			return p.Path, nil
+		}
+	}
+	return "", nil
+}
+
+// ValidateServicePaths checks that each entry in ServicePaths has a
+// valid spec, and a relative path that stays within the config repo
+// path.
+func (g GitConfig) ValidateServicePaths() error {
+	for _, p := range g.ServicePaths {
+		if _, err := p.Services.Matcher(); err != nil {
+			return errors.Wrapf(err, "parsing service path spec %q", p.Services)
+		}
+		clean := filepath.Clean(p.Path)
+		if p.Path == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("service path %q for %s must be relative, and within the config repo path", p.Path, p.Services)
+		}
+	}
+	return nil
+}
+
+// ValidateScanLimits checks that the Ignore patterns are valid, and
+// the other limits not negative.
+func (g GitConfig) ValidateScanLimits() error {
+	for _, p := range g.Ignore {
+		if _, err := path.Match(strings.Trim(p, "/"), ""); err != nil {
+			return errors.Wrapf(err, "parsing ignore pattern %q", p)
+		}
+	}
+	if g.MaxDepth < 0 || g.MaxFiles < 0 {
+		return errors.New("maxDepth and maxFiles may not be negative")
+	}
+	return nil
 }
 
 type SlackConfig struct {
 	HookURL  string `json:"hookURL" yaml:"hookURL"`
 	Username string `json:"username" yaml:"username"`
+	// Commands, if given, lets people query and release services
+	// from Slack, with a slash command.
+	Commands *SlackCommandsConfig `json:"commands,omitempty" yaml:"commands,omitempty"`
+}
+
+// What someone using Slack commands is allowed to do. Each role may
+// also do everything the roles before it may.
+const (
+	SlackRoleViewer   = "viewer"   // list services and pending updates, and see releases
+	SlackRoleReleaser = "releaser" // plan releases
+	SlackRoleApprover = "approver" // approve planned releases, so they're run
+)
+
+type SlackCommandsConfig struct {
+	// SigningSecret is the one Slack gives the app, with which it
+	// signs requests.
+	SigningSecret string `json:"signingSecret" yaml:"signingSecret"`
+	// Users maps Slack user IDs to who they are taken to be, and
+	// what they may do. People not listed can't use the commands.
+	Users map[string]SlackUser `json:"users" yaml:"users"`
+}
+
+type SlackUser struct {
+	// Name is recorded as the user making a release.
+	Name string `json:"name" yaml:"name"`
+	Role string `json:"role" yaml:"role"`
+}
+
+// Validate checks that each user has a known role.
+func (c SlackCommandsConfig) Validate() error {
+	for id, user := range c.Users {
+		switch user.Role {
+		case SlackRoleViewer, SlackRoleReleaser, SlackRoleApprover:
+		default:
+			return fmt.Errorf("unknown role %q for Slack user %s", user.Role, id)
+		}
+	}
+	return nil
 }
 
 type RegistryConfig struct {
@@ -32,6 +242,357 @@ type RegistryConfig struct {
 	// username:password), to make it easy to copypasta from docker
 	// config.
 	Auths map[string]Auth `json:"auths" yaml:"auths"`
+	// Mirrors maps registry hosts (e.g., "docker.io") to mirrors
+	// from which to fetch image metadata instead, optionally with a
+	// path under which the images are kept (e.g.,
+	// "mirror.example.com/dockerhub"). Images are still named as
+	// usual in definitions.
+	Mirrors map[string]string `json:"mirrors,omitempty" yaml:"mirrors,omitempty"`
+	// APIs says what kind of registry each host is ("v2", "ecr",
+	// "gcr", "harbor", "artifactory" or "quay"), and so how to fetch
+	// image metadata from it. Registries with their own API for
+	// listing tags are asked that way, rather than for the manifest of
+	// each tag. quay.io, gcr.io and ECR hosts are recognised without
+	// being given here; anything else not given is "v2".
+	APIs map[string]string `json:"apis,omitempty" yaml:"apis,omitempty"`
+	// Discover lists namespaces (e.g., "weaveworks" on Docker Hub,
+	// or "quay.io/weaveworks") whose repositories are all fetched
+	// ahead of time, so that image metadata is ready for new services.
+	Discover []string `json:"discover,omitempty" yaml:"discover,omitempty"`
+	// Anonymous lists registry hosts which are pulled from without
+	// credentials, on purpose; a registry refusing an anonymous pull
+	// is then reported as such, rather than as credentials missing.
+	// Credentials can't also be given for these hosts.
+	Anonymous []string `json:"anonymous,omitempty" yaml:"anonymous,omitempty"`
+}
+
+type AutomationConfig struct {
+	// BatchWindow, if given, is how long to hold back updates to
+	// automated services once some are found (e.g., "10m"), so that
+	// those found in the meantime are released with them, in a
+	// single commit. Otherwise, each new image is released as soon as
+	// it's found.
+	BatchWindow string `json:"batchWindow,omitempty" yaml:"batchWindow,omitempty"`
+	// PriorityNamespaces are those (e.g., production) whose automated
+	// services have their image repositories polled most often.
+	PriorityNamespaces []string `json:"priorityNamespaces,omitempty" yaml:"priorityNamespaces,omitempty"`
+}
+
+// IsPriorityNamespace says whether the namespace is one of those to
+// be polled for new images most often.
+func (c AutomationConfig) IsPriorityNamespace(namespace string) bool {
+	for _, ns := range c.PriorityNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that the batch window, if given, is a duration.
+func (c AutomationConfig) Validate() error {
+	if c.BatchWindow == "" {
+		return nil
+	}
+	_, err := time.ParseDuration(c.BatchWindow)
+	return errors.Wrapf(err, "parsing automation batch window %q", c.BatchWindow)
+}
+
+type AlertCheckConfig struct {
+	// AlertmanagerURL or PrometheusURL is where to ask for the
+	// alerts firing; only one should be given.
+	AlertmanagerURL string `json:"alertmanagerURL,omitempty" yaml:"alertmanagerURL,omitempty"`
+	PrometheusURL   string `json:"prometheusURL,omitempty" yaml:"prometheusURL,omitempty"`
+	// Window is how long to watch for alerts after services are
+	// released, as a duration, e.g., "5m".
+	Window string `json:"window" yaml:"window"`
+	// NamespaceLabel and ServiceLabel are the labels of alerts
+	// saying which namespace and service they're about; by default,
+	// "namespace" and "service".
+	NamespaceLabel string `json:"namespaceLabel,omitempty" yaml:"namespaceLabel,omitempty"`
+	ServiceLabel   string `json:"serviceLabel,omitempty" yaml:"serviceLabel,omitempty"`
+	// Rollback makes the release fail, and be rolled back, if new
+	// alerts fire for the services released. Otherwise, they're just
+	// reported.
+	Rollback bool `json:"rollback,omitempty" yaml:"rollback,omitempty"`
+}
+
+// Validate checks that exactly one place to ask for alerts is given,
+// and that the window is a duration.
+func (c AlertCheckConfig) Validate() error {
+	if (c.AlertmanagerURL == "") == (c.PrometheusURL == "") {
+		return errors.New("exactly one of an Alertmanager or Prometheus URL must be given for checking alerts")
+	}
+	if _, err := time.ParseDuration(c.Window); err != nil {
+		return errors.Wrapf(err, "parsing alert check window %q", c.Window)
+	}
+	return nil
+}
+
+// Service meshes in which traffic can be shifted.
+const (
+	MeshIstio   = "istio"
+	MeshLinkerd = "linkerd"
+)
+
+type TrafficShiftConfig struct {
+	// Service is the canary workload; once it's released, traffic
+	// is shifted to it from the stable version.
+	Service ServiceID `json:"service" yaml:"service"`
+	// Mesh is "istio" or "linkerd".
+	Mesh string `json:"mesh" yaml:"mesh"`
+	// Host is the service traffic is split for, in the namespace of
+	// the canary: the host of the Istio VirtualService, or the apex
+	// service of the Linkerd TrafficSplit. Flux writes the routing
+	// resource, of the same name, while releasing.
+	Host string `json:"host" yaml:"host"`
+	// Stable and Canary are the destinations for the current and new
+	// versions: subsets (of a DestinationRule for Host) in Istio, or
+	// backend services in Linkerd.
+	Stable string `json:"stable" yaml:"stable"`
+	Canary string `json:"canary" yaml:"canary"`
+	// Steps are the percentages of traffic to send to the canary, in
+	// order, e.g., [10, 50, 100].
+	Steps []int `json:"steps" yaml:"steps"`
+	// Interval is how long to stay at each step before checking and
+	// moving on, e.g., "2m".
+	Interval string `json:"interval" yaml:"interval"`
+	// Check, if given, is run after each step; if it fails, traffic
+	// goes back to the stable version, and the release is rolled
+	// back.
+	Check *MetricCheck `json:"check,omitempty" yaml:"check,omitempty"`
+}
+
+// MetricCheck is a Prometheus query giving a single value, e.g., an
+// error rate, which mustn't be more than Max.
+type MetricCheck struct {
+	PrometheusURL string  `json:"prometheusURL" yaml:"prometheusURL"`
+	Query         string  `json:"query" yaml:"query"`
+	Max           float64 `json:"max" yaml:"max"`
+}
+
+// Validate checks that the mesh is known, the steps go up to 100,
+// and the interval is a duration.
+func (c TrafficShiftConfig) Validate() error {
+	if _, err := ParseServiceID(string(c.Service)); err != nil {
+		return errors.Wrapf(err, "traffic shift service %q", c.Service)
+	}
+	switch c.Mesh {
+	case MeshIstio, MeshLinkerd:
+	default:
+		return fmt.Errorf("unknown service mesh %q for %s", c.Mesh, c.Service)
+	}
+	if c.Host == "" || c.Stable == "" || c.Canary == "" {
+		return fmt.Errorf("host, stable and canary must all be given for %s", c.Service)
+	}
+	last := 0
+	for _, step := range c.Steps {
+		if step <= last || step > 100 {
+			return fmt.Errorf("traffic shift steps for %s must go up, to at most 100", c.Service)
+		}
+		last = step
+	}
+	if last != 100 {
+		return fmt.Errorf("traffic shift steps for %s must end at 100", c.Service)
+	}
+	if _, err := time.ParseDuration(c.Interval); err != nil {
+		return errors.Wrapf(err, "parsing traffic shift interval %q for %s", c.Interval, c.Service)
+	}
+	if c.Check != nil && (c.Check.PrometheusURL == "" || c.Check.Query == "") {
+		return fmt.Errorf("a Prometheus URL and query must be given for the check for %s", c.Service)
+	}
+	return nil
+}
+
+type GrafanaConfig struct {
+	// URL is the base URL of Grafana, e.g.,
+	// "https://grafana.example.com".
+	URL    string `json:"URL" yaml:"URL"`
+	APIKey string `json:"apiKey" yaml:"apiKey"`
+	// DashboardID, if given, puts the annotations on that dashboard
+	// only; otherwise, they're shown on any dashboard querying
+	// annotations by their tags ("flux", the namespace and the
+	// service ID, and any given here).
+	DashboardID int64    `json:"dashboardID,omitempty" yaml:"dashboardID,omitempty"`
+	Tags        []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+// Systems in which change tickets can be kept.
+const (
+	ChangeTicketsJira       = "jira"
+	ChangeTicketsServiceNow = "servicenow"
+)
+
+type ChangeTicketConfig struct {
+	// System is "jira" or "servicenow".
+	System string `json:"system" yaml:"system"`
+	// URL is the base URL of the system, e.g.,
+	// "https://example.atlassian.net".
+	URL      string `json:"URL" yaml:"URL"`
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	// Project is the key of the Jira project in which to open
+	// issues, and IssueType the type of issue (by default "Task").
+	// They aren't used for ServiceNow, which has change requests.
+	Project   string `json:"project,omitempty" yaml:"project,omitempty"`
+	IssueType string `json:"issueType,omitempty" yaml:"issueType,omitempty"`
+	// Services are those whose releases are production releases, and
+	// get a ticket; if none are given, all releases do.
+	Services []ServiceSpec `json:"services,omitempty" yaml:"services,omitempty"`
+	// RequireApproval makes a release wait until its ticket is
+	// approved before it's run, and fail if it's rejected.
+	RequireApproval bool `json:"requireApproval,omitempty" yaml:"requireApproval,omitempty"`
+	// ApprovedStates and RejectedStates are the states of a ticket
+	// (its status in Jira, or approval in ServiceNow) meaning it's
+	// been approved or rejected. By default they are "Approved" and
+	// "Rejected" for Jira, and "approved" and "rejected" for
+	// ServiceNow.
+	ApprovedStates []string `json:"approvedStates,omitempty" yaml:"approvedStates,omitempty"`
+	RejectedStates []string `json:"rejectedStates,omitempty" yaml:"rejectedStates,omitempty"`
+}
+
+// Validate checks that the system is known, and that the services
+// are valid specs.
+func (c ChangeTicketConfig) Validate() error {
+	switch c.System {
+	case ChangeTicketsJira:
+		if c.Project == "" {
+			return errors.New("a project is needed for Jira tickets")
+		}
+	case ChangeTicketsServiceNow:
+	default:
+		return fmt.Errorf("unknown change ticket system %q", c.System)
+	}
+	if c.URL == "" {
+		return errors.New("no URL given for change tickets")
+	}
+	for _, spec := range c.Services {
+		if _, err := spec.Matcher(); err != nil {
+			return errors.Wrapf(err, "parsing service spec %q", spec)
+		}
+	}
+	return nil
+}
+
+// Hosts of config repos to which commit statuses can be posted.
+const (
+	CommitStatusGitHub = "github"
+	CommitStatusGitLab = "gitlab"
+)
+
+type CommitStatusConfig struct {
+	// Host is "github" or "gitlab".
+	Host string `json:"host" yaml:"host"`
+	// URL is the base URL of the host's API; by default,
+	// "https://api.github.com" for GitHub, and "https://gitlab.com"
+	// for GitLab. For GitHub Enterprise it's, e.g.,
+	// "https://github.example.com/api/v3".
+	URL string `json:"URL,omitempty" yaml:"URL,omitempty"`
+	// Token is an access token allowed to post statuses to the
+	// config repo.
+	Token string `json:"token" yaml:"token"`
+	// Project is the config repo's path on the host, e.g.,
+	// "myorg/conf"; by default, it's taken from the repo's URL.
+	Project string `json:"project,omitempty" yaml:"project,omitempty"`
+	// Cluster names the cluster the instance deploys to, in the
+	// statuses posted; by default, "cluster".
+	Cluster string `json:"cluster,omitempty" yaml:"cluster,omitempty"`
+}
+
+// Validate checks that the host is known, and there's a token.
+func (c CommitStatusConfig) Validate() error {
+	switch c.Host {
+	case CommitStatusGitHub, CommitStatusGitLab:
+	default:
+		return fmt.Errorf("unknown commit status host %q", c.Host)
+	}
+	if c.Token == "" {
+		return errors.New("a token is needed for posting commit statuses")
+	}
+	if c.URL != "" {
+		parsed, err := url.Parse(c.URL)
+		if err != nil {
+			return errors.Wrapf(err, "parsing commit status URL %q", c.URL)
+		}
+		if !parsed.IsAbs() {
+			return fmt.Errorf("commit status URL %q must be absolute", c.URL)
+		}
+	}
+	return nil
+}
+
+// SelfUpgradeConfig says how flux's own services are released: the
+// service first, then the daemon, after which the daemon is expected
+// to reconnect, running its new version.
+type SelfUpgradeConfig struct {
+	// ReconnectTimeout is how long the daemon has to reconnect once
+	// it's been released (as parsed by time.ParseDuration); by
+	// default, five minutes.
+	ReconnectTimeout string `json:"reconnectTimeout,omitempty" yaml:"reconnectTimeout,omitempty"`
+}
+
+func (c SelfUpgradeConfig) Validate() error {
+	if c.ReconnectTimeout != "" {
+		if _, err := time.ParseDuration(c.ReconnectTimeout); err != nil {
+			return errors.Wrap(err, "parsing reconnect timeout")
+		}
+	}
+	return nil
+}
+
+// WebhooksConfig says where to send notifications of the instance's
+// events, and whether other systems may trigger releases, by webhook.
+// Requests both ways are signed with a secret shared with whoever is
+// at the other end.
+type WebhooksConfig struct {
+	// NotifyURLs are each sent the instance's events and image
+	// releases, as JSON.
+	NotifyURLs []string `json:"notifyURLs,omitempty" yaml:"notifyURLs,omitempty"`
+	// Triggers lets releases be submitted by webhook, to
+	// /webhooks/<instance>/release.
+	Triggers bool `json:"triggers,omitempty" yaml:"triggers,omitempty"`
+	// GitPush lets the config repo's host (GitHub or GitLab) send
+	// push events to /webhooks/git/<instance>, so the instance is
+	// synced with the repo as soon as it's pushed to.
+	GitPush bool `json:"gitPush,omitempty" yaml:"gitPush,omitempty"`
+	// Secrets sign the requests sent, and verify those received.
+	// Requests sent are signed with each; those received need only
+	// be signed with one. So a secret can be rotated by adding the
+	// new one, and removing the old one once those at the other end
+	// have changed over.
+	Secrets []string `json:"secrets" yaml:"secrets"`
+}
+
+// Validate checks that there's a secret, if webhooks are used, and
+// that the URLs to notify are absolute.
+func (c WebhooksConfig) Validate() error {
+	if (len(c.NotifyURLs) > 0 || c.Triggers || c.GitPush) && len(c.Secrets) == 0 {
+		return errors.New("a secret is needed for signing webhooks")
+	}
+	for _, s := range c.Secrets {
+		if s == "" {
+			return errors.New("webhook secrets can't be empty")
+		}
+	}
+	for _, u := range c.NotifyURLs {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return errors.Wrapf(err, "parsing webhook URL %q", u)
+		}
+		if !parsed.IsAbs() {
+			return fmt.Errorf("webhook URL %q must be absolute", u)
+		}
+	}
+	return nil
+}
+
+// ImageField says where, other than in container specs, an image is
+// given in resources of a particular kind; e.g., in a ConfigMap, the
+// path "data.image". The path is a JSONPath of field names (as in
+// "{.data.image}"), without array indexing.
+type ImageField struct {
+	Kind string `json:"kind" yaml:"kind"`
+	Path string `json:"path" yaml:"path"`
 }
 
 type Auth struct {
@@ -42,6 +603,42 @@ type InstanceConfig struct {
 	Git      GitConfig      `json:"git" yaml:"git"`
 	Slack    SlackConfig    `json:"slack" yaml:"slack"`
 	Registry RegistryConfig `json:"registry" yaml:"registry"`
+	// ImageFields are updated, along with container images, when
+	// releasing a new image.
+	ImageFields []ImageField `json:"imageFields,omitempty" yaml:"imageFields,omitempty"`
+	// Grafana, if given, has the release of each service marked with
+	// an annotation in Grafana.
+	Grafana *GrafanaConfig `json:"grafana,omitempty" yaml:"grafana,omitempty"`
+	// Automation says how automated services are released.
+	Automation AutomationConfig `json:"automation,omitempty" yaml:"automation,omitempty"`
+	// AlertCheck, if given, has releases watch for alerts about the
+	// services released, once they're rolled out.
+	AlertCheck *AlertCheckConfig `json:"alertCheck,omitempty" yaml:"alertCheck,omitempty"`
+	// TrafficShifts say which services are canaries in a service
+	// mesh, to which traffic is shifted a step at a time when they're
+	// released.
+	TrafficShifts []TrafficShiftConfig `json:"trafficShifts,omitempty" yaml:"trafficShifts,omitempty"`
+	// ChangeTickets, if given, has a change ticket opened for each
+	// production release, in Jira or ServiceNow.
+	ChangeTickets *ChangeTicketConfig `json:"changeTickets,omitempty" yaml:"changeTickets,omitempty"`
+	// CommitStatus, if given, has a status posted to each commit of
+	// the config repo applied to the cluster, on GitHub or GitLab.
+	CommitStatus *CommitStatusConfig `json:"commitStatus,omitempty" yaml:"commitStatus,omitempty"`
+	// SelfUpgrade, if given, lets flux's own services (fluxsvc and
+	// fluxd) be released. Otherwise they're left out of releases,
+	// and of automation.
+	SelfUpgrade *SelfUpgradeConfig `json:"selfUpgrade,omitempty" yaml:"selfUpgrade,omitempty"`
+	// Webhooks, if given, has the instance's events sent to other
+	// systems, and lets them trigger releases.
+	Webhooks *WebhooksConfig `json:"webhooks,omitempty" yaml:"webhooks,omitempty"`
+	// Features turns features on or off for the instance; those not
+	// mentioned are as the service has them by default.
+	Features Features `json:"features,omitempty" yaml:"features,omitempty"`
+	// Version is that of the config as stored, when it's fetched. If
+	// it's given when setting the config, the config is only set if
+	// it's still at that version, so changes made in the meantime
+	// aren't lost.
+	Version int64 `json:"version,omitempty" yaml:"version,omitempty"`
 }
 
 // As a safeguard, we make the default behaviour to hide secrets when
@@ -56,12 +653,77 @@ func (c InstanceConfig) MarshalJSON() ([]byte, error) {
 
 func (c InstanceConfig) HideSecrets() SafeInstanceConfig {
 	c.Git = c.Git.HideKey()
+	if c.Slack.Commands != nil && c.Slack.Commands.SigningSecret != "" {
+		commands := *c.Slack.Commands
+		commands.SigningSecret = secretReplacement
+		c.Slack.Commands = &commands
+	}
+	if c.Grafana != nil && c.Grafana.APIKey != "" {
+		grafana := *c.Grafana
+		grafana.APIKey = secretReplacement
+		c.Grafana = &grafana
+	}
+	if c.ChangeTickets != nil && c.ChangeTickets.Password != "" {
+		tickets := *c.ChangeTickets
+		tickets.Password = secretReplacement
+		c.ChangeTickets = &tickets
+	}
+	if c.CommitStatus != nil && c.CommitStatus.Token != "" {
+		status := *c.CommitStatus
+		status.Token = secretReplacement
+		c.CommitStatus = &status
+	}
+	if c.Webhooks != nil && len(c.Webhooks.Secrets) > 0 {
+		webhooks := *c.Webhooks
+		webhooks.Secrets = make([]string, len(c.Webhooks.Secrets))
+		for i := range webhooks.Secrets {
+			webhooks.Secrets[i] = secretReplacement
+		}
+		c.Webhooks = &webhooks
+	}
 	for host, auth := range c.Registry.Auths {
 		c.Registry.Auths[host] = auth.HidePassword()
 	}
 	return SafeInstanceConfig(c)
 }
 
+// WithoutSecrets gives the config with its secrets (keys, passwords,
+// webhook URLs and registry credentials) removed, rather than hidden,
+// so it can be used as the starting point for another instance's
+// config.
+func (c InstanceConfig) WithoutSecrets() UnsafeInstanceConfig {
+	c.Git.Key = ""
+	c.Slack.HookURL = ""
+	if c.Slack.Commands != nil {
+		commands := *c.Slack.Commands
+		commands.SigningSecret = ""
+		c.Slack.Commands = &commands
+	}
+	if c.Grafana != nil {
+		grafana := *c.Grafana
+		grafana.APIKey = ""
+		c.Grafana = &grafana
+	}
+	if c.ChangeTickets != nil {
+		tickets := *c.ChangeTickets
+		tickets.Password = ""
+		c.ChangeTickets = &tickets
+	}
+	if c.CommitStatus != nil {
+		status := *c.CommitStatus
+		status.Token = ""
+		c.CommitStatus = &status
+	}
+	if c.Webhooks != nil {
+		webhooks := *c.Webhooks
+		webhooks.Secrets = nil
+		c.Webhooks = &webhooks
+	}
+	c.Registry.Auths = nil
+	c.Version = 0
+	return UnsafeInstanceConfig(c)
+}
+
 func (a Auth) HidePassword() Auth {
 	if a.Auth == "" {
 		return a
@@ -1,7 +1,10 @@
 // Code for initialising databases; individual components should put
 // scripts in `db/migrations/{driver}`.  `db.MustMigrate` can then be
 // used to make sure the database is up to date before components can
-// use it.
+// use it. The scripts for the history tables are also linked (numbered
+// in their own sequence) from `db/migrations/history/{driver}`, which
+// is used for a database holding history alone; so a new history
+// script goes in `db/migrations/{driver}`, with a link to it there.
 
 package db
 
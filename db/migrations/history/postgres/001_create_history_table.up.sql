@@ -0,0 +1 @@
+../../postgres/001_create_history_table.up.sql
\ No newline at end of file
@@ -0,0 +1 @@
+../../postgres/003_multitenant_history.up.sql
\ No newline at end of file
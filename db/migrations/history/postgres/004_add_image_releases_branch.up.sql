@@ -0,0 +1 @@
+../../postgres/010_add_image_releases_branch.up.sql
\ No newline at end of file
@@ -0,0 +1 @@
+../../postgres/011_add_image_releases_outcome.up.sql
\ No newline at end of file
@@ -0,0 +1 @@
+../../postgres/013_add_history_indexes.up.sql
\ No newline at end of file
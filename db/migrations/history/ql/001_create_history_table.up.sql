@@ -0,0 +1 @@
+../../ql/001_create_history_table.up.sql
\ No newline at end of file
@@ -0,0 +1 @@
+../../ql/009_create_image_releases_table.up.sql
\ No newline at end of file
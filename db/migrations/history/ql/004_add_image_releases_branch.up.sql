@@ -0,0 +1 @@
+../../ql/010_add_image_releases_branch.up.sql
\ No newline at end of file
@@ -0,0 +1 @@
+../../ql/011_add_image_releases_outcome.up.sql
\ No newline at end of file
@@ -0,0 +1 @@
+../../ql/013_add_history_indexes.up.sql
\ No newline at end of file
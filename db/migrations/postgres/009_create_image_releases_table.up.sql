@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS image_releases (
+    instance    text                     NOT NULL,
+    namespace   text                     NOT NULL,
+    service     text                     NOT NULL,
+    container   text                     NOT NULL,
+    from_image  text,
+    to_image    text                     NOT NULL,
+    from_digest text,
+    to_digest   text,
+    revision    text,
+    stamp       timestamp with time zone NOT NULL
+);
+
+CREATE INDEX image_releases_service_idx ON image_releases (instance, namespace, service, stamp);
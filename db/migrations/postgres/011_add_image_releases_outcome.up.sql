@@ -0,0 +1,3 @@
+ALTER TABLE image_releases
+  ADD COLUMN to_created_at timestamp with time zone,
+  ADD COLUMN failed boolean NOT NULL DEFAULT false;
@@ -0,0 +1 @@
+ALTER TABLE config ADD COLUMN version bigint NOT NULL DEFAULT 0;
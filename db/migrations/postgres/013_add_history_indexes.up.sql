@@ -0,0 +1,4 @@
+CREATE INDEX history_service_idx ON history (instance, namespace, service, stamp);
+CREATE INDEX history_instance_idx ON history (instance, stamp);
+CREATE INDEX history_stamp_idx ON history (stamp);
+CREATE INDEX image_releases_instance_idx ON image_releases (instance, stamp);
@@ -0,0 +1 @@
+CREATE INDEX jobs_instance_submitted_idx ON jobs (instance_id, submitted_at);
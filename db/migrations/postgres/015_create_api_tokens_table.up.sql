@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS api_tokens (
+    PRIMARY KEY (id),
+    id          text                     NOT NULL,
+    instance_id text                     NOT NULL,
+    name        text                     NOT NULL,
+    scopes      text                     NOT NULL,
+    rate_limit  integer                  NOT NULL DEFAULT 0,
+    secret_hash text                     NOT NULL,
+    created_at  timestamp with time zone NOT NULL,
+    rotated_at  timestamp with time zone,
+    revoked_at  timestamp with time zone
+);
+
+CREATE UNIQUE INDEX api_tokens_secret_hash_idx ON api_tokens (secret_hash);
+CREATE INDEX api_tokens_instance_idx ON api_tokens (instance_id);
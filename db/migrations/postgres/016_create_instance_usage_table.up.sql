@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS instance_usage (
+    PRIMARY KEY (instance_id, day, kind),
+    instance_id text                     NOT NULL,
+    day         timestamp with time zone NOT NULL,
+    kind        text                     NOT NULL,
+    amount      bigint                   NOT NULL DEFAULT 0
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS webhook_nonces (
+    PRIMARY KEY (nonce),
+    nonce   text                     NOT NULL,
+    expires timestamp with time zone NOT NULL
+);
+
+CREATE INDEX webhook_nonces_expires_idx ON webhook_nonces (expires);
@@ -0,0 +1 @@
+ALTER TABLE jobs ADD claimed_by string;
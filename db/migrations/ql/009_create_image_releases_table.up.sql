@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS image_releases (
+    instance    string NOT NULL,
+    namespace   string NOT NULL,
+    service     string NOT NULL,
+    container   string NOT NULL,
+    from_image  string,
+    to_image    string NOT NULL,
+    from_digest string,
+    to_digest   string,
+    revision    string,
+    stamp       time   NOT NULL,
+);
@@ -0,0 +1 @@
+ALTER TABLE image_releases ADD branch string;
@@ -0,0 +1,2 @@
+ALTER TABLE image_releases ADD to_created_at time;
+ALTER TABLE image_releases ADD failed bool;
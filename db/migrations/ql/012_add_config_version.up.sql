@@ -0,0 +1 @@
+ALTER TABLE config ADD version int64;
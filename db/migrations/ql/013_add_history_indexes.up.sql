@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS history_instance_idx ON history (instance);
+CREATE INDEX IF NOT EXISTS history_stamp_idx ON history (stamp);
+CREATE INDEX IF NOT EXISTS image_releases_instance_idx ON image_releases (instance);
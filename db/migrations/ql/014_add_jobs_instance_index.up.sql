@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS jobs_instance_idx ON jobs (instance_id);
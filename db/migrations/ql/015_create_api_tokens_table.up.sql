@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id          string NOT NULL,
+    instance_id string NOT NULL,
+    name        string NOT NULL,
+    scopes      string NOT NULL,
+    rate_limit  int    NOT NULL DEFAULT 0,
+    secret_hash string NOT NULL,
+    created_at  time   NOT NULL,
+    rotated_at  time,
+    revoked_at  time,
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS api_tokens_secret_hash_idx ON api_tokens (secret_hash);
+CREATE INDEX IF NOT EXISTS api_tokens_instance_idx ON api_tokens (instance_id);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS instance_usage (
+    instance_id string NOT NULL,
+    day         time   NOT NULL,
+    kind        string NOT NULL,
+    amount      int64  NOT NULL DEFAULT 0,
+);
+
+CREATE INDEX IF NOT EXISTS instance_usage_instance_idx ON instance_usage (instance_id);
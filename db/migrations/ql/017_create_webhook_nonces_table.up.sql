@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS webhook_nonces (
+    nonce   string NOT NULL,
+    expires time   NOT NULL,
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS webhook_nonces_nonce_idx ON webhook_nonces (nonce);
+CREATE INDEX IF NOT EXISTS webhook_nonces_expires_idx ON webhook_nonces (expires);
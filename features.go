@@ -0,0 +1,113 @@
+package flux
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Features which can be turned on or off for each instance, so that
+// those which are risky can be tried with some instances before
+// they're on for all.
+const (
+	// FeatureAutoRollback lets releases fail, and be rolled back, if
+	// alerts fire for the services released (as asked for in
+	// AlertCheckConfig). Otherwise, the alerts are only reported.
+	FeatureAutoRollback = "auto-rollback"
+	// FeaturePrune lets releases which apply resources delete those
+	// no longer defined in the config repo.
+	FeaturePrune = "prune"
+)
+
+// KnownFeatures are those which can be turned on or off.
+var KnownFeatures = []string{FeatureAutoRollback, FeaturePrune}
+
+// DefaultFeatures are on or off for instances which don't say, unless
+// the service is told otherwise.
+var DefaultFeatures = Features{
+	FeatureAutoRollback: true,
+	FeaturePrune:        true,
+}
+
+// Features says which features are turned on or off. Those not
+// mentioned are as they are by default.
+type Features map[string]bool
+
+// Enabled says whether the feature is on, given the defaults for
+// those not mentioned.
+func (f Features) Enabled(feature string, defaults Features) bool {
+	if on, ok := f[feature]; ok {
+		return on
+	}
+	return defaults[feature]
+}
+
+// Override gives the features with those given turned on or off.
+func (f Features) Override(with Features) Features {
+	res := Features{}
+	for feature, on := range f {
+		res[feature] = on
+	}
+	for feature, on := range with {
+		res[feature] = on
+	}
+	return res
+}
+
+// Validate checks that only known features are mentioned, so that
+// a misspelt one isn't silently left as it is.
+func (f Features) Validate() error {
+	for feature := range f {
+		if !isKnownFeature(feature) {
+			return errors.Errorf("unknown feature %q; expected one of %s", feature, strings.Join(KnownFeatures, ", "))
+		}
+	}
+	return nil
+}
+
+func (f Features) String() string {
+	var features []string
+	for feature, on := range f {
+		features = append(features, fmt.Sprintf("%s=%t", feature, on))
+	}
+	sort.Strings(features)
+	return strings.Join(features, ",")
+}
+
+func isKnownFeature(feature string) bool {
+	for _, known := range KnownFeatures {
+		if feature == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFeatures parses features turned on or off, as a
+// comma-separated list of "feature=true" or "feature=false"; just
+// "feature" turns it on.
+func ParseFeatures(s string) (Features, error) {
+	f := Features{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		feature, on := part, true
+		if i := strings.Index(part, "="); i >= 0 {
+			var err error
+			feature = part[:i]
+			if on, err = strconv.ParseBool(part[i+1:]); err != nil {
+				return nil, errors.Wrapf(err, "parsing feature %q", part)
+			}
+		}
+		f[feature] = on
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
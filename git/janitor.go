@@ -0,0 +1,123 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+// clonePrefix names the temporary directories clones are made in.
+const clonePrefix = "flux-gitclone"
+
+type JanitorMetrics struct {
+	// Disk space taken by the clones of each instance (or of all the
+	// instances with the same label, if they are hashed or aggregated)
+	WorkingDirSize metrics.Gauge
+	// Counts of clones removed because they were left behind
+	OrphansRemoved metrics.Counter
+	// How to report the instance label
+	Labels fluxmetrics.LabelPolicy
+}
+
+func NewJanitorMetrics() JanitorMetrics {
+	return JanitorMetrics{
+		WorkingDirSize: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "flux",
+			Subsystem: "git",
+			Name:      "working_dir_size_bytes",
+			Help:      "Size on disk of the clones of config repos currently in the working directory.",
+		}, []string{fluxmetrics.LabelInstanceID}),
+		OrphansRemoved: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "flux",
+			Subsystem: "git",
+			Name:      "orphaned_clones_removed_total",
+			Help:      "Number of clones of config repos removed because they were left behind, e.g., by a crash.",
+		}, []string{fluxmetrics.LabelInstanceID}),
+	}
+}
+
+// Janitor looks after the working directory under which clones are
+// made, with a directory for each instance (as set up by the
+// instancer). Clones are usually removed when a release is finished
+// with them, or kept in a pool to be used again, but can be left
+// behind if the process crashes; those not used for longer than maxAge
+// are taken to be orphaned, and removed. Pooled clones removed this way
+// are cloned afresh when next needed.
+type Janitor struct {
+	root    string
+	maxAge  time.Duration
+	metrics JanitorMetrics
+	logger  log.Logger
+}
+
+func NewJanitor(root string, maxAge time.Duration, metrics JanitorMetrics, logger log.Logger) *Janitor {
+	return &Janitor{
+		root:    root,
+		maxAge:  maxAge,
+		metrics: metrics,
+		logger:  logger,
+	}
+}
+
+// Clean sweeps the working directory each time there's a tick.
+func (j *Janitor) Clean(tick <-chan time.Time) {
+	for now := range tick {
+		j.sweep(now)
+	}
+}
+
+func (j *Janitor) sweep(now time.Time) {
+	instances, err := ioutil.ReadDir(j.root)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			j.logger.Log("err", err)
+		}
+		return
+	}
+	// Instances may share a label value, so sizes are summed for each
+	// value before being reported.
+	sizes := map[string]int64{}
+	for _, inst := range instances {
+		if !inst.IsDir() {
+			continue
+		}
+		dir := filepath.Join(j.root, inst.Name())
+		clones, err := ioutil.ReadDir(dir)
+		if err != nil {
+			j.logger.Log("instanceID", inst.Name(), "err", err)
+			continue
+		}
+		label := j.metrics.Labels.Instance(inst.Name())
+		if _, ok := sizes[label]; !ok {
+			sizes[label] = 0 // so it's reported even when there are no clones
+		}
+		for _, clone := range clones {
+			if !clone.IsDir() || !strings.HasPrefix(clone.Name(), clonePrefix) {
+				continue
+			}
+			path := filepath.Join(dir, clone.Name())
+			if now.Sub(clone.ModTime()) > j.maxAge {
+				if err := os.RemoveAll(path); err != nil {
+					j.logger.Log("instanceID", inst.Name(), "clone", path, "err", err)
+				} else {
+					j.logger.Log("instanceID", inst.Name(), "removed", path, "age", now.Sub(clone.ModTime()).String())
+					j.metrics.OrphansRemoved.With(fluxmetrics.LabelInstanceID, label).Add(1)
+					continue
+				}
+			}
+			sizes[label] += dirSize(path)
+		}
+	}
+	for label, size := range sizes {
+		j.metrics.WorkingDirSize.With(fluxmetrics.LabelInstanceID, label).Set(float64(size))
+	}
+}
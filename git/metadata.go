@@ -0,0 +1,68 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Ways of recording release metadata with the commits made.
+const (
+	// MetadataNone records nothing beyond the commit message.
+	MetadataNone = ""
+	// MetadataTrailers appends the metadata to the commit message,
+	// as trailer lines (e.g., "Flux-Job: <id>").
+	MetadataTrailers = "trailers"
+	// MetadataNotes attaches the metadata to the commit as a git
+	// note, under NotesRef, which is pushed along with the branch.
+	MetadataNotes = "notes"
+)
+
+// NotesRef is where release metadata is kept, when it's recorded as
+// git notes.
+const NotesRef = "refs/notes/flux"
+
+// Trailer is an item of metadata recorded with a commit. There may be
+// more than one with the same key.
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+// ValidateMetadata checks that the way of recording metadata given is
+// one that's known.
+func ValidateMetadata(mode string) error {
+	switch mode {
+	case MetadataNone, MetadataTrailers, MetadataNotes:
+		return nil
+	}
+	return fmt.Errorf("unknown way of recording release metadata %q; expected %q or %q", mode, MetadataTrailers, MetadataNotes)
+}
+
+// formatTrailers gives the trailers one per line, in the form
+// understood by `git interpret-trailers`.
+func formatTrailers(trailers []Trailer) string {
+	lines := make([]string, len(trailers))
+	for i, t := range trailers {
+		lines[i] = fmt.Sprintf("%s: %s", t.Key, strings.Replace(t.Value, "\n", " ", -1))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// addNote attaches the note given to HEAD. Notes already pushed are
+// fetched first, so that pushing the notes ref doesn't clobber them.
+func addNote(ctx context.Context, keyData, workingDir, note string) error {
+	keyPath, err := writeKey(keyData)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(keyPath)
+	// There may be no notes yet, so this is allowed to fail; if
+	// it failed for some other reason, the push will.
+	execGit(ctx, "fetch notes", nil, nil, workingDir, keyPath, "fetch", "origin", "+"+NotesRef+":"+NotesRef)
+	return execGit(ctx, "notes add", nil, nil, workingDir, "",
+		"-c", "user.name=Weave Flux", "-c", "user.email=support@weave.works",
+		"notes", "--ref", NotesRef, "add", "-f", "-m", note, "HEAD",
+	)
+}
@@ -0,0 +1,118 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/weaveworks/flux"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+const (
+	LabelOperation = "operation"
+
+	OperationClone   = "clone"
+	OperationCommit  = "commit"
+	OperationPush    = "push"
+	OperationRevert  = "revert"
+	OperationRefresh = "refresh"
+	OperationTag     = "tag"
+)
+
+type Metrics struct {
+	// Duration of each kind of git operation
+	OperationDuration metrics.Histogram
+	// Counts of failed git operations
+	OperationFailures metrics.Counter
+	// Size on disk of the most recent clone, and when it was made
+	CloneSize      metrics.Gauge
+	CloneTimestamp metrics.Gauge
+	// How to report the instance label
+	Labels fluxmetrics.LabelPolicy
+}
+
+func NewMetrics() Metrics {
+	return Metrics{
+		OperationDuration: prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: "flux",
+			Subsystem: "git",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of git operations on config repos, in seconds.",
+			Buckets:   stdprometheus.DefBuckets,
+		}, []string{fluxmetrics.LabelInstanceID, LabelOperation, fluxmetrics.LabelSuccess}),
+		OperationFailures: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "flux",
+			Subsystem: "git",
+			Name:      "operation_failures_total",
+			Help:      "Number of git operations on config repos that failed.",
+		}, []string{fluxmetrics.LabelInstanceID, LabelOperation}),
+		CloneSize: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "flux",
+			Subsystem: "git",
+			Name:      "clone_size_bytes",
+			Help:      "Size on disk of the most recent clone of the config repo.",
+		}, []string{fluxmetrics.LabelInstanceID}),
+		CloneTimestamp: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "flux",
+			Subsystem: "git",
+			Name:      "clone_timestamp_seconds",
+			Help:      "When the most recent clone of the config repo was made, as a Unix time; subtract from time() for its age.",
+		}, []string{fluxmetrics.LabelInstanceID}),
+	}
+}
+
+func (m Metrics) WithInstanceID(instanceID flux.InstanceID) Metrics {
+	if m.OperationDuration == nil {
+		return m
+	}
+	inst := m.Labels.Instance(string(instanceID))
+	return Metrics{
+		OperationDuration: m.OperationDuration.With(fluxmetrics.LabelInstanceID, inst),
+		OperationFailures: m.OperationFailures.With(fluxmetrics.LabelInstanceID, inst),
+		CloneSize:         m.CloneSize.With(fluxmetrics.LabelInstanceID, inst),
+		CloneTimestamp:    m.CloneTimestamp.With(fluxmetrics.LabelInstanceID, inst),
+		Labels:            m.Labels,
+	}
+}
+
+// observe records how an operation went, if there are metrics to
+// record it in.
+func (m Metrics) observe(op string, begin time.Time, err error) {
+	if m.OperationDuration == nil {
+		return
+	}
+	m.OperationDuration.With(
+		LabelOperation, op,
+		fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+	).Observe(time.Since(begin).Seconds())
+	if err != nil {
+		m.OperationFailures.With(LabelOperation, op).Add(1)
+	}
+}
+
+// observeClone records the size of a fresh clone.
+func (m Metrics) observeClone(path string) {
+	if m.CloneSize == nil {
+		return
+	}
+	m.CloneSize.Set(float64(dirSize(path)))
+	m.CloneTimestamp.Set(float64(time.Now().Unix()))
+}
+
+// dirSize adds up the sizes of the files under path.
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
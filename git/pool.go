@@ -0,0 +1,113 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Pool keeps clones of config repos which have been finished with, so
+// that they can be leased again rather than cloned afresh. A clone is
+// refreshed to the tip of the branch each time it's leased, and
+// leased to one job at a time, so jobs running in parallel each have a
+// working directory of their own.
+type Pool struct {
+	maxIdle int
+
+	mu   sync.Mutex
+	idle map[string][]string
+}
+
+// NewPool makes a pool which keeps up to maxIdle clones of each repo
+// (and working directory) which aren't leased.
+func NewPool(maxIdle int) *Pool {
+	return &Pool{
+		maxIdle: maxIdle,
+		idle:    map[string][]string{},
+	}
+}
+
+// poolKey says which clones in a pool are of the repo: those of the
+// same branch, made in the same working directory (i.e., for the same
+// instance).
+func (r Repo) poolKey() string {
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%t", r.URL, r.Branch, r.WorkingDir, r.Submodules)
+}
+
+// lease gives an idle clone of the repo, refreshed, or "" if there
+// isn't one. Clones which can't be refreshed, e.g., because they've
+// been removed by the janitor, are thrown away.
+func (p *Pool) lease(r Repo, stderr io.Writer) string {
+	for {
+		path := p.take(r.poolKey())
+		if path == "" {
+			return ""
+		}
+		if err := r.refresh(path, stderr); err != nil {
+			r.remove(path)
+			continue
+		}
+		touch(path)
+		return path
+	}
+}
+
+func (p *Pool) take(key string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	paths := p.idle[key]
+	if len(paths) == 0 {
+		return ""
+	}
+	path := paths[len(paths)-1]
+	if len(paths) == 1 {
+		delete(p.idle, key)
+	} else {
+		p.idle[key] = paths[:len(paths)-1]
+	}
+	return path
+}
+
+// put keeps a clone of the repo for leasing again, unless there are
+// already enough idle; it says whether it was kept.
+func (p *Pool) put(r Repo, path string) bool {
+	key := r.poolKey()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.idle[key]) >= p.maxIdle {
+		return false
+	}
+	touch(path)
+	p.idle[key] = append(p.idle[key], path)
+	return true
+}
+
+// Refresh brings the idle clones of the repo up to date, e.g., when
+// it's known to have been pushed to, so that those leasing them next
+// have less to fetch. Clones which can't be refreshed are thrown away.
+func (p *Pool) Refresh(r Repo) {
+	key := r.poolKey()
+	p.mu.Lock()
+	paths := p.idle[key]
+	delete(p.idle, key)
+	p.mu.Unlock()
+	for _, path := range paths {
+		if err := r.refresh(path, nil); err != nil {
+			r.remove(path)
+			continue
+		}
+		if !p.put(r, path) {
+			r.remove(path)
+		}
+	}
+}
+
+// touch marks the directory a clone was made in as recently used, so
+// the janitor doesn't take it to have been left behind.
+func touch(path string) {
+	now := time.Now()
+	os.Chtimes(filepath.Dir(path), now, now)
+}
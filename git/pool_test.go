@@ -0,0 +1,137 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// testOrigin makes a bare repo with a commit on master, giving a
+// function to push another commit adding the file named.
+func testOrigin(t *testing.T) (repo Repo, push func(file string), cleanup func()) {
+	dir, err := ioutil.TempDir("", "flux-pool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin, work := filepath.Join(dir, "origin.git"), filepath.Join(dir, "work")
+	run := func(dir string, args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	push = func(file string) {
+		if err := ioutil.WriteFile(filepath.Join(work, file), []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		run(work, "add", file)
+		run(work, "commit", "-m", "Add "+file)
+		run(work, "push", "origin", "HEAD:master")
+	}
+	run(dir, "init", "--bare", origin)
+	run(dir, "clone", origin, work)
+	push("first")
+	repo = Repo{URL: origin, Branch: "master", WorkingDir: filepath.Join(dir, "clones")}
+	return repo, push, func() { os.RemoveAll(dir) }
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestPoolLeaseRefreshes(t *testing.T) {
+	repo, push, cleanup := testOrigin(t)
+	defer cleanup()
+	repo.Pool = NewPool(1)
+
+	path, err := repo.Clone(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(path, "left-behind"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Clean(path); err != nil {
+		t.Fatal(err)
+	}
+	push("second")
+
+	leased, err := repo.Clone(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Clean(leased)
+	if leased != path {
+		t.Errorf("expected the idle clone %s to be leased, got %s", path, leased)
+	}
+	if !exists(filepath.Join(leased, "second")) {
+		t.Error("expected the leased clone to be at the tip of the branch")
+	}
+	if exists(filepath.Join(leased, "left-behind")) {
+		t.Error("expected what was left in the clone to be thrown away")
+	}
+}
+
+func TestPoolRefreshFailure(t *testing.T) {
+	repo, _, cleanup := testOrigin(t)
+	defer cleanup()
+	repo.Pool = NewPool(1)
+
+	path, err := repo.Clone(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Clean(path); err != nil {
+		t.Fatal(err)
+	}
+	// As though the janitor had got to it
+	if err := os.RemoveAll(filepath.Join(path, ".git")); err != nil {
+		t.Fatal(err)
+	}
+
+	fresh, err := repo.Clone(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Clean(fresh)
+	if fresh == path {
+		t.Error("expected a fresh clone, since the idle one couldn't be refreshed")
+	}
+	if exists(filepath.Dir(path)) {
+		t.Error("expected the clone which couldn't be refreshed to be removed")
+	}
+}
+
+func TestPoolMaxIdle(t *testing.T) {
+	repo, _, cleanup := testOrigin(t)
+	defer cleanup()
+	repo.Pool = NewPool(1)
+
+	first, err := repo.Clone(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := repo.Clone(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatal("expected clones leased at once to be different")
+	}
+	repo.Clean(first)
+	repo.Clean(second)
+
+	if !exists(first) {
+		t.Error("expected the first clone back to be kept")
+	}
+	if exists(filepath.Dir(second)) {
+		t.Error("expected the clone over the limit to be removed")
+	}
+	if n := len(repo.Pool.idle[repo.poolKey()]); n != 1 {
+		t.Errorf("expected one idle clone, got %d", n)
+	}
+}
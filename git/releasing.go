@@ -1,17 +1,18 @@
 package git
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
-
-	"github.com/pkg/errors"
+	"strings"
 )
 
-func clone(stderr io.Writer, workingDir, keyData, repoURL, repoBranch string) (path string, err error) {
+func clone(ctx context.Context, stderr io.Writer, workingDir, keyData, repoURL, repoBranch string, submodules bool) (path string, err error) {
 	keyPath, err := writeKey(keyData)
 	if err != nil {
 		return "", err
@@ -23,38 +24,202 @@ func clone(stderr io.Writer, workingDir, keyData, repoURL, repoBranch string) (p
 		args = append(args, "--branch", repoBranch)
 	}
 	args = append(args, repoURL, repoPath)
-	if err := gitCmd(stderr, workingDir, keyPath, args...).Run(); err != nil {
-		return "", errors.Wrap(err, "git clone")
+	if err := execGit(ctx, "clone", stderr, nil, workingDir, keyPath, args...); err != nil {
+		return "", err
+	}
+	if submodules {
+		if err := execGit(ctx, "submodule update", stderr, nil, repoPath, keyPath, "submodule", "update", "--init", "--recursive"); err != nil {
+			return "", err
+		}
 	}
 	return repoPath, nil
 }
 
-func commit(workingDir, commitMessage string) error {
-	if err := gitCmd(
-		nil, workingDir, "",
+// refresh fetches the branch from origin, and checks out its tip,
+// discarding any commits and changes made locally, along with files
+// not in the repo.
+func refresh(ctx context.Context, stderr io.Writer, keyData, workingDir, repoBranch string, submodules bool) error {
+	keyPath, err := writeKey(keyData)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(keyPath)
+	ref := "HEAD"
+	if repoBranch != "" {
+		ref = repoBranch
+	}
+	if err := execGit(ctx, "fetch origin "+ref, stderr, nil, workingDir, keyPath, "fetch", "origin", ref); err != nil {
+		return err
+	}
+	checkout := []string{"checkout", "--force", "FETCH_HEAD"}
+	if repoBranch != "" {
+		checkout = []string{"checkout", "--force", "-B", repoBranch, "FETCH_HEAD"}
+	}
+	if err := execGit(ctx, "checkout", stderr, nil, workingDir, "", checkout...); err != nil {
+		return err
+	}
+	if err := execGit(ctx, "clean", stderr, nil, workingDir, "", "clean", "-ffdx"); err != nil {
+		return err
+	}
+	if submodules {
+		if err := execGit(ctx, "submodule update", stderr, nil, workingDir, keyPath, "submodule", "update", "--init", "--recursive", "--force"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func commit(ctx context.Context, workingDir, commitMessage string) error {
+	return execGit(ctx, "commit", nil, nil, workingDir, "",
 		"-c", "user.name=Weave Flux", "-c", "user.email=support@weave.works",
 		"commit",
 		"--no-verify", "-a", "-m", commitMessage,
-	).Run(); err != nil {
-		return errors.Wrap(err, "git commit")
+	)
+}
+
+// headRevision returns the SHA of the commit at HEAD.
+func headRevision(ctx context.Context, workingDir string) (string, error) {
+	var out bytes.Buffer
+	if err := execGit(ctx, "rev-parse", nil, &out, workingDir, "", "rev-parse", "HEAD"); err != nil {
+		return "", err
 	}
-	return nil
+	return strings.TrimSpace(out.String()), nil
+}
+
+// currentBranch returns the name of the branch checked out; it's an
+// error if HEAD is detached.
+func currentBranch(ctx context.Context, workingDir string) (string, error) {
+	var out bytes.Buffer
+	if err := execGit(ctx, "symbolic-ref", nil, &out, workingDir, "", "symbolic-ref", "--short", "HEAD"); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
 }
 
-func push(keyData, repoBranch, workingDir string) error {
+// remoteRevision returns the SHA of the commit at the tip of the
+// branch in the remote repo, without needing a clone.
+func remoteRevision(ctx context.Context, keyData, repoURL, repoBranch string) (string, error) {
+	keyPath, err := writeKey(keyData)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(keyPath)
+	ref := "HEAD"
+	if repoBranch != "" {
+		ref = "refs/heads/" + repoBranch
+	}
+	var out bytes.Buffer
+	if err := execGit(ctx, "ls-remote", nil, &out, "", keyPath, "ls-remote", repoURL, ref); err != nil {
+		return "", err
+	}
+	fields := strings.Fields(out.String())
+	if len(fields) == 0 {
+		return "", fmt.Errorf("no ref %s in the remote repo", ref)
+	}
+	return fields[0], nil
+}
+
+// fetchRevision fetches the branch from origin, and returns the SHA
+// of the commit at its tip.
+func fetchRevision(ctx context.Context, keyData, repoBranch, workingDir string) (string, error) {
+	keyPath, err := writeKey(keyData)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(keyPath)
+	ref := "HEAD"
+	if repoBranch != "" {
+		ref = repoBranch
+	}
+	if err := execGit(ctx, "fetch origin "+ref, nil, nil, workingDir, keyPath, "fetch", "origin", ref); err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := execGit(ctx, "rev-parse", nil, &out, workingDir, "", "rev-parse", "FETCH_HEAD"); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// changedFiles lists the files under subdir which differ between two
+// revisions.
+func changedFiles(ctx context.Context, workingDir, from, to, subdir string) ([]string, error) {
+	args := []string{"diff", "--name-only", from, to}
+	if subdir != "" {
+		args = append(args, "--", subdir)
+	}
+	var out bytes.Buffer
+	if err := execGit(ctx, "diff", nil, &out, workingDir, "", args...); err != nil {
+		return nil, err
+	}
+	return strings.Fields(out.String()), nil
+}
+
+// rebase replays the commits made locally onto the revision given. If
+// that fails, the rebase is abandoned, leaving things as they were.
+func rebase(ctx context.Context, workingDir, onto string) error {
+	err := execGit(ctx, "rebase", nil, nil, workingDir, "",
+		"-c", "user.name=Weave Flux", "-c", "user.email=support@weave.works",
+		"rebase", onto,
+	)
+	if err != nil {
+		execGit(ctx, "rebase --abort", nil, nil, workingDir, "", "rebase", "--abort")
+	}
+	return err
+}
+
+// tag makes an annotated tag of the revision given.
+func tag(ctx context.Context, workingDir, name, revision, message string) error {
+	return execGit(ctx, "tag", nil, nil, workingDir, "",
+		"-c", "user.name=Weave Flux", "-c", "user.email=support@weave.works",
+		"tag",
+		"-a", "-m", message, name, revision,
+	)
+}
+
+// revert makes a commit undoing the last commit.
+func revert(ctx context.Context, workingDir string) error {
+	return execGit(ctx, "revert", nil, nil, workingDir, "",
+		"-c", "user.name=Weave Flux", "-c", "user.email=support@weave.works",
+		"revert",
+		"--no-edit", "HEAD",
+	)
+}
+
+func push(ctx context.Context, keyData, workingDir string, refs ...string) error {
 	keyPath, err := writeKey(keyData)
 	if err != nil {
 		return err
 	}
 	defer os.Remove(keyPath)
-	if err := gitCmd(nil, workingDir, keyPath, "push", "origin", repoBranch).Run(); err != nil {
-		return errors.Wrap(err, fmt.Sprintf("git push origin %s", repoBranch))
+	args := append([]string{"push", "origin"}, refs...)
+	return execGit(ctx, "push origin "+strings.Join(refs, " "), nil, nil, workingDir, keyPath, args...)
+}
+
+// execGit runs git, and if it fails, returns an *Error explaining
+// why, with what git printed to stderr. The stderr given, if any, also
+// gets a copy of what git printed; stdout, if given, gets its output.
+func execGit(ctx context.Context, op string, stderr, stdout io.Writer, dir, keyPath string, args ...string) error {
+	var errOut bytes.Buffer
+	c := gitCmd(ctx, &errOut, dir, keyPath, args...)
+	if stderr != nil {
+		c.Stderr = io.MultiWriter(&errOut, stderr)
+	}
+	if stdout != nil {
+		c.Stdout = stdout
+	}
+	if err := c.Run(); err != nil {
+		if ctx.Err() != nil {
+			// Timed out, or abandoned by whoever asked
+			err = ctx.Err()
+		}
+		return newError(op, errOut.String(), err)
 	}
 	return nil
 }
 
-func gitCmd(stderr io.Writer, dir, keyPath string, args ...string) *exec.Cmd {
-	c := exec.Command("git", args...)
+func gitCmd(ctx context.Context, stderr io.Writer, dir, keyPath string, args ...string) *exec.Cmd {
+	c := exec.CommandContext(ctx, "git", args...)
 	if dir != "" {
 		c.Dir = dir
 	}
@@ -75,9 +240,18 @@ func env(keyPath string) []string {
 	return []string{fmt.Sprintf("%s -i %q", base, keyPath), "GIT_TERMINAL_PROMPT=0"}
 }
 
+// isAncestor returns true if the revision given is in the history of
+// HEAD.
+func isAncestor(ctx context.Context, workingDir, revision string) bool {
+	mergeBase := gitCmd(ctx, nil, workingDir, "", "merge-base", "--is-ancestor", revision, "HEAD")
+	// This exits with 1 if it's not an ancestor, or 128 if there's
+	// no such revision
+	return mergeBase.Run() == nil
+}
+
 // check returns true if there are changes locally.
-func check(workingDir, subdir string) bool {
-	diff := gitCmd(nil, workingDir, "", "diff", "--quiet", "--", subdir)
+func check(ctx context.Context, workingDir, subdir string) bool {
+	diff := gitCmd(ctx, nil, workingDir, "", "diff", "--quiet", "--", subdir)
 	// `--quiet` means "exit with 1 if there are changes"
 	return diff.Run() != nil
 }
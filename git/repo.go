@@ -1,9 +1,14 @@
 package git
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 // Repo represents a remote git repo
@@ -21,24 +26,310 @@ type Repo struct {
 
 	// The path within the config repo where files are stored.
 	Path string
+
+	// Whether to initialise the config repo's submodules when
+	// cloning it. They're cloned with the same key.
+	Submodules bool
+
+	// WorkingDir is where clones are made; if empty, it's the
+	// system's temporary directory.
+	WorkingDir string
+
+	// Metadata says how to record release metadata with the commits
+	// made: not at all (MetadataNone), as trailers in the commit
+	// message (MetadataTrailers), or as git notes (MetadataNotes).
+	Metadata string
+
+	// Metrics, if set, record how long operations on the repo take.
+	Metrics Metrics
+
+	// Timeout is how long each git operation may take before it's
+	// abandoned; if zero, DefaultTimeout is used.
+	Timeout time.Duration
+
+	// Pool, if set, keeps clones finished with, so that Clone can
+	// refresh one of those rather than clone the repo again.
+	Pool *Pool
+
+	// ctx, if set, is done when operations on the repo are to be
+	// abandoned, whether or not they've timed out.
+	ctx context.Context
+}
+
+// DefaultTimeout is how long git operations may take, if the repo
+// doesn't say otherwise.
+const DefaultTimeout = 2 * time.Minute
+
+// WithContext gives a copy of the repo whose operations are also
+// abandoned when the context given is done, e.g., because the release
+// making them has timed out.
+func (r Repo) WithContext(ctx context.Context) Repo {
+	r.ctx = ctx
+	return r
+}
+
+func (r Repo) context() (context.Context, context.CancelFunc) {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	parent := r.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	return context.WithTimeout(parent, timeout)
 }
 
+// Clone gives a working directory with the branch checked out, at its
+// tip. It's a fresh clone, unless there's one in the repo's pool to
+// lease.
 func (r Repo) Clone(stderr io.Writer) (path string, err error) {
-	workingDir, err := ioutil.TempDir(os.TempDir(), "flux-gitclone")
+	if r.Pool != nil {
+		if path := r.Pool.lease(r, stderr); path != "" {
+			return path, nil
+		}
+	}
+	root := r.WorkingDir
+	if root == "" {
+		root = os.TempDir()
+	} else if err := os.MkdirAll(root, 0700); err != nil {
+		return "", err
+	}
+	workingDir, err := ioutil.TempDir(root, clonePrefix)
 	if err != nil {
 		return "", err
 	}
 
-	repoDir, err := clone(stderr, workingDir, r.Key, r.URL, r.Branch)
-	return repoDir, err
+	ctx, cancel := r.context()
+	defer cancel()
+	begin := time.Now()
+	repoDir, err := clone(ctx, stderr, workingDir, r.Key, r.URL, r.Branch, r.Submodules)
+	r.Metrics.observe(OperationClone, begin, err)
+	if err != nil {
+		os.RemoveAll(workingDir)
+		return "", err
+	}
+	r.Metrics.observeClone(repoDir)
+	return repoDir, nil
+}
+
+// Clean finishes with a clone made by Clone, given the path it
+// returned: it goes back in the repo's pool, if there's room, and is
+// removed otherwise. Nothing may use the clone afterwards, since it
+// may be leased to someone else.
+func (r Repo) Clean(path string) error {
+	if r.Pool != nil && strings.HasPrefix(filepath.Base(filepath.Dir(path)), clonePrefix) && r.Pool.put(r, path) {
+		return nil
+	}
+	return r.remove(path)
 }
 
-func (r Repo) CommitAndPush(path, commitMessage string) (string, error) {
-	if !check(path, r.Path) {
+// refresh brings a clone up to date with the tip of the branch,
+// throwing away whatever was done in it.
+func (r Repo) refresh(path string, stderr io.Writer) error {
+	ctx, cancel := r.context()
+	defer cancel()
+	begin := time.Now()
+	err := refresh(ctx, stderr, r.Key, path, r.Branch, r.Submodules)
+	r.Metrics.observe(OperationRefresh, begin, err)
+	return err
+}
+
+// remove removes a clone, along with the directory it was made in.
+func (r Repo) remove(path string) error {
+	dir := filepath.Dir(path)
+	if !strings.HasPrefix(filepath.Base(dir), clonePrefix) {
+		return os.RemoveAll(path)
+	}
+	return os.RemoveAll(dir)
+}
+
+// CommitAndPush commits the changes in the working directory given,
+// and pushes them. If base is not empty, it's the revision the changes
+// were made on top of: it's an error if that's not what's checked out,
+// and if the branch has moved on upstream, the commit is rebased onto
+// it, so long as nobody else has changed the same files. The metadata
+// given is recorded as the repo's Metadata says.
+func (r Repo) CommitAndPush(path, base, commitMessage string, metadata []Trailer) (string, error) {
+	ctx, cancel := r.context()
+	defer cancel()
+	if !check(ctx, path, r.Path) {
 		return "no changes made to files", nil
 	}
-	if err := commit(path, commitMessage); err != nil {
+	if base != "" {
+		if err := r.VerifyHead(path, base); err != nil {
+			return "", err
+		}
+	}
+	var note string
+	if len(metadata) > 0 {
+		switch r.Metadata {
+		case MetadataTrailers:
+			commitMessage += "\n\n" + formatTrailers(metadata)
+		case MetadataNotes:
+			note = formatTrailers(metadata)
+		}
+	}
+	begin := time.Now()
+	err := commit(ctx, path, commitMessage)
+	r.Metrics.observe(OperationCommit, begin, err)
+	if err != nil {
 		return "", err
 	}
-	return "", push(r.Key, r.Branch, path)
+	return "", r.push(path, base, note)
+}
+
+// RevertAndPush undoes the last commit in the working directory
+// given, with a new commit, and pushes that.
+func (r Repo) RevertAndPush(path string) error {
+	ctx, cancel := r.context()
+	defer cancel()
+	begin := time.Now()
+	err := revert(ctx, path)
+	r.Metrics.observe(OperationRevert, begin, err)
+	if err != nil {
+		return err
+	}
+	return r.push(path, "", "")
+}
+
+// TagAndPush marks the revision given, in the working directory given:
+// with an annotated tag, if name isn't empty, and by moving the ref
+// given (in full, e.g., "refs/tags/deployed"), if that isn't empty.
+// Both are pushed; the ref is moved whatever it pointed at before.
+func (r Repo) TagAndPush(path, revision, name, message, ref string) (err error) {
+	ctx, cancel := r.context()
+	defer cancel()
+	begin := time.Now()
+	defer func() { r.Metrics.observe(OperationTag, begin, err) }()
+	var refs []string
+	if name != "" {
+		if err := tag(ctx, path, name, revision, message); err != nil {
+			return err
+		}
+		refs = append(refs, "refs/tags/"+name)
+	}
+	if ref != "" {
+		refs = append(refs, "+"+revision+":"+ref)
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	return push(ctx, r.Key, path, refs...)
+}
+
+// push pushes the branch. If base is given, it's first rebased onto
+// the upstream branch, should that have moved on; if note is given,
+// it's attached to the commit pushed, and the notes pushed too.
+func (r Repo) push(path, base, note string) (err error) {
+	ctx, cancel := r.context()
+	defer cancel()
+	begin := time.Now()
+	defer func() { r.Metrics.observe(OperationPush, begin, err) }()
+	if base != "" {
+		upstream, err := fetchRevision(ctx, r.Key, r.Branch, path)
+		if err != nil {
+			return err
+		}
+		if upstream != base {
+			if err := r.rebaseOnto(ctx, path, base, upstream); err != nil {
+				return err
+			}
+		}
+	}
+	refs := []string{r.Branch}
+	if note != "" {
+		if err := addNote(ctx, r.Key, path, note); err != nil {
+			return err
+		}
+		refs = append(refs, NotesRef)
+	}
+	return push(ctx, r.Key, path, refs...)
+}
+
+// rebaseOnto moves the commits made locally on top of base onto
+// upstream, refusing if the commits upstream touch the same files.
+func (r Repo) rebaseOnto(ctx context.Context, path, base, upstream string) error {
+	ours, err := changedFiles(ctx, path, base, "HEAD", "")
+	if err != nil {
+		return err
+	}
+	theirs, err := changedFiles(ctx, path, base, upstream, "")
+	if err != nil {
+		return err
+	}
+	if both := intersect(ours, theirs); len(both) > 0 {
+		return &MovedError{Branch: r.Branch, From: base, To: upstream, Files: both}
+	}
+	return rebase(ctx, path, upstream)
+}
+
+func intersect(a, b []string) []string {
+	in := map[string]bool{}
+	for _, s := range a {
+		in[s] = true
+	}
+	var res []string
+	for _, s := range b {
+		if in[s] {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// BranchRevision returns the revision at the tip of the branch in the
+// remote repo.
+func (r Repo) BranchRevision() (string, error) {
+	ctx, cancel := r.context()
+	defer cancel()
+	return remoteRevision(ctx, r.Key, r.URL, r.Branch)
+}
+
+// VerifyHead checks that the working directory given has the repo's
+// branch checked out, at the revision given.
+func (r Repo) VerifyHead(path, revision string) error {
+	ctx, cancel := r.context()
+	defer cancel()
+	if r.Branch != "" {
+		branch, err := currentBranch(ctx, path)
+		if err != nil {
+			return err
+		}
+		if branch != r.Branch {
+			return fmt.Errorf("expected branch %s to be checked out, but it's %s", r.Branch, branch)
+		}
+	}
+	head, err := headRevision(ctx, path)
+	if err != nil {
+		return err
+	}
+	if head != revision {
+		return fmt.Errorf("expected HEAD to be at %s, but it's at %s", short(revision), short(head))
+	}
+	return nil
+}
+
+// ChangedFiles lists the files under the repo's path which differ
+// between two revisions, in the working directory given.
+func (r Repo) ChangedFiles(path, from, to string) ([]string, error) {
+	ctx, cancel := r.context()
+	defer cancel()
+	return changedFiles(ctx, path, from, to, r.Path)
+}
+
+// Contains says whether the revision given is in the history of what's
+// checked out in the working directory given.
+func (r Repo) Contains(path, revision string) bool {
+	ctx, cancel := r.context()
+	defer cancel()
+	return isAncestor(ctx, path, revision)
+}
+
+// HeadRevision returns the revision of the commit at HEAD in the
+// working directory given.
+func (r Repo) HeadRevision(path string) (string, error) {
+	ctx, cancel := r.context()
+	defer cancel()
+	return headRevision(ctx, path)
 }
@@ -0,0 +1,127 @@
+// Package health serves liveness and readiness checks, for
+// orchestrators and load balancers to probe.
+//
+// Liveness (/healthz) says whether the process is working at all; if
+// not, it's wedged and ought to be restarted. Readiness (/readyz)
+// says whether it can do its job right now, given what it depends
+// on; if not, it ought not to be sent requests, but restarting it
+// won't help.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	LabelCheck = "check"
+	// checkTimeout is how long a check has to answer before it's
+	// taken to have failed.
+	checkTimeout = 5 * time.Second
+)
+
+// Check returns nil if what it checks is OK, and otherwise an error
+// saying what's wrong.
+type Check func() error
+
+// Checks are named, so their results can be told apart.
+type Checks map[string]Check
+
+// Result is what's served for each check: "ok", or the error.
+type Result map[string]string
+
+// Run runs all the checks, concurrently, and says whether they all
+// passed.
+func (cs Checks) Run() (Result, bool) {
+	type outcome struct {
+		name string
+		err  error
+	}
+	outcomes := make(chan outcome, len(cs))
+	for name, check := range cs {
+		go func(name string, check Check) {
+			outcomes <- outcome{name, check()}
+		}(name, check)
+	}
+
+	res := Result{}
+	for name := range cs {
+		res[name] = "timed out"
+	}
+	ok := true
+	timeout := time.After(checkTimeout)
+	for i := 0; i < len(cs); i++ {
+		select {
+		case o := <-outcomes:
+			if o.err != nil {
+				res[o.name] = o.err.Error()
+				ok = false
+			} else {
+				res[o.name] = "ok"
+			}
+		case <-timeout:
+			return res, false
+		}
+	}
+	return res, ok
+}
+
+// Handler serves the results of running the checks, with the status
+// 200 if they all pass and 503 if any fail. If status is not nil,
+// it's set to 1 or 0 for each check, labelled with its name.
+func Handler(checks Checks, status metrics.Gauge) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, ok := checks.Run()
+		if status != nil {
+			for _, name := range checks.names() {
+				v := 0.0
+				if res[name] == "ok" {
+					v = 1
+				}
+				status.With(LabelCheck, name).Set(v)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if ok {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(res)
+	})
+}
+
+func (cs Checks) names() []string {
+	var names []string
+	for name := range cs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Register serves liveness and readiness checks on the mux, at
+// /healthz and /readyz. Everything live is a prerequisite for being
+// ready, so the liveness checks are run for readiness too.
+func Register(mux *http.ServeMux, live, ready Checks, status metrics.Gauge) {
+	all := Checks{}
+	for name, check := range live {
+		all[name] = check
+	}
+	for name, check := range ready {
+		all[name] = check
+	}
+	mux.Handle("/healthz", Handler(live, labelled(status, "healthz")))
+	mux.Handle("/readyz", Handler(all, labelled(status, "readyz")))
+}
+
+func labelled(g metrics.Gauge, endpoint string) metrics.Gauge {
+	if g == nil {
+		return nil
+	}
+	return g.With("endpoint", endpoint)
+}
@@ -0,0 +1,44 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerStatus(t *testing.T) {
+	for _, c := range []struct {
+		checks Checks
+		status int
+	}{
+		{Checks{}, http.StatusOK},
+		{Checks{"a": func() error { return nil }}, http.StatusOK},
+		{Checks{
+			"a": func() error { return nil },
+			"b": func() error { return errors.New("down") },
+		}, http.StatusServiceUnavailable},
+	} {
+		rec := httptest.NewRecorder()
+		Handler(c.checks, nil).ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+		if rec.Code != c.status {
+			t.Errorf("%d checks: expected status %d, got %d", len(c.checks), c.status, rec.Code)
+		}
+	}
+}
+
+func TestReadinessIncludesLiveness(t *testing.T) {
+	mux := http.NewServeMux()
+	Register(mux, Checks{
+		"loop": func() error { return errors.New("wedged") },
+	}, Checks{
+		"db": func() error { return nil },
+	}, nil)
+	for _, path := range []string{"/healthz", "/readyz"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: expected status %d, got %d", path, http.StatusServiceUnavailable, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+// NewGrafanaAnnotator gives a ReleaseAnnotator that marks releases
+// with annotations in Grafana: one is made when the release of a
+// service starts, and extended to when it finishes.
+func NewGrafanaAnnotator(d flux.Doer, config flux.GrafanaConfig) *Grafana {
+	return &Grafana{
+		d:      d,
+		config: config,
+		now:    time.Now,
+	}
+}
+
+type Grafana struct {
+	d      flux.Doer
+	config flux.GrafanaConfig
+	now    func() time.Time
+}
+
+type grafanaAnnotation struct {
+	DashboardID int64    `json:"dashboardId,omitempty"`
+	Time        int64    `json:"time,omitempty"`
+	TimeEnd     int64    `json:"timeEnd,omitempty"`
+	Tags        []string `json:"tags"`
+	Text        string   `json:"text"`
+}
+
+func (g *Grafana) ReleaseStarted(service flux.ServiceID, releases []flux.ImageRelease) (string, error) {
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	err := g.call("POST", "/api/annotations", grafanaAnnotation{
+		DashboardID: g.config.DashboardID,
+		Time:        millis(g.now()),
+		Tags:        g.tags(service),
+		Text:        fmt.Sprintf("Releasing %s%s", service, transitions(releases)),
+	}, &created)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(created.ID, 10), nil
+}
+
+func (g *Grafana) ReleaseFinished(ref string, service flux.ServiceID, releases []flux.ImageRelease, releaseErr error) error {
+	result, text := "succeeded", fmt.Sprintf("Released %s%s", service, transitions(releases))
+	if releaseErr != nil {
+		result, text = "failed", fmt.Sprintf("Release of %s failed: %v%s", service, releaseErr, transitions(releases))
+	}
+	annotation := grafanaAnnotation{
+		TimeEnd: millis(g.now()),
+		Tags:    append(g.tags(service), result),
+		Text:    text,
+	}
+	if ref == "" {
+		// There's nothing to extend, so the best we can do is to
+		// mark the finish.
+		annotation.DashboardID = g.config.DashboardID
+		annotation.Time, annotation.TimeEnd = annotation.TimeEnd, 0
+		return g.call("POST", "/api/annotations", annotation, nil)
+	}
+	return g.call("PATCH", "/api/annotations/"+ref, annotation, nil)
+}
+
+func (g *Grafana) tags(service flux.ServiceID) []string {
+	namespace, _ := service.Components()
+	return append([]string{"flux", namespace, string(service)}, g.config.Tags...)
+}
+
+// transitions says how the images changed, e.g.,
+// ": web from quay.io/example/web:1 to quay.io/example/web:2".
+func transitions(releases []flux.ImageRelease) string {
+	var changes []string
+	for _, r := range releases {
+		changes = append(changes, fmt.Sprintf("%s from %s to %s", r.Container, r.From, r.To))
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+	return ": " + strings.Join(changes, ", ")
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func (g *Grafana) call(method, path string, in, out interface{}) error {
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(in); err != nil {
+		return errors.Wrap(err, "encoding Grafana annotation")
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(g.config.URL, "/")+path, buf)
+	if err != nil {
+		return errors.Wrap(err, "constructing Grafana HTTP request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.config.APIKey)
+	}
+	resp, err := g.d.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "executing HTTP %s to Grafana", method)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+		return fmt.Errorf("%s from Grafana (%s)", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if out == nil {
+		return nil
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(out), "decoding Grafana response")
+}
@@ -27,9 +27,60 @@ type EventReader interface {
 	EventsForService(namespace, service string) ([]Event, error)
 }
 
+// ImageReleaseWriter records the image changes made by releases.
+type ImageReleaseWriter interface {
+	LogImageReleases([]flux.ImageRelease) error
+}
+
+type ImageReleaseReader interface {
+	// ImagesAt returns, for each container in the service, the most
+	// recent change made at or before the time given; i.e., what
+	// was running then.
+	ImagesAt(service flux.ServiceID, at time.Time) ([]flux.ImageRelease, error)
+
+	// Timeline returns the image releases selected by the query, in
+	// ascending timestamp order.
+	Timeline(flux.TimelineQuery) ([]flux.ImageRelease, error)
+}
+
+type ImageReleaseReadWriter interface {
+	ImageReleaseReader
+	ImageReleaseWriter
+}
+
+// ReleaseAnnotator marks the start and finish of the release of a
+// service, e.g., on dashboards.
+type ReleaseAnnotator interface {
+	// ReleaseStarted gives a reference to the mark made, to pass to
+	// ReleaseFinished.
+	ReleaseStarted(service flux.ServiceID, releases []flux.ImageRelease) (string, error)
+	// ReleaseFinished marks the end of the release, which failed if
+	// err is not nil.
+	ReleaseFinished(ref string, service flux.ServiceID, releases []flux.ImageRelease, err error) error
+}
+
+// NopAnnotator is a ReleaseAnnotator that doesn't mark anything.
+type NopAnnotator struct{}
+
+func (NopAnnotator) ReleaseStarted(flux.ServiceID, []flux.ImageRelease) (string, error) {
+	return "", nil
+}
+
+func (NopAnnotator) ReleaseFinished(string, flux.ServiceID, []flux.ImageRelease, error) error {
+	return nil
+}
+
 type DB interface {
 	LogEvent(inst flux.InstanceID, namespace, service, msg string) error
 	AllEvents(inst flux.InstanceID) ([]Event, error)
 	EventsForService(inst flux.InstanceID, namespace, service string) ([]Event, error)
+	LogImageReleases(inst flux.InstanceID, releases []flux.ImageRelease) error
+	ImagesAt(inst flux.InstanceID, service flux.ServiceID, at time.Time) ([]flux.ImageRelease, error)
+	Timeline(inst flux.InstanceID, q flux.TimelineQuery) ([]flux.ImageRelease, error)
+	// Prune removes events and image releases, for all instances,
+	// recorded before the time given (unless it's zero); and all but
+	// the latest keep events of each instance (if keep is more than
+	// zero).
+	Prune(before time.Time, keep int) error
 	io.Closer
 }
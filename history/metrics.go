@@ -51,6 +51,36 @@ func (i *instrumentedDB) LogEvent(inst flux.InstanceID, namespace, service, msg
 	return i.db.LogEvent(inst, namespace, service, msg)
 }
 
+func (i *instrumentedDB) LogImageReleases(inst flux.InstanceID, releases []flux.ImageRelease) (err error) {
+	defer func(begin time.Time) {
+		i.m.RequestDuration.With(
+			LabelMethod, "LogImageReleases",
+			LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.db.LogImageReleases(inst, releases)
+}
+
+func (i *instrumentedDB) ImagesAt(inst flux.InstanceID, service flux.ServiceID, at time.Time) (r []flux.ImageRelease, err error) {
+	defer func(begin time.Time) {
+		i.m.RequestDuration.With(
+			LabelMethod, "ImagesAt",
+			LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.db.ImagesAt(inst, service, at)
+}
+
+func (i *instrumentedDB) Timeline(inst flux.InstanceID, q flux.TimelineQuery) (r []flux.ImageRelease, err error) {
+	defer func(begin time.Time) {
+		i.m.RequestDuration.With(
+			LabelMethod, "Timeline",
+			LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.db.Timeline(inst, q)
+}
+
 func (i *instrumentedDB) AllEvents(inst flux.InstanceID) (e []Event, err error) {
 	defer func(begin time.Time) {
 		i.m.RequestDuration.With(
@@ -71,6 +101,16 @@ func (i *instrumentedDB) EventsForService(inst flux.InstanceID, namespace, servi
 	return i.db.EventsForService(inst, namespace, service)
 }
 
+func (i *instrumentedDB) Prune(before time.Time, keep int) (err error) {
+	defer func(begin time.Time) {
+		i.m.RequestDuration.With(
+			LabelMethod, "Prune",
+			LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.db.Prune(before, keep)
+}
+
 func (i *instrumentedDB) Close() (err error) {
 	defer func(begin time.Time) {
 		i.m.RequestDuration.With(
@@ -0,0 +1,27 @@
+package nats
+
+import (
+	"github.com/nats-io/nats"
+)
+
+// Publisher publishes messages to NATS subjects.
+type Publisher struct {
+	conn *nats.Conn
+}
+
+func NewPublisher(url string) (*Publisher, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+	return &Publisher{conn: conn}, nil
+}
+
+func (p *Publisher) Publish(subject string, data []byte) error {
+	return p.conn.Publish(subject, data)
+}
+
+func (p *Publisher) Close() error {
+	p.conn.Close()
+	return nil
+}
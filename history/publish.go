@@ -0,0 +1,70 @@
+package history
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+// Kinds of event published.
+const (
+	PublishedEventKind        = "event"
+	PublishedImageReleaseKind = "image_releases"
+)
+
+// PublishedEvent is what's published for each event and each batch
+// of image releases, so that other systems can follow what's
+// happening in an instance without polling its history.
+type PublishedEvent struct {
+	Kind     string
+	Instance flux.InstanceID
+	Service  flux.ServiceID      `json:",omitempty"`
+	Message  string              `json:",omitempty"`
+	Releases []flux.ImageRelease `json:",omitempty"`
+	Stamp    time.Time
+}
+
+// Publisher sends messages to a topic on a message bus.
+type Publisher interface {
+	Publish(topic string, data []byte) error
+}
+
+// PublishingWriter publishes the events and image releases of an
+// instance, as PublishedEvents encoded as JSON, to a topic.
+type PublishingWriter struct {
+	publisher Publisher
+	inst      flux.InstanceID
+	topic     string
+}
+
+func NewPublishingWriter(p Publisher, inst flux.InstanceID, topic string) *PublishingWriter {
+	return &PublishingWriter{publisher: p, inst: inst, topic: topic}
+}
+
+func (w *PublishingWriter) LogEvent(namespace, service, msg string) error {
+	return w.publish(PublishedEvent{
+		Kind:    PublishedEventKind,
+		Service: flux.MakeServiceID(namespace, service),
+		Message: msg,
+	})
+}
+
+func (w *PublishingWriter) LogImageReleases(releases []flux.ImageRelease) error {
+	return w.publish(PublishedEvent{
+		Kind:     PublishedImageReleaseKind,
+		Releases: releases,
+	})
+}
+
+func (w *PublishingWriter) publish(e PublishedEvent) error {
+	e.Instance = w.inst
+	e.Stamp = time.Now().UTC()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "encoding event to publish")
+	}
+	return errors.Wrapf(w.publisher.Publish(w.topic, data), "publishing to %s", w.topic)
+}
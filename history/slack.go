@@ -11,9 +11,11 @@ import (
 	"strings"
 
 	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
 )
 
-func NewSlackEventWriter(d Doer, webhookURL, username string, matchExprs ...string) *Slack {
+func NewSlackEventWriter(d flux.Doer, webhookURL, username string, matchExprs ...string) *Slack {
 	var re []*regexp.Regexp
 	for _, expr := range matchExprs {
 		re = append(re, regexp.MustCompile(expr))
@@ -27,7 +29,7 @@ func NewSlackEventWriter(d Doer, webhookURL, username string, matchExprs ...stri
 }
 
 type Slack struct {
-	d          Doer
+	d          flux.Doer
 	webhookURL string
 	username   string
 	re         []*regexp.Regexp
@@ -71,8 +73,3 @@ func (s *Slack) match(text string) bool {
 	}
 	return false
 }
-
-// Doer is satisfied by *http.Client.
-type Doer interface {
-	Do(*http.Request) (*http.Response, error)
-}
@@ -2,6 +2,8 @@ package sql
 
 import (
 	"database/sql"
+	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -75,6 +77,173 @@ func (db *DB) LogEvent(inst flux.InstanceID, namespace, service, msg string) err
 	return err
 }
 
+func (db *DB) LogImageReleases(inst flux.InstanceID, releases []flux.ImageRelease) error {
+	tx, err := db.driver.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range releases {
+		namespace, service := r.Service.Components()
+		if _, err = tx.Exec(`INSERT INTO image_releases
+                              (instance, namespace, service, container, from_image, to_image, from_digest, to_digest, revision, branch, to_created_at, failed, stamp)
+                              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, now())`,
+			string(inst), namespace, service, r.Container, r.From.String(), r.To.String(), r.FromDigest, r.ToDigest, r.Revision, r.Branch, r.ToCreatedAt, r.Failed); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *DB) ImagesAt(inst flux.InstanceID, service flux.ServiceID, at time.Time) ([]flux.ImageRelease, error) {
+	namespace, name := service.Components()
+	releases, err := db.queryImageReleases(`SELECT namespace, service, container, from_image, to_image, from_digest, to_digest, revision, branch, to_created_at, failed, stamp
+                                            FROM image_releases
+                                            WHERE instance = $1 AND namespace = $2 AND service = $3 AND stamp <= $4
+                                              AND (failed IS NULL OR failed = false)
+                                            ORDER BY stamp DESC`, string(inst), namespace, name, at)
+	if err != nil {
+		return nil, err
+	}
+
+	// The most recent release for each container is what was running.
+	seen := map[string]bool{}
+	res := []flux.ImageRelease{}
+	for _, r := range releases {
+		if seen[r.Container] {
+			continue
+		}
+		seen[r.Container] = true
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+func (db *DB) Timeline(inst flux.InstanceID, q flux.TimelineQuery) ([]flux.ImageRelease, error) {
+	query := `SELECT namespace, service, container, from_image, to_image, from_digest, to_digest, revision, branch, to_created_at, failed, stamp
+              FROM image_releases
+              WHERE instance = $1`
+	params := []interface{}{string(inst)}
+	where := func(cond string, param interface{}) {
+		params = append(params, param)
+		query += fmt.Sprintf(" AND %s $%d", cond, len(params))
+	}
+	if q.Service != "" {
+		namespace, service := q.Service.Components()
+		where("namespace =", namespace)
+		where("service =", service)
+	}
+	if q.Branch != "" {
+		where("branch =", q.Branch)
+	}
+	if !q.Since.IsZero() {
+		where("stamp >=", q.Since)
+	}
+	if !q.Until.IsZero() {
+		where("stamp <=", q.Until)
+	}
+	return db.queryImageReleases(query+" ORDER BY stamp ASC", params...)
+}
+
+func (db *DB) queryImageReleases(query string, params ...interface{}) ([]flux.ImageRelease, error) {
+	rows, err := db.driver.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []flux.ImageRelease{}
+	for rows.Next() {
+		var (
+			r                                            flux.ImageRelease
+			namespace, service                           string
+			to                                           string
+			from, fromDigest, toDigest, revision, branch sql.NullString
+			createdAt                                    nullTime
+			failed                                       sql.NullBool
+		)
+		if err := rows.Scan(&namespace, &service, &r.Container, &from, &to, &fromDigest, &toDigest, &revision, &branch, &createdAt, &failed, &r.Stamp); err != nil {
+			return nil, err
+		}
+		if createdAt.Valid {
+			r.ToCreatedAt = &createdAt.Time
+		}
+		r.Failed = failed.Bool
+		r.Service = flux.MakeServiceID(namespace, service)
+		r.From.UnmarshalText([]byte(from.String))
+		r.To.UnmarshalText([]byte(to))
+		r.FromDigest, r.ToDigest = fromDigest.String, toDigest.String
+		r.Revision, r.Branch = revision.String, branch.String
+		res = append(res, r)
+	}
+	return res, rows.Err()
+}
+
+func (db *DB) Prune(before time.Time, keep int) error {
+	tx, err := db.driver.Begin()
+	if err != nil {
+		return err
+	}
+
+	if !before.IsZero() {
+		if _, err = tx.Exec(`DELETE FROM history WHERE stamp < $1`, before); err == nil {
+			_, err = tx.Exec(`DELETE FROM image_releases WHERE stamp < $1`, before)
+		}
+	}
+	if err == nil && keep > 0 {
+		err = pruneEventsOver(tx, keep)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	return err
+}
+
+// pruneEventsOver removes all but the latest keep events of each
+// instance.
+func pruneEventsOver(tx *sql.Tx, keep int) error {
+	rows, err := tx.Query(`SELECT DISTINCT instance FROM history`)
+	if err != nil {
+		return err
+	}
+	var instances []string
+	for rows.Next() {
+		var inst string
+		if err := rows.Scan(&inst); err != nil {
+			rows.Close()
+			return err
+		}
+		instances = append(instances, inst)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, inst := range instances {
+		// The newest event past those kept, and everything older
+		// than it, goes.
+		var cutoff time.Time
+		err := tx.QueryRow(`SELECT stamp FROM history
+                            WHERE instance = $1
+                            ORDER BY stamp DESC
+                            LIMIT 1 OFFSET $2`, inst, keep).Scan(&cutoff)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM history WHERE instance = $1 AND stamp <= $2`, inst, cutoff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (db *DB) sanityCheck() (err error) {
 	_, err = db.driver.Query("SELECT instance, namespace, service, message, stamp FROM history LIMIT 1")
 	if err != nil {
@@ -86,3 +255,22 @@ func (db *DB) sanityCheck() (err error) {
 func (db *DB) Close() error {
 	return db.driver.Close()
 }
+
+// nullTime is a time which may be NULL in the database.
+type nullTime struct {
+	Time  time.Time
+	Valid bool // Valid is true if Time is not NULL
+}
+
+func (n *nullTime) Scan(value interface{}) error {
+	if value == nil {
+		n.Time, n.Valid = time.Time{}, false
+		return nil
+	}
+	t, ok := value.(time.Time)
+	if !ok {
+		return fmt.Errorf("unsupported Scan of %T into nullTime", value)
+	}
+	n.Time, n.Valid = t, true
+	return nil
+}
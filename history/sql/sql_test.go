@@ -2,6 +2,7 @@ package sql
 
 import (
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"net/url"
 	"testing"
@@ -88,3 +89,129 @@ func checkInDescOrder(t *testing.T, events []history.Event) {
 		last = event.Stamp
 	}
 }
+
+func imageID(s string) flux.ImageID {
+	id, _ := flux.ParseImageID(s)
+	return id
+}
+
+func TestImagesAt(t *testing.T) {
+	instance := flux.InstanceID("instance")
+	service := flux.ServiceID("namespace/service")
+	db := newSQL(t)
+	defer db.Close()
+
+	before := time.Now().Add(-time.Minute)
+	bailIfErr(t, db.LogImageReleases(instance, []flux.ImageRelease{
+		{Service: service, Container: "a", From: imageID("repo/a:v1"), To: imageID("repo/a:v2"), Revision: "abc"},
+		{Service: service, Container: "b", From: imageID("repo/b:v1"), To: imageID("repo/b@sha256:def"), ToDigest: "sha256:def"},
+	}))
+	bailIfErr(t, db.LogImageReleases(instance, []flux.ImageRelease{
+		{Service: service, Container: "a", From: imageID("repo/a:v2"), To: imageID("repo/a:v3")},
+	}))
+
+	rs, err := db.ImagesAt(instance, service, before)
+	bailIfErr(t, err)
+	if len(rs) != 0 {
+		t.Errorf("expected nothing running before any releases, got %+v", rs)
+	}
+
+	rs, err = db.ImagesAt(instance, service, time.Now().Add(time.Minute))
+	bailIfErr(t, err)
+	running := map[string]flux.ImageRelease{}
+	for _, r := range rs {
+		running[r.Container] = r
+	}
+	if len(running) != 2 {
+		t.Fatalf("expected 2 containers, got %+v", rs)
+	}
+	if running["a"].To.String() != "repo/a:v3" {
+		t.Errorf("expected latest image for a, got %+v", running["a"])
+	}
+	if running["b"].ToDigest != "sha256:def" {
+		t.Errorf("expected digest for b, got %+v", running["b"])
+	}
+}
+
+func TestPruneKeepsLatestEvents(t *testing.T) {
+	db := newSQL(t)
+	defer db.Close()
+
+	for i := 0; i < 5; i++ {
+		bailIfErr(t, db.LogEvent("busy", "namespace", "service", fmt.Sprintf("event %d", i)))
+		time.Sleep(time.Millisecond)
+	}
+	bailIfErr(t, db.LogEvent("quiet", "namespace", "service", "event"))
+
+	bailIfErr(t, db.Prune(time.Time{}, 3))
+
+	es, err := db.AllEvents("busy")
+	bailIfErr(t, err)
+	if len(es) != 3 {
+		t.Fatalf("expected 3 events kept, got %+v", es)
+	}
+	for i, e := range es {
+		if expected := fmt.Sprintf("event %d", 4-i); e.Msg != expected {
+			t.Errorf("expected the latest events to be kept, got %q at %d", e.Msg, i)
+		}
+	}
+	es, err = db.AllEvents("quiet")
+	bailIfErr(t, err)
+	if len(es) != 1 {
+		t.Errorf("expected an instance with few events to keep them, got %+v", es)
+	}
+}
+
+func TestPruneImageReleases(t *testing.T) {
+	instance := flux.InstanceID("instance")
+	service := flux.ServiceID("namespace/service")
+	db := newSQL(t)
+	defer db.Close()
+
+	bailIfErr(t, db.LogEvent(instance, "namespace", "service", "old event"))
+	bailIfErr(t, db.LogImageReleases(instance, []flux.ImageRelease{
+		{Service: service, Container: "a", From: imageID("repo/a:v1"), To: imageID("repo/a:v2")},
+	}))
+	time.Sleep(10 * time.Millisecond)
+	cutoff := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	bailIfErr(t, db.LogImageReleases(instance, []flux.ImageRelease{
+		{Service: service, Container: "a", From: imageID("repo/a:v2"), To: imageID("repo/a:v3")},
+	}))
+
+	bailIfErr(t, db.Prune(cutoff, 0))
+
+	rs, err := db.Timeline(instance, flux.TimelineQuery{})
+	bailIfErr(t, err)
+	if len(rs) != 1 || rs[0].To.String() != "repo/a:v3" {
+		t.Errorf("expected only the release after the cutoff, got %+v", rs)
+	}
+	es, err := db.AllEvents(instance)
+	bailIfErr(t, err)
+	if len(es) != 0 {
+		t.Errorf("expected events before the cutoff to be pruned, got %+v", es)
+	}
+}
+
+func TestHistoryOnlyDatabase(t *testing.T) {
+	source := "file://" + mkDBFile(t)
+	if _, err := db.Migrate(source, "../../db/migrations/history"); err != nil {
+		t.Fatal(err)
+	}
+	historyDB, err := NewSQL("ql", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer historyDB.Close()
+
+	instance := flux.InstanceID("instance")
+	bailIfErr(t, historyDB.LogEvent(instance, "namespace", "service", "event"))
+	bailIfErr(t, historyDB.LogImageReleases(instance, []flux.ImageRelease{
+		{Service: "namespace/service", Container: "a", To: imageID("repo/a:v1"), Branch: "master", Failed: true},
+	}))
+	rs, err := historyDB.Timeline(instance, flux.TimelineQuery{Branch: "master"})
+	bailIfErr(t, err)
+	if len(rs) != 1 || !rs[0].Failed {
+		t.Errorf("expected the release as logged, got %+v", rs)
+	}
+}
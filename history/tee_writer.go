@@ -3,6 +3,8 @@ package history
 import (
 	"fmt"
 	"strings"
+
+	"github.com/weaveworks/flux"
 )
 
 func TeeWriter(w ...EventWriter) EventWriter {
@@ -24,3 +26,27 @@ func (w teeWriter) LogEvent(namespace, service, msg string) error {
 	}
 	return nil
 }
+
+// TeeReleaseWriter records image releases with all the writers given,
+// as well as rw, from which they're read.
+func TeeReleaseWriter(rw ImageReleaseReadWriter, w ...ImageReleaseWriter) ImageReleaseReadWriter {
+	return teeReleaseWriter{rw, w}
+}
+
+type teeReleaseWriter struct {
+	ImageReleaseReadWriter
+	others []ImageReleaseWriter
+}
+
+func (w teeReleaseWriter) LogImageReleases(releases []flux.ImageRelease) error {
+	var errs []string
+	for _, w0 := range append([]ImageReleaseWriter{w.ImageReleaseReadWriter}, w.others...) {
+		if err := w0.LogImageReleases(releases); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf(strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package history
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/webhook"
+)
+
+// WebhookPublisher posts what's published to it to the URL given as
+// the topic, signed with the secrets given. With a PublishingWriter,
+// it sends an instance's events to a webhook.
+type WebhookPublisher struct {
+	d       flux.Doer
+	secrets []string
+}
+
+func NewWebhookPublisher(d flux.Doer, secrets []string) *WebhookPublisher {
+	return &WebhookPublisher{d: d, secrets: secrets}
+}
+
+func (p *WebhookPublisher) Publish(url string, data []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "constructing webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := webhook.Sign(req, data, p.secrets, time.Now()); err != nil {
+		return err
+	}
+	resp, err := p.d.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "executing webhook request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+		return fmt.Errorf("%s from webhook (%s)", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/auth"
+)
+
+// Authenticator checks the token given with each request, and that
+// it may be used for the route asked for, and limits how often it's
+// used. The instance a request is for is that of its token, whatever
+// the request says.
+type Authenticator struct {
+	Tokens  auth.Store
+	Limiter *auth.Limiter
+	Logger  log.Logger
+}
+
+type tokenContextKey struct{}
+
+// requestToken gives the token a request was authenticated with, if
+// it was.
+func requestToken(r *http.Request) (auth.Token, bool) {
+	t, ok := r.Context().Value(tokenContextKey{}).(auth.Token)
+	return t, ok
+}
+
+// secretFromHeader gives the token in the Authorization header,
+// given either as flux.Token sets it, or as a bearer token.
+func secretFromHeader(header string) string {
+	for _, prefix := range []string{"Scope-Probe token=", "Bearer "} {
+		if strings.HasPrefix(header, prefix) {
+			return strings.TrimSpace(header[len(prefix):])
+		}
+	}
+	return ""
+}
+
+func (a *Authenticator) authenticating(next http.Handler, scope auth.Scope) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := secretFromHeader(r.Header.Get("Authorization"))
+		if secret == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, "no API token given")
+			return
+		}
+		t, err := a.Tokens.Authenticate(secret)
+		switch {
+		case err == auth.ErrUnauthenticated:
+			a.Logger.Log("url", r.URL.Path, "remote", r.RemoteAddr, "refused", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, err.Error())
+			return
+		case err != nil:
+			a.Logger.Log("err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "checking API token failed")
+			return
+		}
+		if !t.Allows(scope) {
+			a.Logger.Log("instance", t.Instance, "token", t.ID, "url", r.URL.Path, "refused", "scope "+string(scope))
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "token %q does not have the %q scope", t.Name, scope)
+			return
+		}
+		if a.Limiter != nil {
+			if ok, wait := a.Limiter.Allow(t); !ok {
+				a.Logger.Log("instance", t.Instance, "token", t.ID, "url", r.URL.Path, "refused", "rate limit")
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				w.WriteHeader(http.StatusTooManyRequests)
+				fmt.Fprintf(w, "too many requests with token %q", t.Name)
+				return
+			}
+		}
+
+		r.Header.Set(flux.InstanceIDHeaderKey, string(t.Instance))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey{}, t)))
+	})
+}
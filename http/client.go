@@ -2,11 +2,13 @@ package http
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/api"
+	"github.com/weaveworks/flux/auth"
 	"github.com/weaveworks/flux/jobs"
 )
 
@@ -42,6 +44,22 @@ func (c *client) GetRelease(_ flux.InstanceID, id jobs.JobID) (jobs.Job, error)
 	return invokeGetRelease(c.client, c.token, c.router, c.endpoint, id)
 }
 
+func (c *client) GetReleaseLog(_ flux.InstanceID, id jobs.JobID) ([]jobs.LogEntry, error) {
+	return invokeGetReleaseLog(c.client, c.token, c.router, c.endpoint, id)
+}
+
+func (c *client) GetReleasePlan(_ flux.InstanceID, id jobs.JobID, colour bool) (string, error) {
+	return invokeGetReleasePlan(c.client, c.token, c.router, c.endpoint, id, colour)
+}
+
+func (c *client) ListJobs(_ flux.InstanceID, q jobs.JobQuery) (jobs.JobPage, error) {
+	return invokeListJobs(c.client, c.token, c.router, c.endpoint, q)
+}
+
+func (c *client) AbortSelfUpgrade(_ flux.InstanceID, id jobs.JobID) (jobs.JobID, error) {
+	return invokeAbortSelfUpgrade(c.client, c.token, c.router, c.endpoint, id)
+}
+
 func (c *client) Automate(_ flux.InstanceID, id flux.ServiceID) error {
 	return invokeAutomate(c.client, c.token, c.router, c.endpoint, id)
 }
@@ -50,6 +68,10 @@ func (c *client) Deautomate(_ flux.InstanceID, id flux.ServiceID) error {
 	return invokeDeautomate(c.client, c.token, c.router, c.endpoint, id)
 }
 
+func (c *client) ConfirmImage(_ flux.InstanceID, service flux.ServiceID, image flux.ImageID) error {
+	return invokeConfirmImage(c.client, c.token, c.router, c.endpoint, service, image)
+}
+
 func (c *client) Lock(_ flux.InstanceID, id flux.ServiceID) error {
 	return invokeLock(c.client, c.token, c.router, c.endpoint, id)
 }
@@ -62,6 +84,50 @@ func (c *client) History(_ flux.InstanceID, s flux.ServiceSpec) ([]flux.HistoryE
 	return invokeHistory(c.client, c.token, c.router, c.endpoint, s)
 }
 
+func (c *client) ImagesAt(_ flux.InstanceID, s flux.ServiceID, at time.Time) ([]flux.ImageRelease, error) {
+	return invokeImagesAt(c.client, c.token, c.router, c.endpoint, s, at)
+}
+
+func (c *client) Timeline(_ flux.InstanceID, q flux.TimelineQuery) ([]flux.ImageRelease, error) {
+	return invokeTimeline(c.client, c.token, c.router, c.endpoint, q)
+}
+
+func (c *client) DeploymentReport(_ flux.InstanceID, since, until time.Time) (flux.DeploymentReport, error) {
+	return invokeDeploymentReport(c.client, c.token, c.router, c.endpoint, since, until)
+}
+
+func (c *client) UsageReport(_ flux.InstanceID, since, until time.Time) (flux.UsageReport, error) {
+	return invokeUsageReport(c.client, c.token, c.router, c.endpoint, since, until)
+}
+
+func (c *client) UpdatePolicies(_ flux.InstanceID, update flux.PolicyUpdate) ([]flux.PolicyResult, error) {
+	return invokeUpdatePolicies(c.client, c.token, c.router, c.endpoint, update)
+}
+
+func (c *client) RegistryStatus(_ flux.InstanceID) ([]flux.RegistryHostState, error) {
+	return invokeRegistryStatus(c.client, c.token, c.router, c.endpoint)
+}
+
+func (c *client) CheckRegistryCredentials(_ flux.InstanceID) ([]flux.RegistryCredentialCheck, error) {
+	return invokeCheckRegistryCredentials(c.client, c.token, c.router, c.endpoint)
+}
+
+func (c *client) UnmanagedResources(_ flux.InstanceID) ([]flux.UnmanagedResource, error) {
+	return invokeUnmanagedResources(c.client, c.token, c.router, c.endpoint)
+}
+
+func (c *client) ExplainAutomation(_ flux.InstanceID) ([]flux.AutomationCheck, error) {
+	return invokeExplainAutomation(c.client, c.token, c.router, c.endpoint)
+}
+
+func (c *client) Export(_ flux.InstanceID) (flux.DesiredState, error) {
+	return invokeExport(c.client, c.token, c.router, c.endpoint)
+}
+
+func (c *client) DebugBundle(_ flux.InstanceID) (api.DebugBundle, error) {
+	return invokeDebugBundle(c.client, c.token, c.router, c.endpoint)
+}
+
 func (c *client) GetConfig(_ flux.InstanceID) (flux.InstanceConfig, error) {
 	return invokeGetConfig(c.client, c.token, c.router, c.endpoint)
 }
@@ -70,6 +136,30 @@ func (c *client) SetConfig(_ flux.InstanceID, config flux.UnsafeInstanceConfig)
 	return invokeSetConfig(c.client, c.token, c.router, c.endpoint, config)
 }
 
+func (c *client) GetTemplate(_ flux.InstanceID) (api.InstanceTemplate, error) {
+	return invokeGetTemplate(c.client, c.token, c.router, c.endpoint)
+}
+
+func (c *client) ApplyTemplate(_ flux.InstanceID, template api.InstanceTemplate) error {
+	return invokeApplyTemplate(c.client, c.token, c.router, c.endpoint, template)
+}
+
+func (c *client) ListTokens(_ flux.InstanceID) ([]auth.Token, error) {
+	return invokeListTokens(c.client, c.token, c.router, c.endpoint)
+}
+
+func (c *client) CreateToken(_ flux.InstanceID, spec auth.TokenSpec) (api.NewToken, error) {
+	return invokeCreateToken(c.client, c.token, c.router, c.endpoint, spec)
+}
+
+func (c *client) RotateToken(_ flux.InstanceID, id auth.TokenID) (api.NewToken, error) {
+	return invokeRotateToken(c.client, c.token, c.router, c.endpoint, id)
+}
+
+func (c *client) RevokeToken(_ flux.InstanceID, id auth.TokenID) error {
+	return invokeRevokeToken(c.client, c.token, c.router, c.endpoint, id)
+}
+
 func (c *client) Status(_ flux.InstanceID) (flux.Status, error) {
 	return invokeStatus(c.client, c.token, c.router, c.endpoint)
 }
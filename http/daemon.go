@@ -3,6 +3,7 @@ package http
 import (
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -28,6 +29,10 @@ type Daemon struct {
 	quit     chan struct{}
 
 	ws websocket.Websocket
+
+	mu          sync.Mutex
+	connected   bool
+	attemptedAt time.Time
 }
 
 type DaemonMetrics struct {
@@ -49,6 +54,8 @@ func NewDaemon(client *http.Client, t flux.Token, router *mux.Router, endpoint s
 		logger:   logger,
 		metrics:  m,
 		quit:     make(chan struct{}),
+
+		attemptedAt: time.Now(),
 	}
 	go a.loop()
 	return a, nil
@@ -76,6 +83,7 @@ func (a *Daemon) loop() {
 
 func (a *Daemon) connect() error {
 	a.setConnectionDuration(0)
+	a.setConnected(false)
 	a.logger.Log("connecting", true)
 	ws, err := websocket.Dial(a.client, a.token, a.url)
 	if err != nil {
@@ -88,6 +96,8 @@ func (a *Daemon) connect() error {
 		a.logger.Log("connection closing", true, "err", ws.Close())
 	}()
 	a.logger.Log("connected", true)
+	a.setConnected(true)
+	defer a.setConnected(false)
 
 	// Instrument connection lifespan
 	connectedAt := time.Now()
@@ -118,6 +128,38 @@ func (a *Daemon) connect() error {
 	return nil
 }
 
+func (a *Daemon) setConnected(connected bool) {
+	a.mu.Lock()
+	a.connected = connected
+	if !connected {
+		a.attemptedAt = time.Now()
+	}
+	a.mu.Unlock()
+}
+
+// Connected returns an error if the daemon is not connected to the
+// service.
+func (a *Daemon) Connected() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.connected {
+		return errors.Errorf("not connected to %s", a.endpoint)
+	}
+	return nil
+}
+
+// Alive returns an error if the daemon has been trying to connect to
+// the service for longer than allowed, without getting anywhere; i.e.,
+// it's stuck, rather than failing and retrying.
+func (a *Daemon) Alive(allowed time.Duration) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if since := time.Since(a.attemptedAt); !a.connected && since > allowed {
+		return errors.Errorf("connecting to %s for %s", a.endpoint, since)
+	}
+	return nil
+}
+
 func (a *Daemon) setConnectionDuration(duration float64) {
 	a.metrics.ConnectionDuration.With("target", a.endpoint).Set(duration)
 }
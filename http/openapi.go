@@ -0,0 +1,202 @@
+package http
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/weaveworks/flux/api"
+)
+
+// OpenAPI gives an OpenAPI (Swagger 2.0) document describing the API,
+// made from the routes and the types of what they take and give, so
+// that clients can be generated in other languages.
+func OpenAPI() map[string]interface{} {
+	s := &schemas{defs: map[string]interface{}{}}
+	paths := map[string]map[string]interface{}{}
+	for _, route := range routes {
+		item, ok := paths[route.path]
+		if !ok {
+			item = map[string]interface{}{}
+			paths[route.path] = item
+		}
+		for _, method := range route.methods {
+			item[strings.ToLower(method)] = s.operation(route, method)
+		}
+	}
+	return map[string]interface{}{
+		"swagger": "2.0",
+		"info": map[string]interface{}{
+			"title":   "Flux service API",
+			"version": APIVersions[len(APIVersions)-1],
+		},
+		"consumes": []string{"application/json"},
+		"produces": []string{"application/json"},
+		"securityDefinitions": map[string]interface{}{
+			"token": map[string]interface{}{
+				"type":        "apiKey",
+				"in":          "header",
+				"name":        "Authorization",
+				"description": `An API token, as "Bearer <token>" or "Scope-Probe token=<token>"`,
+			},
+		},
+		"security":    []map[string][]string{{"token": {}}},
+		"paths":       paths,
+		"definitions": s.defs,
+	}
+}
+
+func (s *schemas) operation(r route, method string) map[string]interface{} {
+	id := r.name
+	if len(r.methods) > 1 {
+		id += strings.Title(strings.ToLower(method))
+	}
+	var params []map[string]interface{}
+	for _, q := range r.query {
+		param := map[string]interface{}{
+			"name":        q.name,
+			"in":          "query",
+			"required":    q.required,
+			"type":        "string",
+			"description": q.doc,
+		}
+		if q.repeated {
+			param["type"] = "array"
+			param["items"] = map[string]interface{}{"type": "string"}
+			param["collectionFormat"] = "multi"
+		}
+		params = append(params, param)
+	}
+	if r.body != nil {
+		params = append(params, map[string]interface{}{
+			"name":     "body",
+			"in":       "body",
+			"required": true,
+			"schema":   s.of(reflect.TypeOf(r.body)),
+		})
+	}
+	ok := map[string]interface{}{"description": "OK"}
+	if r.response != nil {
+		ok["schema"] = s.of(reflect.TypeOf(r.response))
+	}
+	op := map[string]interface{}{
+		"operationId": id,
+		"summary":     r.summary,
+		"responses": map[string]interface{}{
+			"200":     ok,
+			"default": map[string]interface{}{"description": "Error, as plain text"},
+		},
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	if r.scope != "" {
+		op["description"] = fmt.Sprintf("Needs a token with the %q scope, or one including it.", r.scope)
+	} else {
+		op["security"] = []map[string][]string{}
+	}
+	return op
+}
+
+// schemas makes JSON schemas of types, as they're encoded as JSON,
+// keeping those of named structs as definitions to refer to.
+type schemas struct {
+	defs map[string]interface{}
+}
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+)
+
+func (s *schemas) of(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]interface{}{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return map[string]interface{}{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.of(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name := path.Base(t.PkgPath()) + "." + t.Name()
+		if _, ok := s.defs[name]; !ok {
+			s.defs[name] = map[string]interface{}{} // in case it refers to itself
+			s.defs[name] = s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + name}
+	}
+	// An interface, or something else which could be anything
+	return map[string]interface{}{}
+}
+
+func (s *schemas) object(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	s.fields(t, props)
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+// fields adds the schemas of the struct's fields to props, as they'd
+// be named by encoding/json, including those of embedded structs.
+func (s *schemas) fields(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue // unexported
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			s.fields(ft, props)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = s.of(f.Type)
+	}
+}
+
+func handleOpenAPI(_ api.FluxService) http.Handler {
+	doc := OpenAPI()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(doc)
+	})
+}
@@ -0,0 +1,228 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+)
+
+// Output formats, which may be asked for with the `output` query
+// parameter on the endpoints which list things, or report status. JSON
+// is the default, and is what the client expects. YAML has the same
+// schema as the JSON; tables are for people, and shouldn't be parsed.
+const (
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+	OutputTable = "table"
+)
+
+// writeOutput writes v to the response in the format asked for. If
+// table is nil, a table can't be asked for.
+func writeOutput(w http.ResponseWriter, r *http.Request, v interface{}, table func(io.Writer, interface{})) {
+	var (
+		body        bytes.Buffer
+		contentType string
+		err         error
+	)
+	switch output := r.URL.Query().Get("output"); output {
+	case "", OutputJSON:
+		contentType = "application/json; charset=utf-8"
+		err = json.NewEncoder(&body).Encode(v)
+	case OutputYAML:
+		contentType = "application/x-yaml; charset=utf-8"
+		err = encodeYAML(&body, v)
+	case OutputTable:
+		if table == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "output %q is not available here", output)
+			return
+		}
+		contentType = "text/plain; charset=utf-8"
+		tw := tabwriter.NewWriter(&body, 0, 2, 2, ' ', 0)
+		table(tw, v)
+		err = tw.Flush()
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "unknown output %q; expected %q, %q or %q", output, OutputJSON, OutputYAML, OutputTable)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
+
+// encodeYAML goes via JSON, so that the field names (and omissions)
+// are the same as in the JSON output.
+func encodeYAML(w io.Writer, v interface{}) error {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var generic interface{}
+	if err := yaml.Unmarshal(j, &generic); err != nil {
+		return err
+	}
+	y, err := yaml.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(y)
+	return err
+}
+
+func servicesTable(w io.Writer, v interface{}) {
+	fmt.Fprintf(w, "SERVICE\tCONTAINER\tIMAGE\tRELEASE\tPOLICY\n")
+	for _, s := range v.([]flux.ServiceStatus) {
+		if len(s.Containers) == 0 {
+			fmt.Fprintf(w, "%s\t\t\t\t\n", s.ID)
+			continue
+		}
+		c := s.Containers[0]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.ID, c.Name, c.Current.ID, s.Status, s.Policies())
+		for _, c := range s.Containers[1:] {
+			fmt.Fprintf(w, "\t%s\t%s\t\t\n", c.Name, c.Current.ID)
+		}
+	}
+}
+
+func imagesTable(w io.Writer, v interface{}) {
+	fmt.Fprintf(w, "SERVICE\tCONTAINER\tIMAGE\tCREATED\n")
+	for _, s := range v.([]flux.ImageStatus) {
+		for _, c := range s.Containers {
+			for _, image := range c.Available {
+				running := "  "
+				if image.ID == c.Current.ID {
+					running = "->"
+				}
+				created := ""
+				if image.CreatedAt != nil {
+					created = image.CreatedAt.Format("02 Jan 06 15:04 MST")
+				} else if image.Warning != "" {
+					created = "(" + image.Warning + ")"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s %s\t%s\n", s.ID, c.Name, running, image.ID, created)
+			}
+		}
+	}
+}
+
+func registryCredentialsTable(w io.Writer, v interface{}) {
+	fmt.Fprintf(w, "HOST\tUSERNAME\tSTATUS\n")
+	for _, c := range v.([]flux.RegistryCredentialCheck) {
+		status := "ok"
+		if !c.OK {
+			status = c.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c.Host, c.Username, status)
+	}
+}
+
+func registryStatusTable(w io.Writer, v interface{}) {
+	fmt.Fprintf(w, "HOST\tIN FLIGHT\tQUEUED\tBACKOFF UNTIL\tLAST 429\tQUOTA\n")
+	for _, h := range v.([]flux.RegistryHostState) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\n", h.Host, h.InFlight, h.Queued, formatTime(h.BackoffUntil), formatTime(h.Last429), formatQuota(h.Remaining, h.Limit))
+	}
+}
+
+func unmanagedTable(w io.Writer, v interface{}) {
+	fmt.Fprintf(w, "SERVICE\tREASON\tFILES\tSUGGESTED PATH\n")
+	for _, u := range v.([]flux.UnmanagedResource) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", u.Service, u.Reason, strings.Join(u.Files, ","), u.SuggestedPath)
+	}
+}
+
+func automationTable(w io.Writer, v interface{}) {
+	fmt.Fprintf(w, "SERVICE\tCONTAINER\tCURRENT\tLATEST\tRELEASE\tREASON\tMESSAGE\n")
+	for _, c := range v.([]flux.AutomationCheck) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\t%s\n", c.Service, c.Container, c.Current, c.Latest, c.Release, c.Reason, c.Message)
+	}
+}
+
+func usageTable(w io.Writer, v interface{}) {
+	report := v.(flux.UsageReport)
+	fmt.Fprintf(w, "DAY\tRELEASES\tREGISTRY REQUESTS\tGIT OPERATIONS\tDAEMON MINUTES\n")
+	row := func(day string, d flux.UsageDay) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", day, d.Releases, d.RegistryRequests, d.GitOperations, d.DaemonMinutes)
+	}
+	for _, d := range report.Days {
+		row(d.Day.Format("2006-01-02"), d)
+	}
+	row("TOTAL", report.Total)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatQuota(remaining, limit *int) string {
+	switch {
+	case remaining == nil:
+		return "unknown"
+	case limit == nil:
+		return fmt.Sprintf("%d left", *remaining)
+	default:
+		return fmt.Sprintf("%d of %d left", *remaining, *limit)
+	}
+}
+
+func statusTable(w io.Writer, v interface{}) {
+	status := v.(flux.Status)
+	fmt.Fprintf(w, "COMPONENT\tOK\tDETAIL\n")
+	fmt.Fprintf(w, "fluxd\t%v\t%s\n", status.Fluxd.Connected, status.Fluxd.Version)
+	fmt.Fprintf(w, "git\t%v\t%s\n", status.Git.Configured && status.Git.Error == "", status.Git.Error)
+}
+
+// releaseLogTable shows the log of a release job.
+func releaseLogTable(w io.Writer, v interface{}) {
+	fmt.Fprintf(w, "LEVEL\tMESSAGE\n")
+	for _, entry := range v.([]jobs.LogEntry) {
+		fmt.Fprintf(w, "%s\t%s\n", entry.Level, entry.Message)
+	}
+}
+
+// releaseTable shows a release job, and the actions in its plan, if
+// it has one.
+func releaseTable(w io.Writer, v interface{}) {
+	job := v.(jobs.Job)
+	fmt.Fprintf(w, "ID\t%s\n", job.ID)
+	fmt.Fprintf(w, "STATUS\t%s\n", job.Status)
+	fmt.Fprintf(w, "DONE\t%v\n", job.Done)
+	if job.Done {
+		fmt.Fprintf(w, "SUCCESS\t%v\n", job.Success)
+	}
+	params, ok := job.Params.(jobs.ReleaseJobParams)
+	if !ok || len(params.Plan) == 0 {
+		return
+	}
+	var plan []struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Result      string `json:"result"`
+	}
+	if err := json.Unmarshal(params.Plan, &plan); err != nil {
+		fmt.Fprintf(w, "PLAN\t(unreadable: %s)\n", err)
+		return
+	}
+	fmt.Fprintf(w, "\nACTION\tDESCRIPTION\tRESULT\n")
+	for _, action := range plan {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", action.Name, action.Description, action.Result)
+	}
+}
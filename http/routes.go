@@ -0,0 +1,177 @@
+package http
+
+import (
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api"
+	"github.com/weaveworks/flux/auth"
+	"github.com/weaveworks/flux/jobs"
+)
+
+// route describes a route of the API: how requests are matched to it,
+// and what they give and get back. The router is made from these, and
+// so is the OpenAPI document, so the two can't disagree.
+type route struct {
+	name    string
+	methods []string
+	path    string
+	summary string
+	// scope is what a token must allow to be used for the route,
+	// when requests are authenticated; empty if anyone may use it.
+	scope auth.Scope
+	query []queryParam
+	// body and response are values of the types of the request and
+	// response bodies, encoded as JSON; nil if there is none.
+	body     interface{}
+	response interface{}
+}
+
+// queryParam is a parameter given in the query. Those required are
+// matched by the router, so requests without them aren't routed
+// there at all; they may still be given as empty.
+type queryParam struct {
+	name     string
+	required bool
+	repeated bool
+	doc      string
+}
+
+func required(name, doc string) queryParam { return queryParam{name: name, required: true, doc: doc} }
+func optional(name, doc string) queryParam { return queryParam{name: name, doc: doc} }
+
+const (
+	serviceDoc     = `Service ID, as "namespace/name"`
+	serviceSpecDoc = `Service ID, or "<all>"`
+	releaseIDDoc   = "ID of the release job"
+	imageDoc       = `Image, as "repository:tag"`
+	timeDoc        = "Time, in RFC3339 format"
+	tokenIDDoc     = "ID of the API token"
+)
+
+var routes = []route{
+	{name: "ListServices", methods: get, path: "/v3/services", summary: "List services, in the namespace given or all of them", scope: auth.ScopeRead,
+		query:    []queryParam{required("namespace", "Namespace; empty means all of them")},
+		response: []flux.ServiceStatus{}},
+	{name: "ListImages", methods: get, path: "/v3/images", summary: "List the images available for services' containers", scope: auth.ScopeRead,
+		query:    []queryParam{required("service", serviceSpecDoc)},
+		response: []flux.ImageStatus{}},
+	{name: "PostRelease", methods: post, path: "/v4/release", summary: "Submit a release; other parameters can be given in the body", scope: auth.ScopeRelease,
+		query: []queryParam{
+			required("service", serviceSpecDoc),
+			required("image", `Image, or "<all latest>" or "<no updates>"`),
+			required("kind", `"plan" or "execute"`),
+			{name: "exclude", repeated: true, doc: "Service ID to leave out"},
+			optional("user", "Who is releasing; ignored if the request is authenticated, when it is the token's name"),
+		},
+		body:     postReleaseRequest{},
+		response: postReleaseResponse{}},
+	{name: "GetRelease", methods: get, path: "/v4/release", summary: "Get a release job, with the latest entries of its log", scope: auth.ScopeRead,
+		query:    []queryParam{required("id", releaseIDDoc)},
+		response: jobs.Job{}},
+	{name: "GetReleaseLog", methods: get, path: "/v4/release/log", summary: "Get the whole log of a release job", scope: auth.ScopeRead,
+		query:    []queryParam{required("id", releaseIDDoc)},
+		response: []jobs.LogEntry{}},
+	{name: "GetReleasePlan", methods: get, path: "/v4/release/plan", summary: "Get the plan of a dry-run release as text/plain, summarised for a terminal like `terraform plan`", scope: auth.ScopeRead,
+		query: []queryParam{
+			required("id", releaseIDDoc),
+			optional("color", `"true" to colour the plan with ANSI escapes`),
+		}},
+	{name: "ListJobs", methods: get, path: "/v4/jobs", summary: "List jobs, most recently submitted first, a page at a time", scope: auth.ScopeRead,
+		query: []queryParam{
+			optional("method", `Kind of job, e.g., "release"`),
+			optional("state", `"queued", "running", "succeeded", "failed" or "done"`),
+			optional("service", "Service ID, for releases including it"),
+			optional("user", "Who submitted the releases"),
+			optional("since", timeDoc),
+			optional("until", timeDoc),
+			optional("cursor", "Where to carry on from, as given by the previous page"),
+			optional("limit", "How many jobs to list"),
+		},
+		response: jobs.JobPage{}},
+	{name: "AbortSelfUpgrade", methods: post, path: "/v4/release/abort-self-upgrade", summary: "Abandon a self-upgrade, rolling back the config repo", scope: auth.ScopeRelease,
+		query:    []queryParam{required("id", releaseIDDoc)},
+		response: postReleaseResponse{}},
+	{name: "Automate", methods: post, path: "/v3/automate", summary: "Automate a service", scope: auth.ScopeRelease,
+		query: []queryParam{required("service", serviceDoc)}},
+	{name: "Deautomate", methods: post, path: "/v3/deautomate", summary: "Stop automating a service", scope: auth.ScopeRelease,
+		query: []queryParam{required("service", serviceDoc)}},
+	{name: "ConfirmImage", methods: post, path: "/v4/images/confirm", summary: "Confirm an image suspect for a service, so it may be released as the latest again", scope: auth.ScopeRelease,
+		query: []queryParam{required("service", serviceDoc), required("image", imageDoc)}},
+	{name: "Lock", methods: post, path: "/v3/lock", summary: "Lock a service, so it isn't released", scope: auth.ScopeRelease,
+		query: []queryParam{required("service", serviceDoc)}},
+	{name: "Unlock", methods: post, path: "/v3/unlock", summary: "Unlock a service", scope: auth.ScopeRelease,
+		query: []queryParam{required("service", serviceDoc)}},
+	{name: "UpdatePolicies", methods: post, path: "/v4/policies", summary: "Add and remove policies for services", scope: auth.ScopeRelease,
+		body:     flux.PolicyUpdate{},
+		response: []flux.PolicyResult{}},
+	{name: "History", methods: get, path: "/v3/history", summary: "Get the history of events for services", scope: auth.ScopeRead,
+		query:    []queryParam{required("service", serviceSpecDoc)},
+		response: []flux.HistoryEntry{}},
+	{name: "Timeline", methods: get, path: "/v4/timeline", summary: "Get the images released, most recent first", scope: auth.ScopeRead,
+		query: []queryParam{
+			optional("service", serviceDoc),
+			optional("branch", "Config repo branch"),
+			optional("since", timeDoc),
+			optional("until", timeDoc),
+		},
+		response: []flux.ImageRelease{}},
+	{name: "DeploymentReport", methods: get, path: "/v4/report/deployments", summary: "Report deployment frequency, lead time and failure rate", scope: auth.ScopeRead,
+		query: []queryParam{
+			optional("since", timeDoc),
+			optional("until", timeDoc),
+		},
+		response: flux.DeploymentReport{}},
+	{name: "UsageReport", methods: get, path: "/v4/report/usage", summary: "Report what the instance used of the service each day: releases, registry requests, git operations and daemon-connected minutes", scope: auth.ScopeRead,
+		query: []queryParam{
+			optional("since", timeDoc),
+			optional("until", timeDoc),
+		},
+		response: flux.UsageReport{}},
+	{name: "ImagesAt", methods: get, path: "/v4/history/images", summary: "Get the images a service was running at a time", scope: auth.ScopeRead,
+		query: []queryParam{
+			required("service", serviceDoc),
+			required("at", timeDoc),
+		},
+		response: []flux.ImageRelease{}},
+	{name: "Status", methods: get, path: "/v3/status", summary: "Get the status of the instance", scope: auth.ScopeRead,
+		response: flux.Status{}},
+	{name: "GetConfig", methods: get, path: "/v4/config", summary: "Get the instance's config, with secrets hidden", scope: auth.ScopeAdmin,
+		response: flux.InstanceConfig{}},
+	{name: "SetConfig", methods: post, path: "/v4/config", summary: "Set the instance's config", scope: auth.ScopeAdmin,
+		body: flux.UnsafeInstanceConfig{}},
+	{name: "GetTemplate", methods: get, path: "/v4/template", summary: "Get the instance's config, less secrets, as a template", scope: auth.ScopeAdmin,
+		response: api.InstanceTemplate{}},
+	{name: "ApplyTemplate", methods: post, path: "/v4/template", summary: "Set up a new instance from a template", scope: auth.ScopeAdmin,
+		body: api.InstanceTemplate{}},
+	{name: "ListTokens", methods: get, path: "/v4/tokens", summary: "List the instance's API tokens", scope: auth.ScopeAdmin,
+		response: []auth.Token{}},
+	{name: "CreateToken", methods: post, path: "/v4/tokens", summary: "Create an API token; its secret is only given now", scope: auth.ScopeAdmin,
+		body:     auth.TokenSpec{},
+		response: api.NewToken{}},
+	{name: "RotateToken", methods: post, path: "/v4/tokens/rotate", summary: "Give an API token a new secret, so the old one isn't accepted", scope: auth.ScopeAdmin,
+		query:    []queryParam{required("id", tokenIDDoc)},
+		response: api.NewToken{}},
+	{name: "RevokeToken", methods: post, path: "/v4/tokens/revoke", summary: "Revoke an API token, so it isn't accepted", scope: auth.ScopeAdmin,
+		query: []queryParam{required("id", tokenIDDoc)}},
+	{name: "DebugBundle", methods: get, path: "/v4/debug", summary: "Get what the service knows about the instance, for support", scope: auth.ScopeAdmin,
+		response: api.DebugBundle{}},
+	{name: "RegistryStatus", methods: get, path: "/v4/registry/status", summary: "Get the state of each image registry host", scope: auth.ScopeRead,
+		response: []flux.RegistryHostState{}},
+	{name: "CheckRegistryCredentials", methods: get, path: "/v4/registry/credentials", summary: "Check the registry credentials in the config", scope: auth.ScopeAdmin,
+		response: []flux.RegistryCredentialCheck{}},
+	{name: "UnmanagedResources", methods: get, path: "/v4/unmanaged", summary: "List services running but not defined in the config repo, or defined but not running", scope: auth.ScopeRead,
+		response: []flux.UnmanagedResource{}},
+	{name: "ExplainAutomation", methods: get, path: "/v4/automation/explain", summary: "Say what automation would release if it ran now, and why it wouldn't release the rest, without releasing anything", scope: auth.ScopeRead,
+		response: []flux.AutomationCheck{}},
+	{name: "Export", methods: get, path: "/v4/export", summary: "Get the services defined in the config repo, with their images, policies and files, for backup or reconciliation", scope: auth.ScopeRead,
+		response: flux.DesiredState{}},
+	{name: "RegisterDaemon", methods: get, path: "/v4/daemon", summary: "Connect a daemon, by websocket", scope: auth.ScopeDaemon},
+	{name: "IsConnected", methods: []string{"HEAD", "GET"}, path: "/v4/ping", summary: "Check whether the daemon is connected", scope: auth.ScopeRead},
+	{name: "APIVersions", methods: get, path: "/api/versions", summary: "List the versions of the API served",
+		response: []string{}},
+	{name: "OpenAPI", methods: get, path: "/api/openapi.json", summary: "Get this document"},
+}
+
+var (
+	get  = []string{"GET"}
+	post = []string{"POST"}
+)
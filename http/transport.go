@@ -21,51 +21,87 @@ import (
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/api"
+	"github.com/weaveworks/flux/auth"
 	"github.com/weaveworks/flux/http/websocket"
+	"github.com/weaveworks/flux/instance"
 	"github.com/weaveworks/flux/jobs"
 	"github.com/weaveworks/flux/platform"
 	"github.com/weaveworks/flux/platform/rpc"
+	"github.com/weaveworks/flux/release"
 )
 
 func NewRouter() *mux.Router {
 	r := mux.NewRouter()
-	r.NewRoute().Name("ListServices").Methods("GET").Path("/v3/services").Queries("namespace", "{namespace}") // optional namespace!
-	r.NewRoute().Name("ListImages").Methods("GET").Path("/v3/images").Queries("service", "{service}")
-	r.NewRoute().Name("PostRelease").Methods("POST").Path("/v4/release").Queries("service", "{service}", "image", "{image}", "kind", "{kind}")
-	r.NewRoute().Name("GetRelease").Methods("GET").Path("/v4/release").Queries("id", "{id}")
-	r.NewRoute().Name("Automate").Methods("POST").Path("/v3/automate").Queries("service", "{service}")
-	r.NewRoute().Name("Deautomate").Methods("POST").Path("/v3/deautomate").Queries("service", "{service}")
-	r.NewRoute().Name("Lock").Methods("POST").Path("/v3/lock").Queries("service", "{service}")
-	r.NewRoute().Name("Unlock").Methods("POST").Path("/v3/unlock").Queries("service", "{service}")
-	r.NewRoute().Name("History").Methods("GET").Path("/v3/history").Queries("service", "{service}")
-	r.NewRoute().Name("Status").Methods("GET").Path("/v3/status")
-	r.NewRoute().Name("GetConfig").Methods("GET").Path("/v4/config")
-	r.NewRoute().Name("SetConfig").Methods("POST").Path("/v4/config")
-	r.NewRoute().Name("RegisterDaemon").Methods("GET").Path("/v4/daemon")
-	r.NewRoute().Name("IsConnected").Methods("HEAD", "GET").Path("/v4/ping")
+	for _, route := range routes {
+		var queries []string
+		for _, q := range route.query {
+			if q.required {
+				queries = append(queries, q.name, "{"+q.name+"}")
+			}
+		}
+		rt := r.NewRoute().Name(route.name).Methods(route.methods...).Path(route.path)
+		if len(queries) > 0 {
+			rt.Queries(queries...)
+		}
+	}
 	return r
 }
 
-func NewHandler(s api.FluxService, r *mux.Router, logger log.Logger, h metrics.Histogram) http.Handler {
+// NewHandler serves the API. If an authenticator is given, requests
+// must come with a token allowing what they ask for; otherwise, they
+// are taken to have been authenticated already (e.g., by a proxy
+// which sets the instance ID header).
+func NewHandler(s api.FluxService, r *mux.Router, a *Authenticator, logger log.Logger, h metrics.Histogram) http.Handler {
+	scopes := map[string]auth.Scope{}
+	for _, route := range routes {
+		scopes[route.name] = route.scope
+	}
 	for method, handlerFunc := range map[string]func(api.FluxService) http.Handler{
-		"ListServices":   handleListServices,
-		"ListImages":     handleListImages,
-		"PostRelease":    handlePostRelease,
-		"GetRelease":     handleGetRelease,
-		"Automate":       handleAutomate,
-		"Deautomate":     handleDeautomate,
-		"Lock":           handleLock,
-		"Unlock":         handleUnlock,
-		"History":        handleHistory,
-		"Status":         handleStatus,
-		"GetConfig":      handleGetConfig,
-		"SetConfig":      handleSetConfig,
-		"RegisterDaemon": handleRegister,
-		"IsConnected":    handleIsConnected,
+		"ListServices":             handleListServices,
+		"ListImages":               handleListImages,
+		"PostRelease":              handlePostRelease,
+		"GetRelease":               handleGetRelease,
+		"GetReleaseLog":            handleGetReleaseLog,
+		"GetReleasePlan":           handleGetReleasePlan,
+		"ListJobs":                 handleListJobs,
+		"AbortSelfUpgrade":         handleAbortSelfUpgrade,
+		"Automate":                 handleAutomate,
+		"ConfirmImage":             handleConfirmImage,
+		"Deautomate":               handleDeautomate,
+		"Lock":                     handleLock,
+		"Unlock":                   handleUnlock,
+		"UpdatePolicies":           handleUpdatePolicies,
+		"History":                  handleHistory,
+		"ImagesAt":                 handleImagesAt,
+		"Timeline":                 handleTimeline,
+		"DeploymentReport":         handleDeploymentReport,
+		"UsageReport":              handleUsageReport,
+		"Status":                   handleStatus,
+		"GetConfig":                handleGetConfig,
+		"SetConfig":                handleSetConfig,
+		"GetTemplate":              handleGetTemplate,
+		"ApplyTemplate":            handleApplyTemplate,
+		"ListTokens":               handleListTokens,
+		"CreateToken":              handleCreateToken,
+		"RotateToken":              handleRotateToken,
+		"RevokeToken":              handleRevokeToken,
+		"DebugBundle":              handleDebugBundle,
+		"RegistryStatus":           handleRegistryStatus,
+		"CheckRegistryCredentials": handleCheckRegistryCredentials,
+		"UnmanagedResources":       handleUnmanagedResources,
+		"ExplainAutomation":        handleExplainAutomation,
+		"Export":                   handleExport,
+		"RegisterDaemon":           handleRegister,
+		"IsConnected":              handleIsConnected,
+		"APIVersions":              handleAPIVersions,
+		"OpenAPI":                  handleOpenAPI,
 	} {
 		var handler http.Handler
 		handler = handlerFunc(s)
 		handler = logging(handler, log.NewContext(logger).With("method", method))
+		if a != nil && scopes[method] != "" {
+			handler = a.authenticating(handler, scopes[method])
+		}
 		handler = observing(handler, h.With("method", method))
 
 		r.Get(method).Handler(handler)
@@ -95,6 +131,12 @@ func (err *APIError) IsUnavailable() bool {
 	return false
 }
 
+// Does this error mean the request was made against a version of
+// something (e.g., the instance config) that's since changed?
+func (err *APIError) IsConflict() bool {
+	return err.StatusCode == http.StatusConflict
+}
+
 // Is this API call missing? This usually indicates that there is a
 // version mismatch between the client and the service.
 func (err *APIError) IsMissing() bool {
@@ -114,13 +156,7 @@ func handleListServices(s api.FluxService) http.Handler {
 			fmt.Fprintf(w, err.Error())
 			return
 		}
-
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		if err := json.NewEncoder(w).Encode(res); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, err.Error())
-			return
-		}
+		writeOutput(w, r, res, servicesTable)
 	})
 }
 
@@ -164,13 +200,7 @@ func handleListImages(s api.FluxService) http.Handler {
 			fmt.Fprintf(w, err.Error())
 			return
 		}
-
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		if err := json.NewEncoder(w).Encode(d); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, err.Error())
-			return
-		}
+		writeOutput(w, r, d, imagesTable)
 	})
 }
 
@@ -198,6 +228,25 @@ func invokeListImages(client *http.Client, t flux.Token, router *mux.Router, end
 	return res, nil
 }
 
+// postReleaseRequest is what a client may ask for in the body of a
+// release, besides what's given in the query. The other release
+// parameters are flux's own bookkeeping, so aren't taken from
+// requests.
+type postReleaseRequest struct {
+	ServiceSpecs     []flux.ServiceSpec
+	ContainerTargets []jobs.ContainerTarget
+	Restart          bool
+	MigrateImages    *flux.ImageMigration
+	RefuseOnDrift    bool
+	ApplyResources   bool
+	PruneSelector    string
+	ServerDryRun     bool
+	WaitForRollout   bool
+	RolloutTimeout   string
+	PlanJob          jobs.JobID
+	Snapshot         *platform.Snapshot
+}
+
 type postReleaseResponse struct {
 	Status    string     `json:"status"`
 	ReleaseID jobs.JobID `json:"release_id"`
@@ -218,7 +267,12 @@ func handlePostRelease(s api.FluxService) http.Handler {
 			fmt.Fprintf(w, errors.Wrapf(err, "parsing service spec %q", service).Error())
 			return
 		}
-		imageSpec := flux.ParseImageSpec(image)
+		imageSpec, err := flux.ParseImageSpec(image)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, errors.Wrapf(err, "parsing image spec %q", image).Error())
+			return
+		}
 		releaseKind, err := flux.ParseReleaseKind(kind)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
@@ -237,12 +291,43 @@ func handlePostRelease(s api.FluxService) http.Handler {
 			excludes = append(excludes, s)
 		}
 
-		id, err := s.PostRelease(inst, jobs.ReleaseJobParams{
-			ServiceSpec: serviceSpec,
-			ImageSpec:   imageSpec,
-			Kind:        releaseKind,
-			Excludes:    excludes,
-		})
+		// Newer clients send all the parameters in the body; those in
+		// the query take precedence, for older clients.
+		var req postReleaseRequest
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, errors.Wrap(err, "decoding release parameters").Error())
+				return
+			}
+		}
+		params := jobs.ReleaseJobParams{
+			ServiceSpec:      serviceSpec,
+			ServiceSpecs:     req.ServiceSpecs,
+			ImageSpec:        imageSpec,
+			Kind:             releaseKind,
+			Excludes:         excludes,
+			ContainerTargets: req.ContainerTargets,
+			Restart:          req.Restart,
+			MigrateImages:    req.MigrateImages,
+			RefuseOnDrift:    req.RefuseOnDrift,
+			ApplyResources:   req.ApplyResources,
+			PruneSelector:    req.PruneSelector,
+			ServerDryRun:     req.ServerDryRun,
+			WaitForRollout:   req.WaitForRollout,
+			RolloutTimeout:   req.RolloutTimeout,
+			PlanJob:          req.PlanJob,
+			Snapshot:         req.Snapshot,
+		}
+		// Who asked is whoever the token's for, if the request was
+		// authenticated; otherwise it's taken on trust.
+		if t, ok := requestToken(r); ok {
+			params.User = t.Name
+		} else {
+			params.User = r.URL.Query().Get("user")
+		}
+
+		id, err := s.PostRelease(inst, params)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(w, err.Error())
@@ -266,16 +351,24 @@ func invokePostRelease(client *http.Client, t flux.Token, router *mux.Router, en
 	for _, ex := range s.Excludes {
 		args = append(args, "exclude", string(ex))
 	}
+	if s.User != "" {
+		args = append(args, "user", s.User)
+	}
 
 	u, err := makeURL(endpoint, router, "PostRelease", args...)
 	if err != nil {
 		return "", errors.Wrap(err, "constructing URL")
 	}
 
-	req, err := http.NewRequest("POST", u.String(), nil)
+	body, err := json.Marshal(s)
+	if err != nil {
+		return "", errors.Wrap(err, "marshaling release parameters")
+	}
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(body))
 	if err != nil {
 		return "", errors.Wrapf(err, "constructing request %s", u)
 	}
+	req.Header.Set("Content-Type", "application/json")
 	t.Set(req)
 
 	resp, err := executeRequest(client, req)
@@ -300,13 +393,7 @@ func handleGetRelease(s api.FluxService) http.Handler {
 			fmt.Fprintf(w, err.Error())
 			return
 		}
-
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		if err := json.NewEncoder(w).Encode(job); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, err.Error())
-			return
-		}
+		writeOutput(w, r, job, releaseTable)
 	})
 }
 
@@ -334,6 +421,137 @@ func invokeGetRelease(client *http.Client, t flux.Token, router *mux.Router, end
 	return res, nil
 }
 
+func handleGetReleaseLog(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		id := mux.Vars(r)["id"]
+		log, err := s.GetReleaseLog(inst, jobs.JobID(id))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+		writeOutput(w, r, log, releaseLogTable)
+	})
+}
+
+func invokeGetReleaseLog(client *http.Client, t flux.Token, router *mux.Router, endpoint string, id jobs.JobID) ([]jobs.LogEntry, error) {
+	u, err := makeURL(endpoint, router, "GetReleaseLog", "id", string(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "executing HTTP request")
+	}
+
+	var res []jobs.LogEntry
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, errors.Wrap(err, "decoding response from server")
+	}
+	return res, nil
+}
+
+func handleGetReleasePlan(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		id := mux.Vars(r)["id"]
+		plan, err := s.GetReleasePlan(inst, jobs.JobID(id), r.URL.Query().Get("color") == "true")
+		switch err {
+		case nil:
+		case release.ErrNoPlan:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, err.Error())
+			return
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(plan))
+	})
+}
+
+func invokeGetReleasePlan(client *http.Client, t flux.Token, router *mux.Router, endpoint string, id jobs.JobID, colour bool) (string, error) {
+	u, err := makeURL(endpoint, router, "GetReleasePlan", "id", string(id), "color", fmt.Sprint(colour))
+	if err != nil {
+		return "", errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return "", errors.Wrap(err, "executing HTTP request")
+	}
+
+	plan, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "reading response from server")
+	}
+	return string(plan), nil
+}
+
+func handleAbortSelfUpgrade(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		id := mux.Vars(r)["id"]
+		rollback, err := s.AbortSelfUpgrade(inst, jobs.JobID(id))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(postReleaseResponse{
+			Status:    "Rollback queued.",
+			ReleaseID: rollback,
+		}); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+	})
+}
+
+func invokeAbortSelfUpgrade(client *http.Client, t flux.Token, router *mux.Router, endpoint string, id jobs.JobID) (jobs.JobID, error) {
+	u, err := makeURL(endpoint, router, "AbortSelfUpgrade", "id", string(id))
+	if err != nil {
+		return "", errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return "", errors.Wrap(err, "executing HTTP request")
+	}
+
+	var res postReleaseResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", errors.Wrap(err, "decoding response from server")
+	}
+	return res.ReleaseID, nil
+}
+
 func handleAutomate(s api.FluxService) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		inst := getInstanceID(r)
@@ -374,6 +592,57 @@ func invokeAutomate(client *http.Client, t flux.Token, router *mux.Router, endpo
 	return nil
 }
 
+func handleConfirmImage(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		service, err := flux.ParseServiceID(mux.Vars(r)["service"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, errors.Wrapf(err, "parsing service ID %q", mux.Vars(r)["service"]).Error())
+			return
+		}
+		image, err := flux.ParseImageID(mux.Vars(r)["image"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, errors.Wrapf(err, "parsing image %q", mux.Vars(r)["image"]).Error())
+			return
+		}
+
+		switch err = s.ConfirmImage(inst, service, image); err {
+		case nil:
+		case release.ErrNotSuspect:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, err.Error())
+			return
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func invokeConfirmImage(client *http.Client, t flux.Token, router *mux.Router, endpoint string, service flux.ServiceID, image flux.ImageID) error {
+	u, err := makeURL(endpoint, router, "ConfirmImage", "service", string(service), "image", image.String())
+	if err != nil {
+		return errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	if _, err = executeRequest(client, req); err != nil {
+		return errors.Wrap(err, "executing HTTP request")
+	}
+
+	return nil
+}
+
 func handleDeautomate(s api.FluxService) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		inst := getInstanceID(r)
@@ -546,81 +815,763 @@ func invokeHistory(client *http.Client, t flux.Token, router *mux.Router, endpoi
 	return res, nil
 }
 
-func handleGetConfig(s api.FluxService) http.Handler {
+func handleImagesAt(s api.FluxService) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		inst := getInstanceID(r)
-		config, err := s.GetConfig(inst)
+		service := mux.Vars(r)["service"]
+		id, err := flux.ParseServiceID(service)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, errors.Wrapf(err, "parsing service ID %q", service).Error())
+			return
+		}
+		atStr := mux.Vars(r)["at"]
+		at, err := time.Parse(time.RFC3339, atStr)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, errors.Wrapf(err, "parsing time %q", atStr).Error())
+			return
+		}
+
+		res, err := s.ImagesAt(inst, id, at)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(w, err.Error())
 			return
 		}
 
-		configBytes := bytes.Buffer{}
-		if err = json.NewEncoder(&configBytes).Encode(config); err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(w, err.Error())
 			return
 		}
-
-		w.WriteHeader(http.StatusOK)
-		w.Write(configBytes.Bytes())
-		return
 	})
 }
 
-func invokeGetConfig(client *http.Client, t flux.Token, router *mux.Router, endpoint string) (flux.InstanceConfig, error) {
-	u, err := makeURL(endpoint, router, "GetConfig")
+func invokeImagesAt(client *http.Client, t flux.Token, router *mux.Router, endpoint string, service flux.ServiceID, at time.Time) ([]flux.ImageRelease, error) {
+	u, err := makeURL(endpoint, router, "ImagesAt", "service", string(service), "at", at.Format(time.RFC3339))
 	if err != nil {
-		return flux.InstanceConfig{}, errors.Wrap(err, "constructing URL")
+		return nil, errors.Wrap(err, "constructing URL")
 	}
 
 	req, err := http.NewRequest("GET", u.String(), nil)
 	if err != nil {
-		return flux.InstanceConfig{}, errors.Wrapf(err, "constructing request %s", u)
+		return nil, errors.Wrapf(err, "constructing request %s", u)
 	}
 	t.Set(req)
 
 	resp, err := executeRequest(client, req)
 	if err != nil {
-		return flux.InstanceConfig{}, errors.Wrap(err, "executing HTTP request")
+		return nil, errors.Wrap(err, "executing HTTP request")
 	}
 
-	var res flux.InstanceConfig
+	var res []flux.ImageRelease
 	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return res, errors.Wrap(err, "decoding response body")
+		return nil, errors.Wrap(err, "decoding response from server")
 	}
+
 	return res, nil
 }
 
-func handleSetConfig(s api.FluxService) http.Handler {
+func handleTimeline(s api.FluxService) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		inst := getInstanceID(r)
+		v := r.URL.Query()
+		var q flux.TimelineQuery
+		if service := v.Get("service"); service != "" {
+			id, err := flux.ParseServiceID(service)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, errors.Wrapf(err, "parsing service ID %q", service).Error())
+				return
+			}
+			q.Service = id
+		}
+		q.Branch = v.Get("branch")
+		for _, t := range []struct {
+			param string
+			dest  *time.Time
+		}{
+			{"since", &q.Since},
+			{"until", &q.Until},
+		} {
+			str := v.Get(t.param)
+			if str == "" {
+				continue
+			}
+			parsed, err := time.Parse(time.RFC3339, str)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, errors.Wrapf(err, "parsing %s time %q", t.param, str).Error())
+				return
+			}
+			*t.dest = parsed
+		}
 
-		var config flux.UnsafeInstanceConfig
-		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+		res, err := s.Timeline(inst, q)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(w, err.Error())
 			return
 		}
 
-		if err := s.SetConfig(inst, config); err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(w, err.Error())
 			return
 		}
-
-		w.WriteHeader(http.StatusOK)
-		return
-
 	})
 }
 
-func invokeSetConfig(client *http.Client, t flux.Token, router *mux.Router, endpoint string, updates flux.UnsafeInstanceConfig) error {
-	u, err := makeURL(endpoint, router, "SetConfig")
-	if err != nil {
-		return errors.Wrap(err, "constructing URL")
-	}
+func handleListJobs(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		v := r.URL.Query()
+		q := jobs.JobQuery{
+			Method: v.Get("method"),
+			State:  v.Get("state"),
+			User:   v.Get("user"),
+			Cursor: v.Get("cursor"),
+		}
+		if service := v.Get("service"); service != "" {
+			id, err := flux.ParseServiceID(service)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, errors.Wrapf(err, "parsing service ID %q", service).Error())
+				return
+			}
+			q.Service = id
+		}
+		for _, t := range []struct {
+			param string
+			dest  *time.Time
+		}{
+			{"since", &q.Since},
+			{"until", &q.Until},
+		} {
+			str := v.Get(t.param)
+			if str == "" {
+				continue
+			}
+			parsed, err := time.Parse(time.RFC3339, str)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, errors.Wrapf(err, "parsing %s time %q", t.param, str).Error())
+				return
+			}
+			*t.dest = parsed
+		}
+		if str := v.Get("limit"); str != "" {
+			limit, err := strconv.Atoi(str)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, errors.Wrapf(err, "parsing limit %q", str).Error())
+				return
+			}
+			q.Limit = limit
+		}
+		if err := q.Validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		res, err := s.ListJobs(inst, q)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+	})
+}
+
+func invokeListJobs(client *http.Client, t flux.Token, router *mux.Router, endpoint string, q jobs.JobQuery) (jobs.JobPage, error) {
+	var params []string
+	for _, p := range []struct{ name, value string }{
+		{"method", q.Method},
+		{"state", q.State},
+		{"service", string(q.Service)},
+		{"user", q.User},
+		{"cursor", q.Cursor},
+	} {
+		if p.value != "" {
+			params = append(params, p.name, p.value)
+		}
+	}
+	if !q.Since.IsZero() {
+		params = append(params, "since", q.Since.Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		params = append(params, "until", q.Until.Format(time.RFC3339))
+	}
+	if q.Limit != 0 {
+		params = append(params, "limit", strconv.Itoa(q.Limit))
+	}
+	u, err := makeURL(endpoint, router, "ListJobs", params...)
+	if err != nil {
+		return jobs.JobPage{}, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return jobs.JobPage{}, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return jobs.JobPage{}, errors.Wrap(err, "executing HTTP request")
+	}
+
+	var res jobs.JobPage
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return jobs.JobPage{}, errors.Wrap(err, "decoding response from server")
+	}
+	return res, nil
+}
+
+func invokeTimeline(client *http.Client, t flux.Token, router *mux.Router, endpoint string, q flux.TimelineQuery) ([]flux.ImageRelease, error) {
+	var params []string
+	if q.Service != "" {
+		params = append(params, "service", string(q.Service))
+	}
+	if q.Branch != "" {
+		params = append(params, "branch", q.Branch)
+	}
+	if !q.Since.IsZero() {
+		params = append(params, "since", q.Since.Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		params = append(params, "until", q.Until.Format(time.RFC3339))
+	}
+	u, err := makeURL(endpoint, router, "Timeline", params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "executing HTTP request")
+	}
+
+	var res []flux.ImageRelease
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, errors.Wrap(err, "decoding response from server")
+	}
+
+	return res, nil
+}
+
+// By default, reports cover this long up to now.
+const defaultReportPeriod = 30 * 24 * time.Hour
+
+// reportPeriod gives the period a report is asked for, from the since
+// and until query parameters, defaulting to defaultReportPeriod up to
+// now.
+func reportPeriod(r *http.Request) (since, until time.Time, err error) {
+	v := r.URL.Query()
+	until = time.Now().UTC()
+	if str := v.Get("until"); str != "" {
+		if until, err = time.Parse(time.RFC3339, str); err != nil {
+			return since, until, errors.Wrapf(err, "parsing until time %q", str)
+		}
+	}
+	since = until.Add(-defaultReportPeriod)
+	if str := v.Get("since"); str != "" {
+		if since, err = time.Parse(time.RFC3339, str); err != nil {
+			return since, until, errors.Wrapf(err, "parsing since time %q", str)
+		}
+	}
+	return since, until, nil
+}
+
+func handleDeploymentReport(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		since, until, err := reportPeriod(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		res, err := s.DeploymentReport(inst, since, until)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+	})
+}
+
+func invokeDeploymentReport(client *http.Client, t flux.Token, router *mux.Router, endpoint string, since, until time.Time) (flux.DeploymentReport, error) {
+	var res flux.DeploymentReport
+	u, err := makeURL(endpoint, router, "DeploymentReport", "since", since.Format(time.RFC3339), "until", until.Format(time.RFC3339))
+	if err != nil {
+		return res, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return res, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return res, errors.Wrap(err, "executing HTTP request")
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return res, errors.Wrap(err, "decoding response from server")
+	}
+
+	return res, nil
+}
+
+func handleUsageReport(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		since, until, err := reportPeriod(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		res, err := s.UsageReport(inst, since, until)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+		writeOutput(w, r, res, usageTable)
+	})
+}
+
+func invokeUsageReport(client *http.Client, t flux.Token, router *mux.Router, endpoint string, since, until time.Time) (flux.UsageReport, error) {
+	var res flux.UsageReport
+	u, err := makeURL(endpoint, router, "UsageReport", "since", since.Format(time.RFC3339), "until", until.Format(time.RFC3339))
+	if err != nil {
+		return res, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return res, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return res, errors.Wrap(err, "executing HTTP request")
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return res, errors.Wrap(err, "decoding response from server")
+	}
+
+	return res, nil
+}
+
+func handleDebugBundle(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		bundle, err := s.DebugBundle(inst)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		bundleBytes := bytes.Buffer{}
+		enc := json.NewEncoder(&bundleBytes)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(bundle); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		// So it can be downloaded from a browser as-is
+		filename := fmt.Sprintf("flux-debug-%s.json", bundle.Generated.Format("20060102T150405Z"))
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.WriteHeader(http.StatusOK)
+		w.Write(bundleBytes.Bytes())
+	})
+}
+
+func invokeDebugBundle(client *http.Client, t flux.Token, router *mux.Router, endpoint string) (api.DebugBundle, error) {
+	var res api.DebugBundle
+	u, err := makeURL(endpoint, router, "DebugBundle")
+	if err != nil {
+		return res, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return res, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return res, errors.Wrap(err, "executing HTTP request")
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return res, errors.Wrap(err, "decoding response body")
+	}
+	return res, nil
+}
+
+func handleUpdatePolicies(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+
+		var update flux.PolicyUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		results, err := s.UpdatePolicies(inst, update)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		resultsBytes := bytes.Buffer{}
+		if err = json.NewEncoder(&resultsBytes).Encode(results); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resultsBytes.Bytes())
+	})
+}
+
+func invokeUpdatePolicies(client *http.Client, t flux.Token, router *mux.Router, endpoint string, update flux.PolicyUpdate) ([]flux.PolicyResult, error) {
+	u, err := makeURL(endpoint, router, "UpdatePolicies")
+	if err != nil {
+		return nil, errors.Wrap(err, "constructing URL")
+	}
+
+	var updateBytes bytes.Buffer
+	if err = json.NewEncoder(&updateBytes).Encode(update); err != nil {
+		return nil, errors.Wrap(err, "encoding policy update")
+	}
+
+	req, err := http.NewRequest("POST", u.String(), &updateBytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "executing HTTP request")
+	}
+
+	var res []flux.PolicyResult
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, errors.Wrap(err, "decoding response body")
+	}
+	return res, nil
+}
+
+func handleRegistryStatus(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		res, err := s.RegistryStatus(inst)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+		writeOutput(w, r, res, registryStatusTable)
+	})
+}
+
+func invokeRegistryStatus(client *http.Client, t flux.Token, router *mux.Router, endpoint string) ([]flux.RegistryHostState, error) {
+	u, err := makeURL(endpoint, router, "RegistryStatus")
+	if err != nil {
+		return nil, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "executing HTTP request")
+	}
+
+	var res []flux.RegistryHostState
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, errors.Wrap(err, "decoding response body")
+	}
+	return res, nil
+}
+
+func handleUnmanagedResources(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		res, err := s.UnmanagedResources(inst)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+		writeOutput(w, r, res, unmanagedTable)
+	})
+}
+
+func invokeUnmanagedResources(client *http.Client, t flux.Token, router *mux.Router, endpoint string) ([]flux.UnmanagedResource, error) {
+	u, err := makeURL(endpoint, router, "UnmanagedResources")
+	if err != nil {
+		return nil, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "executing HTTP request")
+	}
+
+	var res []flux.UnmanagedResource
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, errors.Wrap(err, "decoding response body")
+	}
+	return res, nil
+}
+
+func handleExplainAutomation(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		res, err := s.ExplainAutomation(inst)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+		writeOutput(w, r, res, automationTable)
+	})
+}
+
+func invokeExplainAutomation(client *http.Client, t flux.Token, router *mux.Router, endpoint string) ([]flux.AutomationCheck, error) {
+	u, err := makeURL(endpoint, router, "ExplainAutomation")
+	if err != nil {
+		return nil, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "executing HTTP request")
+	}
+
+	var res []flux.AutomationCheck
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, errors.Wrap(err, "decoding response body")
+	}
+	return res, nil
+}
+
+func handleExport(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		res, err := s.Export(inst)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+		writeOutput(w, r, res, nil)
+	})
+}
+
+func invokeExport(client *http.Client, t flux.Token, router *mux.Router, endpoint string) (flux.DesiredState, error) {
+	u, err := makeURL(endpoint, router, "Export")
+	if err != nil {
+		return flux.DesiredState{}, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return flux.DesiredState{}, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return flux.DesiredState{}, errors.Wrap(err, "executing HTTP request")
+	}
+
+	var res flux.DesiredState
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return flux.DesiredState{}, errors.Wrap(err, "decoding response body")
+	}
+	return res, nil
+}
+
+func handleCheckRegistryCredentials(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		res, err := s.CheckRegistryCredentials(inst)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+		writeOutput(w, r, res, registryCredentialsTable)
+	})
+}
+
+func invokeCheckRegistryCredentials(client *http.Client, t flux.Token, router *mux.Router, endpoint string) ([]flux.RegistryCredentialCheck, error) {
+	u, err := makeURL(endpoint, router, "CheckRegistryCredentials")
+	if err != nil {
+		return nil, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "executing HTTP request")
+	}
+
+	var res []flux.RegistryCredentialCheck
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, errors.Wrap(err, "decoding response body")
+	}
+	return res, nil
+}
+
+func handleGetConfig(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		config, err := s.GetConfig(inst)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		configBytes := bytes.Buffer{}
+		if err = json.NewEncoder(&configBytes).Encode(config); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(configBytes.Bytes())
+		return
+	})
+}
+
+func invokeGetConfig(client *http.Client, t flux.Token, router *mux.Router, endpoint string) (flux.InstanceConfig, error) {
+	u, err := makeURL(endpoint, router, "GetConfig")
+	if err != nil {
+		return flux.InstanceConfig{}, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return flux.InstanceConfig{}, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return flux.InstanceConfig{}, errors.Wrap(err, "executing HTTP request")
+	}
+
+	var res flux.InstanceConfig
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return res, errors.Wrap(err, "decoding response body")
+	}
+	return res, nil
+}
+
+func handleSetConfig(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+
+		var config flux.UnsafeInstanceConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		if err := s.SetConfig(inst, config); err != nil {
+			if _, ok := errors.Cause(err).(*instance.ConflictError); ok {
+				w.WriteHeader(http.StatusConflict)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		return
+
+	})
+}
+
+func invokeSetConfig(client *http.Client, t flux.Token, router *mux.Router, endpoint string, updates flux.UnsafeInstanceConfig) error {
+	u, err := makeURL(endpoint, router, "SetConfig")
+	if err != nil {
+		return errors.Wrap(err, "constructing URL")
+	}
 
 	var configBytes bytes.Buffer
 	if err = json.NewEncoder(&configBytes).Encode(updates); err != nil {
@@ -640,6 +1591,271 @@ func invokeSetConfig(client *http.Client, t flux.Token, router *mux.Router, endp
 	return nil
 }
 
+func handleGetTemplate(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		template, err := s.GetTemplate(inst)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		templateBytes := bytes.Buffer{}
+		if err = json.NewEncoder(&templateBytes).Encode(template); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(templateBytes.Bytes())
+	})
+}
+
+func invokeGetTemplate(client *http.Client, t flux.Token, router *mux.Router, endpoint string) (api.InstanceTemplate, error) {
+	u, err := makeURL(endpoint, router, "GetTemplate")
+	if err != nil {
+		return api.InstanceTemplate{}, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return api.InstanceTemplate{}, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return api.InstanceTemplate{}, errors.Wrap(err, "executing HTTP request")
+	}
+
+	var res api.InstanceTemplate
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return res, errors.Wrap(err, "decoding response body")
+	}
+	return res, nil
+}
+
+func handleApplyTemplate(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+
+		var template api.InstanceTemplate
+		if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		if err := s.ApplyTemplate(inst, template); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func invokeApplyTemplate(client *http.Client, t flux.Token, router *mux.Router, endpoint string, template api.InstanceTemplate) error {
+	u, err := makeURL(endpoint, router, "ApplyTemplate")
+	if err != nil {
+		return errors.Wrap(err, "constructing URL")
+	}
+
+	var templateBytes bytes.Buffer
+	if err = json.NewEncoder(&templateBytes).Encode(template); err != nil {
+		return errors.Wrap(err, "encoding template")
+	}
+
+	req, err := http.NewRequest("POST", u.String(), &templateBytes)
+	if err != nil {
+		return errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	if _, err = executeRequest(client, req); err != nil {
+		return errors.Wrap(err, "executing HTTP request")
+	}
+	return nil
+}
+
+func handleListTokens(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		tokens, err := s.ListTokens(inst)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(tokens)
+	})
+}
+
+func invokeListTokens(client *http.Client, t flux.Token, router *mux.Router, endpoint string) ([]auth.Token, error) {
+	u, err := makeURL(endpoint, router, "ListTokens")
+	if err != nil {
+		return nil, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "executing HTTP request")
+	}
+
+	var res []auth.Token
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, errors.Wrap(err, "decoding response body")
+	}
+	return res, nil
+}
+
+func handleCreateToken(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+
+		var spec auth.TokenSpec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, errors.Wrap(err, "decoding token spec").Error())
+			return
+		}
+		if err := spec.Validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+
+		token, err := s.CreateToken(inst, spec)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(token)
+	})
+}
+
+func invokeCreateToken(client *http.Client, t flux.Token, router *mux.Router, endpoint string, spec auth.TokenSpec) (api.NewToken, error) {
+	u, err := makeURL(endpoint, router, "CreateToken")
+	if err != nil {
+		return api.NewToken{}, errors.Wrap(err, "constructing URL")
+	}
+
+	var specBytes bytes.Buffer
+	if err = json.NewEncoder(&specBytes).Encode(spec); err != nil {
+		return api.NewToken{}, errors.Wrap(err, "encoding token spec")
+	}
+
+	req, err := http.NewRequest("POST", u.String(), &specBytes)
+	if err != nil {
+		return api.NewToken{}, errors.Wrapf(err, "constructing request %s", u)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return api.NewToken{}, errors.Wrap(err, "executing HTTP request")
+	}
+
+	var res api.NewToken
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return api.NewToken{}, errors.Wrap(err, "decoding response body")
+	}
+	return res, nil
+}
+
+func handleRotateToken(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		id := mux.Vars(r)["id"]
+		token, err := s.RotateToken(inst, auth.TokenID(id))
+		switch err {
+		case nil:
+		case auth.ErrNoSuchToken:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, err.Error())
+			return
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(token)
+	})
+}
+
+func invokeRotateToken(client *http.Client, t flux.Token, router *mux.Router, endpoint string, id auth.TokenID) (api.NewToken, error) {
+	u, err := makeURL(endpoint, router, "RotateToken", "id", string(id))
+	if err != nil {
+		return api.NewToken{}, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return api.NewToken{}, errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return api.NewToken{}, errors.Wrap(err, "executing HTTP request")
+	}
+
+	var res api.NewToken
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return api.NewToken{}, errors.Wrap(err, "decoding response body")
+	}
+	return res, nil
+}
+
+func handleRevokeToken(s api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := getInstanceID(r)
+		id := mux.Vars(r)["id"]
+		switch err := s.RevokeToken(inst, auth.TokenID(id)); err {
+		case nil:
+			w.WriteHeader(http.StatusOK)
+		case auth.ErrNoSuchToken:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, err.Error())
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, err.Error())
+		}
+	})
+}
+
+func invokeRevokeToken(client *http.Client, t flux.Token, router *mux.Router, endpoint string, id auth.TokenID) error {
+	u, err := makeURL(endpoint, router, "RevokeToken", "id", string(id))
+	if err != nil {
+		return errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return errors.Wrapf(err, "constructing request %s", u)
+	}
+	t.Set(req)
+
+	if _, err = executeRequest(client, req); err != nil {
+		return errors.Wrap(err, "executing HTTP request")
+	}
+	return nil
+}
+
 func invokeStatus(client *http.Client, t flux.Token, router *mux.Router, endpoint string) (flux.Status, error) {
 	u, err := makeURL(endpoint, router, "Status")
 	if err != nil {
@@ -673,17 +1889,7 @@ func handleStatus(s api.FluxService) http.Handler {
 			fmt.Fprintf(w, err.Error())
 			return
 		}
-
-		statusBytes := bytes.Buffer{}
-		if err = json.NewEncoder(&statusBytes).Encode(status); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, err.Error())
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		w.Write(statusBytes.Bytes())
-		return
+		writeOutput(w, r, status, statusTable)
 	})
 }
 
@@ -736,6 +1942,45 @@ func handleIsConnected(s api.FluxService) http.Handler {
 // invokeIsConnected is not implemented, since it is not (at present)
 // used in a command-line client command.
 
+// APIVersions are the versions of the API served, as in the paths
+// of the routes, oldest first.
+var APIVersions = []string{"v3", "v4"}
+
+func handleAPIVersions(_ api.FluxService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(APIVersions)
+	})
+}
+
+// GetAPIVersions asks the service which versions of the API it
+// serves. Services from before versions could be asked about answer
+// with an APIError for which IsMissing is true.
+func GetAPIVersions(client *http.Client, router *mux.Router, endpoint string) ([]string, error) {
+	u, err := makeURL(endpoint, router, "APIVersions")
+	if err != nil {
+		return nil, errors.Wrap(err, "constructing URL")
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "constructing request %s", u)
+	}
+
+	resp, err := executeRequest(client, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "executing HTTP request")
+	}
+	defer resp.Body.Close()
+
+	var res []string
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, errors.Wrap(err, "decoding response body")
+	}
+	return res, nil
+}
+
 // --- end handle/invoke
 
 func mustGetPathTemplate(route *mux.Route) string {
@@ -811,6 +2056,9 @@ func logging(next http.Handler, logger log.Logger) http.Handler {
 			"took", time.Since(begin).String(),
 			"status_code", cw.code,
 		)
+		if t, ok := requestToken(r); ok {
+			requestLogger = requestLogger.With("token", t.ID)
+		}
 		if cw.code != http.StatusOK {
 			requestLogger = requestLogger.With("error", strings.TrimSpace(tw.buf.String()))
 		}
@@ -0,0 +1,227 @@
+package flux
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ImageID identifies an image, e.g.,
+// "quay.io/weaveworks/helloworld:v1". Any part but the image name may
+// be absent. As in Docker's reference grammar, the first path
+// component is the registry host only if it looks like one: it has a
+// "." or ":" in it, or is "localhost" (so "shortreg/repo/image1" has
+// no host). The organisation is everything else before the image
+// name.
+type ImageID struct {
+	Host   string // e.g., "quay.io"
+	Org    string // e.g., "weaveworks"
+	Image  string // e.g., "helloworld"
+	Tag    string // e.g., "v1"
+	Digest string // e.g., "sha256:6b9a..."
+
+	// invalid holds the string given, if it couldn't be parsed, so
+	// that it can still be shown (and serialised) as it was.
+	invalid string
+}
+
+var (
+	imageHostRE      = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?(:[0-9]+)?$`)
+	imageComponentRE = regexp.MustCompile(`^[a-z0-9]+(([._]|__|-+)[a-z0-9]+)*$`)
+	imageTagRE       = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	imageDigestRE    = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*([-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}$`)
+)
+
+// ParseImageID parses an image reference, as given in a container
+// spec, returning ErrInvalidImageID (wrapped to say why) if it isn't
+// one. In that case, the ImageID returned still gives the string as
+// its String(), but has no parts.
+func ParseImageID(s string) (ImageID, error) {
+	var id ImageID
+	if s == "" {
+		return id, errors.Wrap(ErrInvalidImageID, "empty image reference")
+	}
+	invalid := ImageID{invalid: s}
+	name := s
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		id.Digest = name[i+1:]
+		name = name[:i]
+		if !imageDigestRE.MatchString(id.Digest) {
+			return invalid, errors.Wrapf(ErrInvalidImageID, "invalid digest in %q", s)
+		}
+	}
+	if i := strings.Index(name, "/"); i >= 0 && isHost(name[:i]) {
+		id.Host = name[:i]
+		name = name[i+1:]
+		if !imageHostRE.MatchString(id.Host) {
+			return invalid, errors.Wrapf(ErrInvalidImageID, "invalid registry host in %q", s)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		id.Tag = name[i+1:]
+		name = name[:i]
+		if !imageTagRE.MatchString(id.Tag) {
+			return invalid, errors.Wrapf(ErrInvalidImageID, "invalid tag in %q", s)
+		}
+	}
+	id.Org, id.Image = splitName(name)
+	for _, component := range strings.Split(name, "/") {
+		if !imageComponentRE.MatchString(component) {
+			return invalid, errors.Wrapf(ErrInvalidImageID, "invalid image name in %q", s)
+		}
+	}
+	return id, nil
+}
+
+// isHost says whether the first path component of an image reference
+// is a registry host.
+func isHost(component string) bool {
+	return strings.ContainsAny(component, ".:") || component == "localhost"
+}
+
+// MakeImageID makes an image ID from its parts, as given by
+// Components.
+func MakeImageID(registry, name, tag string) ImageID {
+	org, image := splitName(name)
+	return ImageID{Host: registry, Org: org, Image: image, Tag: tag}
+}
+
+// splitName splits an image name into its organisation (everything
+// up to the last path component) and image.
+func splitName(name string) (org, image string) {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+// Name gives the image name including the organisation, e.g.,
+// "weaveworks/helloworld".
+func (id ImageID) Name() string {
+	if id.Org != "" {
+		return id.Org + "/" + id.Image
+	}
+	return id.Image
+}
+
+func (id ImageID) Components() (registry, name, tag string) {
+	return id.Host, id.Name(), id.Tag
+}
+
+func (id ImageID) Repository() string {
+	name := id.Name()
+	if id.Host != "" && name != "" {
+		return id.Host + "/" + name
+	}
+	return name
+}
+
+func (id ImageID) String() string {
+	if id.invalid != "" {
+		return id.invalid
+	}
+	s := id.Repository()
+	if id.Tag != "" {
+		s += ":" + id.Tag
+	}
+	if id.Digest != "" {
+		s += "@" + id.Digest
+	}
+	return s
+}
+
+// MarshalText gives the image ID as it would be written in a
+// container spec, so it's serialised (e.g., in JSON) as it was when
+// image IDs were strings.
+func (id ImageID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText parses an image ID written by MarshalText; the empty
+// string is the zero value. Since image IDs were once any string,
+// one that doesn't parse is kept as it is, rather than being an
+// error.
+func (id *ImageID) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*id = ImageID{}
+		return nil
+	}
+	*id, _ = ParseImageID(string(text))
+	return nil
+}
+
+// ImageMigration moves images from one registry or repository to
+// another, e.g., from Docker Hub ("docker.io") to an internal mirror
+// of it ("registry.example.com/hub"). From and To are repository
+// prefixes, matched a path component at a time. As in Docker, images
+// without a registry host are on Docker Hub, and those with only a
+// name are in its "library" organisation; so "docker.io/library"
+// matches "nginx".
+type ImageMigration struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+const dockerHubHost = "docker.io"
+
+// canonicalPrefix fills in the registry host of a repository prefix,
+// if it's not given.
+func canonicalPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	first := prefix
+	if i := strings.Index(prefix, "/"); i >= 0 {
+		first = prefix[:i]
+	}
+	switch {
+	case first == "index.docker.io":
+		return dockerHubHost + prefix[len(first):]
+	case isHost(first):
+		return prefix
+	}
+	return dockerHubHost + "/" + prefix
+}
+
+// Validate checks that both prefixes are given, and that images
+// migrated will still be valid image references.
+func (m ImageMigration) Validate() error {
+	if strings.Trim(m.From, "/") == "" || strings.Trim(m.To, "/") == "" {
+		return errors.New("both the repository to migrate from and that to migrate to must be given")
+	}
+	if canonicalPrefix(m.From) == canonicalPrefix(m.To) {
+		return errors.Errorf("migrating from %s to itself", m.From)
+	}
+	if _, err := ParseImageID(strings.Trim(m.To, "/") + "/image"); err != nil {
+		return errors.Wrapf(err, "repository to migrate to, %q", m.To)
+	}
+	return nil
+}
+
+// Migrate gives the image as it is in the repository migrated to,
+// keeping its tag or digest, if the image is in the repository
+// migrated from; otherwise it gives the image as it is, and false.
+func (m ImageMigration) Migrate(id ImageID) (ImageID, bool) {
+	if id.invalid != "" || id.Image == "" {
+		return id, false
+	}
+	host, org := id.Host, id.Org
+	if host == "" || host == "index.docker.io" {
+		host = dockerHubHost
+	}
+	if host == dockerHubHost && org == "" {
+		org = "library"
+	}
+	name := id.Image
+	if org != "" {
+		name = org + "/" + name
+	}
+	repo, from := host+"/"+name, canonicalPrefix(m.From)
+	if repo != from && !strings.HasPrefix(repo, from+"/") {
+		return id, false
+	}
+	migrated, err := ParseImageID(strings.Trim(m.To, "/") + repo[len(from):] + id.String()[len(id.Repository()):])
+	if err != nil {
+		return id, false
+	}
+	return migrated, true
+}
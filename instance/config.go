@@ -1,12 +1,34 @@
 package instance
 
 import (
+	"fmt"
+
 	"github.com/weaveworks/flux"
 )
 
 type ServiceConfig struct {
-	Automated bool `json:"automation"`
-	Locked    bool `json:"locked"`
+	Automated bool `json:"automation" yaml:"automation"`
+	Locked    bool `json:"locked" yaml:"locked"`
+	// TagFilter, if not empty, is a glob that the tags of images must
+	// match to be released by automation, or as the latest of their
+	// repository.
+	TagFilter string `json:"tagFilter,omitempty" yaml:"tagFilter,omitempty"`
+	// MinImageAge, if not zero, is how many minutes old an image must
+	// be to be released as the latest, so that it's had time to reach
+	// every registry mirror.
+	MinImageAge int `json:"minImageAge,omitempty" yaml:"minImageAge,omitempty"`
+	// NewerOnly, if set, means an image is only released as the
+	// latest if it was built after the image running.
+	NewerOnly bool `json:"newerOnly,omitempty" yaml:"newerOnly,omitempty"`
+	// RestartEvery, if not empty, is how often (as a duration, e.g.,
+	// "24h") the service is restarted, e.g., to pick up rotated
+	// secrets.
+	RestartEvery string `json:"restartEvery,omitempty" yaml:"restartEvery,omitempty"`
+	// ReleaseInterval, if not empty, is the least time (as a
+	// duration, e.g., "30m") between releases of the service, for
+	// those whose deployments are expensive. Automated releases which
+	// would come sooner are held back until it's passed.
+	ReleaseInterval string `json:"releaseInterval,omitempty" yaml:"releaseInterval,omitempty"`
 }
 
 func (c ServiceConfig) Policy() flux.Policy {
@@ -22,6 +44,56 @@ func (c ServiceConfig) Policy() flux.Policy {
 type Config struct {
 	Services map[flux.ServiceID]ServiceConfig `json:"services"`
 	Settings flux.UnsafeInstanceConfig        `json:"settings"`
+	// Suspect are the images, for each service, which aren't to be
+	// released to it as the latest until they're confirmed.
+	Suspect map[flux.ServiceID][]flux.SuspectImage `json:"suspect,omitempty"`
+	// Version is incremented each time the config is stored. It's
+	// kept by the DB alongside the config, rather than in it.
+	Version int64 `json:"-"`
+}
+
+// SuspectImage gives the record of the image being suspect for the
+// service, if it is.
+func (c Config) SuspectImage(service flux.ServiceID, image flux.ImageID) (flux.SuspectImage, bool) {
+	for _, s := range c.Suspect[service] {
+		if s.Image == image {
+			return s, true
+		}
+	}
+	return flux.SuspectImage{}, false
+}
+
+// MarkSuspect records the image as suspect for the service, unless it
+// already is; it says whether it wasn't.
+func (c *Config) MarkSuspect(service flux.ServiceID, suspect flux.SuspectImage) bool {
+	if _, ok := c.SuspectImage(service, suspect.Image); ok {
+		return false
+	}
+	if c.Suspect == nil {
+		c.Suspect = map[flux.ServiceID][]flux.SuspectImage{}
+	}
+	c.Suspect[service] = append(c.Suspect[service], suspect)
+	return true
+}
+
+// ConfirmImage forgets that the image is suspect for the service; it
+// says whether it was.
+func (c *Config) ConfirmImage(service flux.ServiceID, image flux.ImageID) bool {
+	var rest []flux.SuspectImage
+	for _, s := range c.Suspect[service] {
+		if s.Image != image {
+			rest = append(rest, s)
+		}
+	}
+	if len(rest) == len(c.Suspect[service]) {
+		return false
+	}
+	if len(rest) == 0 {
+		delete(c.Suspect, service)
+	} else {
+		c.Suspect[service] = rest
+	}
+	return true
 }
 
 type NamedConfig struct {
@@ -37,7 +109,34 @@ func MakeConfig() Config {
 
 type UpdateFunc func(config Config) (Config, error)
 
+// ConflictError is returned by an update made against a version of
+// the config that's since been superseded.
+type ConflictError struct {
+	Instance flux.InstanceID
+	Expected int64
+	Actual   int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("config for instance %s has changed since it was read (it's at version %d, not %d); get it again and reapply the changes", e.Instance, e.Actual, e.Expected)
+}
+
+// IfVersion makes an update that's only applied if the config is at
+// the version given, and otherwise fails with a ConflictError.
+func IfVersion(inst flux.InstanceID, version int64, update UpdateFunc) UpdateFunc {
+	return func(config Config) (Config, error) {
+		if config.Version != version {
+			return config, &ConflictError{Instance: inst, Expected: version, Actual: config.Version}
+		}
+		return update(config)
+	}
+}
+
 type DB interface {
+	// UpdateConfig applies the update to the config of the instance
+	// atomically: if the config is changed by something else in the
+	// meantime, the update is applied again to the new config (or
+	// fails with a ConflictError, if that keeps happening).
 	UpdateConfig(instance flux.InstanceID, update UpdateFunc) error
 	GetConfig(instance flux.InstanceID) (Config, error)
 	All() ([]NamedConfig, error)
@@ -46,6 +145,10 @@ type DB interface {
 type Configurer interface {
 	Get() (Config, error)
 	Update(UpdateFunc) error
+	// UpdateAt applies the update only if the config is still at the
+	// version given (as from Get), failing with a ConflictError if
+	// not.
+	UpdateAt(version int64, update UpdateFunc) error
 }
 
 type configurer struct {
@@ -60,3 +163,7 @@ func (c configurer) Get() (Config, error) {
 func (c configurer) Update(update UpdateFunc) error {
 	return c.db.UpdateConfig(c.instance, update)
 }
+
+func (c configurer) UpdateAt(version int64, update UpdateFunc) error {
+	return c.db.UpdateConfig(c.instance, IfVersion(c.instance, version, update))
+}
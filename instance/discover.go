@@ -0,0 +1,57 @@
+package instance
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+// Discoverer fetches the image repositories under the namespaces each
+// instance has said to discover, so that the registry warehouse has
+// image metadata for them before any service asks.
+type Discoverer struct {
+	DB        DB
+	Instancer Instancer
+	Logger    log.Logger
+}
+
+// Discover discovers repositories for all instances each time there's
+// a tick, until the channel is closed.
+func (d *Discoverer) Discover(tick <-chan time.Time) {
+	for range tick {
+		d.discoverAll()
+	}
+}
+
+func (d *Discoverer) discoverAll() {
+	insts, err := d.DB.All()
+	if err != nil {
+		d.Logger.Log("err", errors.Wrap(err, "getting all instance configs"))
+		return
+	}
+	for _, named := range insts {
+		namespaces := named.Config.Settings.Registry.Discover
+		if len(namespaces) == 0 {
+			continue
+		}
+		logger := log.NewContext(d.Logger).With("instanceID", named.ID)
+		inst, err := d.Instancer.Get(named.ID)
+		if err != nil {
+			logger.Log("err", errors.Wrap(err, "getting instance"))
+			continue
+		}
+		for _, namespace := range namespaces {
+			repos, err := inst.registry.ListRepositories(namespace)
+			if err != nil {
+				logger.Log("namespace", namespace, "err", errors.Wrap(err, "listing repositories"))
+				continue
+			}
+			for _, repo := range repos {
+				if _, err := inst.registry.GetRepository(repo); err != nil {
+					logger.Log("repository", repo, "err", errors.Wrap(err, "fetching image metadata"))
+				}
+			}
+		}
+	}
+}
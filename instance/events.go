@@ -1,6 +1,8 @@
 package instance
 
 import (
+	"time"
+
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/history"
 )
@@ -21,3 +23,15 @@ func (rw EventReadWriter) AllEvents() ([]history.Event, error) {
 func (rw EventReadWriter) EventsForService(namespace, service string) ([]history.Event, error) {
 	return rw.db.EventsForService(rw.inst, namespace, service)
 }
+
+func (rw EventReadWriter) LogImageReleases(releases []flux.ImageRelease) error {
+	return rw.db.LogImageReleases(rw.inst, releases)
+}
+
+func (rw EventReadWriter) ImagesAt(service flux.ServiceID, at time.Time) ([]flux.ImageRelease, error) {
+	return rw.db.ImagesAt(rw.inst, service, at)
+}
+
+func (rw EventReadWriter) Timeline(q flux.TimelineQuery) ([]flux.ImageRelease, error) {
+	return rw.db.Timeline(rw.inst, q)
+}
@@ -1,7 +1,9 @@
 package instance
 
 import (
+	"context"
 	"fmt"
+	"path"
 	"strings"
 	"time"
 
@@ -27,10 +29,15 @@ type Instance struct {
 	config   Configurer
 	duration metrics.Histogram
 	gitrepo  git.Repo
+	// ctx, if set, is done when what's being done with the instance
+	// is to be abandoned; see WithContext.
+	ctx context.Context
 
 	log.Logger
 	history.EventReader
 	history.EventWriter
+	history.ImageReleaseReadWriter
+	history.ReleaseAnnotator
 }
 
 func New(
@@ -42,6 +49,8 @@ func New(
 	duration metrics.Histogram,
 	events history.EventReader,
 	eventlog history.EventWriter,
+	releases history.ImageReleaseReadWriter,
+	annotator history.ReleaseAnnotator,
 ) *Instance {
 	return &Instance{
 		platform:    platform,
@@ -52,10 +61,53 @@ func New(
 		Logger:      logger,
 		EventReader: events,
 		EventWriter: eventlog,
+
+		ImageReleaseReadWriter: releases,
+		ReleaseAnnotator:       annotator,
+	}
+}
+
+// WithPlatform gives a copy of the instance using the platform given,
+// e.g., to plan a release against a snapshot.
+func (i *Instance) WithPlatform(p platform.Platform) *Instance {
+	copy := *i
+	copy.platform = p
+	return &copy
+}
+
+// WithContext gives a copy of the instance which stops fetching from
+// the registry, or applying to the platform, once the context given is
+// done, and whose config repo operations are abandoned then. Calls to
+// the registry or platform already made are seen through, since they
+// can't be cancelled.
+func (i *Instance) WithContext(ctx context.Context) *Instance {
+	copy := *i
+	copy.ctx = ctx
+	return &copy
+}
+
+// Context gives the context the instance was given with WithContext,
+// or the background context if it wasn't given one.
+func (h *Instance) Context() context.Context {
+	if h.ctx == nil {
+		return context.Background()
 	}
+	return h.ctx
+}
+
+// abandoned gives the reason to stop, if the instance's context is
+// done.
+func (h *Instance) abandoned() error {
+	if h.ctx == nil {
+		return nil
+	}
+	return h.ctx.Err()
 }
 
 func (h *Instance) ConfigRepo() git.Repo {
+	if h.ctx != nil {
+		return h.gitrepo.WithContext(h.ctx)
+	}
 	return h.gitrepo
 }
 
@@ -77,6 +129,26 @@ func (m ImageMap) LatestImage(repo string) *flux.ImageDescription {
 	return nil
 }
 
+// FilterTags returns the images whose tags match the glob given.
+// An empty pattern matches everything.
+func (m ImageMap) FilterTags(pattern string) ImageMap {
+	if pattern == "" {
+		return m
+	}
+	res := ImageMap{}
+	for repo, images := range m {
+		var matching []flux.ImageDescription
+		for _, image := range images {
+			_, _, tag := image.ID.Components()
+			if ok, _ := path.Match(pattern, tag); ok {
+				matching = append(matching, image)
+			}
+		}
+		res[repo] = matching
+	}
+	return res
+}
+
 // Get the services in `namespace` along with their containers (if
 // there are any) from the platform; if namespace is blank, just get
 // all the services, in any namespace.
@@ -101,11 +173,17 @@ func (h *Instance) CollectAvailableImages(services []platform.Service) (ImageMap
 	images := ImageMap{}
 	for _, service := range services {
 		for _, container := range service.ContainersOrNil() {
-			repo := flux.ParseImageID(container.Image).Repository()
-			images[repo] = nil
+			id, err := flux.ParseImageID(container.Image)
+			if err != nil {
+				return nil, errors.Wrapf(err, "container %s of service %s", container.Name, service.ID)
+			}
+			images[id.Repository()] = nil
 		}
 	}
 	for repo := range images {
+		if err := h.abandoned(); err != nil {
+			return nil, err
+		}
 		imageRepo, err := h.registry.GetRepository(repo)
 		if err != nil {
 			return nil, errors.Wrapf(err, "fetching image metadata for %s", repo)
@@ -117,6 +195,9 @@ func (h *Instance) CollectAvailableImages(services []platform.Service) (ImageMap
 
 // GetRepository exposes this instance's registry's GetRepository method directly.
 func (h *Instance) GetRepository(repo string) ([]flux.ImageDescription, error) {
+	if err := h.abandoned(); err != nil {
+		return nil, err
+	}
 	return h.registry.GetRepository(repo)
 }
 
@@ -138,9 +219,40 @@ func (h *Instance) PlatformApply(defs []platform.ServiceDefinition) (err error)
 		).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
+	if err := h.abandoned(); err != nil {
+		return err
+	}
 	return h.platform.Apply(defs)
 }
 
+func (h *Instance) PlatformApplyResources(set platform.ResourceSet) (err error) {
+	defer func(begin time.Time) {
+		h.duration.With(
+			fluxmetrics.LabelMethod, "PlatformApplyResources",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	if err := h.abandoned(); err != nil {
+		return err
+	}
+	return h.platform.ApplyResources(set)
+}
+
+func (h *Instance) PlatformDryRunApply(defs []platform.ServiceDefinition) (res platform.DryRunResult, err error) {
+	defer func(begin time.Time) {
+		h.duration.With(
+			fluxmetrics.LabelMethod, "PlatformDryRunApply",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	if err := h.abandoned(); err != nil {
+		return nil, err
+	}
+	return h.platform.DryRunApply(defs)
+}
+
 func (h *Instance) Ping() error {
 	return h.platform.Ping()
 }
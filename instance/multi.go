@@ -2,6 +2,9 @@ package instance
 
 import (
 	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics"
@@ -12,6 +15,7 @@ import (
 	"github.com/weaveworks/flux/history"
 	"github.com/weaveworks/flux/platform"
 	"github.com/weaveworks/flux/registry"
+	"github.com/weaveworks/flux/usage"
 )
 
 type MultitenantInstancer struct {
@@ -21,41 +25,202 @@ type MultitenantInstancer struct {
 	Histogram       metrics.Histogram
 	History         history.DB
 	RegistryMetrics registry.Metrics
+	// RegistryThrottle is shared by the registry clients of all
+	// instances.
+	RegistryThrottle *registry.Throttle
+	// RegistryTransports, if not nil, pools the connections of the
+	// registry clients of all instances.
+	RegistryTransports *registry.Transports
+	// RegistryWarehouse, if not nil, keeps image metadata fetched
+	// for each instance for a while.
+	RegistryWarehouse *registry.Warehouse
+	GitMetrics        git.Metrics
+	// GitTimeout is how long each git operation on a config repo may
+	// take; zero means git.DefaultTimeout.
+	GitTimeout time.Duration
+	// EventPublisher, if not nil, is given the events and image
+	// releases of each instance, to publish on a topic made of
+	// EventTopicPrefix and the instance ID.
+	EventPublisher   history.Publisher
+	EventTopicPrefix string
+	// GitWorkingDir, if not empty, is where clones of config repos
+	// are made, in a directory for each instance.
+	GitWorkingDir string
+	// GitPool, if not nil, keeps the clones of config repos finished
+	// with, to be refreshed and used again.
+	GitPool *git.Pool
+	// CacheMaxAge, if not zero, is how long what's made from an
+	// instance's config is kept, to be used again without going to
+	// the DB. After that, it's still used if the config hasn't
+	// changed. Updates made through the DB returned by CachingDB are
+	// seen straight away; others only once the cache entry is too
+	// old.
+	CacheMaxAge time.Duration
+	// Usage, if not nil, counts the registry requests and git
+	// operations made for each instance.
+	Usage usage.Meter
+
+	mu    sync.Mutex
+	cache map[flux.InstanceID]instanceParts
+	// generations counts the times each instance's cache entry has
+	// been invalidated, so that parts made from a config read before
+	// then aren't cached.
+	generations map[flux.InstanceID]uint64
+}
+
+// instanceParts are what's made from the config of an instance.
+type instanceParts struct {
+	version   int64
+	fetched   time.Time
+	logger    log.Logger
+	registry  registry.Client
+	repo      git.Repo
+	events    EventReadWriter
+	eventW    history.EventWriter
+	releaseRW history.ImageReleaseReadWriter
+	annotator history.ReleaseAnnotator
 }
 
 func (m *MultitenantInstancer) Get(instanceID flux.InstanceID) (*Instance, error) {
-	c, err := m.DB.GetConfig(instanceID)
+	parts, err := m.parts(instanceID)
 	if err != nil {
-		return nil, errors.Wrap(err, "getting instance config from DB")
+		return nil, err
 	}
 
-	// Platform interface for this instance
+	// Platform interface for this instance. This isn't kept, since
+	// the platform may connect or disconnect at any time.
 	platform, err := m.Connecter.Connect(instanceID)
 	if err != nil {
 		return nil, errors.Wrap(err, "connecting to platform")
 	}
 
+	return New(
+		platform,
+		parts.registry,
+		configurer{instanceID, m.DB},
+		parts.repo,
+		parts.logger,
+		m.Histogram,
+		parts.events,
+		parts.eventW,
+		parts.releaseRW,
+		parts.annotator,
+	), nil
+}
+
+// parts gives the parts of the instance, from the cache if they're
+// there and fresh, or they were made from the current config. What's
+// made is only cached if the instance wasn't invalidated meanwhile,
+// since the config read may be out of date.
+func (m *MultitenantInstancer) parts(instanceID flux.InstanceID) (instanceParts, error) {
+	m.mu.Lock()
+	cached, ok := m.cache[instanceID]
+	generation := m.generations[instanceID]
+	m.mu.Unlock()
+	if ok && time.Since(cached.fetched) < m.CacheMaxAge {
+		return cached, nil
+	}
+
+	c, err := m.DB.GetConfig(instanceID)
+	if err != nil {
+		return instanceParts{}, errors.Wrap(err, "getting instance config from DB")
+	}
+	parts := cached
+	if !ok || cached.version != c.Version {
+		if parts, err = m.makeParts(instanceID, c); err != nil {
+			return instanceParts{}, err
+		}
+	}
+	parts.fetched = time.Now()
+
+	if m.CacheMaxAge > 0 {
+		m.mu.Lock()
+		if m.cache == nil {
+			m.cache = map[flux.InstanceID]instanceParts{}
+		}
+		if m.generations[instanceID] == generation {
+			m.cache[instanceID] = parts
+		}
+		m.mu.Unlock()
+	}
+	return parts, nil
+}
+
+// Invalidate forgets what's cached for the instance given, e.g.,
+// because its config has changed.
+func (m *MultitenantInstancer) Invalidate(instanceID flux.InstanceID) {
+	m.mu.Lock()
+	delete(m.cache, instanceID)
+	if m.generations == nil {
+		m.generations = map[flux.InstanceID]uint64{}
+	}
+	m.generations[instanceID]++
+	m.mu.Unlock()
+}
+
+func (m *MultitenantInstancer) makeParts(instanceID flux.InstanceID, c Config) (instanceParts, error) {
 	// Logger specialised to this instance
 	instanceLogger := log.NewContext(m.Logger).With("instanceID", instanceID)
 
 	// Registry client with instance's config
 	creds, err := registry.CredentialsFromConfig(c.Settings)
 	if err != nil {
-		return nil, errors.Wrap(err, "decoding registry credentials")
+		return instanceParts{}, errors.Wrap(err, "decoding registry credentials")
+	}
+	hosts, err := registry.HostConfigFromConfig(c.Settings)
+	if err != nil {
+		return instanceParts{}, errors.Wrap(err, "reading registry host config")
 	}
-	regClient := registry.NewClient(
+	regMetrics := m.RegistryMetrics.WithInstanceID(instanceID)
+	gitMetrics := m.GitMetrics.WithInstanceID(instanceID)
+	if m.Usage != nil {
+		regMetrics.RequestDuration = usage.Counting(regMetrics.RequestDuration, func() {
+			m.Usage.Add(instanceID, usage.RegistryRequests, 1)
+		})
+		if gitMetrics.OperationDuration != nil {
+			gitMetrics.OperationDuration = usage.Counting(gitMetrics.OperationDuration, func() {
+				m.Usage.Add(instanceID, usage.GitOperations, 1)
+			})
+		}
+	}
+	regClient := m.RegistryWarehouse.Client(instanceID, registry.NewClient(
 		creds,
+		hosts,
+		m.RegistryThrottle,
+		m.RegistryTransports,
 		log.NewContext(instanceLogger).With("component", "registry"),
-		m.RegistryMetrics.WithInstanceID(instanceID),
-	)
+		regMetrics,
+	))
 
 	repo := gitRepoFromSettings(c.Settings)
+	repo.Metrics = gitMetrics
+	repo.Timeout = m.GitTimeout
+	repo.Pool = m.GitPool
+	if m.GitWorkingDir != "" {
+		repo.WorkingDir = filepath.Join(m.GitWorkingDir, string(instanceID))
+	}
 
 	// Events for this instance
 	eventRW := EventReadWriter{instanceID, m.History}
 	var eventW history.EventWriter = eventRW
+	var releaseRW history.ImageReleaseReadWriter = eventRW
+	if m.EventPublisher != nil {
+		publisher := history.NewPublishingWriter(m.EventPublisher, instanceID, m.EventTopicPrefix+string(instanceID))
+		eventW = history.TeeWriter(eventRW, publisher)
+		releaseRW = history.TeeReleaseWriter(eventRW, publisher)
+	}
+	if webhooks := c.Settings.Webhooks; webhooks != nil && len(webhooks.NotifyURLs) > 0 {
+		publisher := history.NewWebhookPublisher(http.DefaultClient, webhooks.Secrets)
+		var releaseWs []history.ImageReleaseWriter
+		for _, u := range webhooks.NotifyURLs {
+			w := history.NewPublishingWriter(publisher, instanceID, u)
+			eventW = history.TeeWriter(eventW, w)
+			releaseWs = append(releaseWs, w)
+		}
+		releaseRW = history.TeeReleaseWriter(releaseRW, releaseWs...)
+	}
 	if c.Settings.Slack.HookURL != "" {
-		eventW = history.TeeWriter(eventRW, history.NewSlackEventWriter(
+		eventW = history.TeeWriter(eventW, history.NewSlackEventWriter(
 			http.DefaultClient,
 			c.Settings.Slack.HookURL,
 			c.Settings.Slack.Username,
@@ -63,19 +228,39 @@ func (m *MultitenantInstancer) Get(instanceID flux.InstanceID) (*Instance, error
 		))
 	}
 
-	// Configuration for this instance
-	config := configurer{instanceID, m.DB}
+	var annotator history.ReleaseAnnotator = history.NopAnnotator{}
+	if c.Settings.Grafana != nil && c.Settings.Grafana.URL != "" {
+		annotator = history.NewGrafanaAnnotator(http.DefaultClient, *c.Settings.Grafana)
+	}
+
+	return instanceParts{
+		version:   c.Version,
+		logger:    instanceLogger,
+		registry:  regClient,
+		repo:      repo,
+		events:    eventRW,
+		eventW:    eventW,
+		releaseRW: releaseRW,
+		annotator: annotator,
+	}, nil
+}
 
-	return New(
-		platform,
-		regClient,
-		config,
-		repo,
-		instanceLogger,
-		m.Histogram,
-		eventRW,
-		eventW,
-	), nil
+// CachingDB gives a DB which invalidates the instancer's cache entry
+// for each instance when its config is updated. The instancer should
+// use it too, so updates made through instances are seen.
+func (m *MultitenantInstancer) CachingDB(db DB) DB {
+	return invalidatingDB{db, m.Invalidate}
+}
+
+type invalidatingDB struct {
+	DB
+	invalidate func(flux.InstanceID)
+}
+
+func (db invalidatingDB) UpdateConfig(inst flux.InstanceID, update UpdateFunc) error {
+	err := db.DB.UpdateConfig(inst, update)
+	db.invalidate(inst)
+	return err
 }
 
 func gitRepoFromSettings(settings flux.UnsafeInstanceConfig) git.Repo {
@@ -84,9 +269,11 @@ func gitRepoFromSettings(settings flux.UnsafeInstanceConfig) git.Repo {
 		branch = "master"
 	}
 	return git.Repo{
-		URL:    settings.Git.URL,
-		Branch: branch,
-		Key:    settings.Git.Key,
-		Path:   settings.Git.Path,
+		URL:        settings.Git.URL,
+		Branch:     branch,
+		Key:        settings.Git.Key,
+		Submodules: settings.Git.Submodules,
+		Path:       settings.Git.Path,
+		Metadata:   settings.Git.ReleaseMetadata,
 	}
 }
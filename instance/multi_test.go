@@ -0,0 +1,148 @@
+package instance
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/registry"
+)
+
+type nopHistogram struct{}
+
+func (h nopHistogram) With(...string) metrics.Histogram { return h }
+func (h nopHistogram) Observe(float64)                  {}
+
+// memDB keeps one config per instance, counting how often it's read.
+// If reading is set, GetConfig calls it with the config read, before
+// returning it.
+type memDB struct {
+	mu      sync.Mutex
+	configs map[flux.InstanceID]Config
+	reads   int
+	reading func(Config)
+}
+
+func (db *memDB) GetConfig(inst flux.InstanceID) (Config, error) {
+	db.mu.Lock()
+	c := db.configs[inst]
+	db.reads++
+	reading := db.reading
+	db.mu.Unlock()
+	if reading != nil {
+		reading(c)
+	}
+	return c, nil
+}
+
+func (db *memDB) UpdateConfig(inst flux.InstanceID, update UpdateFunc) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	c, err := update(db.configs[inst])
+	if err != nil {
+		return err
+	}
+	c.Version = db.configs[inst].Version + 1
+	db.configs[inst] = c
+	return nil
+}
+
+func (db *memDB) All() ([]NamedConfig, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var res []NamedConfig
+	for id, c := range db.configs {
+		res = append(res, NamedConfig{ID: id, Config: c})
+	}
+	return res, nil
+}
+
+func (db *memDB) readCount() int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.reads
+}
+
+const testInstance = flux.InstanceID("instance")
+
+func setRepoURL(url string) UpdateFunc {
+	return func(c Config) (Config, error) {
+		c.Settings.Git.URL = url
+		return c, nil
+	}
+}
+
+func newCachingInstancer(maxAge time.Duration) (*MultitenantInstancer, *memDB) {
+	db := &memDB{configs: map[flux.InstanceID]Config{testInstance: MakeConfig()}}
+	db.UpdateConfig(testInstance, setRepoURL("git@example.com:first"))
+	m := &MultitenantInstancer{
+		Logger:          log.NewNopLogger(),
+		RegistryMetrics: registry.Metrics{FetchDuration: nopHistogram{}, RequestDuration: nopHistogram{}},
+		CacheMaxAge:     maxAge,
+	}
+	m.DB = m.CachingDB(db)
+	return m, db
+}
+
+func repoURL(t *testing.T, m *MultitenantInstancer) string {
+	parts, err := m.parts(testInstance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parts.repo.URL
+}
+
+func TestCacheUsed(t *testing.T) {
+	m, db := newCachingInstancer(time.Minute)
+	repoURL(t, m)
+	repoURL(t, m)
+	if n := db.readCount(); n != 1 {
+		t.Errorf("expected the config to be read once, got %d", n)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	m, db := newCachingInstancer(10 * time.Millisecond)
+	repoURL(t, m)
+	// Updated behind the instancer's back, so it only sees the
+	// change once what it has cached is too old.
+	db.UpdateConfig(testInstance, setRepoURL("git@example.com:second"))
+	if url := repoURL(t, m); url != "git@example.com:first" {
+		t.Errorf("expected the cached config to be used, got %q", url)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if url := repoURL(t, m); url != "git@example.com:second" {
+		t.Errorf("expected the config to be read again once the cache was too old, got %q", url)
+	}
+}
+
+func TestCacheInvalidatedByUpdate(t *testing.T) {
+	m, _ := newCachingInstancer(time.Minute)
+	repoURL(t, m)
+	if err := m.DB.UpdateConfig(testInstance, setRepoURL("git@example.com:second")); err != nil {
+		t.Fatal(err)
+	}
+	if url := repoURL(t, m); url != "git@example.com:second" {
+		t.Errorf("expected an update to be seen straight away, got %q", url)
+	}
+}
+
+func TestCacheInvalidatedDuringRead(t *testing.T) {
+	m, db := newCachingInstancer(time.Minute)
+	// The config is updated after it's read, but before what's made
+	// from it would be cached.
+	db.reading = func(Config) {
+		db.reading = nil
+		m.DB.UpdateConfig(testInstance, setRepoURL("git@example.com:second"))
+	}
+	if url := repoURL(t, m); url != "git@example.com:first" {
+		t.Fatalf("expected the config as read, got %q", url)
+	}
+	if url := repoURL(t, m); url != "git@example.com:second" {
+		t.Errorf("expected the config read before the update not to be cached, got %q", url)
+	}
+}
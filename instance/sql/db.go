@@ -27,55 +27,111 @@ func New(driver, datasource string) (*DB, error) {
 	return db, db.sanityCheck()
 }
 
+// How many times to try an update, when the config keeps being
+// changed underneath it.
+const maxUpdateAttempts = 3
+
+// errRaced means the config was changed between being read and being
+// written.
+var errRaced = errors.New("config changed during update")
+
 func (db *DB) UpdateConfig(inst flux.InstanceID, update instance.UpdateFunc) error {
+	var version int64
+	for i := 0; i < maxUpdateAttempts; i++ {
+		var err error
+		version, err = db.updateConfig(inst, update)
+		if err != errRaced {
+			return err
+		}
+	}
+	conflict := &instance.ConflictError{Instance: inst, Expected: version}
+	if current, err := db.GetConfig(inst); err == nil {
+		conflict.Actual = current.Version
+	}
+	return conflict
+}
+
+// updateConfig reads the config, applies the update, and writes the
+// result, as long as the config is still at the version read; if
+// not, it returns errRaced (along with the version read).
+func (db *DB) updateConfig(inst flux.InstanceID, update instance.UpdateFunc) (int64, error) {
 	tx, err := db.conn.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	var (
 		currentConfig instance.Config
 		confString    string
+		version       sql.NullInt64
+		exists        bool
 	)
-	switch tx.QueryRow(`SELECT config FROM config WHERE instance = $1`, string(inst)).Scan(&confString) {
+	switch err = tx.QueryRow(`SELECT config, version FROM config WHERE instance = $1`, string(inst)).Scan(&confString, &version); err {
 	case sql.ErrNoRows:
 		currentConfig = instance.MakeConfig()
 	case nil:
+		exists = true
 		if err = json.Unmarshal([]byte(confString), &currentConfig); err != nil {
-			return err
+			tx.Rollback()
+			return 0, err
 		}
+		currentConfig.Version = version.Int64
 	default:
-		return err
+		tx.Rollback()
+		return 0, err
 	}
 
 	newConfig, err := update(currentConfig)
 	if err != nil {
 		err2 := tx.Rollback()
 		if err2 != nil {
-			return errors.Wrapf(err, "transaction rollback failed: %s", err2)
+			return 0, errors.Wrapf(err, "transaction rollback failed: %s", err2)
 		}
-		return err
+		return currentConfig.Version, err
 	}
 
 	newConfigBytes, err := json.Marshal(newConfig)
 	if err != nil {
-		return err
+		tx.Rollback()
+		return 0, err
 	}
 
-	_, err = tx.Exec(`DELETE FROM config WHERE instance = $1`, string(inst))
-	if err == nil {
-		_, err = tx.Exec(`INSERT INTO config (instance, config, stamp) VALUES
-                       ($1, $2, now())`, string(inst), string(newConfigBytes))
+	if !exists {
+		_, err = tx.Exec(`INSERT INTO config (instance, config, stamp, version) VALUES
+                       ($1, $2, now(), 1)`, string(inst), string(newConfigBytes))
+	} else {
+		// Only write if nothing else has since; rows from before
+		// there were versions have none.
+		var res sql.Result
+		if version.Valid {
+			res, err = tx.Exec(`UPDATE config SET config = $2, stamp = now(), version = $3
+                           WHERE instance = $1 AND version = $4`, string(inst), string(newConfigBytes), version.Int64+1, version.Int64)
+		} else {
+			res, err = tx.Exec(`UPDATE config SET config = $2, stamp = now(), version = $3
+                           WHERE instance = $1 AND version IS NULL`, string(inst), string(newConfigBytes), int64(1))
+		}
+		if err == nil {
+			var n int64
+			if n, err = res.RowsAffected(); err == nil && n == 0 {
+				tx.Rollback()
+				return currentConfig.Version, errRaced
+			}
+		}
 	}
 	if err == nil {
 		err = tx.Commit()
+	} else {
+		tx.Rollback()
 	}
-	return err
+	return currentConfig.Version, err
 }
 
 func (db *DB) GetConfig(inst flux.InstanceID) (instance.Config, error) {
-	var c string
-	err := db.conn.QueryRow(`SELECT config FROM config WHERE instance = $1`, string(inst)).Scan(&c)
+	var (
+		c       string
+		version sql.NullInt64
+	)
+	err := db.conn.QueryRow(`SELECT config, version FROM config WHERE instance = $1`, string(inst)).Scan(&c, &version)
 	switch err {
 	case nil:
 		break
@@ -85,11 +141,15 @@ func (db *DB) GetConfig(inst flux.InstanceID) (instance.Config, error) {
 		return instance.Config{}, err
 	}
 	var conf instance.Config
-	return conf, json.Unmarshal([]byte(c), &conf)
+	if err := json.Unmarshal([]byte(c), &conf); err != nil {
+		return instance.Config{}, err
+	}
+	conf.Version = version.Int64
+	return conf, nil
 }
 
 func (db *DB) All() ([]instance.NamedConfig, error) {
-	rows, err := db.conn.Query(`SELECT instance, config FROM config`)
+	rows, err := db.conn.Query(`SELECT instance, config, version FROM config`)
 	if err != nil {
 		return nil, err
 	}
@@ -98,12 +158,14 @@ func (db *DB) All() ([]instance.NamedConfig, error) {
 	for rows.Next() {
 		var (
 			id, confStr string
+			version     sql.NullInt64
 			conf        instance.Config
 		)
-		err = rows.Scan(&id, &confStr)
+		err = rows.Scan(&id, &confStr, &version)
 		if err == nil {
 			err = json.Unmarshal([]byte(confStr), &conf)
 		}
+		conf.Version = version.Int64
 		if err != nil {
 			return nil, err
 		}
@@ -119,7 +181,7 @@ func (db *DB) All() ([]instance.NamedConfig, error) {
 // ---
 
 func (db *DB) sanityCheck() error {
-	_, err := db.conn.Query(`SELECT instance, config, stamp FROM config LIMIT 1`)
+	_, err := db.conn.Query(`SELECT instance, config, stamp, version FROM config LIMIT 1`)
 	if err != nil {
 		return errors.Wrap(err, "failed sanity check for config table")
 	}
@@ -102,3 +102,36 @@ func TestUpdateRollback(t *testing.T) {
 		t.Fatalf("expected service config %#v, got %#v", c.Services[service], c1.Services[service])
 	}
 }
+
+func TestUpdateVersion(t *testing.T) {
+	inst := flux.InstanceID("floaty-womble-abc123")
+	db := newDB(t)
+
+	setAutomated := func(c instance.Config) (instance.Config, error) {
+		c.Services[flux.MakeServiceID("namespace", "service")] = instance.ServiceConfig{Automated: true}
+		return c, nil
+	}
+	if err := db.UpdateConfig(inst, setAutomated); err != nil {
+		t.Fatal(err)
+	}
+	c, err := db.GetConfig(inst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != 1 {
+		t.Fatalf("expected version 1 after first update, got %d", c.Version)
+	}
+
+	if err := db.UpdateConfig(inst, instance.IfVersion(inst, c.Version, setAutomated)); err != nil {
+		t.Fatal(err)
+	}
+	// Now the version read before is stale
+	err = db.UpdateConfig(inst, instance.IfVersion(inst, c.Version, setAutomated))
+	conflict, ok := err.(*instance.ConflictError)
+	if !ok {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	if conflict.Expected != 1 || conflict.Actual != 2 {
+		t.Errorf("expected conflict between versions 1 and 2, got %+v", conflict)
+	}
+}
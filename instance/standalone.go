@@ -22,6 +22,7 @@ type StandaloneInstancer struct {
 	GitRepo      git.Repo
 	EventReader  history.EventReader
 	EventWriter  history.EventWriter
+	Releases     history.ImageReleaseReadWriter
 	BaseLogger   log.Logger
 	BaseDuration metrics.Histogram
 }
@@ -43,5 +44,7 @@ func (s StandaloneInstancer) Get(inst flux.InstanceID) (*Instance, error) {
 		s.BaseDuration,
 		s.EventReader,
 		s.EventWriter,
+		s.Releases,
+		history.NopAnnotator{},
 	), nil
 }
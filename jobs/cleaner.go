@@ -7,21 +7,51 @@ import (
 )
 
 type Cleaner struct {
-	store  JobStore
-	logger log.Logger
+	store   JobStore
+	logger  log.Logger
+	metrics CleanerMetrics
+	queues  map[string]struct{}
 }
 
-func NewCleaner(store JobStore, logger log.Logger) *Cleaner {
+func NewCleaner(store JobStore, logger log.Logger, metrics CleanerMetrics) *Cleaner {
 	return &Cleaner{
-		store:  store,
-		logger: logger,
+		store:   store,
+		logger:  logger,
+		metrics: metrics,
+		queues:  map[string]struct{}{},
 	}
 }
 
 func (c *Cleaner) Clean(tick <-chan time.Time) {
-	for range tick {
+	for now := range tick {
 		if err := c.store.GC(); err != nil {
 			c.logger.Log("err", err)
 		}
+		c.reportQueues(now)
+	}
+}
+
+// reportQueues updates the queue gauges. Queues which have been seen
+// before but are now empty are reported as such, rather than keeping
+// their last value.
+func (c *Cleaner) reportQueues(now time.Time) {
+	stats, err := c.store.QueueStats()
+	if err != nil {
+		c.logger.Log("err", err)
+		return
+	}
+	empty := map[string]struct{}{}
+	for queue := range c.queues {
+		empty[queue] = struct{}{}
+	}
+	for _, stat := range stats {
+		c.queues[stat.Queue] = struct{}{}
+		delete(empty, stat.Queue)
+		c.metrics.QueueDepth.With(LabelQueue, stat.Queue).Set(float64(stat.Depth))
+		c.metrics.OldestQueuedAge.With(LabelQueue, stat.Queue).Set(now.Sub(stat.Oldest).Seconds())
+	}
+	for queue := range empty {
+		c.metrics.QueueDepth.With(LabelQueue, queue).Set(0)
+		c.metrics.OldestQueuedAge.With(LabelQueue, queue).Set(0)
 	}
 }
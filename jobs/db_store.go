@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
@@ -11,13 +12,18 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/guid"
 )
 
 // DatabaseStore is a job store backed by a sql.DB.
 type DatabaseStore struct {
-	conn   dbProxy
-	oldest time.Duration
-	now    func(dbProxy) (time.Time, error)
+	conn      dbProxy
+	retention RetentionPolicy
+	archiver  Archiver
+	owner     string
+	lease     time.Duration
+	now       func(dbProxy) (time.Time, error)
+	lockClaim func(dbProxy) error
 }
 
 type dbProxy interface {
@@ -27,17 +33,37 @@ type dbProxy interface {
 	Prepare(query string) (*sql.Stmt, error)
 }
 
+// Ping checks the database can be reached.
+func (s *DatabaseStore) Ping() error {
+	if p, ok := s.conn.(interface {
+		Ping() error
+	}); ok {
+		return p.Ping()
+	}
+	return nil
+}
+
 // NewDatabaseStore returns a usable DatabaseStore.
-// The DB should have a jobs table.
-func NewDatabaseStore(driver, datasource string, oldest time.Duration) (*DatabaseStore, error) {
+// The DB should have a jobs table. Jobs removed by GC are handed to
+// the archiver first, if it is not nil.
+//
+// Several stores (e.g., in replicas of the service) can share a
+// database. A job claimed by one store is leased to it for the
+// duration given; if it's not heartbeated within that time, the job
+// is assumed to have been abandoned, and can be claimed by another.
+func NewDatabaseStore(driver, datasource string, retention RetentionPolicy, archiver Archiver, lease time.Duration) (*DatabaseStore, error) {
 	conn, err := sql.Open(driver, datasource)
 	if err != nil {
 		return nil, err
 	}
 	s := &DatabaseStore{
-		conn:   conn,
-		oldest: oldest,
-		now:    nowFor(driver),
+		conn:      conn,
+		retention: retention,
+		archiver:  archiver,
+		owner:     newOwnerID(),
+		lease:     lease,
+		now:       nowFor(driver),
+		lockClaim: claimLockFor(driver),
 	}
 	return s, s.sanityCheck()
 }
@@ -52,6 +78,7 @@ func (s *DatabaseStore) GetJob(inst flux.InstanceID, id JobID) (Job, error) {
 		key         string
 		submittedAt time.Time
 		claimedAt   nullTime
+		claimedBy   sql.NullString
 		heartbeatAt nullTime
 		finishedAt  nullTime
 		logStr      string
@@ -60,13 +87,13 @@ func (s *DatabaseStore) GetJob(inst flux.InstanceID, id JobID) (Job, error) {
 		success     sql.NullBool
 	)
 	if err := s.conn.QueryRow(`
-		SELECT queue, method, params, scheduled_at, priority, key, submitted_at, claimed_at, heartbeat_at, finished_at, log, status, done, success
+		SELECT queue, method, params, scheduled_at, priority, key, submitted_at, claimed_at, claimed_by, heartbeat_at, finished_at, log, status, done, success
 		  FROM jobs
 		 WHERE id = $1
 		   AND instance_id = $2
 	`, string(id), string(inst)).Scan(
 		&queue, &method, &paramsBytes, &scheduledAt, &priority, &key, &submittedAt,
-		&claimedAt, &heartbeatAt, &finishedAt, &logStr, &status, &done, &success,
+		&claimedAt, &claimedBy, &heartbeatAt, &finishedAt, &logStr, &status, &done, &success,
 	); err == sql.ErrNoRows {
 		return Job{}, ErrNoSuchJob
 	} else if err != nil {
@@ -78,7 +105,7 @@ func (s *DatabaseStore) GetJob(inst flux.InstanceID, id JobID) (Job, error) {
 		return Job{}, errors.Wrap(err, "unmarshaling params")
 	}
 
-	var log []string
+	var log []LogEntry
 	if err := json.NewDecoder(strings.NewReader(logStr)).Decode(&log); err != nil {
 		return Job{}, errors.Wrap(err, "unmarshaling log")
 	}
@@ -94,6 +121,7 @@ func (s *DatabaseStore) GetJob(inst flux.InstanceID, id JobID) (Job, error) {
 		Key:         key,
 		Submitted:   submittedAt,
 		Claimed:     claimedAt.Time,
+		ClaimedBy:   claimedBy.String,
 		Heartbeat:   heartbeatAt.Time,
 		Finished:    finishedAt.Time,
 		Log:         log,
@@ -103,6 +131,119 @@ func (s *DatabaseStore) GetJob(inst flux.InstanceID, id JobID) (Job, error) {
 	}, nil
 }
 
+func (s *DatabaseStore) RecentJobs(inst flux.InstanceID, n int) ([]Job, error) {
+	rows, err := s.conn.Query(`
+		SELECT id
+		  FROM jobs
+		 WHERE instance_id = $1
+		 ORDER BY submitted_at DESC
+	`, string(inst))
+	if err != nil {
+		return nil, errors.Wrap(err, "querying recent jobs")
+	}
+	var ids []JobID
+	for rows.Next() && len(ids) < n {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, JobID(id))
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+
+	jobs := make([]Job, 0, len(ids))
+	for _, id := range ids {
+		job, err := s.GetJob(inst, id)
+		if err == ErrNoSuchJob { // GC'd in the meantime
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (s *DatabaseStore) ListJobs(inst flux.InstanceID, q JobQuery) (JobPage, error) {
+	if err := q.Validate(); err != nil {
+		return JobPage{}, err
+	}
+	query := `
+		SELECT id
+		  FROM jobs
+		 WHERE instance_id = $1`
+	args := []interface{}{string(inst)}
+	where := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		query += "\n\t\t   AND " + strings.Replace(cond, "?", fmt.Sprintf("$%d", len(args)), -1)
+	}
+	if q.Method != "" {
+		where("method = ?", q.Method)
+	}
+	if !q.Since.IsZero() {
+		where("submitted_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		where("submitted_at < ?", q.Until)
+	}
+	if q.Cursor != "" {
+		cursor, err := parseJobCursor(q.Cursor)
+		if err != nil {
+			return JobPage{}, err
+		}
+		where("submitted_at <= ?", cursor.submitted)
+		// Those submitted at the same time as the last listed come
+		// after it, by ID
+		where(fmt.Sprintf("(submitted_at < $%d OR id < ?)", len(args)), string(cursor.id))
+	}
+	query += `
+		 ORDER BY submitted_at DESC, id DESC`
+
+	rows, err := s.conn.Query(query, args...)
+	if err != nil {
+		return JobPage{}, errors.Wrap(err, "querying jobs")
+	}
+	var ids []JobID
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return JobPage{}, err
+		}
+		ids = append(ids, JobID(id))
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return JobPage{}, err
+	}
+	rows.Close()
+
+	page := JobPage{Jobs: []Job{}}
+	for _, id := range ids {
+		job, err := s.GetJob(inst, id)
+		if err == ErrNoSuchJob { // GC'd in the meantime
+			continue
+		} else if err != nil {
+			return JobPage{}, err
+		}
+		if !q.matches(job) {
+			continue
+		}
+		if len(page.Jobs) == q.limit() {
+			last := page.Jobs[len(page.Jobs)-1]
+			page.Next = jobCursor{submitted: last.Submitted, id: last.ID}.String()
+			break
+		}
+		page.Jobs = append(page.Jobs, job)
+	}
+	return page, nil
+}
+
 // PutJobIgnoringDuplicates schedules a job to run. Key field and any
 // duplicates are ignored.
 func (s *DatabaseStore) PutJobIgnoringDuplicates(inst flux.InstanceID, job Job) (JobID, error) {
@@ -183,17 +324,25 @@ func (s *DatabaseStore) PutJob(inst flux.InstanceID, job Job) (JobID, error) {
 }
 
 // Take the next job from specified queues. If queues is nil, all queues are
-// used.
+// used. Jobs which were claimed, but whose lease has expired, are
+// available to be claimed again.
 func (s *DatabaseStore) NextJob(queues []string) (Job, error) {
 	if len(queues) == 0 {
 		queues = []string{DefaultQueue}
 	}
 	var job Job
 	err := s.Transaction(func(s *DatabaseStore) error {
+		// Serialise claims among all stores using the database, so
+		// the check for in-progress jobs below sees any claims made
+		// concurrently elsewhere.
+		if err := s.lockClaim(s.conn); err != nil {
+			return errors.Wrap(err, "locking job queue")
+		}
 		now, err := s.now(s.conn)
 		if err != nil {
 			return errors.Wrap(err, "getting current time")
 		}
+		leaseExpiry := now.Add(-s.lease)
 		var (
 			instanceID  string
 			jobID       string
@@ -205,6 +354,7 @@ func (s *DatabaseStore) NextJob(queues []string) (Job, error) {
 			key         string
 			submittedAt time.Time
 			claimedAt   nullTime
+			claimedBy   sql.NullString
 			heartbeatAt nullTime
 			finishedAt  nullTime
 			logStr      string
@@ -215,16 +365,18 @@ func (s *DatabaseStore) NextJob(queues []string) (Job, error) {
 		query, args, err := sqlx.In(`
 			SELECT instance_id, id, queue, method, params,
 						 scheduled_at, priority, key, submitted_at,
-						 claimed_at, heartbeat_at, finished_at, log, status,
+						 claimed_at, claimed_by, heartbeat_at, finished_at, log, status,
 						 done, success
 			FROM jobs
 
 			-- Scope it to our selected queues
 			WHERE queue IN (?)
 
-			-- Only unclaimed/unfinished jobs are available
-			AND claimed_at IS NULL
+			-- Only unfinished jobs, which are unclaimed or whose lease
+			-- has expired, are available
 			AND finished_at IS NULL
+			AND (claimed_at IS NULL
+			     OR (claimed_at < ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)))
 
 			-- Don't make jobs available until after they are scheduled
 			AND scheduled_at <= ?
@@ -236,6 +388,7 @@ func (s *DatabaseStore) NextJob(queues []string) (Job, error) {
 				WHERE queue IN (?)
 				AND claimed_at IS NOT NULL
 				AND finished_at IS NULL
+				AND (claimed_at >= ? OR heartbeat_at >= ?)
 				GROUP BY instance_id
 			)
 
@@ -244,8 +397,12 @@ func (s *DatabaseStore) NextJob(queues []string) (Job, error) {
 			ORDER BY (-1 * priority), scheduled_at, submitted_at
 			LIMIT 1`,
 			queues,
+			leaseExpiry,
+			leaseExpiry,
 			now,
 			queues,
+			leaseExpiry,
+			leaseExpiry,
 		)
 		if err != nil {
 			return errors.Wrap(err, "dequeueing next job")
@@ -262,6 +419,7 @@ func (s *DatabaseStore) NextJob(queues []string) (Job, error) {
 			&key,
 			&submittedAt,
 			&claimedAt,
+			&claimedBy,
 			&heartbeatAt,
 			&finishedAt,
 			&logStr,
@@ -279,10 +437,20 @@ func (s *DatabaseStore) NextJob(queues []string) (Job, error) {
 			return errors.Wrap(err, "unmarshaling params")
 		}
 
-		var log []string
+		var log []LogEntry
 		if err := json.NewDecoder(strings.NewReader(logStr)).Decode(&log); err != nil {
 			return errors.Wrap(err, "unmarshaling log")
 		}
+		if claimedAt.Valid {
+			log = truncateLog(append(log, LogEntry{
+				Level:   LogWarn,
+				Message: fmt.Sprintf("Lease held by %s expired; job taken over by %s.", claimedBy.String, s.owner),
+			}), MaxLogEntries)
+		}
+		logBytes, err := json.Marshal(log)
+		if err != nil {
+			return errors.Wrap(err, "marshaling log")
+		}
 
 		job = Job{
 			Instance:    flux.InstanceID(instanceID),
@@ -294,8 +462,8 @@ func (s *DatabaseStore) NextJob(queues []string) (Job, error) {
 			Priority:    priority,
 			Key:         key,
 			Submitted:   submittedAt,
-			Claimed:     claimedAt.Time,
-			Heartbeat:   heartbeatAt.Time,
+			Claimed:     now,
+			ClaimedBy:   s.owner,
 			Finished:    finishedAt.Time,
 			Log:         log,
 			Status:      status,
@@ -303,15 +471,21 @@ func (s *DatabaseStore) NextJob(queues []string) (Job, error) {
 			Success:     success.Bool,
 		}
 
+		// Another worker may have claimed the job since we selected
+		// it; if so, there's nothing for us this time around.
 		if res, err := s.conn.Exec(`
 			UPDATE jobs
-				 SET claimed_at = $1
-			 WHERE id = $2
-				 AND instance_id = $3
-		`, now, jobID, instanceID); err != nil {
+				 SET claimed_at = $1, claimed_by = $2, heartbeat_at = NULL, log = $3
+			 WHERE id = $4
+				 AND instance_id = $5
+				 AND (claimed_at IS NULL
+				      OR (claimed_at < $6 AND (heartbeat_at IS NULL OR heartbeat_at < $6)))
+		`, now, s.owner, string(logBytes), jobID, instanceID, leaseExpiry); err != nil {
 			return errors.Wrap(err, "marking job as claimed")
 		} else if n, err := res.RowsAffected(); err != nil {
 			return errors.Wrap(err, "after update, checking affected rows")
+		} else if n == 0 {
+			return ErrNoJobAvailable
 		} else if n != 1 {
 			return errors.Errorf("wanted to affect 1 row; affected %d", n)
 		}
@@ -349,6 +523,26 @@ func (s *DatabaseStore) UpdateJob(job Job) error {
 	}
 
 	return s.Transaction(func(s *DatabaseStore) error {
+		// If the job has been claimed, only the claimant may update
+		// it; otherwise, a worker that has lost its lease could
+		// overwrite the progress of the worker that took over.
+		if job.ClaimedBy != "" {
+			var claimedBy sql.NullString
+			if err := s.conn.QueryRow(`
+				SELECT claimed_by
+				  FROM jobs
+				 WHERE id = $1
+				   AND instance_id = $2
+			`, string(job.ID), string(job.Instance)).Scan(&claimedBy); err == sql.ErrNoRows {
+				return ErrNoSuchJob
+			} else if err != nil {
+				return errors.Wrap(err, "checking job claim")
+			}
+			if claimedBy.String != job.ClaimedBy {
+				return ErrJobClaimLost
+			}
+		}
+
 		if res, err := s.conn.Exec(`
 			UPDATE jobs
 				 SET params = $1, log = $2, status = $3
@@ -386,17 +580,54 @@ func (s *DatabaseStore) UpdateJob(job Job) error {
 	})
 }
 
+// Unclaim saves the job's progress, and gives up the claim on it, so
+// that it's available to be picked up again straight away (e.g., by
+// another replica, when shutting down).
+func (s *DatabaseStore) Unclaim(job Job) error {
+	paramsBytes, err := json.Marshal(job.Params)
+	if err != nil {
+		return errors.Wrap(err, "marshaling params")
+	}
+	logBytes, err := json.Marshal(job.Log)
+	if err != nil {
+		return errors.Wrap(err, "marshaling log")
+	}
+
+	return s.Transaction(func(s *DatabaseStore) error {
+		if res, err := s.conn.Exec(`
+			UPDATE jobs
+				 SET params = $1, log = $2, status = $3,
+				     claimed_at = NULL, claimed_by = NULL, heartbeat_at = NULL
+			 WHERE id = $4
+				 AND instance_id = $5
+				 AND claimed_by = $6
+				 AND finished_at IS NULL
+		`, string(paramsBytes), string(logBytes), job.Status, string(job.ID), string(job.Instance), job.ClaimedBy); err != nil {
+			return errors.Wrap(err, "unclaiming job in database")
+		} else if n, err := res.RowsAffected(); err != nil {
+			return errors.Wrap(err, "after unclaim, checking affected rows")
+		} else if n == 0 {
+			return ErrJobClaimLost
+		} else if n > 1 {
+			return errors.Errorf("unclaiming job affected %d rows; wanted 1", n)
+		}
+		return nil
+	})
+}
+
 func (s *DatabaseStore) Heartbeat(id JobID) error {
 	return s.Transaction(func(s *DatabaseStore) error {
 		now, err := s.now(s.conn)
 		if err != nil {
 			return errors.Wrap(err, "getting current time")
 		}
+		// Only the current claimant can keep the lease alive.
 		if res, err := s.conn.Exec(`
 			UPDATE jobs
 			SET heartbeat_at = $1
 			WHERE id = $2
-		`, now, string(id)); err != nil {
+			AND claimed_by = $3
+		`, now, string(id), s.owner); err != nil {
 			return errors.Wrap(err, "heartbeating job in database")
 		} else if n, err := res.RowsAffected(); err != nil {
 			return errors.Wrap(err, "after heartbeat, checking affected rows")
@@ -409,6 +640,8 @@ func (s *DatabaseStore) Heartbeat(id JobID) error {
 	})
 }
 
+// GC removes jobs which are no longer needed according to the
+// retention policy, archiving them first if there is an archiver.
 func (s *DatabaseStore) GC() error {
 	// Take current time from the DB. Use the helper function to accommodate
 	// for non-portable time functions/queries across different DBs :(
@@ -418,19 +651,159 @@ func (s *DatabaseStore) GC() error {
 			return errors.Wrap(err, "getting current time")
 		}
 
-		if _, err := s.conn.Exec(`
-			DELETE FROM jobs
-						WHERE (finished_at IS NOT NULL AND submitted_at < $1)
-						   OR (claimed_at IS NOT NULL
-							 AND claimed_at < $1
-							 AND (heartbeat_at IS NULL OR heartbeat_at < $1))
-		`, now.Add(-s.oldest)); err != nil {
-			return errors.Wrap(err, "deleting old jobs")
+		expired, err := s.expiredJobs(now)
+		if err != nil {
+			return err
+		}
+		if len(expired) == 0 {
+			return nil
+		}
+
+		if s.archiver != nil {
+			var archive []Job
+			for _, ref := range expired {
+				job, err := s.GetJob(ref.instance, ref.id)
+				if err != nil {
+					return errors.Wrapf(err, "fetching job %s to archive", ref.id)
+				}
+				archive = append(archive, job)
+			}
+			if err := s.archiver.Archive(archive); err != nil {
+				return errors.Wrap(err, "archiving old jobs")
+			}
+		}
+
+		for _, ref := range expired {
+			if _, err := s.conn.Exec(`
+				DELETE FROM jobs
+				 WHERE id = $1
+				   AND instance_id = $2
+			`, string(ref.id), string(ref.instance)); err != nil {
+				return errors.Wrap(err, "deleting old jobs")
+			}
 		}
 		return nil
 	})
 }
 
+type jobRef struct {
+	instance flux.InstanceID
+	id       JobID
+}
+
+// expiredJobs finds the jobs that have outlived the retention policy:
+// finished jobs that are too old, or beyond the maximum count for
+// their instance; and claimed jobs that have stopped heartbeating.
+func (s *DatabaseStore) expiredJobs(now time.Time) ([]jobRef, error) {
+	var (
+		expired []jobRef
+		seen    = map[jobRef]struct{}{}
+	)
+	add := func(ref jobRef) {
+		if _, ok := seen[ref]; !ok {
+			seen[ref] = struct{}{}
+			expired = append(expired, ref)
+		}
+	}
+
+	rows, err := s.conn.Query(`
+		SELECT instance_id, id
+		  FROM jobs
+		 WHERE (finished_at IS NOT NULL AND submitted_at < $1)
+		    OR (claimed_at IS NOT NULL
+		        AND claimed_at < $1
+		        AND (heartbeat_at IS NULL OR heartbeat_at < $1))
+	`, now.Add(-s.retention.MaxAge))
+	if err != nil {
+		return nil, errors.Wrap(err, "finding old jobs")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var instanceID, jobID string
+		if err := rows.Scan(&instanceID, &jobID); err != nil {
+			return nil, errors.Wrap(err, "finding old jobs")
+		}
+		add(jobRef{flux.InstanceID(instanceID), JobID(jobID)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "finding old jobs")
+	}
+
+	if s.retention.MaxCount <= 0 {
+		return expired, nil
+	}
+
+	finished, err := s.conn.Query(`
+		SELECT instance_id, id
+		  FROM jobs
+		 WHERE finished_at IS NOT NULL
+		 ORDER BY finished_at DESC
+	`)
+	if err != nil {
+		return nil, errors.Wrap(err, "counting finished jobs")
+	}
+	defer finished.Close()
+	counts := map[flux.InstanceID]int{}
+	for finished.Next() {
+		var instanceID, jobID string
+		if err := finished.Scan(&instanceID, &jobID); err != nil {
+			return nil, errors.Wrap(err, "counting finished jobs")
+		}
+		inst := flux.InstanceID(instanceID)
+		counts[inst]++
+		if counts[inst] > s.retention.MaxCount {
+			add(jobRef{inst, JobID(jobID)})
+		}
+	}
+	return expired, errors.Wrap(finished.Err(), "counting finished jobs")
+}
+
+// QueueStats reports how many jobs are waiting in each queue, and for
+// how long the oldest has been waiting.
+func (s *DatabaseStore) QueueStats() ([]QueueStat, error) {
+	rows, err := s.conn.Query(`
+		SELECT queue, scheduled_at
+		  FROM jobs
+		 WHERE claimed_at IS NULL
+		   AND finished_at IS NULL
+	`)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying queued jobs")
+	}
+	defer rows.Close()
+
+	stats := map[string]*QueueStat{}
+	var queues []string
+	for rows.Next() {
+		var (
+			queue       string
+			scheduledAt time.Time
+		)
+		if err := rows.Scan(&queue, &scheduledAt); err != nil {
+			return nil, errors.Wrap(err, "scanning queued jobs")
+		}
+		stat, ok := stats[queue]
+		if !ok {
+			stat = &QueueStat{Queue: queue}
+			stats[queue] = stat
+			queues = append(queues, queue)
+		}
+		stat.Depth++
+		if stat.Oldest.IsZero() || scheduledAt.Before(stat.Oldest) {
+			stat.Oldest = scheduledAt
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "scanning queued jobs")
+	}
+
+	res := make([]QueueStat, len(queues))
+	for i, queue := range queues {
+		res[i] = *stats[queue]
+	}
+	return res, nil
+}
+
 func (s *DatabaseStore) sanityCheck() error {
 	_, err := s.conn.Query(`SELECT id FROM jobs LIMIT 1`)
 	if err != nil {
@@ -450,9 +823,13 @@ func (s *DatabaseStore) Transaction(f func(*DatabaseStore) error) error {
 		return err
 	}
 	err = f(&DatabaseStore{
-		conn:   tx,
-		oldest: s.oldest,
-		now:    s.now,
+		conn:      tx,
+		retention: s.retention,
+		archiver:  s.archiver,
+		owner:     s.owner,
+		lease:     s.lease,
+		now:       s.now,
+		lockClaim: s.lockClaim,
 	})
 	if err != nil {
 		// Rollback error is ignored as we already have an error in progress
@@ -481,6 +858,35 @@ func (n *nullTime) Scan(value interface{}) error {
 	return nil
 }
 
+// claimLockFor returns a func which takes a lock, for the duration of
+// the current transaction, shared by everyone claiming jobs. ql
+// databases can only be used by one process, and serialise
+// transactions anyway, so there's nothing to do there.
+func claimLockFor(driver string) func(dbProxy) error {
+	switch driver {
+	case "ql", "ql-mem":
+		return func(dbProxy) error { return nil }
+	default:
+		return func(conn dbProxy) error {
+			_, err := conn.Exec("SELECT pg_advisory_xact_lock($1)", claimLockKey)
+			return err
+		}
+	}
+}
+
+// An arbitrary key for the advisory lock taken when claiming jobs.
+const claimLockKey = 0x666c7578 // "flux"
+
+// newOwnerID makes an identifier for a store, to record against the
+// jobs it claims.
+func newOwnerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + "/" + guid.New()
+}
+
 func nowFor(driver string) func(dbProxy) (time.Time, error) {
 	switch driver {
 	case "ql", "ql-mem":
@@ -48,7 +48,7 @@ func Setup(t *testing.T) *DatabaseStore {
 		t.Fatal(err)
 	}
 
-	db, err := NewDatabaseStore(db.DriverForScheme(u.Scheme), *databaseSource, 1*time.Minute)
+	db, err := NewDatabaseStore(db.DriverForScheme(u.Scheme), *databaseSource, RetentionPolicy{MaxAge: 1 * time.Minute}, nil, 10*time.Second)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -181,13 +181,12 @@ func TestDatabaseStore(t *testing.T) {
 
 	// Update the job
 	newStatus := "Being used in testing"
-	interactiveJob.Status = newStatus
-	interactiveJob.Log = append(interactiveJob.Log, newStatus)
+	interactiveJob.Logf(LogInfo, "%s", newStatus)
 	bailIfErr(t, db.UpdateJob(interactiveJob))
 	// - It should have saved the changes
 	interactiveJob, err = db.GetJob(instance, interactiveJobID)
 	bailIfErr(t, err)
-	if interactiveJob.Status != newStatus || len(interactiveJob.Log) != 2 || interactiveJob.Log[1] != interactiveJob.Status {
+	if interactiveJob.Status != newStatus || len(interactiveJob.Log) != 2 || interactiveJob.Log[1].Message != interactiveJob.Status {
 		t.Errorf("expected job to have new log and status")
 	}
 
@@ -507,3 +506,275 @@ func TestDatabaseStoreExpiresHeartbeatedButCrashedJobs(t *testing.T) {
 		t.Errorf("expected ErrNoSuchJob, got %q", err)
 	}
 }
+
+func TestDatabaseStoreKeepsMaxCountFinishedJobs(t *testing.T) {
+	instance := flux.InstanceID("instance")
+	db := Setup(t)
+	defer Cleanup(t, db)
+
+	now := time.Now()
+	db.now = func(_ dbProxy) (time.Time, error) {
+		return now, nil
+	}
+	db.retention.MaxCount = 1
+
+	var ids []JobID
+	for i := 0; i < 3; i++ {
+		id, err := db.PutJob(instance, Job{
+			Method:   ReleaseJob,
+			Params:   ReleaseJobParams{},
+			Priority: PriorityInteractive,
+		})
+		bailIfErr(t, err)
+		ids = append(ids, id)
+
+		job, err := db.NextJob(nil)
+		bailIfErr(t, err)
+		job.Done = true
+		bailIfErr(t, db.UpdateJob(job))
+
+		// Advance time so each job finishes at a different time
+		now = now.Add(time.Second)
+	}
+
+	archived := &memArchiver{}
+	db.archiver = archived
+	bailIfErr(t, db.GC())
+
+	// - Only the most recently finished should remain
+	for _, id := range ids[:2] {
+		if _, err := db.GetJob(instance, id); err != ErrNoSuchJob {
+			t.Errorf("expected ErrNoSuchJob for %s, got %q", id, err)
+		}
+	}
+	_, err := db.GetJob(instance, ids[2])
+	bailIfErr(t, err)
+
+	// - The removed jobs should have been archived
+	if len(archived.jobs) != 2 {
+		t.Errorf("expected 2 archived jobs, got %d", len(archived.jobs))
+	}
+}
+
+func TestDatabaseStoreQueueStats(t *testing.T) {
+	instance := flux.InstanceID("instance")
+	db := Setup(t)
+	defer Cleanup(t, db)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	db.now = func(_ dbProxy) (time.Time, error) {
+		return now, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := db.PutJob(instance, Job{
+			Queue:       "q",
+			Method:      ReleaseJob,
+			Params:      ReleaseJobParams{},
+			ScheduledAt: now.Add(time.Duration(i) * time.Second),
+		})
+		bailIfErr(t, err)
+	}
+
+	stats, err := db.QueueStats()
+	bailIfErr(t, err)
+	if len(stats) != 1 || stats[0].Queue != "q" || stats[0].Depth != 2 {
+		t.Fatalf("unexpected queue stats: %+v", stats)
+	}
+	if !stats[0].Oldest.Equal(now) {
+		t.Errorf("expected oldest job to be scheduled at %s, got %s", now, stats[0].Oldest)
+	}
+}
+
+type memArchiver struct {
+	jobs []Job
+}
+
+func (a *memArchiver) Archive(jobs []Job) error {
+	a.jobs = append(a.jobs, jobs...)
+	return nil
+}
+
+func TestDatabaseStoreTakesOverExpiredLeases(t *testing.T) {
+	instance := flux.InstanceID("instance")
+	db := Setup(t)
+	defer Cleanup(t, db)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	db.now = func(_ dbProxy) (time.Time, error) {
+		return now, nil
+	}
+
+	jobID, err := db.PutJob(instance, Job{
+		Method: ReleaseJob,
+		Params: ReleaseJobParams{},
+	})
+	bailIfErr(t, err)
+
+	// Claim it
+	db.owner = "first"
+	first, err := db.NextJob(nil)
+	bailIfErr(t, err)
+	if first.ID != jobID || first.ClaimedBy != "first" {
+		t.Fatalf("expected job %s claimed by first, got %s claimed by %q", jobID, first.ID, first.ClaimedBy)
+	}
+
+	// While the lease is live, nobody else can claim it
+	db.owner = "second"
+	if _, err := db.NextJob(nil); err != ErrNoJobAvailable {
+		t.Fatalf("expected ErrNoJobAvailable, got %v", err)
+	}
+
+	// After the lease expires, it's taken over
+	now = now.Add(20 * time.Second)
+	second, err := db.NextJob(nil)
+	bailIfErr(t, err)
+	if second.ID != jobID || second.ClaimedBy != "second" {
+		t.Fatalf("expected job %s claimed by second, got %s claimed by %q", jobID, second.ID, second.ClaimedBy)
+	}
+
+	// The original claimant can no longer update the job
+	first.Status = "Complete."
+	if err := db.UpdateJob(first); err != ErrJobClaimLost {
+		t.Fatalf("expected ErrJobClaimLost, got %v", err)
+	}
+	bailIfErr(t, db.UpdateJob(second))
+}
+
+func TestDatabaseStoreUnclaim(t *testing.T) {
+	instance := flux.InstanceID("instance")
+	db := Setup(t)
+	defer Cleanup(t, db)
+
+	jobID, err := db.PutJob(instance, Job{
+		Method: ReleaseJob,
+		Params: ReleaseJobParams{},
+	})
+	bailIfErr(t, err)
+	job, err := db.NextJob(nil)
+	bailIfErr(t, err)
+
+	job.Params = ReleaseJobParams{CompletedActions: []string{"clone"}}
+	job.Status = "Interrupted"
+	bailIfErr(t, db.Unclaim(job))
+
+	// It's available again straight away, with its progress
+	db.owner = "other"
+	resumed, err := db.NextJob(nil)
+	bailIfErr(t, err)
+	if resumed.ID != jobID {
+		t.Fatalf("expected job %s, got %s", jobID, resumed.ID)
+	}
+	if p := resumed.Params.(ReleaseJobParams); len(p.CompletedActions) != 1 || p.CompletedActions[0] != "clone" {
+		t.Errorf("expected progress to be kept, got %#v", p.CompletedActions)
+	}
+
+	// The previous claimant can't unclaim it again
+	if err := db.Unclaim(job); err != ErrJobClaimLost {
+		t.Errorf("expected ErrJobClaimLost, got %v", err)
+	}
+}
+
+func TestDatabaseStoreRecentJobs(t *testing.T) {
+	instance := flux.InstanceID("instance")
+	db := Setup(t)
+	defer Cleanup(t, db)
+
+	for i := 0; i < 3; i++ {
+		_, err := db.PutJob(instance, Job{
+			Method: ReleaseJob,
+			Params: ReleaseJobParams{},
+		})
+		bailIfErr(t, err)
+	}
+	_, err := db.PutJob(flux.InstanceID("other"), Job{
+		Method: ReleaseJob,
+		Params: ReleaseJobParams{},
+	})
+	bailIfErr(t, err)
+
+	recent, err := db.RecentJobs(instance, 2)
+	bailIfErr(t, err)
+	if len(recent) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(recent))
+	}
+	for _, j := range recent {
+		if j.Instance != instance {
+			t.Errorf("expected only jobs for %s, got one for %s", instance, j.Instance)
+		}
+	}
+
+	all, err := db.RecentJobs(instance, 10)
+	bailIfErr(t, err)
+	if len(all) != 3 {
+		t.Errorf("expected 3 jobs, got %d", len(all))
+	}
+}
+
+func TestDatabaseStoreListJobs(t *testing.T) {
+	instance := flux.InstanceID("instance")
+	db := Setup(t)
+	defer Cleanup(t, db)
+
+	for i := 0; i < 5; i++ {
+		user := "alice"
+		if i%2 == 1 {
+			user = "bob"
+		}
+		_, err := db.PutJob(instance, Job{
+			Method: ReleaseJob,
+			Params: ReleaseJobParams{
+				ServiceSpecs: []flux.ServiceSpec{flux.ServiceSpec(fmt.Sprintf("default/service%d", i))},
+				User:         user,
+			},
+		})
+		bailIfErr(t, err)
+	}
+	_, err := db.PutJob(flux.InstanceID("other"), Job{
+		Method: ReleaseJob,
+		Params: ReleaseJobParams{User: "alice"},
+	})
+	bailIfErr(t, err)
+
+	// Page through them all, two at a time
+	seen := map[JobID]bool{}
+	q := JobQuery{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+		page, err := db.ListJobs(instance, q)
+		bailIfErr(t, err)
+		for _, j := range page.Jobs {
+			if seen[j.ID] {
+				t.Errorf("job %s listed twice", j.ID)
+			}
+			seen[j.ID] = true
+		}
+		if page.Next == "" {
+			break
+		}
+		q.Cursor = page.Next
+	}
+	if len(seen) != 5 {
+		t.Errorf("expected 5 jobs, got %d", len(seen))
+	}
+
+	page, err := db.ListJobs(instance, JobQuery{User: "bob"})
+	bailIfErr(t, err)
+	if len(page.Jobs) != 2 || page.Next != "" {
+		t.Errorf("expected 2 jobs by bob and no more, got %d (next %q)", len(page.Jobs), page.Next)
+	}
+
+	page, err = db.ListJobs(instance, JobQuery{Service: "default/service3"})
+	bailIfErr(t, err)
+	if len(page.Jobs) != 1 {
+		t.Errorf("expected 1 job for default/service3, got %d", len(page.Jobs))
+	}
+
+	page, err = db.ListJobs(instance, JobQuery{State: JobStateDone})
+	bailIfErr(t, err)
+	if len(page.Jobs) != 0 {
+		t.Errorf("expected no finished jobs, got %d", len(page.Jobs))
+	}
+}
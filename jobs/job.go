@@ -7,6 +7,7 @@ import (
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/guid"
+	"github.com/weaveworks/flux/platform"
 )
 
 const (
@@ -31,18 +32,27 @@ var (
 	ErrNoJobAvailable   = errors.New("no job available")
 	ErrUnknownJobMethod = errors.New("unknown job method")
 	ErrJobAlreadyQueued = errors.New("job is already queued")
+	ErrJobClaimLost     = errors.New("job has been claimed by another worker")
 )
 
 type JobStore interface {
 	JobReadPusher
 	JobWritePopper
+	Unclaim(Job) error
 	GC() error
+	QueueStats() ([]QueueStat, error)
 }
 
 type JobReadPusher interface {
 	GetJob(flux.InstanceID, JobID) (Job, error)
 	PutJob(flux.InstanceID, Job) (JobID, error)
 	PutJobIgnoringDuplicates(flux.InstanceID, Job) (JobID, error)
+	// RecentJobs gives, at most, the last n jobs submitted for the
+	// instance, most recent first.
+	RecentJobs(_ flux.InstanceID, n int) ([]Job, error)
+	// ListJobs gives a page of the instance's jobs, as asked for,
+	// most recently submitted first.
+	ListJobs(flux.InstanceID, JobQuery) (JobPage, error)
 }
 
 type JobWritePopper interface {
@@ -82,14 +92,15 @@ type Job struct {
 	Key string `json:"key,omitempty"`
 
 	// To be used by the worker
-	Submitted time.Time `json:"submitted"`
-	Claimed   time.Time `json:"claimed,omitempty"`
-	Heartbeat time.Time `json:"heartbeat,omitempty"`
-	Finished  time.Time `json:"finished,omitempty"`
-	Log       []string  `json:"log,omitempty"`
-	Status    string    `json:"status"`
-	Done      bool      `json:"done"`
-	Success   bool      `json:"success"` // only makes sense after done is true
+	Submitted time.Time  `json:"submitted"`
+	Claimed   time.Time  `json:"claimed,omitempty"`
+	ClaimedBy string     `json:"claimed_by,omitempty"`
+	Heartbeat time.Time  `json:"heartbeat,omitempty"`
+	Finished  time.Time  `json:"finished,omitempty"`
+	Log       []LogEntry `json:"log,omitempty"`
+	Status    string     `json:"status"`
+	Done      bool       `json:"done"`
+	Success   bool       `json:"success"` // only makes sense after done is true
 }
 
 func (j *Job) UnmarshalJSON(data []byte) error {
@@ -109,14 +120,15 @@ func (j *Job) UnmarshalJSON(data []byte) error {
 		Key string `json:"key,omitempty"`
 
 		// To be used by the worker
-		Submitted time.Time `json:"submitted"`
-		Claimed   time.Time `json:"claimed,omitempty"`
-		Heartbeat time.Time `json:"heartbeat,omitempty"`
-		Finished  time.Time `json:"finished,omitempty"`
-		Log       []string  `json:"log,omitempty"`
-		Status    string    `json:"status"`
-		Done      bool      `json:"done"`
-		Success   bool      `json:"success"` // only makes sense after done is true
+		Submitted time.Time  `json:"submitted"`
+		Claimed   time.Time  `json:"claimed,omitempty"`
+		ClaimedBy string     `json:"claimed_by,omitempty"`
+		Heartbeat time.Time  `json:"heartbeat,omitempty"`
+		Finished  time.Time  `json:"finished,omitempty"`
+		Log       []LogEntry `json:"log,omitempty"`
+		Status    string     `json:"status"`
+		Done      bool       `json:"done"`
+		Success   bool       `json:"success"` // only makes sense after done is true
 	}
 	if err := json.Unmarshal(data, &wireJob); err != nil {
 		return err
@@ -131,6 +143,7 @@ func (j *Job) UnmarshalJSON(data []byte) error {
 		Key:         wireJob.Key,
 		Submitted:   wireJob.Submitted,
 		Claimed:     wireJob.Claimed,
+		ClaimedBy:   wireJob.ClaimedBy,
 		Heartbeat:   wireJob.Heartbeat,
 		Finished:    wireJob.Finished,
 		Log:         wireJob.Log,
@@ -156,9 +169,122 @@ type ReleaseJobParams struct {
 	ImageSpec    flux.ImageSpec
 	Kind         flux.ReleaseKind
 	Excludes     []flux.ServiceID
+	// ContainerTargets, if given, are the only updates made: each
+	// names a container of a service, and the image it's to run.
+	// Other containers in the same pods are left alone. ServiceSpecs
+	// and ImageSpec are ignored.
+	ContainerTargets []ContainerTarget `json:",omitempty"`
+	// Restart, if set, makes the release restart the services
+	// selected: their definitions are applied as they are, but marked
+	// so their pods are replaced. ImageSpec is ignored.
+	// ScheduledRestart is set for restarts scheduled by a service's
+	// policy, each of which schedules the next.
+	Restart          bool `json:",omitempty"`
+	ScheduledRestart bool `json:",omitempty"`
+	// MigrateImages, if given, makes the release move the images in
+	// all the definitions in the config repo from one registry or
+	// repository to another, and release the services changed.
+	// ServiceSpecs and ImageSpec are ignored.
+	MigrateImages *flux.ImageMigration `json:",omitempty"`
+	// RefuseOnDrift makes the release fail, rather than just report
+	// it, if the environment or resources of a container in the
+	// cluster differ from those in the config repo, e.g., because
+	// someone edited the cluster directly.
+	RefuseOnDrift bool `json:",omitempty"`
+	// ApplyResources makes the release also apply the other
+	// resources (ConfigMaps, Services, and so on) defined in the
+	// config repo. If PruneSelector is given too, resources matching
+	// it which are no longer defined in the config repo are deleted.
+	ApplyResources bool   `json:",omitempty"`
+	PruneSelector  string `json:",omitempty"`
+	// ServerDryRun has the updated definitions checked by the
+	// platform (e.g., by a server-side dry run), where it's able,
+	// before they are committed.
+	ServerDryRun bool `json:",omitempty"`
+	// WaitForRollout makes the release wait until the services are
+	// running the new images before it's finished, for up to
+	// RolloutTimeout (a duration, e.g., "5m") if that's given.
+	WaitForRollout bool   `json:",omitempty"`
+	RolloutTimeout string `json:",omitempty"`
+	// User is who asked for the release, for the record.
+	User string `json:",omitempty"`
+	// ChangeTicket is the ID of the change ticket opened for the
+	// release, if the instance keeps them.
+	ChangeTicket string `json:",omitempty"`
+	// CompletedActions names the kinds of release action which have
+	// been done, each once, in the order first done, if the release
+	// was interrupted part-way through.
+	CompletedActions []string
+	// PushedRevision is the commit the release pushed to the config
+	// repo, once it has, so that another attempt at an interrupted
+	// release can check it's there before carrying on from it.
+	PushedRevision string `json:",omitempty"`
+	// Plan is the serialised release plan. It's filled in by a
+	// planning release. Executing releases are only given one by
+	// flux itself (e.g., while waiting for a change ticket to be
+	// approved), in which case it's run as it is rather than being
+	// recalculated; it's cleared from releases posted to the API.
+	Plan json.RawMessage
+	// PlanJob, if given in an executing release, is the ID of a
+	// planning release which succeeded, whose plan is run as it is
+	// rather than being recalculated; e.g., once it's been approved.
+	PlanJob JobID `json:",omitempty"`
+	// Snapshot, if given, is a recorded state of the platform to plan
+	// the release against, instead of the live platform. Releases
+	// with a snapshot can only be planned.
+	Snapshot *platform.Snapshot `json:",omitempty"`
+	// SelfUpgrade is filled in by a release which upgrades flux's own
+	// services, so the upgrade can be abandoned by hand if need be.
+	SelfUpgrade *SelfUpgradeRecord `json:",omitempty"`
+	// Skipped are the services (or containers) the release left
+	// alone, and why, so it can be explained when nothing happened.
+	Skipped []Skip `json:",omitempty"`
+}
+
+// The reasons a service, or one of its containers, is left out of a
+// release. These are stored with jobs, so shouldn't be changed.
+const (
+	SkipNoImages            = "no_images"
+	SkipInvalidImage        = "invalid_image"
+	SkipAlreadyLatest       = "already_latest"
+	SkipAlreadyRunning      = "already_running"
+	SkipLocked              = "locked"
+	SkipSelfUpgradeDisabled = "self_upgrade_disabled"
+	SkipImageTooNew         = "image_too_new"
+	SkipImageNotNewer       = "image_not_newer"
+	SkipImageSuspect        = "image_suspect"
+)
+
+// Skip says why a service, or one of its containers, was left out of
+// a release.
+type Skip struct {
+	Service   flux.ServiceID
+	Container string `json:",omitempty"`
+	Reason    string
+}
+
+// SelfUpgradeRecord says which of flux's own services a release
+// upgraded, and how to put them back as they were in the config repo,
+// should the daemon not come back.
+type SelfUpgradeRecord struct {
+	Services []flux.ServiceID
+	// Rollback is a release plan which restores the services'
+	// definitions in the config repo, without going to the platform.
+	Rollback json.RawMessage
+}
+
+// ContainerTarget is an image for a particular container of a
+// service.
+type ContainerTarget struct {
+	Service   flux.ServiceID
+	Container string
+	Image     flux.ImageID
 }
 
 // AutomatedInstanceJobParams are the params for an automated_instance job
 type AutomatedInstanceJobParams struct {
 	InstanceID flux.InstanceID
+	// PendingSince is when updates were first found and held back,
+	// if the instance batches automated releases.
+	PendingSince time.Time `json:",omitempty"`
 }
@@ -27,9 +27,10 @@ func TestJobEncodingDecoding(t *testing.T) {
 		Key:         "key1",
 		Submitted:   now,
 		Claimed:     now,
+		ClaimedBy:   "worker",
 		Heartbeat:   now,
 		Finished:    now,
-		Log:         []string{"log1"},
+		Log:         []LogEntry{{Level: LogInfo, Message: "log1"}},
 		Status:      "status",
 		Done:        true,
 		Success:     true,
@@ -0,0 +1,169 @@
+package jobs
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+// The states of a job, as listed.
+const (
+	JobStateQueued    = "queued"
+	JobStateRunning   = "running"
+	JobStateSucceeded = "succeeded"
+	JobStateFailed    = "failed"
+	// JobStateDone matches jobs which have succeeded or failed.
+	JobStateDone = "done"
+)
+
+const (
+	// DefaultJobPageSize is how many jobs are listed at once, if no
+	// limit is given; MaxJobPageSize is the most which can be.
+	DefaultJobPageSize = 50
+	MaxJobPageSize     = 500
+)
+
+// JobQuery says which of an instance's jobs to list, most recently
+// submitted first. Anything left empty doesn't narrow it down.
+type JobQuery struct {
+	Method string
+	State  string
+	// Service narrows it down to release jobs which include the
+	// service.
+	Service flux.ServiceID
+	// User narrows it down to release jobs submitted by the user.
+	User string
+	// Since and Until bound when jobs were submitted; Until is
+	// exclusive.
+	Since time.Time
+	Until time.Time
+	// Cursor, if given, is the Next of the previous page.
+	Cursor string
+	Limit  int
+}
+
+// JobPage is a page of jobs listed. Next is the cursor for the page
+// after, if there is one.
+type JobPage struct {
+	Jobs []Job  `json:"jobs"`
+	Next string `json:"next,omitempty"`
+}
+
+// Validate checks the state and limit are ones which can be listed.
+func (q JobQuery) Validate() error {
+	switch q.State {
+	case "", JobStateQueued, JobStateRunning, JobStateSucceeded, JobStateFailed, JobStateDone:
+	default:
+		return errors.Errorf("unknown job state %q", q.State)
+	}
+	if q.Limit < 0 || q.Limit > MaxJobPageSize {
+		return errors.Errorf("limit must be between 1 and %d", MaxJobPageSize)
+	}
+	return nil
+}
+
+func (q JobQuery) limit() int {
+	if q.Limit == 0 {
+		return DefaultJobPageSize
+	}
+	return q.Limit
+}
+
+// matches says whether the job is one of those asked for, in the
+// ways which can't be asked of the database.
+func (q JobQuery) matches(j Job) bool {
+	if q.State != "" {
+		state := j.State()
+		if state != q.State && !(q.State == JobStateDone && j.Done) {
+			return false
+		}
+	}
+	if q.Service == "" && q.User == "" {
+		return true
+	}
+	params, ok := j.Params.(ReleaseJobParams)
+	if !ok {
+		return false
+	}
+	if q.User != "" && params.User != q.User {
+		return false
+	}
+	return q.Service == "" || params.Involves(q.Service)
+}
+
+// State says where the job has got to.
+func (j Job) State() string {
+	switch {
+	case j.Done && j.Success:
+		return JobStateSucceeded
+	case j.Done:
+		return JobStateFailed
+	case !j.Claimed.IsZero():
+		return JobStateRunning
+	default:
+		return JobStateQueued
+	}
+}
+
+// Involves says whether the release is of the service given, or of
+// some of its containers.
+func (p ReleaseJobParams) Involves(id flux.ServiceID) bool {
+	if len(p.ContainerTargets) > 0 {
+		for _, t := range p.ContainerTargets {
+			if t.Service == id {
+				return true
+			}
+		}
+		return false
+	}
+	for _, ex := range p.Excludes {
+		if ex == id {
+			return false
+		}
+	}
+	specs := p.ServiceSpecs
+	if p.ServiceSpec != "" {
+		specs = append([]flux.ServiceSpec{p.ServiceSpec}, specs...)
+	}
+	for _, spec := range specs {
+		if spec == flux.ServiceSpecAll {
+			return true
+		}
+		if match, err := spec.Matcher(); err == nil && match(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// jobCursor is where a page of jobs listed starts: after the job
+// submitted at the time given, with the ID given (for jobs submitted
+// at the same time).
+type jobCursor struct {
+	submitted time.Time
+	id        JobID
+}
+
+func (c jobCursor) String() string {
+	return base64.URLEncoding.EncodeToString([]byte(c.submitted.UTC().Format(time.RFC3339Nano) + " " + string(c.id)))
+}
+
+func parseJobCursor(s string) (jobCursor, error) {
+	bytes, err := base64.URLEncoding.DecodeString(s)
+	if err != nil {
+		return jobCursor{}, errors.Wrap(err, "decoding cursor")
+	}
+	parts := strings.SplitN(string(bytes), " ", 2)
+	if len(parts) != 2 {
+		return jobCursor{}, errors.New("malformed cursor")
+	}
+	submitted, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return jobCursor{}, errors.Wrap(err, "malformed cursor")
+	}
+	return jobCursor{submitted: submitted, id: JobID(parts[1])}, nil
+}
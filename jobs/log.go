@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The levels of entry in a job's log.
+const (
+	LogInfo  = "info"
+	LogWarn  = "warn"
+	LogError = "error"
+)
+
+const (
+	// MaxLogEntries is the most entries kept in a job's log. Beyond
+	// that, entries from the middle are dropped, and a marker says
+	// how many; the first entries say what the job was doing, and the
+	// last what happened to it.
+	MaxLogEntries = 500
+	// SummaryLogEntries is how many of the latest entries in a job's
+	// log are given with a summary of the job.
+	SummaryLogEntries = 20
+)
+
+// LogEntry is a line in a job's log. Omitted is set on the marker
+// put in place of entries which were dropped.
+type LogEntry struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Omitted int    `json:"omitted,omitempty"`
+}
+
+// UnmarshalJSON reads an entry, or a plain string as an info entry,
+// as logs were kept before they had levels.
+func (e *LogEntry) UnmarshalJSON(data []byte) error {
+	var message string
+	if err := json.Unmarshal(data, &message); err == nil {
+		*e = LogEntry{Level: LogInfo, Message: message}
+		return nil
+	}
+	type entry LogEntry
+	return json.Unmarshal(data, (*entry)(e))
+}
+
+func (e LogEntry) String() string {
+	if e.Level == LogInfo || e.Level == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("[%s] %s", e.Level, e.Message)
+}
+
+// Logf sets the job's status, and adds it to the log at the level
+// given; unless it's the same as the last entry, since a job may
+// report the same status over and over while waiting.
+func (j *Job) Logf(level, format string, args ...interface{}) {
+	j.Status = fmt.Sprintf(format, args...)
+	entry := LogEntry{Level: level, Message: j.Status}
+	if n := len(j.Log); n > 0 && j.Log[n-1] == entry {
+		return
+	}
+	j.Log = truncateLog(append(j.Log, entry), MaxLogEntries)
+}
+
+// Summary gives the job with only the latest entries of its log, for
+// showing its progress; the whole log can be fetched separately.
+func (j Job) Summary() Job {
+	j.Log = tailLog(j.Log, SummaryLogEntries)
+	return j
+}
+
+// truncateLog drops entries from the middle of the log, if there are
+// more than max, putting a marker in their place.
+func truncateLog(log []LogEntry, max int) []LogEntry {
+	if len(log) <= max {
+		return log
+	}
+	head := max / 4
+	tail := max - head - 1
+	omitted := len(log) - head - tail
+	dropped := log[head : len(log)-tail]
+	for _, e := range dropped {
+		if e.Omitted > 0 {
+			// An earlier marker; count what it stood for, not it
+			omitted += e.Omitted - 1
+		}
+	}
+	res := append([]LogEntry{}, log[:head]...)
+	res = append(res, omittedMarker(omitted))
+	return append(res, log[len(log)-tail:]...)
+}
+
+// tailLog gives the last n entries of the log, with a marker for the
+// rest.
+func tailLog(log []LogEntry, n int) []LogEntry {
+	if len(log) <= n {
+		return log
+	}
+	omitted := len(log) - (n - 1)
+	for _, e := range log[:omitted] {
+		if e.Omitted > 0 {
+			omitted += e.Omitted - 1
+		}
+	}
+	return append([]LogEntry{omittedMarker(omitted)}, log[len(log)-(n-1):]...)
+}
+
+func omittedMarker(n int) LogEntry {
+	return LogEntry{
+		Level:   LogInfo,
+		Message: fmt.Sprintf("... %d entries omitted ...", n),
+		Omitted: n,
+	}
+}
@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLogTruncation(t *testing.T) {
+	var job Job
+	for i := 0; i < MaxLogEntries*3; i++ {
+		job.Logf(LogInfo, "step %d", i)
+		job.Logf(LogInfo, "step %d", i) // repeated, so not logged again
+	}
+	if len(job.Log) != MaxLogEntries {
+		t.Fatalf("expected %d entries, got %d", MaxLogEntries, len(job.Log))
+	}
+	head := MaxLogEntries / 4
+	if omitted := job.Log[head].Omitted; omitted != MaxLogEntries*2+1 {
+		t.Errorf("expected %d entries omitted, got %d", MaxLogEntries*2+1, omitted)
+	}
+	if last := job.Log[len(job.Log)-1]; last.Message != job.Status {
+		t.Errorf("expected the last entry to be the status %q, got %q", job.Status, last.Message)
+	}
+
+	summary := job.Summary()
+	if len(summary.Log) != SummaryLogEntries || summary.Log[0].Omitted != MaxLogEntries*3-(SummaryLogEntries-1) {
+		t.Errorf("expected the summary to account for every entry, got %+v", summary.Log[0])
+	}
+}
+
+func TestLogEntryFromString(t *testing.T) {
+	var log []LogEntry
+	bailIfErr(t, json.Unmarshal([]byte(`["old", {"level": "error", "message": "new"}]`), &log))
+	expected := []LogEntry{{Level: LogInfo, Message: "old"}, {Level: LogError, Message: "new"}}
+	if len(log) != 2 || log[0] != expected[0] || log[1] != expected[1] {
+		t.Errorf("expected %+v, got %+v", expected, log)
+	}
+}
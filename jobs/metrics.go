@@ -12,6 +12,8 @@ import (
 	fluxmetrics "github.com/weaveworks/flux/metrics"
 )
 
+const LabelQueue = "queue"
+
 type instrumentedJobStore struct {
 	js              JobStore
 	RequestDuration metrics.Histogram
@@ -60,6 +62,26 @@ func (i *instrumentedJobStore) PutJobIgnoringDuplicates(inst flux.InstanceID, j
 	return i.js.PutJobIgnoringDuplicates(inst, j)
 }
 
+func (i *instrumentedJobStore) RecentJobs(inst flux.InstanceID, n int) (jobs []Job, err error) {
+	defer func(begin time.Time) {
+		i.RequestDuration.With(
+			fluxmetrics.LabelMethod, "RecentJobs",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.js.RecentJobs(inst, n)
+}
+
+func (i *instrumentedJobStore) ListJobs(inst flux.InstanceID, q JobQuery) (page JobPage, err error) {
+	defer func(begin time.Time) {
+		i.RequestDuration.With(
+			fluxmetrics.LabelMethod, "ListJobs",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.js.ListJobs(inst, q)
+}
+
 func (i *instrumentedJobStore) UpdateJob(j Job) (err error) {
 	defer func(begin time.Time) {
 		i.RequestDuration.With(
@@ -90,6 +112,16 @@ func (i *instrumentedJobStore) NextJob(queues []string) (j Job, err error) {
 	return i.js.NextJob(queues)
 }
 
+func (i *instrumentedJobStore) Unclaim(j Job) (err error) {
+	defer func(begin time.Time) {
+		i.RequestDuration.With(
+			fluxmetrics.LabelMethod, "Unclaim",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.js.Unclaim(j)
+}
+
 func (i *instrumentedJobStore) GC() (err error) {
 	defer func(begin time.Time) {
 		i.RequestDuration.With(
@@ -100,6 +132,16 @@ func (i *instrumentedJobStore) GC() (err error) {
 	return i.js.GC()
 }
 
+func (i *instrumentedJobStore) QueueStats() (stats []QueueStat, err error) {
+	defer func(begin time.Time) {
+		i.RequestDuration.With(
+			fluxmetrics.LabelMethod, "QueueStats",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.js.QueueStats()
+}
+
 type WorkerMetrics struct {
 	JobDuration metrics.Histogram
 }
@@ -115,3 +157,25 @@ func NewWorkerMetrics() WorkerMetrics {
 		}, []string{fluxmetrics.LabelMethod, fluxmetrics.LabelSuccess}),
 	}
 }
+
+type CleanerMetrics struct {
+	QueueDepth      metrics.Gauge
+	OldestQueuedAge metrics.Gauge
+}
+
+func NewCleanerMetrics() CleanerMetrics {
+	return CleanerMetrics{
+		QueueDepth: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "flux",
+			Subsystem: "jobs",
+			Name:      "queue_depth",
+			Help:      "Number of jobs waiting to be claimed, per queue.",
+		}, []string{LabelQueue}),
+		OldestQueuedAge: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "flux",
+			Subsystem: "jobs",
+			Name:      "oldest_queued_age_seconds",
+			Help:      "Time in seconds since the longest-waiting job in each queue was scheduled.",
+		}, []string{LabelQueue}),
+	}
+}
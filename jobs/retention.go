@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetentionPolicy says which finished jobs the store may delete when
+// it is garbage collected.
+type RetentionPolicy struct {
+	// MaxAge is how long jobs are kept after submission. Claimed jobs
+	// that have not heartbeated within MaxAge are also considered
+	// dead, and removed.
+	MaxAge time.Duration
+	// MaxCount is the maximum number of finished jobs kept for each
+	// instance; the oldest are removed first. Zero means no limit.
+	MaxCount int
+}
+
+// Archiver is given jobs before they are deleted from the store, so
+// that they can be kept somewhere cheaper for later inspection.
+type Archiver interface {
+	Archive([]Job) error
+}
+
+// QueueStat describes the jobs waiting in a queue.
+type QueueStat struct {
+	Queue string
+	// Depth is the number of jobs not yet claimed by a worker.
+	Depth int
+	// Oldest is when the longest-waiting job was scheduled to run;
+	// it's zero if the queue is empty.
+	Oldest time.Time
+}
+
+// FileArchiver writes archived jobs as newline-delimited JSON, to a
+// new file for each batch, in a directory.
+type FileArchiver struct {
+	dir string
+	now func() time.Time
+}
+
+// NewFileArchiver returns an archiver writing to the directory given,
+// creating it if necessary.
+func NewFileArchiver(dir string) (*FileArchiver, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "creating archive directory %s", dir)
+	}
+	return &FileArchiver{
+		dir: dir,
+		now: time.Now,
+	}, nil
+}
+
+func (a *FileArchiver) Archive(jobs []Job) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	name := filepath.Join(a.dir, fmt.Sprintf("jobs-%d.json", a.now().UTC().UnixNano()))
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return errors.Wrap(err, "creating archive file")
+	}
+	enc := json.NewEncoder(f)
+	for _, job := range jobs {
+		if err := enc.Encode(job); err != nil {
+			f.Close()
+			return errors.Wrapf(err, "archiving job %s", job.ID)
+		}
+	}
+	return f.Close()
+}
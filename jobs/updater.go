@@ -0,0 +1,138 @@
+package jobs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// updateBackoff is how long to wait before retrying a failed
+	// update, multiplied by the number of the attempt, up to
+	// maxUpdateBackoff.
+	updateBackoff    = time.Second
+	maxUpdateBackoff = 10 * time.Second
+	// finalUpdateAttempts is how many times to try writing the final
+	// state of a job before giving up.
+	finalUpdateAttempts = 10
+)
+
+// BufferedUpdater passes a job's updates on to the store, without
+// holding up (or failing) the job if the store is briefly unavailable:
+// an update which fails is kept, and retried in the background until
+// it's written, or a later update supersedes it. Since each update is
+// the whole job, only the latest is kept. Losing the claim on the job
+// is not retried; it's returned from every update after.
+type BufferedUpdater struct {
+	updater JobUpdater
+	logger  log.Logger
+	backoff time.Duration
+
+	mu       sync.Mutex
+	pending  *Job
+	retrying bool
+	closed   bool
+	lost     bool
+}
+
+func NewBufferedUpdater(updater JobUpdater, logger log.Logger) *BufferedUpdater {
+	return &BufferedUpdater{
+		updater: updater,
+		logger:  logger,
+		backoff: updateBackoff,
+	}
+}
+
+func (b *BufferedUpdater) UpdateJob(job Job) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.lost {
+		return ErrJobClaimLost
+	}
+	if b.closed {
+		return errors.New("job updates are closed")
+	}
+	if b.retrying {
+		// It'll be written on the next attempt
+		b.pending = &job
+		return nil
+	}
+	err := b.updater.UpdateJob(job)
+	switch {
+	case err == ErrJobClaimLost:
+		b.lost = true
+		return err
+	case err != nil:
+		b.logger.Log("err", errors.Wrap(err, "updating job; will retry"))
+		b.pending, b.retrying = &job, true
+		go b.retry()
+	}
+	return nil
+}
+
+func (b *BufferedUpdater) Heartbeat(id JobID) error {
+	return b.updater.Heartbeat(id)
+}
+
+// retry writes the pending update, until it succeeds or there's no
+// longer any need.
+func (b *BufferedUpdater) retry() {
+	for attempt := 1; ; attempt++ {
+		time.Sleep(b.wait(attempt))
+		b.mu.Lock()
+		if b.closed || b.pending == nil {
+			b.retrying = false
+			b.mu.Unlock()
+			return
+		}
+		err := b.updater.UpdateJob(*b.pending)
+		if err == nil || err == ErrJobClaimLost {
+			b.lost = err == ErrJobClaimLost
+			b.pending, b.retrying = nil, false
+			b.mu.Unlock()
+			return
+		}
+		b.mu.Unlock()
+	}
+}
+
+func (b *BufferedUpdater) wait(attempt int) time.Duration {
+	if d := time.Duration(attempt) * b.backoff; d < maxUpdateBackoff {
+		return d
+	}
+	return maxUpdateBackoff
+}
+
+// Finish writes the final state of the job, superseding any update
+// still pending, retrying until it's written or it has tried enough
+// times. No updates are accepted afterwards. If it returns an error,
+// the job's outcome has not been recorded.
+func (b *BufferedUpdater) Finish(job Job) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed, b.pending = true, nil
+	if b.lost {
+		return ErrJobClaimLost
+	}
+	for attempt := 1; ; attempt++ {
+		err := b.updater.UpdateJob(job)
+		if err == nil || err == ErrJobClaimLost {
+			return err
+		}
+		if attempt == finalUpdateAttempts {
+			return errors.Wrap(err, "recording job outcome")
+		}
+		b.logger.Log("err", errors.Wrapf(err, "recording job outcome (attempt %d of %d)", attempt, finalUpdateAttempts))
+		time.Sleep(b.wait(attempt))
+	}
+}
+
+// Close drops any update still pending, and accepts no more; e.g.,
+// because the job is being handed back as it is.
+func (b *BufferedUpdater) Close() {
+	b.mu.Lock()
+	b.closed, b.pending = true, nil
+	b.mu.Unlock()
+}
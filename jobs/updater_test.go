@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// flakyUpdater fails the number of updates given, then records them.
+type flakyUpdater struct {
+	mu       sync.Mutex
+	failures int
+	written  []string
+}
+
+func (f *flakyUpdater) UpdateJob(job Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("database unavailable")
+	}
+	f.written = append(f.written, job.Status)
+	return nil
+}
+
+func (f *flakyUpdater) Heartbeat(JobID) error { return nil }
+
+func (f *flakyUpdater) statuses() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.written...)
+}
+
+func TestBufferedUpdaterRetries(t *testing.T) {
+	store := &flakyUpdater{failures: 2}
+	b := NewBufferedUpdater(store, log.NewNopLogger())
+	b.backoff = time.Millisecond
+
+	if err := b.UpdateJob(Job{Status: "one"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.UpdateJob(Job{Status: "two"}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(store.statuses()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := store.statuses(); len(got) != 1 || got[0] != "two" {
+		t.Fatalf("expected only the latest update to be written, got %v", got)
+	}
+
+	if err := b.Finish(Job{Status: "done"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.UpdateJob(Job{Status: "late"}); err == nil {
+		t.Error("expected updates after finishing to be refused")
+	}
+	if got := store.statuses(); got[len(got)-1] != "done" {
+		t.Errorf("expected the final state to be written last, got %v", got)
+	}
+}
@@ -2,6 +2,7 @@ package jobs
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -16,6 +17,10 @@ const (
 
 var (
 	ErrNoHandlerForJob = fmt.Errorf("no handler for job type")
+	// ErrJobInterrupted is returned by handlers which have stopped
+	// part-way through a job, having recorded their progress in it,
+	// so that it can be picked up again later.
+	ErrJobInterrupted = fmt.Errorf("job interrupted")
 )
 
 type Handler interface {
@@ -31,6 +36,10 @@ type Worker struct {
 	queues   []string
 	stopping chan struct{}
 	done     chan struct{}
+
+	mu       sync.Mutex
+	lastPoll time.Time
+	busy     bool
 }
 
 // NewWorker returns a usable worker pulling jobs from the JobPopper.
@@ -49,6 +58,7 @@ func NewWorker(
 		queues:   queues,
 		stopping: make(chan struct{}),
 		done:     make(chan struct{}),
+		lastPoll: time.Now(),
 	}
 }
 
@@ -67,6 +77,7 @@ func (w *Worker) Work() {
 			return
 		default:
 		}
+		w.setBusy(false)
 		job, err := w.jobs.NextJob(w.queues)
 		if err == ErrNoJobAvailable {
 			time.Sleep(pollingPeriod)
@@ -77,6 +88,7 @@ func (w *Worker) Work() {
 			time.Sleep(pollingPeriod)
 			continue
 		}
+		w.setBusy(true)
 		logger := log.NewContext(w.logger).With("job", job.ID)
 		logger.Log("method", job.Method)
 
@@ -84,34 +96,58 @@ func (w *Worker) Work() {
 		go heartbeat(job.ID, w.jobs, time.Second, cancel, done, logger)
 
 		job.Status = "Executing..."
-		if err := w.jobs.UpdateJob(job); err != nil {
+		if err := w.jobs.UpdateJob(job); err == ErrJobClaimLost {
+			// Someone else has taken over the job; leave it to them.
+			logger.Log("err", err)
+			close(cancel)
+			<-done
+			continue
+		} else if err != nil {
 			logger.Log("err", errors.Wrap(err, "updating job"))
 		}
 
 		begin := time.Now().UTC()
 		var followUps []Job
+		updater := NewBufferedUpdater(w.jobs, logger)
 		if handler, ok := w.handlers[job.Method]; !ok {
 			err = ErrNoHandlerForJob
 		} else {
-			followUps, err = handler.Handle(&job, w.jobs)
+			followUps, err = handler.Handle(&job, updater)
 		}
 		w.metrics.JobDuration.With(
 			fluxmetrics.LabelMethod, job.Method,
 			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
 		).Observe(time.Since(begin).Seconds())
 		logger.Log("took", time.Since(begin))
+		if errors.Cause(err) == ErrJobInterrupted {
+			// Put it back, so it can be resumed as soon as possible
+			// (and maybe elsewhere), rather than waiting for our
+			// lease to expire.
+			job.Logf(LogWarn, "Interrupted; waiting to be resumed.")
+			updater.Close()
+			if err := w.jobs.Unclaim(job); err != nil {
+				logger.Log("err", errors.Wrap(err, "unclaiming job"))
+			}
+			close(cancel)
+			<-done
+			continue
+		}
 		job.Done = true
 		if err != nil {
 			job.Success = false
-			status := fmt.Sprintf("Failed: %v", err)
-			job.Status = status
-			job.Log = append(job.Log, status)
+			job.Logf(LogError, "Failed: %v", err)
 		} else {
 			job.Success = true
 			job.Status = "Complete."
 		}
-		if err := w.jobs.UpdateJob(job); err != nil {
-			logger.Log("err", errors.Wrap(err, "updating job"))
+		if err := updater.Finish(job); err != nil {
+			// The outcome isn't recorded, so neither are its
+			// consequences; once the claim on the job lapses, it
+			// will be resumed, and finish again.
+			logger.Log("err", err)
+			close(cancel)
+			<-done
+			continue
 		}
 
 		// Schedule any follow-up jobs
@@ -126,6 +162,25 @@ func (w *Worker) Work() {
 	}
 }
 
+func (w *Worker) setBusy(busy bool) {
+	w.mu.Lock()
+	w.lastPoll, w.busy = time.Now(), busy
+	w.mu.Unlock()
+}
+
+// Alive returns an error if the worker has gone longer than allowed
+// without looking for a job, while not working on one; i.e., its loop
+// is wedged. Jobs themselves may take a while, and are bounded by
+// their own timeouts and leases.
+func (w *Worker) Alive(allowed time.Duration) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if since := time.Since(w.lastPoll); !w.busy && since > allowed {
+		return errors.Errorf("no job polled for %s", since)
+	}
+	return nil
+}
+
 // Close stops the worker from processing any more jobs
 func (w *Worker) Stop(timeout time.Duration) error {
 	close(w.stopping)
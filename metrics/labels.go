@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Some labels, like the instance ID and image repository, can take
+// as many values as there are users of a multitenant service, which
+// makes for a lot of series. Cardinality says how the values of such
+// a label are reported.
+type Cardinality string
+
+const (
+	// Report each value as it is.
+	CardinalityFull Cardinality = "full"
+	// Report a hash of the value, taken modulo the number of hash
+	// buckets; this bounds the number of series, while still
+	// spreading values out.
+	CardinalityHash Cardinality = "hash"
+	// Report the same value for everything, i.e., don't break the
+	// metric down by this label at all.
+	CardinalityAggregate Cardinality = "aggregate"
+)
+
+// AggregateValue is the label value reported for everything, when a
+// label is aggregated.
+const AggregateValue = "all"
+
+const defaultHashBuckets = 64
+
+func ParseCardinality(s string) (Cardinality, error) {
+	switch c := Cardinality(s); c {
+	case CardinalityFull, CardinalityHash, CardinalityAggregate:
+		return c, nil
+	}
+	return "", fmt.Errorf(`unknown label cardinality %q; expected "full", "hash" or "aggregate"`, s)
+}
+
+// LabelPolicy says how each of the high-cardinality labels is
+// reported. The zero value reports all values as they are.
+type LabelPolicy struct {
+	InstanceID  Cardinality
+	Repository  Cardinality
+	ServiceID   Cardinality
+	HashBuckets int // if zero, a default is used
+}
+
+// Instance gives the value to report for the instance ID label.
+func (p LabelPolicy) Instance(inst string) string {
+	return p.value(p.InstanceID, inst)
+}
+
+// Repo gives the value to report for an image repository label.
+func (p LabelPolicy) Repo(repo string) string {
+	return p.value(p.Repository, repo)
+}
+
+// Service gives the value to report for a service label. An empty
+// service (e.g., for a whole instance) is reported as it is, so it
+// isn't mixed up with services.
+func (p LabelPolicy) Service(service string) string {
+	if service == "" {
+		return ""
+	}
+	return p.value(p.ServiceID, service)
+}
+
+func (p LabelPolicy) value(c Cardinality, v string) string {
+	switch c {
+	case CardinalityHash:
+		buckets := p.HashBuckets
+		if buckets <= 0 {
+			buckets = defaultHashBuckets
+		}
+		h := fnv.New32a()
+		h.Write([]byte(v))
+		return fmt.Sprintf("h%d", h.Sum32()%uint32(buckets))
+	case CardinalityAggregate:
+		return AggregateValue
+	default:
+		return v
+	}
+}
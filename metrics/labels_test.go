@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLabelPolicyFull(t *testing.T) {
+	var p LabelPolicy
+	if got := p.Instance("inst-1"); got != "inst-1" {
+		t.Errorf("expected instance label as given, got %q", got)
+	}
+	if got := p.Repo("quay.io/weaveworks/flux"); got != "quay.io/weaveworks/flux" {
+		t.Errorf("expected repository label as given, got %q", got)
+	}
+}
+
+func TestLabelPolicyAggregate(t *testing.T) {
+	p := LabelPolicy{Repository: CardinalityAggregate}
+	for _, repo := range []string{"alpine", "weaveworks/flux", "quay.io/weaveworks/fluxsvc"} {
+		if got := p.Repo(repo); got != AggregateValue {
+			t.Errorf("expected repository %q to be aggregated, got %q", repo, got)
+		}
+	}
+	// Only the repository label is aggregated
+	if got := p.Instance("inst-1"); got != "inst-1" {
+		t.Errorf("expected instance label as given, got %q", got)
+	}
+}
+
+func TestLabelPolicyHash(t *testing.T) {
+	p := LabelPolicy{InstanceID: CardinalityHash, HashBuckets: 4}
+	seen := map[string]struct{}{}
+	for i := 0; i < 100; i++ {
+		inst := fmt.Sprintf("inst-%d", i)
+		v := p.Instance(inst)
+		if v != p.Instance(inst) {
+			t.Fatalf("expected hashed label for %q to be stable", inst)
+		}
+		seen[v] = struct{}{}
+	}
+	if len(seen) > 4 {
+		t.Errorf("expected at most 4 label values, got %d: %v", len(seen), seen)
+	}
+	if len(seen) < 2 {
+		t.Errorf("expected label values to be spread over buckets, got %v", seen)
+	}
+}
+
+func TestParseCardinality(t *testing.T) {
+	for _, s := range []string{"full", "hash", "aggregate"} {
+		if _, err := ParseCardinality(s); err != nil {
+			t.Errorf("expected %q to parse, got %s", s, err)
+		}
+	}
+	if _, err := ParseCardinality("some"); err == nil {
+		t.Error("expected error parsing unknown cardinality")
+	}
+}
+
+func TestLabelPolicyService(t *testing.T) {
+	p := LabelPolicy{ServiceID: CardinalityHash, HashBuckets: 4}
+	if got := p.Service("default/helloworld"); got == "default/helloworld" || got == "" {
+		t.Errorf("expected service label to be hashed, got %q", got)
+	}
+	// The whole instance is still told apart from its services
+	if got := p.Service(""); got != "" {
+		t.Errorf("expected empty service label to stay empty, got %q", got)
+	}
+}
@@ -0,0 +1,182 @@
+package platform
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+// Fake is a Platform which keeps its services in memory, for tests.
+// Applying a definition updates the service's containers, if
+// ContainersFor is set; everything applied is recorded. It can be made
+// slow, or made to fail, per method; it is safe to change while in
+// use.
+type Fake struct {
+	// ContainersFor gives the containers in a pod controller
+	// definition; e.g., kubernetes.ContainersFor. If it's nil,
+	// applying definitions doesn't change the services.
+	ContainersFor func(def []byte) ([]Container, error)
+
+	mu        sync.Mutex
+	services  []Service
+	applied   []ServiceDefinition
+	resources []ResourceSet
+	errors    map[string]error
+	latency   time.Duration
+}
+
+// NewFake gives a Fake platform running the services given.
+func NewFake(services ...Service) *Fake {
+	return &Fake{
+		services: append([]Service{}, services...),
+		errors:   map[string]error{},
+	}
+}
+
+// SetService adds the service given, or replaces the service with the
+// same ID.
+func (f *Fake) SetService(s Service) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.services {
+		if f.services[i].ID == s.ID {
+			f.services[i] = s
+			return
+		}
+	}
+	f.services = append(f.services, s)
+}
+
+// Fail makes calls to the method named (e.g., "Apply") fail with the
+// error given; a nil error makes them succeed again.
+func (f *Fake) Fail(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.errors, method)
+		return
+	}
+	f.errors[method] = err
+}
+
+// SetLatency makes each call take (at least) the time given.
+func (f *Fake) SetLatency(d time.Duration) {
+	f.mu.Lock()
+	f.latency = d
+	f.mu.Unlock()
+}
+
+// Applied gives the definitions applied so far, in order.
+func (f *Fake) Applied() []ServiceDefinition {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]ServiceDefinition{}, f.applied...)
+}
+
+// AppliedResources gives the resource sets applied so far, in order.
+func (f *Fake) AppliedResources() []ResourceSet {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]ResourceSet{}, f.resources...)
+}
+
+// call waits for the latency, and gives the error to fail the method
+// with, if there is one.
+func (f *Fake) call(method string) error {
+	f.mu.Lock()
+	latency, err := f.latency, f.errors[method]
+	f.mu.Unlock()
+	time.Sleep(latency)
+	return err
+}
+
+func (f *Fake) AllServices(namespace string, ignore flux.ServiceIDSet) ([]Service, error) {
+	if err := f.call("AllServices"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return NewSnapshotPlatform(Snapshot{Services: f.services}).AllServices(namespace, ignore)
+}
+
+func (f *Fake) SomeServices(ids []flux.ServiceID) ([]Service, error) {
+	if err := f.call("SomeServices"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return NewSnapshotPlatform(Snapshot{Services: f.services}).SomeServices(ids)
+}
+
+func (f *Fake) Apply(defs []ServiceDefinition) error {
+	if err := f.call("Apply"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	errs := ApplyError{}
+	for _, def := range defs {
+		f.applied = append(f.applied, def)
+		if err := f.update(def); err != nil {
+			errs[def.ServiceID] = err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// update sets the containers of the service defined to those in the
+// definition. It's called with the lock held.
+func (f *Fake) update(def ServiceDefinition) error {
+	if f.ContainersFor == nil {
+		return nil
+	}
+	for i := range f.services {
+		if f.services[i].ID != def.ServiceID {
+			continue
+		}
+		containers, err := f.ContainersFor(def.NewDefinition)
+		if err != nil {
+			return err
+		}
+		f.services[i].Containers = ContainersOrExcuse{Containers: containers}
+		return nil
+	}
+	return fmt.Errorf("service %s not found", def.ServiceID)
+}
+
+func (f *Fake) ApplyResources(set ResourceSet) error {
+	if err := f.call("ApplyResources"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.resources = append(f.resources, set)
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *Fake) DryRunApply(defs []ServiceDefinition) (DryRunResult, error) {
+	if err := f.call("DryRunApply"); err != nil {
+		return nil, err
+	}
+	res := DryRunResult{}
+	for _, def := range defs {
+		res[def.ServiceID] = "configured (fake)"
+	}
+	return res, nil
+}
+
+func (f *Fake) Ping() error {
+	return f.call("Ping")
+}
+
+func (f *Fake) Version() (string, error) {
+	if err := f.call("Version"); err != nil {
+		return "", err
+	}
+	return "fake", nil
+}
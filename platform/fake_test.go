@@ -0,0 +1,35 @@
+package platform
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/weaveworks/flux"
+)
+
+func TestFake(t *testing.T) {
+	f := NewFake(Service{ID: "default/helloworld"})
+	f.ContainersFor = func([]byte) ([]Container, error) {
+		return []Container{{Name: "helloworld", Image: "quay.io/weaveworks/helloworld:v2"}}, nil
+	}
+
+	if err := f.Apply([]ServiceDefinition{{ServiceID: "default/helloworld"}}); err != nil {
+		t.Fatal(err)
+	}
+	services, err := f.SomeServices([]flux.ServiceID{"default/helloworld"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if containers := services[0].ContainersOrNil(); len(containers) != 1 || containers[0].Image != "quay.io/weaveworks/helloworld:v2" {
+		t.Errorf("expected the applied image, got %+v", containers)
+	}
+	if len(f.Applied()) != 1 {
+		t.Errorf("expected one definition recorded, got %d", len(f.Applied()))
+	}
+
+	failure := errors.New("apply failed")
+	f.Fail("Apply", failure)
+	if err := f.Apply(nil); err != failure {
+		t.Errorf("expected %v, got %v", failure, err)
+	}
+}
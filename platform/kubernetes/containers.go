@@ -0,0 +1,83 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/kubernetes/pkg/api/resource"
+
+	"github.com/weaveworks/flux/platform"
+)
+
+type containersDef struct {
+	Spec struct {
+		Template struct {
+			Spec struct {
+				Containers []containerDef `yaml:"containers"`
+			} `yaml:"spec"`
+		} `yaml:"template"`
+	} `yaml:"spec"`
+}
+
+type containerDef struct {
+	Name  string `yaml:"name"`
+	Image string `yaml:"image"`
+	Env   []struct {
+		Name      string      `yaml:"name"`
+		Value     interface{} `yaml:"value"`
+		ValueFrom interface{} `yaml:"valueFrom"`
+	} `yaml:"env"`
+	Resources struct {
+		Limits   map[string]interface{} `yaml:"limits"`
+		Requests map[string]interface{} `yaml:"requests"`
+	} `yaml:"resources"`
+}
+
+// ContainersFor gives the containers in the pod template of a
+// replication controller or deployment definition, in the same form
+// as those reported by the platform, so they can be compared.
+func ContainersFor(def []byte) ([]platform.Container, error) {
+	var d containersDef
+	if err := yaml.Unmarshal(def, &d); err != nil {
+		return nil, err
+	}
+	var res []platform.Container
+	for _, c := range d.Spec.Template.Spec.Containers {
+		container := platform.Container{Name: c.Name, Image: c.Image}
+		if len(c.Env) > 0 {
+			container.Env = map[string]string{}
+			for _, e := range c.Env {
+				switch {
+				case e.ValueFrom != nil:
+					container.Env[e.Name] = platform.EnvValueFrom
+				case e.Value != nil:
+					container.Env[e.Name] = fmt.Sprint(e.Value)
+				default:
+					container.Env[e.Name] = ""
+				}
+			}
+		}
+		if len(c.Resources.Limits)+len(c.Resources.Requests) > 0 {
+			container.Resources = map[string]string{}
+			for name, q := range c.Resources.Limits {
+				container.Resources["limits."+name] = canonicalQuantity(q)
+			}
+			for name, q := range c.Resources.Requests {
+				container.Resources["requests."+name] = canonicalQuantity(q)
+			}
+		}
+		res = append(res, container)
+	}
+	return res, nil
+}
+
+// canonicalQuantity gives a quantity the way the cluster reports it,
+// so that e.g., "0.1" and "100m" compare equal.
+func canonicalQuantity(v interface{}) string {
+	s := fmt.Sprint(v)
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return s
+	}
+	return q.String()
+}
@@ -0,0 +1,64 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/weaveworks/flux/platform"
+)
+
+const containersDefCase = `---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+spec:
+  template:
+    spec:
+      containers:
+      - name: helloworld
+        image: quay.io/weaveworks/helloworld:master-a000001
+        env:
+        - name: GREETING
+          value: Ahoy
+        - name: PASSWORD
+          valueFrom:
+            secretKeyRef:
+              name: hello
+              key: password
+        resources:
+          limits:
+            cpu: 0.1
+`
+
+func TestContainersForAndDiff(t *testing.T) {
+	defined, err := ContainersFor([]byte(containersDefCase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defined) != 1 || defined[0].Name != "helloworld" {
+		t.Fatalf("expected one container called helloworld, got %+v", defined)
+	}
+	c := defined[0]
+	if c.Env["GREETING"] != "Ahoy" || c.Env["PASSWORD"] != platform.EnvValueFrom {
+		t.Errorf("unexpected env %v", c.Env)
+	}
+	if c.Resources["limits.cpu"] != "100m" {
+		t.Errorf("expected canonical cpu limit 100m, got %q", c.Resources["limits.cpu"])
+	}
+
+	// The same, but for the image, is no difference
+	running := []platform.Container{{
+		Name:      "helloworld",
+		Image:     "quay.io/weaveworks/helloworld:master-a000002",
+		Env:       map[string]string{"GREETING": "Ahoy", "PASSWORD": platform.EnvValueFrom},
+		Resources: map[string]string{"limits.cpu": "100m"},
+	}}
+	if diff := platform.DiffContainers(defined, running); len(diff) != 0 {
+		t.Errorf("expected no differences, got %v", diff)
+	}
+
+	running[0].Env = map[string]string{"GREETING": "Hello", "PASSWORD": platform.EnvValueFrom, "DEBUG": "1"}
+	if diff := platform.DiffContainers(defined, running); len(diff) != 2 {
+		t.Errorf("expected two differences, got %v", diff)
+	}
+}
@@ -0,0 +1,83 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/platform"
+)
+
+// The flags kubectl has used, newest first, to ask the API server to
+// process a request without persisting it.
+var serverDryRunFlags = []string{"--dry-run=server", "--server-dry-run"}
+
+// DryRunApply sends each definition to the API server as a dry-run
+// apply, so that validation and admission controllers see it without
+// anything being changed. For the definitions which pass, it reports
+// what would change according to `kubectl diff`.
+func (c *Cluster) DryRunApply(defs []platform.ServiceDefinition) (platform.DryRunResult, error) {
+	type result struct {
+		res platform.DryRunResult
+		err error
+	}
+	resc := make(chan result)
+	c.actionc <- func() {
+		logger := log.NewContext(c.logger).With("method", "DryRunApply")
+		res := platform.DryRunResult{}
+		rejected := platform.ApplyError{}
+		for _, def := range defs {
+			_, stderr, err := c.dryRunApply(def.NewDefinition)
+			if err == platform.ErrDryRunUnsupported {
+				resc <- result{nil, err}
+				return
+			}
+			if err != nil {
+				logger.Log("service", def.ServiceID, "rejected", stderr)
+				rejected[def.ServiceID] = errors.New(strings.TrimSpace(stderr))
+				continue
+			}
+			// `kubectl diff` exits with 1 when there are differences;
+			// anything other than the output is of no interest here.
+			diff, _, _ := c.runKubectl(def.NewDefinition, "diff", "-f", "-")
+			res[def.ServiceID] = diff
+		}
+		if len(rejected) > 0 {
+			resc <- result{res, rejected}
+			return
+		}
+		resc <- result{res, nil}
+	}
+	r := <-resc
+	return r.res, r.err
+}
+
+func (c *Cluster) dryRunApply(def []byte) (stdout, stderr string, err error) {
+	for _, flag := range serverDryRunFlags {
+		stdout, stderr, err = c.runKubectl(def, "apply", flag, "-f", "-")
+		if err == nil || !unknownFlag(stderr) {
+			return stdout, stderr, err
+		}
+	}
+	return "", "", platform.ErrDryRunUnsupported
+}
+
+func unknownFlag(stderr string) bool {
+	return strings.Contains(stderr, "unknown flag") || strings.Contains(stderr, "invalid argument")
+}
+
+// runKubectl runs kubectl with the input given and returns what it
+// printed, rather than passing it through.
+func (c *Cluster) runKubectl(input []byte, args ...string) (string, string, error) {
+	cmd := c.kubectlCommand(args...)
+	cmd.Stdin = bytes.NewReader(input)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), stderr.String(), fmt.Errorf("running kubectl %s: %v", strings.Join(args, " "), err)
+	}
+	return stdout.String(), stderr.String(), nil
+}
@@ -14,52 +14,85 @@ import (
 // that are responsible for driving the given namespace/service. It presumes
 // kubeservice is available in the PWD or PATH.
 func FilesFor(path, namespace, service string) (filenames []string, err error) {
-	bin, err := func() (string, error) {
-		cwd, err := os.Getwd()
-		if err != nil {
-			return "", err
-		}
-		localBin := filepath.Join(cwd, "kubeservice")
-		if _, err := os.Stat(localBin); err == nil {
-			return localBin, nil
-		}
-		if pathBin, err := exec.LookPath("kubeservice"); err == nil {
-			return pathBin, nil
-		}
-		return "", errors.New("kubeservice not found")
-	}()
+	index, err := IndexFiles(path, nil, ScanLimits{})
+	if err != nil {
+		return nil, err
+	}
+	return index.FilesFor(path, namespace, service), nil
+}
+
+// FileIndex records which resource definition files drive each
+// service, as "namespace/service". Files are relative to the path
+// indexed, so an index can be used with any copy of the same files.
+type FileIndex map[string][]string
+
+// IndexFiles runs kubeservice over each of the resource definition
+// files in path (or any subdirectory) once, to find the services it
+// drives. Resources without a namespace are taken to be in that given
+// by defaults. Only the files within the limits given are looked
+// through. Like FilesFor, it presumes kubeservice is available in the
+// PWD or PATH.
+func IndexFiles(path string, defaults NamespaceDefaulter, limits ScanLimits) (FileIndex, error) {
+	bin, err := kubeserviceBin()
 	if err != nil {
 		return nil, err
 	}
 
 	var candidates []string
-	filepath.Walk(path, func(target string, fi os.FileInfo, err error) error {
-		if fi.IsDir() {
-			return nil
-		}
-		if ext := filepath.Ext(target); ext == ".yaml" || ext == ".yml" {
-			candidates = append(candidates, target)
-		}
+	if err := walkYAML(path, limits, func(target string) error {
+		candidates = append(candidates, target)
 		return nil
-	})
+	}); err != nil {
+		return nil, err
+	}
 
-	tgt := fmt.Sprintf("%s/%s", namespace, service)
-	var winners []string
+	index := FileIndex{}
 	for _, file := range candidates {
+		rel, err := filepath.Rel(path, file)
+		if err != nil {
+			return nil, err
+		}
 		var stdout bytes.Buffer
-		cmd := exec.Command(bin, "./"+filepath.Base(file)) // due to bug (?) in kubeservice
+		cmd := exec.Command(bin, "--default-namespace", defaults.namespaceFor(file), "./"+filepath.Base(file)) // due to bug (?) in kubeservice
 		cmd.Dir = filepath.Dir(file)
 		cmd.Stdout = &stdout
 		if err := cmd.Run(); err != nil {
 			continue
 		}
+		seen := map[string]bool{}
 		for _, out := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
-			if out == tgt { // kubeservice output is "namespace/service", same as ServiceID
-				winners = append(winners, file)
-				break
+			// kubeservice output is "namespace/service", same as ServiceID
+			if out == "" || seen[out] {
+				continue
 			}
+			seen[out] = true
+			index[out] = append(index[out], rel)
 		}
 	}
+	return index, nil
+}
+
+// FilesFor gives the files, under path, that drive the given
+// namespace/service, according to the index.
+func (ix FileIndex) FilesFor(path, namespace, service string) []string {
+	var res []string
+	for _, file := range ix[fmt.Sprintf("%s/%s", namespace, service)] {
+		res = append(res, filepath.Join(path, file))
+	}
+	return res
+}
 
-	return winners, nil
+func kubeserviceBin() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	localBin := filepath.Join(cwd, "kubeservice")
+	if _, err := os.Stat(localBin); err == nil {
+		return localBin, nil
+	}
+	if pathBin, err := exec.LookPath("kubeservice"); err == nil {
+		return pathBin, nil
+	}
+	return "", errors.New("kubeservice not found")
 }
@@ -0,0 +1,125 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// UpdateCase is a regression case for UpdatePodController (or
+// UpdateContainer), kept in a directory of its own:
+//
+//	in.yaml   the definition to update
+//	image     the image to update it to
+//	container (optional) the only container to update
+//	out.yaml  the definition expected after the update; or,
+//	error     (a fragment of) the error expected instead
+//
+// Manifests which have been updated wrongly can be dropped into a
+// directory like this, to make sure they stay fixed.
+type UpdateCase struct {
+	Name      string
+	Dir       string
+	In        []byte
+	Image     string
+	Container string
+	Out       []byte
+	Error     string
+}
+
+// ReadUpdateCases reads the cases in each subdirectory of the
+// directory given, in order of name.
+func ReadUpdateCases(dir string) ([]UpdateCase, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var cases []UpdateCase
+	for _, name := range names {
+		c, err := readUpdateCase(name, filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+func readUpdateCase(name, dir string) (UpdateCase, error) {
+	c := UpdateCase{Name: name, Dir: dir}
+	var err error
+	if c.In, err = ioutil.ReadFile(filepath.Join(dir, "in.yaml")); err != nil {
+		return c, err
+	}
+	if c.Image, err = readLine(filepath.Join(dir, "image")); err != nil {
+		return c, err
+	}
+	if c.Container, err = readLine(filepath.Join(dir, "container")); err != nil && !os.IsNotExist(err) {
+		return c, err
+	}
+	if c.Error, err = readLine(filepath.Join(dir, "error")); err != nil && !os.IsNotExist(err) {
+		return c, err
+	}
+	// A new case may not have its output written yet.
+	if c.Out, err = ioutil.ReadFile(filepath.Join(dir, "out.yaml")); err != nil && !os.IsNotExist(err) {
+		return c, err
+	}
+	return c, nil
+}
+
+func readLine(path string) (string, error) {
+	bytes, err := ioutil.ReadFile(path)
+	return strings.TrimSpace(string(bytes)), err
+}
+
+// Update does the update the case describes, giving the result.
+func (c UpdateCase) Update() ([]byte, error) {
+	if c.Container != "" {
+		return UpdateContainer(c.In, c.Container, c.Image, ioutil.Discard)
+	}
+	return UpdatePodController(c.In, c.Image, ioutil.Discard)
+}
+
+// Check does the update, and returns an error if the result isn't
+// what the case expects.
+func (c UpdateCase) Check() error {
+	out, err := c.Update()
+	switch {
+	case c.Error != "" && err == nil:
+		return fmt.Errorf("%s: expected error containing %q, got none", c.Name, c.Error)
+	case c.Error != "" && !strings.Contains(err.Error(), c.Error):
+		return fmt.Errorf("%s: expected error containing %q, got %q", c.Name, c.Error, err.Error())
+	case c.Error != "":
+		return nil
+	case err != nil:
+		return fmt.Errorf("%s: %v", c.Name, err)
+	case !bytes.Equal(out, c.Out):
+		return fmt.Errorf("%s: did not get expected result, instead got\n\n%s", c.Name, out)
+	}
+	return nil
+}
+
+// WriteOut does the update, and writes the result as the case's
+// expected output; for when the output is meant to change.
+func (c UpdateCase) WriteOut() error {
+	if c.Error != "" {
+		return nil
+	}
+	out, err := c.Update()
+	if err != nil {
+		return fmt.Errorf("%s: %v", c.Name, err)
+	}
+	return ioutil.WriteFile(filepath.Join(c.Dir, "out.yaml"), out, 0644)
+}
@@ -0,0 +1,225 @@
+package kubernetes
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+// Images may be given in fields other than those of container specs,
+// e.g., in a ConfigMap, for a program to read. These functions find
+// and update such fields, given a path of field names. As with
+// UpdatePodController, the definition is edited as text, so that its
+// layout and comments are kept; this means assuming the fields are
+// laid out one per line, in block style.
+
+var fieldLineRE = regexp.MustCompile(`^(\s*)(["']?)([^\s"':#]+)["']?:(\s*)(.*)$`)
+
+// ParseFieldPath turns a JSONPath like "{.data.image}" or ".data.image"
+// into field names.
+func ParseFieldPath(path string) ([]string, error) {
+	p := strings.TrimSpace(path)
+	p = strings.TrimPrefix(p, "{")
+	p = strings.TrimSuffix(p, "}")
+	p = strings.TrimPrefix(p, ".")
+	if p == "" {
+		return nil, fmt.Errorf("empty field path %q", path)
+	}
+	if strings.ContainsAny(p, "[]*") {
+		return nil, fmt.Errorf("field path %q: only field names are supported, not array indexing", path)
+	}
+	fields := strings.Split(p, ".")
+	for _, f := range fields {
+		if f == "" {
+			return nil, fmt.Errorf("field path %q has an empty field name", path)
+		}
+	}
+	return fields, nil
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func blank(line string) bool {
+	t := strings.TrimSpace(line)
+	return t == "" || strings.HasPrefix(t, "#")
+}
+
+// findField gives the index of the line with the field at the path,
+// or -1 if there isn't one.
+func findField(lines []string, fields []string) int {
+	start, end, parentIndent := 0, len(lines), -1
+	for depth, field := range fields {
+		found := -1
+		childIndent := -1
+		for i := start; i < end; i++ {
+			line := lines[i]
+			if blank(line) {
+				continue
+			}
+			indent := indentOf(line)
+			if indent <= parentIndent {
+				end = i
+				break
+			}
+			if childIndent < 0 {
+				childIndent = indent
+			}
+			if indent != childIndent {
+				continue
+			}
+			if m := fieldLineRE.FindStringSubmatch(line); m != nil && m[3] == field {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			return -1
+		}
+		if depth == len(fields)-1 {
+			return found
+		}
+		start, parentIndent = found+1, childIndent
+		end = len(lines)
+	}
+	return -1
+}
+
+// splitValue separates a scalar value from any quotes around it, and
+// any comment after it.
+func splitValue(v string) (value, quote, rest string) {
+	if strings.HasPrefix(v, `"`) || strings.HasPrefix(v, `'`) {
+		quote = v[:1]
+		if i := strings.Index(v[1:], quote); i >= 0 {
+			return v[1 : i+1], quote, v[i+2:]
+		}
+		return v[1:], quote, ""
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		return strings.TrimSpace(v[:i]), "", v[i:]
+	}
+	return strings.TrimSpace(v), "", ""
+}
+
+// ImageFieldValue gives the value of the field at the path in the
+// definition, if there is one.
+func ImageFieldValue(def []byte, path string) (string, bool, error) {
+	fields, err := ParseFieldPath(path)
+	if err != nil {
+		return "", false, err
+	}
+	lines := strings.Split(string(def), "\n")
+	i := findField(lines, fields)
+	if i < 0 {
+		return "", false, nil
+	}
+	m := fieldLineRE.FindStringSubmatch(lines[i])
+	value, _, _ := splitValue(m[5])
+	return value, value != "", nil
+}
+
+// UpdateImageField sets the value of the field at the path in the
+// definition to the image given, keeping any quotes and comments.
+func UpdateImageField(def []byte, path, newImage string) ([]byte, error) {
+	fields, err := ParseFieldPath(path)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(def), "\n")
+	i := findField(lines, fields)
+	if i < 0 {
+		return nil, fmt.Errorf("field %s not found", path)
+	}
+	m := fieldLineRE.FindStringSubmatch(lines[i])
+	_, quote, rest := splitValue(m[5])
+	keyPart := lines[i][:len(lines[i])-len(m[5])]
+	if m[4] == "" {
+		keyPart += " "
+	}
+	lines[i] = keyPart + quote + newImage + quote + rest
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// UpdateImageFields looks through the YAML files under path, within
+// the limits given, for resources with image fields, as given, holding an image from the
+// same repository as any of those given; and updates them to that
+// image. It returns a description of each change made. Files
+// encrypted with SOPS are decrypted and encrypted again if decrypt is
+// true, and otherwise left alone.
+func UpdateImageFields(path string, fields []flux.ImageField, images []flux.ImageID, decrypt bool, limits ScanLimits) ([]string, error) {
+	byRepo := map[string]flux.ImageID{}
+	for _, image := range images {
+		byRepo[image.Repository()] = image
+	}
+	byKind := map[string][]string{}
+	for _, f := range fields {
+		byKind[f.Kind] = append(byKind[f.Kind], f.Path)
+	}
+
+	var changes []string
+	err := walkYAML(path, limits, func(target string) error {
+		contents, encrypted, err := ReadDefinition(target, decrypt)
+		if errors.Cause(err) == ErrEncrypted {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Edit each document in turn, keeping the separators.
+		text := string(contents)
+		var (
+			out     []string
+			changed bool
+			prev    int
+		)
+		bounds := append(docSeparator.FindAllStringIndex(text, -1), []int{len(text), len(text)})
+		for _, b := range bounds {
+			doc := text[prev:b[0]]
+			obj, err := definitionObj([]byte(doc))
+			if err == nil {
+				for _, p := range byKind[obj.Kind] {
+					current, ok, err := ImageFieldValue([]byte(doc), p)
+					if err != nil {
+						return errors.Wrapf(err, "%s kind %s", target, obj.Kind)
+					}
+					if !ok {
+						continue
+					}
+					currentImage, err := flux.ParseImageID(current)
+					if err != nil {
+						continue
+					}
+					newImage, ok := byRepo[currentImage.Repository()]
+					if !ok || newImage.String() == current {
+						continue
+					}
+					updated, err := UpdateImageField([]byte(doc), p, newImage.String())
+					if err != nil {
+						return errors.Wrapf(err, "updating %s in %s", p, target)
+					}
+					doc = string(updated)
+					changed = true
+					changes = append(changes, fmt.Sprintf("%s %s %s: %s -> %s", obj.Kind, obj.Metadata.Name, p, current, newImage))
+				}
+			}
+			out = append(out, doc, text[b[0]:b[1]])
+			prev = b[1]
+		}
+		if !changed {
+			return nil
+		}
+		info, err := os.Stat(target)
+		if err != nil {
+			return err
+		}
+		return WriteDefinition(target, []byte(strings.Join(out, "")), encrypted, info.Mode())
+	})
+	return changes, err
+}
@@ -0,0 +1,56 @@
+package kubernetes
+
+import (
+	"testing"
+)
+
+const imageFieldCase = `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: helloworld-config
+  labels:
+    image: not-this-one
+data:
+  # the image the job runner uses
+  image: "quay.io/weaveworks/helloworld:master-a000001" # pinned
+  other: value
+`
+
+const imageFieldCaseOut = `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: helloworld-config
+  labels:
+    image: not-this-one
+data:
+  # the image the job runner uses
+  image: "quay.io/weaveworks/helloworld:master-a000002" # pinned
+  other: value
+`
+
+func TestImageFields(t *testing.T) {
+	v, ok, err := ImageFieldValue([]byte(imageFieldCase), "{.data.image}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || v != "quay.io/weaveworks/helloworld:master-a000001" {
+		t.Fatalf("expected image field value, got %q (found: %v)", v, ok)
+	}
+
+	out, err := UpdateImageField([]byte(imageFieldCase), ".data.image", "quay.io/weaveworks/helloworld:master-a000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != imageFieldCaseOut {
+		t.Errorf("did not get expected result, instead got\n\n%s", string(out))
+	}
+
+	if _, ok, _ := ImageFieldValue([]byte(imageFieldCase), "data.missing"); ok {
+		t.Error("expected no value for missing field")
+	}
+	if _, err := ParseFieldPath("{.spec.containers[0].image}"); err == nil {
+		t.Error("expected error for array indexing")
+	}
+}
@@ -174,13 +174,20 @@ func (c *Cluster) AllServices(namespace string, ignore flux.ServiceIDSet) (res [
 func (c *Cluster) makeService(ns string, service *api.Service, controllers []podController) platform.Service {
 	id := flux.MakeServiceID(ns, service.Name)
 	status, _ := c.status.getApplyProgress(id)
-	return platform.Service{
-		ID:         id,
-		IP:         service.Spec.ClusterIP,
-		Metadata:   metadataForService(service),
-		Containers: containersOrExcuse(service, controllers),
-		Status:     status,
+	s := platform.Service{
+		ID:          id,
+		IP:          service.Spec.ClusterIP,
+		Metadata:    metadataForService(service),
+		Labels:      service.Labels,
+		Annotations: service.Annotations,
+		Containers:  containersOrExcuse(service, controllers),
+		Status:      status,
 	}
+	if pc, err := matchController(service, controllers); err == nil {
+		s.ControllerKind = pc.kind()
+		s.Replicas = pc.replicas()
+	}
+	return s
 }
 
 func metadataForService(s *api.Service) map[string]string {
@@ -267,6 +274,26 @@ func (p podController) kind() string {
 	return "unknown"
 }
 
+// replicas gives the replica counts of the controller. Replication
+// controllers don't report availability, so for those, the replicas
+// running are counted as available.
+func (p podController) replicas() *flux.Replicas {
+	if p.Deployment != nil {
+		return &flux.Replicas{
+			Desired:   int(p.Deployment.Spec.Replicas),
+			Current:   int(p.Deployment.Status.Replicas),
+			Available: int(p.Deployment.Status.AvailableReplicas),
+		}
+	} else if p.ReplicationController != nil {
+		return &flux.Replicas{
+			Desired:   int(p.ReplicationController.Spec.Replicas),
+			Current:   int(p.ReplicationController.Status.Replicas),
+			Available: int(p.ReplicationController.Status.Replicas),
+		}
+	}
+	return nil
+}
+
 func (p podController) templateContainers() (res []platform.Container) {
 	var apiContainers []api.Container
 	if p.Deployment != nil {
@@ -276,7 +303,27 @@ func (p podController) templateContainers() (res []platform.Container) {
 	}
 
 	for _, c := range apiContainers {
-		res = append(res, platform.Container{Name: c.Name, Image: c.Image})
+		container := platform.Container{Name: c.Name, Image: c.Image}
+		if len(c.Env) > 0 {
+			container.Env = map[string]string{}
+			for _, e := range c.Env {
+				if e.ValueFrom != nil {
+					container.Env[e.Name] = platform.EnvValueFrom
+				} else {
+					container.Env[e.Name] = e.Value
+				}
+			}
+		}
+		if len(c.Resources.Limits)+len(c.Resources.Requests) > 0 {
+			container.Resources = map[string]string{}
+			for name, q := range c.Resources.Limits {
+				container.Resources["limits."+string(name)] = q.String()
+			}
+			for name, q := range c.Resources.Requests {
+				container.Resources["requests."+string(name)] = q.String()
+			}
+		}
+		res = append(res, container)
 	}
 	return res
 }
@@ -0,0 +1,87 @@
+package kubernetes
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+// imageLineRE matches a line giving an image, e.g., in a container
+// spec, possibly as the first field of a list item.
+var imageLineRE = regexp.MustCompile(`^(\s*(?:-\s+)?["']?image["']?:)(\s*)(.*)$`)
+
+// LineChange is a line of a definition changed, numbered from one.
+type LineChange struct {
+	Line int
+	Old  string
+	New  string
+}
+
+// MigrateImages moves the images given in the definition, in any field
+// named "image", to the repository migrated to, where they're in the
+// repository migrated from. Like UpdateImageField, it edits the
+// definition as text, keeping quotes and comments; it returns the
+// definition as updated, and the lines changed.
+func MigrateImages(def []byte, m flux.ImageMigration) ([]byte, []LineChange) {
+	lines := strings.Split(string(def), "\n")
+	var changes []LineChange
+	for i, line := range lines {
+		match := imageLineRE.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		value, quote, rest := splitValue(match[3])
+		if value == "" {
+			continue
+		}
+		id, err := flux.ParseImageID(value)
+		if err != nil {
+			continue
+		}
+		migrated, ok := m.Migrate(id)
+		if !ok {
+			continue
+		}
+		space := match[2]
+		if space == "" {
+			space = " "
+		}
+		lines[i] = match[1] + space + quote + migrated.String() + quote + rest
+		changes = append(changes, LineChange{Line: i + 1, Old: line, New: lines[i]})
+	}
+	if len(changes) == 0 {
+		return def, nil
+	}
+	return []byte(strings.Join(lines, "\n")), changes
+}
+
+// FindImageMigrations looks through the YAML files under path, within
+// the limits given, for images to migrate, and gives the lines that would change in each,
+// by the file's path relative to that given. Nothing is written.
+// Files encrypted with SOPS are decrypted if decrypt is true, and
+// otherwise left out.
+func FindImageMigrations(path string, m flux.ImageMigration, decrypt bool, limits ScanLimits) (map[string][]LineChange, error) {
+	res := map[string][]LineChange{}
+	err := walkYAML(path, limits, func(file string) error {
+		def, _, err := ReadDefinition(file, decrypt)
+		if errors.Cause(err) == ErrEncrypted {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, changes := MigrateImages(def, m); len(changes) > 0 {
+			rel, err := filepath.Rel(path, file)
+			if err != nil {
+				return err
+			}
+			res[rel] = changes
+		}
+		return nil
+	})
+	return res, err
+}
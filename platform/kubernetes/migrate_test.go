@@ -0,0 +1,70 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/flux"
+)
+
+const migrateDef = `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+spec:
+  template:
+    spec:
+      initContainers:
+      - image: busybox:1.27 # for the init
+        name: init
+      containers:
+      - name: helloworld
+        image: "quay.io/weaveworks/helloworld:master-a000001"
+      - name: sidecar
+        image: weaveworks/sidecar@sha256:6b9a2e31e4b5e6d1b2e0f8b6c6c7a6c0e8c9e0a1
+      - name: other
+        image: quay.io/weaveworksx/other:v1
+`
+
+func TestMigrateImages(t *testing.T) {
+	for i, c := range []struct {
+		migration flux.ImageMigration
+		changes   []LineChange
+	}{
+		{
+			flux.ImageMigration{From: "quay.io/weaveworks", To: "registry.example.com/weaveworks/"},
+			[]LineChange{{
+				Line: 13,
+				Old:  `        image: "quay.io/weaveworks/helloworld:master-a000001"`,
+				New:  `        image: "registry.example.com/weaveworks/helloworld:master-a000001"`,
+			}},
+		},
+		{
+			flux.ImageMigration{From: "docker.io", To: "registry.example.com/hub"},
+			[]LineChange{{
+				Line: 9,
+				Old:  `      - image: busybox:1.27 # for the init`,
+				New:  `      - image: registry.example.com/hub/library/busybox:1.27 # for the init`,
+			}, {
+				Line: 15,
+				Old:  `        image: weaveworks/sidecar@sha256:6b9a2e31e4b5e6d1b2e0f8b6c6c7a6c0e8c9e0a1`,
+				New:  `        image: registry.example.com/hub/weaveworks/sidecar@sha256:6b9a2e31e4b5e6d1b2e0f8b6c6c7a6c0e8c9e0a1`,
+			}},
+		},
+		{
+			flux.ImageMigration{From: "gcr.io", To: "registry.example.com"},
+			nil,
+		},
+	} {
+		def, changes := MigrateImages([]byte(migrateDef), c.migration)
+		if !reflect.DeepEqual(changes, c.changes) {
+			t.Errorf("%d: expected changes %#v, got %#v", i, c.changes, changes)
+		}
+		if len(c.changes) == 0 && string(def) != migrateDef {
+			t.Errorf("%d: definition changed, though nothing was to be migrated", i)
+		}
+		if again, more := MigrateImages(def, c.migration); len(more) > 0 || string(again) != string(def) {
+			t.Errorf("%d: migrating again changed %#v", i, more)
+		}
+	}
+}
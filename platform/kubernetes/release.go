@@ -93,6 +93,7 @@ func rollingUpgradeExec(def *api.ReplicationController, newDef *apiObject) apply
 			newDef,
 			"rolling-update",
 			"--update-period", "3s",
+			"--namespace", def.Namespace,
 			def.Name,
 			"-f", "-", // take definition from stdin
 		)
@@ -101,18 +102,19 @@ func rollingUpgradeExec(def *api.ReplicationController, newDef *apiObject) apply
 
 func deploymentExec(def *apiext.Deployment, newDef *apiObject) applyExecFunc {
 	return func(c *Cluster, logger log.Logger) error {
+		// The definition may not give a namespace, in which case it
+		// goes where the deployment already is.
 		err := c.doApplyCommand(
 			logger,
 			newDef,
-			"apply",
-			"-f", "-", // take definition from stdin
+			applyArgs(def.Namespace)..., // take definition from stdin
 		)
 
 		if err == nil {
 			args := []string{
 				"rollout", "status",
 				"deployment", newDef.Metadata.Name,
-				"--namespace", newDef.Metadata.Namespace,
+				"--namespace", def.Namespace,
 			}
 			cmd := c.kubectlCommand(args...)
 			logger.Log("cmd", strings.Join(args, " "))
@@ -0,0 +1,174 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/platform"
+)
+
+// Kinds of resource that run pods. These are released by updating
+// their images, rather than applied as they are.
+var workloadKinds = map[string]bool{
+	"Deployment":            true,
+	"ReplicationController": true,
+	"ReplicaSet":            true,
+	"DaemonSet":             true,
+	"StatefulSet":           true,
+	"PetSet":                true,
+	"Job":                   true,
+	"Pod":                   true,
+}
+
+// Some kinds of resource must exist before others can be created;
+// these are applied first, in this order. Anything else comes after.
+var kindOrder = []string{
+	"Namespace",
+	"CustomResourceDefinition",
+	"ThirdPartyResource",
+	"ServiceAccount",
+	"Secret",
+	"ConfigMap",
+	"PersistentVolumeClaim",
+	"Service",
+}
+
+func kindRank(kind string) int {
+	for i, k := range kindOrder {
+		if k == kind {
+			return i
+		}
+	}
+	return len(kindOrder)
+}
+
+var docSeparator = regexp.MustCompile(`(?m)^---.*$`)
+
+// NamespaceDefaulter gives the namespace to assume for resources
+// defined without one in the file given, as though the file were
+// applied with `kubectl -n`. If it's nil, or gives the empty string,
+// the namespace is "default".
+type NamespaceDefaulter func(file string) string
+
+func (d NamespaceDefaulter) namespaceFor(file string) string {
+	if d != nil {
+		if ns := d(file); ns != "" {
+			return ns
+		}
+	}
+	return "default"
+}
+
+// ResourcesIn finds the definitions of resources, other than
+// workloads, in the YAML files under path. Files may contain more than
+// one document. Files encrypted with SOPS are decrypted if decrypt is
+// true; otherwise, they're an error. Only the files within the limits
+// given are looked through.
+func ResourcesIn(path string, defaults NamespaceDefaulter, decrypt bool, limits ScanLimits) ([]platform.ResourceDefinition, error) {
+	var res []platform.ResourceDefinition
+	err := walkYAML(path, limits, func(target string) error {
+		contents, _, err := ReadDefinition(target, decrypt)
+		if err != nil {
+			return err
+		}
+		for _, doc := range docSeparator.Split(string(contents), -1) {
+			if strings.TrimSpace(doc) == "" {
+				continue
+			}
+			obj, err := definitionObj([]byte(doc))
+			if err != nil {
+				return errors.Wrapf(err, "parsing %s", target)
+			}
+			if obj.Kind == "" || obj.Metadata.Name == "" || workloadKinds[obj.Kind] {
+				continue
+			}
+			namespace := obj.Metadata.Namespace
+			if namespace == "" {
+				namespace = defaults.namespaceFor(target)
+			}
+			res = append(res, platform.ResourceDefinition{
+				ID:         fmt.Sprintf("%s/%s/%s", namespace, obj.Kind, obj.Metadata.Name),
+				Kind:       obj.Kind,
+				Namespace:  namespace,
+				Definition: []byte(doc),
+			})
+		}
+		return nil
+	})
+	return res, err
+}
+
+// ApplyResources applies the definitions given with `kubectl apply`,
+// each on its own so that failures can be attributed, namespaces and
+// resource types first. If there's a prune selector, everything is
+// then applied again together (a namespace at a time) with `--prune`,
+// so that kubectl deletes matching resources which aren't among the
+// definitions.
+func (c *Cluster) ApplyResources(set platform.ResourceSet) error {
+	errc := make(chan error)
+	c.actionc <- func() {
+		defs := make([]platform.ResourceDefinition, len(set.Definitions))
+		copy(defs, set.Definitions)
+		sort.Stable(byKindRank(defs))
+
+		logger := log.NewContext(c.logger).With("method", "ApplyResources")
+		var (
+			failed     []string
+			namespaces []string
+			all        = map[string]*bytes.Buffer{}
+		)
+		for _, def := range defs {
+			obj := &apiObject{bytes: def.Definition}
+			if err := c.doApplyCommand(log.NewContext(logger).With("resource", def.ID), obj, applyArgs(def.Namespace)...); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", def.ID, err))
+			}
+			buf, ok := all[def.Namespace]
+			if !ok {
+				buf = &bytes.Buffer{}
+				all[def.Namespace] = buf
+				namespaces = append(namespaces, def.Namespace)
+			}
+			buf.WriteString("---\n")
+			buf.Write(def.Definition)
+			buf.WriteString("\n")
+		}
+		if len(failed) > 0 {
+			errc <- fmt.Errorf("applying %d of %d resources failed: %s", len(failed), len(defs), strings.Join(failed, "; "))
+			return
+		}
+
+		if set.PruneSelector != "" {
+			for _, ns := range namespaces {
+				obj := &apiObject{bytes: all[ns].Bytes()}
+				if err := c.doApplyCommand(logger, obj, applyArgs(ns, "--prune", "-l", set.PruneSelector)...); err != nil {
+					errc <- errors.Wrap(err, "pruning resources")
+					return
+				}
+			}
+		}
+		errc <- nil
+	}
+	return <-errc
+}
+
+// applyArgs gives the arguments to `kubectl apply` definitions from
+// stdin, into the namespace given if they don't say otherwise.
+func applyArgs(namespace string, flags ...string) []string {
+	args := append([]string{"apply"}, flags...)
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	return append(args, "-f", "-")
+}
+
+type byKindRank []platform.ResourceDefinition
+
+func (d byKindRank) Len() int           { return len(d) }
+func (d byKindRank) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d byKindRank) Less(i, j int) bool { return kindRank(d[i].Kind) < kindRank(d[j].Kind) }
@@ -0,0 +1,80 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+const resourcesCase = `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: helloworld
+spec:
+  ports:
+  - port: 80
+---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: hello
+`
+
+func TestResourcesIn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-resources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "helloworld.yaml"), []byte(resourcesCase), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defs, err := ResourcesIn(dir, nil, false, ScanLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The deployment is a workload, so isn't included
+	if len(defs) != 2 {
+		t.Fatalf("expected 2 resources, got %d: %+v", len(defs), defs)
+	}
+	if defs[0].ID != "default/Service/helloworld" {
+		t.Errorf("unexpected ID %q", defs[0].ID)
+	}
+
+	// Namespaces go before anything else
+	sort.Stable(byKindRank(defs))
+	if defs[0].Kind != "Namespace" {
+		t.Errorf("expected namespace first, got %s", defs[0].Kind)
+	}
+}
+
+func TestResourcesInDefaultNamespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-resources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "helloworld.yaml"), []byte(resourcesCase), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defs, err := ResourcesIn(dir, func(string) string { return "hello" }, false, ScanLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 2 {
+		t.Fatalf("expected 2 resources, got %d: %+v", len(defs), defs)
+	}
+	if defs[0].ID != "hello/Service/helloworld" || defs[0].Namespace != "hello" {
+		t.Errorf("expected service to be put in the default namespace given, got %q (namespace %q)", defs[0].ID, defs[0].Namespace)
+	}
+}
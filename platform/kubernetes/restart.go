@@ -0,0 +1,77 @@
+package kubernetes
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RestartAnnotation is set, on the pod template of a pod controller,
+// to when its service was last restarted. Changing it has the pods
+// replaced, though nothing else about them has changed.
+const RestartAnnotation = "flux.weave.works/restarted-at"
+
+// SetRestartAnnotation sets the restart annotation in the pod
+// template of the definition to the time given, adding the
+// annotations, and the template's metadata, if need be. Like
+// UpdateImageField, it edits the definition as text, so assumes the
+// template is laid out in block style.
+func SetRestartAnnotation(def []byte, at time.Time) ([]byte, error) {
+	value := `"` + at.UTC().Format(time.RFC3339) + `"`
+	lines := strings.Split(string(def), "\n")
+	path := []string{"spec", "template", "metadata", "annotations", RestartAnnotation}
+
+	if i := findField(lines, path); i >= 0 {
+		m := fieldLineRE.FindStringSubmatch(lines[i])
+		_, _, rest := splitValue(m[5])
+		keyPart := lines[i][:len(lines[i])-len(m[5])]
+		if m[4] == "" {
+			keyPart += " "
+		}
+		lines[i] = keyPart + value + rest
+		return []byte(strings.Join(lines, "\n")), nil
+	}
+
+	// Find the deepest of the fields that's there, and add the rest
+	// under it.
+	for depth := len(path) - 1; depth >= 2; depth-- {
+		i := findField(lines, path[:depth])
+		if i < 0 {
+			continue
+		}
+		m := fieldLineRE.FindStringSubmatch(lines[i])
+		if v, _, _ := splitValue(m[5]); v != "" {
+			return nil, errors.New("the pod template's " + path[depth-1] + " are not in block style")
+		}
+		indent, step := indentOf(lines[i]), childIndent(lines, i)-indentOf(lines[i])
+		var added []string
+		for _, field := range path[depth : len(path)-1] {
+			indent += step
+			added = append(added, strings.Repeat(" ", indent)+field+":")
+		}
+		indent += step
+		added = append(added, strings.Repeat(" ", indent)+path[len(path)-1]+": "+value)
+
+		res := append([]string{}, lines[:i+1]...)
+		res = append(res, added...)
+		res = append(res, lines[i+1:]...)
+		return []byte(strings.Join(res, "\n")), nil
+	}
+	return nil, errors.New("no pod template found in definition")
+}
+
+// childIndent gives the indentation of the fields under the line
+// given, or, if there aren't any, two spaces more than the line.
+func childIndent(lines []string, i int) int {
+	for _, line := range lines[i+1:] {
+		if blank(line) {
+			continue
+		}
+		if indent := indentOf(line); indent > indentOf(lines[i]) {
+			return indent
+		}
+		break
+	}
+	return indentOf(lines[i]) + 2
+}
@@ -0,0 +1,85 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+)
+
+const restartCase = `---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+spec:
+  replicas: 2
+  template:
+    metadata:
+      labels:
+        name: helloworld
+    spec:
+      containers:
+      - name: helloworld
+        image: quay.io/weaveworks/helloworld:master-a000001
+`
+
+const restartCaseOut = `---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+spec:
+  replicas: 2
+  template:
+    metadata:
+      annotations:
+        flux.weave.works/restarted-at: "2017-06-01T12:00:00Z"
+      labels:
+        name: helloworld
+    spec:
+      containers:
+      - name: helloworld
+        image: quay.io/weaveworks/helloworld:master-a000001
+`
+
+const restartCaseAgainOut = `---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+spec:
+  replicas: 2
+  template:
+    metadata:
+      annotations:
+        flux.weave.works/restarted-at: "2017-06-02T12:00:00Z"
+      labels:
+        name: helloworld
+    spec:
+      containers:
+      - name: helloworld
+        image: quay.io/weaveworks/helloworld:master-a000001
+`
+
+func TestSetRestartAnnotation(t *testing.T) {
+	first := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	out, err := SetRestartAnnotation([]byte(restartCase), first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != restartCaseOut {
+		t.Errorf("expected:\n%s\ngot:\n%s", restartCaseOut, out)
+	}
+
+	// Restarting again replaces the annotation
+	out, err = SetRestartAnnotation(out, first.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != restartCaseAgainOut {
+		t.Errorf("expected:\n%s\ngot:\n%s", restartCaseAgainOut, out)
+	}
+
+	if _, err := SetRestartAnnotation([]byte("kind: ConfigMap\ndata:\n  a: b\n"), first); err == nil {
+		t.Error("expected an error for a definition without a pod template")
+	}
+}
@@ -0,0 +1,97 @@
+package kubernetes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrEncrypted is returned when reading a file encrypted with SOPS,
+// without asking for it to be decrypted.
+var ErrEncrypted = errors.New("file is encrypted with SOPS; enable SOPS decryption in the git config to use it")
+
+// SOPS adds its metadata to each document it encrypts, under a
+// top-level "sops" key.
+var (
+	sopsKey = regexp.MustCompile(`(?m)^sops:[ \t]*$`)
+	sopsMAC = regexp.MustCompile(`(?m)^[ \t]+mac:`)
+)
+
+// IsEncrypted says whether the contents of a file look to have been
+// encrypted with SOPS.
+func IsEncrypted(contents []byte) bool {
+	return sopsKey.Match(contents) && sopsMAC.Match(contents)
+}
+
+// ReadDefinition reads a resource definition file. If the file is
+// encrypted with SOPS, and decrypt is true, it's decrypted, which
+// needs sops, and the keys, to be available; if decrypt is false, it's
+// an error (ErrEncrypted), since the contents can't be used as they
+// are. It also says whether the file was encrypted, so that it can be
+// encrypted again when written.
+func ReadDefinition(path string, decrypt bool) (contents []byte, encrypted bool, err error) {
+	contents, err = ioutil.ReadFile(path)
+	if err != nil || !IsEncrypted(contents) {
+		return contents, false, err
+	}
+	if !decrypt {
+		return nil, true, errors.Wrap(ErrEncrypted, path)
+	}
+	out, err := runSOPS(path, "--decrypt", filepath.Base(path))
+	if err != nil {
+		return nil, true, errors.Wrapf(err, "decrypting %s", path)
+	}
+	return out, true, nil
+}
+
+// WriteDefinition writes a resource definition file, encrypting it
+// again with SOPS if it was encrypted when read. The keys to use are
+// found, as sops usually does, from the creation rules in a
+// .sops.yaml file. If encrypting fails, the file is left as it was, so
+// the plaintext can't be committed.
+func WriteDefinition(path string, contents []byte, encrypted bool, mode os.FileMode) error {
+	if !encrypted {
+		return ioutil.WriteFile(path, contents, mode)
+	}
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, contents, mode); err != nil {
+		return err
+	}
+	if _, err := runSOPS(path, "--encrypt", "--in-place", filepath.Base(path)); err != nil {
+		if restoreErr := ioutil.WriteFile(path, original, mode); restoreErr != nil {
+			return errors.Wrapf(restoreErr, "restoring %s after failing to encrypt it (%s)", path, err)
+		}
+		return errors.Wrapf(err, "encrypting %s", path)
+	}
+	return nil
+}
+
+// runSOPS runs sops in the directory of the file given, so that it
+// finds the .sops.yaml that applies to it, and returns its output.
+func runSOPS(path string, args ...string) ([]byte, error) {
+	bin, err := exec.LookPath("sops")
+	if err != nil {
+		return nil, errors.New("sops not found")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(bin, args...)
+	cmd.Dir = filepath.Dir(path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,52 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+const encryptedCase = `apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+data:
+  password: ENC[AES256_GCM,data:Tr7o=,iv:1=,tag:2=,type:str]
+sops:
+  kms: []
+  lastmodified: '2017-04-06T10:00:00Z'
+  mac: ENC[AES256_GCM,data:abc=,iv:3=,tag:4=,type:str]
+  version: 2.0.9
+`
+
+func TestIsEncrypted(t *testing.T) {
+	if !IsEncrypted([]byte(encryptedCase)) {
+		t.Error("expected SOPS-encrypted file to be recognised")
+	}
+	if IsEncrypted([]byte(resourcesCase)) {
+		t.Error("expected plain file not to be taken as encrypted")
+	}
+}
+
+func TestReadDefinitionEncrypted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-sops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secret.yaml")
+	if err := ioutil.WriteFile(path, []byte(encryptedCase), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, encrypted, err := ReadDefinition(path, false)
+	if errors.Cause(err) != ErrEncrypted {
+		t.Errorf("expected ErrEncrypted, got %v", err)
+	}
+	if !encrypted {
+		t.Error("expected file to be reported as encrypted")
+	}
+}
@@ -20,7 +20,15 @@ import (
 // the source to learn about them.
 func UpdatePodController(def []byte, newImageName string, trace io.Writer) ([]byte, error) {
 	var buf bytes.Buffer
-	err := tryUpdate(string(def), newImageName, trace, &buf)
+	err := tryUpdate(string(def), "", newImageName, trace, &buf)
+	return buf.Bytes(), err
+}
+
+// UpdateContainer is like UpdatePodController, but updates only the
+// named container, even if others use the same image.
+func UpdateContainer(def []byte, container, newImageName string, trace io.Writer) ([]byte, error) {
+	var buf bytes.Buffer
+	err := tryUpdate(string(def), container, newImageName, trace, &buf)
 	return buf.Bytes(), err
 }
 
@@ -33,7 +41,8 @@ func UpdatePodController(def []byte, newImageName string, trace io.Writer) ([]by
 //    same image; e.g., "weaveworks/helloworld:a00001" to
 //    "weaveworks/helloworld:a00002"
 //  * the container spec to update is the (first) one that uses the
-//    same image name (e.g., weaveworks/helloworld)
+//    same image name (e.g., weaveworks/helloworld), or the one with
+//    the container name given, if given
 //  * the name of the controller is updated to reflect the new tag
 //  * there's a label which must be updated in both the pod spec and the selector
 //  * the file uses canonical YAML syntax, that is, one line per item
@@ -67,8 +76,11 @@ func UpdatePodController(def []byte, newImageName string, trace io.Writer) ([]by
 //         ports:
 //         - containerPort: 80
 // ```
-func tryUpdate(def, newImageStr string, trace io.Writer, out io.Writer) error {
-	newImage := flux.ParseImageID(newImageStr)
+func tryUpdate(def, container, newImageStr string, trace io.Writer, out io.Writer) error {
+	newImage, err := flux.ParseImageID(newImageStr)
+	if err != nil {
+		return err
+	}
 
 	nameRE := multilineRE(
 		`metadata:\s*`,
@@ -81,9 +93,13 @@ func tryUpdate(def, newImageStr string, trace io.Writer, out io.Writer) error {
 	oldDefName := matches[1]
 	fmt.Fprintf(trace, "Found resource name %q in fragment:\n\n%s\n\n", oldDefName, matches[0])
 
+	containerNameRE := `[\w-]+`
+	if container != "" {
+		containerNameRE = regexp.QuoteMeta(container)
+	}
 	imageRE := multilineRE(
 		`      containers:.*`,
-		`(?:      .*\n)*(?:  ){3,4}- name:\s*"?([\w-]+)"?(?:\s.*)?`,
+		`(?:      .*\n)*(?:  ){3,4}- name:\s*"?(`+containerNameRE+`)"?(?:\s.*)?`,
 		`(?:  ){4,5}image:\s*"?(`+newImage.Repository()+`:[\w][\w.-]{0,127})"?(\s.*)?`,
 	)
 	// tag part of regexp from
@@ -91,10 +107,16 @@ func tryUpdate(def, newImageStr string, trace io.Writer, out io.Writer) error {
 
 	matches = imageRE.FindStringSubmatch(def)
 	if matches == nil || len(matches) < 3 {
+		if container != "" {
+			return fmt.Errorf("Could not find container %q using image %s", container, newImage.Repository())
+		}
 		return fmt.Errorf("Could not find image name")
 	}
 	containerName := matches[1]
-	oldImage := flux.ParseImageID(matches[2])
+	oldImage, err := flux.ParseImageID(matches[2])
+	if err != nil {
+		return err
+	}
 	fmt.Fprintf(trace, "Found container %q using image %v in fragment:\n\n%s\n\n", containerName, oldImage, matches[0])
 
 	if oldImage.Repository() != newImage.Repository() {
@@ -145,7 +167,7 @@ func tryUpdate(def, newImageStr string, trace io.Writer, out io.Writer) error {
 		`((?:  ){3,4}- name:\s*`+containerName+`)`,
 		`((?:  ){4,5}image:\s*) .*`,
 	)
-	replaceImage := fmt.Sprintf("$1\n$2 %s$3", string(newImage))
+	replaceImage := fmt.Sprintf("$1\n$2 %s$3", newImage.String())
 	withNewImage := replaceImageRE.ReplaceAllString(withNewLabels, replaceImage)
 
 	fmt.Fprint(out, withNewImage)
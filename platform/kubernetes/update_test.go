@@ -2,14 +2,18 @@ package kubernetes
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
 )
 
+var updateGolden = flag.Bool("update-golden", false, "rewrite the expected output of the update cases in testdata/update")
+
 func testUpdate(t *testing.T, name, caseIn, updatedImage, caseOut string) {
 	var trace, out bytes.Buffer
-	if err := tryUpdate(caseIn, updatedImage, &trace, &out); err != nil {
+	if err := tryUpdate(caseIn, "", updatedImage, &trace, &out); err != nil {
 		fmt.Fprintln(os.Stderr, "Failed:", name)
 		fmt.Fprintf(os.Stderr, "--- TRACE ---\n"+trace.String()+"\n---\n")
 		t.Fatal(err)
@@ -33,6 +37,38 @@ func TestUpdates(t *testing.T) {
 	}
 }
 
+func TestUpdateContainer(t *testing.T) {
+	out, err := UpdateContainer([]byte(case5), "sidecar", case5image, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != case5out {
+		t.Fatalf("Did not get expected result, instead got\n\n%s", string(out))
+	}
+
+	if _, err := UpdateContainer([]byte(case5), "nonesuch", case5image, ioutil.Discard); err == nil {
+		t.Error("expected error updating a container that isn't there")
+	}
+}
+
+func TestGoldenUpdates(t *testing.T) {
+	cases, err := ReadUpdateCases("testdata/update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		if *updateGolden {
+			if err := c.WriteOut(); err != nil {
+				t.Error(err)
+			}
+			continue
+		}
+		if err := c.Check(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
 // Unusual but still valid indentation between containers: and the
 // next line
 const case1 = `---
@@ -321,3 +357,46 @@ spec:
               - all
           readOnlyRootFilesystem: true
 `
+
+// Two containers using the same image; only one is to be updated
+const case5 = `---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+spec:
+  template:
+    metadata:
+      labels:
+        name: helloworld
+    spec:
+      containers:
+      - name: helloworld
+        image: quay.io/weaveworks/helloworld:master-a000001
+      - name: sidecar
+        image: quay.io/weaveworks/helloworld:master-a000001
+        args:
+        - --sidecar
+`
+
+const case5image = "quay.io/weaveworks/helloworld:master-a000002"
+
+const case5out = `---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+spec:
+  template:
+    metadata:
+      labels:
+        name: helloworld
+    spec:
+      containers:
+      - name: helloworld
+        image: quay.io/weaveworks/helloworld:master-a000001
+      - name: sidecar
+        image: quay.io/weaveworks/helloworld:master-a000002
+        args:
+        - --sidecar
+`
@@ -0,0 +1,152 @@
+package kubernetes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ScanLimits limit which of the files under a path are looked through
+// for resource definitions, so that big repos (e.g., with vendored
+// code, or charts full of CRDs) don't take minutes to look through.
+// The zero value looks through everything.
+type ScanLimits struct {
+	// Base is the directory Ignore patterns are relative to; if
+	// empty, it's the path looked through.
+	Base string
+	// Ignore lists patterns, as in .gitignore, of files and
+	// directories not to look in: a pattern with a slash, other
+	// than a trailing one, is matched against the whole path
+	// relative to Base, and otherwise against the name alone, at
+	// any depth; a pattern with a trailing slash only matches
+	// directories. Directories ignored aren't read at all.
+	Ignore []string
+	// MaxDepth, if not zero, is how many directories deep to look.
+	MaxDepth int
+	// MaxFiles, if not zero, is how many YAML files may be looked
+	// through; finding more is an error, rather than a slow release.
+	MaxFiles int
+}
+
+// ignored says whether the file or directory at rel, relative to
+// Base, matches one of the Ignore patterns.
+func (l ScanLimits) ignored(rel string, dir bool) bool {
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range l.Ignore {
+		if strings.HasSuffix(pattern, "/") {
+			if !dir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		name := path.Base(rel)
+		if strings.Contains(pattern, "/") {
+			pattern, name = strings.TrimPrefix(pattern, "/"), rel
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// walkYAML calls fn with each YAML file under root, skipping hidden
+// directories, and those files and directories left out by the limits
+// given. Symlinks are followed, so long as they lead somewhere else
+// under root; e.g., to a shared library of manifests kept as a git
+// submodule. Each file is visited once, however many ways there are of
+// reaching it. If root is itself a file, only that is visited.
+func walkYAML(root string, limits ScanLimits, fn func(path string) error) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(realRoot); err != nil {
+		return err
+	} else if !info.IsDir() {
+		if ext := filepath.Ext(root); ext == ".yaml" || ext == ".yml" {
+			return fn(root)
+		}
+		return nil
+	}
+	seen := map[string]bool{}
+	base := limits.Base
+	if base == "" {
+		base = root
+	}
+	skip := func(target string, dir bool) bool {
+		if len(limits.Ignore) == 0 {
+			return false
+		}
+		rel, err := filepath.Rel(base, target)
+		return err == nil && limits.ignored(rel, dir)
+	}
+	files := 0
+
+	var walk func(dir string, depth int) error
+	walk = func(dir string, depth int) error {
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil || seen[real] {
+			return err
+		}
+		seen[real] = true
+
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			target := filepath.Join(dir, entry.Name())
+			info := entry
+			if entry.Mode()&os.ModeSymlink != 0 {
+				resolved, err := filepath.EvalSymlinks(target)
+				if err != nil || !within(realRoot, resolved) {
+					continue // dangling, or leads outside the root
+				}
+				if info, err = os.Stat(resolved); err != nil {
+					continue
+				}
+				if !info.IsDir() {
+					if seen[resolved] {
+						continue
+					}
+					seen[resolved] = true
+				}
+			} else if !info.IsDir() {
+				if seen[filepath.Join(real, entry.Name())] {
+					continue
+				}
+				seen[filepath.Join(real, entry.Name())] = true
+			}
+
+			if info.IsDir() {
+				if strings.HasPrefix(entry.Name(), ".") || (limits.MaxDepth > 0 && depth >= limits.MaxDepth) || skip(target, true) {
+					continue
+				}
+				if err := walk(target, depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+			if ext := filepath.Ext(target); (ext == ".yaml" || ext == ".yml") && !skip(target, false) {
+				if files++; limits.MaxFiles > 0 && files > limits.MaxFiles {
+					return fmt.Errorf("more than %d YAML files under %s; ignore some of them, or raise the limit", limits.MaxFiles, root)
+				}
+				if err := fn(target); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return walk(root, 0)
+}
+
+// within says whether path is root, or under it.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,70 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWalkYAMLLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-walk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, file := range []string{
+		"app.yaml",
+		"crds/thing.yaml",
+		"team/svc.yaml",
+		"team/crds/other.yaml",
+		"team/deep/down/svc.yaml",
+		"vendor/lib/chart.yaml",
+		"generated.yaml",
+	} {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	walk := func(limits ScanLimits) ([]string, error) {
+		var res []string
+		err := walkYAML(dir, limits, func(path string) error {
+			rel, _ := filepath.Rel(dir, path)
+			res = append(res, filepath.ToSlash(rel))
+			return nil
+		})
+		sort.Strings(res)
+		return res, err
+	}
+
+	for i, c := range []struct {
+		limits   ScanLimits
+		expected []string
+	}{
+		{ScanLimits{Ignore: []string{"vendor/", "crds/", "generated.yaml"}}, []string{"app.yaml", "team/deep/down/svc.yaml", "team/svc.yaml"}},
+		{ScanLimits{Ignore: []string{"/crds", "team/deep"}}, []string{"app.yaml", "generated.yaml", "team/crds/other.yaml", "team/svc.yaml", "vendor/lib/chart.yaml"}},
+		{ScanLimits{MaxDepth: 1}, []string{"app.yaml", "crds/thing.yaml", "generated.yaml", "team/svc.yaml"}},
+	} {
+		files, err := walk(c.limits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(files, c.expected) {
+			t.Errorf("%d: expected %v, got %v", i, c.expected, files)
+		}
+	}
+
+	if _, err := walk(ScanLimits{MaxFiles: 3}); err == nil || !strings.Contains(err.Error(), "more than 3") {
+		t.Errorf("expected too many files to be an error, got %v", err)
+	}
+	if _, err := walk(ScanLimits{MaxFiles: 3, Ignore: []string{"team/", "vendor/", "crds/"}}); err != nil {
+		t.Errorf("expected files ignored not to count, got %v", err)
+	}
+}
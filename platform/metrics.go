@@ -67,6 +67,26 @@ func (i *instrumentedPlatform) Apply(defs []ServiceDefinition) (err error) {
 	return i.p.Apply(defs)
 }
 
+func (i *instrumentedPlatform) ApplyResources(set ResourceSet) (err error) {
+	defer func(begin time.Time) {
+		i.m.RequestDuration.With(
+			fluxmetrics.LabelMethod, "ApplyResources",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.p.ApplyResources(set)
+}
+
+func (i *instrumentedPlatform) DryRunApply(defs []ServiceDefinition) (res DryRunResult, err error) {
+	defer func(begin time.Time) {
+		i.m.RequestDuration.With(
+			fluxmetrics.LabelMethod, "DryRunApply",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.p.DryRunApply(defs)
+}
+
 func (i *instrumentedPlatform) Ping() (err error) {
 	defer func(begin time.Time) {
 		i.m.RequestDuration.With(
@@ -90,6 +110,7 @@ func (i *instrumentedPlatform) Version() (v string, err error) {
 // BusMetrics has metrics for messages buses.
 type BusMetrics struct {
 	KickCount metrics.Counter
+	Labels    fluxmetrics.LabelPolicy
 }
 
 func NewBusMetrics() BusMetrics {
@@ -104,5 +125,5 @@ func NewBusMetrics() BusMetrics {
 }
 
 func (m BusMetrics) IncrKicks(inst flux.InstanceID) {
-	m.KickCount.With(fluxmetrics.LabelInstanceID, string(inst)).Add(1)
+	m.KickCount.With(fluxmetrics.LabelInstanceID, m.Labels.Instance(string(inst))).Add(1)
 }
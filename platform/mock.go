@@ -16,6 +16,13 @@ type MockPlatform struct {
 	ApplyArgTest func([]ServiceDefinition) error
 	ApplyError   error
 
+	ApplyResourcesArgTest func(ResourceSet) error
+	ApplyResourcesError   error
+
+	DryRunApplyArgTest func([]ServiceDefinition) error
+	DryRunApplyAnswer  DryRunResult
+	DryRunApplyError   error
+
 	PingError error
 
 	VersionAnswer string
@@ -49,6 +56,24 @@ func (p *MockPlatform) Apply(defs []ServiceDefinition) error {
 	return p.ApplyError
 }
 
+func (p *MockPlatform) ApplyResources(set ResourceSet) error {
+	if p.ApplyResourcesArgTest != nil {
+		if err := p.ApplyResourcesArgTest(set); err != nil {
+			return err
+		}
+	}
+	return p.ApplyResourcesError
+}
+
+func (p *MockPlatform) DryRunApply(defs []ServiceDefinition) (DryRunResult, error) {
+	if p.DryRunApplyArgTest != nil {
+		if err := p.DryRunApplyArgTest(defs); err != nil {
+			return nil, err
+		}
+	}
+	return p.DryRunApplyAnswer, p.DryRunApplyError
+}
+
 func (p *MockPlatform) Ping() error {
 	return p.PingError
 }
@@ -5,6 +5,7 @@ package platform
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -14,6 +15,7 @@ import (
 
 var (
 	ErrPlatformNotAvailable = errors.New("Platform is not available")
+	ErrDryRunUnsupported    = errors.New("Platform does not support server-side dry runs")
 )
 
 // Platform is the interface various platforms fulfill, e.g.
@@ -22,6 +24,8 @@ type Platform interface {
 	AllServices(maybeNamespace string, ignored flux.ServiceIDSet) ([]Service, error)
 	SomeServices([]flux.ServiceID) ([]Service, error)
 	Apply([]ServiceDefinition) error
+	ApplyResources(ResourceSet) error
+	DryRunApply([]ServiceDefinition) (DryRunResult, error)
 	Ping() error
 	Version() (string, error)
 }
@@ -70,15 +74,81 @@ type Service struct {
 	Metadata map[string]string // a grab bag of goodies, likely platform-specific
 	Status   string            // A status summary for display
 
+	// Labels and annotations of the service itself, so that they can
+	// be used in selecting services without going back to the
+	// platform.
+	Labels      map[string]string
+	Annotations map[string]string
+	// The kind of pod controller running the service, if one was
+	// found, and its replica counts.
+	ControllerKind string
+	Replicas       *flux.Replicas
+
 	Containers ContainersOrExcuse
 }
 
 // A Container represents a container specification in a pod. The Name
 // identifies it within the pod, and the Image says which image it's
-// configured to run.
+// configured to run. Env and Resources are compared with those in the
+// config repo when releasing, to spot changes made directly to the
+// cluster.
 type Container struct {
-	Name  string
-	Image string
+	Name      string
+	Image     string
+	Env       map[string]string `json:",omitempty"`
+	Resources map[string]string `json:",omitempty"` // e.g., "limits.cpu": "100m"
+}
+
+// EnvValueFrom stands in for the value of an environment variable
+// taken from elsewhere (a secret, say), rather than given literally.
+const EnvValueFrom = "<valueFrom>"
+
+// DiffContainers reports how the environment and resources of the
+// containers in a definition differ from those running. Images are
+// ignored, since those are expected to differ when releasing, as are
+// containers not in both.
+func DiffContainers(defined, running []Container) []string {
+	byName := map[string]Container{}
+	for _, c := range running {
+		byName[c.Name] = c
+	}
+	var res []string
+	for _, d := range defined {
+		r, ok := byName[d.Name]
+		if !ok {
+			continue
+		}
+		res = append(res, diffMap(d.Name, "env", d.Env, r.Env)...)
+		res = append(res, diffMap(d.Name, "resources", d.Resources, r.Resources)...)
+	}
+	return res
+}
+
+func diffMap(container, what string, defined, running map[string]string) []string {
+	var keys []string
+	for k := range defined {
+		keys = append(keys, k)
+	}
+	for k := range running {
+		if _, ok := defined[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var res []string
+	for _, k := range keys {
+		d, inDef := defined[k]
+		r, inRunning := running[k]
+		switch {
+		case !inDef:
+			res = append(res, fmt.Sprintf("container %s: %s %s=%q is set in the cluster but not in the config repo", container, what, k, r))
+		case !inRunning:
+			res = append(res, fmt.Sprintf("container %s: %s %s=%q is in the config repo but not set in the cluster", container, what, k, d))
+		case d != r:
+			res = append(res, fmt.Sprintf("container %s: %s %s is %q in the config repo but %q in the cluster", container, what, k, d, r))
+		}
+	}
+	return res
 }
 
 // Sometimes we care if we can't find the containers for a service,
@@ -119,6 +189,31 @@ type ServiceDefinition struct {
 	NewDefinition []byte // of the pod controller e.g. deployment
 }
 
+// ResourceDefinition is the definition of a resource other than a
+// pod controller, e.g., a ConfigMap, Service or Ingress, to be applied
+// as it is.
+type ResourceDefinition struct {
+	ID         string // "<namespace>/<kind>/<name>"; for reporting
+	Kind       string
+	Namespace  string // where to apply it, if the definition doesn't say
+	Definition []byte
+}
+
+// ResourceSet is given to platform.ApplyResources. The platform
+// decides the order in which to apply the definitions; e.g.,
+// namespaces and resource types go before anything else.
+type ResourceSet struct {
+	Definitions []ResourceDefinition
+	// If PruneSelector is not empty, resources matching it (as a
+	// label selector) that aren't among the definitions are deleted.
+	PruneSelector string
+}
+
+// DryRunResult describes, for each service, what applying its new
+// definition would change. It is returned from platform.DryRunApply;
+// definitions which would be rejected are reported in an ApplyError.
+type DryRunResult map[flux.ServiceID]string
+
 type ApplyError map[flux.ServiceID]error
 
 func (e ApplyError) Error() string {
@@ -68,6 +68,45 @@ func (p *RPCClient) Apply(defs []platform.ServiceDefinition) error {
 	return nil
 }
 
+// ApplyResources tells the remote platform to apply some resource
+// definitions other than those of pod controllers.
+func (p *RPCClient) ApplyResources(set platform.ResourceSet) error {
+	err := p.client.Call("RPCServer.ApplyResources", set, nil)
+	if _, ok := err.(rpc.ServerError); !ok && err != nil {
+		err = platform.FatalError{err}
+	}
+	return err
+}
+
+// DryRunApply asks the remote platform to validate some new service
+// definitions, without applying them.
+func (p *RPCClient) DryRunApply(defs []platform.ServiceDefinition) (platform.DryRunResult, error) {
+	var resp DryRunResponse
+	if err := p.client.Call("RPCServer.DryRunApply", defs, &resp); err != nil {
+		if _, ok := err.(rpc.ServerError); !ok {
+			return nil, platform.FatalError{err}
+		} else if err.Error() == "rpc: can't find method RPCServer.DryRunApply" {
+			// An older fluxd
+			return nil, platform.ErrDryRunUnsupported
+		} else if err.Error() == platform.ErrDryRunUnsupported.Error() {
+			return nil, platform.ErrDryRunUnsupported
+		}
+		return nil, err
+	}
+	return resp.Result, dryRunErrors(resp.Errors)
+}
+
+func dryRunErrors(result ApplyResult) error {
+	if len(result) == 0 {
+		return nil
+	}
+	errs := platform.ApplyError{}
+	for s, e := range result {
+		errs[s] = errors.New(e)
+	}
+	return errs
+}
+
 // Ping is used to check if the remote platform is available.
 func (p *RPCClient) Ping() error {
 	err := p.client.Call("RPCServer.Ping", struct{}{}, nil)
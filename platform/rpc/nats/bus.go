@@ -2,6 +2,7 @@ package nats
 
 import (
 	"errors"
+	"fmt"
 	"net/rpc"
 	"strings"
 	"time"
@@ -15,10 +16,11 @@ import (
 )
 
 const (
-	timeout      = 5 * time.Second
-	applyTimeout = 20 * time.Minute
-	presenceTick = 50 * time.Millisecond
-	encoderType  = nats.JSON_ENCODER
+	timeout       = 5 * time.Second
+	applyTimeout  = 20 * time.Minute
+	dryRunTimeout = time.Minute
+	presenceTick  = 50 * time.Millisecond
+	encoderType   = nats.JSON_ENCODER
 
 	methodKick         = ".Platform.Kick"
 	methodPing         = ".Platform.Ping"
@@ -26,6 +28,8 @@ const (
 	methodAllServices  = ".Platform.AllServices"
 	methodSomeServices = ".Platform.SomeServices"
 	methodApply        = ".Platform.Apply"
+	methodApplyRes     = ".Platform.ApplyResources"
+	methodDryRunApply  = ".Platform.DryRunApply"
 )
 
 type NATS struct {
@@ -58,6 +62,15 @@ func NewMessageBus(url string, metrics platform.BusMetrics) (*NATS, error) {
 	}, nil
 }
 
+// Connected returns an error if the connection to the NATS server
+// is down, e.g., while reconnecting.
+func (n *NATS) Connected() error {
+	if !n.raw.IsConnected() {
+		return fmt.Errorf("not connected to NATS at %s", n.url)
+	}
+	return nil
+}
+
 // Wait up to `timeout` for a particular instance to connect. Mostly
 // useful for synchronising during testing.
 func (n *NATS) AwaitPresence(instID flux.InstanceID, timeout time.Duration) error {
@@ -111,6 +124,15 @@ type ApplyResponse struct {
 	ErrorResponse
 }
 
+type ApplyResourcesResponse struct {
+	ErrorResponse
+}
+
+type DryRunApplyResponse struct {
+	fluxrpc.DryRunResponse
+	ErrorResponse
+}
+
 type ping struct{}
 
 type PingResponse struct {
@@ -191,6 +213,37 @@ func (r *natsPlatform) Apply(specs []platform.ServiceDefinition) error {
 	return extractError(response.ErrorResponse)
 }
 
+// ApplyResources has the same long timeout as Apply, for the same
+// reasons.
+func (r *natsPlatform) ApplyResources(set platform.ResourceSet) error {
+	var response ApplyResourcesResponse
+	if err := r.conn.Request(r.instance+methodApplyRes, set, &response, applyTimeout); err != nil {
+		return err
+	}
+	return extractError(response.ErrorResponse)
+}
+
+func (r *natsPlatform) DryRunApply(specs []platform.ServiceDefinition) (platform.DryRunResult, error) {
+	var response DryRunApplyResponse
+	if err := r.conn.Request(r.instance+methodDryRunApply, specs, &response, dryRunTimeout); err != nil {
+		return nil, err
+	}
+	if err := extractError(response.ErrorResponse); err != nil {
+		if err.Error() == platform.ErrDryRunUnsupported.Error() {
+			return nil, platform.ErrDryRunUnsupported
+		}
+		return nil, err
+	}
+	if len(response.Errors) > 0 {
+		errs := platform.ApplyError{}
+		for s, e := range response.Errors {
+			errs[s] = errors.New(e)
+		}
+		return response.Result, errs
+	}
+	return response.Result, nil
+}
+
 func (r *natsPlatform) Ping() error {
 	var response PingResponse
 	if err := r.conn.Request(r.instance+methodPing, ping{}, &response, timeout); err != nil {
@@ -277,6 +330,36 @@ func (n *NATS) Subscribe(instID flux.InstanceID, remote platform.Platform, done
 					res, err = remote.SomeServices(req)
 				}
 				n.enc.Publish(request.Reply, SomeServicesResponse{res, makeErrorResponse(err)})
+			case strings.HasSuffix(request.Subject, methodDryRunApply):
+				var (
+					req []platform.ServiceDefinition
+					res platform.DryRunResult
+				)
+				err = encoder.Decode(request.Subject, request.Data, &req)
+				if err == nil {
+					res, err = remote.DryRunApply(req)
+				}
+				response := DryRunApplyResponse{}
+				response.Result = res
+				switch applyErr := err.(type) {
+				case platform.ApplyError:
+					response.Errors = fluxrpc.ApplyResult{}
+					for s, e := range applyErr {
+						response.Errors[s] = e.Error()
+					}
+				default:
+					response.ErrorResponse = makeErrorResponse(err)
+				}
+				n.enc.Publish(request.Reply, response)
+			case strings.HasSuffix(request.Subject, methodApplyRes):
+				var (
+					req platform.ResourceSet
+				)
+				err = encoder.Decode(request.Subject, request.Data, &req)
+				if err == nil {
+					err = remote.ApplyResources(req)
+				}
+				n.enc.Publish(request.Reply, ApplyResourcesResponse{makeErrorResponse(err)})
 			case strings.HasSuffix(request.Subject, methodApply):
 				var (
 					req []platform.ServiceDefinition
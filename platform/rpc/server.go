@@ -13,6 +13,13 @@ import (
 // reconstitute them on the other side.
 type ApplyResult map[flux.ServiceID]string
 
+// DryRunResponse carries what would change, and any rejections, from
+// a dry-run apply.
+type DryRunResponse struct {
+	Result platform.DryRunResult
+	Errors ApplyResult
+}
+
 // Server takes a platform and makes it available over RPC.
 type Server struct {
 	server *rpc.Server
@@ -65,6 +72,23 @@ func (p *RPCServer) SomeServices(ids []flux.ServiceID, resp *[]platform.Service)
 	return err
 }
 
+func (p *RPCServer) ApplyResources(set platform.ResourceSet, _ *struct{}) error {
+	return p.p.ApplyResources(set)
+}
+
+func (p *RPCServer) DryRunApply(defs []platform.ServiceDefinition, resp *DryRunResponse) error {
+	res, err := p.p.DryRunApply(defs)
+	resp.Result = res
+	if applyErr, ok := err.(platform.ApplyError); ok {
+		resp.Errors = ApplyResult{}
+		for s, e := range applyErr {
+			resp.Errors[s] = e.Error()
+		}
+		err = nil
+	}
+	return err
+}
+
 // Regrade is still around for backwards compatibility, though it is called "Apply" everywhere else.
 func (p *RPCServer) Regrade(defs []platform.ServiceDefinition, applyResult *ApplyResult) error {
 	return p.Apply(defs, applyResult)
@@ -0,0 +1,96 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+// ErrSimulated is returned when something tries to change a platform
+// which is only a snapshot.
+var ErrSimulated = errors.New("platform is a recorded snapshot; it cannot be changed")
+
+// Snapshot is the state of a platform's services (and their
+// containers) at a point in time. It can be recorded, and the planner
+// run against it later without a connection to the platform.
+type Snapshot struct {
+	Taken    time.Time
+	Services []Service
+}
+
+// TakeSnapshot records the services the platform is running, in the
+// namespace given, or in all namespaces if that's empty.
+func TakeSnapshot(p Platform, namespace string) (Snapshot, error) {
+	services, err := p.AllServices(namespace, flux.ServiceIDSet{})
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{
+		Taken:    time.Now().UTC(),
+		Services: services,
+	}, nil
+}
+
+// SnapshotPlatform is a Platform answering questions from a
+// snapshot. It refuses to apply anything.
+type SnapshotPlatform struct {
+	snapshot Snapshot
+}
+
+func NewSnapshotPlatform(snapshot Snapshot) *SnapshotPlatform {
+	return &SnapshotPlatform{snapshot}
+}
+
+func (p *SnapshotPlatform) AllServices(namespace string, ignore flux.ServiceIDSet) ([]Service, error) {
+	var res []Service
+	for _, s := range p.snapshot.Services {
+		ns, _ := s.ID.Components()
+		if (namespace == "" || ns == namespace) && !ignore.Contains(s.ID) {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+func (p *SnapshotPlatform) SomeServices(ids []flux.ServiceID) ([]Service, error) {
+	var res []Service
+	for _, id := range ids {
+		s, ok := p.service(id)
+		if !ok {
+			return nil, fmt.Errorf("service %s is not in the snapshot", id)
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+func (p *SnapshotPlatform) service(id flux.ServiceID) (Service, bool) {
+	for _, s := range p.snapshot.Services {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return Service{}, false
+}
+
+func (p *SnapshotPlatform) Apply([]ServiceDefinition) error {
+	return ErrSimulated
+}
+
+func (p *SnapshotPlatform) ApplyResources(ResourceSet) error {
+	return ErrSimulated
+}
+
+func (p *SnapshotPlatform) DryRunApply([]ServiceDefinition) (DryRunResult, error) {
+	return nil, ErrSimulated
+}
+
+func (p *SnapshotPlatform) Ping() error {
+	return nil
+}
+
+func (p *SnapshotPlatform) Version() (string, error) {
+	return "snapshot taken " + p.snapshot.Taken.Format(time.RFC3339), nil
+}
@@ -0,0 +1,34 @@
+package platform
+
+import (
+	"testing"
+
+	"github.com/weaveworks/flux"
+)
+
+func TestSnapshotPlatform(t *testing.T) {
+	snapshot, err := TakeSnapshot(&MockPlatform{
+		AllServicesAnswer: []Service{
+			{ID: "default/helloworld"},
+			{ID: "prod/helloworld"},
+		},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewSnapshotPlatform(snapshot)
+
+	services, err := p.AllServices("prod", flux.ServiceIDSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || services[0].ID != "prod/helloworld" {
+		t.Errorf("expected only prod/helloworld, got %+v", services)
+	}
+	if _, err := p.SomeServices([]flux.ServiceID{"default/missing"}); err == nil {
+		t.Error("expected error for service not in snapshot, got nil")
+	}
+	if err := p.Apply(nil); err != ErrSimulated {
+		t.Errorf("expected ErrSimulated, got %v", err)
+	}
+}
@@ -146,6 +146,24 @@ func (p *removeablePlatform) Apply(defs []ServiceDefinition) (err error) {
 	return p.remote.Apply(defs)
 }
 
+func (p *removeablePlatform) ApplyResources(set ResourceSet) (err error) {
+	defer func() {
+		if _, ok := err.(FatalError); ok {
+			p.closeWithError(err)
+		}
+	}()
+	return p.remote.ApplyResources(set)
+}
+
+func (p *removeablePlatform) DryRunApply(defs []ServiceDefinition) (res DryRunResult, err error) {
+	defer func() {
+		if _, ok := err.(FatalError); ok {
+			p.closeWithError(err)
+		}
+	}()
+	return p.remote.DryRunApply(defs)
+}
+
 func (p *removeablePlatform) Ping() (err error) {
 	defer func() {
 		if _, ok := err.(FatalError); ok {
@@ -178,6 +196,14 @@ func (p disconnectedPlatform) Apply([]ServiceDefinition) error {
 	return ErrPlatformNotAvailable
 }
 
+func (p disconnectedPlatform) ApplyResources(ResourceSet) error {
+	return ErrPlatformNotAvailable
+}
+
+func (p disconnectedPlatform) DryRunApply([]ServiceDefinition) (DryRunResult, error) {
+	return nil, ErrPlatformNotAvailable
+}
+
 func (p disconnectedPlatform) Ping() error {
 	return ErrPlatformNotAvailable
 }
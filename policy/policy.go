@@ -0,0 +1,109 @@
+// Package policy asks Open Policy Agent (OPA) whether releases may go
+// ahead, as planned.
+//
+// The policy is queried through OPA's data API, with the release as
+// input. It can deny the release, giving reasons, e.g.,
+//
+//	package flux.release
+//
+//	deny[msg] {
+//	    endswith(input.actions[_].updates[_].Target, ":latest")
+//	    msg := "images tagged latest may not be released"
+//	}
+//
+// or replace the plan with its own, as "plan". A policy which gives
+// no decision (i.e., is undefined for the input) allows the release.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+)
+
+// Input is what the policy is given to decide on.
+type Input struct {
+	Instance flux.InstanceID  `json:"instance"`
+	Job      jobs.JobID       `json:"job"`
+	User     string           `json:"user"`
+	Kind     flux.ReleaseKind `json:"kind"`
+	// Type is the type of release, e.g., "release_one".
+	Type   string      `json:"type"`
+	Params interface{} `json:"params"`
+	// Actions are the release actions planned.
+	Actions interface{} `json:"actions"`
+}
+
+// Decision is what the policy decided.
+type Decision struct {
+	// Deny gives the reasons the release may not go ahead, if it
+	// may not.
+	Deny []string `json:"deny,omitempty"`
+	// Plan, if given, is the release actions to do instead of those
+	// planned.
+	Plan json.RawMessage `json:"plan,omitempty"`
+}
+
+// Allowed says whether the release may go ahead.
+func (d Decision) Allowed() bool {
+	return len(d.Deny) == 0
+}
+
+// OPA queries the policy at a URL of an OPA server's data API, e.g.,
+// "http://opa:8181/v1/data/flux/release".
+type OPA struct {
+	url string
+	d   flux.Doer
+}
+
+func NewOPA(url string, d flux.Doer) *OPA {
+	return &OPA{url: url, d: d}
+}
+
+type dataRequest struct {
+	Input Input `json:"input"`
+}
+
+type dataResponse struct {
+	Result *Decision `json:"result"`
+}
+
+// Decide asks the policy whether the release described may go ahead.
+func (o *OPA) Decide(input Input) (Decision, error) {
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(dataRequest{input}); err != nil {
+		return Decision{}, errors.Wrap(err, "encoding policy input")
+	}
+	req, err := http.NewRequest("POST", o.url, buf)
+	if err != nil {
+		return Decision{}, errors.Wrap(err, "constructing request")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := o.d.Do(req)
+	if err != nil {
+		return Decision{}, errors.Wrap(err, "querying policy")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+		return Decision{}, fmt.Errorf("%s from policy (%s)", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var data dataResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return Decision{}, errors.Wrap(err, "decoding policy decision")
+	}
+	if data.Result == nil {
+		return Decision{}, nil
+	}
+	return *data.Result, nil
+}
@@ -0,0 +1,47 @@
+package policy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDecide(t *testing.T) {
+	var response string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/v1/data/flux/release" {
+			http.NotFound(w, r)
+			return
+		}
+		var req dataRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Input.Instance != "floaty-womble-abc123" {
+			http.Error(w, "bad input", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	opa := NewOPA(server.URL+"/v1/data/flux/release", http.DefaultClient)
+	input := Input{Instance: "floaty-womble-abc123", Type: "release_one"}
+	for i, c := range []struct {
+		response string
+		allowed  bool
+		plan     bool
+	}{
+		{`{}`, true, false},
+		{`{"result": {"deny": []}}`, true, false},
+		{`{"result": {"deny": ["images tagged latest may not be released"]}}`, false, false},
+		{`{"result": {"plan": [{"name": "printf", "description": "Nothing to do."}]}}`, true, true},
+	} {
+		response = c.response
+		decision, err := opa.Decide(input)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if decision.Allowed() != c.allowed || (len(decision.Plan) > 0) != c.plan {
+			t.Errorf("%d: unexpected decision %+v", i, decision)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+
+	dockerregistry "github.com/heroku/docker-registry-client/registry"
+	"github.com/pkg/errors"
+)
+
+// AuthError is returned when a registry refuses to give up image
+// metadata for want of (acceptable) credentials. It says which host
+// refused, and whether it was because the credentials given were
+// rejected, or because there weren't any.
+type AuthError struct {
+	// Host is the host asked, which may be a mirror of Origin.
+	Host       string
+	Origin     string
+	Repository string
+	// Username is that of the credentials rejected; it's empty if no
+	// credentials were used.
+	Username string
+	// Anonymous is set if the host is configured to be pulled from
+	// without credentials.
+	Anonymous bool
+	Err       error
+}
+
+func (e *AuthError) Error() string {
+	where := e.Host
+	if e.Origin != "" && e.Origin != e.Host {
+		where = fmt.Sprintf("%s (mirroring %s)", e.Host, e.Origin)
+	}
+	switch {
+	case e.Username != "":
+		return fmt.Sprintf("registry %s rejected the credentials for %q, fetching %s: %v", where, e.Username, e.Repository, e.Err)
+	case e.Anonymous:
+		return fmt.Sprintf("registry %s refused an anonymous pull of %s, though it's configured for anonymous pulls: %v", where, e.Repository, e.Err)
+	}
+	return fmt.Sprintf("registry %s refused an anonymous pull of %s, and no credentials are configured for it: %v", where, e.Repository, e.Err)
+}
+
+// explain says which host failed, and if it was for want of
+// credentials, which credentials.
+func (cs Credentials) explain(err error, repository, host, origin string) error {
+	switch statusOf(err) {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &AuthError{
+			Host:       host,
+			Origin:     origin,
+			Repository: repository,
+			Username:   cs.credsFor(host).username,
+			Anonymous:  cs.anonymous[host],
+			Err:        err,
+		}
+	}
+	if origin != host {
+		return errors.Wrapf(err, "fetching %s from %s (mirroring %s)", repository, host, origin)
+	}
+	return errors.Wrapf(err, "fetching %s from %s", repository, host)
+}
+
+// statusError is an HTTP response other than 200 OK, from a registry.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+// statusOf gives the HTTP status of the response the error is about,
+// or zero if it isn't about a response.
+func statusOf(err error) int {
+	switch e := errors.Cause(err).(type) {
+	case *dockerregistry.HttpStatusError:
+		if e.Response != nil {
+			return e.Response.StatusCode
+		}
+	case *statusError:
+		return e.code
+	}
+	return 0
+}
@@ -0,0 +1,54 @@
+package registry
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	dockerregistry "github.com/heroku/docker-registry-client/registry"
+
+	"github.com/weaveworks/flux"
+)
+
+func TestExplainAuthError(t *testing.T) {
+	config := flux.UnsafeInstanceConfig{}
+	config.Registry.Auths = map[string]flux.Auth{
+		"quay.io": {Auth: base64.StdEncoding.EncodeToString([]byte("bob:secret"))},
+	}
+	config.Registry.Anonymous = []string{"registry.example.com"}
+	cs, err := CredentialsFromConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refused := &dockerregistry.HttpStatusError{Response: &http.Response{StatusCode: http.StatusUnauthorized}}
+	for _, c := range []struct {
+		host, origin, expected string
+	}{
+		{"quay.io", "quay.io", `rejected the credentials for "bob"`},
+		{"registry.example.com", "registry.example.com", "configured for anonymous pulls"},
+		{"index.docker.io", "index.docker.io", "no credentials are configured"},
+		{"mirror.example.com", "index.docker.io", "mirror.example.com (mirroring index.docker.io)"},
+	} {
+		err := cs.explain(refused, "foo/bar", c.host, c.origin)
+		if _, ok := err.(*AuthError); !ok {
+			t.Errorf("%s: expected AuthError, got %T", c.host, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%s: expected error to contain %q, got %q", c.host, c.expected, err.Error())
+		}
+	}
+}
+
+func TestAnonymousWithCredentials(t *testing.T) {
+	config := flux.UnsafeInstanceConfig{}
+	config.Registry.Auths = map[string]flux.Auth{
+		"https://index.docker.io/v1/": {Auth: base64.StdEncoding.EncodeToString([]byte("bob:secret"))},
+	}
+	config.Registry.Anonymous = []string{"index.docker.io"}
+	if _, err := CredentialsFromConfig(config); err == nil {
+		t.Error("expected error for anonymous host with credentials")
+	}
+}
@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/weaveworks/flux"
+)
+
+// CheckCredentials checks each of the credentials against the host
+// it's for, by authenticating with it as a pull would (but without
+// asking for any particular repository). Requests are throttled by t
+// and use connections from p, if they're not nil.
+func CheckCredentials(cs Credentials, t *Throttle, p *Transports) []flux.RegistryCredentialCheck {
+	var keys []string
+	for key := range cs.m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var res []flux.RegistryCredentialCheck
+	for _, key := range keys {
+		host, auth := credentialsHost(key), cs.m[key]
+		client := &http.Client{Transport: t.Transport(host, p.transport(host, auth))}
+		check := flux.RegistryCredentialCheck{Host: host, Username: auth.username}
+		if err := checkCreds(client, host, auth); err != nil {
+			check.Error = err.Error()
+		} else {
+			check.OK = true
+		}
+		res = append(res, check)
+	}
+	return res
+}
+
+var serviceRE = regexp.MustCompile(`service="([^"]+)"`)
+
+// checkCreds asks the registry API base endpoint, which wants
+// credentials if the registry does; if it wants a bearer token, the
+// credentials are used to get one.
+func checkCreds(client *http.Client, host string, auth creds) error {
+	req, err := http.NewRequest("GET", "https://"+host+"/v2/", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(auth.username, auth.password)
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+	default:
+		return fmt.Errorf("GET %s: %s", req.URL, res.Status)
+	}
+
+	challenge := res.Header.Get("WWW-Authenticate")
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		// We gave it the credentials, and it still wants them
+		return fmt.Errorf("credentials rejected by %s", host)
+	}
+	realm := realmRE.FindStringSubmatch(challenge)
+	if realm == nil {
+		return fmt.Errorf("no token realm in challenge from %s: %q", host, challenge)
+	}
+	tokenURL, err := url.Parse(realm[1])
+	if err != nil {
+		return err
+	}
+	if service := serviceRE.FindStringSubmatch(challenge); service != nil {
+		q := tokenURL.Query()
+		q.Set("service", service[1])
+		tokenURL.RawQuery = q.Encode()
+	}
+	var token tokenResponse
+	tokenReq, err := http.NewRequest("GET", tokenURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	if err := getJSON(client, tokenReq, auth, &token); err != nil {
+		switch statusOf(err) {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return fmt.Errorf("credentials rejected by %s", tokenURL.Host)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+// ListRepositories lists the image repositories under a namespace,
+// named as they would be in a definition. The namespace is an
+// organisation on Docker Hub (e.g., "weaveworks"), or a host followed
+// by an organisation or project, for quay.io and Google Container
+// Registry (e.g., "quay.io/weaveworks" or "gcr.io/my-project").
+//
+// Docker Hub and quay.io are asked for public repositories only.
+func (c *client) ListRepositories(namespace string) (_ []string, err error) {
+	defer func(start time.Time) {
+		c.Metrics.RequestDuration.With(
+			LabelRepository, c.Metrics.Labels.Repo(namespace),
+			LabelRequestKind, RequestKindDiscovery,
+			fluxmetrics.LabelSuccess, strconv.FormatBool(err == nil),
+		).Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	host, org := dockerHubHost, namespace
+	if parts := strings.SplitN(namespace, "/", 2); len(parts) == 2 {
+		host, org = parts[0], parts[1]
+	}
+	if org == "" || strings.Contains(org, "/") && host == dockerHubHost {
+		return nil, fmt.Errorf("expected namespace as <org> or <host>/<org>, got %q", namespace)
+	}
+
+	client := &http.Client{Transport: c.Throttle.Transport(host, c.Transports.transport(host, c.Credentials.credsFor(host)))}
+	switch {
+	case host == dockerHubHost || host == "docker.io":
+		return listDockerHub(client, org)
+	case host == "quay.io":
+		return listQuay(client, org)
+	case host == "gcr.io" || strings.HasSuffix(host, ".gcr.io"):
+		return listGCR(client, host, org, c.Credentials.credsFor(host))
+	}
+	return nil, fmt.Errorf("listing repositories is not supported for %s", host)
+}
+
+func listDockerHub(client *http.Client, org string) ([]string, error) {
+	var res []string
+	next := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/?page_size=100", url.QueryEscape(org))
+	for next != "" {
+		req, err := http.NewRequest("GET", next, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Next    string `json:"next"`
+			Results []struct {
+				Name string `json:"name"`
+			} `json:"results"`
+		}
+		if err := getJSON(client, req, creds{}, &page); err != nil {
+			return nil, err
+		}
+		for _, r := range page.Results {
+			res = append(res, org+"/"+r.Name)
+		}
+		next = page.Next
+	}
+	return res, nil
+}
+
+func listQuay(client *http.Client, org string) ([]string, error) {
+	var res []string
+	var nextPage string
+	for {
+		u := "https://quay.io/api/v1/repository?public=true&namespace=" + url.QueryEscape(org)
+		if nextPage != "" {
+			u += "&next_page=" + url.QueryEscape(nextPage)
+		}
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			NextPage     string `json:"next_page"`
+			Repositories []struct {
+				Name string `json:"name"`
+			} `json:"repositories"`
+		}
+		if err := getJSON(client, req, creds{}, &page); err != nil {
+			return nil, err
+		}
+		for _, r := range page.Repositories {
+			res = append(res, "quay.io/"+org+"/"+r.Name)
+		}
+		if page.NextPage == "" {
+			return res, nil
+		}
+		nextPage = page.NextPage
+	}
+}
+
+// listGCR uses the tags list of the project, which (in GCR only)
+// includes the repositories under it as "child".
+func listGCR(client *http.Client, host, project string, auth creds) ([]string, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://%s/v2/%s/tags/list", host, project), nil)
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Child []string `json:"child"`
+	}
+	if err := getJSON(client, req, auth, &list); err != nil {
+		return nil, err
+	}
+	res := make([]string, len(list.Child))
+	for i, child := range list.Child {
+		res[i] = host + "/" + project + "/" + child
+	}
+	return res, nil
+}
@@ -0,0 +1,147 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+// Fake is a registry Client serving repositories from fixtures, for
+// tests. It can be made slow, or made to fail, per repository; it is
+// safe to change while in use.
+type Fake struct {
+	mu           sync.Mutex
+	repositories map[string][]flux.ImageDescription
+	errors       map[string]error
+	latency      time.Duration
+	requests     map[string]int
+}
+
+// NewFake gives a Fake registry with no repositories.
+func NewFake() *Fake {
+	return &Fake{
+		repositories: map[string][]flux.ImageDescription{},
+		errors:       map[string]error{},
+		requests:     map[string]int{},
+	}
+}
+
+// AddImage adds an image to its repository, with the time it was
+// created and the labels given (either may be empty, as a real
+// registry's manifests may lack them). Adding an image with a tag
+// already in the repository replaces it.
+func (f *Fake) AddImage(image string, created time.Time, labels map[string]string) error {
+	id, err := flux.ParseImageID(image)
+	if err != nil {
+		return err
+	}
+	desc := flux.ImageDescription{ID: id, Labels: labels}
+	if !created.IsZero() {
+		desc.CreatedAt = &created
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	repo := id.Repository()
+	images := f.repositories[repo]
+	for i := range images {
+		if images[i].ID.Tag == id.Tag {
+			images[i] = desc
+			return nil
+		}
+	}
+	f.repositories[repo] = append(images, desc)
+	return nil
+}
+
+// AddTags adds images with the tags given to a repository, created a
+// minute apart in the order given, the last at the time given.
+func (f *Fake) AddTags(repository string, last time.Time, tags ...string) error {
+	for i, tag := range tags {
+		created := last.Add(-time.Duration(len(tags)-1-i) * time.Minute)
+		if err := f.AddImage(repository+":"+tag, created, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fail makes requests for the repository (or for the namespace, in
+// ListRepositories) fail with the error given; a nil error makes them
+// succeed again.
+func (f *Fake) Fail(repository string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.errors, repository)
+		return
+	}
+	f.errors[repository] = err
+}
+
+// SetLatency makes each request take (at least) the time given.
+func (f *Fake) SetLatency(d time.Duration) {
+	f.mu.Lock()
+	f.latency = d
+	f.mu.Unlock()
+}
+
+// Requests says how many times the repository (or namespace) has been
+// asked for.
+func (f *Fake) Requests(repository string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[repository]
+}
+
+// request counts a request, waits for the latency, and gives the
+// error to fail it with, if there is one.
+func (f *Fake) request(name string) error {
+	f.mu.Lock()
+	f.requests[name]++
+	latency, err := f.latency, f.errors[name]
+	f.mu.Unlock()
+	time.Sleep(latency)
+	return err
+}
+
+func (f *Fake) GetRepository(repository string) ([]flux.ImageDescription, error) {
+	if err := f.request(repository); err != nil {
+		return nil, err
+	}
+	id, err := flux.ParseImageID(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	images, ok := f.repositories[id.Repository()]
+	if !ok {
+		return nil, fmt.Errorf("repository %s not found", repository)
+	}
+	res := append([]flux.ImageDescription{}, images...)
+	sort.Stable(byCreatedDesc(res))
+	return res, nil
+}
+
+func (f *Fake) ListRepositories(namespace string) ([]string, error) {
+	if err := f.request(namespace); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []string
+	for repo := range f.repositories {
+		if strings.HasPrefix(repo, namespace+"/") && !strings.Contains(strings.TrimPrefix(repo, namespace+"/"), "/") {
+			res = append(res, repo)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
@@ -0,0 +1,40 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	f := NewFake()
+	now := time.Now()
+	if err := f.AddTags("quay.io/weaveworks/helloworld", now, "v1", "v2", "v3"); err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := f.GetRepository("quay.io/weaveworks/helloworld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 3 || images[0].ID.Tag != "v3" {
+		t.Errorf("expected three images, newest (v3) first; got %+v", images)
+	}
+
+	repos, err := f.ListRepositories("quay.io/weaveworks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0] != "quay.io/weaveworks/helloworld" {
+		t.Errorf("expected the one repository, got %v", repos)
+	}
+
+	failure := errors.New("registry down")
+	f.Fail("quay.io/weaveworks/helloworld", failure)
+	if _, err := f.GetRepository("quay.io/weaveworks/helloworld"); err != failure {
+		t.Errorf("expected %v, got %v", failure, err)
+	}
+	if n := f.Requests("quay.io/weaveworks/helloworld"); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
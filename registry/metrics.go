@@ -15,14 +15,18 @@ type Metrics struct {
 	FetchDuration metrics.Histogram
 	// Counts of particular kinds of request
 	RequestDuration metrics.Histogram
+	// How to report the instance and repository labels
+	Labels fluxmetrics.LabelPolicy
 }
 
 const (
 	LabelRepository  = "repository"
 	LabelRequestKind = "kind"
 
-	RequestKindTags     = "tags"
-	RequestKindMetadata = "metadata"
+	RequestKindTags       = "tags"
+	RequestKindMetadata   = "metadata"
+	RequestKindNativeTags = "native_tags"
+	RequestKindDiscovery  = "discovery"
 )
 
 func NewMetrics() Metrics {
@@ -45,7 +49,8 @@ func NewMetrics() Metrics {
 
 func (m Metrics) WithInstanceID(instanceID flux.InstanceID) Metrics {
 	return Metrics{
-		FetchDuration:   m.FetchDuration.With(fluxmetrics.LabelInstanceID, string(instanceID)),
-		RequestDuration: m.RequestDuration.With(fluxmetrics.LabelInstanceID, string(instanceID)),
+		FetchDuration:   m.FetchDuration.With(fluxmetrics.LabelInstanceID, m.Labels.Instance(string(instanceID))),
+		RequestDuration: m.RequestDuration.With(fluxmetrics.LabelInstanceID, m.Labels.Instance(string(instanceID))),
+		Labels:          m.Labels,
 	}
 }
@@ -0,0 +1,36 @@
+package registry
+
+import (
+	"strings"
+)
+
+// Mirrors maps registry hosts to mirrors from which to fetch image
+// metadata instead; e.g., "docker.io" to "mirror.example.com" or, if
+// the mirror keeps the images under a path, to
+// "mirror.example.com/dockerhub". Images are still named as they
+// usually are, in definitions and in what's reported.
+type Mirrors map[string]string
+
+// resolve gives the host, and the name of the image repository on it,
+// to use in place of the host and repository name given.
+func (m Mirrors) resolve(host, name string) (string, string) {
+	mirror, ok := m[host]
+	if !ok && host == dockerHubHost {
+		mirror, ok = m["docker.io"]
+	}
+	if !ok || mirror == "" {
+		return host, name
+	}
+	parts := strings.SplitN(strings.Trim(mirror, "/"), "/", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1] + "/" + name
+	}
+	return parts[0], name
+}
+
+// HostFor gives the registry host requests for an image repository
+// are actually made to, taking mirrors into account.
+func (m Mirrors) HostFor(repository string) string {
+	host, _ := m.resolve(HostOf(repository), "")
+	return host
+}
@@ -0,0 +1,28 @@
+package registry
+
+import (
+	"testing"
+)
+
+func TestMirrorsResolve(t *testing.T) {
+	m := Mirrors{
+		"docker.io": "mirror.example.com/dockerhub",
+		"quay.io":   "quay-mirror.example.com",
+	}
+	for _, c := range []struct {
+		host, name       string
+		wantHost, wantIn string
+	}{
+		{dockerHubHost, "library/alpine", "mirror.example.com", "dockerhub/library/alpine"},
+		{"quay.io", "weaveworks/flux", "quay-mirror.example.com", "weaveworks/flux"},
+		{"gcr.io", "google_containers/pause", "gcr.io", "google_containers/pause"},
+	} {
+		host, name := m.resolve(c.host, c.name)
+		if host != c.wantHost || name != c.wantIn {
+			t.Errorf("%s/%s: expected %s/%s, got %s/%s", c.host, c.name, c.wantHost, c.wantIn, host, name)
+		}
+	}
+	if host := m.HostFor("alpine"); host != "mirror.example.com" {
+		t.Errorf("expected requests for alpine to go to the mirror, got %s", host)
+	}
+}
@@ -0,0 +1,258 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+// nativeTag is a tag as listed by a registry's own API, with when it
+// was pushed, and any labels.
+type nativeTag struct {
+	name   string
+	pushed time.Time
+	labels map[string]string
+}
+
+// nativeAPI lists all the tags of an image repository, using the
+// registry's own API rather than the Docker registry API; that takes
+// a request for each tag to find out when it was pushed, while these
+// take one (or one per page).
+type nativeAPI func(client *http.Client, host, name string, auth creds) ([]nativeTag, error)
+
+// nativeProvider fetches images using a registry's own API.
+type nativeProvider struct {
+	api nativeAPI
+}
+
+func (p nativeProvider) Images(r Remote) ([]flux.ImageDescription, error) {
+	start := time.Now()
+	tags, err := p.api(&http.Client{Transport: r.Transport}, r.Host, r.Name, creds{r.Username, r.Password})
+	r.observe(RequestKindNativeTags, start, err)
+	if err != nil {
+		return nil, err
+	}
+	images := make([]flux.ImageDescription, len(tags))
+	for i, tag := range tags {
+		images[i] = flux.ImageDescription{
+			ID:     flux.MakeImageID("", r.ImageName, tag.name),
+			Labels: tag.labels,
+		}
+		if !tag.pushed.IsZero() {
+			pushed := tag.pushed
+			images[i].CreatedAt = &pushed
+		}
+	}
+	return images, nil
+}
+
+// HostConfig says how to talk to particular registry hosts.
+type HostConfig struct {
+	Mirrors Mirrors
+	// APIs gives the kind of registry (e.g., "harbor") for hosts
+	// that aren't to be treated as they would by default.
+	APIs map[string]string
+}
+
+// HostConfigFromConfig gets the registry host configuration from an
+// instance's config, checking that it makes sense.
+func HostConfigFromConfig(config flux.UnsafeInstanceConfig) (HostConfig, error) {
+	for host, kind := range config.Registry.APIs {
+		if _, ok := providers[kind]; !ok && kind != "" {
+			var kinds []string
+			for k := range providers {
+				kinds = append(kinds, k)
+			}
+			sort.Strings(kinds)
+			return HostConfig{}, fmt.Errorf("unknown kind of registry %q for %s; expected one of %s", kind, host, strings.Join(kinds, ", "))
+		}
+	}
+	return HostConfig{
+		Mirrors: Mirrors(config.Registry.Mirrors),
+		APIs:    config.Registry.APIs,
+	}, nil
+}
+
+// getJSON makes a request, and decodes the JSON response into v.
+func getJSON(client *http.Client, req *http.Request, auth creds, v interface{}) error {
+	if auth.username != "" {
+		req.SetBasicAuth(auth.username, auth.password)
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		return &statusError{res.StatusCode, fmt.Sprintf("%s %s: %s: %s", req.Method, req.URL, res.Status, strings.TrimSpace(string(body)))}
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+const harborPageSize = 100
+
+// harborTags uses the Harbor v2 API, which lists the artifacts in a
+// repository along with their tags and labels. The repository name
+// starts with the Harbor project.
+func harborTags(client *http.Client, host, name string, auth creds) ([]nativeTag, error) {
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expected Harbor repository as <project>/<repository>, got %q", name)
+	}
+	// Repository names with slashes in them have to be encoded
+	// twice, since they're a single path element.
+	repo := strings.Replace(parts[1], "/", "%252F", -1)
+
+	type artifact struct {
+		PushTime time.Time `json:"push_time"`
+		Tags     []struct {
+			Name     string    `json:"name"`
+			PushTime time.Time `json:"push_time"`
+		} `json:"tags"`
+		Labels []struct {
+			Name string `json:"name"`
+		} `json:"labels"`
+	}
+
+	var res []nativeTag
+	for page := 1; ; page++ {
+		u := fmt.Sprintf("https://%s/api/v2.0/projects/%s/repositories/%s/artifacts?with_tag=true&with_label=true&page_size=%d&page=%d", host, parts[0], repo, harborPageSize, page)
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		var artifacts []artifact
+		if err := getJSON(client, req, auth, &artifacts); err != nil {
+			return nil, err
+		}
+		for _, a := range artifacts {
+			var labels map[string]string
+			if len(a.Labels) > 0 {
+				labels = map[string]string{}
+				for _, l := range a.Labels {
+					labels[l.Name] = ""
+				}
+			}
+			for _, t := range a.Tags {
+				pushed := t.PushTime
+				if pushed.IsZero() {
+					pushed = a.PushTime
+				}
+				res = append(res, nativeTag{name: t.Name, pushed: pushed, labels: labels})
+			}
+		}
+		if len(artifacts) < harborPageSize {
+			return res, nil
+		}
+	}
+}
+
+// Docker image labels are kept by Artifactory as properties, with
+// this prefix.
+const artifactoryLabelPrefix = "docker.label."
+
+// artifactoryTags uses an Artifactory query to find the manifest of
+// each tag in a repository, with when it was created and its
+// properties. The repository name starts with the Artifactory
+// repository key, as when Artifactory is set up to serve Docker
+// images by repository path.
+func artifactoryTags(client *http.Client, host, name string, auth creds) ([]nativeTag, error) {
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expected Artifactory repository as <repository key>/<image>, got %q", name)
+	}
+	repoKey, image := parts[0], parts[1]
+
+	query := fmt.Sprintf(`items.find({"repo":%q,"path":{"$match":%q},"name":"manifest.json"}).include("path","created","property")`, repoKey, image+"/*")
+	req, err := http.NewRequest("POST", fmt.Sprintf("https://%s/artifactory/api/search/aql", host), strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	var found struct {
+		Results []struct {
+			Path       string    `json:"path"`
+			Created    time.Time `json:"created"`
+			Properties []struct {
+				Key   string `json:"key"`
+				Value string `json:"value"`
+			} `json:"properties"`
+		} `json:"results"`
+	}
+	if err := getJSON(client, req, auth, &found); err != nil {
+		return nil, err
+	}
+
+	var res []nativeTag
+	for _, r := range found.Results {
+		// Only manifests directly under the image, i.e., tags
+		if path.Dir(r.Path) != image {
+			continue
+		}
+		var labels map[string]string
+		for _, p := range r.Properties {
+			if strings.HasPrefix(p.Key, artifactoryLabelPrefix) {
+				if labels == nil {
+					labels = map[string]string{}
+				}
+				labels[strings.TrimPrefix(p.Key, artifactoryLabelPrefix)] = p.Value
+			}
+		}
+		res = append(res, nativeTag{name: path.Base(r.Path), pushed: r.Created, labels: labels})
+	}
+	return res, nil
+}
+
+const quayPageSize = 100
+
+// quayTags uses the Quay API, which lists the tags of a repository
+// along with when each was last changed. The API doesn't take
+// registry credentials, so this only works for public repositories;
+// for private ones, it fails and the Docker registry API is used
+// instead.
+func quayTags(client *http.Client, host, name string, _ creds) ([]nativeTag, error) {
+	var res []nativeTag
+	for page := 1; ; page++ {
+		u := fmt.Sprintf("https://%s/api/v1/repository/%s/tag/?onlyActiveTags=true&limit=%d&page=%d", host, name, quayPageSize, page)
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		var found struct {
+			Tags []struct {
+				Name         string `json:"name"`
+				LastModified string `json:"last_modified"`
+			} `json:"tags"`
+			HasAdditional bool `json:"has_additional"`
+		}
+		if err := getJSON(client, req, creds{}, &found); err != nil {
+			return nil, err
+		}
+		for _, t := range found.Tags {
+			tag := nativeTag{name: t.Name}
+			if t.LastModified != "" {
+				modified, err := time.Parse(time.RFC1123Z, t.LastModified)
+				if err != nil {
+					return nil, errors.Wrapf(err, "parsing last_modified of tag %s", t.Name)
+				}
+				tag.pushed = modified
+			}
+			res = append(res, tag)
+		}
+		if !found.HasAdditional {
+			return res, nil
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/go-kit/kit/log"
+	dockerregistry "github.com/heroku/docker-registry-client/registry"
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/weaveworks/flux"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+// Kinds of registry, each with its own way of fetching images.
+const (
+	ProviderV2          = "v2"
+	ProviderECR         = "ecr"
+	ProviderGCR         = "gcr"
+	ProviderHarbor      = "harbor"
+	ProviderArtifactory = "artifactory"
+	ProviderQuay        = "quay"
+)
+
+// A Provider fetches the tagged images in a repository from one kind
+// of registry.
+type Provider interface {
+	Images(r Remote) ([]flux.ImageDescription, error)
+}
+
+// Remote is an image repository at a registry host, with what's
+// needed to talk to the host.
+type Remote struct {
+	// Host is the registry host to ask, having taken mirrors into
+	// account.
+	Host string
+	// Name is the name of the repository at the host, e.g.,
+	// "library/alpine".
+	Name string
+	// ImageName is the name of the repository as given, with which
+	// the images fetched are named, e.g., "alpine".
+	ImageName string
+	// Transport is for requests to the host; it's throttled.
+	Transport http.RoundTripper
+	// Tokens keeps the bearer tokens obtained from the host with these
+	// credentials, shared with other lookups; it may be nil.
+	Tokens             *TokenCache
+	Username, Password string
+	Logger             log.Logger
+	Metrics            Metrics
+}
+
+// observe records how long a request of the kind given took.
+func (r Remote) observe(kind string, start time.Time, err error) {
+	r.Metrics.RequestDuration.With(
+		LabelRepository, r.Metrics.Labels.Repo(r.ImageName),
+		LabelRequestKind, kind,
+		fluxmetrics.LabelSuccess, strconv.FormatBool(err == nil),
+	).Observe(time.Since(start).Seconds())
+}
+
+var providers = map[string]Provider{
+	ProviderV2: v2Provider{},
+	// ECR serves the Docker registry API; the credentials have to be
+	// a current ECR authorisation token.
+	ProviderECR:         v2Provider{},
+	ProviderGCR:         withFallback{gcrProvider{}},
+	ProviderHarbor:      withFallback{nativeProvider{harborTags}},
+	ProviderArtifactory: withFallback{nativeProvider{artifactoryTags}},
+	ProviderQuay:        withFallback{nativeProvider{quayTags}},
+}
+
+// defaultProvider gives the kind of registry the host is known to be,
+// if it's not given in the config.
+func defaultProvider(host string) string {
+	switch {
+	case host == "quay.io":
+		return ProviderQuay
+	case host == "gcr.io" || strings.HasSuffix(host, ".gcr.io"):
+		return ProviderGCR
+	case strings.Contains(host, ".dkr.ecr.") && strings.HasSuffix(host, ".amazonaws.com"):
+		return ProviderECR
+	}
+	return ProviderV2
+}
+
+// kindFor gives the kind of registry the host given is.
+func (h HostConfig) kindFor(host string) string {
+	kind, ok := h.APIs[host]
+	if !ok {
+		return defaultProvider(host)
+	}
+	if _, ok := providers[kind]; !ok {
+		return ProviderV2
+	}
+	return kind
+}
+
+// providerFor gives the provider to use for the host given.
+func (h HostConfig) providerFor(host string) Provider {
+	return providers[h.kindFor(host)]
+}
+
+// withFallback uses a registry's own API, and if that doesn't work
+// out, the Docker registry API, which every registry has.
+type withFallback struct {
+	Provider
+}
+
+func (p withFallback) Images(r Remote) ([]flux.ImageDescription, error) {
+	images, err := p.Provider.Images(r)
+	if err == nil {
+		return images, nil
+	}
+	r.Logger.Log("registry-native-api-err", err, "host", r.Host)
+	return providers[ProviderV2].Images(r)
+}
+
+type roundtripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundtripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// dockerRegistryInterface is the part of the registry client library
+// that's used here, so it can be replaced in tests.
+type dockerRegistryInterface interface {
+	Tags(repository string) ([]string, error)
+	Manifest(repository, reference string) (*schema1.SignedManifest, error)
+}
+
+// v2Provider uses the Docker registry API, which takes a request to
+// list the tags, then one for each tag to find out when it was made.
+type v2Provider struct{}
+
+func (v2Provider) Images(r Remote) ([]flux.ImageDescription, error) {
+	httphost := "https://" + r.Host
+
+	// quay.io wants us to use cookies for authorisation, so we have
+	// to construct one (the default client has none). This means a
+	// bit more constructing things to be able to make a registry
+	// client literal, rather than calling .New()
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, err
+	}
+
+	// A context we'll use to cancel requests on error
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Use the wrapper to fix headers for quay.io, and remember bearer tokens
+	var transport http.RoundTripper = &wwwAuthenticateFixer{
+		transport:  r.Transport,
+		tokens:     r.Tokens,
+		repository: r.Name,
+	}
+	// Now the auth-handling wrappers that come with the library
+	transport = dockerregistry.WrapTransport(transport, httphost, r.Username, r.Password)
+
+	client := &dockerregistry.Registry{
+		URL: httphost,
+		Client: &http.Client{
+			Transport: roundtripperFunc(func(r *http.Request) (*http.Response, error) {
+				return transport.RoundTrip(r.WithContext(ctx))
+			}),
+			Jar: jar,
+		},
+		Logf: dockerregistry.Quiet,
+	}
+
+	start := time.Now()
+	tags, err := client.Tags(r.Name)
+	r.observe(RequestKindTags, start, err)
+	if isNotFound(err) {
+		// Perhaps the registry doesn't do the v2 API at all; see if
+		// it'll list the tags with the v1 API instead.
+		cancel()
+		images, v1err := v1Images(r)
+		if v1err != nil {
+			r.Logger.Log("registry-v1-api-err", v1err, "host", r.Host)
+			return nil, err
+		}
+		return images, nil
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return tagsToRepository(cancel, client, r, tags)
+}
+
+const (
+	warningNoV2API    = "registry doesn't support the v2 API; ordered by tag"
+	warningNoManifest = "registry has no manifest; ordered by tag"
+)
+
+// isNotFound says whether the error is the registry responding with
+// 404 Not Found; i.e., it doesn't have the endpoint asked for.
+func isNotFound(err error) bool {
+	return statusOf(err) == http.StatusNotFound
+}
+
+// v1Images lists the tags of a repository using the (deprecated)
+// Docker registry v1 API. That doesn't say when images were created,
+// so they're given a warning to that effect, and end up ordered by
+// tag.
+func v1Images(r Remote) ([]flux.ImageDescription, error) {
+	req, err := http.NewRequest("GET", "https://"+r.Host+"/v1/repositories/"+r.Name+"/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	// This is a map of tag to image ID
+	var tags map[string]string
+	start := time.Now()
+	err = getJSON(&http.Client{Transport: r.Transport}, req, creds{r.Username, r.Password}, &tags)
+	r.observe(RequestKindTags, start, err)
+	if err != nil {
+		return nil, err
+	}
+	r.Logger.Log("warning", "registry does not support the v2 API; images will be ordered by tag", "host", r.Host, "repository", r.Name)
+	var images []flux.ImageDescription
+	for tag := range tags {
+		images = append(images, flux.ImageDescription{
+			ID:      flux.MakeImageID("", r.ImageName, tag),
+			Warning: warningNoV2API,
+		})
+	}
+	return images, nil
+}
+
+func lookupImage(client dockerRegistryInterface, r Remote, tag string) (flux.ImageDescription, error) {
+	// Minor cheat: this will give the correct result even if the
+	// imageName includes a host
+	id := flux.MakeImageID("", r.ImageName, tag)
+	img := flux.ImageDescription{ID: id}
+
+	start := time.Now()
+	meta, err := client.Manifest(r.Name, tag)
+	r.observe(RequestKindMetadata, start, err)
+	if isNotFound(err) {
+		// The tag's there, but the registry won't give us the
+		// manifest (perhaps it doesn't do the v2 manifests API); it
+		// will have to be ordered by tag.
+		img.Warning = warningNoManifest
+		return img, nil
+	}
+	if err != nil {
+		return img, err
+	}
+	// the manifest includes some v1-backwards-compatibility data,
+	// oddly called "History", which are layer metadata as JSON
+	// strings; these appear most-recent (i.e., topmost layer) first,
+	// so happily we can just decode the first entry to get a created
+	// time.
+	type v1image struct {
+		Created time.Time `json:"created"`
+	}
+	if len(meta.History) == 0 {
+		return img, nil
+	}
+	var topmost v1image
+	if err = json.Unmarshal([]byte(meta.History[0].V1Compatibility), &topmost); err == nil {
+		if !topmost.Created.IsZero() {
+			img.CreatedAt = &topmost.Created
+		}
+	}
+
+	return img, err
+}
+
+func tagsToRepository(cancel func(), client dockerRegistryInterface, r Remote, tags []string) ([]flux.ImageDescription, error) {
+	// one way or another, we'll be finishing all requests
+	defer cancel()
+
+	type result struct {
+		image flux.ImageDescription
+		err   error
+	}
+
+	fetched := make(chan result, len(tags))
+
+	for _, tag := range tags {
+		go func(t string) {
+			img, err := lookupImage(client, r, t)
+			if err != nil {
+				r.Logger.Log("registry-metadata-err", err)
+			}
+			fetched <- result{img, err}
+		}(tag)
+	}
+
+	images := make([]flux.ImageDescription, cap(fetched))
+	for i := 0; i < cap(fetched); i++ {
+		res := <-fetched
+		if res.err != nil {
+			return nil, res.err
+		}
+		images[i] = res.image
+	}
+	return images, nil
+}
+
+// gcrProvider uses the tags list of Google Container Registry, which
+// includes when each image was made, along with the tags.
+type gcrProvider struct{}
+
+func (gcrProvider) Images(r Remote) ([]flux.ImageDescription, error) {
+	req, err := http.NewRequest("GET", "https://"+r.Host+"/v2/"+r.Name+"/tags/list", nil)
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Manifest map[string]struct {
+			Tags          []string `json:"tag"`
+			TimeCreatedMs string   `json:"timeCreatedMs"`
+		} `json:"manifest"`
+	}
+	start := time.Now()
+	err = getJSON(&http.Client{Transport: r.Transport}, req, creds{r.Username, r.Password}, &list)
+	r.observe(RequestKindNativeTags, start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []flux.ImageDescription
+	for _, m := range list.Manifest {
+		var created *time.Time
+		if ms, err := strconv.ParseInt(m.TimeCreatedMs, 10, 64); err == nil && ms > 0 {
+			t := time.Unix(0, ms*int64(time.Millisecond)).UTC()
+			created = &t
+		}
+		for _, tag := range m.Tags {
+			images = append(images, flux.ImageDescription{
+				ID:        flux.MakeImageID("", r.ImageName, tag),
+				CreatedAt: created,
+			})
+		}
+	}
+	return images, nil
+}
@@ -0,0 +1,212 @@
+package registry
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	dockerregistry "github.com/heroku/docker-registry-client/registry"
+
+	"github.com/weaveworks/flux"
+)
+
+type mockProvider struct {
+	images []flux.ImageDescription
+	err    error
+	calls  int
+}
+
+func (p *mockProvider) Images(r Remote) ([]flux.ImageDescription, error) {
+	p.calls++
+	return p.images, p.err
+}
+
+func TestProviderKind(t *testing.T) {
+	h := HostConfig{APIs: map[string]string{
+		"harbor.example.com": ProviderHarbor,
+		"quay.io":            "",
+	}}
+	for host, want := range map[string]string{
+		"harbor.example.com": ProviderHarbor,
+		"eu.gcr.io":          ProviderGCR,
+		"123456789.dkr.ecr.eu-west-1.amazonaws.com": ProviderECR,
+		"index.docker.io":      ProviderV2,
+		"quay.io":              ProviderV2,
+		"registry.example.com": ProviderV2,
+	} {
+		if got := h.kindFor(host); got != want {
+			t.Errorf("%s: expected %q, got %q", host, want, got)
+		}
+	}
+}
+
+func TestProviderFallback(t *testing.T) {
+	v2 := &mockProvider{images: []flux.ImageDescription{{ID: flux.MakeImageID("", "alpine", "3.5")}}}
+	saved := providers[ProviderV2]
+	providers[ProviderV2] = v2
+	defer func() { providers[ProviderV2] = saved }()
+
+	native := &mockProvider{err: errors.New("not found")}
+	images, err := withFallback{native}.Images(Remote{Logger: log.NewNopLogger()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if native.calls != 1 || v2.calls != 1 {
+		t.Errorf("expected native API then registry API to be asked, got %d and %d calls", native.calls, v2.calls)
+	}
+	if len(images) != 1 || images[0].ID.String() != "alpine:3.5" {
+		t.Errorf("expected images from registry API, got %v", images)
+	}
+}
+
+type nopHistogram struct{}
+
+func (h nopHistogram) With(...string) metrics.Histogram { return h }
+func (h nopHistogram) Observe(float64)                  {}
+
+// noManifests is a registry which lists tags, but has no manifests.
+type noManifests []string
+
+func (r noManifests) Tags(string) ([]string, error) {
+	return r, nil
+}
+
+func (noManifests) Manifest(string, string) (*schema1.SignedManifest, error) {
+	return nil, &dockerregistry.HttpStatusError{Response: &http.Response{StatusCode: http.StatusNotFound}}
+}
+
+func TestNoManifestsOrderedByTag(t *testing.T) {
+	r := Remote{ImageName: "alpine", Logger: log.NewNopLogger(), Metrics: Metrics{FetchDuration: nopHistogram{}, RequestDuration: nopHistogram{}}}
+	images, err := tagsToRepository(func() {}, noManifests{"3.4", "3.6", "3.5"}, r, []string{"3.4", "3.6", "3.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Sort(byCreatedDesc(images))
+	var tags []string
+	for _, image := range images {
+		if image.Warning == "" {
+			t.Errorf("%s: expected a warning", image.ID)
+		}
+		_, _, tag := image.ID.Components()
+		tags = append(tags, tag)
+	}
+	if len(tags) != 3 || tags[0] != "3.6" || tags[1] != "3.5" || tags[2] != "3.4" {
+		t.Errorf("expected images in descending order of tag, got %v", tags)
+	}
+}
+
+// fakeRegistry is a registry which has a manifest (or an error) for
+// each tag.
+type fakeRegistry struct {
+	manifests map[string]*schema1.SignedManifest
+	errs      map[string]error
+}
+
+func (r fakeRegistry) Tags(string) ([]string, error) {
+	var tags []string
+	for tag := range r.manifests {
+		tags = append(tags, tag)
+	}
+	for tag := range r.errs {
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func (r fakeRegistry) Manifest(_, tag string) (*schema1.SignedManifest, error) {
+	if err, ok := r.errs[tag]; ok {
+		return nil, err
+	}
+	return r.manifests[tag], nil
+}
+
+func manifestWithHistory(v1Compatibility ...string) *schema1.SignedManifest {
+	m := &schema1.SignedManifest{}
+	for _, h := range v1Compatibility {
+		m.History = append(m.History, schema1.History{V1Compatibility: h})
+	}
+	return m
+}
+
+func testRemote() Remote {
+	return Remote{Name: "library/alpine", ImageName: "alpine", Logger: log.NewNopLogger(), Metrics: Metrics{FetchDuration: nopHistogram{}, RequestDuration: nopHistogram{}}}
+}
+
+func TestLookupImage(t *testing.T) {
+	created := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	client := fakeRegistry{
+		manifests: map[string]*schema1.SignedManifest{
+			"3.5":        manifestWithHistory(`{"created":"2017-03-01T12:00:00Z"}`, `{"created":"2017-01-01T12:00:00Z"}`),
+			"no-history": manifestWithHistory(),
+			"no-created": manifestWithHistory(`{}`),
+			"bad":        manifestWithHistory(`not json`),
+		},
+		errs: map[string]error{
+			"missing": &dockerregistry.HttpStatusError{Response: &http.Response{StatusCode: http.StatusNotFound}},
+			"broken":  errors.New("connection reset"),
+		},
+	}
+
+	img, err := lookupImage(client, testRemote(), "3.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.ID.String() != "alpine:3.5" || img.CreatedAt == nil || !img.CreatedAt.Equal(created) {
+		t.Errorf("expected alpine:3.5, created at %s from the topmost layer, got %+v", created, img)
+	}
+
+	for _, tag := range []string{"no-history", "no-created"} {
+		img, err := lookupImage(client, testRemote(), tag)
+		if err != nil {
+			t.Errorf("%s: %v", tag, err)
+		}
+		if img.CreatedAt != nil || img.Warning != "" {
+			t.Errorf("%s: expected an image with no creation time, got %+v", tag, img)
+		}
+	}
+
+	img, err = lookupImage(client, testRemote(), "missing")
+	if err != nil || img.Warning != warningNoManifest {
+		t.Errorf("expected an image with a warning when there's no manifest, got %+v, %v", img, err)
+	}
+
+	for _, tag := range []string{"bad", "broken"} {
+		if _, err := lookupImage(client, testRemote(), tag); err == nil {
+			t.Errorf("%s: expected an error", tag)
+		}
+	}
+}
+
+func TestTagsToRepository(t *testing.T) {
+	client := fakeRegistry{manifests: map[string]*schema1.SignedManifest{
+		"3.4": manifestWithHistory(`{"created":"2017-01-01T12:00:00Z"}`),
+		"3.5": manifestWithHistory(`{"created":"2017-03-01T12:00:00Z"}`),
+		"3.6": manifestWithHistory(),
+	}}
+	cancelled := false
+	images, err := tagsToRepository(func() { cancelled = true }, client, testRemote(), []string{"3.4", "3.5", "3.6"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cancelled {
+		t.Error("expected the requests to be finished with")
+	}
+	created := map[string]bool{}
+	for _, image := range images {
+		_, _, tag := image.ID.Components()
+		created[tag] = image.CreatedAt != nil
+	}
+	if len(created) != 3 || !created["3.4"] || !created["3.5"] || created["3.6"] {
+		t.Errorf("expected 3.4 and 3.5 with creation times, and 3.6 without, got %+v", images)
+	}
+
+	client.errs = map[string]error{"3.7": errors.New("connection reset")}
+	if _, err := tagsToRepository(func() {}, client, testRemote(), []string{"3.4", "3.7"}); err == nil {
+		t.Error("expected an error when a manifest can't be fetched")
+	}
+}
@@ -1,33 +1,55 @@
 package registry
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Workaround for quay.io, which fails to quote the scope value in its
 // WWW-Authenticate header. Annoying.  This also remembers a Bearer
 // token, so once you have authenticated, it can keep using it rather
-// than authenticating each time.
+// than authenticating each time; and, if given a TokenCache, shares
+// the token with other lookups of the same repository, for as long as
+// the token lasts.
 
 type wwwAuthenticateFixer struct {
-	transport   http.RoundTripper
+	transport  http.RoundTripper
+	tokens     *TokenCache
+	repository string
+
+	mu          sync.Mutex
 	tokenHeader string
+	realm       string
 }
 
 func (t *wwwAuthenticateFixer) RoundTrip(req *http.Request) (*http.Response, error) {
-	t.maybeAddToken(req)
+	cached := t.maybeAddToken(req)
 	res, err := t.transport.RoundTrip(req)
 	if err == nil {
 		newAuthHeaders := []string{}
 		for _, h := range res.Header[http.CanonicalHeaderKey("WWW-Authenticate")] {
 			if strings.HasPrefix(h, "Bearer ") {
 				h = replaceUnquoted(h)
+				t.rememberRealm(h)
 			}
 			newAuthHeaders = append(newAuthHeaders, h)
 		}
 		res.Header[http.CanonicalHeaderKey("WWW-Authenticate")] = newAuthHeaders
+
+		switch {
+		case res.StatusCode == http.StatusUnauthorized && cached:
+			// The token we had is no good (any more); let the library
+			// authenticate again.
+			t.forgetToken()
+		case res.StatusCode == http.StatusOK && t.isTokenRequest(req):
+			t.cacheToken(res)
+		}
 	}
 	return res, err
 }
@@ -42,21 +64,100 @@ func replaceUnquoted(h string) string {
 	return scopeRE.ReplaceAllString(h, `,scope="$1"`)
 }
 
-// If we've got a token from a previous roundtrip, try using it
-// again. BEWARE: this means this transport should only be used when
-// asking (repeatedly) about a single repository, otherwise we may
-// leak authorisation.
-func (t *wwwAuthenticateFixer) maybeAddToken(req *http.Request) {
+// If we've got a token from a previous roundtrip, or another lookup
+// of the same repository, try using it again. BEWARE: this means this
+// transport should only be used when asking (repeatedly) about a
+// single repository, otherwise we may leak authorisation. It returns
+// whether a token was added.
+func (t *wwwAuthenticateFixer) maybeAddToken(req *http.Request) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	authHeaders := req.Header[http.CanonicalHeaderKey("Authorization")]
 	for _, h := range authHeaders {
-		if strings.EqualFold(h[:7], "bearer ") {
-			if t.tokenHeader == "" {
-				t.tokenHeader = h
-			}
-			return
+		if len(h) >= 7 && strings.EqualFold(h[:7], "bearer ") {
+			// The library has just authenticated, so this is the
+			// freshest token there is.
+			t.tokenHeader = h
+		}
+	}
+	if len(authHeaders) > 0 {
+		// Either we've just seen the token, or it's a request for
+		// one, with the credentials; leave it be.
+		return false
+	}
+	if t.tokenHeader == "" {
+		if h, ok := t.tokens.Get(t.repository); ok {
+			t.tokenHeader = h
 		}
 	}
 	if t.tokenHeader != "" {
 		req.Header.Set("Authorization", t.tokenHeader)
+		return true
+	}
+	return false
+}
+
+func (t *wwwAuthenticateFixer) forgetToken() {
+	t.mu.Lock()
+	t.tokenHeader = ""
+	t.mu.Unlock()
+	t.tokens.Forget(t.repository)
+}
+
+var realmRE = regexp.MustCompile(`realm="([^"]+)"`)
+
+// rememberRealm notes where tokens come from, given a Bearer
+// challenge, so the response with a token can be spotted.
+func (t *wwwAuthenticateFixer) rememberRealm(challenge string) {
+	if m := realmRE.FindStringSubmatch(challenge); m != nil {
+		t.mu.Lock()
+		t.realm = m[1]
+		t.mu.Unlock()
+	}
+}
+
+func (t *wwwAuthenticateFixer) isTokenRequest(req *http.Request) bool {
+	t.mu.Lock()
+	realm := t.realm
+	t.mu.Unlock()
+	if realm == "" {
+		return false
+	}
+	u := *req.URL
+	u.RawQuery = ""
+	return u.String() == realm
+}
+
+// tokenResponse is the response from a token server; `access_token`
+// is the OAuth2 name for the token, which some servers use instead.
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// cacheToken reads the token from the response given, and keeps it
+// for as long as it's said to last. The body is put back for the
+// library to read.
+func (t *wwwAuthenticateFixer) cacheToken(res *http.Response) {
+	if t.tokens == nil {
+		return
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return
 	}
+	t.tokens.Put(t.repository, "Bearer "+token.Token, time.Duration(token.ExpiresIn)*time.Second)
 }
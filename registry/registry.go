@@ -2,21 +2,18 @@
 package registry
 
 import (
-	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"net/http/cookiejar"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
-	dockerregistry "github.com/heroku/docker-registry-client/registry"
-	"golang.org/x/net/publicsuffix"
 
 	"github.com/weaveworks/flux"
 	fluxmetrics "github.com/weaveworks/flux/metrics"
@@ -34,35 +31,41 @@ type creds struct {
 // Credentials to a (Docker) registry.
 type Credentials struct {
 	m map[string]creds
+	// anonymous hosts are pulled from without credentials on purpose
+	anonymous map[string]bool
 }
 
 // Client is a handle to a bunch of registries.
 type Client interface {
 	GetRepository(repository string) ([]flux.ImageDescription, error)
+	ListRepositories(namespace string) ([]string, error)
 }
 
 // client is a handle to a registry.
 type client struct {
 	Credentials Credentials
+	Hosts       HostConfig
+	Throttle    *Throttle
+	Transports  *Transports
 	Logger      log.Logger
 	Metrics     Metrics
 }
 
-// NewClient creates a new registry client, to use when fetching repositories.
-func NewClient(c Credentials, l log.Logger, m Metrics) Client {
+// NewClient creates a new registry client, to use when fetching
+// repositories. Requests go to mirrors, and use native APIs, as the
+// host config says, and are throttled by t, if it's not nil. They use
+// connections from the pool p, if it's not nil.
+func NewClient(c Credentials, h HostConfig, t *Throttle, p *Transports, l log.Logger, m Metrics) Client {
 	return &client{
 		Credentials: c,
+		Hosts:       h,
+		Throttle:    t,
+		Transports:  p,
 		Logger:      l,
 		Metrics:     m,
 	}
 }
 
-type roundtripperFunc func(*http.Request) (*http.Response, error)
-
-func (f roundtripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
-	return f(r)
-}
-
 // GetRepository yields a repository matching the given name, if any exists.
 // Repository may be of various forms, in which case omitted elements take
 // assumed defaults.
@@ -70,152 +73,74 @@ func (f roundtripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
 //   helloworld             -> index.docker.io/library/helloworld
 //   foo/helloworld         -> index.docker.io/foo/helloworld
 //   quay.io/foo/helloworld -> quay.io/foo/helloworld
+//   foo/bar/helloworld     -> index.docker.io/foo/bar/helloworld
+//
+// The host is recognised as in Docker, by having a "." or ":" in it,
+// or being "localhost"; see flux.ParseImageID.
 //
 func (c *client) GetRepository(repository string) (_ []flux.ImageDescription, err error) {
 	defer func(start time.Time) {
 		c.Metrics.FetchDuration.With(
-			LabelRepository, repository,
+			LabelRepository, c.Metrics.Labels.Repo(repository),
 			fluxmetrics.LabelSuccess, strconv.FormatBool(err == nil),
 		).Observe(time.Since(start).Seconds())
 	}(time.Now())
 
-	var host, org, image string
-	parts := strings.Split(repository, "/")
-	switch len(parts) {
-	case 1:
-		host = dockerHubHost
-		org = dockerHubLibrary
-		image = parts[0]
-	case 2:
-		host = dockerHubHost
-		org = parts[0]
-		image = parts[1]
-	case 3:
-		host = parts[0]
-		org = parts[1]
-		image = parts[2]
-	default:
-		return nil, fmt.Errorf(`expected image name as either "<host>/<org>/<image>", "<org>/<image>", or "<image>"`)
-	}
-
-	hostlessImageName := fmt.Sprintf("%s/%s", org, image)
-	httphost := "https://" + host
-
-	// quay.io wants us to use cookies for authorisation, so we have
-	// to construct one (the default client has none). This means a
-	// bit more constructing things to be able to make a registry
-	// client literal, rather than calling .New()
-	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	host, name, err := canonical(repository)
 	if err != nil {
 		return nil, err
 	}
-	auth := c.Credentials.credsFor(host)
-
-	// A context we'll use to cancel requests on error
-	ctx, cancel := context.WithCancel(context.Background())
-
-	// Use the wrapper to fix headers for quay.io, and remember bearer tokens
-	var transport http.RoundTripper = &wwwAuthenticateFixer{transport: http.DefaultTransport}
-	// Now the auth-handling wrappers that come with the library
-	transport = dockerregistry.WrapTransport(transport, httphost, auth.username, auth.password)
 
-	client := &dockerregistry.Registry{
-		URL: httphost,
-		Client: &http.Client{
-			Transport: roundtripperFunc(func(r *http.Request) (*http.Response, error) {
-				return transport.RoundTrip(r.WithContext(ctx))
-			}),
-			Jar: jar,
-		},
-		Logf: dockerregistry.Quiet,
-	}
-
-	start := time.Now()
-	tags, err := client.Tags(hostlessImageName)
-	c.Metrics.RequestDuration.With(
-		LabelRepository, repository,
-		LabelRequestKind, RequestKindTags,
-		fluxmetrics.LabelSuccess, strconv.FormatBool(err == nil),
-	).Observe(time.Since(start).Seconds())
-	if err != nil {
-		cancel()
-		return nil, err
-	}
+	// If there's a mirror, everything is fetched from there instead;
+	// the credentials are those for the mirror.
+	origin := host
+	host, hostlessImageName := c.Hosts.Mirrors.resolve(host, name)
+	auth := c.Credentials.credsFor(host)
 
-	// the hostlessImageName is canonicalised, in the sense that it
+	// The hostlessImageName is canonicalised, in the sense that it
 	// includes "library" as the org, if unqualified -- e.g.,
 	// `library/nats`. We need that to fetch the tags etc. However, we
 	// want the results to use the *actual* name of the images to be
 	// as supplied, e.g., `nats`.
-	return c.tagsToRepository(cancel, client, hostlessImageName, repository, tags)
-}
-
-func (c *client) lookupImage(client *dockerregistry.Registry, lookupName, imageName, tag string) (flux.ImageDescription, error) {
-	// Minor cheat: this will give the correct result even if the
-	// imageName includes a host
-	id := flux.MakeImageID("", imageName, tag)
-	img := flux.ImageDescription{ID: id}
-
-	start := time.Now()
-	meta, err := client.Manifest(lookupName, tag)
-	c.Metrics.RequestDuration.With(
-		LabelRepository, imageName,
-		LabelRequestKind, RequestKindMetadata,
-		fluxmetrics.LabelSuccess, strconv.FormatBool(err == nil),
-	).Observe(time.Since(start).Seconds())
-	if err != nil {
-		return img, err
-	}
-	// the manifest includes some v1-backwards-compatibility data,
-	// oddly called "History", which are layer metadata as JSON
-	// strings; these appear most-recent (i.e., topmost layer) first,
-	// so happily we can just decode the first entry to get a created
-	// time.
-	type v1image struct {
-		Created time.Time `json:"created"`
+	remote := Remote{
+		Host:      host,
+		Name:      hostlessImageName,
+		ImageName: repository,
+		Transport: c.Throttle.Transport(host, c.Transports.transport(host, auth)),
+		Tokens:    c.Transports.tokenCache(host, auth),
+		Username:  auth.username,
+		Password:  auth.password,
+		Logger:    c.Logger,
+		Metrics:   c.Metrics,
 	}
-	var topmost v1image
-	if err = json.Unmarshal([]byte(meta.History[0].V1Compatibility), &topmost); err == nil {
-		if !topmost.Created.IsZero() {
-			img.CreatedAt = &topmost.Created
-		}
+	images, err := c.Hosts.providerFor(host).Images(remote)
+	if err != nil {
+		return nil, c.Credentials.explain(err, repository, host, origin)
 	}
-
-	return img, err
+	sort.Sort(byCreatedDesc(images))
+	return images, nil
 }
 
-func (c *client) tagsToRepository(cancel func(), client *dockerregistry.Registry, lookupName, imageName string, tags []string) ([]flux.ImageDescription, error) {
-	// one way or another, we'll be finishing all requests
-	defer cancel()
-
-	type result struct {
-		image flux.ImageDescription
-		err   error
+// canonical gives the registry host and the name of an image
+// repository there, filling in what Docker assumes when they're not
+// given: Docker Hub, and the "library" organisation on it.
+func canonical(repository string) (host, name string, err error) {
+	id, err := flux.ParseImageID(repository)
+	if err != nil {
+		return "", "", err
 	}
-
-	fetched := make(chan result, len(tags))
-
-	for _, tag := range tags {
-		go func(t string) {
-			img, err := c.lookupImage(client, lookupName, imageName, t)
-			if err != nil {
-				c.Logger.Log("registry-metadata-err", err)
-			}
-			fetched <- result{img, err}
-		}(tag)
+	host = id.Host
+	if host == "" || host == "docker.io" {
+		host = dockerHubHost
 	}
-
-	images := make([]flux.ImageDescription, cap(fetched))
-	for i := 0; i < cap(fetched); i++ {
-		res := <-fetched
-		if res.err != nil {
-			return nil, res.err
-		}
-		images[i] = res.image
+	org := id.Org
+	if org == "" && host == dockerHubHost {
+		org = dockerHubLibrary
 	}
-
-	sort.Sort(byCreatedDesc(images))
-	return images, nil
+	if org == "" {
+		return host, id.Image, nil
+	}
+	return host, org + "/" + id.Image, nil
 }
 
 // --- Credentials
@@ -263,6 +188,10 @@ func CredentialsFromFile(path string) (Credentials, error) {
 }
 
 func CredentialsFromConfig(config flux.UnsafeInstanceConfig) (Credentials, error) {
+	anonymous := map[string]bool{}
+	for _, host := range config.Registry.Anonymous {
+		anonymous[host] = true
+	}
 	m := map[string]creds{}
 	for host, entry := range config.Registry.Auths {
 		decodedAuth, err := base64.StdEncoding.DecodeString(entry.Auth)
@@ -274,12 +203,28 @@ func CredentialsFromConfig(config flux.UnsafeInstanceConfig) (Credentials, error
 			username: authParts[0],
 			password: authParts[1],
 		}
+		if anonymous[credentialsHost(host)] {
+			return Credentials{}, fmt.Errorf("registry host %s is configured for anonymous pulls, but has credentials too", credentialsHost(host))
+		}
 	}
-	return Credentials{m: m}, nil
+	return Credentials{m: m, anonymous: anonymous}, nil
+}
+
+// credentialsHost gives the host that credentials are for, given the
+// key they're under; that may be a URL, e.g.,
+// "https://index.docker.io/v1/", as Docker has it.
+func credentialsHost(key string) string {
+	if u, err := url.Parse(key); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return key
 }
 
 // For yields an authenticator for a specific host.
 func (cs Credentials) credsFor(host string) creds {
+	if cs.anonymous[host] {
+		return creds{}
+	}
 	if cred, found := cs.m[host]; found {
 		return cred
 	}
@@ -305,6 +250,11 @@ type byCreatedDesc []flux.ImageDescription
 func (is byCreatedDesc) Len() int      { return len(is) }
 func (is byCreatedDesc) Swap(i, j int) { is[i], is[j] = is[j], is[i] }
 func (is byCreatedDesc) Less(i, j int) bool {
+	if is[i].CreatedAt == nil && is[j].CreatedAt == nil {
+		// Nothing to go on but the tags; assume later tags sort
+		// later, e.g., v1.2 after v1.1.
+		return is[i].ID.String() > is[j].ID.String()
+	}
 	if is[i].CreatedAt == nil {
 		return true
 	}
@@ -312,7 +262,7 @@ func (is byCreatedDesc) Less(i, j int) bool {
 		return false
 	}
 	if is[i].CreatedAt.Equal(*is[j].CreatedAt) {
-		return is[i].ID < is[j].ID
+		return is[i].ID.String() < is[j].ID.String()
 	}
 	return is[i].CreatedAt.After(*is[j].CreatedAt)
 }
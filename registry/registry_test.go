@@ -1,8 +1,11 @@
 package registry
 
 import (
+	"encoding/json"
 	"testing"
 
+	"github.com/pkg/errors"
+
 	"github.com/weaveworks/flux"
 )
 
@@ -32,10 +35,20 @@ var imageParsingExamples = map[string]image{
 		Tag:      "ver",
 	},
 	"shortreg/repo/image1": image{
-		Registry: "shortreg",
-		Name:     "repo/image1",
+		Registry: "",
+		Name:     "shortreg/repo/image1",
 		Tag:      "",
 	},
+	"localhost/foo/bar": image{
+		Registry: "localhost",
+		Name:     "foo/bar",
+		Tag:      "",
+	},
+	"localhost:5000/foo:1.0": image{
+		Registry: "localhost:5000",
+		Name:     "foo",
+		Tag:      "1.0",
+	},
 	"foo": image{
 		Registry: "",
 		Name:     "foo",
@@ -45,7 +58,11 @@ var imageParsingExamples = map[string]image{
 
 func TestParseImage(t *testing.T) {
 	for in, want := range imageParsingExamples {
-		outReg, outName, outTag := flux.ParseImageID(in).Components()
+		id, err := flux.ParseImageID(in)
+		if err != nil {
+			t.Fatalf("%s: %s", in, err)
+		}
+		outReg, outName, outTag := id.Components()
 		if outReg != want.Registry ||
 			outName != want.Name ||
 			outTag != want.Tag {
@@ -54,10 +71,60 @@ func TestParseImage(t *testing.T) {
 	}
 }
 
+func TestParseImageDigest(t *testing.T) {
+	digest := "sha256:6b9a4ef6d0e9bd7d03f4c5c1a2e1a4c0c5b2fb0d0b1b0b0f0c1a9f2e3d4c5b6a"
+	id, err := flux.ParseImageID("quay.io/weaveworks/helloworld:v1@" + digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Host != "quay.io" || id.Org != "weaveworks" || id.Image != "helloworld" || id.Tag != "v1" || id.Digest != digest {
+		t.Errorf("unexpected parts: %#v", id)
+	}
+	if id.String() != "quay.io/weaveworks/helloworld:v1@"+digest {
+		t.Errorf("expected image ID to be written as given, got %s", id)
+	}
+}
+
+func TestParseImageInvalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"foo//bar",
+		"Foo/bar",
+		"foo/bar:",
+		"foo/bar:ba/z",
+		"foo/bar@sha256:xyz",
+		"reg:port/foo/bar",
+	} {
+		id, err := flux.ParseImageID(in)
+		if errors.Cause(err) != flux.ErrInvalidImageID {
+			t.Errorf("%q: expected invalid image ID error, got %v", in, err)
+		}
+		if id.String() != in {
+			t.Errorf("%q: expected invalid image ID to be kept as given, got %q", in, id)
+		}
+	}
+}
+
+func TestImageJSON(t *testing.T) {
+	for _, in := range []string{"foo/bar:baz", "Not An Image"} {
+		var desc flux.ImageDescription
+		if err := json.Unmarshal([]byte(`{"ID":"`+in+`"}`), &desc); err != nil {
+			t.Fatal(err)
+		}
+		out, err := json.Marshal(desc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != `{"ID":"`+in+`"}` {
+			t.Errorf("expected image ID to survive JSON as %q, got %s", in, out)
+		}
+	}
+}
+
 func TestMakeImage(t *testing.T) {
 	for want, in := range imageParsingExamples {
 		out := flux.MakeImageID(in.Registry, in.Name, in.Tag)
-		if string(out) != want {
+		if out.String() != want {
 			t.Fatalf("%#v.String(): %s != %s", in, out, want)
 		}
 	}
@@ -72,7 +139,11 @@ func TestImageRepository(t *testing.T) {
 		"shortreg/repo/image1":                             "shortreg/repo/image1",
 		"foo": "foo",
 	} {
-		out := flux.ParseImageID(in).Repository()
+		id, err := flux.ParseImageID(in)
+		if err != nil {
+			t.Fatalf("%s: %s", in, err)
+		}
+		out := id.Repository()
 		if out != want {
 			t.Fatalf("%#v.Repository(): %s != %s", in, out, want)
 		}
@@ -0,0 +1,206 @@
+package registry
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+const (
+	// If a registry says to slow down (with a 429) and doesn't say
+	// for how long, we back off for this long, doubling each time it
+	// happens again, up to the maximum.
+	initialBackoff = 5 * time.Second
+	maxBackoff     = 5 * time.Minute
+)
+
+// Throttle limits the requests made to each registry host, and backs
+// off when a host says we've made too many (with a 429). It's shared
+// by all the registry clients, so that it knows about all the
+// requests to a host, and it keeps track of what's going on so that
+// it can be reported.
+type Throttle struct {
+	maxInFlight int
+
+	mu    sync.Mutex
+	hosts map[string]*hostThrottle
+}
+
+type hostThrottle struct {
+	slots        chan struct{}
+	queued       int
+	backoff      time.Duration
+	backoffUntil time.Time
+	last429      time.Time
+	remaining    *int
+	limit        *int
+}
+
+// NewThrottle makes a Throttle that allows at most maxInFlight
+// requests to each host at once; others are queued.
+func NewThrottle(maxInFlight int) *Throttle {
+	return &Throttle{
+		maxInFlight: maxInFlight,
+		hosts:       map[string]*hostThrottle{},
+	}
+}
+
+func (t *Throttle) host(host string) *hostThrottle {
+	h, ok := t.hosts[host]
+	if !ok {
+		h = &hostThrottle{slots: make(chan struct{}, t.maxInFlight)}
+		t.hosts[host] = h
+	}
+	return h
+}
+
+// Transport wraps the round-tripper given so that requests to host
+// are throttled. If t is nil, it returns the round-tripper as it is.
+func (t *Throttle) Transport(host string, rt http.RoundTripper) http.RoundTripper {
+	if t == nil {
+		return rt
+	}
+	return roundtripperFunc(func(req *http.Request) (*http.Response, error) {
+		release, err := t.acquire(req, host)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		res, err := rt.RoundTrip(req)
+		if err == nil {
+			t.observe(host, res)
+		}
+		return res, err
+	})
+}
+
+// acquire waits until any backoff is over and there's a free slot for
+// the host, or the request is cancelled.
+func (t *Throttle) acquire(req *http.Request, host string) (func(), error) {
+	t.mu.Lock()
+	h := t.host(host)
+	h.queued++
+	wait := h.backoffUntil.Sub(time.Now())
+	t.mu.Unlock()
+
+	dequeue := func() {
+		t.mu.Lock()
+		h.queued--
+		t.mu.Unlock()
+	}
+	if wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			dequeue()
+			return nil, req.Context().Err()
+		}
+	}
+	select {
+	case h.slots <- struct{}{}:
+		dequeue()
+		return func() { <-h.slots }, nil
+	case <-req.Context().Done():
+		dequeue()
+		return nil, req.Context().Err()
+	}
+}
+
+func (t *Throttle) observe(host string, res *http.Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := t.host(host)
+	now := time.Now()
+
+	if remaining, ok := rateLimitHeader(res.Header, "RateLimit-Remaining", "X-RateLimit-Remaining"); ok {
+		h.remaining = &remaining
+	}
+	if limit, ok := rateLimitHeader(res.Header, "RateLimit-Limit", "X-RateLimit-Limit"); ok {
+		h.limit = &limit
+	}
+
+	if res.StatusCode != http.StatusTooManyRequests {
+		h.backoff = 0
+		return
+	}
+	h.last429 = now
+	if secs, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && secs > 0 {
+		h.backoff = time.Duration(secs) * time.Second
+	} else if h.backoff == 0 {
+		h.backoff = initialBackoff
+	} else if h.backoff *= 2; h.backoff > maxBackoff {
+		h.backoff = maxBackoff
+	}
+	h.backoffUntil = now.Add(h.backoff)
+}
+
+// rateLimitHeader reads the first of the headers given that's
+// present. Docker Hub gives values like "100;w=21600", i.e., with the
+// window after the number.
+func rateLimitHeader(header http.Header, names ...string) (int, bool) {
+	for _, name := range names {
+		if v := header.Get(name); v != "" {
+			n, err := strconv.Atoi(strings.TrimSpace(strings.SplitN(v, ";", 2)[0]))
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
+
+// HostOf gives the registry host for an image repository, as
+// GetRepository would use.
+func HostOf(repository string) string {
+	host, _, err := canonical(repository)
+	if err != nil {
+		return dockerHubHost
+	}
+	return host
+}
+
+// State reports what's known about each of the hosts given, or all
+// the hosts requests have been made to, if none are given.
+func (t *Throttle) State(hosts ...string) []flux.RegistryHostState {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(hosts) == 0 {
+		for host := range t.hosts {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+
+	now := time.Now()
+	var res []flux.RegistryHostState
+	for _, host := range hosts {
+		h, ok := t.hosts[host]
+		if !ok {
+			res = append(res, flux.RegistryHostState{Host: host})
+			continue
+		}
+		s := flux.RegistryHostState{
+			Host:      host,
+			InFlight:  len(h.slots),
+			Queued:    h.queued,
+			Remaining: h.remaining,
+			Limit:     h.limit,
+		}
+		if h.backoffUntil.After(now) {
+			until := h.backoffUntil
+			s.BackoffUntil = &until
+		}
+		if !h.last429.IsZero() {
+			last := h.last429
+			s.Last429 = &last
+		}
+		res = append(res, s)
+	}
+	return res
+}
@@ -0,0 +1,65 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestThrottleBacksOffAfter429(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", "0;w=21600")
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	throttle := NewThrottle(2)
+	client := &http.Client{Transport: throttle.Transport("example.com", http.DefaultTransport)}
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	states := throttle.State("example.com")
+	if len(states) != 1 {
+		t.Fatalf("expected state for one host, got %+v", states)
+	}
+	s := states[0]
+	if s.Last429 == nil {
+		t.Error("expected last 429 to be recorded")
+	}
+	if s.BackoffUntil == nil {
+		t.Error("expected host to be backed off")
+	}
+	if s.Remaining == nil || *s.Remaining != 0 {
+		t.Errorf("expected remaining quota of 0, got %v", s.Remaining)
+	}
+	if s.Limit == nil || *s.Limit != 100 {
+		t.Errorf("expected quota limit of 100, got %v", s.Limit)
+	}
+	if s.InFlight != 0 || s.Queued != 0 {
+		t.Errorf("expected nothing in flight or queued, got %d and %d", s.InFlight, s.Queued)
+	}
+}
+
+func TestThrottleUnknownHost(t *testing.T) {
+	states := NewThrottle(1).State("quay.io")
+	if len(states) != 1 || states[0].Host != "quay.io" || states[0].BackoffUntil != nil {
+		t.Errorf("expected empty state for quay.io, got %+v", states)
+	}
+}
+
+func TestHostOf(t *testing.T) {
+	for repo, host := range map[string]string{
+		"alpine":                  dockerHubHost,
+		"weaveworks/flux":         dockerHubHost,
+		"quay.io/weaveworks/flux": "quay.io",
+	} {
+		if got := HostOf(repo); got != host {
+			t.Errorf("expected host of %q to be %q, got %q", repo, host, got)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package registry
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// How long a token lasts if the registry doesn't say; this is
+	// the default in the Docker token authentication spec.
+	defaultTokenLifetime = 60 * time.Second
+	// How long before it expires a token is no longer used, so it's
+	// not used up in flight.
+	tokenExpiryMargin = 5 * time.Second
+)
+
+// TokenCache keeps the bearer tokens obtained from a registry host,
+// with one set of credentials, for each repository, until they
+// expire. It's shared by all the lookups using the host and
+// credentials, so that each doesn't have to authenticate again.
+type TokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+	now    func() time.Time
+}
+
+type cachedToken struct {
+	header  string // e.g., "Bearer abc123"
+	expires time.Time
+}
+
+func NewTokenCache() *TokenCache {
+	return &TokenCache{
+		tokens: map[string]cachedToken{},
+		now:    time.Now,
+	}
+}
+
+// Get gives the Authorization header with the token for the
+// repository, if there's one that hasn't expired.
+func (c *TokenCache) Get(repository string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	token, ok := c.tokens[repository]
+	if !ok || !c.now().Before(token.expires) {
+		return "", false
+	}
+	return token.header, true
+}
+
+// Put keeps the Authorization header with the token for the
+// repository, for as long as it lasts (less a margin), or the default
+// lifetime if that's zero.
+func (c *TokenCache) Put(repository, header string, lifetime time.Duration) {
+	if c == nil {
+		return
+	}
+	if lifetime <= 0 {
+		lifetime = defaultTokenLifetime
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.tokens[repository] = cachedToken{header, now.Add(lifetime - tokenExpiryMargin)}
+	// Take the opportunity to forget anything expired
+	for repo, token := range c.tokens {
+		if !now.Before(token.expires) {
+			delete(c.tokens, repo)
+		}
+	}
+}
+
+// Forget drops the token for the repository, e.g., because it was
+// refused.
+func (c *TokenCache) Forget(repository string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.tokens, repository)
+	c.mu.Unlock()
+}
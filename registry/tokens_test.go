@@ -0,0 +1,43 @@
+package registry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenCacheExpiry(t *testing.T) {
+	now := time.Now()
+	c := NewTokenCache()
+	c.now = func() time.Time { return now }
+
+	c.Put("weaveworks/flux", "Bearer abc", 30*time.Second)
+	if h, ok := c.Get("weaveworks/flux"); !ok || h != "Bearer abc" {
+		t.Fatalf("expected token, got %q, %v", h, ok)
+	}
+	if _, ok := c.Get("weaveworks/helloworld"); ok {
+		t.Error("expected no token for another repository")
+	}
+
+	now = now.Add(30*time.Second - tokenExpiryMargin)
+	if _, ok := c.Get("weaveworks/flux"); ok {
+		t.Error("expected token to have expired")
+	}
+
+	c.Put("weaveworks/flux", "Bearer def", 0)
+	now = now.Add(defaultTokenLifetime - tokenExpiryMargin - time.Second)
+	if h, ok := c.Get("weaveworks/flux"); !ok || h != "Bearer def" {
+		t.Fatalf("expected token with default lifetime, got %q, %v", h, ok)
+	}
+	c.Forget("weaveworks/flux")
+	if _, ok := c.Get("weaveworks/flux"); ok {
+		t.Error("expected token to have been forgotten")
+	}
+}
+
+func TestTokenCacheNil(t *testing.T) {
+	var c *TokenCache
+	c.Put("weaveworks/flux", "Bearer abc", time.Minute)
+	if _, ok := c.Get("weaveworks/flux"); ok {
+		t.Error("expected nil cache to keep nothing")
+	}
+}
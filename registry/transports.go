@@ -0,0 +1,88 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Transports keeps an HTTP transport for each registry host and set
+// of credentials, shared by the registry clients of all instances, so
+// that connections (and their TLS sessions) are kept alive and reused
+// from one lookup to the next, rather than made afresh each time.
+// Transports aren't shared between credentials, so connections aren't
+// either.
+type Transports struct {
+	maxIdlePerHost int
+
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+	tokens     map[string]*TokenCache
+}
+
+// NewTransports makes a pool of transports each keeping up to
+// maxIdlePerHost idle connections; this should be at least as many
+// as the requests made to a host at once.
+func NewTransports(maxIdlePerHost int) *Transports {
+	return &Transports{
+		maxIdlePerHost: maxIdlePerHost,
+		transports:     map[string]*http.Transport{},
+		tokens:         map[string]*TokenCache{},
+	}
+}
+
+// transport gives the transport for requests to the host with the
+// credentials given. If the pool is nil, it's the default transport.
+func (p *Transports) transport(host string, auth creds) http.RoundTripper {
+	if p == nil {
+		return http.DefaultTransport
+	}
+	key := transportKey(host, auth)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.transports[key]; ok {
+		return t
+	}
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          p.maxIdlePerHost,
+		MaxIdleConnsPerHost:   p.maxIdlePerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	p.transports[key] = t
+	return t
+}
+
+// tokenCache gives the bearer tokens obtained from the host with the
+// credentials given. If the pool is nil, it's nil, and tokens aren't
+// kept.
+func (p *Transports) tokenCache(host string, auth creds) *TokenCache {
+	if p == nil {
+		return nil
+	}
+	key := transportKey(host, auth)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.tokens[key]; ok {
+		return c
+	}
+	c := NewTokenCache()
+	p.tokens[key] = c
+	return c
+}
+
+// transportKey identifies a host and credentials, without keeping
+// the credentials themselves.
+func transportKey(host string, auth creds) string {
+	sum := sha256.Sum256([]byte(auth.username + ":" + auth.password))
+	return host + "|" + hex.EncodeToString(sum[:])
+}
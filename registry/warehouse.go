@@ -0,0 +1,328 @@
+package registry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+// Warehouse keeps the image descriptions of repositories, as last
+// fetched for each instance, so that they can be used again without
+// going to the registry, for a while. Since registry credentials
+// belong to instances, nothing is shared between instances.
+//
+// What's kept can be bounded: beyond a number of images in memory,
+// the repositories least recently used are spilled to a store on disk
+// (or forgotten, if there isn't one); and beyond a number of images
+// for an instance, its repositories least recently used are
+// forgotten.
+type Warehouse struct {
+	maxAge time.Duration
+	limits WarehouseLimits
+	store  WarehouseStore
+
+	mu       sync.Mutex
+	repos    map[flux.InstanceID]map[string]*warehouseEntry
+	inMemory int
+}
+
+// WarehouseLimits bound what a warehouse keeps; zero means there's no
+// limit.
+type WarehouseLimits struct {
+	// MaxImagesInMemory is the most image descriptions held in
+	// memory, over all instances.
+	MaxImagesInMemory int
+	// MaxImagesPerInstance is the most image descriptions kept for
+	// each instance, in memory or in the store.
+	MaxImagesPerInstance int
+}
+
+// WarehouseStore keeps image descriptions spilled from memory.
+type WarehouseStore interface {
+	Put(flux.InstanceID, string, []flux.ImageDescription) error
+	Get(flux.InstanceID, string) ([]flux.ImageDescription, error)
+	Delete(flux.InstanceID, string) error
+	// Clear removes everything, e.g., anything left from a previous
+	// run.
+	Clear() error
+}
+
+type warehouseEntry struct {
+	images  []flux.ImageDescription // nil if spilled to the store
+	size    int
+	fetched time.Time
+	used    time.Time
+}
+
+type warehouseKey struct {
+	instID     flux.InstanceID
+	repository string
+}
+
+// NewWarehouse makes a warehouse keeping image descriptions for
+// maxAge, within the limits given. If store is nil, nothing is
+// spilled; otherwise, it's cleared to start with.
+func NewWarehouse(maxAge time.Duration, limits WarehouseLimits, store WarehouseStore) (*Warehouse, error) {
+	if store != nil {
+		if err := store.Clear(); err != nil {
+			return nil, errors.Wrap(err, "clearing registry cache store")
+		}
+	}
+	return &Warehouse{
+		maxAge: maxAge,
+		limits: limits,
+		store:  store,
+		repos:  map[flux.InstanceID]map[string]*warehouseEntry{},
+	}, nil
+}
+
+// Client gives a registry client for the instance given, which uses
+// image descriptions from the warehouse if they're fresh enough, and
+// otherwise fetches them with c and keeps them. If the warehouse is
+// nil, it's just c.
+func (w *Warehouse) Client(instID flux.InstanceID, c Client) Client {
+	if w == nil {
+		return c
+	}
+	return &warehouseClient{instID: instID, warehouse: w, client: c}
+}
+
+func (w *Warehouse) get(instID flux.InstanceID, repository string) ([]flux.ImageDescription, bool) {
+	w.mu.Lock()
+	entry, ok := w.repos[instID][repository]
+	if !ok || time.Since(entry.fetched) > w.maxAge {
+		w.mu.Unlock()
+		return nil, false
+	}
+	entry.used = time.Now()
+	if images := entry.images; images != nil {
+		w.mu.Unlock()
+		return images, true
+	}
+	w.mu.Unlock()
+
+	images, err := w.store.Get(instID, repository)
+	if err != nil {
+		// Treat it as missing; it'll be fetched and put again.
+		return nil, false
+	}
+	w.mu.Lock()
+	// Bring it back into memory, unless it's been replaced meanwhile
+	if w.repos[instID][repository] == entry && entry.images == nil {
+		entry.images = images
+		w.inMemory += entry.size
+	}
+	spill, drop := w.evict()
+	w.mu.Unlock()
+	w.flush(spill, drop)
+	return images, true
+}
+
+func (w *Warehouse) put(instID flux.InstanceID, repository string, images []flux.ImageDescription) {
+	w.mu.Lock()
+	repos, ok := w.repos[instID]
+	if !ok {
+		repos = map[string]*warehouseEntry{}
+		w.repos[instID] = repos
+	}
+	var drop []warehouseKey
+	if old, ok := repos[repository]; ok {
+		w.remove(instID, repository, old, &drop)
+	}
+	if images == nil {
+		// nil means spilled, so keep nothing as something
+		images = []flux.ImageDescription{}
+	}
+	now := time.Now()
+	repos[repository] = &warehouseEntry{images: images, size: len(images), fetched: now, used: now}
+	w.inMemory += len(images)
+	// Take the opportunity to forget anything stale
+	for repo, entry := range repos {
+		if now.Sub(entry.fetched) > w.maxAge {
+			w.remove(instID, repo, entry, &drop)
+		}
+	}
+	w.limitInstance(instID, repository, &drop)
+	spill, evicted := w.evict()
+	w.mu.Unlock()
+	w.flush(spill, append(drop, evicted...))
+}
+
+// remove forgets the entry, noting it to be deleted from the store if
+// it was spilled there. It's called with the lock held.
+func (w *Warehouse) remove(instID flux.InstanceID, repository string, entry *warehouseEntry, drop *[]warehouseKey) {
+	delete(w.repos[instID], repository)
+	if entry.images != nil {
+		w.inMemory -= entry.size
+	} else {
+		*drop = append(*drop, warehouseKey{instID, repository})
+	}
+}
+
+// limitInstance forgets the instance's least recently used
+// repositories, other than the one given, while it has more images
+// than it's allowed. It's called with the lock held.
+func (w *Warehouse) limitInstance(instID flux.InstanceID, keep string, drop *[]warehouseKey) {
+	max := w.limits.MaxImagesPerInstance
+	if max <= 0 {
+		return
+	}
+	repos := w.repos[instID]
+	total := 0
+	for _, entry := range repos {
+		total += entry.size
+	}
+	for total > max {
+		var (
+			lru  string
+			used time.Time
+		)
+		for repo, entry := range repos {
+			if repo != keep && (lru == "" || entry.used.Before(used)) {
+				lru, used = repo, entry.used
+			}
+		}
+		if lru == "" {
+			return
+		}
+		total -= repos[lru].size
+		w.remove(instID, lru, repos[lru], drop)
+	}
+}
+
+type spilled struct {
+	warehouseKey
+	images []flux.ImageDescription
+}
+
+// evict takes the least recently used repositories out of memory
+// while there are more images in memory than allowed, giving those
+// to spill to the store, or, if there's no store, forgetting them.
+// It's called with the lock held.
+func (w *Warehouse) evict() ([]spilled, []warehouseKey) {
+	max := w.limits.MaxImagesInMemory
+	if max <= 0 {
+		return nil, nil
+	}
+	var (
+		spill []spilled
+		drop  []warehouseKey
+	)
+	for w.inMemory > max {
+		var (
+			lru   *warehouseEntry
+			lruAt warehouseKey
+		)
+		for instID, repos := range w.repos {
+			for repo, entry := range repos {
+				if entry.images != nil && (lru == nil || entry.used.Before(lru.used)) {
+					lru, lruAt = entry, warehouseKey{instID, repo}
+				}
+			}
+		}
+		if lru == nil {
+			break
+		}
+		if w.store == nil {
+			w.remove(lruAt.instID, lruAt.repository, lru, &drop)
+			continue
+		}
+		spill = append(spill, spilled{lruAt, lru.images})
+		lru.images = nil
+		w.inMemory -= lru.size
+	}
+	return spill, drop
+}
+
+// flush writes what's been spilled to the store, and deletes what's
+// been forgotten from it. Anything which can't be written is
+// forgotten, so it's fetched again when it's next needed.
+func (w *Warehouse) flush(spill []spilled, drop []warehouseKey) {
+	if w.store == nil {
+		return
+	}
+	for _, s := range spill {
+		if err := w.store.Put(s.instID, s.repository, s.images); err != nil {
+			w.mu.Lock()
+			if entry, ok := w.repos[s.instID][s.repository]; ok && entry.images == nil {
+				delete(w.repos[s.instID], s.repository)
+			}
+			w.mu.Unlock()
+		}
+	}
+	for _, key := range drop {
+		w.store.Delete(key.instID, key.repository)
+	}
+}
+
+// Compact forgets everything stale, and anything beyond the limits,
+// each time there's a tick, until the ticks stop.
+func (w *Warehouse) Compact(tick <-chan time.Time, logger log.Logger) {
+	for range tick {
+		if err := w.compact(); err != nil {
+			logger.Log("err", err)
+		}
+	}
+}
+
+func (w *Warehouse) compact() error {
+	w.mu.Lock()
+	var drop []warehouseKey
+	now := time.Now()
+	for instID, repos := range w.repos {
+		for repo, entry := range repos {
+			if now.Sub(entry.fetched) > w.maxAge {
+				w.remove(instID, repo, entry, &drop)
+			}
+		}
+		if len(repos) == 0 {
+			delete(w.repos, instID)
+			continue
+		}
+		w.limitInstance(instID, "", &drop)
+	}
+	spill, evicted := w.evict()
+	w.mu.Unlock()
+
+	drop = append(drop, evicted...)
+	w.flush(spill, nil)
+	if w.store == nil {
+		return nil
+	}
+	var errs []string
+	for _, key := range drop {
+		if err := w.store.Delete(key.instID, key.repository); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Errorf("compacting registry cache store: %d deletion(s) failed, e.g., %s", len(errs), errs[0])
+	}
+	return nil
+}
+
+type warehouseClient struct {
+	instID    flux.InstanceID
+	warehouse *Warehouse
+	client    Client
+}
+
+func (c *warehouseClient) GetRepository(repository string) ([]flux.ImageDescription, error) {
+	if images, ok := c.warehouse.get(c.instID, repository); ok {
+		return images, nil
+	}
+	images, err := c.client.GetRepository(repository)
+	if err != nil {
+		return nil, err
+	}
+	c.warehouse.put(c.instID, repository, images)
+	return images, nil
+}
+
+func (c *warehouseClient) ListRepositories(namespace string) ([]string, error) {
+	return c.client.ListRepositories(namespace)
+}
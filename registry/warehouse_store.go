@@ -0,0 +1,88 @@
+package registry
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+// SQLWarehouseStore keeps image descriptions spilled from a warehouse
+// in a database; usually an embedded (ql) database file, since it
+// only needs to last as long as the process. The table is made if it
+// isn't there.
+type SQLWarehouseStore struct {
+	conn *sql.DB
+}
+
+func NewSQLWarehouseStore(driver, datasource string) (*SQLWarehouseStore, error) {
+	conn, err := sql.Open(driver, datasource)
+	if err != nil {
+		return nil, err
+	}
+	s := &SQLWarehouseStore{conn: conn}
+	return s, s.exec(`CREATE TABLE IF NOT EXISTS registry_cache
+  (instance   string NOT NULL,
+   repository string NOT NULL,
+   images     string NOT NULL)`)
+}
+
+func (s *SQLWarehouseStore) Put(instID flux.InstanceID, repository string, images []flux.ImageDescription) error {
+	bytes, err := json.Marshal(images)
+	if err != nil {
+		return errors.Wrap(err, "marshaling images")
+	}
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM registry_cache WHERE instance = $1 AND repository = $2`, string(instID), repository); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO registry_cache (instance, repository, images) VALUES ($1, $2, $3)`, string(instID), repository, string(bytes)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLWarehouseStore) Get(instID flux.InstanceID, repository string) ([]flux.ImageDescription, error) {
+	var imagesString string
+	if err := s.conn.QueryRow(`SELECT images FROM registry_cache WHERE instance = $1 AND repository = $2`, string(instID), repository).Scan(&imagesString); err != nil {
+		return nil, err
+	}
+	var images []flux.ImageDescription
+	if err := json.Unmarshal([]byte(imagesString), &images); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling images")
+	}
+	return images, nil
+}
+
+func (s *SQLWarehouseStore) Delete(instID flux.InstanceID, repository string) error {
+	return s.exec(`DELETE FROM registry_cache WHERE instance = $1 AND repository = $2`, string(instID), repository)
+}
+
+func (s *SQLWarehouseStore) Clear() error {
+	return s.exec(`DELETE FROM registry_cache`)
+}
+
+func (s *SQLWarehouseStore) Close() error {
+	return s.conn.Close()
+}
+
+// exec runs the statement in a transaction, which ql needs for
+// anything that writes.
+func (s *SQLWarehouseStore) exec(query string, args ...interface{}) error {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+type mapStore map[string][]flux.ImageDescription
+
+func (m mapStore) Put(instID flux.InstanceID, repo string, images []flux.ImageDescription) error {
+	m[string(instID)+"|"+repo] = images
+	return nil
+}
+
+func (m mapStore) Get(instID flux.InstanceID, repo string) ([]flux.ImageDescription, error) {
+	images, ok := m[string(instID)+"|"+repo]
+	if !ok {
+		return nil, fmt.Errorf("not found")
+	}
+	return images, nil
+}
+
+func (m mapStore) Delete(instID flux.InstanceID, repo string) error {
+	delete(m, string(instID)+"|"+repo)
+	return nil
+}
+
+func (m mapStore) Clear() error {
+	for k := range m {
+		delete(m, k)
+	}
+	return nil
+}
+
+func someImages(n int) []flux.ImageDescription {
+	return make([]flux.ImageDescription, n)
+}
+
+func TestWarehouseSpills(t *testing.T) {
+	store := mapStore{}
+	w, err := NewWarehouse(time.Hour, WarehouseLimits{MaxImagesInMemory: 10}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst := flux.InstanceID("instance")
+	w.put(inst, "first", someImages(6))
+	time.Sleep(time.Millisecond)
+	w.put(inst, "second", someImages(6))
+
+	if w.inMemory != 6 || len(store) != 1 {
+		t.Fatalf("expected the first repository to be spilled, got %d in memory and %v in the store", w.inMemory, store)
+	}
+	// It can still be had, from the store
+	if images, ok := w.get(inst, "first"); !ok || len(images) != 6 {
+		t.Errorf("expected the spilled images, got %v", images)
+	}
+}
+
+func TestWarehouseLimitsInstance(t *testing.T) {
+	w, err := NewWarehouse(time.Hour, WarehouseLimits{MaxImagesPerInstance: 10}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, other := flux.InstanceID("instance"), flux.InstanceID("other")
+	w.put(inst, "first", someImages(6))
+	w.put(other, "first", someImages(6))
+	time.Sleep(time.Millisecond)
+	w.put(inst, "second", someImages(6))
+
+	if _, ok := w.get(inst, "first"); ok {
+		t.Error("expected the least recently used repository of the instance to be forgotten")
+	}
+	if _, ok := w.get(inst, "second"); !ok {
+		t.Error("expected the repository just fetched to be kept")
+	}
+	if _, ok := w.get(other, "first"); !ok {
+		t.Error("expected other instances to be unaffected")
+	}
+}
@@ -0,0 +1,654 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/platform/kubernetes"
+)
+
+// The kinds of release action. These are stored along with plans, so
+// shouldn't be changed.
+const (
+	ActionPrintf              = "printf"
+	ActionSkip                = "skip"
+	ActionClone               = "clone"
+	ActionFindPodController   = "find_pod_controller"
+	ActionUpdatePodController = "update_pod_controller"
+	ActionCommitAndPush       = "commit_and_push"
+	ActionReleaseServices     = "release_services"
+	ActionApplyResources      = "apply_resources"
+	ActionUpdateImageFields   = "update_image_fields"
+	ActionDryRunApply         = "dry_run_apply"
+	ActionWaitForRollout      = "wait_for_rollout"
+	ActionCheckAlerts         = "check_alerts"
+	ActionShiftTraffic        = "shift_traffic"
+	ActionCheckPushed         = "check_pushed"
+)
+
+// ReleaseAction is a step in a release plan. It's plain data, so that
+// a plan can be serialised, stored and inspected, then executed later,
+// possibly somewhere else. Name says what kind of action it is, and
+// the other fields are parameters, used according to the kind.
+type ReleaseAction struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Service     flux.ServiceID    `json:"service,omitempty"`
+	Services    []flux.ServiceID  `json:"services,omitempty"`
+	Updates     []ContainerUpdate `json:"updates,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	// RefuseOnDrift makes updating a pod controller fail if the
+	// cluster has drifted from the config repo.
+	RefuseOnDrift bool `json:"refuseOnDrift,omitempty"`
+	// PruneSelector is the label selector for resources to delete if
+	// not defined in the config repo, when applying resources.
+	PruneSelector string `json:"pruneSelector,omitempty"`
+	// ImageFields are the fields, other than in container specs,
+	// which hold images, when updating image fields.
+	ImageFields []flux.ImageField `json:"imageFields,omitempty"`
+	// Timeout, if given, is how long the action may take (as parsed
+	// by time.ParseDuration), in place of that configured for its
+	// kind.
+	Timeout string `json:"timeout,omitempty"`
+	// Revision is the tip of the config repo branch when the release
+	// was planned, for cloning; if the files under the configured
+	// path have changed since, the plan is out of date. When checking
+	// what was pushed, it's the commit which should have been.
+	Revision string `json:"revision,omitempty"`
+	// Window is how long to watch for alerts, when checking alerts,
+	// and Rollback says whether to fail if any fire.
+	Window   string `json:"window,omitempty"`
+	Rollback bool   `json:"rollback,omitempty"`
+	// Container and Reason say what was left out of the release, and
+	// why, when skipping.
+	Container string `json:"container,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	// File is the definition file to change (relative to the config
+	// repo path), and Migration how, when migrating images.
+	File      string               `json:"file,omitempty"`
+	Migration *flux.ImageMigration `json:"migration,omitempty"`
+	Result    string               `json:"result"`
+}
+
+// actionFunc does (or undoes) an action. It should give up when the
+// context is cancelled, if it can.
+type actionFunc func(context.Context, *ReleaseContext, ReleaseAction) (string, error)
+
+// actionType gives the implementation of a kind of action. undo, if
+// not nil, compensates for what do did, should a later action fail.
+// noRetry is set for actions which won't do any better if they're
+// tried again.
+type actionType struct {
+	do      actionFunc
+	undo    actionFunc
+	noRetry bool
+}
+
+var actionTypes = map[string]actionType{
+	ActionPrintf:              {do: doPrintf},
+	ActionSkip:                {do: doPrintf},
+	ActionClone:               {do: doClone, noRetry: true},
+	ActionFindPodController:   {do: doFindPodController},
+	ActionUpdatePodController: {do: doUpdatePodController},
+	ActionCommitAndPush:       {do: doCommitAndPush, undo: undoCommitAndPush, noRetry: true},
+	ActionCheckPushed:         {do: doCheckPushed, noRetry: true},
+	ActionReleaseServices:     {do: doReleaseServices, undo: undoReleaseServices},
+	ActionApplyResources:      {do: doApplyResources},
+	ActionUpdateImageFields:   {do: doUpdateImageFields},
+	ActionDryRunApply:         {do: doDryRunApply},
+	ActionWaitForRollout:      {do: doWaitForRollout},
+	ActionCheckAlerts:         {do: doCheckAlerts, noRetry: true},
+	ActionShiftTraffic:        {do: doShiftTraffic, undo: undoShiftTraffic, noRetry: true},
+	ActionUpgradeSelf:         {do: doUpgradeSelf, noRetry: true},
+	ActionVerifyDaemon:        {do: doVerifyDaemon, noRetry: true},
+	ActionRestartService:      {do: doRestartService},
+	ActionMigrateImages:       {do: doMigrateImages},
+}
+
+// ValidatePlan checks that all the actions in a plan are of a known
+// kind, and have the parameters they need.
+func ValidatePlan(actions []ReleaseAction) error {
+	for i, action := range actions {
+		if _, ok := actionTypes[action.Name]; !ok {
+			return fmt.Errorf("action %d: unknown kind of action %q", i, action.Name)
+		}
+		switch action.Name {
+		case ActionFindPodController, ActionUpdatePodController, ActionRestartService, ActionShiftTraffic, ActionSkip:
+			if action.Service == "" {
+				return fmt.Errorf("action %d (%s): no service given", i, action.Name)
+			}
+		case ActionMigrateImages:
+			if action.File == "" || action.Migration == nil {
+				return fmt.Errorf("action %d (%s): no file or migration given", i, action.Name)
+			}
+		case ActionUpgradeSelf:
+			if len(action.Services) == 0 {
+				return fmt.Errorf("action %d (%s): no services given", i, action.Name)
+			}
+		case ActionCommitAndPush:
+			if action.Message == "" {
+				return fmt.Errorf("action %d (%s): no commit message given", i, action.Name)
+			}
+		case ActionCheckPushed:
+			if action.Revision == "" {
+				return fmt.Errorf("action %d (%s): no revision given", i, action.Name)
+			}
+		case ActionCheckAlerts:
+			if _, err := time.ParseDuration(action.Window); err != nil {
+				return fmt.Errorf("action %d (%s): invalid window %q", i, action.Name, action.Window)
+			}
+		}
+		if action.Timeout != "" {
+			if _, err := time.ParseDuration(action.Timeout); err != nil {
+				return fmt.Errorf("action %d (%s): invalid timeout %q", i, action.Name, action.Timeout)
+			}
+		}
+	}
+	return nil
+}
+
+func doPrintf(_ context.Context, _ *ReleaseContext, _ ReleaseAction) (string, error) {
+	return "", nil
+}
+
+func doClone(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	err := rc.CloneRepo(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "clone the config repo")
+	}
+	head, err := rc.HeadRevision()
+	if err != nil {
+		return "", errors.Wrap(err, "finding the revision cloned")
+	}
+	if action.Revision != "" && head != action.Revision {
+		changed, err := rc.Instance.ConfigRepo().WithContext(ctx).ChangedFiles(rc.WorkingDir, action.Revision, head)
+		if err != nil {
+			return "", errors.Wrap(err, "comparing the revision cloned with that planned against")
+		}
+		if len(changed) > 0 {
+			return "", errors.Wrap(&git.MovedError{
+				Branch: rc.Instance.ConfigRepo().Branch,
+				From:   action.Revision,
+				To:     head,
+				Files:  changed,
+			}, "the config repo has changed since the release was planned; plan it again")
+		}
+	}
+	rc.BaseRevision = head
+	return "Clone OK.", nil
+}
+
+func doFindPodController(_ context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	service := action.Service
+	resourcePath, err := rc.ServicePath(service)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(resourcePath); err != nil {
+		return "", fmt.Errorf("the resource path (%s) is not valid", resourcePath)
+	}
+
+	files, err := rc.FilesFor(resourcePath, service)
+
+	if err != nil {
+		return "", errors.Wrapf(err, "finding resource definition file for %s", service)
+	}
+	if len(files) <= 0 { // fine; we'll just skip it
+		return fmt.Sprintf("no resource definition file found for %s; skipping", service), nil
+	}
+	if len(files) > 1 {
+		return "", ambiguousDefinitionError(rc, map[flux.ServiceID][]string{service: files})
+	}
+
+	def, _, err := kubernetes.ReadDefinition(files[0], rc.DecryptSOPS()) // TODO(mb) not multi-doc safe
+	if err != nil {
+		return "", err
+	}
+	rc.SetPodController(service, def)
+	rc.SetOriginal(service, def)
+	return "Found pod controller OK.", nil
+}
+
+func doUpdatePodController(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	service := action.Service
+	resourcePath, err := rc.ServicePath(service)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(resourcePath); err != nil {
+		return "", fmt.Errorf("the resource path (%s) is not valid", resourcePath)
+	}
+
+	files, err := rc.FilesFor(resourcePath, service)
+	if err != nil {
+		return "", errors.Wrapf(err, "finding resource definition file for %s", service)
+	}
+	if len(files) <= 0 {
+		return fmt.Sprintf("no resource definition file found for %s; skipping", service), nil
+	}
+	if len(files) > 1 {
+		return "", ambiguousDefinitionError(rc, map[flux.ServiceID][]string{service: files})
+	}
+
+	def, encrypted, err := kubernetes.ReadDefinition(files[0], rc.DecryptSOPS())
+	if err != nil {
+		return "", err
+	}
+	// Kept so that the release can be rolled back.
+	rc.SetOriginal(service, def)
+
+	// Changes made directly to the cluster will be overwritten by
+	// the release, so say what they are.
+	drift, err := driftFromCluster(rc, service, def)
+	if err != nil {
+		rc.Instance.Log("service", service, "err", errors.Wrap(err, "comparing definition with cluster"))
+	}
+	if len(drift) > 0 && action.RefuseOnDrift {
+		return "", fmt.Errorf("the cluster differs from the config repo for %s, so refusing to release: %s", service, strings.Join(drift, "; "))
+	}
+
+	fi, err := os.Stat(files[0])
+	if err != nil {
+		return "", err
+	}
+
+	for _, update := range action.Updates {
+		// Note 1: UpdateContainer parses the target (new) image
+		// name, extracts the repository, and only mutates the line(s)
+		// in the definition of the container that match it. So for
+		// the time being we ignore the current image.
+		//
+		// Note 2: we keep overwriting the same def, to handle multiple
+		// images in a single file.
+		if update.Container != "" {
+			def, err = kubernetes.UpdateContainer(def, update.Container, update.Target.String(), ioutil.Discard)
+		} else {
+			def, err = kubernetes.UpdatePodController(def, update.Target.String(), ioutil.Discard)
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "updating pod controller for %s", update.Target)
+		}
+	}
+
+	// Write the file back, so commit/push works; unless the release
+	// has been abandoned meanwhile.
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := kubernetes.WriteDefinition(files[0], def, encrypted, fi.Mode()); err != nil {
+		return "", err
+	}
+
+	// Put the def in the map, so release works.
+	rc.SetPodController(service, def)
+	rc.SetUpdates(service, action.Updates)
+	if len(drift) > 0 {
+		return fmt.Sprintf("Update pod controller OK. Changes made in the cluster will be overwritten: %s", strings.Join(drift, "; ")), nil
+	}
+	return "Update pod controller OK.", nil
+}
+
+// driftFromCluster reports how the containers of a service, as
+// running in the cluster, differ from its definition (other than in
+// their images).
+func driftFromCluster(rc *ReleaseContext, service flux.ServiceID, def []byte) ([]string, error) {
+	defined, err := kubernetes.ContainersFor(def)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing definition")
+	}
+	services, err := rc.Instance.GetServices([]flux.ServiceID{service})
+	if err != nil {
+		return nil, errors.Wrap(err, "getting service from platform")
+	}
+	if len(services) == 0 {
+		return nil, nil
+	}
+	return platform.DiffContainers(defined, services[0].ContainersOrNil()), nil
+}
+
+// doDryRunApply has the platform validate the updated definitions
+// without applying them, so that anything the API server or an
+// admission controller would reject fails the release before it's
+// committed. The result says what would change.
+func doDryRunApply(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	var defs []platform.ServiceDefinition
+	for _, service := range action.Services {
+		if def, ok := rc.PodControllers[service]; ok {
+			defs = append(defs, platform.ServiceDefinition{
+				ServiceID:     service,
+				NewDefinition: def,
+			})
+		}
+	}
+	if len(defs) == 0 {
+		return "No updated definitions to check.", nil
+	}
+
+	changes, err := rc.Instance.WithContext(ctx).PlatformDryRunApply(defs)
+	switch err := err.(type) {
+	case nil:
+	case platform.ApplyError:
+		var rejected []string
+		for id, e := range err {
+			rejected = append(rejected, fmt.Sprintf("%s: %s", id, e))
+		}
+		sort.Strings(rejected)
+		return "", fmt.Errorf("the platform would reject %d of %d definitions: %s", len(err), len(defs), strings.Join(rejected, "; "))
+	default:
+		if err == platform.ErrDryRunUnsupported {
+			return "The platform doesn't support server-side dry runs; skipping.", nil
+		}
+		return "", errors.Wrap(err, "dry-run applying definitions")
+	}
+
+	var ids []string
+	for id := range changes {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+	res := fmt.Sprintf("Dry-run apply OK for %d service(s).", len(defs))
+	for _, id := range ids {
+		if diff := strings.TrimSpace(changes[flux.ServiceID(id)]); diff != "" {
+			res += fmt.Sprintf("\nChanges to %s:\n%s", id, diff)
+		}
+	}
+	return res, nil
+}
+
+func doCommitAndPush(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	msg := action.Message
+	if fi, err := os.Stat(rc.WorkingDir); err != nil || !fi.IsDir() {
+		return "", fmt.Errorf("the repo path (%s) is not valid", rc.WorkingDir)
+	}
+	result, err := rc.CommitAndPush(ctx, msg)
+	if err == nil && result == "" {
+		rc.Pushed = true
+		// This is only for the record, so not knowing it isn't fatal.
+		if rev, err := rc.HeadRevision(); err == nil {
+			rc.Revision = rev
+		}
+		return "Pushed commit: " + msg, nil
+	}
+	return result, err
+}
+
+func undoCommitAndPush(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	if !rc.Pushed {
+		return "Nothing was pushed; nothing to revert.", nil
+	}
+	if err := rc.RevertAndPush(ctx); err != nil {
+		return "", errors.Wrap(err, "reverting commit")
+	}
+	rc.Pushed = false
+	return "Pushed revert of commit: " + action.Message, nil
+}
+
+// doCheckPushed makes sure that the commit an interrupted attempt at
+// the release recorded pushing is in the config repo, before the
+// release carries on from there.
+func doCheckPushed(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	if !rc.Instance.ConfigRepo().WithContext(ctx).Contains(rc.WorkingDir, action.Revision) {
+		return "", fmt.Errorf("the commit %s, recorded as pushed before the release was interrupted, is not in the config repo; release again", action.Revision)
+	}
+	rc.Revision = action.Revision
+	return "Changes were pushed to the config repo before the release was interrupted; continuing from there.", nil
+}
+
+func doReleaseServices(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	services, msg := action.Services, action.Message
+	cause := strconv.Quote(msg)
+	rc.SetReleased(time.Now())
+
+	// We'll collect results for each service release.
+	results := map[flux.ServiceID]error{}
+
+	// Collect definitions for each service release.
+	var defs []platform.ServiceDefinition
+	// If we're regrading our own image, we want to do that
+	// last, and "asynchronously" (meaning we probably won't
+	// see the reply).
+	var asyncDefs []platform.ServiceDefinition
+	// References to the marks made at the start of each release, to
+	// be finished when we know the result.
+	annotations := map[flux.ServiceID]string{}
+
+	for _, service := range services {
+		def, ok := rc.PodControllers[service]
+		if !ok {
+			results[service] = errors.New("no definition found; skipping release")
+			continue
+		}
+
+		namespace, serviceName := service.Components()
+		switch serviceName {
+		case FluxServiceName, FluxDaemonName:
+			rc.Instance.LogEvent(namespace, serviceName, "Starting "+cause+". (no result expected)")
+			asyncDefs = append(asyncDefs, platform.ServiceDefinition{
+				ServiceID:     service,
+				NewDefinition: def,
+			})
+		default:
+			rc.Instance.LogEvent(namespace, serviceName, "Starting "+cause)
+			ref, err := rc.Instance.ReleaseStarted(service, imageReleases(rc, service))
+			if err != nil {
+				rc.Instance.Log("err", errors.Wrap(err, "annotating start of release"))
+			}
+			annotations[service] = ref
+			defs = append(defs, platform.ServiceDefinition{
+				ServiceID:     service,
+				NewDefinition: def,
+			})
+		}
+	}
+
+	// Execute the releases as a single transaction.
+	// Splat any errors into our results map.
+	transactionErr := rc.Instance.WithContext(ctx).PlatformApply(defs)
+	if transactionErr != nil {
+		switch err := transactionErr.(type) {
+		case platform.ApplyError:
+			for id, applyErr := range err {
+				results[id] = applyErr
+			}
+		default: // assume everything failed, if there was a coverall error
+			for _, service := range services {
+				results[service] = transactionErr
+			}
+		}
+	}
+
+	// Report individual service release results.
+	var released []flux.ImageRelease
+	for _, service := range services {
+		namespace, serviceName := service.Components()
+		switch serviceName {
+		case FluxServiceName, FluxDaemonName:
+			continue
+		default:
+			if err := rc.Instance.ReleaseFinished(annotations[service], service, imageReleases(rc, service), results[service]); err != nil {
+				rc.Instance.Log("err", errors.Wrap(err, "annotating finish of release"))
+			}
+			if err := results[service]; err == nil { // no entry = nil error
+				rc.Instance.LogEvent(namespace, serviceName, msg+". done")
+				released = append(released, imageReleases(rc, service)...)
+			} else {
+				rc.Instance.LogEvent(namespace, serviceName, msg+". error: "+err.Error()+". failed")
+				failed := imageReleases(rc, service)
+				for i := range failed {
+					failed[i].Failed = true
+				}
+				released = append(released, failed...)
+			}
+		}
+	}
+
+	if len(released) > 0 {
+		// Before this release is recorded, so it's compared with
+		// those before it.
+		markReleasedOver(rc, released, time.Now())
+		if err := rc.Instance.LogImageReleases(released); err != nil {
+			rc.Instance.Log("err", errors.Wrap(err, "recording image releases"))
+		}
+	}
+
+	// Lastly, services for which we don't expect a result
+	// (i.e., ourselves). This will kick off the release in
+	// the daemon, which will cause Kubernetes to restart the
+	// service. In the meantime, however, we will have
+	// finished recording what happened, as part of a graceful
+	// shutdown. So the only thing that goes missing is the
+	// result from this release call. (Plans made with self-upgrade
+	// enabled release flux in actions of their own, after which the
+	// daemon is checked, and the upgrade can be abandoned by hand;
+	// see withSelfUpgrade.)
+	if len(asyncDefs) > 0 {
+		go func() {
+			rc.Instance.PlatformApply(asyncDefs)
+		}()
+	}
+
+	return "", transactionErr
+}
+
+func doUpdateImageFields(_ context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	resourcePath, err := rc.RepoPath()
+	if err != nil {
+		return "", err
+	}
+	if fi, err := os.Stat(resourcePath); err != nil || !fi.IsDir() {
+		return "", fmt.Errorf("the resource path (%s) is not valid", resourcePath)
+	}
+	var images []flux.ImageID
+	for _, update := range action.Updates {
+		images = append(images, update.Target)
+	}
+	limits, err := rc.ScanLimits()
+	if err != nil {
+		return "", err
+	}
+	changes, err := kubernetes.UpdateImageFields(resourcePath, action.ImageFields, images, rc.DecryptSOPS(), limits)
+	if err != nil {
+		return "", errors.Wrap(err, "updating image fields")
+	}
+	if len(changes) == 0 {
+		return "No image fields to update.", nil
+	}
+	return "Updated image fields: " + strings.Join(changes, "; "), nil
+}
+
+func doApplyResources(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	resourcePath, err := rc.RepoPath()
+	if err != nil {
+		return "", err
+	}
+	if fi, err := os.Stat(resourcePath); err != nil || !fi.IsDir() {
+		return "", fmt.Errorf("the resource path (%s) is not valid", resourcePath)
+	}
+	defaults, err := rc.NamespaceDefaults()
+	if err != nil {
+		return "", err
+	}
+	limits, err := rc.ScanLimits()
+	if err != nil {
+		return "", err
+	}
+	defs, err := kubernetes.ResourcesIn(resourcePath, defaults, rc.DecryptSOPS(), limits)
+	if err != nil {
+		return "", errors.Wrap(err, "finding resource definitions")
+	}
+	if len(defs) == 0 && action.PruneSelector == "" {
+		return "No resources other than workloads found; nothing to apply.", nil
+	}
+	if err := rc.Instance.WithContext(ctx).PlatformApplyResources(platform.ResourceSet{
+		Definitions:   defs,
+		PruneSelector: action.PruneSelector,
+	}); err != nil {
+		return "", err
+	}
+	if action.PruneSelector != "" {
+		return fmt.Sprintf("Applied %d resource(s), pruning those matching %s.", len(defs), action.PruneSelector), nil
+	}
+	return fmt.Sprintf("Applied %d resource(s).", len(defs)), nil
+}
+
+// undoReleaseServices puts back the definitions of the services
+// updated, as they were before the release, and marks the images they
+// were released to as suspect. Flux's own services are left alone; a
+// self-upgrade has its own way of being abandoned.
+func undoReleaseServices(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	var defs []platform.ServiceDefinition
+	rc.mu.Lock()
+	for _, service := range action.Services {
+		if _, updated := rc.Updates[service]; !updated {
+			continue
+		}
+		switch _, serviceName := service.Components(); serviceName {
+		case FluxServiceName, FluxDaemonName:
+			continue
+		}
+		if def, ok := rc.Originals[service]; ok {
+			defs = append(defs, platform.ServiceDefinition{
+				ServiceID:     service,
+				NewDefinition: def,
+			})
+		}
+	}
+	rc.mu.Unlock()
+	if len(defs) == 0 {
+		return "No service definitions to restore.", nil
+	}
+	if err := rc.Instance.WithContext(ctx).PlatformApply(defs); err != nil {
+		return "", errors.Wrap(err, "restoring service definitions")
+	}
+	now := time.Now()
+	for _, def := range defs {
+		namespace, serviceName := def.ServiceID.Components()
+		rc.Instance.LogEvent(namespace, serviceName, "Rolled back release: "+action.Message)
+		var released []flux.ImageID
+		rc.mu.Lock()
+		for _, update := range rc.Updates[def.ServiceID] {
+			if update.Target != update.Current {
+				released = append(released, update.Target)
+			}
+		}
+		rc.mu.Unlock()
+		if err := markSuspect(rc.Instance, def.ServiceID, released, SuspectReleaseRolledBack, now); err != nil {
+			rc.Instance.Log("service", def.ServiceID, "err", errors.Wrap(err, "marking images as suspect"))
+		}
+	}
+	return fmt.Sprintf("Restored the previous definitions of %d service(s).", len(defs)), nil
+}
+
+// imageReleases makes the history records for the image changes made
+// to a service in this release.
+func imageReleases(rc *ReleaseContext, service flux.ServiceID) []flux.ImageRelease {
+	var res []flux.ImageRelease
+	for _, update := range rc.Updates[service] {
+		res = append(res, flux.ImageRelease{
+			Service:     service,
+			Container:   update.Container,
+			From:        update.Current,
+			To:          update.Target,
+			FromDigest:  update.Current.Digest,
+			ToDigest:    update.Target.Digest,
+			Revision:    rc.Revision,
+			Branch:      rc.Instance.ConfigRepo().Branch,
+			ToCreatedAt: update.TargetCreatedAt,
+		})
+	}
+	return res
+}
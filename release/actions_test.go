@@ -0,0 +1,108 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/platform/kubernetes"
+	"github.com/weaveworks/flux/registry"
+)
+
+const helloworldDef = `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: %s
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+      - name: main
+        image: quay.io/weaveworks/helloworld:v1
+`
+
+// testContext gives a release context for a "clone" holding the files
+// given, each defining the services given for it, as though it had
+// been indexed already.
+func testContext(t *testing.T, p platform.Platform, files map[string][]flux.ServiceID, contents map[string]string) (*ReleaseContext, func()) {
+	dir, err := ioutil.TempDir("", "flux-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := kubernetes.FileIndex{}
+	for file, services := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(contents[file]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, service := range services {
+			index[string(service)] = append(index[string(service)], file)
+		}
+	}
+	inst := instance.New(p, registry.NewFake(), staticConfig{instance.MakeConfig()}, git.Repo{Branch: "master"}, log.NewNopLogger(), nopHistogram{}, nopHistory{}, nopHistory{}, nopHistory{}, history.NopAnnotator{})
+	rc := NewReleaseContext(inst)
+	rc.WorkingDir, rc.BaseRevision = dir, "base"
+	rc.indexes = newFileIndexes()
+	path, err := rc.RepoPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.indexes.Get(rc.indexKey(path, flux.GitConfig{}), func() (kubernetes.FileIndex, error) {
+		return index, nil
+	})
+	return rc, func() { os.RemoveAll(dir) }
+}
+
+func TestUndoReleaseServicesRestoresUpdated(t *testing.T) {
+	updated := flux.MakeServiceID("default", "helloworld")
+	found := flux.MakeServiceID("default", "other")
+	fake := platform.NewFake(
+		platform.Service{ID: updated, Containers: platform.ContainersOrExcuse{Containers: []platform.Container{{Name: "main", Image: "quay.io/weaveworks/helloworld:v1"}}}},
+		platform.Service{ID: found, Containers: platform.ContainersOrExcuse{Containers: []platform.Container{{Name: "main", Image: "quay.io/weaveworks/helloworld:v1"}}}},
+	)
+	rc, cleanup := testContext(t, fake,
+		map[string][]flux.ServiceID{"helloworld.yaml": {updated}, "other.yaml": {found}},
+		map[string]string{
+			"helloworld.yaml": fmt.Sprintf(helloworldDef, "helloworld"),
+			"other.yaml":      fmt.Sprintf(helloworldDef, "other"),
+		})
+	defer cleanup()
+
+	update := ContainerUpdate{
+		Container: "main",
+		Current:   mustParseImageID(t, "quay.io/weaveworks/helloworld:v1"),
+		Target:    mustParseImageID(t, "quay.io/weaveworks/helloworld:v2"),
+	}
+	release := ReleaseAction{Name: ActionReleaseServices, Services: []flux.ServiceID{updated, found}, Message: "Release"}
+	for _, action := range []ReleaseAction{
+		{Name: ActionFindPodController, Service: found},
+		{Name: ActionUpdatePodController, Service: updated, Updates: []ContainerUpdate{update}},
+		release,
+	} {
+		if _, err := actionTypes[action.Name].do(context.Background(), rc, action); err != nil {
+			t.Fatalf("%s: %v", action.Name, err)
+		}
+	}
+	before := len(fake.Applied())
+
+	if _, err := undoReleaseServices(context.Background(), rc, release); err != nil {
+		t.Fatal(err)
+	}
+	restored := fake.Applied()[before:]
+	if len(restored) != 1 || restored[0].ServiceID != updated {
+		t.Fatalf("expected only %s to be restored, got %+v", updated, restored)
+	}
+	if string(restored[0].NewDefinition) != fmt.Sprintf(helloworldDef, "helloworld") {
+		t.Errorf("expected the original definition to be applied again, got:\n%s", restored[0].NewDefinition)
+	}
+}
@@ -0,0 +1,69 @@
+package release
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/policy"
+)
+
+// Admission decides whether releases may go ahead; it's satisfied by
+// *policy.OPA.
+type Admission interface {
+	Decide(policy.Input) (policy.Decision, error)
+}
+
+// AdmitWith has each release, once planned (or loaded, if it was
+// planned earlier), put to the admission policy given, which may
+// refuse it or change its plan. It's for setting up the releaser,
+// before it handles any jobs.
+func (r *Releaser) AdmitWith(a Admission) {
+	r.admission = a
+}
+
+// admit puts the release to the admission policy, if there is one,
+// and gives the actions to do: those planned, or those the policy
+// gave instead. The decision is recorded in the job. If the policy
+// can't be asked, the release doesn't go ahead.
+func (r *Releaser) admit(inst *instance.Instance, job *jobs.Job, params jobs.ReleaseJobParams, releaseType string, actions []ReleaseAction, updateJob func(string, ...interface{})) ([]ReleaseAction, error) {
+	if r.admission == nil {
+		return actions, nil
+	}
+	decision, err := r.admission.Decide(policy.Input{
+		Instance: job.Instance,
+		Job:      job.ID,
+		User:     params.User,
+		Kind:     params.Kind,
+		Type:     releaseType,
+		Params:   params,
+		Actions:  actions,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "checking release against policy")
+	}
+	if !decision.Allowed() {
+		reasons := strings.Join(decision.Deny, "; ")
+		updateJob("Release denied by policy: %s.", reasons)
+		inst.Log("policy", "deny", "reasons", reasons)
+		return nil, errors.Errorf("release denied by policy: %s", reasons)
+	}
+	if len(decision.Plan) == 0 {
+		updateJob("Release allowed by policy.")
+		inst.Log("policy", "allow")
+		return actions, nil
+	}
+	var changed []ReleaseAction
+	if err := json.Unmarshal(decision.Plan, &changed); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling plan given by policy")
+	}
+	if err := ValidatePlan(changed); err != nil {
+		return nil, errors.Wrap(err, "validating plan given by policy")
+	}
+	updateJob("Release allowed by policy, with the plan changed from %d actions to %d.", len(actions), len(changed))
+	inst.Log("policy", "change", "actions", len(changed))
+	return changed, nil
+}
@@ -0,0 +1,171 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+const (
+	// How often to look for alerts while watching.
+	alertPollInterval = 30 * time.Second
+	// How much longer than its window checking alerts may take
+	// before it's timed out.
+	alertCheckGrace = time.Minute
+)
+
+// alert is an alert firing, from Alertmanager or Prometheus.
+type alert struct {
+	Labels map[string]string
+	Since  time.Time
+}
+
+func (a alert) name() string {
+	return a.Labels["alertname"]
+}
+
+// doCheckAlerts watches for alerts about the services released for
+// the window given, and reports any which have started firing since
+// the release. If the action says to roll back, they fail the action
+// (and so the release).
+func doCheckAlerts(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	config, err := rc.Instance.GetConfig()
+	if err != nil {
+		return "", errors.Wrap(err, "getting instance config")
+	}
+	check := config.Settings.AlertCheck
+	if check == nil {
+		return "Alerts are no longer checked for this instance; skipping.", nil
+	}
+	window, err := time.ParseDuration(action.Window)
+	if err != nil {
+		return "", errors.Wrap(err, "parsing window")
+	}
+
+	rc.mu.Lock()
+	since := rc.Released
+	rc.mu.Unlock()
+	if since.IsZero() {
+		// Resumed after the release; the best we can do is to look
+		// for alerts from now on.
+		since = time.Now()
+	}
+
+	deadline := time.NewTimer(window)
+	defer deadline.Stop()
+	ticker := time.NewTicker(alertPollInterval)
+	defer ticker.Stop()
+	for {
+		alerts, err := firingAlerts(ctx, *check)
+		if err != nil {
+			return "", errors.Wrap(err, "getting alerts")
+		}
+		if found := alertsFor(alerts, action.Services, since, *check); len(found) > 0 {
+			msg := "New alerts firing since the release: " + strings.Join(found, ", ")
+			if action.Rollback {
+				return "", errors.New(msg)
+			}
+			return msg + ".", nil
+		}
+		select {
+		case <-deadline.C:
+			return fmt.Sprintf("No new alerts about %d service(s) within %s of the release.", len(action.Services), window), nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// alertsFor gives the names of alerts about the services given,
+// which started firing since the time given, with the service each is
+// about.
+func alertsFor(alerts []alert, services []flux.ServiceID, since time.Time, check flux.AlertCheckConfig) []string {
+	namespaceLabel, serviceLabel := check.NamespaceLabel, check.ServiceLabel
+	if namespaceLabel == "" {
+		namespaceLabel = "namespace"
+	}
+	if serviceLabel == "" {
+		serviceLabel = "service"
+	}
+	watched := flux.ServiceIDSet{}
+	watched.Add(services)
+
+	var res []string
+	for _, a := range alerts {
+		if a.Since.Before(since) {
+			continue
+		}
+		id := flux.MakeServiceID(a.Labels[namespaceLabel], a.Labels[serviceLabel])
+		if watched.Contains(id) {
+			res = append(res, fmt.Sprintf("%s (%s)", a.name(), id))
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// firingAlerts asks Alertmanager or Prometheus, whichever is
+// configured, for the alerts firing.
+func firingAlerts(ctx context.Context, check flux.AlertCheckConfig) ([]alert, error) {
+	var res []alert
+	if check.AlertmanagerURL != "" {
+		var alerts []struct {
+			Labels   map[string]string `json:"labels"`
+			StartsAt time.Time         `json:"startsAt"`
+		}
+		if err := getJSON(ctx, strings.TrimSuffix(check.AlertmanagerURL, "/")+"/api/v2/alerts?active=true&silenced=false&inhibited=false", &alerts); err != nil {
+			return nil, err
+		}
+		for _, a := range alerts {
+			res = append(res, alert{Labels: a.Labels, Since: a.StartsAt})
+		}
+		return res, nil
+	}
+
+	var resp struct {
+		Data struct {
+			Alerts []struct {
+				Labels   map[string]string `json:"labels"`
+				State    string            `json:"state"`
+				ActiveAt time.Time         `json:"activeAt"`
+			} `json:"alerts"`
+		} `json:"data"`
+	}
+	if err := getJSON(ctx, strings.TrimSuffix(check.PrometheusURL, "/")+"/api/v1/alerts", &resp); err != nil {
+		return nil, err
+	}
+	for _, a := range resp.Data.Alerts {
+		if a.State == "firing" {
+			res = append(res, alert{Labels: a.Labels, Since: a.ActiveAt})
+		}
+	}
+	return res, nil
+}
+
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return errors.Wrap(err, "constructing request")
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+		return fmt.Errorf("%s from %s (%s)", resp.Status, url, strings.TrimSpace(string(body)))
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(v), "decoding response from %s", url)
+}
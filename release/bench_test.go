@@ -0,0 +1,247 @@
+package release
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/registry"
+)
+
+// The size of the synthetic instance released in the benchmarks: the
+// services are spread evenly over the repositories, and the tags over
+// the repositories.
+var (
+	benchServices = flag.Int("bench-services", 1000, "number of services in the synthetic instance")
+	benchRepos    = flag.Int("bench-repos", 100, "number of image repositories in the synthetic instance")
+	benchTags     = flag.Int("bench-tags", 100000, "number of tags, over all repositories, in the synthetic instance")
+)
+
+const benchInstance = flux.InstanceID("bench")
+
+func benchRepo(i int) string {
+	return fmt.Sprintf("quay.io/bench/repo%d", i%*benchRepos)
+}
+
+func benchServiceID(i int) flux.ServiceID {
+	return flux.MakeServiceID("bench", fmt.Sprintf("service%d", i))
+}
+
+// syntheticServices gives services each running the oldest tag of its
+// repository, so each can be updated.
+func syntheticServices() []platform.Service {
+	var services []platform.Service
+	for i := 0; i < *benchServices; i++ {
+		services = append(services, platform.Service{
+			ID: benchServiceID(i),
+			Containers: platform.ContainersOrExcuse{
+				Containers: []platform.Container{{
+					Name:  "main",
+					Image: benchRepo(i) + ":v0",
+				}},
+			},
+		})
+	}
+	return services
+}
+
+func syntheticRegistry(b *testing.B) *registry.Fake {
+	r := registry.NewFake()
+	now := time.Now()
+	perRepo := *benchTags / *benchRepos
+	for i := 0; i < *benchRepos; i++ {
+		for t := 0; t < perRepo; t++ {
+			if err := r.AddImage(fmt.Sprintf("%s:v%d", benchRepo(i), t), now.Add(time.Duration(t)*time.Second), nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	return r
+}
+
+func syntheticImages(b *testing.B) instance.ImageMap {
+	r := syntheticRegistry(b)
+	images := instance.ImageMap{}
+	for i := 0; i < *benchRepos; i++ {
+		repo, err := r.GetRepository(benchRepo(i))
+		if err != nil {
+			b.Fatal(err)
+		}
+		images[benchRepo(i)] = repo
+	}
+	return images
+}
+
+func BenchmarkCalculateUpdates(b *testing.B) {
+	services, images := syntheticServices(), syntheticImages(b)
+	skip := func(jobs.Skip, string, ...interface{}) {}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		CalculateUpdates(services, images, skip)
+	}
+}
+
+func BenchmarkCollectAvailableImages(b *testing.B) {
+	inst := instance.New(platform.NewFake(syntheticServices()...), syntheticRegistry(b), staticConfig{instance.MakeConfig()}, git.Repo{}, log.NewNopLogger(), nopHistogram{}, nopHistory{}, nopHistory{}, nopHistory{}, history.NopAnnotator{})
+	services := syntheticServices()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := inst.CollectAvailableImages(services); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkPlanAndExecute releases every service to the latest image,
+// from the synthetic registry, through a config repo made on the
+// spot. It needs git, and kubeservice, to find the definitions.
+func BenchmarkPlanAndExecute(b *testing.B) {
+	if _, err := exec.LookPath("git"); err != nil {
+		b.Skip("git not found")
+	}
+	if _, err := exec.LookPath("kubeservice"); err != nil {
+		b.Skip("kubeservice not found")
+	}
+	images := syntheticRegistry(b)
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		repo, cleanup := syntheticConfigRepo(b)
+		inst := instance.New(platform.NewFake(syntheticServices()...), images, staticConfig{instance.MakeConfig()}, repo, log.NewNopLogger(), nopHistogram{}, nopHistory{}, nopHistory{}, nopHistory{}, history.NopAnnotator{})
+		r := NewReleaser(staticInstancer{inst}, Metrics{ReleaseDuration: nopHistogram{}, ActionDuration: nopHistogram{}, StageDuration: nopHistogram{}, NothingToDo: nopCounter{}}, FailureRollback, DefaultTimeouts, flux.DefaultFeatures)
+		job := &jobs.Job{
+			ID:       jobs.NewJobID(),
+			Instance: benchInstance,
+			Params: jobs.ReleaseJobParams{
+				ServiceSpec: flux.ServiceSpecAll,
+				ImageSpec:   flux.ImageSpecLatest,
+				Kind:        flux.ReleaseKindExecute,
+			},
+		}
+		b.StartTimer()
+
+		if _, err := r.Handle(job, nopUpdater{}); err != nil {
+			b.Fatal(err)
+		}
+
+		b.StopTimer()
+		cleanup()
+		b.StartTimer()
+	}
+}
+
+// syntheticConfigRepo makes a bare git repo with a file defining each
+// synthetic service.
+func syntheticConfigRepo(b *testing.B) (git.Repo, func()) {
+	dir, err := ioutil.TempDir("", "flux-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	origin, work := filepath.Join(dir, "origin.git"), filepath.Join(dir, "work")
+	run := func(dir string, args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Bench", "-c", "user.email=bench@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			b.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run(dir, "init", "--bare", origin)
+	run(dir, "clone", origin, work)
+	for i := 0; i < *benchServices; i++ {
+		_, name := benchServiceID(i).Components()
+		def := fmt.Sprintf(`---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: %[1]s
+  namespace: bench
+spec:
+  template:
+    metadata:
+      labels:
+        name: %[1]s
+    spec:
+      containers:
+      - name: main
+        image: %[2]s:v0
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: %[1]s
+  namespace: bench
+spec:
+  selector:
+    name: %[1]s
+`, name, benchRepo(i))
+		if err := ioutil.WriteFile(filepath.Join(work, name+".yaml"), []byte(def), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	run(work, "add", ".")
+	run(work, "commit", "-m", "Synthetic services")
+	run(work, "push", "origin", "HEAD:master")
+	return git.Repo{URL: origin, Branch: "master", WorkingDir: filepath.Join(dir, "clones")}, func() { os.RemoveAll(dir) }
+}
+
+type staticInstancer struct {
+	inst *instance.Instance
+}
+
+func (s staticInstancer) Get(flux.InstanceID) (*instance.Instance, error) {
+	return s.inst, nil
+}
+
+type staticConfig struct {
+	config instance.Config
+}
+
+func (c staticConfig) Get() (instance.Config, error) {
+	return c.config, nil
+}
+
+func (c staticConfig) Update(instance.UpdateFunc) error {
+	return nil
+}
+
+func (c staticConfig) UpdateAt(int64, instance.UpdateFunc) error {
+	return nil
+}
+
+type nopHistogram struct{}
+
+func (h nopHistogram) With(...string) metrics.Histogram { return h }
+func (h nopHistogram) Observe(float64)                  {}
+
+type nopCounter struct{}
+
+func (c nopCounter) With(...string) metrics.Counter { return c }
+func (c nopCounter) Add(float64)                    {}
+
+type nopHistory struct{}
+
+func (nopHistory) LogEvent(string, string, string) error                           { return nil }
+func (nopHistory) AllEvents() ([]history.Event, error)                             { return nil, nil }
+func (nopHistory) EventsForService(string, string) ([]history.Event, error)        { return nil, nil }
+func (nopHistory) LogImageReleases([]flux.ImageRelease) error                      { return nil }
+func (nopHistory) ImagesAt(flux.ServiceID, time.Time) ([]flux.ImageRelease, error) { return nil, nil }
+func (nopHistory) Timeline(flux.TimelineQuery) ([]flux.ImageRelease, error)        { return nil, nil }
+
+type nopUpdater struct{}
+
+func (nopUpdater) UpdateJob(jobs.Job) error   { return nil }
+func (nopUpdater) Heartbeat(jobs.JobID) error { return nil }
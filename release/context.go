@@ -1,28 +1,73 @@
 package release
 
 import (
-	"os"
+	"context"
+	"fmt"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform/kubernetes"
 )
 
 type ReleaseContext struct {
 	Instance       *instance.Instance
 	WorkingDir     string
 	PodControllers map[flux.ServiceID][]byte
+	// Originals are the definitions of pod controllers as they were
+	// before being updated, so they can be restored.
+	Originals map[flux.ServiceID][]byte
+	// Updates are the image changes made to each service's
+	// definition.
+	Updates map[flux.ServiceID][]ContainerUpdate
+	// Pushed is set once changes have been pushed to the config repo,
+	// and Revision is that of the commit pushed.
+	Pushed   bool
+	Revision string
+	// Job is the job executing the release, and User who asked for
+	// it; these are recorded with the commit made. InstanceID is the
+	// instance released to.
+	Job        jobs.JobID
+	User       string
+	InstanceID flux.InstanceID
+	// BaseRevision is the revision cloned, on top of which changes
+	// are committed.
+	BaseRevision string
+	// Released is when the services were released to the platform.
+	Released time.Time
+	// DaemonVersion is the version the daemon reported before it was
+	// upgraded, if it's being upgraded.
+	DaemonVersion string
+
+	indexes *fileIndexes
+
+	mu sync.Mutex // guards the maps while actions run in parallel
+	// running counts the actions (and undos) still running, timed out
+	// or not, since they may still be using the working directory.
+	running sync.WaitGroup
 }
 
 func NewReleaseContext(inst *instance.Instance) *ReleaseContext {
 	return &ReleaseContext{
 		Instance:       inst,
 		PodControllers: map[flux.ServiceID][]byte{},
+		Originals:      map[flux.ServiceID][]byte{},
+		Updates:        map[flux.ServiceID][]ContainerUpdate{},
 	}
 }
 
-func (rc *ReleaseContext) CloneRepo() error {
-	path, err := rc.Instance.ConfigRepo().Clone(nil)
+// CloneRepo clones the config repo (or leases a clone) as the working
+// directory, abandoning it if the context given is done first.
+func (rc *ReleaseContext) CloneRepo(ctx context.Context) error {
+	path, err := rc.Instance.ConfigRepo().WithContext(ctx).Clone(nil)
 	if err != nil {
 		return err
 	}
@@ -30,16 +75,223 @@ func (rc *ReleaseContext) CloneRepo() error {
 	return nil
 }
 
-func (rc *ReleaseContext) CommitAndPush(msg string) (string, error) {
-	return rc.Instance.ConfigRepo().CommitAndPush(rc.WorkingDir, msg)
+func (rc *ReleaseContext) CommitAndPush(ctx context.Context, msg string) (string, error) {
+	return rc.Instance.ConfigRepo().WithContext(ctx).CommitAndPush(rc.WorkingDir, rc.BaseRevision, msg, rc.metadata())
+}
+
+// metadata gives what's recorded about the release with its commit:
+// the job, who asked for it, and the services and images updated.
+func (rc *ReleaseContext) metadata() []git.Trailer {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	res := []git.Trailer{{Key: "Flux-Job", Value: string(rc.Job)}}
+	if rc.User != "" {
+		res = append(res, git.Trailer{Key: "Flux-Requested-By", Value: rc.User})
+	}
+	var services []string
+	images := map[string]bool{}
+	for id, updates := range rc.Updates {
+		services = append(services, string(id))
+		for _, update := range updates {
+			images[update.Target.String()] = true
+		}
+	}
+	sort.Strings(services)
+	for _, s := range services {
+		res = append(res, git.Trailer{Key: "Flux-Service", Value: s})
+	}
+	var imageList []string
+	for image := range images {
+		imageList = append(imageList, image)
+	}
+	sort.Strings(imageList)
+	for _, image := range imageList {
+		res = append(res, git.Trailer{Key: "Flux-Image", Value: image})
+	}
+	return res
+}
+
+func (rc *ReleaseContext) RevertAndPush(ctx context.Context) error {
+	return rc.Instance.ConfigRepo().WithContext(ctx).RevertAndPush(rc.WorkingDir)
+}
+
+func (rc *ReleaseContext) SetPodController(service flux.ServiceID, def []byte) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.PodControllers[service] = def
+}
+
+func (rc *ReleaseContext) SetOriginal(service flux.ServiceID, def []byte) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.Originals[service] = def
+}
+
+func (rc *ReleaseContext) SetReleased(t time.Time) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.Released = t
+}
+
+func (rc *ReleaseContext) SetUpdates(service flux.ServiceID, updates []ContainerUpdate) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.Updates[service] = updates
+}
+
+func (rc *ReleaseContext) HeadRevision() (string, error) {
+	return rc.Instance.ConfigRepo().HeadRevision(rc.WorkingDir)
 }
 
-func (rc *ReleaseContext) RepoPath() string {
-	return filepath.Join(rc.WorkingDir, rc.Instance.ConfigRepo().Path)
+// RepoPath gives the directory within the clone of the config repo
+// which holds the resource definitions. If the configured path is (or
+// goes through) a symlink, it's resolved; it's an error for that to
+// lead outside the clone.
+func (rc *ReleaseContext) RepoPath() (string, error) {
+	return resolveWithin(rc.WorkingDir, rc.Instance.ConfigRepo().Path)
+}
+
+// ServicePath gives the directory in which to look for the definition
+// of the service given: the sub-path of RepoPath configured for it, if
+// there is one (e.g., in a monorepo), otherwise RepoPath itself.
+func (rc *ReleaseContext) ServicePath(service flux.ServiceID) (string, error) {
+	root, err := rc.RepoPath()
+	if err != nil {
+		return "", err
+	}
+	config, err := rc.Instance.GetConfig()
+	if err != nil {
+		return "", errors.Wrap(err, "getting instance config")
+	}
+	sub, err := config.Settings.Git.PathFor(service)
+	if err != nil || sub == "" {
+		return root, err
+	}
+	return resolveWithin(root, sub)
+}
+
+// FilesFor gives the resource definition files, under the path given,
+// for the service given. The files are indexed once per revision of
+// the config repo, and the index reused.
+func (rc *ReleaseContext) FilesFor(path string, service flux.ServiceID) ([]string, error) {
+	config, err := rc.Instance.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting instance config")
+	}
+	defaults, err := rc.NamespaceDefaults()
+	if err != nil {
+		return nil, err
+	}
+	limits, err := rc.ScanLimits()
+	if err != nil {
+		return nil, err
+	}
+	build := func() (kubernetes.FileIndex, error) {
+		return kubernetes.IndexFiles(path, defaults, limits)
+	}
+	var index kubernetes.FileIndex
+	if rc.BaseRevision == "" {
+		index, err = build()
+	} else {
+		index, err = rc.indexes.Get(rc.indexKey(path, config.Settings.Git), build)
+	}
+	if err != nil {
+		return nil, err
+	}
+	namespace, name := service.Components()
+	return index.FilesFor(path, namespace, name), nil
+}
+
+// indexKey gives the key under which the index of the files under the
+// path given is kept, for the revision cloned.
+func (rc *ReleaseContext) indexKey(path string, git flux.GitConfig) string {
+	dir := path
+	if root, err := filepath.EvalSymlinks(rc.WorkingDir); err == nil {
+		if rel, err := filepath.Rel(root, path); err == nil {
+			dir = rel
+		}
+	}
+	// Which services files define depends on the namespaces
+	// assumed, and which files are looked through, as well as
+	// the files.
+	return fmt.Sprintf("%s@%s:%s %v %v %d %d", rc.Instance.ConfigRepo().URL, rc.BaseRevision, dir, git.DefaultNamespaces, git.Ignore, git.MaxDepth, git.MaxFiles)
+}
+
+// NamespaceDefaults gives the namespace to assume for resources
+// defined without one in files under RepoPath, as configured.
+func (rc *ReleaseContext) NamespaceDefaults() (kubernetes.NamespaceDefaulter, error) {
+	config, err := rc.Instance.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting instance config")
+	}
+	root, err := rc.RepoPath()
+	if err != nil {
+		return nil, err
+	}
+	return func(file string) string {
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return ""
+		}
+		return config.Settings.Git.NamespaceFor(rel)
+	}, nil
+}
+
+// ScanLimits gives the limits, as configured, on which files under
+// RepoPath are looked through for resource definitions.
+func (rc *ReleaseContext) ScanLimits() (kubernetes.ScanLimits, error) {
+	config, err := rc.Instance.GetConfig()
+	if err != nil {
+		return kubernetes.ScanLimits{}, errors.Wrap(err, "getting instance config")
+	}
+	root, err := rc.RepoPath()
+	if err != nil {
+		return kubernetes.ScanLimits{}, err
+	}
+	return kubernetes.ScanLimits{
+		Base:     root,
+		Ignore:   config.Settings.Git.Ignore,
+		MaxDepth: config.Settings.Git.MaxDepth,
+		MaxFiles: config.Settings.Git.MaxFiles,
+	}, nil
+}
+
+// DecryptSOPS says whether files encrypted with SOPS should be
+// decrypted when read, and encrypted again when written.
+func (rc *ReleaseContext) DecryptSOPS() bool {
+	config, err := rc.Instance.GetConfig()
+	if err != nil {
+		return false
+	}
+	return config.Settings.Git.SOPS
+}
+
+// resolveWithin joins path to root and resolves any symlinks; it's an
+// error for that to lead outside root. If the path can't be resolved
+// (e.g., because it doesn't exist), it's returned as it is, for the
+// caller to report as not valid.
+func resolveWithin(root, path string) (string, error) {
+	joined := filepath.Join(root, path)
+	resolved, err := filepath.EvalSymlinks(joined)
+	if err != nil {
+		return joined, nil
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return joined, nil
+	}
+	if rel, err := filepath.Rel(realRoot, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("the config repo path %s leads outside the repo", path)
+	}
+	return resolved, nil
 }
 
+// Clean finishes with the working directory, once no action is using
+// it; it may go back in the config repo's pool, to be leased to
+// another release.
 func (rc *ReleaseContext) Clean() {
+	rc.running.Wait()
 	if rc.WorkingDir != "" {
-		os.RemoveAll(rc.WorkingDir)
+		rc.Instance.ConfigRepo().Clean(rc.WorkingDir)
 	}
 }
@@ -0,0 +1,81 @@
+package release
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+)
+
+// checkDefinitions looks in the config repo for the definition of each
+// service the plan will load or update, so that a plan which would
+// fail because a service is defined in more than one file fails when
+// it's made, rather than part-way through being executed.
+func (r *Releaser) checkDefinitions(inst *instance.Instance, actions []ReleaseAction) error {
+	var services []flux.ServiceID
+	for _, action := range actions {
+		if action.Name == ActionFindPodController || action.Name == ActionUpdatePodController {
+			services = append(services, action.Service)
+		}
+	}
+	if len(services) == 0 {
+		return nil
+	}
+
+	rc := NewReleaseContext(inst)
+	rc.indexes = r.indexes
+	defer rc.Clean()
+	if err := rc.CloneRepo(inst.Context()); err != nil {
+		return errors.Wrap(err, "cloning the config repo to check definitions")
+	}
+	if head, err := rc.HeadRevision(); err == nil {
+		rc.BaseRevision = head
+	}
+
+	ambiguous := map[flux.ServiceID][]string{}
+	for _, service := range services {
+		path, err := rc.ServicePath(service)
+		if err != nil {
+			return err
+		}
+		files, err := rc.FilesFor(path, service)
+		if err != nil {
+			return errors.Wrapf(err, "finding resource definition file for %s", service)
+		}
+		if len(files) > 1 {
+			ambiguous[service] = files
+		}
+	}
+	if len(ambiguous) > 0 {
+		return ambiguousDefinitionError(rc, ambiguous)
+	}
+	return nil
+}
+
+// ambiguousDefinitionError explains which services are defined in
+// more than one file, giving the files relative to the config repo,
+// and how to say which should be used.
+func ambiguousDefinitionError(rc *ReleaseContext, files map[flux.ServiceID][]string) error {
+	root := rc.WorkingDir
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		root = real
+	}
+	var ambiguous []string
+	for service, paths := range files {
+		var rel []string
+		for _, p := range paths {
+			if r, err := filepath.Rel(root, p); err == nil {
+				p = r
+			}
+			rel = append(rel, p)
+		}
+		ambiguous = append(ambiguous, fmt.Sprintf("%s (%s)", service, strings.Join(rel, ", ")))
+	}
+	sort.Strings(ambiguous)
+	return fmt.Errorf("multiple resource definition files found for %s; add an entry to servicePaths in the git config giving the file to use", strings.Join(ambiguous, "; "))
+}
@@ -0,0 +1,99 @@
+package release
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/platform/kubernetes"
+)
+
+// DesiredState reads the services defined in the instance's config
+// repo, as it is at the tip of the branch, along with their policies.
+// Files encrypted with SOPS are listed, but their containers only
+// given if the instance decrypts them.
+func DesiredState(instID flux.InstanceID, inst *instance.Instance) (flux.DesiredState, error) {
+	config, err := inst.GetConfig()
+	if err != nil {
+		return flux.DesiredState{}, errors.Wrap(err, "getting instance config")
+	}
+
+	rc := NewReleaseContext(inst)
+	if err := rc.CloneRepo(inst.Context()); err != nil {
+		return flux.DesiredState{}, errors.Wrap(err, "cloning config repo")
+	}
+	defer rc.Clean()
+	root, err := rc.RepoPath()
+	if err != nil {
+		return flux.DesiredState{}, err
+	}
+	defaults, err := rc.NamespaceDefaults()
+	if err != nil {
+		return flux.DesiredState{}, err
+	}
+	limits, err := rc.ScanLimits()
+	if err != nil {
+		return flux.DesiredState{}, err
+	}
+	index, err := kubernetes.IndexFiles(root, defaults, limits)
+	if err != nil {
+		return flux.DesiredState{}, errors.Wrap(err, "indexing config repo")
+	}
+	revision, err := rc.HeadRevision()
+	if err != nil {
+		return flux.DesiredState{}, errors.Wrap(err, "getting config repo revision")
+	}
+
+	repo := inst.ConfigRepo()
+	state := flux.DesiredState{
+		Instance: instID,
+		Repo:     repo.URL,
+		Branch:   repo.Branch,
+		Path:     repo.Path,
+		Revision: revision,
+		Services: []flux.DesiredService{},
+	}
+	for id, files := range index {
+		sort.Strings(files)
+		conf := config.Services[flux.ServiceID(id)]
+		service := flux.DesiredService{
+			ID:              flux.ServiceID(id),
+			Files:           files,
+			Automated:       conf.Automated,
+			Locked:          conf.Locked,
+			TagFilter:       conf.TagFilter,
+			MinImageAge:     conf.MinImageAge,
+			NewerOnly:       conf.NewerOnly,
+			RestartEvery:    conf.RestartEvery,
+			ReleaseInterval: conf.ReleaseInterval,
+		}
+		for _, file := range files {
+			def, _, err := kubernetes.ReadDefinition(filepath.Join(root, file), rc.DecryptSOPS())
+			if errors.Cause(err) == kubernetes.ErrEncrypted {
+				continue
+			}
+			if err != nil {
+				return flux.DesiredState{}, errors.Wrapf(err, "reading %s", file)
+			}
+			containers, err := kubernetes.ContainersFor(def)
+			if err != nil {
+				return flux.DesiredState{}, errors.Wrapf(err, "parsing %s", file)
+			}
+			for _, c := range containers {
+				service.Containers = append(service.Containers, flux.DesiredContainer{Name: c.Name, Image: c.Image})
+			}
+		}
+		state.Services = append(state.Services, service)
+	}
+	sort.Sort(desiredByService(state.Services))
+	return state, nil
+}
+
+type desiredByService []flux.DesiredService
+
+func (s desiredByService) Len() int           { return len(s) }
+func (s desiredByService) Less(i, j int) bool { return s[i].ID < s[j].ID }
+func (s desiredByService) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
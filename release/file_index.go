@@ -0,0 +1,59 @@
+package release
+
+import (
+	"sync"
+
+	"github.com/weaveworks/flux/platform/kubernetes"
+)
+
+// maxFileIndexes is how many indexes of definition files are kept;
+// enough for the revisions being released at any one time.
+const maxFileIndexes = 64
+
+// fileIndexes keeps the indexes of resource definition files made for
+// each revision of a config repo, so that the files are looked through
+// once per revision, rather than once for each service released. The
+// oldest indexes are dropped when there are more than maxFileIndexes.
+type fileIndexes struct {
+	mu      sync.Mutex
+	indexes map[string]kubernetes.FileIndex
+	order   []string
+}
+
+func newFileIndexes() *fileIndexes {
+	return &fileIndexes{
+		indexes: map[string]kubernetes.FileIndex{},
+	}
+}
+
+// Get returns the index stored under the key given, or makes it with
+// the func given and stores it. Indexes aren't made while holding the
+// lock, so two releases may both make the same index; either will do.
+func (f *fileIndexes) Get(key string, build func() (kubernetes.FileIndex, error)) (kubernetes.FileIndex, error) {
+	if f == nil {
+		return build()
+	}
+	f.mu.Lock()
+	index, ok := f.indexes[key]
+	f.mu.Unlock()
+	if ok {
+		return index, nil
+	}
+
+	index, err := build()
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.indexes[key]; !ok {
+		f.order = append(f.order, key)
+	}
+	f.indexes[key] = index
+	for len(f.order) > maxFileIndexes {
+		delete(f.indexes, f.order[0])
+		f.order = f.order[1:]
+	}
+	return index, nil
+}
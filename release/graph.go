@@ -0,0 +1,99 @@
+package release
+
+import (
+	"github.com/weaveworks/flux"
+)
+
+// Release actions form a graph: each action depends on those which
+// must be done before it. Most actions depend on everything before
+// them, but loading or updating the definitions of services in
+// different files (or migrating the images in different files) can be
+// done in any order, or at the same time. Commit and push, and
+// everything else, remain synchronisation points.
+//
+// Which files define a service is only known once the config repo has
+// been cloned, so the actions to do next are worked out as the release
+// goes along, rather than all at once.
+
+// maxParallelActions limits how many actions are run at once.
+const maxParallelActions = 8
+
+// filesFunc gives the files an action reads or writes, or an error if
+// they can't be told.
+type filesFunc func(ReleaseAction) ([]string, error)
+
+// independent says whether an action can be done at the same time as
+// (an earlier) other. Actions on services are independent only if
+// they touch different files, since a file may define more than one
+// service; if the files can't be told, they're assumed not to be.
+func independent(action, other ReleaseAction, files filesFunc) bool {
+	perService := func(a ReleaseAction) bool {
+		return a.Name == ActionFindPodController || a.Name == ActionUpdatePodController || a.Name == ActionRestartService
+	}
+	if action.Name == ActionMigrateImages && other.Name == ActionMigrateImages {
+		return action.File != other.File
+	}
+	if !perService(action) || !perService(other) || action.Service == other.Service {
+		return false
+	}
+	actionFiles, err := files(action)
+	if err != nil {
+		return false
+	}
+	otherFiles, err := files(other)
+	if err != nil {
+		return false
+	}
+	for _, f := range actionFiles {
+		for _, g := range otherFiles {
+			if f == g {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// nextLayer gives the indices of the actions not yet done which depend
+// on none of the others not yet done, in ascending order. These can be
+// run in parallel.
+func nextLayer(actions []ReleaseAction, done []bool, files filesFunc) []int {
+	var res []int
+	for i, action := range actions {
+		if done[i] {
+			continue
+		}
+		ready := true
+		// Earlier actions are looked at first, so that (e.g.)
+		// files aren't looked for before the clone they're in.
+		for j := 0; j < i && ready; j++ {
+			ready = done[j] || independent(action, actions[j], files)
+		}
+		if ready {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// definitionFiles gives the files defining the service each action is
+// for, as found in the release context's clone. They're remembered,
+// since releasing doesn't change which files define which services.
+func definitionFiles(rc *ReleaseContext) filesFunc {
+	found := map[flux.ServiceID][]string{}
+	return func(action ReleaseAction) ([]string, error) {
+		if files, ok := found[action.Service]; ok {
+			return files, nil
+		}
+		path, err := rc.ServicePath(action.Service)
+		if err != nil {
+			return nil, err
+		}
+		files, err := rc.FilesFor(path, action.Service)
+		if err != nil {
+			return nil, err
+		}
+		found[action.Service] = files
+		return files, nil
+	}
+}
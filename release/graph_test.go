@@ -0,0 +1,37 @@
+package release
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/platform"
+)
+
+func TestNextLayerSharedFile(t *testing.T) {
+	front := flux.MakeServiceID("default", "front")
+	back := flux.MakeServiceID("default", "back")
+	other := flux.MakeServiceID("default", "other")
+	rc, cleanup := testContext(t, platform.NewFake(),
+		map[string][]flux.ServiceID{"app.yaml": {front, back}, "other.yaml": {other}},
+		map[string]string{})
+	defer cleanup()
+
+	actions := []ReleaseAction{
+		{Name: ActionUpdatePodController, Service: front},
+		{Name: ActionUpdatePodController, Service: back},
+		{Name: ActionUpdatePodController, Service: other},
+		{Name: ActionCommitAndPush, Message: "Release"},
+	}
+	done := make([]bool, len(actions))
+	files := definitionFiles(rc)
+	for _, expected := range [][]int{{0, 2}, {1}, {3}, nil} {
+		layer := nextLayer(actions, done, files)
+		if !reflect.DeepEqual(layer, expected) {
+			t.Fatalf("expected layer %v, got %v", expected, layer)
+		}
+		for _, i := range layer {
+			done[i] = true
+		}
+	}
+}
@@ -17,13 +17,26 @@ func ImageSelectorForSpec(spec flux.ImageSpec) ImageSelector {
 	switch spec {
 	case flux.ImageSpecLatest:
 		return AllLatestImages
+	case flux.ImageSpecLatestAllowed:
+		return AllLatestAllowedImages
 	case flux.ImageSpecNone:
 		return LatestConfig
-	default:
-		return ExactlyTheseImages([]flux.ImageID{
-			flux.ParseImageID(string(spec)),
-		})
 	}
+	if repo, ok := spec.LatestOfRepository(); ok {
+		return LatestOfRepository(repo)
+	}
+	id, err := flux.ParseImageID(string(spec))
+	if err != nil {
+		// The error is left until images are selected, since the
+		// spec isn't always used.
+		return funcImageSelector{
+			text: string(spec),
+			f: func(*instance.Instance, []platform.Service) (instance.ImageMap, error) {
+				return nil, err
+			},
+		}
+	}
+	return ExactlyTheseImages([]flux.ImageID{id})
 }
 
 type funcImageSelector struct {
@@ -55,10 +68,50 @@ var (
 	}
 )
 
+// latestAllowedImages selects the images of all repositories used by
+// the services, like AllLatestImages; but the releaser takes the
+// latest allowed for each service.
+type latestAllowedImages struct{}
+
+// AllLatestAllowedImages selects the latest images each service is
+// allowed by its tag filter, if it has one.
+var AllLatestAllowedImages ImageSelector = latestAllowedImages{}
+
+func (latestAllowedImages) String() string {
+	return "latest allowed images"
+}
+
+func (latestAllowedImages) SelectImages(h *instance.Instance, services []platform.Service) (instance.ImageMap, error) {
+	return h.CollectAvailableImages(services)
+}
+
+// latestOfRepository selects the images of just the one repository;
+// the releaser takes the latest allowed for each service.
+type latestOfRepository string
+
+// LatestOfRepository selects the latest images of the repository
+// given. Each service gets the latest allowed by its tag filter, if
+// it has one.
+func LatestOfRepository(repo string) ImageSelector {
+	return latestOfRepository(repo)
+}
+
+func (repo latestOfRepository) String() string {
+	return "latest of " + string(repo)
+}
+
+func (repo latestOfRepository) SelectImages(h *instance.Instance, _ []platform.Service) (instance.ImageMap, error) {
+	images, err := h.GetRepository(string(repo))
+	if err != nil {
+		return nil, err
+	}
+	return instance.ImageMap{string(repo): images}, nil
+}
+
 func ExactlyTheseImages(images []flux.ImageID) ImageSelector {
 	var imageText []string
 	for _, image := range images {
-		imageText = append(imageText, string(image))
+		imageText = append(imageText, image.String())
 	}
 	return funcImageSelector{
 		text: strings.Join(imageText, ", "),
@@ -0,0 +1,85 @@
+package release
+
+import (
+	"sync"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+)
+
+// LatestImages resolves the latest image of each repository (for
+// each tag filter) once, however many containers it's asked about
+// for. It's safe to use concurrently.
+type LatestImages struct {
+	images instance.ImageMap
+
+	mu       sync.Mutex
+	resolved map[latestKey]*flux.ImageDescription
+}
+
+type latestKey struct {
+	repo, filter string
+}
+
+func NewLatestImages(images instance.ImageMap) *LatestImages {
+	return &LatestImages{
+		images:   images,
+		resolved: map[latestKey]*flux.ImageDescription{},
+	}
+}
+
+// Latest gives the latest image in the repository with a tag matching
+// the filter (which may be empty, to match any tag), or nil if there
+// isn't one.
+func (l *LatestImages) Latest(repo, filter string) *flux.ImageDescription {
+	key := latestKey{repo, filter}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if latest, ok := l.resolved[key]; ok {
+		return latest
+	}
+	images := instance.ImageMap{repo: l.images[repo]}
+	latest := images.FilterTags(filter).LatestImage(repo)
+	l.resolved[key] = latest
+	return latest
+}
+
+// Describe gives the image with the ID given, or nil if it's not
+// among the images.
+func (l *LatestImages) Describe(id flux.ImageID) *flux.ImageDescription {
+	images := l.images[id.Repository()]
+	for i := range images {
+		if images[i].ID == id {
+			return &images[i]
+		}
+	}
+	return nil
+}
+
+// Reuse takes what was resolved by an earlier LatestImages, for each
+// repository with exactly the same images; e.g., because they came
+// from the registry cache both times.
+func (l *LatestImages) Reuse(earlier *LatestImages) {
+	if earlier == nil {
+		return
+	}
+	earlier.mu.Lock()
+	defer earlier.mu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, latest := range earlier.resolved {
+		if sameImages(l.images[key.repo], earlier.images[key.repo]) {
+			l.resolved[key] = latest
+		}
+	}
+}
+
+// sameImages says whether the two slices are the same slice, rather
+// than whether they have the same contents, which is all that's needed
+// to spot images coming from the same place, and is cheaper.
+func sameImages(a, b []flux.ImageDescription) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	return len(a) == 0 || &a[0] == &b[0]
+}
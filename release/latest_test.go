@@ -0,0 +1,127 @@
+package release
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform"
+)
+
+func TestLatestImagesReuse(t *testing.T) {
+	mustParse := func(s string) flux.ImageID {
+		id, err := flux.ParseImageID(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	cached := []flux.ImageDescription{
+		{ID: mustParse("quay.io/weaveworks/helloworld:master-2")},
+		{ID: mustParse("quay.io/weaveworks/helloworld:v1")},
+	}
+	earlier := NewLatestImages(instance.ImageMap{"quay.io/weaveworks/helloworld": cached})
+	if latest := earlier.Latest("quay.io/weaveworks/helloworld", "v*"); latest == nil || latest.ID.Tag != "v1" {
+		t.Fatalf("expected v1, got %+v", latest)
+	}
+
+	// The same images, e.g., from the cache, reuse what was resolved
+	same := NewLatestImages(instance.ImageMap{"quay.io/weaveworks/helloworld": cached})
+	same.Reuse(earlier)
+	if len(same.resolved) != 1 {
+		t.Errorf("expected the resolved image to be reused, got %+v", same.resolved)
+	}
+
+	// Images fetched again don't
+	fetched := append([]flux.ImageDescription{}, cached...)
+	fresh := NewLatestImages(instance.ImageMap{"quay.io/weaveworks/helloworld": fetched})
+	fresh.Reuse(earlier)
+	if len(fresh.resolved) != 0 {
+		t.Errorf("expected nothing reused, got %+v", fresh.resolved)
+	}
+}
+
+func TestCalculateUpdatesSkips(t *testing.T) {
+	latest, err := flux.ParseImageID("quay.io/weaveworks/helloworld:v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := instance.ImageMap{"quay.io/weaveworks/helloworld": {{ID: latest}}}
+	current := flux.MakeServiceID("default", "current")
+	bad := flux.MakeServiceID("default", "bad")
+	services := []platform.Service{
+		{ID: current, Containers: platform.ContainersOrExcuse{Containers: []platform.Container{{Name: "main", Image: latest.String()}}}},
+		{ID: bad, Containers: platform.ContainersOrExcuse{Excuse: "no pods"}},
+	}
+	var skips []jobs.Skip
+	updates := CalculateUpdates(services, images, func(s jobs.Skip, _ string, _ ...interface{}) {
+		skips = append(skips, s)
+	})
+	if len(updates) != 0 {
+		t.Errorf("expected no updates, got %+v", updates)
+	}
+	expected := []jobs.Skip{
+		{Service: current, Container: "main", Reason: jobs.SkipAlreadyLatest},
+		{Service: bad, Reason: jobs.SkipNoImages},
+	}
+	if len(skips) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, skips)
+	}
+	for i := range expected {
+		if skips[i] != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], skips[i])
+		}
+	}
+}
+
+func TestCalculateUpdatesImageAge(t *testing.T) {
+	now := time.Now()
+	at := func(ago time.Duration) *time.Time {
+		t := now.Add(-ago)
+		return &t
+	}
+	mustParse := func(s string) flux.ImageID {
+		id, err := flux.ParseImageID(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	running := mustParse("quay.io/weaveworks/helloworld:v1")
+	newest := mustParse("quay.io/weaveworks/helloworld:v2")
+	images := instance.ImageMap{"quay.io/weaveworks/helloworld": {
+		{ID: newest, CreatedAt: at(10 * time.Minute)},
+		{ID: running, CreatedAt: at(5 * time.Minute)}, // rebuilt since
+	}}
+	service := flux.MakeServiceID("default", "helloworld")
+	services := []platform.Service{
+		{ID: service, Containers: platform.ContainersOrExcuse{Containers: []platform.Container{{Name: "main", Image: running.String()}}}},
+	}
+
+	for i, c := range []struct {
+		conf   instance.ServiceConfig
+		reason string
+	}{
+		{instance.ServiceConfig{}, ""},
+		{instance.ServiceConfig{MinImageAge: 5}, ""},
+		{instance.ServiceConfig{MinImageAge: 30}, jobs.SkipImageTooNew},
+		{instance.ServiceConfig{NewerOnly: true}, jobs.SkipImageNotNewer},
+	} {
+		config := instance.Config{Services: map[flux.ServiceID]instance.ServiceConfig{service: c.conf}}
+		var skips []jobs.Skip
+		updates := CalculateFilteredUpdates(services, images, config, func(s jobs.Skip, _ string, _ ...interface{}) {
+			skips = append(skips, s)
+		})
+		if c.reason == "" {
+			if len(updates[service]) != 1 || len(skips) != 0 {
+				t.Errorf("%d: expected an update, got %+v and skips %+v", i, updates, skips)
+			}
+			continue
+		}
+		if len(updates) != 0 || len(skips) != 1 || skips[0].Reason != c.reason {
+			t.Errorf("%d: expected a skip for %s, got %+v and skips %+v", i, c.reason, updates, skips)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package release
+
+import (
+	"sort"
+	"sync"
+)
+
+// keyedLocks hands out a mutex per key, so that work on different
+// keys can go ahead concurrently while work on the same key is
+// serialised. Mutexes are removed once nobody holds or waits for
+// them.
+type keyedLocks struct {
+	mu    sync.Mutex
+	locks map[string]*refLock
+}
+
+type refLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newKeyedLocks() *keyedLocks {
+	return &keyedLocks{
+		locks: map[string]*refLock{},
+	}
+}
+
+// Lock acquires the locks for all the keys given, and returns a func
+// to release them. Keys are always acquired in the same order, so
+// callers with overlapping sets of keys will not deadlock.
+func (k *keyedLocks) Lock(keys ...string) (unlock func()) {
+	keys = uniqueSorted(keys)
+	held := make([]*refLock, 0, len(keys))
+	for _, key := range keys {
+		k.mu.Lock()
+		l, ok := k.locks[key]
+		if !ok {
+			l = &refLock{}
+			k.locks[key] = l
+		}
+		l.refs++
+		k.mu.Unlock()
+
+		l.Lock()
+		held = append(held, l)
+	}
+
+	return func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].Unlock()
+			k.mu.Lock()
+			held[i].refs--
+			if held[i].refs == 0 {
+				delete(k.locks, keys[i])
+			}
+			k.mu.Unlock()
+		}
+	}
+}
+
+func uniqueSorted(keys []string) []string {
+	set := map[string]struct{}{}
+	var res []string
+	for _, key := range keys {
+		if _, ok := set[key]; ok {
+			continue
+		}
+		set[key] = struct{}{}
+		res = append(res, key)
+	}
+	sort.Strings(res)
+	return res
+}
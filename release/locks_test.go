@@ -0,0 +1,222 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/registry"
+)
+
+func TestKeyedLocksSameKey(t *testing.T) {
+	locks := newKeyedLocks()
+	var (
+		mu       sync.Mutex
+		running  int
+		overlaps int
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := locks.Lock("a", "b")
+			defer unlock()
+			mu.Lock()
+			running++
+			if running > 1 {
+				overlaps++
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if overlaps > 0 {
+		t.Errorf("expected holders of the same key never to overlap, got %d overlaps", overlaps)
+	}
+	if len(locks.locks) != 0 {
+		t.Errorf("expected no locks to be kept once released, got %d", len(locks.locks))
+	}
+}
+
+func TestKeyedLocksDifferentKeys(t *testing.T) {
+	locks := newKeyedLocks()
+	unlock := locks.Lock("a")
+	defer unlock()
+	acquired := make(chan struct{})
+	go func() {
+		locks.Lock("b")()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("expected a different key to be locked while the first is held")
+	}
+}
+
+func TestKeyedLocksOverlappingKeys(t *testing.T) {
+	locks := newKeyedLocks()
+	// Given in different orders, and with duplicates, which would
+	// deadlock if they were taken in the order given.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		keys := []string{"a", "b", "c", "a"}
+		if i%2 == 0 {
+			keys = []string{"c", "b", "a"}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			locks.Lock(keys...)()
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected locking overlapping sets of keys not to deadlock")
+	}
+}
+
+type instancesByID map[flux.InstanceID]*instance.Instance
+
+func (m instancesByID) Get(id flux.InstanceID) (*instance.Instance, error) {
+	return m[id], nil
+}
+
+// TestHandleSerialisesReleases runs releases as the worker pool
+// would: releases to the same instance, or to instances sharing a
+// config repo, must never run at once; releases to other instances
+// must be able to.
+func TestHandleSerialisesReleases(t *testing.T) {
+	newInstance := func(repoURL string) *instance.Instance {
+		return instance.New(platform.NewFake(), registry.NewFake(), staticConfig{instance.MakeConfig()}, git.Repo{URL: repoURL, Branch: "master"}, log.NewNopLogger(), nopHistogram{}, nopHistory{}, nopHistory{}, nopHistory{}, history.NopAnnotator{})
+	}
+	// a and b push to the same config repo; c to its own.
+	instances := instancesByID{
+		"a": newInstance("git@example.com:shared"),
+		"b": newInstance("git@example.com:shared"),
+		"c": newInstance("git@example.com:own"),
+	}
+	group := map[string]string{"a": "shared", "b": "shared", "c": "own"}
+
+	r := NewReleaser(instances, Metrics{ReleaseDuration: nopHistogram{}, ActionDuration: nopHistogram{}, StageDuration: nopHistogram{}, NothingToDo: nopCounter{}}, FailureNone, DefaultTimeouts, flux.DefaultFeatures)
+
+	var (
+		mu            sync.Mutex
+		running       = map[string]int{}
+		overlaps      int
+		sharedStarted = make(chan struct{})
+		ownRunning    = make(chan struct{})
+		startShared   sync.Once
+		concurrent    = true
+	)
+	r.UseActionMiddleware(func(next ActionRunner) ActionRunner {
+		return func(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+			g := group[action.Message]
+			mu.Lock()
+			running[g]++
+			if running[g] > 1 {
+				overlaps++
+			}
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				running[g]--
+				mu.Unlock()
+			}()
+
+			// The first release to the shared repo and the release to
+			// c each wait for the other to be running, so they only
+			// both finish if they run at once.
+			wait := func(ch chan struct{}) {
+				select {
+				case <-ch:
+				case <-time.After(time.Second):
+					mu.Lock()
+					concurrent = false
+					mu.Unlock()
+				}
+			}
+			if g == "own" {
+				wait(sharedStarted)
+				close(ownRunning)
+			} else {
+				first := false
+				startShared.Do(func() { first = true })
+				if first {
+					close(sharedStarted)
+					wait(ownRunning)
+				} else {
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+			return next(ctx, rc, action)
+		}
+	})
+
+	var wg sync.WaitGroup
+	for _, inst := range []flux.InstanceID{"a", "a", "b", "b", "c"} {
+		plan, err := json.Marshal([]ReleaseAction{{Name: ActionPrintf, Description: "Release.", Message: string(inst)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		job := &jobs.Job{
+			ID:       jobs.NewJobID(),
+			Instance: inst,
+			Params:   jobs.ReleaseJobParams{Plan: plan, Kind: flux.ReleaseKindExecute, User: "test"},
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.Handle(job, nopUpdater{}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if overlaps > 0 {
+		t.Errorf("expected releases to the same instance or config repo never to run at once, got %d overlaps", overlaps)
+	}
+	if !concurrent {
+		t.Error("expected releases to instances with different config repos to run at once")
+	}
+}
+
+func TestLockKeys(t *testing.T) {
+	shared := git.Repo{URL: "git@example.com:shared", Branch: "master"}
+	a, b := lockKeys("a", shared), lockKeys("b", shared)
+	if a[0] == b[0] {
+		t.Errorf("expected instances to have their own keys, got %v and %v", a, b)
+	}
+	if len(a) != 2 || len(b) != 2 || a[1] != b[1] {
+		t.Errorf("expected instances pushing to the same repo and branch to share a key, got %v and %v", a, b)
+	}
+	other := lockKeys("a", git.Repo{URL: shared.URL, Branch: "other"})
+	if other[1] == a[1] {
+		t.Errorf("expected other branches of the repo to have their own key, got %v", other)
+	}
+	if keys := lockKeys("a", git.Repo{}); len(keys) != 1 {
+		t.Errorf("expected only the instance's key without a config repo, got %v", keys)
+	}
+}
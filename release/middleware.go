@@ -0,0 +1,70 @@
+package release
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// ActionRunner does a release action, giving a result to report, if
+// there is one.
+type ActionRunner func(context.Context, *ReleaseContext, ReleaseAction) (string, error)
+
+// ActionMiddleware wraps the doing of release actions, for things
+// which apply to every action (e.g., logging, or checking each action
+// against a policy), rather than to one kind. It may do something
+// before or after the action, or refuse it by returning an error
+// without calling next.
+type ActionMiddleware func(next ActionRunner) ActionRunner
+
+// UseActionMiddleware has each action done through the middleware
+// given, in addition to any given before; the first given is
+// outermost. It's for setting up the releaser, before it handles any
+// jobs. Undoing actions, when rolling back, isn't wrapped.
+func (r *Releaser) UseActionMiddleware(mw ...ActionMiddleware) {
+	r.middleware = append(r.middleware, mw...)
+}
+
+// runner gives the implementation of an action wrapped in the
+// middleware.
+func (r *Releaser) runner(do actionFunc) ActionRunner {
+	run := ActionRunner(do)
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		run = r.middleware[i](run)
+	}
+	return run
+}
+
+// LoggingActions logs each action done, with how long it took and
+// whether it succeeded.
+func LoggingActions(logger log.Logger) ActionMiddleware {
+	return func(next ActionRunner) ActionRunner {
+		return func(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (result string, err error) {
+			defer func(begin time.Time) {
+				logger.Log(
+					"instance", rc.InstanceID,
+					"job", rc.Job,
+					"action", action.Name,
+					"service", action.Service,
+					"took", time.Since(begin).String(),
+					"err", err,
+				)
+			}(time.Now())
+			return next(ctx, rc, action)
+		}
+	}
+}
+
+// CheckingActions refuses, with the error check gives, any action
+// check doesn't allow.
+func CheckingActions(check func(*ReleaseContext, ReleaseAction) error) ActionMiddleware {
+	return func(next ActionRunner) ActionRunner {
+		return func(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+			if err := check(rc, action); err != nil {
+				return "", err
+			}
+			return next(ctx, rc, action)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/weaveworks/flux"
+)
+
+func TestActionMiddleware(t *testing.T) {
+	r := NewReleaser(nil, Metrics{ActionDuration: nopHistogram{}}, FailureRollback, DefaultTimeouts, flux.DefaultFeatures)
+
+	var order []string
+	record := func(name string) ActionMiddleware {
+		return func(next ActionRunner) ActionRunner {
+			return func(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+				order = append(order, name)
+				return next(ctx, rc, action)
+			}
+		}
+	}
+	refused := errors.New("refused")
+	r.UseActionMiddleware(record("outer"), record("inner"))
+	r.UseActionMiddleware(CheckingActions(func(_ *ReleaseContext, action ReleaseAction) error {
+		if action.Name == ActionSkip {
+			return refused
+		}
+		return nil
+	}))
+
+	rc := NewReleaseContext(nil)
+	if _, err := r.do(rc, ReleaseAction{Name: ActionPrintf}); err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 2 || order[0] != "outer" || order[1] != "inner" {
+		t.Errorf("expected middleware to run outer then inner, got %v", order)
+	}
+	if _, err := r.do(rc, ReleaseAction{Name: ActionSkip, Service: "default/helloworld"}); err != refused {
+		t.Errorf("expected action to be refused, got %v", err)
+	}
+}
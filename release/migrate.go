@@ -0,0 +1,194 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/platform/kubernetes"
+)
+
+// ActionMigrateImages moves the images in a definition file from one
+// registry or repository to another.
+const ActionMigrateImages = "migrate_images"
+
+// releaseMigration plans moving the images throughout the config repo
+// from one registry or repository to another. There's an action for
+// each file to be changed, described with the lines it will change, so
+// the plan can be reviewed before it's executed. The services running
+// which are defined in the files changed are released; files defining
+// locked services are left alone.
+func (r *Releaser) releaseMigration(instID flux.InstanceID, method string, inst *instance.Instance, m flux.ImageMigration) (res []ReleaseAction, err error) {
+	stages := r.newStageTimer(instID, method)
+	defer func() { stages.done(err) }()
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	msg := migrationMessage(m)
+	res = append(res, r.releaseActionPrintf(msg))
+
+	stages.next("find_images")
+
+	rc := NewReleaseContext(inst)
+	defer rc.Clean()
+	if err := rc.CloneRepo(inst.Context()); err != nil {
+		return nil, errors.Wrap(err, "cloning the config repo to find images")
+	}
+	root, err := rc.RepoPath()
+	if err != nil {
+		return nil, err
+	}
+	limits, err := rc.ScanLimits()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := kubernetes.FindImageMigrations(root, m, rc.DecryptSOPS(), limits)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding images to migrate")
+	}
+	if len(changes) == 0 {
+		res = append(res, r.releaseActionPrintf("No images from %s found in the config repo. Nothing to do.", m.From))
+		return res, nil
+	}
+
+	defaults, err := rc.NamespaceDefaults()
+	if err != nil {
+		return nil, err
+	}
+	index, err := kubernetes.IndexFiles(root, defaults, limits)
+	if err != nil {
+		return nil, errors.Wrap(err, "indexing config repo")
+	}
+	defined := map[string][]flux.ServiceID{}
+	for id, files := range index {
+		for _, file := range files {
+			defined[file] = append(defined[file], flux.ServiceID(id))
+		}
+	}
+
+	locked, err := lockedServices(inst)
+	if err != nil {
+		return nil, err
+	}
+	lockedSet := flux.ServiceIDSet{}
+	lockedSet.Add(locked)
+	services, err := inst.GetAllServices("")
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching platform services")
+	}
+	running := flux.ServiceIDSet{}
+	for _, service := range services {
+		running.Add([]flux.ServiceID{service.ID})
+	}
+
+	var files []string
+	for file := range changes {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var migrations []ReleaseAction
+	var release []flux.ServiceID
+	for _, file := range files {
+		ids := defined[file]
+		sort.Sort(serviceIDs(ids))
+		var lockedIn []string
+		for _, id := range ids {
+			if lockedSet.Contains(id) {
+				lockedIn = append(lockedIn, string(id))
+			}
+		}
+		if len(lockedIn) > 0 {
+			res = append(res, r.releaseActionPrintf("%s defines locked service(s) %s; skipping.", file, strings.Join(lockedIn, ", ")))
+			continue
+		}
+		migrations = append(migrations, ReleaseAction{
+			Name:        ActionMigrateImages,
+			Description: fmt.Sprintf("Move images from %s to %s in %s:\n%s", m.From, m.To, file, migrationDiff(file, changes[file])),
+			File:        file,
+			Services:    ids,
+			Migration:   &m,
+		})
+		for _, id := range ids {
+			if running.Contains(id) {
+				release = append(release, id)
+			}
+		}
+	}
+	if len(migrations) == 0 {
+		res = append(res, r.releaseActionPrintf("All the files with images to move define locked services. Nothing to do."))
+		return res, nil
+	}
+
+	stages.next("finalize")
+
+	res = append(res, r.releaseActionClone())
+	res = append(res, migrations...)
+	res = append(res, r.releaseActionCommitAndPush(msg))
+	if len(release) > 0 {
+		res = append(res, r.releaseActionReleaseServices(release, msg))
+	}
+	return res, nil
+}
+
+func migrationMessage(m flux.ImageMigration) string {
+	return fmt.Sprintf("Move images from %s to %s", m.From, m.To)
+}
+
+// migrationDiff shows the lines of a file to be changed, in the manner
+// of a unified diff (without context).
+func migrationDiff(file string, changes []kubernetes.LineChange) string {
+	file = filepath.ToSlash(file)
+	lines := []string{"--- a/" + file, "+++ b/" + file}
+	for _, c := range changes {
+		lines = append(lines, fmt.Sprintf("@@ -%d +%d @@", c.Line, c.Line), "-"+c.Old, "+"+c.New)
+	}
+	return strings.Join(lines, "\n")
+}
+
+type serviceIDs []flux.ServiceID
+
+func (ids serviceIDs) Len() int           { return len(ids) }
+func (ids serviceIDs) Less(i, j int) bool { return ids[i] < ids[j] }
+func (ids serviceIDs) Swap(i, j int)      { ids[i], ids[j] = ids[j], ids[i] }
+
+func doMigrateImages(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	root, err := rc.RepoPath()
+	if err != nil {
+		return "", err
+	}
+	path, err := resolveWithin(root, action.File)
+	if err != nil {
+		return "", err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("the definition file (%s) is not valid", action.File)
+	}
+	original, encrypted, err := kubernetes.ReadDefinition(path, rc.DecryptSOPS())
+	if err != nil {
+		return "", err
+	}
+	def, changes := kubernetes.MigrateImages(original, *action.Migration)
+	if len(changes) == 0 {
+		return fmt.Sprintf("No images to move in %s; skipping.", action.File), nil
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := kubernetes.WriteDefinition(path, def, encrypted, fi.Mode()); err != nil {
+		return "", err
+	}
+	for _, service := range action.Services {
+		rc.SetOriginal(service, original)
+		rc.SetPodController(service, def)
+	}
+	return fmt.Sprintf("Moved %d image(s) in %s.", len(changes), action.File), nil
+}
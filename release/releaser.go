@@ -1,11 +1,12 @@
 package release
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"strconv"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -13,42 +14,152 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/changes"
+	"github.com/weaveworks/flux/commitstatus"
+	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/instance"
 	"github.com/weaveworks/flux/jobs"
 	fluxmetrics "github.com/weaveworks/flux/metrics"
 	"github.com/weaveworks/flux/platform"
-	"github.com/weaveworks/flux/platform/kubernetes"
+	"github.com/weaveworks/flux/usage"
 )
 
 const FluxServiceName = "fluxsvc"
 const FluxDaemonName = "fluxd"
 
+// Releaser handles release jobs. It's safe to share a Releaser among
+// several workers: releases for different instances can go ahead
+// concurrently, but those for the same instance, or which would push
+// to the same config repo, are executed one at a time.
 type Releaser struct {
 	instancer instance.Instancer
 	metrics   Metrics
+	policy    FailurePolicy
+	timeouts  Timeouts
+	features  flux.Features
+	locks     *keyedLocks
+	indexes   *fileIndexes
+	plans     PlanStore
+	tickets   func(flux.ChangeTicketConfig) (changes.System, error)
+	statuses  func(flux.CommitStatusConfig, string) (commitstatus.Poster, error)
+	stopping  chan struct{}
+	stopOnce  sync.Once
+
+	shadow       Planner // if not nil, plans every release again, for comparison
+	shadowLogger log.Logger
+	middleware   []ActionMiddleware
+	admission    Admission
+	usage        usage.Meter
 }
 
+// Metrics are those of releases. Each histogram is labelled with the
+// instance and whether what's measured succeeded, as well as what's
+// particular to it.
 type Metrics struct {
 	ReleaseDuration metrics.Histogram
 	ActionDuration  metrics.Histogram
 	StageDuration   metrics.Histogram
+	// NothingToDo counts the releases planned which turned out to
+	// have nothing to do.
+	NothingToDo metrics.Counter
+	// ShadowPlans counts the releases planned again in shadow, by
+	// whether the plans were the same.
+	ShadowPlans metrics.Counter
+	Labels      fluxmetrics.LabelPolicy
+}
+
+// stageTimer times the stages of planning a release, one after the
+// other.
+type stageTimer struct {
+	duration metrics.Histogram
+	stage    string
+	begin    time.Time
+}
+
+func (r *Releaser) newStageTimer(instID flux.InstanceID, method string) *stageTimer {
+	return &stageTimer{
+		duration: r.metrics.StageDuration.With(
+			fluxmetrics.LabelInstanceID, r.metrics.Labels.Instance(string(instID)),
+			fluxmetrics.LabelMethod, method,
+		),
+	}
+}
+
+// next finishes the stage under way, if there is one, as a success,
+// and starts the stage given.
+func (t *stageTimer) next(stage string) {
+	t.observe(true)
+	t.stage, t.begin = stage, time.Now()
+}
+
+// done finishes the stage under way, which failed if there's an
+// error.
+func (t *stageTimer) done(err error) {
+	t.observe(err == nil)
+	t.stage = ""
+}
+
+func (t *stageTimer) observe(success bool) {
+	if t.stage == "" {
+		return
+	}
+	t.duration.With(
+		fluxmetrics.LabelStage, t.stage,
+		fluxmetrics.LabelSuccess, fmt.Sprint(success),
+	).Observe(time.Since(t.begin).Seconds())
+}
+
+// nothingToDo says whether a plan only reports things, rather than
+// doing any.
+func nothingToDo(actions []ReleaseAction) bool {
+	for _, action := range actions {
+		if action.Name != ActionPrintf && action.Name != ActionSkip {
+			return false
+		}
+	}
+	return true
 }
 
 func NewReleaser(
 	instancer instance.Instancer,
 	metrics Metrics,
+	policy FailurePolicy,
+	timeouts Timeouts,
+	features flux.Features,
 ) *Releaser {
 	return &Releaser{
 		instancer: instancer,
 		metrics:   metrics,
+		policy:    policy,
+		timeouts:  timeouts,
+		features:  features,
+		locks:     newKeyedLocks(),
+		indexes:   newFileIndexes(),
+		tickets: func(config flux.ChangeTicketConfig) (changes.System, error) {
+			return changes.New(config, http.DefaultClient)
+		},
+		statuses: func(config flux.CommitStatusConfig, repoURL string) (commitstatus.Poster, error) {
+			return commitstatus.New(config, repoURL, http.DefaultClient)
+		},
+		stopping: make(chan struct{}),
+		usage:    usage.NopMeter{},
 	}
 }
 
-type ReleaseAction struct {
-	Name        string                                `json:"name"`
-	Description string                                `json:"description"`
-	Do          func(*ReleaseContext) (string, error) `json:"-"`
-	Result      string                                `json:"result"`
+// MeterUsageWith has each release executed counted against its
+// instance by the meter given. It's for setting up the releaser,
+// before it handles any jobs.
+func (r *Releaser) MeterUsageWith(m usage.Meter) {
+	r.usage = m
+}
+
+// Stop tells the releaser to start no more release actions. Releases
+// in progress finish the action they're on, record what they've done
+// in the job, and return jobs.ErrJobInterrupted.
+func (r *Releaser) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopping)
+	})
 }
 
 func (r *Releaser) Handle(job *jobs.Job, updater jobs.JobUpdater) (followUps []jobs.Job, err error) {
@@ -62,6 +173,7 @@ func (r *Releaser) Handle(job *jobs.Job, updater jobs.JobUpdater) (followUps []j
 	releaseType := "unknown"
 	defer func(begin time.Time) {
 		r.metrics.ReleaseDuration.With(
+			fluxmetrics.LabelInstanceID, r.metrics.Labels.Instance(string(job.Instance)),
 			fluxmetrics.LabelReleaseType, releaseType,
 			fluxmetrics.LabelReleaseKind, string(params.Kind),
 			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
@@ -74,25 +186,171 @@ func (r *Releaser) Handle(job *jobs.Job, updater jobs.JobUpdater) (followUps []j
 	}
 
 	inst.Logger = log.NewContext(inst.Logger).With("job", job.ID)
+	if params.Snapshot != nil {
+		if params.Kind != flux.ReleaseKindPlan {
+			return nil, errors.New("a release against a platform snapshot can only be planned")
+		}
+		inst = inst.WithPlatform(platform.NewSnapshotPlatform(*params.Snapshot))
+	}
 
 	updateJob := func(format string, args ...interface{}) {
-		status := fmt.Sprintf(format, args...)
-		job.Status = status
-		job.Log = append(job.Log, status)
-		updater.UpdateJob(*job)
+		job.Logf(jobs.LogInfo, format, args...)
+		if err := updater.UpdateJob(*job); err != nil {
+			inst.Logger.Log("err", errors.Wrap(err, "updating job"))
+		}
 	}
 
-	updateJob("Calculating release actions.")
+	if params.ScheduledRestart {
+		wanted, next, err := scheduledRestart(job.Instance, inst, params)
+		if err != nil {
+			return nil, err
+		}
+		if !wanted {
+			updateJob("The service is no longer to be restarted on schedule. Nothing to do.")
+			return nil, nil
+		}
+		// The next restart is scheduled whether or not this one
+		// goes well.
+		defer func() { followUps = append(followUps, next...) }()
+	}
 
 	var actions []ReleaseAction
-	releaseType, actions, err = r.plan(inst, params)
+	switch {
+	case len(params.Plan) > 0:
+		// The plan was kept by flux itself, e.g., while waiting for a
+		// change ticket; run it as it is.
+		releaseType = "stored_plan"
+		updateJob("Using stored release plan.")
+		if err := json.Unmarshal(params.Plan, &actions); err != nil {
+			return nil, errors.Wrap(err, "unmarshaling stored plan")
+		}
+		if err := ValidatePlan(actions); err != nil {
+			return nil, errors.Wrap(err, "validating stored plan")
+		}
+	case params.PlanJob != "":
+		// The plan was made (and presumably approved) earlier; run
+		// it as it is.
+		releaseType = "stored_plan"
+		updateJob("Using the plan made by release %s.", params.PlanJob)
+		if actions, err = r.storedPlan(job.Instance, params.PlanJob); err != nil {
+			return nil, err
+		}
+	default:
+		updateJob("Calculating release actions.")
+		// Planning is given the timeout's context, so it stops
+		// fetching from registries and git once that's done; but
+		// until it notices it carries on in the background, so it
+		// mustn't write to anything we use afterwards.
+		type planned struct {
+			releaseType string
+			actions     []ReleaseAction
+		}
+		plans := make(chan planned, 1)
+		_, err = withTimeout(r.timeouts, PlanStage, func(ctx context.Context) (string, error) {
+			releaseType, actions, err := r.plan(job.Instance, inst.WithContext(ctx), params)
+			plans <- planned{releaseType, actions}
+			return "", err
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "planning release")
+		}
+		p := <-plans
+		releaseType, actions = p.releaseType, p.actions
+		r.shadowPlan(job, inst, params, releaseType, actions)
+		if nothingToDo(actions) {
+			r.metrics.NothingToDo.With(
+				fluxmetrics.LabelInstanceID, r.metrics.Labels.Instance(string(job.Instance)),
+				fluxmetrics.LabelReleaseType, releaseType,
+				fluxmetrics.LabelReleaseKind, string(params.Kind),
+			).Add(1)
+		}
+	}
+	if releaseType == "stored_plan" {
+		// What's allowed may have changed since the plan was made.
+		if actions, err = r.checkStoredPlan(inst, actions); err != nil {
+			return nil, errors.Wrap(err, "checking stored plan")
+		}
+	}
+	actions, err = r.admit(inst, job, params, releaseType, actions, updateJob)
 	if err != nil {
-		return nil, errors.Wrap(err, "planning release")
+		return nil, err
 	}
-	return nil, r.execute(inst, actions, params.Kind, updateJob)
+	if alreadyPushed(params) {
+		actions = resumePlan(actions, params.PushedRevision)
+	}
+	if params.Kind == flux.ReleaseKindExecute && params.SelfUpgrade == nil {
+		// Keep what's needed to abandon an upgrade of flux itself,
+		// with the job, since the daemon may not come back to say
+		// how it went.
+		record, err := selfUpgradeRecord(actions)
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			p := job.Params.(jobs.ReleaseJobParams)
+			p.SelfUpgrade = record
+			job.Params = p
+		}
+	}
+
+	if skips := skipped(actions); len(skips) > 0 {
+		p := job.Params.(jobs.ReleaseJobParams)
+		p.Skipped = skips
+		job.Params = p
+	}
+
+	if params.Kind == flux.ReleaseKindPlan {
+		// Keep the plan with the job, so it can be inspected, and
+		// submitted again to be executed.
+		plan, err := json.Marshal(actions)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshaling plan")
+		}
+		p := job.Params.(jobs.ReleaseJobParams)
+		p.Plan = plan
+		job.Params = p
+	}
+
+	var ticket *changeTicket
+	if params.Kind == flux.ReleaseKindExecute {
+		var wait *jobs.Job
+		ticket, wait, err = r.changeTicket(inst, job, actions, updateJob)
+		if err != nil {
+			return nil, err
+		}
+		if wait != nil {
+			return []jobs.Job{*wait}, nil
+		}
+		unlock := r.locks.Lock(lockKeys(job.Instance, inst.ConfigRepo())...)
+		defer unlock()
+	}
+	checkpoint := func(action, pushed string) {
+		if err := recordCompleted(job, updater, action, pushed); err != nil {
+			inst.Logger.Log("err", err)
+		}
+	}
+	if params.Kind == flux.ReleaseKindExecute && !nothingToDo(actions) {
+		r.usage.Add(job.Instance, usage.Releases, 1)
+	}
+	err = r.execute(inst, job.Instance, job.ID, params.User, actions, params.Kind, updateJob, checkpoint)
+	if ticket != nil {
+		ticket.record(actions, err, updateJob)
+	}
+	return nil, err
 }
 
-func (r *Releaser) plan(inst *instance.Instance, params jobs.ReleaseJobParams) (string, []ReleaseAction, error) {
+// lockKeys gives the keys under which a release must be serialised:
+// the instance, and the config repo it pushes to (which may be shared
+// by more than one instance).
+func lockKeys(instID flux.InstanceID, repo git.Repo) []string {
+	keys := []string{"instance:" + string(instID)}
+	if repo.URL != "" {
+		keys = append(keys, "repo:"+repo.URL+"#"+repo.Branch)
+	}
+	return keys
+}
+
+func (r *Releaser) plan(instID flux.InstanceID, inst *instance.Instance, params jobs.ReleaseJobParams) (string, []ReleaseAction, error) {
 	releaseType := "unknown"
 
 	images := ImageSelectorForSpec(params.ImageSpec)
@@ -105,56 +363,336 @@ func (r *Releaser) plan(inst *instance.Instance, params jobs.ReleaseJobParams) (
 	msg := fmt.Sprintf("Release %v to %v", images, services)
 	var actions []ReleaseAction
 	switch {
+	case params.MigrateImages != nil:
+		releaseType = "migrate_images"
+		actions, err = r.releaseMigration(instID, releaseType, inst, *params.MigrateImages)
+
+	case params.Restart:
+		releaseType = "restart"
+		actions, err = r.releaseRestart(instID, releaseType, restartMessage(services), inst, services)
+
+	case len(params.ContainerTargets) > 0:
+		releaseType = "release_containers"
+		actions, err = r.releaseContainers(instID, releaseType, inst, params.ContainerTargets)
+
 	case params.ServiceSpec == flux.ServiceSpecAll && params.ImageSpec == flux.ImageSpecLatest:
 		releaseType = "release_all_to_latest"
-		actions, err = r.releaseImages(releaseType, msg, inst, services, images)
+		actions, err = r.releaseImages(instID, releaseType, msg, inst, services, images)
+
+	case params.ImageSpec == flux.ImageSpecLatestAllowed:
+		releaseType = "release_to_latest_allowed"
+		actions, err = r.releaseImages(instID, releaseType, msg, inst, services, images)
 
 	case params.ServiceSpec == flux.ServiceSpecAll && params.ImageSpec == flux.ImageSpecNone:
 		releaseType = "release_all_without_update"
-		actions, err = r.releaseWithoutUpdate(releaseType, msg, inst, services)
+		actions, err = r.releaseWithoutUpdate(instID, releaseType, msg, inst, services)
 
 	case params.ServiceSpec == flux.ServiceSpecAll:
 		releaseType = "release_all_for_image"
-		actions, err = r.releaseImages(releaseType, msg, inst, services, images)
+		actions, err = r.releaseImages(instID, releaseType, msg, inst, services, images)
 
 	case params.ImageSpec == flux.ImageSpecLatest:
 		releaseType = "release_one_to_latest"
-		actions, err = r.releaseImages(releaseType, msg, inst, services, images)
+		actions, err = r.releaseImages(instID, releaseType, msg, inst, services, images)
+
+	case isLatestOfRepository(params.ImageSpec):
+		releaseType = "release_repository_to_latest"
+		actions, err = r.releaseImages(instID, releaseType, msg, inst, services, images)
 
 	case params.ImageSpec == flux.ImageSpecNone:
 		releaseType = "release_one_without_update"
-		actions, err = r.releaseWithoutUpdate(releaseType, msg, inst, services)
+		actions, err = r.releaseWithoutUpdate(instID, releaseType, msg, inst, services)
 
 	default:
 		releaseType = "release_one"
-		actions, err = r.releaseImages(releaseType, msg, inst, services, images)
+		actions, err = r.releaseImages(instID, releaseType, msg, inst, services, images)
+	}
+	if err == nil {
+		err = r.checkDefinitions(inst, actions)
+	}
+	if params.RefuseOnDrift {
+		for i := range actions {
+			if actions[i].Name == ActionUpdatePodController {
+				actions[i].RefuseOnDrift = true
+			}
+		}
+	}
+	config, configErr := inst.GetConfig()
+	if configErr != nil {
+		return releaseType, nil, errors.Wrap(configErr, "getting instance config")
+	}
+	actions = withSelfUpgrade(actions, config.Settings.SelfUpgrade)
+	if fields := config.Settings.ImageFields; len(fields) > 0 {
+		actions = withUpdateImageFields(actions, fields)
+	}
+	if params.ServerDryRun {
+		actions = withServerDryRun(actions)
+	}
+	if params.WaitForRollout {
+		if params.RolloutTimeout != "" {
+			if _, err := time.ParseDuration(params.RolloutTimeout); err != nil {
+				return releaseType, nil, errors.Wrap(err, "parsing rollout timeout")
+			}
+		}
+		actions = withWaitForRollout(actions, params.RolloutTimeout)
+	}
+	if shifts := config.Settings.TrafficShifts; len(shifts) > 0 {
+		actions, configErr = withShiftTraffic(actions, shifts)
+		if configErr != nil {
+			return releaseType, nil, configErr
+		}
 	}
+	if check := config.Settings.AlertCheck; check != nil {
+		alerts := *check
+		if !config.Settings.Features.Enabled(flux.FeatureAutoRollback, r.features) {
+			alerts.Rollback = false
+		}
+		actions, configErr = withCheckAlerts(actions, alerts)
+		if configErr != nil {
+			return releaseType, nil, configErr
+		}
+	}
+	if params.PruneSelector != "" && !config.Settings.Features.Enabled(flux.FeaturePrune, r.features) {
+		return releaseType, nil, errors.Errorf("pruning resources is not enabled for this instance (feature %q)", flux.FeaturePrune)
+	}
+	if params.ApplyResources {
+		actions = withApplyResources(actions, r.releaseActionApplyResources(params.PruneSelector))
+	}
+	actions = withRevision(inst, actions)
 	return releaseType, actions, err
 }
 
-func (r *Releaser) releaseImages(method, msg string, inst *instance.Instance, getServices ServiceSelector, getImages ImageSelector) ([]ReleaseAction, error) {
+// withRevision records the tip of the config repo branch in the clone
+// action, so that executing the plan can tell if it's out of date. If
+// the revision can't be got, the plan is left as it is, and only the
+// push is checked against concurrent changes.
+func withRevision(inst *instance.Instance, actions []ReleaseAction) []ReleaseAction {
+	for i, action := range actions {
+		if action.Name == ActionClone {
+			rev, err := inst.ConfigRepo().BranchRevision()
+			if err != nil {
+				inst.Logger.Log("err", errors.Wrap(err, "getting config repo revision"))
+				return actions
+			}
+			actions[i].Revision = rev
+			actions[i].Description = fmt.Sprintf("Clone the config repo (expecting %.7s).", rev)
+		}
+	}
+	return actions
+}
+
+// withUpdateImageFields adds an action to update the images given in
+// fields other than those of containers, just before the changes are
+// committed.
+func withUpdateImageFields(actions []ReleaseAction, fields []flux.ImageField) []ReleaseAction {
+	var updates []ContainerUpdate
+	for _, action := range actions {
+		if action.Name == ActionUpdatePodController {
+			updates = append(updates, action.Updates...)
+		}
+	}
+	if len(updates) == 0 {
+		return actions
+	}
+	for i, action := range actions {
+		if action.Name == ActionCommitAndPush {
+			res := append([]ReleaseAction{}, actions[:i]...)
+			res = append(res, ReleaseAction{
+				Name:        ActionUpdateImageFields,
+				Description: fmt.Sprintf("Update images given in other fields (%d kind(s) of field configured).", len(fields)),
+				Updates:     updates,
+				ImageFields: fields,
+			})
+			return append(res, actions[i:]...)
+		}
+	}
+	return actions
+}
+
+// withServerDryRun adds an action to have the platform check the
+// updated definitions, just before the changes are committed. Plans
+// which update nothing are left alone.
+func withServerDryRun(actions []ReleaseAction) []ReleaseAction {
+	var services []flux.ServiceID
+	for _, action := range actions {
+		switch action.Name {
+		case ActionUpdatePodController:
+			services = append(services, action.Service)
+		case ActionMigrateImages:
+			services = append(services, action.Services...)
+		}
+	}
+	if len(services) == 0 {
+		return actions
+	}
+	for i, action := range actions {
+		if action.Name == ActionCommitAndPush {
+			res := append([]ReleaseAction{}, actions[:i]...)
+			res = append(res, ReleaseAction{
+				Name:        ActionDryRunApply,
+				Description: fmt.Sprintf("Dry-run apply the updated definitions of %d service(s), to check the platform would accept them.", len(services)),
+				Services:    services,
+			})
+			return append(res, actions[i:]...)
+		}
+	}
+	return actions
+}
+
+// withWaitForRollout adds an action, after the services are
+// released, to wait until they're running the new images.
+func withWaitForRollout(actions []ReleaseAction, timeout string) []ReleaseAction {
+	for i, action := range actions {
+		if action.Name == ActionReleaseServices && len(action.Services) > 0 {
+			desc := fmt.Sprintf("Wait for %d service(s) to be rolled out.", len(action.Services))
+			if timeout != "" {
+				desc = fmt.Sprintf("Wait up to %s for %d service(s) to be rolled out.", timeout, len(action.Services))
+			}
+			res := append([]ReleaseAction{}, actions[:i+1]...)
+			res = append(res, ReleaseAction{
+				Name:        ActionWaitForRollout,
+				Description: desc,
+				Services:    action.Services,
+				Timeout:     timeout,
+			})
+			return append(res, actions[i+1:]...)
+		}
+	}
+	return actions
+}
+
+// withCheckAlerts puts the action to watch for alerts after the
+// services are rolled out (and any traffic shifted to them), if the
+// release waits for that, or after they're released otherwise.
+func withCheckAlerts(actions []ReleaseAction, check flux.AlertCheckConfig) ([]ReleaseAction, error) {
+	window, err := time.ParseDuration(check.Window)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing alert check window")
+	}
+	after := -1
+	var services []flux.ServiceID
+	for i, action := range actions {
+		switch {
+		case action.Name == ActionReleaseServices && len(action.Services) > 0:
+			after, services = i, action.Services
+		case (action.Name == ActionWaitForRollout || action.Name == ActionShiftTraffic) && after >= 0:
+			after = i
+		}
+	}
+	if after < 0 {
+		return actions, nil
+	}
+	res := append([]ReleaseAction{}, actions[:after+1]...)
+	res = append(res, ReleaseAction{
+		Name:        ActionCheckAlerts,
+		Description: fmt.Sprintf("Watch for alerts about %d service(s) for %s.", len(services), window),
+		Services:    services,
+		Window:      check.Window,
+		Rollback:    check.Rollback,
+		Timeout:     (window + alertCheckGrace).String(),
+	})
+	return append(res, actions[after+1:]...), nil
+}
+
+// withApplyResources puts the action to apply other resources just
+// before the services are released, so that anything they need (e.g.,
+// ConfigMaps) is there already. Plans which release nothing are left
+// alone.
+func withApplyResources(actions []ReleaseAction, apply ReleaseAction) []ReleaseAction {
+	for i, action := range actions {
+		if action.Name == ActionReleaseServices {
+			res := append([]ReleaseAction{}, actions[:i]...)
+			res = append(res, apply)
+			return append(res, actions[i:]...)
+		}
+	}
+	return actions
+}
+
+// recordCompleted records, with the job, that an action of the kind
+// given has been done, and once they've been pushed, the revision with
+// the release's changes. It's saved straight away, so that if the
+// release is interrupted, another attempt knows how far it got.
+func recordCompleted(job *jobs.Job, updater jobs.JobUpdater, action, pushed string) error {
+	p := job.Params.(jobs.ReleaseJobParams)
+	for _, done := range p.CompletedActions {
+		if done == action {
+			return nil
+		}
+	}
+	p.CompletedActions = append(p.CompletedActions, action)
+	if action == ActionCommitAndPush {
+		p.PushedRevision = pushed
+	}
+	job.Params = p
+	return errors.Wrap(updater.UpdateJob(*job), "recording completed action")
+}
+
+// alreadyPushed says whether a previous, interrupted, attempt at the
+// release got as far as pushing its changes to the config repo. (The
+// resumed plan checks that they're there.)
+func alreadyPushed(params jobs.ReleaseJobParams) bool {
+	if params.PushedRevision == "" {
+		return false
+	}
+	for _, action := range params.CompletedActions {
+		if action == ActionCommitAndPush {
+			return true
+		}
+	}
+	return false
+}
+
+// resumePlan adapts a plan whose changes have already been pushed to
+// the config repo, as the revision given: rather than being updated
+// and committed again, the definitions are loaded from the config repo
+// as they are, once it's been checked that the revision is there.
+func resumePlan(actions []ReleaseAction, pushed string) []ReleaseAction {
 	var res []ReleaseAction
-	res = append(res, r.releaseActionPrintf(msg))
+	for _, action := range actions {
+		switch action.Name {
+		case ActionUpdatePodController:
+			res = append(res, ReleaseAction{
+				Name:        ActionFindPodController,
+				Description: fmt.Sprintf("Load the resource definition file for service %s", action.Service),
+				Service:     action.Service,
+			})
+		case ActionClone:
+			// The branch has moved on, with our own changes
+			action.Revision = ""
+			res = append(res, action)
+		case ActionCommitAndPush:
+			res = append(res, ReleaseAction{
+				Name:        ActionCheckPushed,
+				Description: fmt.Sprintf("Check that the commit %s, pushed before the release was interrupted, is in the config repo.", pushed),
+				Revision:    pushed,
+			})
+		default:
+			res = append(res, action)
+		}
+	}
+	return res
+}
 
-	var (
-		base  = r.metrics.StageDuration.With("method", method)
-		stage *metrics.Timer
-	)
+func (r *Releaser) releaseImages(instID flux.InstanceID, method, msg string, inst *instance.Instance, getServices ServiceSelector, getImages ImageSelector) (_ []ReleaseAction, err error) {
+	var res []ReleaseAction
+	res = append(res, r.releaseActionPrintf(msg))
 
-	defer func() { stage.ObserveDuration() }()
-	stage = metrics.NewTimer(base.With("stage", "fetch_platform_services"))
+	stages := r.newStageTimer(instID, method)
+	defer func() { stages.done(err) }()
+	stages.next("fetch_platform_services")
 
 	services, err := getServices.SelectServices(inst)
 	if err != nil {
 		return nil, errors.Wrap(err, "fetching platform services")
 	}
+	res = append(res, r.releaseActionsExpansion(getServices, services)...)
 	if len(services) == 0 {
 		res = append(res, r.releaseActionPrintf("No selected services found. Nothing to do."))
 		return res, nil
 	}
 
-	stage.ObserveDuration()
-	stage = metrics.NewTimer(base.With("stage", "calculate_applies"))
+	stages.next("calculate_applies")
 
 	// Each service is running multiple images.
 	// Each image may need to be upgraded, and trigger an apply.
@@ -163,23 +701,37 @@ func (r *Releaser) releaseImages(method, msg string, inst *instance.Instance, ge
 		return nil, errors.Wrap(err, "collecting available images to calculate applies")
 	}
 
-	updateMap := CalculateUpdates(services, images, func(format string, args ...interface{}) {
-		res = append(res, r.releaseActionPrintf(format, args...))
-	})
+	skip := func(s jobs.Skip, format string, args ...interface{}) {
+		res = append(res, r.releaseActionSkip(s, format, args...))
+	}
+	var updateMap map[flux.ServiceID][]ContainerUpdate
+	switch getImages.(type) {
+	case latestOfRepository, latestAllowedImages:
+		// Each service gets the latest image it's allowed.
+		config, err := inst.GetConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "getting instance config")
+		}
+		updateMap = CalculateFilteredUpdates(services, images, config, skip)
+	default:
+		updateMap = CalculateUpdates(services, images, skip)
+	}
 
 	if len(updateMap) <= 0 {
 		res = append(res, r.releaseActionPrintf("All selected services are running the requested images. Nothing to do."))
 		return res, nil
 	}
 
-	stage.ObserveDuration()
-	stage = metrics.NewTimer(base.With("stage", "finalize"))
+	stages.next("finalize")
 
 	// We have identified at least 1 release that needs to occur. Releasing
 	// means cloning the repo, changing the resource file(s), committing and
 	// pushing, and then making the release(s) to the platform.
 
 	res = append(res, r.releaseActionClone())
+	// If the changes were pushed before an interruption, but we didn't
+	// get to record that, the updates will make no difference to the
+	// files, and nothing will be committed.
 	for service, applies := range updateMap {
 		res = append(res, r.releaseActionUpdatePodController(service, applies))
 	}
@@ -193,29 +745,120 @@ func (r *Releaser) releaseImages(method, msg string, inst *instance.Instance, ge
 	return res, nil
 }
 
-// Release whatever is in the cloned configuration, without changing anything
-func (r *Releaser) releaseWithoutUpdate(method, msg string, inst *instance.Instance, getServices ServiceSelector) ([]ReleaseAction, error) {
-	var res []ReleaseAction
+// releaseContainers updates just the containers given, leaving any
+// others in the same pods alone.
+func (r *Releaser) releaseContainers(instID flux.InstanceID, method string, inst *instance.Instance, targets []jobs.ContainerTarget) (_ []ReleaseAction, err error) {
+	stages := r.newStageTimer(instID, method)
+	defer func() { stages.done(err) }()
+	stages.next("fetch_platform_services")
 
 	var (
-		base  = r.metrics.StageDuration.With("method", method)
-		stage *metrics.Timer
+		ids         []flux.ServiceID
+		targetNames []string
 	)
+	for _, t := range targets {
+		ids = append(ids, t.Service)
+		targetNames = append(targetNames, fmt.Sprintf("%s:%s", t.Service, t.Container))
+	}
+	msg := fmt.Sprintf("Release %s", strings.Join(targetNames, ", "))
+	res := []ReleaseAction{r.releaseActionPrintf(msg)}
+
+	locked, err := lockedServices(inst)
+	if err != nil {
+		return nil, err
+	}
+	lockedSet := flux.ServiceIDSet{}
+	lockedSet.Add(locked)
+
+	services, err := inst.GetServices(ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching platform services")
+	}
+	byID := map[flux.ServiceID]platform.Service{}
+	for _, s := range services {
+		byID[s.ID] = s
+	}
+
+	stages.next("calculate_applies")
+
+	updateMap := map[flux.ServiceID][]ContainerUpdate{}
+	for _, t := range targets {
+		if lockedSet.Contains(t.Service) {
+			skip := jobs.Skip{Service: t.Service, Container: t.Container, Reason: jobs.SkipLocked}
+			res = append(res, r.releaseActionSkip(skip, "Service %s is locked; skipping container %s.", t.Service, t.Container))
+			continue
+		}
+		service, ok := byID[t.Service]
+		if !ok {
+			return nil, fmt.Errorf("service %s not found", t.Service)
+		}
+		var current *platform.Container
+		for _, c := range service.ContainersOrNil() {
+			if c.Name == t.Container {
+				c := c
+				current = &c
+				break
+			}
+		}
+		if current == nil {
+			return nil, fmt.Errorf("service %s has no container %q", t.Service, t.Container)
+		}
+		currentImageID, err := flux.ParseImageID(current.Image)
+		if err != nil {
+			return nil, errors.Wrapf(err, "container %q of service %s", t.Container, t.Service)
+		}
+		if currentImageID.Repository() != t.Image.Repository() {
+			return nil, fmt.Errorf("container %q of service %s runs %s, not an image from %s", t.Container, t.Service, currentImageID.Repository(), t.Image.Repository())
+		}
+		if currentImageID == t.Image {
+			skip := jobs.Skip{Service: t.Service, Container: t.Container, Reason: jobs.SkipAlreadyRunning}
+			res = append(res, r.releaseActionSkip(skip, "Service %s container %s is already running %s; skipping.", t.Service, t.Container, t.Image))
+			continue
+		}
+		updateMap[t.Service] = append(updateMap[t.Service], ContainerUpdate{
+			Container: t.Container,
+			Current:   currentImageID,
+			Target:    t.Image,
+		})
+	}
+
+	if len(updateMap) == 0 {
+		res = append(res, r.releaseActionPrintf("All selected containers are running the requested images. Nothing to do."))
+		return res, nil
+	}
+
+	stages.next("finalize")
+
+	res = append(res, r.releaseActionClone())
+	var servicesToApply []flux.ServiceID
+	for service, updates := range updateMap {
+		res = append(res, r.releaseActionUpdatePodController(service, updates))
+		servicesToApply = append(servicesToApply, service)
+	}
+	res = append(res, r.releaseActionCommitAndPush(msg))
+	res = append(res, r.releaseActionReleaseServices(servicesToApply, msg))
+	return res, nil
+}
+
+// Release whatever is in the cloned configuration, without changing anything
+func (r *Releaser) releaseWithoutUpdate(instID flux.InstanceID, method, msg string, inst *instance.Instance, getServices ServiceSelector) (_ []ReleaseAction, err error) {
+	var res []ReleaseAction
 
-	defer func() { stage.ObserveDuration() }()
-	stage = metrics.NewTimer(base.With("stage", "fetch_platform_services"))
+	stages := r.newStageTimer(instID, method)
+	defer func() { stages.done(err) }()
+	stages.next("fetch_platform_services")
 
 	services, err := getServices.SelectServices(inst)
 	if err != nil {
 		return nil, errors.Wrap(err, "fetching platform services")
 	}
+	res = append(res, r.releaseActionsExpansion(getServices, services)...)
 	if len(services) == 0 {
 		res = append(res, r.releaseActionPrintf("No selected services found. Nothing to do."))
 		return res, nil
 	}
 
-	stage.ObserveDuration()
-	stage = metrics.NewTimer(base.With("stage", "finalize"))
+	stages.next("finalize")
 
 	res = append(res, r.releaseActionPrintf(msg))
 	res = append(res, r.releaseActionClone())
@@ -229,134 +872,320 @@ func (r *Releaser) releaseWithoutUpdate(method, msg string, inst *instance.Insta
 	return res, nil
 }
 
-func (r *Releaser) execute(inst *instance.Instance, actions []ReleaseAction, kind flux.ReleaseKind, updateJob func(string, ...interface{})) error {
+func (r *Releaser) execute(inst *instance.Instance, instID flux.InstanceID, jobID jobs.JobID, user string, actions []ReleaseAction, kind flux.ReleaseKind, updateJob func(string, ...interface{}), checkpoint func(string, string)) error {
+	if kind != flux.ReleaseKindExecute {
+		for _, action := range actions {
+			updateJob(action.Description)
+			inst.Log("description", action.Description)
+		}
+		return nil
+	}
+
 	rc := NewReleaseContext(inst)
+	rc.InstanceID, rc.Job, rc.User = instID, jobID, user
+	rc.indexes = r.indexes
 	defer rc.Clean()
 
-	for i, action := range actions {
-		updateJob(action.Description)
-		inst.Log("description", action.Description)
-		if action.Do == nil {
-			continue
+	// Actions in the same layer run concurrently, and all report
+	// progress to the job.
+	var mu sync.Mutex
+	syncUpdateJob := func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		updateJob(format, args...)
+	}
+
+	var (
+		tx        transaction
+		completed int
+		done      = make([]bool, len(actions))
+		files     = definitionFiles(rc)
+	)
+	for {
+		layer := nextLayer(actions, done, files)
+		if len(layer) == 0 {
+			break
+		}
+		select {
+		case <-r.stopping:
+			updateJob("Shutting down; stopped after %d of %d actions.", completed, len(actions))
+			inst.Log("interrupted", "shutting down", "completed", completed, "actions", len(actions))
+			return jobs.ErrJobInterrupted
+		default:
 		}
 
-		if kind == flux.ReleaseKindExecute {
-			begin := time.Now()
-			result, err := action.Do(rc)
-			r.metrics.ActionDuration.With(
-				fluxmetrics.LabelAction, action.Name,
-				fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
-			).Observe(time.Since(begin).Seconds())
-			if err != nil {
+		var (
+			results = make([]string, len(layer))
+			errs    = make([]error, len(layer))
+			wg      sync.WaitGroup
+			sem     = make(chan struct{}, maxParallelActions)
+		)
+		for n, i := range layer {
+			wg.Add(1)
+			go func(n int, action ReleaseAction) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				syncUpdateJob(action.Description)
+				inst.Log("description", action.Description)
+				results[n], errs[n] = r.doWithRetries(rc, action, syncUpdateJob)
+			}(n, actions[i])
+		}
+		wg.Wait()
+
+		var failed error
+		for n, i := range layer {
+			if err := errs[n]; err != nil {
 				updateJob(err.Error())
 				inst.Log("err", err)
 				actions[i].Result = "Failed: " + err.Error()
-				return err
+				if failed == nil {
+					failed = err
+				}
+				if isTimeout(err) {
+					// It's been told to stop, but it mustn't still be
+					// running when the repo is cleaned up or what it
+					// did is rolled back; and if it got there in the
+					// end, that needs rolling back too.
+					updateJob("Waiting for %s to stop.", actions[i].Name)
+					if _, lateErr := waitForTimedOut(err); lateErr == nil {
+						tx.record(actions[i])
+					}
+				}
+				continue
 			}
-			if result != "" {
-				updateJob(result)
+			tx.record(actions[i])
+			done[i] = true
+			actions[i].Result = results[n]
+			checkpoint(actions[i].Name, rc.Revision)
+			completed++
+			if results[n] != "" {
+				updateJob(results[n])
 			}
-			actions[i].Result = result
+		}
+		if failed != nil {
+			if r.policy != FailureNone {
+				tx.rollback(rc, updateJob)
+			}
+			return failed
 		}
 	}
 
+	r.postCommitStatus(inst, rc, updateJob)
+	r.tagRelease(inst, rc, actions, updateJob)
 	return nil
 }
 
-func CalculateUpdates(services []platform.Service, images instance.ImageMap, printf func(string, ...interface{})) map[flux.ServiceID][]ContainerUpdate {
+// doWithRetries runs an action, retrying it if it fails and the
+// failure policy says to. An action which timed out isn't retried,
+// since it may still be running; the caller has to wait for it.
+func (r *Releaser) doWithRetries(rc *ReleaseContext, action ReleaseAction, updateJob func(string, ...interface{})) (string, error) {
+	result, err := r.do(rc, action)
+	if err != nil && !isTimeout(err) && r.policy == FailureRetry && !actionTypes[action.Name].noRetry {
+		for attempt := 1; err != nil && !isTimeout(err) && attempt <= maxRetries; attempt++ {
+			updateJob("%s; retrying (%d of %d).", err, attempt, maxRetries)
+			time.Sleep(time.Duration(attempt) * retryBackoff)
+			result, err = r.do(rc, action)
+		}
+	}
+	return result, err
+}
+
+// do runs a single action, recording how long it took.
+func (r *Releaser) do(rc *ReleaseContext, action ReleaseAction) (string, error) {
+	t, ok := actionTypes[action.Name]
+	if !ok {
+		return "", fmt.Errorf("unknown kind of action %q", action.Name)
+	}
+	timeouts := r.timeouts
+	if action.Timeout != "" {
+		// This was checked when the plan was made or loaded
+		d, _ := time.ParseDuration(action.Timeout)
+		timeouts = Timeouts{action.Name: d}
+	}
+	run := r.runner(t.do)
+	begin := time.Now()
+	rc.running.Add(1)
+	result, err := withTimeout(timeouts, action.Name, func(ctx context.Context) (string, error) {
+		defer rc.running.Done()
+		return run(ctx, rc, action)
+	})
+	r.metrics.ActionDuration.With(
+		fluxmetrics.LabelInstanceID, r.metrics.Labels.Instance(string(rc.InstanceID)),
+		fluxmetrics.LabelAction, action.Name,
+		fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+	).Observe(time.Since(begin).Seconds())
+	return result, err
+}
+
+// CalculateUpdates gives the updates needed to bring each service's
+// containers up to the latest images. Each container (or service)
+// left alone is passed to skip, with the reason and a message.
+func CalculateUpdates(services []platform.Service, images instance.ImageMap, skip func(jobs.Skip, string, ...interface{})) map[flux.ServiceID][]ContainerUpdate {
+	return CalculateLatestUpdates(services, NewLatestImages(images), instance.Config{}, skip)
+}
+
+// CalculateFilteredUpdates is like CalculateUpdates, except that
+// services with a tag filter only get images with tags matching it.
+func CalculateFilteredUpdates(services []platform.Service, images instance.ImageMap, config instance.Config, skip func(jobs.Skip, string, ...interface{})) map[flux.ServiceID][]ContainerUpdate {
+	return CalculateLatestUpdates(services, NewLatestImages(images), config, skip)
+}
+
+// CalculateLatestUpdates is like CalculateFilteredUpdates, with the
+// latest images resolved by (and perhaps already kept in) latest.
+func CalculateLatestUpdates(services []platform.Service, latest *LatestImages, config instance.Config, skip func(jobs.Skip, string, ...interface{})) map[flux.ServiceID][]ContainerUpdate {
 	updateMap := map[flux.ServiceID][]ContainerUpdate{}
+	now := time.Now()
 	for _, service := range services {
 		containers, err := service.ContainersOrError()
 		if err != nil {
-			printf("service %s does not have images associated: %s", service.ID, err)
+			skip(jobs.Skip{Service: service.ID, Reason: jobs.SkipNoImages}, "service %s does not have images associated: %s", service.ID, err)
 			continue
 		}
+		serviceConfig := config.Services[service.ID]
+		filter := serviceConfig.TagFilter
 		for _, container := range containers {
-			currentImageID := flux.ParseImageID(container.Image)
-			latestImage := images.LatestImage(currentImageID.Repository())
+			currentImageID, err := flux.ParseImageID(container.Image)
+			if err != nil {
+				skip(jobs.Skip{Service: service.ID, Container: container.Name, Reason: jobs.SkipInvalidImage}, "Service %s container %s: %s", service.ID, container.Name, err)
+				continue
+			}
+			latestImage := latest.Latest(currentImageID.Repository(), filter)
 			if latestImage == nil {
 				continue
 			}
 
 			if currentImageID == latestImage.ID {
-				printf("Service %s image %s is already the latest one; skipping.", service.ID, currentImageID)
+				skip(jobs.Skip{Service: service.ID, Container: container.Name, Reason: jobs.SkipAlreadyLatest}, "Service %s image %s is already the latest one; skipping.", service.ID, currentImageID)
+				continue
+			}
+			if reason, msg := imageAgeSkip(serviceConfig, latest.Describe(currentImageID), latestImage, now); reason != "" {
+				skip(jobs.Skip{Service: service.ID, Container: container.Name, Reason: reason}, "Service %s container %s: %s; skipping.", service.ID, container.Name, msg)
+				continue
+			}
+			if msg, ok := suspectSkip(config, service.ID, latestImage.ID); ok {
+				skip(jobs.Skip{Service: service.ID, Container: container.Name, Reason: jobs.SkipImageSuspect}, "Service %s container %s: %s; skipping.", service.ID, container.Name, msg)
 				continue
 			}
 
 			updateMap[service.ID] = append(updateMap[service.ID], ContainerUpdate{
-				Container: container.Name,
-				Current:   currentImageID,
-				Target:    latestImage.ID,
+				Container:       container.Name,
+				Current:         currentImageID,
+				Target:          latestImage.ID,
+				TargetCreatedAt: latestImage.CreatedAt,
 			})
 		}
 	}
 	return updateMap
 }
 
+// imageAgeSkip gives the reason, and a message, if a service's
+// policies on the age of images mean a container mustn't be updated
+// to the target image. An image whose age isn't known is taken to be
+// too new; if the age of the image running isn't known, there's
+// nothing to say the target isn't newer.
+func imageAgeSkip(conf instance.ServiceConfig, current, target *flux.ImageDescription, now time.Time) (reason, msg string) {
+	if conf.MinImageAge > 0 {
+		minAge := time.Duration(conf.MinImageAge) * time.Minute
+		if target.CreatedAt == nil {
+			return jobs.SkipImageTooNew, fmt.Sprintf("image %s may be less than %s old, since when it was built is not known", target.ID, minAge)
+		}
+		if age := now.Sub(*target.CreatedAt); age < minAge {
+			return jobs.SkipImageTooNew, fmt.Sprintf("image %s is %s old, less than the minimum of %s", target.ID, age/time.Second*time.Second, minAge)
+		}
+	}
+	if conf.NewerOnly && current != nil && current.CreatedAt != nil {
+		if target.CreatedAt == nil || !target.CreatedAt.After(*current.CreatedAt) {
+			return jobs.SkipImageNotNewer, fmt.Sprintf("image %s is not newer than %s, which is running", target.ID, current.ID)
+		}
+	}
+	return "", ""
+}
+
+func isLatestOfRepository(spec flux.ImageSpec) bool {
+	_, ok := spec.LatestOfRepository()
+	return ok
+}
+
 // Release helpers.
 
 type ContainerUpdate struct {
-	Container string
-	Current   flux.ImageID
-	Target    flux.ImageID
+	Container       string
+	Current         flux.ImageID
+	Target          flux.ImageID
+	TargetCreatedAt *time.Time `json:",omitempty"`
 }
 
-// ReleaseAction Do funcs
+// ReleaseAction constructors
 
 func (r *Releaser) releaseActionPrintf(format string, args ...interface{}) ReleaseAction {
 	return ReleaseAction{
-		Name:        "printf",
+		Name:        ActionPrintf,
 		Description: fmt.Sprintf(format, args...),
-		Do: func(_ *ReleaseContext) (res string, err error) {
-			return "", nil
-		},
+	}
+}
+
+// releaseActionSkip records that a service, or one of its containers,
+// is left out of the release, with a message for people.
+func (r *Releaser) releaseActionSkip(skip jobs.Skip, format string, args ...interface{}) ReleaseAction {
+	return ReleaseAction{
+		Name:        ActionSkip,
+		Description: fmt.Sprintf(format, args...),
+		Service:     skip.Service,
+		Container:   skip.Container,
+		Reason:      skip.Reason,
+	}
+}
+
+// skipped gives the skips recorded in a plan, in order.
+func skipped(actions []ReleaseAction) []jobs.Skip {
+	var res []jobs.Skip
+	for _, action := range actions {
+		if action.Name == ActionSkip {
+			res = append(res, jobs.Skip{Service: action.Service, Container: action.Container, Reason: action.Reason})
+		}
+	}
+	return res
+}
+
+// releaseActionsExpansion reports what a selector's patterns, if it
+// has any, expanded to.
+func (r *Releaser) releaseActionsExpansion(selector ServiceSelector, services []platform.Service) []ReleaseAction {
+	e, ok := selector.(expandingSelector)
+	if !ok {
+		return nil
+	}
+	var res []ReleaseAction
+	for _, line := range e.Expansion(services) {
+		res = append(res, r.releaseActionPrintf("%s", line))
+	}
+	return res
+}
+
+func (r *Releaser) releaseActionApplyResources(pruneSelector string) ReleaseAction {
+	desc := "Apply the other resources defined in the config repo."
+	if pruneSelector != "" {
+		desc = fmt.Sprintf("Apply the other resources defined in the config repo, deleting those matching %s that aren't.", pruneSelector)
+	}
+	return ReleaseAction{
+		Name:          ActionApplyResources,
+		Description:   desc,
+		PruneSelector: pruneSelector,
 	}
 }
 
 func (r *Releaser) releaseActionClone() ReleaseAction {
 	return ReleaseAction{
-		Name:        "clone",
+		Name:        ActionClone,
 		Description: "Clone the config repo.",
-		Do: func(rc *ReleaseContext) (res string, err error) {
-			err = rc.CloneRepo()
-			if err != nil {
-				return "", errors.Wrap(err, "clone the config repo")
-			}
-			return "Clone OK.", nil
-		},
 	}
 }
 
 func (r *Releaser) releaseActionFindPodController(service flux.ServiceID) ReleaseAction {
 	return ReleaseAction{
-		Name:        "find_pod_controller",
+		Name:        ActionFindPodController,
 		Description: fmt.Sprintf("Load the resource definition file for service %s", service),
-		Do: func(rc *ReleaseContext) (res string, err error) {
-			resourcePath := rc.RepoPath()
-			if fi, err := os.Stat(resourcePath); err != nil || !fi.IsDir() {
-				return "", fmt.Errorf("the resource path (%s) is not valid", resourcePath)
-			}
-
-			namespace, serviceName := service.Components()
-			files, err := kubernetes.FilesFor(resourcePath, namespace, serviceName)
-
-			if err != nil {
-				return "", errors.Wrapf(err, "finding resource definition file for %s", service)
-			}
-			if len(files) <= 0 { // fine; we'll just skip it
-				return fmt.Sprintf("no resource definition file found for %s; skipping", service), nil
-			}
-			if len(files) > 1 {
-				return "", fmt.Errorf("multiple resource definition files found for %s: %s", service, strings.Join(files, ", "))
-			}
-
-			def, err := ioutil.ReadFile(files[0]) // TODO(mb) not multi-doc safe
-			if err != nil {
-				return "", err
-			}
-			rc.PodControllers[service] = def
-			return "Found pod controller OK.", nil
-		},
+		Service:     service,
 	}
 }
 
@@ -368,76 +1197,18 @@ func (r *Releaser) releaseActionUpdatePodController(service flux.ServiceID, upda
 	actionList := strings.Join(actions, ", ")
 
 	return ReleaseAction{
-		Name:        "update_pod_controller",
+		Name:        ActionUpdatePodController,
 		Description: fmt.Sprintf("Update %d images(s) in the resource definition file for %s: %s.", len(updates), service, actionList),
-		Do: func(rc *ReleaseContext) (res string, err error) {
-			resourcePath := rc.RepoPath()
-			if fi, err := os.Stat(resourcePath); err != nil || !fi.IsDir() {
-				return "", fmt.Errorf("the resource path (%s) is not valid", resourcePath)
-			}
-
-			namespace, serviceName := service.Components()
-			files, err := kubernetes.FilesFor(resourcePath, namespace, serviceName)
-			if err != nil {
-				return "", errors.Wrapf(err, "finding resource definition file for %s", service)
-			}
-			if len(files) <= 0 {
-				return fmt.Sprintf("no resource definition file found for %s; skipping", service), nil
-			}
-			if len(files) > 1 {
-				return "", fmt.Errorf("multiple resource definition files found for %s: %s", service, strings.Join(files, ", "))
-			}
-
-			def, err := ioutil.ReadFile(files[0])
-			if err != nil {
-				return "", err
-			}
-			fi, err := os.Stat(files[0])
-			if err != nil {
-				return "", err
-			}
-
-			for _, update := range updates {
-				// Note 1: UpdatePodController parses the target (new) image
-				// name, extracts the repository, and only mutates the line(s)
-				// in the definition that match it. So for the time being we
-				// ignore the current image. UpdatePodController could be
-				// updated, if necessary.
-				//
-				// Note 2: we keep overwriting the same def, to handle multiple
-				// images in a single file.
-				def, err = kubernetes.UpdatePodController(def, string(update.Target), ioutil.Discard)
-				if err != nil {
-					return "", errors.Wrapf(err, "updating pod controller for %s", update.Target)
-				}
-			}
-
-			// Write the file back, so commit/push works.
-			if err := ioutil.WriteFile(files[0], def, fi.Mode()); err != nil {
-				return "", err
-			}
-
-			// Put the def in the map, so release works.
-			rc.PodControllers[service] = def
-			return "Update pod controller OK.", nil
-		},
+		Service:     service,
+		Updates:     updates,
 	}
 }
 
 func (r *Releaser) releaseActionCommitAndPush(msg string) ReleaseAction {
 	return ReleaseAction{
-		Name:        "commit_and_push",
+		Name:        ActionCommitAndPush,
 		Description: "Commit and push the config repo.",
-		Do: func(rc *ReleaseContext) (res string, err error) {
-			if fi, err := os.Stat(rc.WorkingDir); err != nil || !fi.IsDir() {
-				return "", fmt.Errorf("the repo path (%s) is not valid", rc.WorkingDir)
-			}
-			result, err := rc.CommitAndPush(msg)
-			if err == nil && result == "" {
-				return "Pushed commit: " + msg, nil
-			}
-			return result, err
-		},
+		Message:     msg,
 	}
 }
 
@@ -451,90 +1222,9 @@ func service2string(a []flux.ServiceID) []string {
 
 func (r *Releaser) releaseActionReleaseServices(services []flux.ServiceID, msg string) ReleaseAction {
 	return ReleaseAction{
-		Name:        "release_services",
+		Name:        ActionReleaseServices,
 		Description: fmt.Sprintf("Release %d service(s): %s.", len(services), strings.Join(service2string(services), ", ")),
-		Do: func(rc *ReleaseContext) (res string, err error) {
-			cause := strconv.Quote(msg)
-
-			// We'll collect results for each service release.
-			results := map[flux.ServiceID]error{}
-
-			// Collect definitions for each service release.
-			var defs []platform.ServiceDefinition
-			// If we're regrading our own image, we want to do that
-			// last, and "asynchronously" (meaning we probably won't
-			// see the reply).
-			var asyncDefs []platform.ServiceDefinition
-
-			for _, service := range services {
-				def, ok := rc.PodControllers[service]
-				if !ok {
-					results[service] = errors.New("no definition found; skipping release")
-					continue
-				}
-
-				namespace, serviceName := service.Components()
-				switch serviceName {
-				case FluxServiceName, FluxDaemonName:
-					rc.Instance.LogEvent(namespace, serviceName, "Starting "+cause+". (no result expected)")
-					asyncDefs = append(asyncDefs, platform.ServiceDefinition{
-						ServiceID:     service,
-						NewDefinition: def,
-					})
-				default:
-					rc.Instance.LogEvent(namespace, serviceName, "Starting "+cause)
-					defs = append(defs, platform.ServiceDefinition{
-						ServiceID:     service,
-						NewDefinition: def,
-					})
-				}
-			}
-
-			// Execute the releases as a single transaction.
-			// Splat any errors into our results map.
-			transactionErr := rc.Instance.PlatformApply(defs)
-			if transactionErr != nil {
-				switch err := transactionErr.(type) {
-				case platform.ApplyError:
-					for id, applyErr := range err {
-						results[id] = applyErr
-					}
-				default: // assume everything failed, if there was a coverall error
-					for _, service := range services {
-						results[service] = transactionErr
-					}
-				}
-			}
-
-			// Report individual service release results.
-			for _, service := range services {
-				namespace, serviceName := service.Components()
-				switch serviceName {
-				case FluxServiceName, FluxDaemonName:
-					continue
-				default:
-					if err := results[service]; err == nil { // no entry = nil error
-						rc.Instance.LogEvent(namespace, serviceName, msg+". done")
-					} else {
-						rc.Instance.LogEvent(namespace, serviceName, msg+". error: "+err.Error()+". failed")
-					}
-				}
-			}
-
-			// Lastly, services for which we don't expect a result
-			// (i.e., ourselves). This will kick off the release in
-			// the daemon, which will cause Kubernetes to restart the
-			// service. In the meantime, however, we will have
-			// finished recording what happened, as part of a graceful
-			// shutdown. So the only thing that goes missing is the
-			// result from this release call.
-			if len(asyncDefs) > 0 {
-				go func() {
-					rc.Instance.PlatformApply(asyncDefs)
-				}()
-			}
-
-			return "", transactionErr
-		},
+		Services:    services,
+		Message:     msg,
 	}
 }
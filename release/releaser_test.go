@@ -0,0 +1,80 @@
+package release
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+)
+
+type recordingUpdater struct {
+	nopUpdater
+	updates []jobs.Job
+}
+
+func (u *recordingUpdater) UpdateJob(job jobs.Job) error {
+	u.updates = append(u.updates, job)
+	return nil
+}
+
+func TestRecordCompleted(t *testing.T) {
+	job := &jobs.Job{Params: jobs.ReleaseJobParams{}}
+	updater := &recordingUpdater{}
+	for _, action := range []string{ActionClone, ActionUpdatePodController, ActionUpdatePodController, ActionCommitAndPush} {
+		pushed := ""
+		if action == ActionCommitAndPush {
+			pushed = "abc123"
+		}
+		if err := recordCompleted(job, updater, action, pushed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []string{ActionClone, ActionUpdatePodController, ActionCommitAndPush}
+	params := job.Params.(jobs.ReleaseJobParams)
+	if !reflect.DeepEqual(params.CompletedActions, expected) {
+		t.Errorf("expected %v recorded, got %v", expected, params.CompletedActions)
+	}
+	if params.PushedRevision != "abc123" {
+		t.Errorf("expected the revision pushed to be recorded, got %q", params.PushedRevision)
+	}
+	if len(updater.updates) != len(expected) {
+		t.Fatalf("expected the job to be saved each time an action was recorded, got %d saves", len(updater.updates))
+	}
+	if saved := updater.updates[len(updater.updates)-1].Params.(jobs.ReleaseJobParams).CompletedActions; !reflect.DeepEqual(saved, expected) {
+		t.Errorf("expected %v saved, got %v", expected, saved)
+	}
+}
+
+func TestResumePlan(t *testing.T) {
+	pushed := jobs.ReleaseJobParams{CompletedActions: []string{ActionClone, ActionCommitAndPush}}
+	if alreadyPushed(pushed) {
+		t.Error("expected a release with no revision recorded as pushed to be started again")
+	}
+	pushed.PushedRevision = "abc123"
+	if !alreadyPushed(pushed) {
+		t.Fatal("expected a release with a revision recorded as pushed to be resumed")
+	}
+
+	service := flux.MakeServiceID("default", "helloworld")
+	actions := resumePlan([]ReleaseAction{
+		{Name: ActionClone, Revision: "planned"},
+		{Name: ActionUpdatePodController, Service: service},
+		{Name: ActionCommitAndPush, Message: "Release"},
+		{Name: ActionReleaseServices, Services: []flux.ServiceID{service}},
+	}, pushed.PushedRevision)
+	if err := ValidatePlan(actions); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, action := range actions {
+		names = append(names, action.Name)
+	}
+	expected := []string{ActionClone, ActionFindPodController, ActionCheckPushed, ActionReleaseServices}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+	if actions[0].Revision != "" || actions[2].Revision != "abc123" {
+		t.Errorf("expected the commit pushed, rather than that planned against, to be checked for, got %+v", actions)
+	}
+}
@@ -0,0 +1,183 @@
+package release
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/weaveworks/flux"
+)
+
+// ErrNoPlan is returned for a release which has no plan to render.
+var ErrNoPlan = errors.New("the release has no plan; only dry-run releases keep theirs, once they have been planned")
+
+// ANSI colours for the rendered plan.
+const (
+	colourReset  = "\x1b[0m"
+	colourBold   = "\x1b[1m"
+	colourRed    = "\x1b[31m"
+	colourGreen  = "\x1b[32m"
+	colourYellow = "\x1b[33m"
+)
+
+// RenderPlan writes a plan as a summary for people at a terminal, in
+// the manner of `terraform plan`: each service changed, with the image
+// of each of its containers going (-) and coming (+), or changing (~);
+// then the other steps to be taken, and a count of the changes. If
+// colour is true, the symbols are coloured with ANSI escapes.
+func RenderPlan(w io.Writer, actions []ReleaseAction, colour bool) error {
+	r := planRenderer{colour: colour}
+	for _, action := range actions {
+		r.add(action)
+	}
+	return r.write(w)
+}
+
+type planRenderer struct {
+	colour bool
+
+	notes   []string
+	changes []string
+	steps   []string
+	skips   []string
+
+	updated, restarted, files int
+}
+
+func (r *planRenderer) add(action ReleaseAction) {
+	switch action.Name {
+	case ActionPrintf:
+		r.notes = append(r.notes, action.Description)
+	case ActionClone, ActionFindPodController:
+		// How the plan is carried out, rather than what it does.
+	case ActionUpdatePodController:
+		r.updated++
+		r.changes = append(r.changes, r.symbol("~")+" "+string(action.Service))
+		for _, update := range action.Updates {
+			r.changes = append(r.changes, r.containerChange(update)...)
+		}
+	case ActionRestartService:
+		r.restarted++
+		r.changes = append(r.changes, fmt.Sprintf("%s %s (restart)", r.symbol("~"), action.Service))
+	case ActionMigrateImages:
+		r.files++
+		line := fmt.Sprintf("%s %s", r.symbol("~"), action.File)
+		if m := action.Migration; m != nil {
+			line += fmt.Sprintf(" (images from %s to %s)", m.From, m.To)
+		}
+		r.changes = append(r.changes, line)
+		for _, l := range diffLines(action.Description) {
+			r.changes = append(r.changes, "    "+r.symbol(l[:1])+l[1:])
+		}
+	case ActionSkip:
+		what := string(action.Service)
+		if action.Container != "" {
+			what += " " + action.Container
+		}
+		reason := action.Reason
+		if reason == "" {
+			reason = action.Description
+		}
+		r.skips = append(r.skips, fmt.Sprintf("%s %s: %s", r.symbol("!"), what, reason))
+	default:
+		r.steps = append(r.steps, "* "+action.Description)
+	}
+}
+
+// containerChange gives the lines for the change of a container's
+// image.
+func (r *planRenderer) containerChange(update ContainerUpdate) []string {
+	switch {
+	case update.Current == update.Target:
+		return nil
+	case update.Current == (flux.ImageID{}):
+		return []string{fmt.Sprintf("    %s %s: %s", r.symbol("+"), update.Container, update.Target)}
+	default:
+		return []string{
+			fmt.Sprintf("    %s %s", r.symbol("~"), update.Container),
+			fmt.Sprintf("        %s %s", r.symbol("-"), update.Current),
+			fmt.Sprintf("        %s %s", r.symbol("+"), update.Target),
+		}
+	}
+}
+
+func (r *planRenderer) symbol(s string) string {
+	if !r.colour {
+		return s
+	}
+	switch s {
+	case "+":
+		return colourGreen + s + colourReset
+	case "-":
+		return colourRed + s + colourReset
+	case "~", "!":
+		return colourYellow + s + colourReset
+	}
+	return s
+}
+
+func (r *planRenderer) bold(s string) string {
+	if !r.colour {
+		return s
+	}
+	return colourBold + s + colourReset
+}
+
+func (r *planRenderer) write(w io.Writer) error {
+	var buf bytes.Buffer
+	for _, note := range r.notes {
+		fmt.Fprintln(&buf, note)
+	}
+	if len(r.notes) > 0 {
+		fmt.Fprintln(&buf)
+	}
+	if len(r.changes) == 0 {
+		fmt.Fprintln(&buf, r.bold("No changes."))
+	} else {
+		fmt.Fprintln(&buf, "The release will make these changes:")
+		fmt.Fprintln(&buf)
+		for _, line := range r.changes {
+			fmt.Fprintln(&buf, "  "+line)
+		}
+	}
+	if len(r.skips) > 0 {
+		fmt.Fprintln(&buf)
+		fmt.Fprintln(&buf, "Left out:")
+		fmt.Fprintln(&buf)
+		for _, line := range r.skips {
+			fmt.Fprintln(&buf, "  "+line)
+		}
+	}
+	if len(r.steps) > 0 {
+		fmt.Fprintln(&buf)
+		fmt.Fprintln(&buf, "Then:")
+		fmt.Fprintln(&buf)
+		for _, line := range r.steps {
+			fmt.Fprintln(&buf, "  "+line)
+		}
+	}
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, r.bold(fmt.Sprintf("Plan: %d to update, %d to restart, %d file(s) to change, %d left out.", r.updated, r.restarted, r.files, len(r.skips))))
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// diffLines gives the removed and added lines of the diff in a
+// description, as written by migrationDiff.
+func diffLines(description string) []string {
+	var lines []string
+	s := bufio.NewScanner(strings.NewReader(description))
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "---") || strings.HasPrefix(line, "+++") {
+			continue
+		}
+		if strings.HasPrefix(line, "-") || strings.HasPrefix(line, "+") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
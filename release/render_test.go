@@ -0,0 +1,78 @@
+package release
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/flux"
+)
+
+func mustParseImageID(t *testing.T, s string) flux.ImageID {
+	id, err := flux.ParseImageID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestRenderPlan(t *testing.T) {
+	plan := []ReleaseAction{
+		{Name: ActionPrintf, Description: "Release latest images to <all>"},
+		{Name: ActionClone, Description: "Clone the config repo."},
+		{Name: ActionFindPodController, Service: "default/helloworld"},
+		{Name: ActionSkip, Service: "default/locked", Reason: "locked", Description: "Skipping locked service default/locked."},
+		{Name: ActionUpdatePodController, Service: "default/helloworld", Updates: []ContainerUpdate{{
+			Container: "helloworld",
+			Current:   mustParseImageID(t, "quay.io/weaveworks/helloworld:master-a000001"),
+			Target:    mustParseImageID(t, "quay.io/weaveworks/helloworld:master-a000002"),
+		}}},
+		{Name: ActionRestartService, Service: "default/sidecar"},
+		{Name: ActionCommitAndPush, Description: "Commit and push the config repo."},
+	}
+	expected := `Release latest images to <all>
+
+The release will make these changes:
+
+  ~ default/helloworld
+      ~ helloworld
+          - quay.io/weaveworks/helloworld:master-a000001
+          + quay.io/weaveworks/helloworld:master-a000002
+  ~ default/sidecar (restart)
+
+Left out:
+
+  ! default/locked: locked
+
+Then:
+
+  * Commit and push the config repo.
+
+Plan: 1 to update, 1 to restart, 0 file(s) to change, 1 left out.
+`
+	var buf bytes.Buffer
+	if err := RenderPlan(&buf, plan, false); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := RenderPlan(&buf, plan, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), colourRed+"-"+colourReset+" quay.io/weaveworks/helloworld:master-a000001") {
+		t.Errorf("expected the image going to be coloured, got:\n%s", buf.String())
+	}
+}
+
+func TestRenderPlanNoChanges(t *testing.T) {
+	var buf bytes.Buffer
+	if err := RenderPlan(&buf, []ReleaseAction{{Name: ActionPrintf, Description: "All services up to date."}}, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "No changes.") {
+		t.Errorf("expected no changes, got:\n%s", buf.String())
+	}
+}
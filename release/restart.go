@@ -0,0 +1,157 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform/kubernetes"
+)
+
+// ActionRestartService marks the definition of a service, in the
+// config repo, as restarted, so that applying it replaces the pods
+// even though nothing else has changed.
+const ActionRestartService = "restart_service"
+
+// MinRestartInterval is the shortest a service may be scheduled to be
+// restarted every.
+const MinRestartInterval = time.Hour
+
+// releaseRestart plans a restart of the services selected: each
+// definition is applied as it is in the config repo, but for the
+// restart annotation, which is committed so the restart is on record.
+func (r *Releaser) releaseRestart(instID flux.InstanceID, method, msg string, inst *instance.Instance, getServices ServiceSelector) (res []ReleaseAction, err error) {
+	stages := r.newStageTimer(instID, method)
+	defer func() { stages.done(err) }()
+	stages.next("fetch_platform_services")
+
+	services, err := getServices.SelectServices(inst)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching platform services")
+	}
+	res = append(res, r.releaseActionsExpansion(getServices, services)...)
+	if len(services) == 0 {
+		res = append(res, r.releaseActionPrintf("No selected services found. Nothing to do."))
+		return res, nil
+	}
+
+	stages.next("finalize")
+
+	res = append(res, r.releaseActionPrintf(msg))
+	res = append(res, r.releaseActionClone())
+	var ids []flux.ServiceID
+	for _, service := range services {
+		res = append(res, ReleaseAction{
+			Name:        ActionRestartService,
+			Description: fmt.Sprintf("Mark pod controller for %q as restarted.", service.ID),
+			Service:     service.ID,
+		})
+		ids = append(ids, service.ID)
+	}
+	res = append(res, r.releaseActionCommitAndPush(msg))
+	res = append(res, r.releaseActionReleaseServices(ids, msg))
+	return res, nil
+}
+
+func restartMessage(services ServiceSelector) string {
+	return fmt.Sprintf("Restart %v", services)
+}
+
+func doRestartService(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	service := action.Service
+	resourcePath, err := rc.ServicePath(service)
+	if err != nil {
+		return "", err
+	}
+	files, err := rc.FilesFor(resourcePath, service)
+	if err != nil {
+		return "", errors.Wrapf(err, "finding resource definition file for %s", service)
+	}
+	if len(files) <= 0 {
+		return fmt.Sprintf("no resource definition file found for %s; skipping", service), nil
+	}
+	if len(files) > 1 {
+		return "", ambiguousDefinitionError(rc, map[flux.ServiceID][]string{service: files})
+	}
+
+	def, encrypted, err := kubernetes.ReadDefinition(files[0], rc.DecryptSOPS())
+	if err != nil {
+		return "", err
+	}
+	rc.SetOriginal(service, def)
+	fi, err := os.Stat(files[0])
+	if err != nil {
+		return "", err
+	}
+	def, err = kubernetes.SetRestartAnnotation(def, time.Now())
+	if err != nil {
+		return "", errors.Wrapf(err, "marking pod controller for %s as restarted", service)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := kubernetes.WriteDefinition(files[0], def, encrypted, fi.Mode()); err != nil {
+		return "", err
+	}
+	rc.SetPodController(service, def)
+	return "Marked pod controller as restarted.", nil
+}
+
+// RestartJob gives the job which restarts a service on schedule,
+// after the interval given. Each scheduled restart schedules the
+// next, for as long as the service's policy says to restart it.
+func RestartJob(instID flux.InstanceID, service flux.ServiceID, every time.Duration, now time.Time) jobs.Job {
+	return jobs.Job{
+		Queue: jobs.ReleaseJob,
+		// Only one restart of each service is scheduled at a time.
+		Key: strings.Join([]string{
+			jobs.ReleaseJob,
+			string(instID),
+			string(service),
+			"restart",
+		}, "|"),
+		Method:      jobs.ReleaseJob,
+		Priority:    jobs.PriorityBackground,
+		ScheduledAt: now.UTC().Add(every),
+		Params: jobs.ReleaseJobParams{
+			ServiceSpecs:     []flux.ServiceSpec{flux.ServiceSpec(service)},
+			Kind:             flux.ReleaseKindExecute,
+			Restart:          true,
+			ScheduledRestart: true,
+			User:             "scheduler",
+		},
+	}
+}
+
+// scheduledRestart says whether a scheduled restart is still wanted,
+// by the service's policy, and if so gives the job to restart it next
+// time.
+func scheduledRestart(instID flux.InstanceID, inst *instance.Instance, params jobs.ReleaseJobParams) (bool, []jobs.Job, error) {
+	if len(params.ServiceSpecs) != 1 {
+		return false, nil, errors.New("scheduled restart of other than one service")
+	}
+	service, err := flux.ParseServiceID(string(params.ServiceSpecs[0]))
+	if err != nil {
+		return false, nil, errors.Wrap(err, "parsing service of scheduled restart")
+	}
+	config, err := inst.GetConfig()
+	if err != nil {
+		return false, nil, errors.Wrap(err, "getting instance config")
+	}
+	every := config.Services[service].RestartEvery
+	if every == "" {
+		return false, nil, nil
+	}
+	interval, err := time.ParseDuration(every)
+	if err != nil {
+		return false, nil, errors.Wrapf(err, "parsing restart interval of %s", service)
+	}
+	return true, []jobs.Job{RestartJob(instID, service, interval, time.Now())}, nil
+}
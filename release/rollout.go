@@ -0,0 +1,89 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/platform"
+)
+
+// rolloutPollInterval is how often the platform is asked about the
+// services being rolled out.
+const rolloutPollInterval = 5 * time.Second
+
+// doWaitForRollout waits until the platform reports that each service
+// released is running the images it was updated to, with all its
+// replicas available. It gives up when the context is cancelled, i.e.,
+// when the action times out.
+func doWaitForRollout(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	rc.mu.Lock()
+	waiting := map[flux.ServiceID][]ContainerUpdate{}
+	for _, service := range action.Services {
+		waiting[service] = rc.Updates[service]
+	}
+	rc.mu.Unlock()
+
+	ticker := time.NewTicker(rolloutPollInterval)
+	defer ticker.Stop()
+	var pending []string
+	for {
+		var ids []flux.ServiceID
+		for id := range waiting {
+			ids = append(ids, id)
+		}
+		services, err := rc.Instance.GetServices(ids)
+		if err != nil {
+			return "", errors.Wrap(err, "getting services from platform")
+		}
+		pending = pending[:0]
+		for _, service := range services {
+			if done, why := rolledOut(service, waiting[service.ID]); done {
+				delete(waiting, service.ID)
+			} else {
+				pending = append(pending, fmt.Sprintf("%s (%s)", service.ID, why))
+			}
+		}
+		if len(waiting) == 0 {
+			return fmt.Sprintf("Rollout of %d service(s) complete.", len(action.Services)), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			sort.Strings(pending)
+			return "", fmt.Errorf("gave up waiting for rollout of: %s", strings.Join(pending, ", "))
+		case <-ticker.C:
+		}
+	}
+}
+
+// rolledOut says whether the service is running the images given,
+// with all the replicas it wants available; and if not, why not.
+// Platforms which don't report replicas are taken at their word about
+// the images.
+func rolledOut(service platform.Service, updates []ContainerUpdate) (bool, string) {
+	containers := service.ContainersOrNil()
+	for _, update := range updates {
+		found := false
+		for _, c := range containers {
+			if c.Name == update.Container {
+				found = c.Image == update.Target.String()
+				break
+			}
+		}
+		if !found {
+			return false, fmt.Sprintf("container %s not yet running %s", update.Container, update.Target)
+		}
+	}
+	if r := service.Replicas; r != nil {
+		if r.Available < r.Desired || r.Current != r.Desired {
+			return false, fmt.Sprintf("%d of %d replicas available, %d running", r.Available, r.Desired, r.Current)
+		}
+	}
+	return true, ""
+}
@@ -0,0 +1,283 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform"
+)
+
+// The kinds of release action for upgrading flux itself.
+const (
+	ActionUpgradeSelf  = "upgrade_self"
+	ActionVerifyDaemon = "verify_daemon"
+)
+
+// daemonPollInterval is how often the daemon is asked for its
+// version, when waiting for it to reconnect.
+const daemonPollInterval = 5 * time.Second
+
+// daemonApplyGrace is how long to wait for the daemon to refuse its
+// own upgrade outright, before leaving it to carry on.
+const daemonApplyGrace = 5 * time.Second
+
+// IsFluxService says whether the service is one of flux's own.
+func IsFluxService(id flux.ServiceID) bool {
+	switch _, name := id.Components(); name {
+	case FluxServiceName, FluxDaemonName:
+		return true
+	}
+	return false
+}
+
+// withSelfUpgrade takes flux's own services out of the release of the
+// other services. If self-upgrade isn't enabled, they're not released
+// at all; otherwise, they're released after everything else, the
+// service before the daemon, and the daemon is then expected to
+// reconnect.
+func withSelfUpgrade(actions []ReleaseAction, config *flux.SelfUpgradeConfig) []ReleaseAction {
+	self := map[flux.ServiceID]bool{}
+	for _, action := range actions {
+		if action.Name != ActionReleaseServices {
+			continue
+		}
+		for _, service := range action.Services {
+			if IsFluxService(service) {
+				self[service] = true
+			}
+		}
+	}
+	if len(self) == 0 {
+		return actions
+	}
+
+	var res []ReleaseAction
+	for _, action := range actions {
+		switch {
+		case action.Name == ActionUpdatePodController && self[action.Service] && config == nil:
+			continue
+		case action.Name == ActionReleaseServices:
+			var others, svc, daemon []flux.ServiceID
+			for _, service := range action.Services {
+				switch _, name := service.Components(); {
+				case !self[service]:
+					others = append(others, service)
+				case name == FluxServiceName:
+					svc = append(svc, service)
+				default:
+					daemon = append(daemon, service)
+				}
+			}
+			if len(others) > 0 {
+				action.Services = others
+				action.Description = fmt.Sprintf("Release %d service(s): %s.", len(others), strings.Join(service2string(others), ", "))
+				res = append(res, action)
+			}
+			if config == nil {
+				for _, service := range append(svc, daemon...) {
+					res = append(res, ReleaseAction{
+						Name:        ActionSkip,
+						Description: fmt.Sprintf("Skipping %s: flux's own services are only released if self-upgrade is enabled in the instance config.", service),
+						Service:     service,
+						Reason:      jobs.SkipSelfUpgradeDisabled,
+					})
+				}
+				continue
+			}
+			if len(svc) > 0 {
+				res = append(res, ReleaseAction{
+					Name:        ActionUpgradeSelf,
+					Description: fmt.Sprintf("Upgrade the flux service: %s.", strings.Join(service2string(svc), ", ")),
+					Services:    svc,
+					Message:     action.Message,
+				})
+			}
+			if len(daemon) > 0 {
+				res = append(res, ReleaseAction{
+					Name:        ActionUpgradeSelf,
+					Description: fmt.Sprintf("Upgrade the flux daemon: %s.", strings.Join(service2string(daemon), ", ")),
+					Services:    daemon,
+					Message:     action.Message,
+				}, ReleaseAction{
+					Name:        ActionVerifyDaemon,
+					Description: "Wait for the upgraded daemon to reconnect.",
+					Timeout:     config.ReconnectTimeout,
+				})
+			}
+		default:
+			res = append(res, action)
+		}
+	}
+	return res
+}
+
+// selfUpgradeRecord gives, for a plan which upgrades flux's own
+// services, the services, and a plan putting their definitions in the
+// config repo back as they were; or nil if the plan doesn't upgrade
+// flux. The rollback doesn't need the platform, since it's for when
+// the daemon can't be reached.
+func selfUpgradeRecord(actions []ReleaseAction) (*jobs.SelfUpgradeRecord, error) {
+	upgraded := map[flux.ServiceID]bool{}
+	var services []flux.ServiceID
+	for _, action := range actions {
+		if action.Name == ActionUpgradeSelf {
+			for _, service := range action.Services {
+				upgraded[service] = true
+				services = append(services, service)
+			}
+		}
+	}
+	if len(services) == 0 {
+		return nil, nil
+	}
+
+	msg := fmt.Sprintf("Roll back self-upgrade of %s", strings.Join(service2string(services), ", "))
+	rollback := []ReleaseAction{
+		{Name: ActionPrintf, Description: msg + "."},
+		{Name: ActionClone, Description: "Clone the config repo."},
+	}
+	for _, action := range actions {
+		if action.Name != ActionUpdatePodController || !upgraded[action.Service] {
+			continue
+		}
+		var updates []ContainerUpdate
+		for _, update := range action.Updates {
+			updates = append(updates, ContainerUpdate{
+				Container: update.Container,
+				Current:   update.Target,
+				Target:    update.Current,
+			})
+		}
+		rollback = append(rollback, ReleaseAction{
+			Name:        ActionUpdatePodController,
+			Description: fmt.Sprintf("Put back %d image(s) in the resource definition file for %s.", len(updates), action.Service),
+			Service:     action.Service,
+			Updates:     updates,
+		})
+	}
+	rollback = append(rollback, ReleaseAction{
+		Name:        ActionCommitAndPush,
+		Description: "Commit and push the config repo.",
+		Message:     msg,
+	})
+	plan, err := json.Marshal(rollback)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshaling self-upgrade rollback plan")
+	}
+	return &jobs.SelfUpgradeRecord{Services: services, Rollback: plan}, nil
+}
+
+// doUpgradeSelf releases flux's own services. The daemon applies its
+// own new definition, and is restarted in doing so, so there's no
+// result to wait for; the daemon's version beforehand is kept, to tell
+// when it's come back upgraded.
+func doUpgradeSelf(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	var (
+		defs     []platform.ServiceDefinition
+		isDaemon bool
+	)
+	rc.mu.Lock()
+	for _, service := range action.Services {
+		def, ok := rc.PodControllers[service]
+		if !ok {
+			continue
+		}
+		defs = append(defs, platform.ServiceDefinition{ServiceID: service, NewDefinition: def})
+		if _, name := service.Components(); name == FluxDaemonName {
+			isDaemon = true
+		}
+	}
+	rc.mu.Unlock()
+	if len(defs) == 0 {
+		return "No definitions found; nothing to upgrade.", nil
+	}
+
+	for _, def := range defs {
+		namespace, serviceName := def.ServiceID.Components()
+		rc.Instance.LogEvent(namespace, serviceName, "Starting self-upgrade: "+action.Message+". (no result expected)")
+	}
+	if !isDaemon {
+		if err := rc.Instance.WithContext(ctx).PlatformApply(defs); err != nil {
+			return "", errors.Wrap(err, "upgrading the flux service")
+		}
+		return fmt.Sprintf("Upgraded %d service(s).", len(defs)), nil
+	}
+
+	version, err := rc.Instance.Version()
+	if err != nil {
+		return "", errors.Wrap(err, "getting the daemon's version before upgrading it")
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	rc.mu.Lock()
+	rc.DaemonVersion = version
+	rc.mu.Unlock()
+	// The daemon is likely to go away before it replies, so the
+	// apply is left to finish in the background once it's had a
+	// moment to fail. Losing the connection to the daemon is expected;
+	// anything else means the upgrade didn't happen.
+	applied := make(chan error, 1)
+	go func() {
+		applied <- rc.Instance.PlatformApply(defs)
+	}()
+	select {
+	case err := <-applied:
+		if err != nil && !isDisconnect(err) {
+			return "", errors.Wrap(err, "upgrading the daemon")
+		}
+	case <-time.After(daemonApplyGrace):
+		go func() {
+			if err := <-applied; err != nil && !isDisconnect(err) {
+				rc.Instance.Log("service", FluxDaemonName, "err", errors.Wrap(err, "upgrading the daemon"))
+			}
+		}()
+	}
+	return fmt.Sprintf("Upgrading the daemon from version %s.", version), nil
+}
+
+// isDisconnect says whether the error is from losing the connection
+// to the daemon, as happens when it's replaced.
+func isDisconnect(err error) bool {
+	if _, ok := err.(platform.FatalError); ok {
+		return true
+	}
+	return err == platform.ErrPlatformNotAvailable
+}
+
+// doVerifyDaemon waits until the daemon is connected, and reports a
+// version other than that before it was upgraded. It gives up when
+// the context is cancelled, i.e., when the action times out.
+func doVerifyDaemon(ctx context.Context, rc *ReleaseContext, _ ReleaseAction) (string, error) {
+	rc.mu.Lock()
+	before := rc.DaemonVersion
+	rc.mu.Unlock()
+
+	ticker := time.NewTicker(daemonPollInterval)
+	defer ticker.Stop()
+	var lastErr error
+	for {
+		version, err := rc.Instance.Version()
+		switch {
+		case err != nil:
+			lastErr = err
+		case version != before:
+			return fmt.Sprintf("Daemon reconnected, at version %s.", version), nil
+		default:
+			lastErr = fmt.Errorf("daemon still reports version %s", version)
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", errors.Wrap(lastErr, "gave up waiting for the upgraded daemon to reconnect")
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/registry"
+)
+
+func selfUpgradePlan() []ReleaseAction {
+	svc := flux.MakeServiceID("flux", FluxServiceName)
+	daemon := flux.MakeServiceID("flux", FluxDaemonName)
+	app := flux.MakeServiceID("default", "helloworld")
+	daemonUpdate := ContainerUpdate{
+		Container: "fluxd",
+		Current:   flux.MakeImageID("quay.io", "weaveworks/fluxd", "0.1"),
+		Target:    flux.MakeImageID("quay.io", "weaveworks/fluxd", "0.2"),
+	}
+	return []ReleaseAction{
+		{Name: ActionClone},
+		{Name: ActionUpdatePodController, Service: app},
+		{Name: ActionUpdatePodController, Service: daemon, Updates: []ContainerUpdate{daemonUpdate}},
+		{Name: ActionUpdatePodController, Service: svc},
+		{Name: ActionCommitAndPush, Message: "Release"},
+		{Name: ActionReleaseServices, Services: []flux.ServiceID{daemon, app, svc}, Message: "Release"},
+	}
+}
+
+func actionNames(actions []ReleaseAction) []string {
+	var names []string
+	for _, action := range actions {
+		names = append(names, action.Name)
+	}
+	return names
+}
+
+func TestWithSelfUpgradeDisabled(t *testing.T) {
+	actions := withSelfUpgrade(selfUpgradePlan(), nil)
+	expected := []string{ActionClone, ActionUpdatePodController, ActionCommitAndPush, ActionReleaseServices, ActionSkip, ActionSkip}
+	if got := actionNames(actions); len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i, name := range expected {
+		if actions[i].Name != name {
+			t.Fatalf("expected %v, got %v", expected, actionNames(actions))
+		}
+	}
+	if services := actions[3].Services; len(services) != 1 || IsFluxService(services[0]) {
+		t.Errorf("expected only the application to be released, got %v", services)
+	}
+}
+
+func TestWithSelfUpgradeEnabled(t *testing.T) {
+	actions := withSelfUpgrade(selfUpgradePlan(), &flux.SelfUpgradeConfig{ReconnectTimeout: "2m"})
+	expected := []string{ActionClone, ActionUpdatePodController, ActionUpdatePodController, ActionUpdatePodController, ActionCommitAndPush, ActionReleaseServices, ActionUpgradeSelf, ActionUpgradeSelf, ActionVerifyDaemon}
+	if got := actionNames(actions); len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i, name := range expected {
+		if actions[i].Name != name {
+			t.Fatalf("expected %v, got %v", expected, actionNames(actions))
+		}
+	}
+	if _, name := actions[6].Services[0].Components(); name != FluxServiceName {
+		t.Errorf("expected the service to be upgraded before the daemon, got %v first", actions[6].Services)
+	}
+	if actions[8].Timeout != "2m" {
+		t.Errorf("expected reconnect timeout on verify action, got %q", actions[8].Timeout)
+	}
+	if err := ValidatePlan(actions); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSelfUpgradeRecord(t *testing.T) {
+	if record, err := selfUpgradeRecord(selfUpgradePlan()); err != nil || record != nil {
+		t.Fatalf("expected no record for plan without self-upgrade, got %v, %v", record, err)
+	}
+
+	record, err := selfUpgradeRecord(withSelfUpgrade(selfUpgradePlan(), &flux.SelfUpgradeConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record == nil || len(record.Services) != 2 {
+		t.Fatalf("expected record of both flux services, got %v", record)
+	}
+	var rollback []ReleaseAction
+	if err := json.Unmarshal(record.Rollback, &rollback); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidatePlan(rollback); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range rollback {
+		switch action.Name {
+		case ActionReleaseServices, ActionUpgradeSelf:
+			t.Errorf("expected rollback not to go to the platform, got %s action", action.Name)
+		case ActionUpdatePodController:
+			if !IsFluxService(action.Service) {
+				t.Errorf("expected only flux's services to be rolled back, got %s", action.Service)
+			}
+			for _, update := range action.Updates {
+				if update.Target.String() != "quay.io/weaveworks/fluxd:0.1" {
+					t.Errorf("expected rollback to previous image, got %s", update.Target)
+				}
+			}
+		}
+	}
+}
+
+func TestUpgradeDaemonFailures(t *testing.T) {
+	daemon := flux.MakeServiceID("flux", FluxDaemonName)
+	for _, c := range []struct {
+		applyErr error
+		ok       bool
+	}{
+		{nil, true},
+		{platform.FatalError{errors.New("connection lost")}, true},
+		{errors.New("forbidden"), false},
+	} {
+		fake := platform.NewFake()
+		fake.Fail("Apply", c.applyErr)
+		inst := instance.New(fake, registry.NewFake(), staticConfig{instance.MakeConfig()}, git.Repo{}, log.NewNopLogger(), nopHistogram{}, nopHistory{}, nopHistory{}, nopHistory{}, history.NopAnnotator{})
+		rc := NewReleaseContext(inst)
+		rc.SetPodController(daemon, []byte("definition"))
+
+		_, err := doUpgradeSelf(context.Background(), rc, ReleaseAction{Name: ActionUpgradeSelf, Services: []flux.ServiceID{daemon}, Message: "Upgrade"})
+		if c.ok && err != nil {
+			t.Errorf("apply failing with %v: expected the upgrade to carry on, got %v", c.applyErr, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("apply failing with %v: expected the upgrade to fail", c.applyErr)
+		}
+	}
+}
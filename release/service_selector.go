@@ -2,6 +2,7 @@ package release
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -27,18 +28,219 @@ func ServiceSelectorForSpecs(inst *instance.Instance, includeSpecs []flux.Servic
 	excludeSet.Add(locked)
 
 	include := flux.ServiceIDSet{}
+	var (
+		patterns []flux.ServiceSpec
+		using    []ServiceSelector
+	)
 	for _, spec := range includeSpecs {
 		if spec == flux.ServiceSpecAll {
 			// If one of the specs is '<all>' we can ignore the rest.
 			return AllServicesExcept(excludeSet), nil
 		}
+		if repo, ok := spec.UsingRepository(); ok {
+			// This is a selection in itself, so it's combined with
+			// whatever the other specs select.
+			using = append(using, ServicesUsingRepository(repo, excludeSet))
+			continue
+		}
+		if spec.IsPattern() {
+			patterns = append(patterns, spec)
+			continue
+		}
 		serviceID, err := flux.ParseServiceID(string(spec))
 		if err != nil {
 			return nil, errors.Wrapf(err, "parsing service ID from params %q", spec)
 		}
 		include.Add([]flux.ServiceID{serviceID})
 	}
-	return ExactlyTheseServices(include.Without(excludeSet)), nil
+
+	var selectors []ServiceSelector
+	switch {
+	case len(patterns) > 0:
+		matching, err := ServicesMatching(patterns, include, excludeSet)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, matching)
+	case len(include) > 0 || len(using) == 0:
+		selectors = append(selectors, ExactlyTheseServices(include.Without(excludeSet)))
+	}
+	selectors = append(selectors, using...)
+	if len(selectors) == 1 {
+		return selectors[0], nil
+	}
+	return AnyOfServices(selectors...), nil
+}
+
+// expandingSelector is a ServiceSelector that can explain which
+// services it selected, and why; e.g., what a pattern expanded to.
+type expandingSelector interface {
+	ServiceSelector
+	Expansion([]platform.Service) []string
+}
+
+type patternServiceQuery struct {
+	patterns []flux.ServiceSpec
+	matchers []func(flux.ServiceID) bool
+	include  flux.ServiceIDSet
+	exclude  flux.ServiceIDSet
+}
+
+// ServicesMatching selects the services matching any of the patterns
+// given, as well as those included exactly, less those excluded.
+func ServicesMatching(patterns []flux.ServiceSpec, include, exclude flux.ServiceIDSet) (ServiceSelector, error) {
+	q := patternServiceQuery{
+		patterns: patterns,
+		include:  include,
+		exclude:  exclude,
+	}
+	for _, p := range patterns {
+		m, err := p.Matcher()
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing service pattern %q", p)
+		}
+		q.matchers = append(q.matchers, m)
+	}
+	return q, nil
+}
+
+func (q patternServiceQuery) String() string {
+	var text []string
+	for _, p := range q.patterns {
+		text = append(text, string(p))
+	}
+	for id := range q.include {
+		text = append(text, string(id))
+	}
+	s := "services matching " + strings.Join(text, ", ")
+	if len(q.exclude) > 0 {
+		var idText []string
+		for id := range q.exclude {
+			idText = append(idText, string(id))
+		}
+		s += fmt.Sprintf(" (except: %s)", strings.Join(idText, ", "))
+	}
+	return s
+}
+
+func (q patternServiceQuery) SelectServices(inst *instance.Instance) ([]platform.Service, error) {
+	all, err := inst.GetAllServicesExcept("", q.exclude)
+	if err != nil {
+		return nil, err
+	}
+	var res []platform.Service
+	for _, service := range all {
+		if q.include.Contains(service.ID) {
+			res = append(res, service)
+			continue
+		}
+		for _, m := range q.matchers {
+			if m(service.ID) {
+				res = append(res, service)
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+// Expansion reports the services each pattern matched.
+func (q patternServiceQuery) Expansion(services []platform.Service) []string {
+	var res []string
+	for i, p := range q.patterns {
+		var matched []string
+		for _, service := range services {
+			if q.matchers[i](service.ID) {
+				matched = append(matched, string(service.ID))
+			}
+		}
+		if len(matched) == 0 {
+			res = append(res, fmt.Sprintf("Pattern %s matched no services.", p))
+			continue
+		}
+		sort.Strings(matched)
+		res = append(res, fmt.Sprintf("Pattern %s matched: %s", p, strings.Join(matched, ", ")))
+	}
+	return res
+}
+
+// ServicesUsingRepository selects the services with a container
+// running any tag of the image repository given, less those excluded.
+func ServicesUsingRepository(repository string, exclude flux.ServiceIDSet) ServiceSelector {
+	text := "services using " + repository
+	if len(exclude) > 0 {
+		var idText []string
+		for id := range exclude {
+			idText = append(idText, string(id))
+		}
+		text += fmt.Sprintf(" (except: %s)", strings.Join(idText, ", "))
+	}
+	return funcServiceQuery{
+		text: text,
+		f: func(h *instance.Instance) ([]platform.Service, error) {
+			all, err := h.GetAllServicesExcept("", exclude)
+			if err != nil {
+				return nil, err
+			}
+			var res []platform.Service
+			for _, service := range all {
+				for _, container := range service.ContainersOrNil() {
+					if id, err := flux.ParseImageID(container.Image); err == nil && id.Repository() == repository {
+						res = append(res, service)
+						break
+					}
+				}
+			}
+			return res, nil
+		},
+	}
+}
+
+type anyServiceQuery []ServiceSelector
+
+// AnyOfServices selects the services selected by any of the selectors
+// given.
+func AnyOfServices(selectors ...ServiceSelector) ServiceSelector {
+	return anyServiceQuery(selectors)
+}
+
+func (q anyServiceQuery) String() string {
+	var text []string
+	for _, s := range q {
+		text = append(text, s.String())
+	}
+	return strings.Join(text, " and ")
+}
+
+func (q anyServiceQuery) SelectServices(inst *instance.Instance) ([]platform.Service, error) {
+	seen := flux.ServiceIDSet{}
+	var res []platform.Service
+	for _, s := range q {
+		services, err := s.SelectServices(inst)
+		if err != nil {
+			return nil, err
+		}
+		for _, service := range services {
+			if seen.Contains(service.ID) {
+				continue
+			}
+			seen.Add([]flux.ServiceID{service.ID})
+			res = append(res, service)
+		}
+	}
+	return res, nil
+}
+
+// Expansion reports what each of the selectors that can explain
+// itself expanded to.
+func (q anyServiceQuery) Expansion(services []platform.Service) []string {
+	var res []string
+	for _, s := range q {
+		if e, ok := s.(expandingSelector); ok {
+			res = append(res, e.Expansion(services)...)
+		}
+	}
+	return res
 }
 
 type funcServiceQuery struct {
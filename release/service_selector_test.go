@@ -0,0 +1,132 @@
+package release
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/registry"
+)
+
+func selectorInstance(ids ...flux.ServiceID) *instance.Instance {
+	var services []platform.Service
+	for _, id := range ids {
+		services = append(services, platform.Service{ID: id})
+	}
+	return instance.New(platform.NewFake(services...), registry.NewFake(), staticConfig{instance.MakeConfig()}, git.Repo{}, log.NewNopLogger(), nopHistogram{}, nopHistory{}, nopHistory{}, nopHistory{}, history.NopAnnotator{})
+}
+
+func selectedIDs(t *testing.T, s ServiceSelector, inst *instance.Instance) []string {
+	services, err := s.SelectServices(inst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, service := range services {
+		ids = append(ids, string(service.ID))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestServicesMatching(t *testing.T) {
+	inst := selectorInstance("default/a", "default/b", "default/helloworld", "other/a", "other/helloworld")
+	for _, c := range []struct {
+		patterns []flux.ServiceSpec
+		include  []flux.ServiceID
+		exclude  []flux.ServiceID
+		expected []string
+	}{
+		{[]flux.ServiceSpec{"default/*"}, nil, nil, []string{"default/a", "default/b", "default/helloworld"}},
+		{[]flux.ServiceSpec{"*/a"}, nil, nil, []string{"default/a", "other/a"}},
+		{[]flux.ServiceSpec{"/world$/"}, nil, nil, []string{"default/helloworld", "other/helloworld"}},
+		// Services are selected if they match any pattern, or are
+		// included exactly
+		{[]flux.ServiceSpec{"*/a", "/world$/"}, []flux.ServiceID{"default/b"}, nil, []string{"default/a", "default/b", "default/helloworld", "other/a", "other/helloworld"}},
+		// Exclusions win over everything else
+		{[]flux.ServiceSpec{"default/*"}, []flux.ServiceID{"other/a"}, []flux.ServiceID{"default/b", "other/a"}, []string{"default/a", "default/helloworld"}},
+		{[]flux.ServiceSpec{"nowhere/*"}, nil, nil, nil},
+	} {
+		include, exclude := flux.ServiceIDSet{}, flux.ServiceIDSet{}
+		include.Add(c.include)
+		exclude.Add(c.exclude)
+		s, err := ServicesMatching(c.patterns, include, exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := selectedIDs(t, s, inst); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%v (include %v, exclude %v): expected %v, got %v", c.patterns, c.include, c.exclude, c.expected, got)
+		}
+	}
+}
+
+func TestServicesMatchingBadPattern(t *testing.T) {
+	for _, p := range []flux.ServiceSpec{"default/[a-", "/default/(a/"} {
+		if _, err := ServicesMatching([]flux.ServiceSpec{p}, flux.ServiceIDSet{}, flux.ServiceIDSet{}); err == nil {
+			t.Errorf("expected %q to be refused", p)
+		}
+	}
+}
+
+func TestServicesMatchingExpansion(t *testing.T) {
+	inst := selectorInstance("default/b", "default/a", "other/a")
+	s, err := ServicesMatching([]flux.ServiceSpec{"default/*", "/^other/", "nowhere/*"}, flux.ServiceIDSet{}, flux.ServiceIDSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	services, err := s.SelectServices(inst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"Pattern default/* matched: default/a, default/b",
+		"Pattern /^other/ matched: other/a",
+		"Pattern nowhere/* matched no services.",
+	}
+	if got := s.(expandingSelector).Expansion(services); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected expansion %q, got %q", expected, got)
+	}
+}
+
+func TestServiceSelectorForSpecsUsing(t *testing.T) {
+	running := func(id flux.ServiceID, image string) platform.Service {
+		return platform.Service{ID: id, Containers: platform.ContainersOrExcuse{Containers: []platform.Container{{Name: "main", Image: image}}}}
+	}
+	inst := instance.New(platform.NewFake(
+		running("default/a", "quay.io/weaveworks/helloworld:master-a000001"),
+		running("default/b", "quay.io/weaveworks/sidecar:master-a000001"),
+		running("other/a", "quay.io/weaveworks/helloworld:master-a000002"),
+		running("other/b", "quay.io/weaveworks/other:master-a000001"),
+		running("other/c", "quay.io/weaveworks/other:master-a000001"),
+	), registry.NewFake(), staticConfig{instance.MakeConfig()}, git.Repo{}, log.NewNopLogger(), nopHistogram{}, nopHistory{}, nopHistory{}, nopHistory{}, history.NopAnnotator{})
+
+	using := flux.ServiceSpecUsing("quay.io/weaveworks/helloworld")
+	for _, c := range []struct {
+		specs    []flux.ServiceSpec
+		exclude  []flux.ServiceID
+		expected []string
+	}{
+		{[]flux.ServiceSpec{using}, nil, []string{"default/a", "other/a"}},
+		// The services using the repository are selected as well as
+		// those the other specs select, not instead of them
+		{[]flux.ServiceSpec{using, "other/b"}, nil, []string{"default/a", "other/a", "other/b"}},
+		{[]flux.ServiceSpec{"default/*", using}, nil, []string{"default/a", "default/b", "other/a"}},
+		{[]flux.ServiceSpec{using, flux.ServiceSpecUsing("quay.io/weaveworks/sidecar")}, nil, []string{"default/a", "default/b", "other/a"}},
+		{[]flux.ServiceSpec{using, "other/b"}, []flux.ServiceID{"other/a", "other/b"}, []string{"default/a"}},
+	} {
+		s, err := ServiceSelectorForSpecs(inst, c.specs, c.exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := selectedIDs(t, s, inst); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%v (exclude %v): expected %v, got %v", c.specs, c.exclude, c.expected, got)
+		}
+	}
+}
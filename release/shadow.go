@@ -0,0 +1,114 @@
+package release
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+// Planner makes the plan for a release: its type, as it's labelled in
+// metrics, and its actions. Planning only reads, from the platform,
+// registry and config repo; it mustn't change anything.
+type Planner interface {
+	Plan(flux.InstanceID, *instance.Instance, jobs.ReleaseJobParams) (string, []ReleaseAction, error)
+}
+
+// PlannerFunc is a func used as a Planner.
+type PlannerFunc func(flux.InstanceID, *instance.Instance, jobs.ReleaseJobParams) (string, []ReleaseAction, error)
+
+func (f PlannerFunc) Plan(instID flux.InstanceID, inst *instance.Instance, params jobs.ReleaseJobParams) (string, []ReleaseAction, error) {
+	return f(instID, inst, params)
+}
+
+// ShadowPlanners are the planners which can be run in shadow, by
+// name. A new planner is added here while it's being tried out;
+// "current" is the releaser's own planner, run a second time, which
+// shows up any planning that isn't repeatable.
+var ShadowPlanners = map[string]func(*Releaser) Planner{
+	"current": func(r *Releaser) Planner { return PlannerFunc(r.plan) },
+}
+
+// Outcomes of shadow planning, as counted in metrics.
+const (
+	shadowSame    = "same"
+	shadowDiffers = "differs"
+	shadowError   = "error"
+)
+
+// ShadowPlanWith has each release planned again, in the background,
+// by the planner given, once it's been planned as usual. The plans
+// are compared, and any differences logged, but only the usual plan
+// is ever executed. This is for trying out a new planner on real
+// releases before switching to it.
+func (r *Releaser) ShadowPlanWith(p Planner, logger log.Logger) {
+	r.shadow = p
+	r.shadowLogger = logger
+}
+
+// shadowPlan plans the release with the shadow planner, if there is
+// one, and compares the plan with that made as usual. Releases which
+// failed to plan aren't planned again.
+func (r *Releaser) shadowPlan(job *jobs.Job, inst *instance.Instance, params jobs.ReleaseJobParams, releaseType string, actions []ReleaseAction) {
+	if r.shadow == nil {
+		return
+	}
+	logger := log.NewContext(r.shadowLogger).With("instance", job.Instance, "job", job.ID)
+	go func() {
+		outcome := shadowError
+		defer func() {
+			if p := recover(); p != nil {
+				logger.Log("err", fmt.Sprintf("shadow planner panicked: %v", p))
+				outcome = shadowError
+			}
+			r.metrics.ShadowPlans.With(
+				fluxmetrics.LabelInstanceID, r.metrics.Labels.Instance(string(job.Instance)),
+				fluxmetrics.LabelReleaseType, releaseType,
+				"outcome", outcome,
+			).Add(1)
+		}()
+
+		shadowType, shadowActions, err := r.shadow.Plan(job.Instance, inst, params)
+		if err != nil {
+			logger.Log("shadow", "error", "err", errors.Cause(err))
+			return
+		}
+		outcome = shadowSame
+		for _, diff := range comparePlans(releaseType, actions, shadowType, shadowActions) {
+			outcome = shadowDiffers
+			logger.Log("shadow", "differs", "difference", diff)
+		}
+	}()
+}
+
+// comparePlans describes how the shadow plan differs from the usual
+// one. The revision of the config repo, and results, are left out of
+// the comparison, since they can change between one plan and the
+// next without either planner being at fault.
+func comparePlans(releaseType string, actions []ReleaseAction, shadowType string, shadowActions []ReleaseAction) []string {
+	var diffs []string
+	if releaseType != shadowType {
+		diffs = append(diffs, fmt.Sprintf("release type: %s, shadow %s", releaseType, shadowType))
+	}
+	if len(actions) != len(shadowActions) {
+		diffs = append(diffs, fmt.Sprintf("number of actions: %d, shadow %d", len(actions), len(shadowActions)))
+	}
+	for i := 0; i < len(actions) && i < len(shadowActions); i++ {
+		a, s := withoutResults(actions[i]), withoutResults(shadowActions[i])
+		if !reflect.DeepEqual(a, s) {
+			diffs = append(diffs, fmt.Sprintf("action %d: %s %q, shadow %s %q", i, a.Name, a.Description, s.Name, s.Description))
+		}
+	}
+	return diffs
+}
+
+func withoutResults(a ReleaseAction) ReleaseAction {
+	a.Revision, a.Result = "", ""
+	return a
+}
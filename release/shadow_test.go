@@ -0,0 +1,25 @@
+package release
+
+import "testing"
+
+func TestComparePlans(t *testing.T) {
+	plan := func(rev string) []ReleaseAction {
+		return []ReleaseAction{
+			{Name: ActionClone, Description: "Clone the config repo.", Revision: rev},
+			{Name: ActionCommitAndPush, Description: "Commit and push the config repo.", Result: "done"},
+		}
+	}
+
+	// Revisions and results don't count
+	if diffs := comparePlans("release_one", plan("abc"), "release_one", plan("def")); len(diffs) != 0 {
+		t.Errorf("expected no differences, got %v", diffs)
+	}
+
+	shadow := plan("abc")
+	shadow[1].Description = "Commit the config repo."
+	shadow = append(shadow, ReleaseAction{Name: ActionCommitAndPush})
+	diffs := comparePlans("release_one", plan("abc"), "release_all", shadow)
+	if len(diffs) != 3 {
+		t.Errorf("expected release type, number of actions, and one action to differ, got %v", diffs)
+	}
+}
@@ -0,0 +1,52 @@
+package release
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/commitstatus"
+	"github.com/weaveworks/flux/instance"
+)
+
+// postCommitStatus posts a status to the commit of the config repo
+// applied by the release (that pushed, or else that cloned), if it
+// applied anything and the instance has commit statuses configured.
+// Failing to doesn't fail the release, which has happened anyway.
+func (r *Releaser) postCommitStatus(inst *instance.Instance, rc *ReleaseContext, updateJob func(string, ...interface{})) {
+	revision := rc.BaseRevision
+	if rc.Pushed && rc.Revision != "" {
+		revision = rc.Revision
+	}
+	if rc.Released.IsZero() || revision == "" {
+		return
+	}
+	config, err := inst.GetConfig()
+	if err != nil {
+		inst.Log("err", errors.Wrap(err, "getting instance config"))
+		return
+	}
+	statusConfig := config.Settings.CommitStatus
+	if statusConfig == nil {
+		return
+	}
+	poster, err := r.statuses(*statusConfig, inst.ConfigRepo().URL)
+	if err != nil {
+		updateJob("Posting the status of commit %.7s failed: %v", revision, err)
+		return
+	}
+	cluster := statusConfig.Cluster
+	if cluster == "" {
+		cluster = "cluster"
+	}
+	if err := poster.Post(commitstatus.Status{
+		Revision:    revision,
+		Context:     "flux/" + cluster,
+		Description: fmt.Sprintf("Applied to %s at %s", cluster, rc.Released.UTC().Format(time.RFC3339)),
+	}); err != nil {
+		updateJob("Posting the status of commit %.7s failed: %v", revision, err)
+		return
+	}
+	updateJob("Posted the status of commit %.7s.", revision)
+}
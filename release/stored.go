@@ -0,0 +1,105 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+)
+
+// PlanStore gets the planning releases whose plans are to be executed;
+// it's satisfied by jobs.JobStore.
+type PlanStore interface {
+	GetJob(flux.InstanceID, jobs.JobID) (jobs.Job, error)
+}
+
+// LoadPlansFrom has releases given a planning release (rather than
+// what to release) execute its plan, loaded from the store given. It's
+// for setting up the releaser, before it handles any jobs.
+func (r *Releaser) LoadPlansFrom(store PlanStore) {
+	r.plans = store
+}
+
+// storedPlan gives the plan made by the planning release given. Only
+// the plans of releases which finished planning successfully, against
+// the live platform, are given.
+func (r *Releaser) storedPlan(instID flux.InstanceID, id jobs.JobID) ([]ReleaseAction, error) {
+	if r.plans == nil {
+		return nil, errors.New("stored plans are not available")
+	}
+	job, err := r.plans.GetJob(instID, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting planning release %s", id)
+	}
+	params, ok := job.Params.(jobs.ReleaseJobParams)
+	switch {
+	case job.Method != jobs.ReleaseJob || !ok || params.Kind != flux.ReleaseKindPlan:
+		return nil, fmt.Errorf("job %s is not a planning release", id)
+	case !job.Done || !job.Success || len(params.Plan) == 0:
+		return nil, fmt.Errorf("release %s did not make a plan", id)
+	case params.Snapshot != nil:
+		return nil, fmt.Errorf("release %s was planned against a platform snapshot, so can't be executed", id)
+	}
+	var actions []ReleaseAction
+	if err := json.Unmarshal(params.Plan, &actions); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling stored plan")
+	}
+	if err := ValidatePlan(actions); err != nil {
+		return nil, errors.Wrap(err, "validating stored plan")
+	}
+	return actions, nil
+}
+
+// checkStoredPlan applies the policies and features which govern
+// planning to a plan made earlier, since they may have changed since:
+// locked services mustn't be changed, flux's own services may only be
+// released by self-upgrade (if it's enabled), resources are only
+// pruned if that's enabled, and releases are only rolled back when
+// alerts fire if that's enabled.
+func (r *Releaser) checkStoredPlan(inst *instance.Instance, actions []ReleaseAction) ([]ReleaseAction, error) {
+	config, err := inst.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting instance config")
+	}
+	res := make([]ReleaseAction, len(actions))
+	for i, action := range actions {
+		services := action.Services
+		if action.Service != "" {
+			services = append([]flux.ServiceID{action.Service}, services...)
+		}
+		switch action.Name {
+		case ActionUpdatePodController, ActionReleaseServices, ActionRestartService, ActionUpgradeSelf, ActionShiftTraffic, ActionMigrateImages:
+			for _, service := range services {
+				if config.Services[service].Locked {
+					return nil, fmt.Errorf("service %s is locked", service)
+				}
+			}
+		}
+		switch action.Name {
+		case ActionReleaseServices:
+			for _, service := range services {
+				if IsFluxService(service) {
+					return nil, fmt.Errorf("flux's own services are only released by self-upgrade, but %s is released with the others", service)
+				}
+			}
+		case ActionUpgradeSelf, ActionVerifyDaemon:
+			if config.Settings.SelfUpgrade == nil {
+				return nil, errors.New("the plan upgrades flux's own services, but self-upgrade is not enabled in the instance config")
+			}
+		case ActionApplyResources:
+			if action.PruneSelector != "" && !config.Settings.Features.Enabled(flux.FeaturePrune, r.features) {
+				return nil, errors.Errorf("pruning resources is not enabled for this instance (feature %q)", flux.FeaturePrune)
+			}
+		case ActionCheckAlerts:
+			if action.Rollback && !config.Settings.Features.Enabled(flux.FeatureAutoRollback, r.features) {
+				action.Rollback = false
+			}
+		}
+		res[i] = action
+	}
+	return res, nil
+}
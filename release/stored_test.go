@@ -0,0 +1,89 @@
+package release
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/registry"
+)
+
+type planStore map[jobs.JobID]jobs.Job
+
+func (s planStore) GetJob(_ flux.InstanceID, id jobs.JobID) (jobs.Job, error) {
+	job, ok := s[id]
+	if !ok {
+		return jobs.Job{}, jobs.ErrNoSuchJob
+	}
+	return job, nil
+}
+
+func TestStoredPlan(t *testing.T) {
+	plan, err := json.Marshal([]ReleaseAction{{Name: ActionPrintf, Description: "Nothing to do."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	planned := func(kind flux.ReleaseKind, done, success bool) jobs.Job {
+		return jobs.Job{
+			Method:  jobs.ReleaseJob,
+			Params:  jobs.ReleaseJobParams{Kind: kind, Plan: plan},
+			Done:    done,
+			Success: success,
+		}
+	}
+	r := &Releaser{}
+	r.LoadPlansFrom(planStore{
+		"planned":   planned(flux.ReleaseKindPlan, true, true),
+		"failed":    planned(flux.ReleaseKindPlan, true, false),
+		"planning":  planned(flux.ReleaseKindPlan, false, false),
+		"executing": planned(flux.ReleaseKindExecute, true, true),
+	})
+	if actions, err := r.storedPlan("inst", "planned"); err != nil || len(actions) != 1 {
+		t.Errorf("expected the plan of a successful planning release, got %v, %v", actions, err)
+	}
+	for _, id := range []jobs.JobID{"failed", "planning", "executing", "unknown"} {
+		if _, err := r.storedPlan("inst", id); err == nil {
+			t.Errorf("%s: expected no plan to be given", id)
+		}
+	}
+}
+
+func TestCheckStoredPlan(t *testing.T) {
+	app := flux.MakeServiceID("default", "helloworld")
+	locked := flux.MakeServiceID("default", "locked")
+	daemon := flux.MakeServiceID("flux", FluxDaemonName)
+	config := instance.MakeConfig()
+	config.Services[locked] = instance.ServiceConfig{Locked: true}
+	inst := instance.New(platform.NewFake(), registry.NewFake(), staticConfig{config}, git.Repo{}, log.NewNopLogger(), nopHistogram{}, nopHistory{}, nopHistory{}, nopHistory{}, history.NopAnnotator{})
+	r := &Releaser{features: flux.Features{}}
+
+	actions, err := r.checkStoredPlan(inst, []ReleaseAction{
+		{Name: ActionUpdatePodController, Service: app},
+		{Name: ActionReleaseServices, Services: []flux.ServiceID{app}},
+		{Name: ActionCheckAlerts, Services: []flux.ServiceID{app}, Window: "5m", Rollback: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actions[2].Rollback {
+		t.Error("expected rolling back on alerts to be turned off, since the feature isn't enabled")
+	}
+
+	for name, plan := range map[string][]ReleaseAction{
+		"locked service":                {{Name: ActionUpdatePodController, Service: locked}},
+		"flux released with the others": {{Name: ActionReleaseServices, Services: []flux.ServiceID{app, daemon}}},
+		"self-upgrade not enabled":      {{Name: ActionUpgradeSelf, Services: []flux.ServiceID{daemon}}},
+		"pruning not enabled":           {{Name: ActionApplyResources, PruneSelector: "app=helloworld"}},
+	} {
+		if _, err := r.checkStoredPlan(inst, plan); err == nil {
+			t.Errorf("%s: expected the plan to be refused", name)
+		}
+	}
+}
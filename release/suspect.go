@@ -0,0 +1,126 @@
+package release
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+)
+
+// Images are marked suspect for a service when a release of them to it
+// is rolled back: automatically, when the release fails part-way (or
+// alerts fire after it), or by hand, by releasing the image it
+// replaced. Suspect images are passed over when releasing the latest
+// images (and so by automation) until someone confirms them.
+const (
+	SuspectReleaseRolledBack = "release rolled back"
+	SuspectReleasedOver      = "replaced by the image it was released over"
+)
+
+// ErrNotSuspect is returned when confirming an image which isn't
+// suspect for the service.
+var ErrNotSuspect = errors.New("the image is not suspect for the service")
+
+// A release only counts as putting back the image it replaced if the
+// earlier release was no longer ago than this.
+const releasedOverWindow = 7 * 24 * time.Hour
+
+// markSuspect records the images as suspect for the service, and says
+// so in the service's history.
+func markSuspect(inst *instance.Instance, service flux.ServiceID, images []flux.ImageID, reason string, now time.Time) error {
+	if len(images) == 0 {
+		return nil
+	}
+	var marked []flux.ImageID
+	err := inst.UpdateConfig(func(conf instance.Config) (instance.Config, error) {
+		marked = nil
+		for _, image := range images {
+			if conf.MarkSuspect(service, flux.SuspectImage{Image: image, Reason: reason, Since: now}) {
+				marked = append(marked, image)
+			}
+		}
+		return conf, nil
+	})
+	if err != nil {
+		return err
+	}
+	namespace, serviceName := service.Components()
+	for _, image := range marked {
+		inst.LogEvent(namespace, serviceName, fmt.Sprintf("Image %s marked as suspect (%s); it won't be released as the latest until it's confirmed.", image, reason))
+	}
+	return nil
+}
+
+// markReleasedOver marks as suspect the images which the releases
+// given replaced with the images they were released over.
+func markReleasedOver(rc *ReleaseContext, released []flux.ImageRelease, now time.Time) {
+	byService := map[flux.ServiceID][]flux.ImageRelease{}
+	for _, r := range released {
+		byService[r.Service] = append(byService[r.Service], r)
+	}
+	for service, releases := range byService {
+		earlier, err := rc.Instance.Timeline(flux.TimelineQuery{Service: service, Since: now.Add(-releasedOverWindow)})
+		if err != nil {
+			rc.Instance.Log("service", service, "err", errors.Wrap(err, "fetching earlier releases"))
+			continue
+		}
+		if images := releasedOver(releases, earlier); len(images) > 0 {
+			if err := markSuspect(rc.Instance, service, images, SuspectReleasedOver, now); err != nil {
+				rc.Instance.Log("service", service, "err", errors.Wrap(err, "marking images as suspect"))
+			}
+		}
+	}
+}
+
+// releasedOver gives the images which the releases given put back the
+// images they replaced, going by the last release of each container
+// before them; e.g., someone releasing the image running before a bad
+// release, by hand.
+func releasedOver(releases []flux.ImageRelease, earlier []flux.ImageRelease) []flux.ImageID {
+	var res []flux.ImageID
+	for _, r := range releases {
+		if r.Failed {
+			continue
+		}
+		// The timeline is most recent first.
+		for _, e := range earlier {
+			if e.Container != r.Container || e.Failed {
+				continue
+			}
+			if e.To == r.From && e.From == r.To && e.From != e.To {
+				res = append(res, e.To)
+			}
+			break
+		}
+	}
+	return res
+}
+
+// ConfirmImage forgets that the image is suspect for the service, so
+// it may be released as the latest image again.
+func ConfirmImage(inst *instance.Instance, service flux.ServiceID, image flux.ImageID) error {
+	if err := inst.UpdateConfig(func(conf instance.Config) (instance.Config, error) {
+		if !conf.ConfirmImage(service, image) {
+			return conf, ErrNotSuspect
+		}
+		return conf, nil
+	}); err != nil {
+		return err
+	}
+	namespace, serviceName := service.Components()
+	inst.LogEvent(namespace, serviceName, fmt.Sprintf("Image %s confirmed; it may be released as the latest again.", image))
+	return nil
+}
+
+// suspectSkip gives a message, if the image is suspect for the
+// service.
+func suspectSkip(config instance.Config, service flux.ServiceID, image flux.ImageID) (string, bool) {
+	s, ok := config.SuspectImage(service, image)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("image %s has been suspect since %s (%s), and must be confirmed to be released", image, s.Since.Format(time.RFC3339), s.Reason), true
+}
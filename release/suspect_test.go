@@ -0,0 +1,76 @@
+package release
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform"
+)
+
+func TestReleasedOver(t *testing.T) {
+	service := flux.MakeServiceID("default", "helloworld")
+	good := mustParseImageID(t, "quay.io/weaveworks/helloworld:v1")
+	bad := mustParseImageID(t, "quay.io/weaveworks/helloworld:v2")
+	sidecar := mustParseImageID(t, "quay.io/weaveworks/sidecar:v1")
+	earlier := []flux.ImageRelease{
+		{Service: service, Container: "main", From: good, To: bad},
+		{Service: service, Container: "sidecar", From: sidecar, To: sidecar},
+		{Service: service, Container: "main", From: bad, To: good},
+	}
+
+	// Putting back the image replaced by the last release
+	if images := releasedOver([]flux.ImageRelease{{Service: service, Container: "main", From: bad, To: good}}, earlier); len(images) != 1 || images[0] != bad {
+		t.Errorf("expected %s to be released over, got %v", bad, images)
+	}
+	// Going forward, or failing to go back, doesn't count
+	for _, r := range []flux.ImageRelease{
+		{Service: service, Container: "main", From: bad, To: mustParseImageID(t, "quay.io/weaveworks/helloworld:v3")},
+		{Service: service, Container: "main", From: bad, To: good, Failed: true},
+		{Service: service, Container: "sidecar", From: sidecar, To: sidecar},
+	} {
+		if images := releasedOver([]flux.ImageRelease{r}, earlier); len(images) != 0 {
+			t.Errorf("expected nothing released over by %+v, got %v", r, images)
+		}
+	}
+}
+
+func TestCalculateUpdatesSuspect(t *testing.T) {
+	service := flux.MakeServiceID("default", "helloworld")
+	running := mustParseImageID(t, "quay.io/weaveworks/helloworld:v1")
+	latest := mustParseImageID(t, "quay.io/weaveworks/helloworld:v2")
+	images := instance.ImageMap{"quay.io/weaveworks/helloworld": {{ID: latest}}}
+	services := []platform.Service{
+		{ID: service, Containers: platform.ContainersOrExcuse{Containers: []platform.Container{{Name: "main", Image: running.String()}}}},
+	}
+
+	config := instance.MakeConfig()
+	if !config.MarkSuspect(service, flux.SuspectImage{Image: latest, Reason: SuspectReleaseRolledBack, Since: time.Now()}) {
+		t.Fatal("expected the image to be marked suspect")
+	}
+	if config.MarkSuspect(service, flux.SuspectImage{Image: latest, Reason: SuspectReleasedOver, Since: time.Now()}) {
+		t.Error("expected the image to be marked suspect only once")
+	}
+	var skips []jobs.Skip
+	updates := CalculateFilteredUpdates(services, images, config, func(s jobs.Skip, _ string, _ ...interface{}) {
+		skips = append(skips, s)
+	})
+	if len(updates) != 0 || len(skips) != 1 || skips[0].Reason != jobs.SkipImageSuspect {
+		t.Errorf("expected the suspect image to be skipped, got %+v and skips %+v", updates, skips)
+	}
+
+	if !config.ConfirmImage(service, latest) {
+		t.Fatal("expected the image to be confirmed")
+	}
+	if config.ConfirmImage(service, latest) {
+		t.Error("expected the image to be no longer suspect")
+	}
+	updates = CalculateFilteredUpdates(services, images, config, func(s jobs.Skip, _ string, _ ...interface{}) {
+		t.Errorf("expected no skips once the image is confirmed, got %+v", s)
+	})
+	if len(updates[service]) != 1 {
+		t.Errorf("expected an update once the image is confirmed, got %+v", updates)
+	}
+}
@@ -0,0 +1,95 @@
+package release
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+)
+
+// deployTagTime is how when a release was made is given in the names
+// of deploy tags; refs can't have colons in them.
+const deployTagTime = "2006-01-02T15-04-05"
+
+// tagRelease marks the commit of the config repo applied by the
+// release, as the instance's deploy tags say, if it applied anything
+// and it's a release of the services to be marked. Like commit
+// statuses, failing to doesn't fail the release.
+func (r *Releaser) tagRelease(inst *instance.Instance, rc *ReleaseContext, actions []ReleaseAction, updateJob func(string, ...interface{})) {
+	revision := rc.BaseRevision
+	if rc.Pushed && rc.Revision != "" {
+		revision = rc.Revision
+	}
+	if rc.Released.IsZero() || revision == "" {
+		return
+	}
+	config, err := inst.GetConfig()
+	if err != nil {
+		inst.Log("err", errors.Wrap(err, "getting instance config"))
+		return
+	}
+	tags := config.Settings.Git.DeployTags
+	if tags == nil {
+		return
+	}
+	services := actionServices(actions)
+	if ok, err := deployTagsApply(*tags, services); err != nil || !ok {
+		if err != nil {
+			updateJob("Tagging commit %.7s failed: %v", revision, err)
+		}
+		return
+	}
+
+	var name string
+	if tags.Prefix != "" {
+		name = tags.Prefix + rc.Released.UTC().Format(deployTagTime)
+	}
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "Release %s", rc.Job)
+	if rc.User != "" {
+		fmt.Fprintf(&message, ", requested by %s", rc.User)
+	}
+	fmt.Fprintf(&message, "\n\n")
+	for _, service := range services {
+		fmt.Fprintln(&message, service)
+	}
+	if err := inst.ConfigRepo().TagAndPush(rc.WorkingDir, revision, name, message.String(), tags.TagRef()); err != nil {
+		updateJob("Tagging commit %.7s failed: %v", revision, err)
+		return
+	}
+	switch {
+	case name != "" && tags.Ref != "":
+		updateJob("Tagged commit %.7s as %s, and moved %s to it.", revision, name, tags.TagRef())
+	case name != "":
+		updateJob("Tagged commit %.7s as %s.", revision, name)
+	default:
+		updateJob("Moved %s to commit %.7s.", tags.TagRef(), revision)
+	}
+}
+
+// deployTagsApply says whether a release of the services given is to
+// be marked, i.e., whether any of them are among the services given
+// in the config.
+func deployTagsApply(config flux.DeployTagsConfig, services []flux.ServiceID) (bool, error) {
+	if len(services) == 0 {
+		return false, nil
+	}
+	if len(config.Services) == 0 {
+		return true, nil
+	}
+	for _, spec := range config.Services {
+		match, err := spec.Matcher()
+		if err != nil {
+			return false, errors.Wrapf(err, "parsing service spec %q", spec)
+		}
+		for _, s := range services {
+			if match(s) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,44 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/weaveworks/flux"
+)
+
+func TestDeployTagsApply(t *testing.T) {
+	services := []flux.ServiceID{"default/frontend", "prod/api"}
+	for i, c := range []struct {
+		specs    []flux.ServiceSpec
+		services []flux.ServiceID
+		applies  bool
+	}{
+		{nil, services, true},
+		{nil, nil, false},
+		{[]flux.ServiceSpec{"prod/*"}, services, true},
+		{[]flux.ServiceSpec{"staging/*"}, services, false},
+	} {
+		applies, err := deployTagsApply(flux.DeployTagsConfig{Prefix: "deploy/", Services: c.specs}, c.services)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applies != c.applies {
+			t.Errorf("%d: expected %v, got %v", i, c.applies, applies)
+		}
+	}
+}
+
+func TestDeployTagsRef(t *testing.T) {
+	for ref, expected := range map[string]string{
+		"":                    "",
+		"deployed":            "refs/tags/deployed",
+		"refs/heads/deployed": "refs/heads/deployed",
+	} {
+		if got := (flux.DeployTagsConfig{Ref: ref}).TagRef(); got != expected {
+			t.Errorf("%q: expected %q, got %q", ref, expected, got)
+		}
+	}
+	if err := (flux.DeployTagsConfig{Prefix: "deploy/prod:"}).Validate(); err == nil {
+		t.Error("expected a prefix with a colon to be invalid")
+	}
+}
@@ -0,0 +1,149 @@
+package release
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/changes"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+)
+
+// How long a release waiting for its change ticket to be approved
+// waits before looking again.
+const ticketPollInterval = time.Minute
+
+type changeTicket struct {
+	system changes.System
+	id     string
+}
+
+// changeTicket opens a change ticket for a release, if the instance
+// keeps them and the release is of production services, unless one
+// was opened already. If the ticket has to be approved first, and
+// isn't yet, it gives a job to try the release again later, with the
+// plan as it is.
+func (r *Releaser) changeTicket(inst *instance.Instance, job *jobs.Job, actions []ReleaseAction, updateJob func(string, ...interface{})) (*changeTicket, *jobs.Job, error) {
+	config, err := inst.GetConfig()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "getting instance config")
+	}
+	ticketConfig := config.Settings.ChangeTickets
+	if ticketConfig == nil {
+		return nil, nil, nil
+	}
+	services := actionServices(actions)
+	if ok, err := changes.Applies(*ticketConfig, services); err != nil || !ok {
+		return nil, nil, err
+	}
+	system, err := r.tickets(*ticketConfig)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "change ticket config")
+	}
+
+	params := job.Params.(jobs.ReleaseJobParams)
+	if params.ChangeTicket == "" {
+		var description bytes.Buffer
+		for _, action := range actions {
+			fmt.Fprintln(&description, action.Description)
+		}
+		id, err := system.Open(changes.Change{
+			Instance:    job.Instance,
+			Release:     string(job.ID),
+			User:        params.User,
+			Services:    services,
+			Description: description.String(),
+		})
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "opening change ticket")
+		}
+		params.ChangeTicket = id
+		job.Params = params
+		updateJob("Opened change ticket %s.", id)
+	}
+	ticket := &changeTicket{system, params.ChangeTicket}
+	if !ticketConfig.RequireApproval {
+		return ticket, nil, nil
+	}
+
+	approval, err := system.Approval(ticket.id)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "checking approval of change ticket %s", ticket.id)
+	}
+	switch approval {
+	case changes.Approved:
+		updateJob("Change ticket %s is approved.", ticket.id)
+		return ticket, nil, nil
+	case changes.Rejected:
+		return nil, nil, fmt.Errorf("change ticket %s was rejected", ticket.id)
+	}
+
+	// Wait with the plan as it is, since that's what's in the ticket.
+	plan, err := json.Marshal(actions)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "marshaling plan")
+	}
+	params.Plan = plan
+	params.CompletedActions = nil
+	next := time.Now().UTC().Add(ticketPollInterval)
+	updateJob("Waiting for change ticket %s to be approved; looking again at %s.", ticket.id, next.Format(time.RFC3339))
+	return nil, &jobs.Job{
+		Queue: jobs.ReleaseJob,
+		// Key stops us getting two jobs waiting on the same ticket.
+		Key: strings.Join([]string{
+			jobs.ReleaseJob,
+			string(job.Instance),
+			"ticket",
+			ticket.id,
+		}, "|"),
+		Method:      jobs.ReleaseJob,
+		Priority:    job.Priority,
+		Params:      params,
+		ScheduledAt: next,
+	}, nil
+}
+
+// record adds the result of the release to the ticket. Failing to do
+// so doesn't fail the release, which has happened anyway.
+func (t *changeTicket) record(actions []ReleaseAction, releaseErr error, updateJob func(string, ...interface{})) {
+	var text bytes.Buffer
+	if releaseErr != nil {
+		fmt.Fprintf(&text, "Release failed: %v\n\n", releaseErr)
+	} else {
+		fmt.Fprint(&text, "Release succeeded.\n\n")
+	}
+	for _, action := range actions {
+		fmt.Fprintf(&text, "%s", action.Description)
+		if action.Result != "" {
+			fmt.Fprintf(&text, ": %s", action.Result)
+		}
+		fmt.Fprintln(&text)
+	}
+	if err := t.system.Comment(t.id, text.String()); err != nil {
+		updateJob("Recording the result in change ticket %s failed: %v", t.id, err)
+	}
+}
+
+// actionServices gives the services the actions update.
+func actionServices(actions []ReleaseAction) []flux.ServiceID {
+	var (
+		ids  []flux.ServiceID
+		seen = flux.ServiceIDSet{}
+	)
+	for _, action := range actions {
+		for _, id := range append([]flux.ServiceID{action.Service}, action.Services...) {
+			if id == "" || seen.Contains(id) {
+				continue
+			}
+			seen.Add([]flux.ServiceID{id})
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,129 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PlanStage names the planning of a release (which includes fetching
+// image metadata from registries) when giving timeouts.
+const PlanStage = "plan"
+
+// Timeouts gives the longest each kind of release action (or the
+// planning stage) may take. Kinds not mentioned get the default.
+type Timeouts map[string]time.Duration
+
+// DefaultTimeouts are used for anything not given a timeout
+// explicitly.
+var DefaultTimeouts = Timeouts{
+	PlanStage:                 5 * time.Minute,
+	ActionClone:               2 * time.Minute,
+	ActionFindPodController:   30 * time.Second,
+	ActionUpdatePodController: 30 * time.Second,
+	ActionRestartService:      30 * time.Second,
+	ActionMigrateImages:       30 * time.Second,
+	ActionCommitAndPush:       2 * time.Minute,
+	ActionReleaseServices:     10 * time.Minute,
+	ActionWaitForRollout:      10 * time.Minute,
+	ActionVerifyDaemon:        5 * time.Minute,
+}
+
+// fallbackTimeout is for things not in the defaults either.
+const fallbackTimeout = time.Minute
+
+func (t Timeouts) For(name string) time.Duration {
+	if d, ok := t[name]; ok {
+		return d
+	}
+	if d, ok := DefaultTimeouts[name]; ok {
+		return d
+	}
+	return fallbackTimeout
+}
+
+// ParseTimeouts parses timeouts given as "name=duration", e.g.,
+// "clone=5m".
+func ParseTimeouts(specs []string) (Timeouts, error) {
+	res := Timeouts{}
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("expected name=duration, got %q", spec)
+		}
+		if _, ok := actionTypes[parts[0]]; !ok && parts[0] != PlanStage {
+			return nil, errors.Errorf("unknown action %q in timeout %q", parts[0], spec)
+		}
+		d, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing timeout %q", spec)
+		}
+		res[parts[0]] = d
+	}
+	return res, nil
+}
+
+// timeoutError is returned by withTimeout when f didn't return in
+// time. Since f may yet finish what it was doing, what it did can't
+// safely be tried again or undone until it has returned; late gives
+// what it returned, once it has.
+type timeoutError struct {
+	name    string
+	timeout time.Duration
+	late    <-chan outcome
+}
+
+func (e timeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.name, e.timeout)
+}
+
+// outcome is what something run with withTimeout returned.
+type outcome struct {
+	result string
+	err    error
+}
+
+// isTimeout says whether err came from something that timed out, and
+// may still be running.
+func isTimeout(err error) bool {
+	_, ok := errors.Cause(err).(timeoutError)
+	return ok
+}
+
+// waitForTimedOut waits for whatever timed out, giving err, to return,
+// and gives what it returned. If err isn't from something timing out,
+// it's returned as it is.
+func waitForTimedOut(err error) (string, error) {
+	e, ok := errors.Cause(err).(timeoutError)
+	if !ok {
+		return "", err
+	}
+	o := <-e.late
+	return o.result, o.err
+}
+
+// withTimeout runs f, giving it a context which is cancelled after the
+// timeout for the name given. If f hasn't returned by then, a
+// timeoutError is returned straight away; f is left to notice the
+// cancellation in the background, and can be waited for with
+// waitForTimedOut.
+func withTimeout(timeouts Timeouts, name string, f func(context.Context) (string, error)) (string, error) {
+	timeout := timeouts.For(name)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := f(ctx)
+		done <- outcome{result, err}
+	}()
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-ctx.Done():
+		return "", timeoutError{name, timeout, done}
+	}
+}
@@ -0,0 +1,83 @@
+package release
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/registry"
+)
+
+func TestTimedOutActionNotRetried(t *testing.T) {
+	r := NewReleaser(nil, Metrics{ActionDuration: nopHistogram{}}, FailureRetry, Timeouts{ActionPrintf: 10 * time.Millisecond}, flux.DefaultFeatures)
+
+	// The action ignores its context, so it's still running once it's
+	// timed out.
+	var calls int32
+	stuck := make(chan struct{})
+	defer close(stuck)
+	r.UseActionMiddleware(func(next ActionRunner) ActionRunner {
+		return func(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+			atomic.AddInt32(&calls, 1)
+			<-stuck
+			return next(ctx, rc, action)
+		}
+	})
+
+	_, err := r.doWithRetries(NewReleaseContext(nil), ReleaseAction{Name: ActionPrintf}, func(string, ...interface{}) {})
+	if !isTimeout(err) {
+		t.Fatalf("expected the action to time out, got %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("expected the action to be tried once, got %d", n)
+	}
+}
+
+func TestWaitForTimedOut(t *testing.T) {
+	release := make(chan struct{})
+	_, err := withTimeout(Timeouts{"slow": time.Millisecond}, "slow", func(context.Context) (string, error) {
+		<-release
+		return "done late", nil
+	})
+	if !isTimeout(err) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	close(release)
+	result, err := waitForTimedOut(err)
+	if err != nil || result != "done late" {
+		t.Errorf("expected what was returned late, got %q, %v", result, err)
+	}
+}
+
+func TestExecuteWaitsForTimedOutAction(t *testing.T) {
+	r := NewReleaser(nil, Metrics{ActionDuration: nopHistogram{}}, FailureRollback, Timeouts{ActionPrintf: 10 * time.Millisecond}, flux.DefaultFeatures)
+	// The action notices it's been cancelled, but takes a while to
+	// stop.
+	var finished int32
+	r.UseActionMiddleware(func(next ActionRunner) ActionRunner {
+		return func(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+			<-ctx.Done()
+			time.Sleep(50 * time.Millisecond)
+			atomic.StoreInt32(&finished, 1)
+			return "", ctx.Err()
+		}
+	})
+
+	inst := instance.New(platform.NewFake(), registry.NewFake(), staticConfig{instance.MakeConfig()}, git.Repo{}, log.NewNopLogger(), nopHistogram{}, nopHistory{}, nopHistory{}, nopHistory{}, history.NopAnnotator{})
+	actions := []ReleaseAction{{Name: ActionPrintf, Description: "Slow.", Message: "slow"}}
+	err := r.execute(inst, "instance", "job", "user", actions, flux.ReleaseKindExecute, func(string, ...interface{}) {}, func(string, string) {})
+	if !isTimeout(err) {
+		t.Fatalf("expected the action to time out, got %v", err)
+	}
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Error("expected the release to wait for the timed out action to stop")
+	}
+}
@@ -0,0 +1,258 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/platform"
+)
+
+// How much longer than all its steps shifting traffic may take before
+// it's timed out.
+const trafficShiftGrace = 2 * time.Minute
+
+// withShiftTraffic puts an action to shift traffic to each canary
+// released, after the services are rolled out if the release waits
+// for that, or after they're released otherwise.
+func withShiftTraffic(actions []ReleaseAction, shifts []flux.TrafficShiftConfig) ([]ReleaseAction, error) {
+	after := -1
+	var released []flux.ServiceID
+	for i, action := range actions {
+		switch {
+		case action.Name == ActionReleaseServices && len(action.Services) > 0:
+			after, released = i, action.Services
+		case action.Name == ActionWaitForRollout && after >= 0:
+			after = i
+		}
+	}
+	if after < 0 {
+		return actions, nil
+	}
+
+	var shiftActions []ReleaseAction
+	for _, id := range released {
+		shift, ok := trafficShiftFor(shifts, id)
+		if !ok {
+			continue
+		}
+		interval, err := time.ParseDuration(shift.Interval)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing traffic shift interval for %s", id)
+		}
+		var steps []string
+		for _, step := range shift.Steps {
+			steps = append(steps, fmt.Sprintf("%d%%", step))
+		}
+		shiftActions = append(shiftActions, ReleaseAction{
+			Name:        ActionShiftTraffic,
+			Description: fmt.Sprintf("Shift traffic for %s to %s in steps of %s, every %s.", shift.Host, id, strings.Join(steps, ", "), interval),
+			Service:     id,
+			Timeout:     (time.Duration(len(shift.Steps))*interval + trafficShiftGrace).String(),
+		})
+	}
+	if len(shiftActions) == 0 {
+		return actions, nil
+	}
+	res := append([]ReleaseAction{}, actions[:after+1]...)
+	res = append(res, shiftActions...)
+	return append(res, actions[after+1:]...), nil
+}
+
+func trafficShiftFor(shifts []flux.TrafficShiftConfig, id flux.ServiceID) (flux.TrafficShiftConfig, bool) {
+	for _, shift := range shifts {
+		if shift.Service == id {
+			return shift, true
+		}
+	}
+	return flux.TrafficShiftConfig{}, false
+}
+
+func (rc *ReleaseContext) trafficShift(id flux.ServiceID) (flux.TrafficShiftConfig, bool, error) {
+	config, err := rc.Instance.GetConfig()
+	if err != nil {
+		return flux.TrafficShiftConfig{}, false, errors.Wrap(err, "getting instance config")
+	}
+	shift, ok := trafficShiftFor(config.Settings.TrafficShifts, id)
+	return shift, ok, nil
+}
+
+// doShiftTraffic sends the canary more traffic a step at a time,
+// checking the metric (if there is one) after each step. If the check
+// fails, all traffic goes back to the stable version, and the action
+// fails.
+func doShiftTraffic(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	shift, ok, err := rc.trafficShift(action.Service)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return fmt.Sprintf("Traffic is no longer shifted for %s; skipping.", action.Service), nil
+	}
+	interval, err := time.ParseDuration(shift.Interval)
+	if err != nil {
+		return "", errors.Wrap(err, "parsing interval")
+	}
+
+	for _, step := range shift.Steps {
+		if err := setTrafficWeight(ctx, rc, action.Service, shift, step); err != nil {
+			return "", err
+		}
+		select {
+		case <-ctx.Done():
+			return "", restoreTraffic(rc, action.Service, shift, ctx.Err())
+		case <-time.After(interval):
+		}
+		if shift.Check == nil {
+			continue
+		}
+		value, err := queryMetric(ctx, *shift.Check)
+		if err != nil {
+			return "", restoreTraffic(rc, action.Service, shift, errors.Wrap(err, "checking metric"))
+		}
+		if value > shift.Check.Max {
+			return "", restoreTraffic(rc, action.Service, shift, fmt.Errorf("with %d%% of traffic to %s, %s was %g, over the maximum of %g", step, action.Service, shift.Check.Query, value, shift.Check.Max))
+		}
+	}
+	return fmt.Sprintf("All traffic for %s is going to %s.", shift.Host, action.Service), nil
+}
+
+func undoShiftTraffic(ctx context.Context, rc *ReleaseContext, action ReleaseAction) (string, error) {
+	shift, ok, err := rc.trafficShift(action.Service)
+	if err != nil || !ok {
+		return "", err
+	}
+	if err := setTrafficWeight(ctx, rc, action.Service, shift, 0); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Sent all traffic for %s back to %s.", shift.Host, shift.Stable), nil
+}
+
+// restoreTraffic sends all traffic back to the stable version,
+// because of the error given, which it returns (along with any error
+// restoring traffic). It does so even if the shift has been abandoned,
+// so as not to leave the canary with traffic.
+func restoreTraffic(rc *ReleaseContext, id flux.ServiceID, shift flux.TrafficShiftConfig, cause error) error {
+	if err := setTrafficWeight(context.Background(), rc, id, shift, 0); err != nil {
+		return fmt.Errorf("%v; and sending traffic back to %s failed: %v", cause, shift.Stable, err)
+	}
+	return fmt.Errorf("%v; sent traffic back to %s", cause, shift.Stable)
+}
+
+// setTrafficWeight applies the routing resource sending the given
+// percentage of traffic to the canary, and the rest to the stable
+// version, unless ctx is done.
+func setTrafficWeight(ctx context.Context, rc *ReleaseContext, id flux.ServiceID, shift flux.TrafficShiftConfig, canary int) error {
+	namespace, _ := id.Components()
+	def, err := routingResource(namespace, shift, canary)
+	if err != nil {
+		return err
+	}
+	rc.Instance.LogEvent(namespace, shift.Host, fmt.Sprintf("Sending %d%% of traffic to %s", canary, shift.Canary))
+	return errors.Wrapf(rc.Instance.WithContext(ctx).PlatformApplyResources(platform.ResourceSet{
+		Definitions: []platform.ResourceDefinition{def},
+	}), "setting traffic weights for %s", shift.Host)
+}
+
+// routingResource gives the definition of the VirtualService (for
+// Istio) or TrafficSplit (for Linkerd) splitting traffic as given.
+func routingResource(namespace string, shift flux.TrafficShiftConfig, canary int) (platform.ResourceDefinition, error) {
+	type obj map[string]interface{}
+	metadata := obj{"name": shift.Host, "namespace": namespace}
+	var res obj
+	switch shift.Mesh {
+	case flux.MeshIstio:
+		destination := func(subset string, weight int) obj {
+			return obj{"destination": obj{"host": shift.Host, "subset": subset}, "weight": weight}
+		}
+		res = obj{
+			"apiVersion": "networking.istio.io/v1alpha3",
+			"kind":       "VirtualService",
+			"metadata":   metadata,
+			"spec": obj{
+				"hosts": []string{shift.Host},
+				"http": []obj{{
+					"route": []obj{destination(shift.Stable, 100-canary), destination(shift.Canary, canary)},
+				}},
+			},
+		}
+	case flux.MeshLinkerd:
+		res = obj{
+			"apiVersion": "split.smi-spec.io/v1alpha2",
+			"kind":       "TrafficSplit",
+			"metadata":   metadata,
+			"spec": obj{
+				"service": shift.Host,
+				"backends": []obj{
+					{"service": shift.Stable, "weight": 100 - canary},
+					{"service": shift.Canary, "weight": canary},
+				},
+			},
+		}
+	default:
+		return platform.ResourceDefinition{}, fmt.Errorf("unknown service mesh %q", shift.Mesh)
+	}
+	// JSON will do, for kubectl.
+	bytes, err := json.Marshal(res)
+	if err != nil {
+		return platform.ResourceDefinition{}, errors.Wrap(err, "marshaling routing resource")
+	}
+	kind := res["kind"].(string)
+	return platform.ResourceDefinition{
+		ID:         namespace + "/" + kind + "/" + shift.Host,
+		Kind:       kind,
+		Namespace:  namespace,
+		Definition: bytes,
+	}, nil
+}
+
+// queryMetric gives the value of the check's query, which should be a
+// scalar or a vector with a single sample.
+func queryMetric(ctx context.Context, check flux.MetricCheck) (float64, error) {
+	var resp struct {
+		Data struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	u := strings.TrimSuffix(check.PrometheusURL, "/") + "/api/v1/query?query=" + url.QueryEscape(check.Query)
+	if err := getJSON(ctx, u, &resp); err != nil {
+		return 0, err
+	}
+
+	var sample []interface{} // [ <time>, "<value>" ]
+	switch resp.Data.ResultType {
+	case "scalar":
+		if err := json.Unmarshal(resp.Data.Result, &sample); err != nil {
+			return 0, errors.Wrap(err, "decoding scalar")
+		}
+	case "vector":
+		var vector []struct {
+			Value []interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(resp.Data.Result, &vector); err != nil {
+			return 0, errors.Wrap(err, "decoding vector")
+		}
+		if len(vector) != 1 {
+			return 0, fmt.Errorf("expected one sample from %q, got %d", check.Query, len(vector))
+		}
+		sample = vector[0].Value
+	default:
+		return 0, fmt.Errorf("expected a scalar or vector from %q, got %s", check.Query, resp.Data.ResultType)
+	}
+	if len(sample) != 2 {
+		return 0, fmt.Errorf("unexpected sample from %q", check.Query)
+	}
+	value, ok := sample[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected sample value from %q", check.Query)
+	}
+	return strconv.ParseFloat(value, 64)
+}
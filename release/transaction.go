@@ -0,0 +1,81 @@
+package release
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FailurePolicy says what to do when a release action fails part-way
+// through a release, leaving (for example) changes pushed to the
+// config repo which haven't been applied to the platform.
+type FailurePolicy string
+
+const (
+	// FailureNone leaves things as they are, so they can be put right
+	// by hand (or by another release).
+	FailureNone FailurePolicy = "none"
+	// FailureRollback undoes the actions done so far, in reverse
+	// order.
+	FailureRollback FailurePolicy = "rollback"
+	// FailureRetry retries the failed action a few times, and rolls
+	// back if it still fails.
+	FailureRetry FailurePolicy = "retry"
+)
+
+const (
+	maxRetries   = 3
+	retryBackoff = 5 * time.Second
+)
+
+// ParseFailurePolicy returns the policy named, or an error.
+func ParseFailurePolicy(s string) (FailurePolicy, error) {
+	switch p := FailurePolicy(s); p {
+	case FailureNone, FailureRollback, FailureRetry:
+		return p, nil
+	}
+	return "", errors.Errorf("unknown failure policy %q; expected %q, %q or %q", s, FailureNone, FailureRollback, FailureRetry)
+}
+
+// transaction is the log of actions done in a release, so that they
+// can be compensated for if a later action fails.
+type transaction struct {
+	done []ReleaseAction
+}
+
+func (tx *transaction) record(action ReleaseAction) {
+	tx.done = append(tx.done, action)
+}
+
+// rollback undoes the actions recorded, most recent first. It carries
+// on past failures, so as to undo as much as possible.
+func (tx *transaction) rollback(rc *ReleaseContext, updateJob func(string, ...interface{})) {
+	for i := len(tx.done) - 1; i >= 0; i-- {
+		action := tx.done[i]
+		undo := actionTypes[action.Name].undo
+		if undo == nil {
+			continue
+		}
+		updateJob("Rolling back: %s", action.Description)
+		rc.running.Add(1)
+		result, err := withTimeout(nil, action.Name, func(ctx context.Context) (string, error) {
+			defer rc.running.Done()
+			return undo(ctx, rc, action)
+		})
+		if isTimeout(err) {
+			// The next undo mustn't race with this one.
+			updateJob("Rollback of %s timed out; waiting for it to stop.", action.Name)
+			result, err = waitForTimedOut(err)
+		}
+		if err != nil {
+			updateJob("Rollback of %s failed: %s", action.Name, err)
+			rc.Instance.Log("rollback", action.Name, "err", err)
+			continue
+		}
+		if result != "" {
+			updateJob(result)
+		}
+	}
+	tx.done = nil
+}
@@ -0,0 +1,127 @@
+package release
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/platform/kubernetes"
+)
+
+// UnmanagedResources compares the services running on the platform
+// with those defined in the config repo, and gives those which are
+// only in one or the other, with where to put the definitions of
+// those which are only running.
+func UnmanagedResources(inst *instance.Instance) ([]flux.UnmanagedResource, error) {
+	services, err := inst.GetAllServices("")
+	if err != nil {
+		return nil, errors.Wrap(err, "getting services from platform")
+	}
+	config, err := inst.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting instance config")
+	}
+
+	rc := NewReleaseContext(inst)
+	if err := rc.CloneRepo(inst.Context()); err != nil {
+		return nil, errors.Wrap(err, "cloning config repo")
+	}
+	defer rc.Clean()
+	root, err := rc.RepoPath()
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := rc.NamespaceDefaults()
+	if err != nil {
+		return nil, err
+	}
+	limits, err := rc.ScanLimits()
+	if err != nil {
+		return nil, err
+	}
+	index, err := kubernetes.IndexFiles(root, defaults, limits)
+	if err != nil {
+		return nil, errors.Wrap(err, "indexing config repo")
+	}
+	return compareManaged(index, services, config.Settings.Git)
+}
+
+// compareManaged gives the services in the index (of files, relative
+// to the config repo path) which aren't running, and the services
+// running which aren't in the index.
+func compareManaged(index kubernetes.FileIndex, services []platform.Service, git flux.GitConfig) ([]flux.UnmanagedResource, error) {
+	var res []flux.UnmanagedResource
+	running := map[string]bool{}
+	for _, service := range services {
+		running[string(service.ID)] = true
+		if len(index[string(service.ID)]) > 0 {
+			continue
+		}
+		path, err := suggestPath(index, service.ID, git)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, flux.UnmanagedResource{
+			Service:       service.ID,
+			Reason:        flux.UnmanagedNotInRepo,
+			SuggestedPath: path,
+		})
+	}
+	for id, files := range index {
+		if running[id] {
+			continue
+		}
+		res = append(res, flux.UnmanagedResource{
+			Service: flux.ServiceID(id),
+			Reason:  flux.UnmanagedNotRunning,
+			Files:   files,
+		})
+	}
+	sort.Sort(unmanagedByService(res))
+	return res, nil
+}
+
+type unmanagedByService []flux.UnmanagedResource
+
+func (u unmanagedByService) Len() int           { return len(u) }
+func (u unmanagedByService) Less(i, j int) bool { return u[i].Service < u[j].Service }
+func (u unmanagedByService) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+
+// suggestPath gives a file, relative to the config repo path, for
+// the definition of a service. It's in the directory holding most of
+// the definitions of other services in the same namespace (and
+// within the service's own path, if it has one), or else in a
+// directory named for the namespace.
+func suggestPath(index kubernetes.FileIndex, service flux.ServiceID, git flux.GitConfig) (string, error) {
+	sub, err := git.PathFor(service)
+	if err != nil {
+		return "", err
+	}
+	namespace, name := service.Components()
+	dirs := map[string]int{}
+	for id, files := range index {
+		if ns, _ := flux.ServiceID(id).Components(); ns != namespace {
+			continue
+		}
+		for _, file := range files {
+			dir := filepath.Dir(file)
+			if sub != "" && dir != filepath.Clean(sub) && !strings.HasPrefix(dir, filepath.Clean(sub)+string(filepath.Separator)) {
+				continue
+			}
+			dirs[dir]++
+		}
+	}
+	best := filepath.Join(sub, namespace)
+	most := 0
+	for dir, n := range dirs {
+		if n > most || (n == most && dir < best) {
+			best, most = dir, n
+		}
+	}
+	return filepath.Join(best, name+".yaml"), nil
+}
@@ -0,0 +1,41 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/platform/kubernetes"
+)
+
+func TestCompareManaged(t *testing.T) {
+	index := kubernetes.FileIndex{
+		"default/helloworld": {"apps/default/helloworld.yaml"},
+		"default/old":        {"apps/default/old.yaml"},
+		"prod/api":           {"prod/api.yaml"},
+	}
+	services := []platform.Service{
+		{ID: "default/helloworld"},
+		{ID: "default/new"},
+		{ID: "prod/api"},
+		{ID: "staging/api"},
+	}
+	got, err := compareManaged(index, services, flux.GitConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []flux.UnmanagedResource{
+		{Service: "default/new", Reason: flux.UnmanagedNotInRepo, SuggestedPath: "apps/default/new.yaml"},
+		{Service: "default/old", Reason: flux.UnmanagedNotRunning, Files: []string{"apps/default/old.yaml"}},
+		{Service: "staging/api", Reason: flux.UnmanagedNotInRepo, SuggestedPath: "staging/api.yaml"},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+	for i := range expected {
+		e, g := expected[i], got[i]
+		if e.Service != g.Service || e.Reason != g.Reason || e.SuggestedPath != g.SuggestedPath || len(e.Files) != len(g.Files) {
+			t.Errorf("%d: expected %+v, got %+v", i, e, g)
+		}
+	}
+}
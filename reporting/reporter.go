@@ -0,0 +1,129 @@
+package reporting
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/instance"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+const LabelService = "service"
+
+type Metrics struct {
+	DeploymentsPerDay metrics.Gauge
+	LeadTime          metrics.Gauge
+	ChangeFailureRate metrics.Gauge
+	// How to report the instance and service labels. If they're
+	// hashed or aggregated, the figures are for all the instances
+	// (or services) given the same label.
+	Labels fluxmetrics.LabelPolicy
+}
+
+func NewMetrics() Metrics {
+	labels := []string{fluxmetrics.LabelInstanceID, LabelService}
+	return Metrics{
+		DeploymentsPerDay: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "flux",
+			Subsystem: "deployments",
+			Name:      "per_day",
+			Help:      "Deployments per day over the reporting window, per instance and service (the instance as a whole has an empty service).",
+		}, labels),
+		LeadTime: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "flux",
+			Subsystem: "deployments",
+			Name:      "lead_time_seconds",
+			Help:      "Mean time in seconds from an image being built to it being released, over the reporting window.",
+		}, labels),
+		ChangeFailureRate: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "flux",
+			Subsystem: "deployments",
+			Name:      "change_failure_rate",
+			Help:      "Proportion of deployments which failed, over the reporting window.",
+		}, labels),
+	}
+}
+
+// Reporter periodically computes the deployment metrics for every
+// instance, and reports them to Prometheus.
+type Reporter struct {
+	instances instance.DB
+	history   history.DB
+	window    time.Duration
+	metrics   Metrics
+	logger    log.Logger
+}
+
+func NewReporter(instances instance.DB, history history.DB, window time.Duration, metrics Metrics, logger log.Logger) *Reporter {
+	return &Reporter{
+		instances: instances,
+		history:   history,
+		window:    window,
+		metrics:   metrics,
+		logger:    logger,
+	}
+}
+
+// Report computes and reports metrics each time the ticker ticks.
+func (r *Reporter) Report(tick <-chan time.Time) {
+	for now := range tick {
+		if err := r.report(now); err != nil {
+			r.logger.Log("err", err)
+		}
+	}
+}
+
+func (r *Reporter) report(now time.Time) error {
+	configs, err := r.instances.All()
+	if err != nil {
+		return err
+	}
+	since := now.Add(-r.window)
+	// Instances (and services) may share labels, so the releases are
+	// tallied for each set of labels, rather than each instance.
+	tallies := map[series]*tally{}
+	tallyFor := func(s series) *tally {
+		t, ok := tallies[s]
+		if !ok {
+			t = &tally{}
+			tallies[s] = t
+		}
+		return t
+	}
+	for _, c := range configs {
+		releases, err := r.history.Timeline(c.ID, flux.TimelineQuery{Since: since, Until: now})
+		if err != nil {
+			r.logger.Log("instance", c.ID, "err", err)
+			continue
+		}
+		inst := r.metrics.Labels.Instance(string(c.ID))
+		whole := tallyFor(series{inst, ""})
+		for _, rel := range releases {
+			whole.add(c.ID, rel)
+			tallyFor(series{inst, r.metrics.Labels.Service(string(rel.Service))}).add(c.ID, rel)
+		}
+	}
+	days := now.Sub(since).Hours() / 24
+	for s, t := range tallies {
+		r.set(s, t.metrics("", days))
+	}
+	return nil
+}
+
+// series is the labels a set of deployment metrics is reported with.
+type series struct {
+	instance, service string
+}
+
+func (r *Reporter) set(s series, m flux.DeploymentMetrics) {
+	labels := []string{fluxmetrics.LabelInstanceID, s.instance, LabelService, s.service}
+	r.metrics.DeploymentsPerDay.With(labels...).Set(m.DeploymentsPerDay)
+	r.metrics.LeadTime.With(labels...).Set(m.MeanLeadTimeSeconds)
+	r.metrics.ChangeFailureRate.With(labels...).Set(m.ChangeFailureRate)
+}
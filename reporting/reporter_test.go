@@ -0,0 +1,103 @@
+package reporting
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/instance"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+// recordingGauge keeps the value set for each set of labels.
+type recordingGauge struct {
+	mu     *sync.Mutex
+	values map[string]float64
+	labels []string
+}
+
+func newRecordingGauge() recordingGauge {
+	return recordingGauge{mu: &sync.Mutex{}, values: map[string]float64{}}
+}
+
+func (g recordingGauge) With(labels ...string) metrics.Gauge {
+	return recordingGauge{g.mu, g.values, append(append([]string{}, g.labels...), labels...)}
+}
+
+func (g recordingGauge) Set(value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[strings.Join(g.labels, ",")] = value
+}
+
+func (g recordingGauge) Add(delta float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[strings.Join(g.labels, ",")] += delta
+}
+
+type staticInstances struct {
+	instance.DB
+	ids []flux.InstanceID
+}
+
+func (db staticInstances) All() ([]instance.NamedConfig, error) {
+	var res []instance.NamedConfig
+	for _, id := range db.ids {
+		res = append(res, instance.NamedConfig{ID: id, Config: instance.MakeConfig()})
+	}
+	return res, nil
+}
+
+type staticTimeline struct {
+	history.DB
+	releases map[flux.InstanceID][]flux.ImageRelease
+}
+
+func (db staticTimeline) Timeline(inst flux.InstanceID, _ flux.TimelineQuery) ([]flux.ImageRelease, error) {
+	return db.releases[inst], nil
+}
+
+func TestReportSharedLabels(t *testing.T) {
+	now := time.Now()
+	service := flux.MakeServiceID("default", "helloworld")
+	// Both instances release the same service at the same time, so
+	// it's clear whether they're counted separately.
+	timeline := staticTimeline{releases: map[flux.InstanceID][]flux.ImageRelease{
+		"inst-1": {{Service: service, Stamp: now.Add(-time.Hour)}},
+		"inst-2": {{Service: service, Stamp: now.Add(-time.Hour), Failed: true}},
+	}}
+	gauges := map[string]recordingGauge{"per_day": newRecordingGauge(), "failure_rate": newRecordingGauge()}
+	m := Metrics{
+		DeploymentsPerDay: gauges["per_day"],
+		LeadTime:          newRecordingGauge(),
+		ChangeFailureRate: gauges["failure_rate"],
+		Labels:            fluxmetrics.LabelPolicy{InstanceID: fluxmetrics.CardinalityAggregate, ServiceID: fluxmetrics.CardinalityAggregate},
+	}
+	r := NewReporter(staticInstances{ids: []flux.InstanceID{"inst-1", "inst-2"}}, timeline, 24*time.Hour, m, log.NewNopLogger())
+	if err := r.report(now); err != nil {
+		t.Fatal(err)
+	}
+
+	all := fluxmetrics.AggregateValue
+	for labels, expected := range map[string]float64{
+		fluxmetrics.LabelInstanceID + "," + all + "," + LabelService + ",":       2,
+		fluxmetrics.LabelInstanceID + "," + all + "," + LabelService + "," + all: 2,
+	} {
+		if got := gauges["per_day"].values[labels]; got != expected {
+			t.Errorf("expected %g deployments per day for %s, got %g", expected, labels, got)
+		}
+		if got := gauges["failure_rate"].values[labels]; got != 0.5 {
+			t.Errorf("expected a change failure rate of 0.5 for %s, got %g", labels, got)
+		}
+	}
+	if len(gauges["per_day"].values) != 2 {
+		t.Errorf("expected only the aggregated series, got %v", gauges["per_day"].values)
+	}
+}
@@ -0,0 +1,102 @@
+// Package reporting computes delivery performance metrics (the
+// so-called DORA metrics) from the releases recorded in history:
+// deployment frequency, lead time for changes, and change failure
+// rate.
+package reporting
+
+import (
+	"sort"
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+// Compute summarises the releases given, which are assumed to fall
+// between since and until.
+//
+// A deployment is a release to a service, however many of its
+// containers it changed; it failed if any of them did. Lead time is
+// measured for each image successfully released whose build time is
+// known.
+func Compute(releases []flux.ImageRelease, since, until time.Time) flux.DeploymentReport {
+	report := flux.DeploymentReport{
+		Since: since,
+		Until: until,
+	}
+	days := until.Sub(since).Hours() / 24
+
+	all := &tally{}
+	byService := map[flux.ServiceID]*tally{}
+	for _, r := range releases {
+		t, ok := byService[r.Service]
+		if !ok {
+			t = &tally{}
+			byService[r.Service] = t
+		}
+		t.add("", r)
+		all.add("", r)
+	}
+
+	report.Instance = all.metrics("", days)
+	for service, t := range byService {
+		report.Services = append(report.Services, t.metrics(service, days))
+	}
+	sort.Sort(byServiceID(report.Services))
+	return report
+}
+
+type tally struct {
+	deployments map[deployment]bool // -> failed
+	leadTime    time.Duration
+	leadTimes   int
+}
+
+// deployment identifies the releases made together to a service (of
+// an instance, when tallying more than one). Releases are recorded
+// together, but the timestamps may differ slightly, so they are
+// compared to the second.
+type deployment struct {
+	instance flux.InstanceID
+	service  flux.ServiceID
+	stamp    time.Time
+}
+
+func (t *tally) add(inst flux.InstanceID, r flux.ImageRelease) {
+	if t.deployments == nil {
+		t.deployments = map[deployment]bool{}
+	}
+	d := deployment{inst, r.Service, r.Stamp.Truncate(time.Second)}
+	t.deployments[d] = t.deployments[d] || r.Failed
+	if !r.Failed && r.ToCreatedAt != nil && r.Stamp.After(*r.ToCreatedAt) {
+		t.leadTime += r.Stamp.Sub(*r.ToCreatedAt)
+		t.leadTimes++
+	}
+}
+
+func (t *tally) metrics(service flux.ServiceID, days float64) flux.DeploymentMetrics {
+	m := flux.DeploymentMetrics{
+		Service:     service,
+		Deployments: len(t.deployments),
+	}
+	for _, failed := range t.deployments {
+		if failed {
+			m.Failures++
+		}
+	}
+	if days > 0 {
+		m.DeploymentsPerDay = float64(m.Deployments) / days
+	}
+	if m.Deployments > 0 {
+		m.ChangeFailureRate = float64(m.Failures) / float64(m.Deployments)
+	}
+	if t.leadTimes > 0 {
+		m.MeanLeadTimeSeconds = (t.leadTime / time.Duration(t.leadTimes)).Seconds()
+	}
+	return m
+}
+
+type byServiceID []flux.DeploymentMetrics
+
+func (s byServiceID) Len() int           { return len(s) }
+func (s byServiceID) Less(i, j int) bool { return s[i].Service < s[j].Service }
+func (s byServiceID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
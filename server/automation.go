@@ -0,0 +1,19 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/automator"
+)
+
+// ExplainAutomation says what automation would do for the instance if
+// it ran now, without releasing anything; e.g., to find out why a new
+// image isn't being released.
+func (s *Server) ExplainAutomation(instID flux.InstanceID) ([]flux.AutomationCheck, error) {
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting instance")
+	}
+	return automator.Explain(inst)
+}
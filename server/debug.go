@@ -0,0 +1,75 @@
+package server
+
+import (
+	"time"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api"
+)
+
+const (
+	debugBundleJobs   = 20
+	debugBundleEvents = 100
+	redacted          = "<redacted>"
+)
+
+// DebugBundle gathers what we know about an instance, for support.
+// It does the best it can: anything that fails is noted in the
+// bundle, rather than failing the whole thing.
+func (s *Server) DebugBundle(instID flux.InstanceID) (api.DebugBundle, error) {
+	bundle := api.DebugBundle{
+		Generated: time.Now().UTC(),
+		Instance:  instID,
+		Version:   s.version,
+	}
+	fail := func(what string, err error) {
+		bundle.Errors = append(bundle.Errors, what+": "+err.Error())
+	}
+
+	if config, err := s.config.GetConfig(instID); err != nil {
+		fail("config", err)
+	} else {
+		safe := flux.InstanceConfig(config.Settings).HideSecrets()
+		if safe.Slack.HookURL != "" {
+			safe.Slack.HookURL = redacted
+		}
+		bundle.Config = &safe
+	}
+
+	s.daemonsMu.Lock()
+	if since, ok := s.daemons[instID]; ok {
+		bundle.Daemon.ConnectedSince = &since
+	}
+	s.daemonsMu.Unlock()
+	start := time.Now()
+	if err := s.messageBus.Ping(instID); err != nil {
+		bundle.Daemon.Error = err.Error()
+	} else {
+		bundle.Daemon.Connected = true
+		bundle.Daemon.PingSeconds = time.Since(start).Seconds()
+		if inst, err := s.instancer.Get(instID); err != nil {
+			fail("instance", err)
+		} else if v, err := inst.Version(); err != nil {
+			fail("daemon version", err)
+		} else {
+			bundle.Daemon.Version = v
+		}
+	}
+
+	if js, err := s.jobs.RecentJobs(instID, debugBundleJobs); err != nil {
+		fail("jobs", err)
+	} else {
+		bundle.Jobs = js
+	}
+
+	if events, err := s.History(instID, flux.ServiceSpecAll); err != nil {
+		fail("events", err)
+	} else {
+		if len(events) > debugBundleEvents {
+			events = events[:debugBundleEvents]
+		}
+		bundle.Events = events
+	}
+
+	return bundle, nil
+}
@@ -0,0 +1,18 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/release"
+)
+
+// Export gives the desired state of the instance: the services defined
+// in its config repo, with their images, policies and files.
+func (s *Server) Export(instID flux.InstanceID) (flux.DesiredState, error) {
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return flux.DesiredState{}, errors.Wrap(err, "getting instance")
+	}
+	return release.DesiredState(instID, inst)
+}
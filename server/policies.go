@@ -0,0 +1,195 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/release"
+)
+
+// UpdatePolicies sets the policies given on all the services
+// selected. Each service is updated on its own, so that one failing
+// doesn't stop the others; the results say what happened to each.
+func (s *Server) UpdatePolicies(instID flux.InstanceID, update flux.PolicyUpdate) ([]flux.PolicyResult, error) {
+	if update.Namespace == "" && len(update.Labels) == 0 && update.Spec == "" {
+		return nil, errors.New("no services selected; give a namespace, labels or service spec (which may be <all>)")
+	}
+	if update.Automate == nil && update.Lock == nil && update.TagFilter == nil && update.MinImageAge == nil && update.NewerOnly == nil && update.RestartEvery == nil && update.ReleaseInterval == nil {
+		return nil, errors.New("no policies given to update")
+	}
+	if update.TagFilter != nil {
+		if _, err := path.Match(*update.TagFilter, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid tag filter %q", *update.TagFilter)
+		}
+	}
+	if update.MinImageAge != nil && *update.MinImageAge < 0 {
+		return nil, errors.Errorf("invalid minimum image age %d; expected minutes, or zero for no minimum", *update.MinImageAge)
+	}
+
+	var restartEvery time.Duration
+	if update.RestartEvery != nil && *update.RestartEvery != "" {
+		d, err := time.ParseDuration(*update.RestartEvery)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid restart interval %q", *update.RestartEvery)
+		}
+		if d < release.MinRestartInterval {
+			return nil, errors.Errorf("restart interval %s is shorter than the minimum of %s", d, release.MinRestartInterval)
+		}
+		restartEvery = d
+	}
+	if update.ReleaseInterval != nil && *update.ReleaseInterval != "" {
+		d, err := time.ParseDuration(*update.ReleaseInterval)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid release interval %q", *update.ReleaseInterval)
+		}
+		if d <= 0 {
+			return nil, errors.Errorf("invalid release interval %s; expected a positive duration, or none", d)
+		}
+	}
+
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return nil, err
+	}
+	services, err := inst.GetAllServices(update.Namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting services from platform")
+	}
+	matches, err := policyUpdateMatcher(update)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []flux.PolicyResult
+	for _, service := range services {
+		if !matches(service) {
+			continue
+		}
+		result := flux.PolicyResult{Service: service.ID}
+		if err := applyPolicyUpdate(inst, service.ID, update); err != nil {
+			result.Error = err.Error()
+		} else if restartEvery > 0 {
+			// Restarts already scheduled stand; each picks up the
+			// interval when it schedules the next.
+			_, err := s.jobs.PutJob(instID, release.RestartJob(instID, service.ID, restartEvery, time.Now()))
+			if err != nil && err != jobs.ErrJobAlreadyQueued {
+				result.Error = errors.Wrap(err, "scheduling restart").Error()
+			}
+		}
+		res = append(res, result)
+	}
+	return res, nil
+}
+
+func policyUpdateMatcher(update flux.PolicyUpdate) (func(platform.Service) bool, error) {
+	matchID := func(flux.ServiceID) bool { return true }
+	switch spec := update.Spec; {
+	case spec == "" || spec == flux.ServiceSpecAll:
+	case spec.IsPattern():
+		m, err := spec.Matcher()
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing service pattern %q", spec)
+		}
+		matchID = m
+	default:
+		id, err := flux.ParseServiceID(string(spec))
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing service spec %q", spec)
+		}
+		matchID = func(s flux.ServiceID) bool { return s == id }
+	}
+	return func(service platform.Service) bool {
+		for k, v := range update.Labels {
+			if service.Labels[k] != v {
+				return false
+			}
+		}
+		return matchID(service.ID)
+	}, nil
+}
+
+func applyPolicyUpdate(inst *instance.Instance, service flux.ServiceID, update flux.PolicyUpdate) error {
+	if err := inst.UpdateConfig(func(conf instance.Config) (instance.Config, error) {
+		serviceConf := conf.Services[service]
+		if update.Automate != nil {
+			serviceConf.Automated = *update.Automate
+		}
+		if update.Lock != nil {
+			serviceConf.Locked = *update.Lock
+		}
+		if update.TagFilter != nil {
+			serviceConf.TagFilter = *update.TagFilter
+		}
+		if update.MinImageAge != nil {
+			serviceConf.MinImageAge = *update.MinImageAge
+		}
+		if update.NewerOnly != nil {
+			serviceConf.NewerOnly = *update.NewerOnly
+		}
+		if update.RestartEvery != nil {
+			serviceConf.RestartEvery = *update.RestartEvery
+		}
+		if update.ReleaseInterval != nil {
+			serviceConf.ReleaseInterval = *update.ReleaseInterval
+		}
+		if serviceConf == (instance.ServiceConfig{}) {
+			delete(conf.Services, service)
+		} else {
+			conf.Services[service] = serviceConf
+		}
+		return conf, nil
+	}); err != nil {
+		return err
+	}
+
+	ns, svc := service.Components()
+	if update.Automate != nil {
+		if *update.Automate {
+			inst.LogEvent(ns, svc, serviceAutomated)
+		} else {
+			inst.LogEvent(ns, svc, serviceDeautomated)
+		}
+	}
+	if update.Lock != nil {
+		if *update.Lock {
+			inst.LogEvent(ns, svc, serviceLocked)
+		} else {
+			inst.LogEvent(ns, svc, serviceUnlocked)
+		}
+	}
+	if update.TagFilter != nil {
+		inst.LogEvent(ns, svc, fmt.Sprintf("Tag filter set to %q.", *update.TagFilter))
+	}
+	if update.MinImageAge != nil {
+		inst.LogEvent(ns, svc, fmt.Sprintf("Minimum image age set to %d minutes.", *update.MinImageAge))
+	}
+	if update.NewerOnly != nil {
+		if *update.NewerOnly {
+			inst.LogEvent(ns, svc, "Only images newer than that running will be released.")
+		} else {
+			inst.LogEvent(ns, svc, "Images older than that running may be released.")
+		}
+	}
+	if update.RestartEvery != nil {
+		if *update.RestartEvery != "" {
+			inst.LogEvent(ns, svc, fmt.Sprintf("Service will be restarted every %s.", *update.RestartEvery))
+		} else {
+			inst.LogEvent(ns, svc, "Service will no longer be restarted on schedule.")
+		}
+	}
+	if update.ReleaseInterval != nil {
+		if *update.ReleaseInterval != "" {
+			inst.LogEvent(ns, svc, fmt.Sprintf("Service will be released at most once every %s.", *update.ReleaseInterval))
+		} else {
+			inst.LogEvent(ns, svc, "Service may be released as often as there are new images.")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/registry"
+)
+
+type nopHistogram struct{}
+
+func (h nopHistogram) With(...string) metrics.Histogram { return h }
+func (h nopHistogram) Observe(float64)                  {}
+
+// memConfig keeps an instance's config, refusing any update after
+// which refuse gives an error.
+type memConfig struct {
+	mu     sync.Mutex
+	config instance.Config
+	refuse func(instance.Config) error
+}
+
+func (c *memConfig) Get() (instance.Config, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config, nil
+}
+
+func (c *memConfig) Update(update instance.UpdateFunc) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// The update may change the services in place, so it's given a
+	// copy to work on.
+	current := c.config
+	current.Services = map[flux.ServiceID]instance.ServiceConfig{}
+	for id, s := range c.config.Services {
+		current.Services[id] = s
+	}
+	updated, err := update(current)
+	if err != nil {
+		return err
+	}
+	if c.refuse != nil {
+		if err := c.refuse(updated); err != nil {
+			return err
+		}
+	}
+	c.config = updated
+	return nil
+}
+
+func (c *memConfig) UpdateAt(_ int64, update instance.UpdateFunc) error {
+	return c.Update(update)
+}
+
+// recordingEvents keeps the events logged for each service.
+type recordingEvents struct {
+	mu     sync.Mutex
+	events map[string][]string
+}
+
+func (e *recordingEvents) LogEvent(namespace, service, msg string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	id := string(flux.MakeServiceID(namespace, service))
+	e.events[id] = append(e.events[id], msg)
+	return nil
+}
+
+type staticInstancer struct {
+	inst *instance.Instance
+}
+
+func (i staticInstancer) Get(flux.InstanceID) (*instance.Instance, error) {
+	return i.inst, nil
+}
+
+type nopReleases struct {
+	history.ImageReleaseReadWriter
+}
+
+func policiesServer(config *memConfig, events *recordingEvents) *Server {
+	p := platform.NewFake(
+		platform.Service{ID: "default/a", Labels: map[string]string{"tier": "front"}},
+		platform.Service{ID: "default/b", Labels: map[string]string{"tier": "back"}},
+		platform.Service{ID: "default/helloworld", Labels: map[string]string{"tier": "front"}},
+		platform.Service{ID: "other/a", Labels: map[string]string{"tier": "front"}},
+		platform.Service{ID: "other/helloworld"},
+	)
+	inst := instance.New(p, registry.NewFake(), config, git.Repo{}, log.NewNopLogger(), nopHistogram{}, nil, events, nopReleases{}, history.NopAnnotator{})
+	return &Server{instancer: staticInstancer{inst}, logger: log.NewNopLogger()}
+}
+
+func updatedServices(results []flux.PolicyResult) []string {
+	var res []string
+	for _, r := range results {
+		res = append(res, string(r.Service))
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestUpdatePoliciesSelection(t *testing.T) {
+	yes := true
+	for _, c := range []struct {
+		update   flux.PolicyUpdate
+		expected []string
+	}{
+		{flux.PolicyUpdate{Spec: flux.ServiceSpecAll}, []string{"default/a", "default/b", "default/helloworld", "other/a", "other/helloworld"}},
+		{flux.PolicyUpdate{Spec: "default/helloworld"}, []string{"default/helloworld"}},
+		{flux.PolicyUpdate{Namespace: "other"}, []string{"other/a", "other/helloworld"}},
+		{flux.PolicyUpdate{Labels: map[string]string{"tier": "front"}}, []string{"default/a", "default/helloworld", "other/a"}},
+		{flux.PolicyUpdate{Spec: "*/helloworld"}, []string{"default/helloworld", "other/helloworld"}},
+		{flux.PolicyUpdate{Spec: "/^default/"}, []string{"default/a", "default/b", "default/helloworld"}},
+		// The selections narrow each other down
+		{flux.PolicyUpdate{Namespace: "default", Labels: map[string]string{"tier": "front"}, Spec: "*/a"}, []string{"default/a"}},
+		{flux.PolicyUpdate{Spec: "nowhere/*"}, nil},
+	} {
+		config := &memConfig{config: instance.MakeConfig()}
+		s := policiesServer(config, &recordingEvents{events: map[string][]string{}})
+		update := c.update
+		update.Automate = &yes
+		results, err := s.UpdatePolicies("instance", update)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := updatedServices(results); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%+v: expected %v to be updated, got %v", c.update, c.expected, got)
+		}
+		var automated []string
+		for id, conf := range config.config.Services {
+			if conf.Automated {
+				automated = append(automated, string(id))
+			}
+		}
+		sort.Strings(automated)
+		if !reflect.DeepEqual(automated, c.expected) {
+			t.Errorf("%+v: expected %v to be automated, got %v", c.update, c.expected, automated)
+		}
+	}
+}
+
+func TestUpdatePoliciesPartialFailure(t *testing.T) {
+	yes := true
+	config := &memConfig{
+		config: instance.MakeConfig(),
+		refuse: func(c instance.Config) error {
+			if c.Services["default/b"].Locked {
+				return errors.New("default/b may not be locked")
+			}
+			return nil
+		},
+	}
+	events := &recordingEvents{events: map[string][]string{}}
+	s := policiesServer(config, events)
+	results, err := s.UpdatePolicies("instance", flux.PolicyUpdate{Spec: "default/*", Lock: &yes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[flux.ServiceID]string{
+		"default/a":          "",
+		"default/b":          "default/b may not be locked",
+		"default/helloworld": "",
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected a result for each of %v, got %+v", expected, results)
+	}
+	for _, r := range results {
+		if e, ok := expected[r.Service]; !ok || r.Error != e {
+			t.Errorf("expected %s to have error %q, got %q", r.Service, e, r.Error)
+		}
+		locked := config.config.Services[r.Service].Locked
+		if locked != (r.Error == "") {
+			t.Errorf("expected %s to be locked only if it was updated, got locked %v", r.Service, locked)
+		}
+	}
+	for _, id := range []string{"default/a", "default/helloworld"} {
+		if !reflect.DeepEqual(events.events[id], []string{serviceLocked}) {
+			t.Errorf("expected %s to be logged as locked, got %v", id, events.events[id])
+		}
+	}
+	if len(events.events["default/b"]) != 0 {
+		t.Errorf("expected nothing to be logged for the service which failed, got %v", events.events["default/b"])
+	}
+}
+
+func TestUpdatePoliciesRefused(t *testing.T) {
+	yes, negative := true, -1
+	s := policiesServer(&memConfig{config: instance.MakeConfig()}, &recordingEvents{events: map[string][]string{}})
+	for _, update := range []flux.PolicyUpdate{
+		{Automate: &yes},                      // no services selected
+		{Spec: flux.ServiceSpecAll},           // no policies
+		{Spec: "default/[a-", Automate: &yes}, // bad pattern
+		{Spec: flux.ServiceSpecAll, MinImageAge: &negative},
+	} {
+		if _, err := s.UpdatePolicies("instance", update); err == nil {
+			t.Errorf("expected %+v to be refused", update)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/registry"
+)
+
+// RegistryStatus reports how each of the registry hosts used by the
+// instance's services is limiting requests, so it's possible to tell
+// why fetching image metadata is slow. Since the registry hosts are
+// shared among instances, the numbers are for all instances.
+func (s *Server) RegistryStatus(instID flux.InstanceID) ([]flux.RegistryHostState, error) {
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting instance")
+	}
+	services, err := inst.GetAllServices("")
+	if err != nil {
+		return nil, errors.Wrap(err, "getting services from platform")
+	}
+	config, err := inst.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting instance config")
+	}
+	mirrors := registry.Mirrors(config.Settings.Registry.Mirrors)
+
+	seen := map[string]bool{}
+	var hosts []string
+	for _, service := range services {
+		for _, container := range service.ContainersOrNil() {
+			id, err := flux.ParseImageID(container.Image)
+			if err != nil {
+				continue
+			}
+			host := mirrors.HostFor(id.Repository())
+			if !seen[host] {
+				seen[host] = true
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+	return s.throttle.State(hosts...), nil
+}
+
+// CheckRegistryCredentials checks each of the registry credentials in
+// the instance's config against the registry it's for, so that
+// credentials which have been revoked or mistyped can be told apart
+// from registries refusing for other reasons.
+func (s *Server) CheckRegistryCredentials(instID flux.InstanceID) ([]flux.RegistryCredentialCheck, error) {
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting instance")
+	}
+	config, err := inst.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting instance config")
+	}
+	creds, err := registry.CredentialsFromConfig(config.Settings)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding registry credentials")
+	}
+	return registry.CheckCredentials(creds, s.throttle, nil), nil
+}
@@ -2,8 +2,10 @@ package server
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -12,12 +14,17 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/auth"
+	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/history"
 	"github.com/weaveworks/flux/instance"
 	"github.com/weaveworks/flux/jobs"
 	fluxmetrics "github.com/weaveworks/flux/metrics"
 	"github.com/weaveworks/flux/platform"
 	"github.com/weaveworks/flux/registry"
+	"github.com/weaveworks/flux/release"
+	"github.com/weaveworks/flux/reporting"
+	"github.com/weaveworks/flux/usage"
 )
 
 const (
@@ -33,10 +40,17 @@ type Server struct {
 	config      instance.DB
 	messageBus  platform.MessageBus
 	jobs        jobs.JobStore
+	tokens      auth.Store
+	usage       usage.Store
+	throttle    *registry.Throttle
 	logger      log.Logger
 	maxPlatform chan struct{} // semaphore for concurrent calls to the platform
 	metrics     Metrics
 	connected   int32
+	version     string
+
+	daemonsMu sync.Mutex
+	daemons   map[flux.InstanceID]time.Time // when each connected daemon connected
 }
 
 type Metrics struct {
@@ -47,6 +61,7 @@ type Metrics struct {
 	RegisterDaemonDuration metrics.Histogram
 	ConnectedDaemons       metrics.Gauge
 	PlatformMetrics        platform.Metrics
+	Labels                 fluxmetrics.LabelPolicy
 }
 
 func New(
@@ -54,8 +69,12 @@ func New(
 	config instance.DB,
 	messageBus platform.MessageBus,
 	jobs jobs.JobStore,
+	tokens auth.Store,
+	usage usage.Store,
+	registryThrottle *registry.Throttle,
 	logger log.Logger,
 	metrics Metrics,
+	version string,
 ) *Server {
 	metrics.ConnectedDaemons.Set(0)
 	return &Server{
@@ -63,9 +82,14 @@ func New(
 		config:      config,
 		messageBus:  messageBus,
 		jobs:        jobs,
+		tokens:      tokens,
+		usage:       usage,
+		throttle:    registryThrottle,
 		logger:      logger,
 		maxPlatform: make(chan struct{}, 8),
 		metrics:     metrics,
+		version:     version,
+		daemons:     map[flux.InstanceID]time.Time{},
 	}
 }
 
@@ -93,10 +117,12 @@ func (s *Server) Status(inst flux.InstanceID) (res flux.Status, err error) {
 	}
 	res.Git.Configured = config.Settings.Git.URL != "" && config.Settings.Git.Key != ""
 
-	stderr := &bytes.Buffer{}
-	if _, err := helper.ConfigRepo().Clone(stderr); err != nil {
+	if path, err := helper.ConfigRepo().Clone(nil); err != nil {
+		// The error includes what git printed, less any credentials.
 		// Remove \r, so it prints as a yaml block
-		res.Git.Error = strings.Replace(stderr.String(), "\r", "", -1)
+		res.Git.Error = strings.Replace(err.Error(), "\r", "", -1)
+	} else {
+		helper.ConfigRepo().Clean(path)
 	}
 
 	res.Fluxd.Version, err = helper.Version()
@@ -133,11 +159,21 @@ func (s *Server) ListServices(inst flux.InstanceID, namespace string) (res []flu
 			helper.Log("service", service.ID, "err", err)
 		}
 		res = append(res, flux.ServiceStatus{
-			ID:         service.ID,
-			Containers: containers2containers(service.ContainersOrNil()),
-			Status:     service.Status,
-			Automated:  config.Services[service.ID].Automated,
-			Locked:     config.Services[service.ID].Locked,
+			ID:              service.ID,
+			Containers:      containers2containers(service.ContainersOrNil()),
+			Status:          service.Status,
+			Automated:       config.Services[service.ID].Automated,
+			Locked:          config.Services[service.ID].Locked,
+			Labels:          service.Labels,
+			Annotations:     service.Annotations,
+			Controller:      service.ControllerKind,
+			Replicas:        service.Replicas,
+			TagFilter:       config.Services[service.ID].TagFilter,
+			MinImageAge:     config.Services[service.ID].MinImageAge,
+			NewerOnly:       config.Services[service.ID].NewerOnly,
+			RestartEvery:    config.Services[service.ID].RestartEvery,
+			ReleaseInterval: config.Services[service.ID].ReleaseInterval,
+			Suspect:         config.Suspect[service.ID],
 		})
 	}
 	return res, nil
@@ -146,10 +182,12 @@ func (s *Server) ListServices(inst flux.InstanceID, namespace string) (res []flu
 func containers2containers(cs []platform.Container) []flux.Container {
 	res := make([]flux.Container, len(cs))
 	for i, c := range cs {
+		// An image that doesn't parse is still shown as it is
+		id, _ := flux.ParseImageID(c.Image)
 		res[i] = flux.Container{
 			Name: c.Name,
 			Current: flux.ImageDescription{
-				ID: flux.ParseImageID(c.Image),
+				ID: id,
 			},
 		}
 	}
@@ -172,6 +210,33 @@ func (s *Server) ListImages(inst flux.InstanceID, spec flux.ServiceSpec) (res []
 	var services []platform.Service
 	if spec == flux.ServiceSpecAll {
 		services, err = helper.GetAllServices("")
+	} else if repo, ok := spec.UsingRepository(); ok {
+		all, err := helper.GetAllServices("")
+		if err != nil {
+			return nil, errors.Wrap(err, "getting services")
+		}
+		for _, service := range all {
+			for _, c := range service.ContainersOrNil() {
+				if id, err := flux.ParseImageID(c.Image); err == nil && id.Repository() == repo {
+					services = append(services, service)
+					break
+				}
+			}
+		}
+	} else if spec.IsPattern() {
+		matches, err := spec.Matcher()
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing service pattern")
+		}
+		all, err := helper.GetAllServices("")
+		if err != nil {
+			return nil, errors.Wrap(err, "getting services")
+		}
+		for _, service := range all {
+			if matches(service.ID) {
+				services = append(services, service)
+			}
+		}
 	} else {
 		id, err := spec.AsID()
 		if err != nil {
@@ -198,9 +263,13 @@ func (s *Server) ListImages(inst flux.InstanceID, spec flux.ServiceSpec) (res []
 
 func containersWithAvailable(service platform.Service, images instance.ImageMap) (res []flux.Container) {
 	for _, c := range service.ContainersOrNil() {
-		id := flux.ParseImageID(c.Image)
-		repo := id.Repository()
-		available := images[repo]
+		// An image that doesn't parse is still shown as it is, with
+		// nothing available
+		id, err := flux.ParseImageID(c.Image)
+		var available []flux.ImageDescription
+		if err == nil {
+			available = images[id.Repository()]
+		}
 		res = append(res, flux.Container{
 			Name: c.Name,
 			Current: flux.ImageDescription{
@@ -256,6 +325,69 @@ func (s *Server) History(inst flux.InstanceID, spec flux.ServiceSpec) (res []flu
 	return res, nil
 }
 
+// ImagesAt says which image each container of a service was running
+// at a given time, according to the releases recorded.
+func (s *Server) ImagesAt(instID flux.InstanceID, service flux.ServiceID, at time.Time) (res []flux.ImageRelease, err error) {
+	defer func(begin time.Time) {
+		s.metrics.HistoryDuration.With(
+			"service_spec", string(service),
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting instance")
+	}
+	res, err = inst.ImagesAt(service, at)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching image releases for %s", service)
+	}
+	return res, nil
+}
+
+// Timeline gives the image releases selected by the query, oldest
+// first.
+func (s *Server) Timeline(instID flux.InstanceID, q flux.TimelineQuery) (res []flux.ImageRelease, err error) {
+	defer func(begin time.Time) {
+		s.metrics.HistoryDuration.With(
+			"service_spec", string(q.Service),
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting instance")
+	}
+	res, err = inst.Timeline(q)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching deployment timeline")
+	}
+	return res, nil
+}
+
+// DeploymentReport computes deployment metrics for the instance, and
+// each of its services, over the period given.
+func (s *Server) DeploymentReport(instID flux.InstanceID, since, until time.Time) (res flux.DeploymentReport, err error) {
+	defer func(begin time.Time) {
+		s.metrics.HistoryDuration.With(
+			"service_spec", string(flux.ServiceSpecAll),
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return res, errors.Wrapf(err, "getting instance")
+	}
+	releases, err := inst.Timeline(flux.TimelineQuery{Since: since, Until: until})
+	if err != nil {
+		return res, errors.Wrap(err, "fetching deployment timeline")
+	}
+	return reporting.Compute(releases, since, until), nil
+}
+
 func (s *Server) Automate(instID flux.InstanceID, service flux.ServiceID) error {
 	inst, err := s.instancer.Get(instID)
 	if err != nil {
@@ -290,6 +422,14 @@ func recordAutomated(inst *instance.Instance, service flux.ServiceID, automated
 	})
 }
 
+func (s *Server) ConfirmImage(instID flux.InstanceID, service flux.ServiceID, image flux.ImageID) error {
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return err
+	}
+	return release.ConfirmImage(inst, service, image)
+}
+
 func (s *Server) Lock(instID flux.InstanceID, service flux.ServiceID) error {
 	inst, err := s.instancer.Get(instID)
 	if err != nil {
@@ -327,7 +467,24 @@ func recordLock(inst *instance.Instance, service flux.ServiceID, locked bool) er
 	return nil
 }
 
+// PostRelease queues a release. Plans to execute can only be given by
+// the ID of the planning release that made them, so that what's run is
+// what was planned (and perhaps reviewed). The parameters which are
+// flux's own record of a release's progress are cleared, so a release
+// can't be started part-way through, as is ScheduledRestart, since
+// only flux schedules restarts. A platform snapshot can only be
+// planned against.
 func (s *Server) PostRelease(inst flux.InstanceID, params jobs.ReleaseJobParams) (jobs.JobID, error) {
+	if params.Snapshot != nil && params.Kind != flux.ReleaseKindPlan {
+		return "", errors.New("a release against a platform snapshot can only be planned")
+	}
+	params.ScheduledRestart = false
+	params.Plan = nil
+	params.CompletedActions = nil
+	params.PushedRevision = ""
+	params.SelfUpgrade = nil
+	params.Skipped = nil
+	params.ChangeTicket = ""
 	return s.jobs.PutJob(inst, jobs.Job{
 		Queue:    jobs.ReleaseJob,
 		Method:   jobs.ReleaseJob,
@@ -336,7 +493,62 @@ func (s *Server) PostRelease(inst flux.InstanceID, params jobs.ReleaseJobParams)
 	})
 }
 
+// GetRelease gives a summary of the release job, with only the latest
+// entries of its log; GetReleaseLog gives the whole log.
 func (s *Server) GetRelease(inst flux.InstanceID, id jobs.JobID) (jobs.Job, error) {
+	j, err := s.getRelease(inst, id)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	return j.Summary(), nil
+}
+
+// GetReleaseLog gives the log of the release job, as much of it as
+// is kept.
+func (s *Server) GetReleaseLog(inst flux.InstanceID, id jobs.JobID) ([]jobs.LogEntry, error) {
+	j, err := s.getRelease(inst, id)
+	if err != nil {
+		return nil, err
+	}
+	return j.Log, nil
+}
+
+// GetReleasePlan gives the plan of a dry-run release, once it's been
+// planned, rendered for a terminal (coloured, if asked for).
+func (s *Server) GetReleasePlan(inst flux.InstanceID, id jobs.JobID, colour bool) (string, error) {
+	j, err := s.getRelease(inst, id)
+	if err != nil {
+		return "", err
+	}
+	params, ok := j.Params.(jobs.ReleaseJobParams)
+	if !ok || len(params.Plan) == 0 {
+		return "", release.ErrNoPlan
+	}
+	var actions []release.ReleaseAction
+	if err := json.Unmarshal(params.Plan, &actions); err != nil {
+		return "", errors.Wrap(err, "unmarshaling plan")
+	}
+	var buf bytes.Buffer
+	if err := release.RenderPlan(&buf, actions, colour); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ListJobs gives a page of the instance's jobs, most recent first,
+// each with only the latest entries of its log.
+func (s *Server) ListJobs(inst flux.InstanceID, q jobs.JobQuery) (jobs.JobPage, error) {
+	page, err := s.jobs.ListJobs(inst, q)
+	if err != nil {
+		return jobs.JobPage{}, err
+	}
+	for i := range page.Jobs {
+		page.Jobs[i] = page.Jobs[i].Summary()
+	}
+	return page, nil
+}
+
+func (s *Server) getRelease(inst flux.InstanceID, id jobs.JobID) (jobs.Job, error) {
 	j, err := s.jobs.GetJob(inst, id)
 	if err != nil {
 		return jobs.Job{}, err
@@ -347,6 +559,60 @@ func (s *Server) GetRelease(inst flux.InstanceID, id jobs.JobID) (jobs.Job, erro
 	return j, err
 }
 
+// AbortSelfUpgrade abandons a release which upgraded flux's own
+// services, when the daemon hasn't come back: the release is marked
+// as failed (if it isn't finished), and a release is queued which
+// puts flux's definitions in the config repo back as they were. This
+// is recorded as a failure of each service, so it's alerted on
+// wherever events go. It gives the ID of the release rolling back.
+func (s *Server) AbortSelfUpgrade(instID flux.InstanceID, id jobs.JobID) (jobs.JobID, error) {
+	job, err := s.getRelease(instID, id)
+	if err != nil {
+		return "", err
+	}
+	params := job.Params.(jobs.ReleaseJobParams)
+	if params.SelfUpgrade == nil {
+		return "", fmt.Errorf("release %s did not upgrade flux's own services", id)
+	}
+	if job.Done && job.Success {
+		return "", fmt.Errorf("release %s succeeded; there is nothing to abort", id)
+	}
+	if !job.Done {
+		job.Done, job.Success = true, false
+		job.Logf(jobs.LogError, "Self-upgrade aborted by hand; marked as failed.")
+		if err := s.jobs.UpdateJob(job); err != nil {
+			return "", errors.Wrap(err, "marking release as failed")
+		}
+	}
+
+	rollback, err := s.jobs.PutJob(instID, jobs.Job{
+		Queue:    jobs.ReleaseJob,
+		Method:   jobs.ReleaseJob,
+		Priority: jobs.PriorityInteractive,
+		// Only the one rollback, however many times it's asked for
+		Key: strings.Join([]string{jobs.ReleaseJob, string(instID), string(id), "rollback"}, "|"),
+		Params: jobs.ReleaseJobParams{
+			Kind: flux.ReleaseKindExecute,
+			Plan: params.SelfUpgrade.Rollback,
+			User: params.User,
+		},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "queueing rollback of config repo")
+	}
+
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		s.logger.Log("method", "AbortSelfUpgrade", "err", errors.Wrap(err, "getting instance to record abort"))
+		return rollback, nil
+	}
+	for _, service := range params.SelfUpgrade.Services {
+		namespace, name := service.Components()
+		inst.LogEvent(namespace, name, fmt.Sprintf("Self-upgrade in release %s aborted; rolling back the config repo in release %s. failed", id, rollback))
+	}
+	return rollback, nil
+}
+
 func (s *Server) GetConfig(instID flux.InstanceID) (flux.InstanceConfig, error) {
 	fullConfig, err := s.config.GetConfig(instID)
 	if err != nil {
@@ -354,18 +620,92 @@ func (s *Server) GetConfig(instID flux.InstanceID) (flux.InstanceConfig, error)
 	}
 
 	config := flux.InstanceConfig(fullConfig.Settings)
+	config.Version = fullConfig.Version
 	return config, nil
 }
 
 func (s *Server) SetConfig(instID flux.InstanceID, updates flux.UnsafeInstanceConfig) error {
+	if err := validateConfig(updates); err != nil {
+		return err
+	}
+	update := applyConfigUpdates(updates)
+	if updates.Version != 0 {
+		update = instance.IfVersion(instID, updates.Version, update)
+	}
+	return s.config.UpdateConfig(instID, update)
+}
+
+// validateConfig checks the parts of the config which can be checked
+// without using them.
+func validateConfig(updates flux.UnsafeInstanceConfig) error {
 	if _, err := registry.CredentialsFromConfig(updates); err != nil {
 		return errors.Wrap(err, "invalid registry credentials")
 	}
-	return s.config.UpdateConfig(instID, applyConfigUpdates(updates))
+	if _, err := registry.HostConfigFromConfig(updates); err != nil {
+		return errors.Wrap(err, "invalid registry config")
+	}
+	if err := git.ValidateMetadata(updates.Git.ReleaseMetadata); err != nil {
+		return errors.Wrap(err, "invalid git config")
+	}
+	if err := updates.Git.ValidateServicePaths(); err != nil {
+		return errors.Wrap(err, "invalid git config")
+	}
+	if err := updates.Git.ValidateScanLimits(); err != nil {
+		return errors.Wrap(err, "invalid git config")
+	}
+	if updates.Git.DeployTags != nil {
+		if err := updates.Git.DeployTags.Validate(); err != nil {
+			return errors.Wrap(err, "invalid git config")
+		}
+	}
+	if updates.Slack.Commands != nil {
+		if err := updates.Slack.Commands.Validate(); err != nil {
+			return errors.Wrap(err, "invalid slack config")
+		}
+	}
+	if err := updates.Automation.Validate(); err != nil {
+		return errors.Wrap(err, "invalid automation config")
+	}
+	if updates.AlertCheck != nil {
+		if err := updates.AlertCheck.Validate(); err != nil {
+			return errors.Wrap(err, "invalid alert check config")
+		}
+	}
+	for _, shift := range updates.TrafficShifts {
+		if err := shift.Validate(); err != nil {
+			return errors.Wrap(err, "invalid traffic shift config")
+		}
+	}
+	if updates.ChangeTickets != nil {
+		if err := updates.ChangeTickets.Validate(); err != nil {
+			return errors.Wrap(err, "invalid change ticket config")
+		}
+	}
+	if updates.CommitStatus != nil {
+		if err := updates.CommitStatus.Validate(); err != nil {
+			return errors.Wrap(err, "invalid commit status config")
+		}
+	}
+	if updates.Webhooks != nil {
+		if err := updates.Webhooks.Validate(); err != nil {
+			return errors.Wrap(err, "invalid webhooks config")
+		}
+	}
+	if updates.SelfUpgrade != nil {
+		if err := updates.SelfUpgrade.Validate(); err != nil {
+			return errors.Wrap(err, "invalid self-upgrade config")
+		}
+	}
+	if err := updates.Features.Validate(); err != nil {
+		return errors.Wrap(err, "invalid features")
+	}
+	return nil
 }
 
 func applyConfigUpdates(updates flux.UnsafeInstanceConfig) instance.UpdateFunc {
 	return func(config instance.Config) (instance.Config, error) {
+		// The version is kept by the DB, not in the settings
+		updates.Version = 0
 		config.Settings = updates
 		return config, nil
 	}
@@ -392,13 +732,26 @@ func (s *Server) RegisterDaemon(instID flux.InstanceID, platform platform.Platfo
 		}
 
 		s.metrics.RegisterDaemonDuration.With(
-			fluxmetrics.LabelInstanceID, fmt.Sprint(instID),
+			fluxmetrics.LabelInstanceID, s.metrics.Labels.Instance(string(instID)),
 			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
 		).Observe(time.Since(begin).Seconds())
 		s.metrics.ConnectedDaemons.Set(float64(atomic.AddInt32(&s.connected, -1)))
 	}(time.Now())
 	s.metrics.ConnectedDaemons.Set(float64(atomic.AddInt32(&s.connected, 1)))
 
+	connectedAt := time.Now().UTC()
+	s.daemonsMu.Lock()
+	s.daemons[instID] = connectedAt
+	s.daemonsMu.Unlock()
+	defer func() {
+		s.daemonsMu.Lock()
+		// A newer connection may have replaced this one already
+		if s.daemons[instID] == connectedAt {
+			delete(s.daemons, instID)
+		}
+		s.daemonsMu.Unlock()
+	}()
+
 	// Register the daemon with our message bus, waiting for it to be
 	// closed. NB we cannot in general expect there to be a
 	// configuration record for this instance; it may be connecting
@@ -453,6 +806,24 @@ func (p *loggingPlatform) Apply(defs []platform.ServiceDefinition) (err error) {
 	return p.platform.Apply(defs)
 }
 
+func (p *loggingPlatform) ApplyResources(set platform.ResourceSet) (err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "ApplyResources", "error", err)
+		}
+	}()
+	return p.platform.ApplyResources(set)
+}
+
+func (p *loggingPlatform) DryRunApply(defs []platform.ServiceDefinition) (res platform.DryRunResult, err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "DryRunApply", "error", err)
+		}
+	}()
+	return p.platform.DryRunApply(defs)
+}
+
 func (p *loggingPlatform) Ping() (err error) {
 	defer func() {
 		if err != nil {
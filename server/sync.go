@@ -0,0 +1,41 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+)
+
+// SyncConfigRepo brings the instance up to date with its config repo,
+// which has been pushed to at the revision given: the idle clones of
+// the repo are refreshed, and a release applying the definitions in
+// the repo, without updating images, is queued. There's only ever one
+// such release queued for an instance; since it clones the repo when
+// it runs, it picks up any pushes made while it's waiting.
+func (s *Server) SyncConfigRepo(instID flux.InstanceID, revision string) (jobs.JobID, error) {
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return "", err
+	}
+	if repo := inst.ConfigRepo(); repo.Pool != nil {
+		go repo.Pool.Refresh(repo)
+	}
+	id, err := s.jobs.PutJob(instID, jobs.Job{
+		Queue:    jobs.ReleaseJob,
+		Key:      strings.Join([]string{"sync", string(instID)}, "|"),
+		Method:   jobs.ReleaseJob,
+		Priority: jobs.PriorityInteractive,
+		Params: jobs.ReleaseJobParams{
+			ServiceSpecs: []flux.ServiceSpec{flux.ServiceSpecAll},
+			ImageSpec:    flux.ImageSpecNone,
+			Kind:         flux.ReleaseKindExecute,
+			User:         "git push",
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	inst.Log("sync", id, "revision", revision)
+	return id, nil
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api"
+	"github.com/weaveworks/flux/instance"
+)
+
+// GetTemplate gives the instance's config, less its secrets, as a
+// template for setting up other instances.
+func (s *Server) GetTemplate(instID flux.InstanceID) (api.InstanceTemplate, error) {
+	config, err := s.config.GetConfig(instID)
+	if err != nil {
+		return api.InstanceTemplate{}, errors.Wrap(err, "getting config")
+	}
+	return api.InstanceTemplate{
+		Settings: flux.InstanceConfig(config.Settings).WithoutSecrets(),
+		Services: config.Services,
+	}, nil
+}
+
+// ApplyTemplate sets up a new instance from the template given. It's
+// refused if the instance has been configured already, so that a
+// template can't silently overwrite config; secrets, which templates
+// don't have, are then given with SetConfig.
+func (s *Server) ApplyTemplate(instID flux.InstanceID, template api.InstanceTemplate) error {
+	settings := template.Settings
+	settings.Version = 0
+	if err := validateConfig(settings); err != nil {
+		return err
+	}
+	return s.config.UpdateConfig(instID, func(config instance.Config) (instance.Config, error) {
+		if isConfigured(config) {
+			return config, errors.Errorf("instance %s is already configured; templates can only be applied to new instances", instID)
+		}
+		config.Settings = settings
+		config.Services = map[flux.ServiceID]instance.ServiceConfig{}
+		for id, service := range template.Services {
+			config.Services[id] = service
+		}
+		return config, nil
+	})
+}
+
+// isConfigured says whether the config has been set, or any service
+// policies given, as opposed to being that of a new instance.
+func isConfigured(config instance.Config) bool {
+	return config.Version > 0 || len(config.Services) > 0 || config.Settings.Git.URL != ""
+}
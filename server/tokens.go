@@ -0,0 +1,62 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api"
+	"github.com/weaveworks/flux/auth"
+)
+
+// Tokens are managed through the API, by those with tokens of their
+// own with the admin scope; each change is recorded in the instance's
+// history, so there's an audit trail of who could do what, when.
+
+func (s *Server) ListTokens(inst flux.InstanceID) ([]auth.Token, error) {
+	return s.tokens.List(inst)
+}
+
+func (s *Server) CreateToken(inst flux.InstanceID, spec auth.TokenSpec) (api.NewToken, error) {
+	t, secret, err := s.tokens.Create(inst, spec)
+	if err != nil {
+		return api.NewToken{}, err
+	}
+	var scopes []string
+	for _, scope := range t.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+	s.audit(inst, fmt.Sprintf("API token %q (%s) created, with scopes %s.", t.Name, t.ID, strings.Join(scopes, ", ")))
+	return api.NewToken{Token: t, Secret: secret}, nil
+}
+
+func (s *Server) RotateToken(inst flux.InstanceID, id auth.TokenID) (api.NewToken, error) {
+	t, secret, err := s.tokens.Rotate(inst, id)
+	if err != nil {
+		return api.NewToken{}, err
+	}
+	s.audit(inst, fmt.Sprintf("API token %q (%s) rotated.", t.Name, t.ID))
+	return api.NewToken{Token: t, Secret: secret}, nil
+}
+
+func (s *Server) RevokeToken(inst flux.InstanceID, id auth.TokenID) error {
+	if err := s.tokens.Revoke(inst, id); err != nil {
+		return err
+	}
+	s.audit(inst, fmt.Sprintf("API token %s revoked.", id))
+	return nil
+}
+
+// audit records an event about the instance as a whole, rather than
+// any service of it.
+func (s *Server) audit(instID flux.InstanceID, msg string) {
+	inst, err := s.instancer.Get(instID)
+	if err == nil {
+		err = inst.LogEvent("", "", msg)
+	}
+	if err != nil {
+		s.logger.Log("instance", instID, "audit", msg, "err", errors.Wrap(err, "recording audit event"))
+	}
+}
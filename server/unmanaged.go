@@ -0,0 +1,19 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/release"
+)
+
+// UnmanagedResources lists the services flux can't release because
+// they're running but not defined in the config repo, or defined but
+// not running; e.g., to help bring a cluster under flux's management.
+func (s *Server) UnmanagedResources(instID flux.InstanceID) ([]flux.UnmanagedResource, error) {
+	inst, err := s.instancer.Get(instID)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting instance")
+	}
+	return release.UnmanagedResources(inst)
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/usage"
+)
+
+// UsageReport gives what the instance used of the service each day of
+// the period given, and in total.
+func (s *Server) UsageReport(instID flux.InstanceID, since, until time.Time) (flux.UsageReport, error) {
+	days, err := s.usage.Usage(instID, since, until)
+	if err != nil {
+		return flux.UsageReport{}, errors.Wrap(err, "fetching usage")
+	}
+	res := flux.UsageReport{
+		Since: since,
+		Until: until,
+		Days:  days,
+		Total: flux.UsageDay{Day: usage.Day(since)},
+	}
+	for _, day := range days {
+		res.Total.Add(day)
+	}
+	return res, nil
+}
+
+// MeterDaemons counts a minute of connection against each instance
+// whose daemon is connected, each time the ticker ticks; it should
+// tick once a minute.
+func (s *Server) MeterDaemons(meter usage.Meter, tick <-chan time.Time) {
+	for range tick {
+		s.daemonsMu.Lock()
+		var connected []flux.InstanceID
+		for instID := range s.daemons {
+			connected = append(connected, instID)
+		}
+		s.daemonsMu.Unlock()
+		for _, instID := range connected {
+			meter.Add(instID, usage.DaemonMinutes, 1)
+		}
+	}
+}
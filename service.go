@@ -3,9 +3,12 @@ package flux
 import (
 	"fmt"
 	"net/http"
+	"path"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/pkg/errors"
 )
@@ -13,10 +16,14 @@ import (
 const (
 	ServiceSpecAll  = ServiceSpec("<all>")
 	ImageSpecLatest = ImageSpec("<all latest>")
-	ImageSpecNone   = ImageSpec("<no updates>")
-	PolicyNone      = Policy("")
-	PolicyLocked    = Policy("locked")
-	PolicyAutomated = Policy("automated")
+	// ImageSpecLatestAllowed updates each service to the latest
+	// images its policy allows (e.g., by its tag filter), which may
+	// differ from one service to the next.
+	ImageSpecLatestAllowed = ImageSpec("<all latest allowed>")
+	ImageSpecNone          = ImageSpec("<no updates>")
+	PolicyNone             = Policy("")
+	PolicyLocked           = Policy("locked")
+	PolicyAutomated        = Policy("automated")
 )
 
 var (
@@ -33,6 +40,13 @@ func (t Token) Set(req *http.Request) {
 	}
 }
 
+// Doer sends HTTP requests; it's satisfied by *http.Client. Things
+// which call other services take one, so they can be tested without
+// a network.
+type Doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
 type InstanceID string
 
 const InstanceIDHeaderKey = "X-Scope-OrgID"
@@ -147,76 +161,193 @@ func (ids ServiceIDs) Intersection(others ServiceIDSet) ServiceIDSet {
 	return set.Intersection(others)
 }
 
-type ImageID string // "quay.io/weaveworks/helloworld:v1"
+// ServiceSpec is a ServiceID, "<all>", "<using:REPOSITORY>" (the
+// services running any tag of the image repository), or a pattern
+// matching service IDs. A pattern is either a glob (e.g., "prod/*-api"), in which "*"
+// doesn't match "/"; or a regular expression between slashes (e.g.,
+// "/^team-a-/"), which is matched against the whole
+// "<namespace>/<service>".
+type ServiceSpec string
 
-func ParseImageID(s string) ImageID {
-	return ImageID(s) // technically all strings are valid
+func ParseServiceSpec(s string) (ServiceSpec, error) {
+	if s == string(ServiceSpecAll) {
+		return ServiceSpecAll, nil
+	}
+	if repo, ok := ServiceSpec(s).UsingRepository(); ok {
+		if repo == "" {
+			return "", errors.New("invalid service spec: no image repository given")
+		}
+		return ServiceSpec(s), nil
+	}
+	if spec := ServiceSpec(s); spec.IsPattern() {
+		if _, err := spec.Matcher(); err != nil {
+			return "", errors.Wrap(err, "invalid service spec")
+		}
+		return spec, nil
+	}
+	id, err := ParseServiceID(s)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid service spec")
+	}
+	return ServiceSpec(id), nil
+}
+
+func (s ServiceSpec) AsID() (ServiceID, error) {
+	return ParseServiceID(string(s))
 }
 
-func MakeImageID(registry, name, tag string) ImageID {
-	result := name
-	if registry != "" {
-		result = registry + "/" + name
+const (
+	serviceSpecUsingPrefix = "<using:"
+	serviceSpecUsingSuffix = ">"
+)
+
+// ServiceSpecUsing gives the spec for the services running any tag
+// of the image repository given.
+func ServiceSpecUsing(repository string) ServiceSpec {
+	return ServiceSpec(serviceSpecUsingPrefix + repository + serviceSpecUsingSuffix)
+}
+
+// UsingRepository gives the image repository, if the spec is for the
+// services using it.
+func (s ServiceSpec) UsingRepository() (string, bool) {
+	str := string(s)
+	if !strings.HasPrefix(str, serviceSpecUsingPrefix) || !strings.HasSuffix(str, serviceSpecUsingSuffix) {
+		return "", false
 	}
-	if tag != "" {
-		result = result + ":" + tag
+	return str[len(serviceSpecUsingPrefix) : len(str)-len(serviceSpecUsingSuffix)], true
+}
+
+func (s ServiceSpec) isRegexp() bool {
+	return len(s) > 2 && strings.HasPrefix(string(s), "/") && strings.HasSuffix(string(s), "/")
+}
+
+// IsPattern says whether the spec is a glob or regular expression,
+// rather than naming a particular service.
+func (s ServiceSpec) IsPattern() bool {
+	return s.isRegexp() || strings.ContainsAny(string(s), "*?[")
+}
+
+// checkGlob returns path.ErrBadPattern if the pattern is malformed,
+// as path.Match would find it: a class ([...]) left open, empty, or
+// with an unescaped - or ] out of place, or a trailing \.
+func checkGlob(pattern string) error {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			if i++; i == len(pattern) {
+				return path.ErrBadPattern
+			}
+		case '[':
+			i++
+			if i < len(pattern) && pattern[i] == '^' {
+				i++
+			}
+			for first := true; ; first = false {
+				if i < len(pattern) && pattern[i] == ']' && !first {
+					break
+				}
+				var err error
+				if i, err = globClassChar(pattern, i); err != nil {
+					return err
+				}
+				if i < len(pattern) && pattern[i] == '-' {
+					if i, err = globClassChar(pattern, i+1); err != nil {
+						return err
+					}
+				}
+			}
+		}
 	}
-	return ImageID(result)
+	return nil
 }
 
-func (id ImageID) Components() (registry, name, tag string) {
-	s := string(id)
-	toks := strings.SplitN(s, "/", 3)
-	if len(toks) == 3 {
-		registry = toks[0]
-		s = fmt.Sprintf("%s/%s", toks[1], toks[2])
+// globClassChar checks there's a character (or escaped character) at
+// i in a glob's class, giving the index after it.
+func globClassChar(pattern string, i int) (int, error) {
+	if i >= len(pattern) || pattern[i] == '-' || pattern[i] == ']' {
+		return 0, path.ErrBadPattern
 	}
-	toks = strings.SplitN(s, ":", 2)
-	if len(toks) == 2 {
-		tag = toks[1]
+	if pattern[i] == '\\' {
+		if i++; i == len(pattern) {
+			return 0, path.ErrBadPattern
+		}
 	}
-	name = toks[0]
-	return registry, name, tag
+	_, size := utf8.DecodeRuneInString(pattern[i:])
+	return i + size, nil
 }
 
-func (id ImageID) Repository() string {
-	registry, name, _ := id.Components()
-	if registry != "" && name != "" {
-		return registry + "/" + name
-	}
-	if name != "" {
-		return name
+// Matcher gives a predicate for the service IDs matched by a pattern
+// spec (or the exact ID, if the spec isn't a pattern).
+func (s ServiceSpec) Matcher() (func(ServiceID) bool, error) {
+	switch {
+	case s.isRegexp():
+		re, err := regexp.Compile(string(s[1 : len(s)-1]))
+		if err != nil {
+			return nil, err
+		}
+		return func(id ServiceID) bool {
+			return re.MatchString(string(id))
+		}, nil
+	case s.IsPattern():
+		// Check the pattern now, since Match only complains about a
+		// bad pattern if it gets that far.
+		if err := checkGlob(string(s)); err != nil {
+			return nil, err
+		}
+		return func(id ServiceID) bool {
+			ok, _ := path.Match(string(s), string(id))
+			return ok
+		}, nil
+	default:
+		return func(id ServiceID) bool {
+			return id == ServiceID(s)
+		}, nil
 	}
-	return ""
 }
 
-type ServiceSpec string // ServiceID or "<all>"
+// ImageSpec is an ImageID, or "<all latest>" (update all containers
+// to the latest available), or "<all latest allowed>" (update all
+// containers to the latest each service's policy allows), or "<no
+// updates>" (do not update any images)
+type ImageSpec string
 
-func ParseServiceSpec(s string) (ServiceSpec, error) {
-	if s == string(ServiceSpecAll) {
-		return ServiceSpecAll, nil
+func ParseImageSpec(s string) (ImageSpec, error) {
+	if s == string(ImageSpecLatest) || s == string(ImageSpecLatestAllowed) || s == string(ImageSpecNone) {
+		return ImageSpec(s), nil
 	}
-	id, err := ParseServiceID(s)
+	if repo, ok := ImageSpec(s).LatestOfRepository(); ok {
+		if repo == "" {
+			return "", errors.New("invalid image spec: no image repository given")
+		}
+		return ImageSpec(s), nil
+	}
+	id, err := ParseImageID(s)
 	if err != nil {
-		return "", errors.Wrap(err, "invalid service spec")
+		return "", err
 	}
-	return ServiceSpec(id), nil
+	return ImageSpec(id.String()), nil
 }
 
-func (s ServiceSpec) AsID() (ServiceID, error) {
-	return ParseServiceID(string(s))
-}
+const (
+	imageSpecLatestOfPrefix = "<latest:"
+	imageSpecLatestOfSuffix = ">"
+)
 
-// ImageSpec is an ImageID, or "<all latest>" (update all containers
-// to the latest available), or "<no updates>" (do not update any
-// images)
-type ImageSpec string
+// ImageSpecLatestOf gives the spec for the latest image (allowed for
+// each service) from the repository given, leaving other images
+// alone.
+func ImageSpecLatestOf(repository string) ImageSpec {
+	return ImageSpec(imageSpecLatestOfPrefix + repository + imageSpecLatestOfSuffix)
+}
 
-func ParseImageSpec(s string) ImageSpec {
-	if s == string(ImageSpecLatest) {
-		return ImageSpec(s)
+// LatestOfRepository gives the image repository, if the spec is for
+// the latest image from it.
+func (s ImageSpec) LatestOfRepository() (string, bool) {
+	str := string(s)
+	if !strings.HasPrefix(str, imageSpecLatestOfPrefix) || !strings.HasSuffix(str, imageSpecLatestOfSuffix) {
+		return "", false
 	}
-	return ImageSpec(ParseImageID(s))
+	return str[len(imageSpecLatestOfPrefix) : len(str)-len(imageSpecLatestOfSuffix)], true
 }
 
 type ImageStatus struct {
@@ -241,11 +372,172 @@ func ParsePolicy(s string) Policy {
 }
 
 type ServiceStatus struct {
-	ID         ServiceID
-	Containers []Container
-	Status     string
-	Automated  bool
-	Locked     bool
+	ID              ServiceID
+	Containers      []Container
+	Status          string
+	Automated       bool
+	Locked          bool
+	Labels          map[string]string `json:",omitempty"`
+	Annotations     map[string]string `json:",omitempty"`
+	Controller      string            `json:",omitempty"` // kind of pod controller, e.g., "Deployment"
+	Replicas        *Replicas         `json:",omitempty"`
+	TagFilter       string            `json:",omitempty"`
+	MinImageAge     int               `json:",omitempty"` // in minutes
+	NewerOnly       bool              `json:",omitempty"`
+	RestartEvery    string            `json:",omitempty"`
+	ReleaseInterval string            `json:",omitempty"`
+	// Suspect are the images which won't be released to the service
+	// as the latest until they're confirmed.
+	Suspect []SuspectImage `json:",omitempty"`
+}
+
+// RegistryHostState says how a registry host is limiting the requests
+// made to it. Remaining and Limit are the request quota, if the
+// registry reports it.
+type RegistryHostState struct {
+	Host         string
+	InFlight     int
+	Queued       int
+	BackoffUntil *time.Time `json:",omitempty"`
+	Last429      *time.Time `json:",omitempty"`
+	Remaining    *int       `json:",omitempty"`
+	Limit        *int       `json:",omitempty"`
+}
+
+// RegistryCredentialCheck is the result of checking the credentials
+// configured for a registry host against the host. Error says why
+// they weren't accepted, if they weren't.
+type RegistryCredentialCheck struct {
+	Host     string
+	Username string
+	OK       bool
+	Error    string `json:",omitempty"`
+}
+
+// PolicyUpdate changes the policies of many services at once. The
+// services are those selected by all of Namespace, Labels and Spec
+// that are given; at least one must be given, and Spec may be "<all>".
+// Only the policies given are changed.
+type PolicyUpdate struct {
+	Namespace string            `json:",omitempty"`
+	Labels    map[string]string `json:",omitempty"`
+	Spec      ServiceSpec       `json:",omitempty"`
+
+	Automate *bool `json:",omitempty"`
+	Lock     *bool `json:",omitempty"`
+	// TagFilter is a glob which tags must match for automation to
+	// release them; the empty string removes the filter.
+	TagFilter *string `json:",omitempty"`
+	// MinImageAge is how many minutes old images must be to be
+	// released as the latest; zero removes the minimum.
+	MinImageAge *int `json:",omitempty"`
+	// NewerOnly says whether images must have been built after the
+	// image running to be released as the latest.
+	NewerOnly *bool `json:",omitempty"`
+	// RestartEvery is how often (as a duration) the services are
+	// restarted; the empty string stops them being restarted.
+	RestartEvery *string `json:",omitempty"`
+	// ReleaseInterval is the least time (as a duration) between
+	// releases of the services; the empty string removes the limit.
+	ReleaseInterval *string `json:",omitempty"`
+}
+
+// PolicyResult says what happened when updating the policies of a
+// service.
+type PolicyResult struct {
+	Service ServiceID
+	Error   string `json:",omitempty"`
+}
+
+// UnmanagedResource is a service which is running but isn't defined
+// in the config repo, or is defined there but isn't running; either
+// way, flux can't release it.
+type UnmanagedResource struct {
+	Service ServiceID
+	Reason  string // UnmanagedNotInRepo or UnmanagedNotRunning
+	// Files are those in the config repo defining the service, if
+	// it's not running.
+	Files []string `json:",omitempty"`
+	// SuggestedPath is where in the config repo the service might be
+	// defined, if it's not; it's next to the definitions of other
+	// services in the same namespace, where there are any.
+	SuggestedPath string `json:",omitempty"`
+}
+
+const (
+	UnmanagedNotInRepo  = "not_in_repo"
+	UnmanagedNotRunning = "not_running"
+)
+
+// AutomationCheck says what automation would do about a container of
+// an automated service, were it to run now: whether it'd be released,
+// to which image, and if not, why not. Reason is one of the reasons
+// releases give for skipping a container, or one of the Automation*
+// reasons; where the reason is about the service as a whole, there's
+// no Container.
+type AutomationCheck struct {
+	Service   ServiceID
+	Container string `json:",omitempty"`
+	Current   ImageID
+	// Latest is the latest image which may be released to the
+	// container, taking its tag filter into account.
+	Latest  ImageID
+	Release bool
+	Reason  string `json:",omitempty"`
+	Message string `json:",omitempty"`
+	// HeldUntil is when the service may next be released, if it's
+	// held back by its release interval.
+	HeldUntil *time.Time `json:",omitempty"`
+}
+
+const (
+	AutomationNotRunning       = "not_running"
+	AutomationNoMatchingImages = "no_matching_images"
+	AutomationRegistryError    = "registry_error"
+	AutomationReleaseInterval  = "release_interval"
+)
+
+// DesiredState is what an instance is configured to run: each service
+// defined in its config repo, with the images its containers are to
+// run, the policies it's under, and the files defining it. It's for
+// backing up, and for other tools to reconcile against.
+type DesiredState struct {
+	Instance InstanceID `json:"instance" yaml:"instance"`
+	// Repo, Branch and Path are the config repo the services are
+	// defined in, and Revision the commit they were read from.
+	Repo     string           `json:"repo" yaml:"repo"`
+	Branch   string           `json:"branch" yaml:"branch"`
+	Path     string           `json:"path,omitempty" yaml:"path,omitempty"`
+	Revision string           `json:"revision" yaml:"revision"`
+	Services []DesiredService `json:"services" yaml:"services"`
+}
+
+// DesiredService is a service as it's defined in the config repo, and
+// the policies it's under. Files are relative to the config repo path.
+type DesiredService struct {
+	ID              ServiceID          `json:"id" yaml:"id"`
+	Files           []string           `json:"files" yaml:"files"`
+	Containers      []DesiredContainer `json:"containers,omitempty" yaml:"containers,omitempty"`
+	Automated       bool               `json:"automated,omitempty" yaml:"automated,omitempty"`
+	Locked          bool               `json:"locked,omitempty" yaml:"locked,omitempty"`
+	TagFilter       string             `json:"tagFilter,omitempty" yaml:"tagFilter,omitempty"`
+	MinImageAge     int                `json:"minImageAge,omitempty" yaml:"minImageAge,omitempty"` // in minutes
+	NewerOnly       bool               `json:"newerOnly,omitempty" yaml:"newerOnly,omitempty"`
+	RestartEvery    string             `json:"restartEvery,omitempty" yaml:"restartEvery,omitempty"`
+	ReleaseInterval string             `json:"releaseInterval,omitempty" yaml:"releaseInterval,omitempty"`
+}
+
+// DesiredContainer is a container as it's defined in the config repo.
+type DesiredContainer struct {
+	Name  string `json:"name" yaml:"name"`
+	Image string `json:"image" yaml:"image"`
+}
+
+// Replicas counts the replicas of a service's pod controller.
+type Replicas struct {
+	Desired   int
+	Current   int
+	Available int
 }
 
 func (s ServiceStatus) Policies() string {
@@ -269,6 +561,101 @@ type Container struct {
 type ImageDescription struct {
 	ID        ImageID
 	CreatedAt *time.Time `json:",omitempty"`
+	// Labels are those the registry reports for the image, if any
+	Labels map[string]string `json:",omitempty"`
+	// Warning says why the image isn't described fully, if it isn't;
+	// e.g., because the registry couldn't say when it was created,
+	// so it's been ordered by its tag instead.
+	Warning string `json:",omitempty"`
+}
+
+// ImageRelease records a release changing the image run by one
+// container of a service. Digests are given where they are known.
+type ImageRelease struct {
+	Service    ServiceID
+	Container  string
+	From       ImageID
+	To         ImageID
+	FromDigest string `json:",omitempty"`
+	ToDigest   string `json:",omitempty"`
+	Revision   string `json:",omitempty"` // of the commit to the config repo
+	Branch     string `json:",omitempty"` // of the config repo
+	// ToCreatedAt is when the image released was built, if known.
+	ToCreatedAt *time.Time `json:",omitempty"`
+	// Failed is set if the release of the image didn't succeed.
+	Failed bool `json:",omitempty"`
+	Stamp  time.Time
+}
+
+// SuspectImage is an image whose release to a service was rolled back,
+// whether automatically, because the release failed, or by hand, by
+// releasing the image it replaced. It isn't released to the service as
+// the latest image again until someone confirms it's good.
+type SuspectImage struct {
+	Image  ImageID
+	Reason string
+	Since  time.Time
+}
+
+// DeploymentMetrics summarise the releases made to an instance, or
+// to a service, over a period.
+type DeploymentMetrics struct {
+	Service           ServiceID `json:",omitempty"` // empty for the whole instance
+	Deployments       int
+	DeploymentsPerDay float64
+	// Lead time is from an image being built to it being released;
+	// it's only known for images with a creation time.
+	MeanLeadTimeSeconds float64 `json:",omitempty"`
+	Failures            int
+	ChangeFailureRate   float64
+}
+
+// DeploymentReport gives the deployment metrics for an instance, and
+// for each service in it, over a period.
+type DeploymentReport struct {
+	Since    time.Time
+	Until    time.Time
+	Instance DeploymentMetrics
+	Services []DeploymentMetrics
+}
+
+// UsageReport gives what an instance used of the service each day of
+// a period, e.g., for charging it back to the team running the
+// instance.
+type UsageReport struct {
+	Since time.Time
+	Until time.Time
+	Days  []UsageDay
+	Total UsageDay
+}
+
+// UsageDay is what an instance used in a day (in UTC): the releases it
+// executed, the requests made to image registries and the git
+// operations done on its behalf, and the minutes its daemon was
+// connected. In a report's total, Day is the start of the period.
+type UsageDay struct {
+	Day              time.Time
+	Releases         int64
+	RegistryRequests int64
+	GitOperations    int64
+	DaemonMinutes    int64
+}
+
+// Add adds the usage of another day to this.
+func (d *UsageDay) Add(other UsageDay) {
+	d.Releases += other.Releases
+	d.RegistryRequests += other.RegistryRequests
+	d.GitOperations += other.GitOperations
+	d.DaemonMinutes += other.DaemonMinutes
+}
+
+// TimelineQuery selects the image releases that make up a deployment
+// timeline. Zero-valued fields don't restrict the selection.
+type TimelineQuery struct {
+	Service ServiceID
+	Branch  string
+	Since   time.Time
+	Until   time.Time
 }
 
 // Ask me for more details.
@@ -0,0 +1,85 @@
+package flux
+
+import (
+	"testing"
+)
+
+func TestServiceSpecIsPattern(t *testing.T) {
+	for spec, expected := range map[ServiceSpec]bool{
+		"default/helloworld":    false,
+		"default/*":             true,
+		"*/helloworld":          true,
+		"default/hello?orld":    true,
+		"default/[hw]elloworld": true,
+		"/^default/":            true,
+		"/":                     false, // too short to be a regexp
+		"//":                    false,
+		"default/helloworld/":   false, // not a regexp, since it doesn't start with /
+	} {
+		if got := spec.IsPattern(); got != expected {
+			t.Errorf("expected IsPattern of %q to be %v, got %v", spec, expected, got)
+		}
+	}
+}
+
+func TestServiceSpecMatcher(t *testing.T) {
+	for _, c := range []struct {
+		spec    ServiceSpec
+		matches []ServiceID
+		misses  []ServiceID
+	}{
+		{"default/helloworld", []ServiceID{"default/helloworld"}, []ServiceID{"default/helloworld2", "other/helloworld"}},
+		{"default/*", []ServiceID{"default/helloworld", "default/a"}, []ServiceID{"other/helloworld"}},
+		// A glob's * doesn't cross /
+		{"*", nil, []ServiceID{"default/helloworld"}},
+		{"*/helloworld", []ServiceID{"default/helloworld", "other/helloworld"}, []ServiceID{"default/helloworld2"}},
+		{"default/hello-[0-9]", []ServiceID{"default/hello-1"}, []ServiceID{"default/hello-a", "default/hello-10"}},
+		// A regexp is unanchored, unless it says otherwise, and can
+		// match across /
+		{"/hello/", []ServiceID{"default/helloworld", "other/say-hello"}, []ServiceID{"default/goodbye"}},
+		{"/^default/.*world$/", []ServiceID{"default/helloworld"}, []ServiceID{"other/helloworld", "default/world2"}},
+	} {
+		m, err := c.spec.Matcher()
+		if err != nil {
+			t.Errorf("%q: %v", c.spec, err)
+			continue
+		}
+		for _, id := range c.matches {
+			if !m(id) {
+				t.Errorf("expected %q to match %s", c.spec, id)
+			}
+		}
+		for _, id := range c.misses {
+			if m(id) {
+				t.Errorf("expected %q not to match %s", c.spec, id)
+			}
+		}
+	}
+}
+
+func TestParseServiceSpec(t *testing.T) {
+	for _, s := range []string{
+		"<all>",
+		"default/helloworld",
+		"default/*",
+		"/^default/",
+		"<using:quay.io/weaveworks/helloworld>",
+	} {
+		if _, err := ParseServiceSpec(s); err != nil {
+			t.Errorf("expected %q to parse, got %v", s, err)
+		}
+	}
+	for _, s := range []string{
+		"helloworld",   // no namespace
+		"default/[a-",  // bad glob
+		"default/[]",   // empty class
+		"default/a\\",  // trailing escape
+		"/default/(a/", // bad regexp
+		"<using:>",     // no repository
+		"",
+	} {
+		if _, err := ParseServiceSpec(s); err == nil {
+			t.Errorf("expected %q to be refused", s)
+		}
+	}
+}
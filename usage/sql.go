@@ -0,0 +1,123 @@
+package usage
+
+import (
+	"database/sql"
+	"time"
+
+	_ "github.com/cznic/ql/driver"
+	_ "github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+// SQLStore keeps usage in the instance_usage table, a row for each
+// instance, day and kind of usage.
+type SQLStore struct {
+	conn *sql.DB
+}
+
+func NewSQLStore(driver, datasource string) (*SQLStore, error) {
+	conn, err := sql.Open(driver, datasource)
+	if err != nil {
+		return nil, err
+	}
+	s := &SQLStore{conn: conn}
+	return s, s.sanityCheck()
+}
+
+func (s *SQLStore) Add(day time.Time, amounts []Amount) error {
+	day = Day(day)
+	err := s.transaction(func(tx *sql.Tx) error {
+		for _, a := range amounts {
+			res, err := tx.Exec(`
+				UPDATE instance_usage SET amount = amount + $1
+				 WHERE instance_id = $2 AND day = $3 AND kind = $4
+			`, a.N, string(a.Instance), day, a.Kind)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				continue
+			}
+			if _, err := tx.Exec(`
+				INSERT INTO instance_usage (instance_id, day, kind, amount)
+				VALUES ($1, $2, $3, $4)
+			`, string(a.Instance), day, a.Kind, a.N); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return errors.Wrap(err, "recording usage")
+}
+
+func (s *SQLStore) Usage(inst flux.InstanceID, since, until time.Time) ([]flux.UsageDay, error) {
+	rows, err := s.conn.Query(`
+		SELECT day, kind, amount
+		  FROM instance_usage
+		 WHERE instance_id = $1 AND day >= $2 AND day <= $3
+		 ORDER BY day
+	`, string(inst), Day(since), Day(until))
+	if err != nil {
+		return nil, errors.Wrap(err, "querying usage")
+	}
+	defer rows.Close()
+
+	days := []flux.UsageDay{}
+	for rows.Next() {
+		var (
+			day    time.Time
+			kind   string
+			amount int64
+		)
+		if err := rows.Scan(&day, &kind, &amount); err != nil {
+			return nil, err
+		}
+		day = day.UTC()
+		if len(days) == 0 || !days[len(days)-1].Day.Equal(day) {
+			days = append(days, flux.UsageDay{Day: day})
+		}
+		d := &days[len(days)-1]
+		switch kind {
+		case Releases:
+			d.Releases += amount
+		case RegistryRequests:
+			d.RegistryRequests += amount
+		case GitOperations:
+			d.GitOperations += amount
+		case DaemonMinutes:
+			d.DaemonMinutes += amount
+		}
+	}
+	return days, rows.Err()
+}
+
+func (s *SQLStore) transaction(f func(*sql.Tx) error) error {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Ping checks the database can be reached.
+func (s *SQLStore) Ping() error {
+	return s.conn.Ping()
+}
+
+func (s *SQLStore) sanityCheck() error {
+	_, err := s.conn.Query(`SELECT instance_id FROM instance_usage LIMIT 1`)
+	if err != nil {
+		return errors.Wrap(err, "failed sanity check for instance_usage table")
+	}
+	return nil
+}
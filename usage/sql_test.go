@@ -0,0 +1,116 @@
+package usage
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/db"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+func newStore(t *testing.T) *SQLStore {
+	f, err := ioutil.TempFile("", "fluxy-testdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbsource := "file://" + f.Name()
+	if _, err = db.Migrate(dbsource, "../db/migrations"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSQLStore("ql", dbsource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAddUsage(t *testing.T) {
+	s := newStore(t)
+	inst := flux.InstanceID("floaty-womble-abc123")
+	yesterday := time.Date(2017, 6, 1, 23, 59, 0, 0, time.UTC)
+	today := yesterday.Add(2 * time.Minute)
+
+	for _, add := range []struct {
+		day     time.Time
+		amounts []Amount
+	}{
+		{yesterday, []Amount{{inst, Releases, 2}, {"other", Releases, 5}}},
+		{today, []Amount{{inst, Releases, 1}, {inst, GitOperations, 3}}},
+		{today, []Amount{{inst, GitOperations, 4}, {inst, DaemonMinutes, 60}}},
+	} {
+		if err := s.Add(add.day, add.amounts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	days, err := s.Usage(inst, yesterday, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 2 {
+		t.Fatalf("expected usage for two days, got %+v", days)
+	}
+	if !days[0].Day.Equal(Day(yesterday)) || days[0].Releases != 2 || days[0].GitOperations != 0 {
+		t.Errorf("unexpected usage for yesterday %+v", days[0])
+	}
+	if !days[1].Day.Equal(Day(today)) || days[1].Releases != 1 || days[1].GitOperations != 7 || days[1].DaemonMinutes != 60 {
+		t.Errorf("unexpected usage for today %+v", days[1])
+	}
+
+	days, err = s.Usage(inst, today, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 1 {
+		t.Errorf("expected usage for today only, got %+v", days)
+	}
+}
+
+type failingStore struct {
+	Store
+	fail bool
+}
+
+func (s *failingStore) Add(day time.Time, amounts []Amount) error {
+	if s.fail {
+		return errors.New("store unavailable")
+	}
+	return s.Store.Add(day, amounts)
+}
+
+func TestRecorderFlush(t *testing.T) {
+	store := &failingStore{Store: newStore(t), fail: true}
+	r := NewRecorder(store, nil, fluxmetrics.LabelPolicy{}, log.NewNopLogger())
+	inst := flux.InstanceID("floaty-womble-abc123")
+
+	r.Add(inst, RegistryRequests, 3)
+	r.Add(inst, RegistryRequests, 2)
+	r.Add(inst, Releases, 0)
+	if err := r.Flush(); err == nil {
+		t.Fatal("expected an error flushing to a failing store")
+	}
+
+	// What couldn't be flushed is kept for next time.
+	store.fail = false
+	r.Add(inst, RegistryRequests, 1)
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	days, err := store.Usage(inst, now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 1 || days[0].RegistryRequests != 6 || days[0].Releases != 0 {
+		t.Errorf("unexpected usage %+v", days)
+	}
+}
@@ -0,0 +1,177 @@
+// Package usage meters what each instance uses of the service
+// (releases, registry requests, git operations and the time its daemon
+// is connected), so that the cost of running it for many teams can be
+// shown back, or charged back, to them.
+package usage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+
+	"github.com/weaveworks/flux"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+// The kinds of usage metered. These are stored, so shouldn't be
+// changed.
+const (
+	Releases         = "releases"
+	RegistryRequests = "registry_requests"
+	GitOperations    = "git_operations"
+	DaemonMinutes    = "daemon_minutes"
+)
+
+// LabelKind is the label for the kind of usage.
+const LabelKind = "kind"
+
+// Meter records what instances use.
+type Meter interface {
+	Add(inst flux.InstanceID, kind string, n int64)
+}
+
+// NopMeter records nothing.
+type NopMeter struct{}
+
+func (NopMeter) Add(flux.InstanceID, string, int64) {}
+
+// Store keeps what instances have used, by the (UTC) day.
+type Store interface {
+	// Add adds the amounts given to those already recorded for the
+	// day.
+	Add(day time.Time, amounts []Amount) error
+	// Usage gives what the instance used each day from that of since
+	// to that of until, inclusive; days on which it used nothing are
+	// left out.
+	Usage(inst flux.InstanceID, since, until time.Time) ([]flux.UsageDay, error)
+}
+
+// Amount is how much of a kind of usage an instance used.
+type Amount struct {
+	Instance flux.InstanceID
+	Kind     string
+	N        int64
+}
+
+// Day gives the day, in UTC, that a time falls in.
+func Day(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Recorder is a Meter which keeps what's used in memory, and adds it to
+// the store now and then, so that metering doesn't slow down what's
+// metered. It also counts what's used in Prometheus, if given a
+// counter.
+type Recorder struct {
+	store   Store
+	counter metrics.Counter
+	labels  fluxmetrics.LabelPolicy
+	logger  log.Logger
+
+	mu      sync.Mutex
+	pending map[time.Time]map[key]int64
+}
+
+type key struct {
+	inst flux.InstanceID
+	kind string
+}
+
+// NewRecorder makes a recorder for the store given. The counter may be
+// nil; if not, it's labelled with the instance and kind.
+func NewRecorder(store Store, counter metrics.Counter, labels fluxmetrics.LabelPolicy, logger log.Logger) *Recorder {
+	return &Recorder{
+		store:   store,
+		counter: counter,
+		labels:  labels,
+		logger:  logger,
+		pending: map[time.Time]map[key]int64{},
+	}
+}
+
+func (r *Recorder) Add(inst flux.InstanceID, kind string, n int64) {
+	if n <= 0 {
+		return
+	}
+	if r.counter != nil {
+		r.counter.With(
+			fluxmetrics.LabelInstanceID, r.labels.Instance(string(inst)),
+			LabelKind, kind,
+		).Add(float64(n))
+	}
+	day := Day(time.Now())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	amounts, ok := r.pending[day]
+	if !ok {
+		amounts = map[key]int64{}
+		r.pending[day] = amounts
+	}
+	amounts[key{inst, kind}] += n
+}
+
+// Flush adds what's been used since it was last called to the store.
+// If the store can't be written to, the usage is kept, to be added
+// next time.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = map[time.Time]map[key]int64{}
+	r.mu.Unlock()
+
+	var firstErr error
+	for day, amounts := range pending {
+		var batch []Amount
+		for k, n := range amounts {
+			batch = append(batch, Amount{Instance: k.inst, Kind: k.kind, N: n})
+		}
+		if err := r.store.Add(day, batch); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			r.mu.Lock()
+			if r.pending[day] == nil {
+				r.pending[day] = map[key]int64{}
+			}
+			for k, n := range amounts {
+				r.pending[day][k] += n
+			}
+			r.mu.Unlock()
+		}
+	}
+	return firstErr
+}
+
+// Record flushes what's been used to the store each time the ticker
+// ticks.
+func (r *Recorder) Record(tick <-chan time.Time) {
+	for range tick {
+		if err := r.Flush(); err != nil {
+			r.logger.Log("err", err)
+		}
+	}
+}
+
+// Counting gives a histogram which, as well as observing into the one
+// given, calls count for each observation; e.g., to meter requests
+// whose durations are observed.
+func Counting(h metrics.Histogram, count func()) metrics.Histogram {
+	return countingHistogram{h, count}
+}
+
+type countingHistogram struct {
+	metrics.Histogram
+	count func()
+}
+
+func (h countingHistogram) With(labelValues ...string) metrics.Histogram {
+	return countingHistogram{h.Histogram.With(labelValues...), h.count}
+}
+
+func (h countingHistogram) Observe(value float64) {
+	h.Histogram.Observe(value)
+	h.count()
+}
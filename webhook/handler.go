@@ -0,0 +1,153 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+)
+
+// Webhooks are small; anything much bigger is refused.
+const maxBodySize = 1 << 20
+
+// Releaser submits releases; it's satisfied by api.ClientService.
+type Releaser interface {
+	PostRelease(flux.InstanceID, jobs.ReleaseJobParams) (jobs.JobID, error)
+}
+
+// ConfigGetter gives the settings of an instance.
+type ConfigGetter func(flux.InstanceID) (flux.UnsafeInstanceConfig, error)
+
+// TriggerHandler lets other systems (e.g., CI) submit releases, by
+// webhook, to the instance named in the path, as
+// "<instance>/release". The request is signed with one of the
+// instance's webhook secrets, and its body says what to release, as
+// JSON (see triggerRequest).
+type TriggerHandler struct {
+	releaser Releaser
+	configs  ConfigGetter
+	verifier *Verifier
+	logger   log.Logger
+}
+
+// NewTriggerHandler makes a handler which remembers the nonces of the
+// requests it's sent in the store given (see NewVerifier).
+func NewTriggerHandler(releaser Releaser, configs ConfigGetter, nonces NonceStore, logger log.Logger) *TriggerHandler {
+	return &TriggerHandler{
+		releaser: releaser,
+		configs:  configs,
+		verifier: NewVerifier(nonces),
+		logger:   logger,
+	}
+}
+
+// triggerRequest is what a webhook may ask for: which services to
+// release, and to which images. The other release parameters are
+// either flux's own bookkeeping, or not for webhooks to set.
+type triggerRequest struct {
+	ServiceSpec  flux.ServiceSpec // For backwards compatibility
+	ServiceSpecs []flux.ServiceSpec
+	ImageSpec    flux.ImageSpec
+	Kind         flux.ReleaseKind
+	Excludes     []flux.ServiceID
+	User         string
+}
+
+// validate checks what's asked for parses, as it would have to if
+// given to fluxctl.
+func (req triggerRequest) validate() error {
+	specs := req.ServiceSpecs
+	if req.ServiceSpec != "" {
+		specs = append([]flux.ServiceSpec{req.ServiceSpec}, specs...)
+	}
+	for _, spec := range specs {
+		if _, err := flux.ParseServiceSpec(string(spec)); err != nil {
+			return errors.Wrapf(err, "parsing service spec %q", spec)
+		}
+	}
+	if _, err := flux.ParseImageSpec(string(req.ImageSpec)); err != nil {
+		return errors.Wrapf(err, "parsing image spec %q", req.ImageSpec)
+	}
+	if _, err := flux.ParseReleaseKind(string(req.Kind)); err != nil {
+		return errors.Wrapf(err, "parsing release kind %q", req.Kind)
+	}
+	return nil
+}
+
+type triggerResponse struct {
+	ReleaseID jobs.JobID `json:"release_id"`
+}
+
+func (h *TriggerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || parts[1] != "release" {
+		http.NotFound(w, r)
+		return
+	}
+	inst := flux.InstanceID(parts[0])
+	logger := log.NewContext(h.logger).With("instance", inst)
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.configs(inst)
+	if err != nil {
+		logger.Log("err", errors.Wrap(err, "getting instance config"))
+		http.Error(w, "unknown instance", http.StatusNotFound)
+		return
+	}
+	if settings.Webhooks == nil || !settings.Webhooks.Triggers {
+		http.Error(w, "webhook triggers are not enabled for this instance", http.StatusNotFound)
+		return
+	}
+	if err := h.verifier.Verify(string(inst), r.Header, body, settings.Webhooks.Secrets); err != nil {
+		logger.Log("err", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req triggerRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, errors.Wrap(err, "decoding release parameters").Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := jobs.ReleaseJobParams{
+		ServiceSpec:  req.ServiceSpec,
+		ServiceSpecs: req.ServiceSpecs,
+		ImageSpec:    req.ImageSpec,
+		Kind:         req.Kind,
+		Excludes:     req.Excludes,
+		User:         req.User,
+	}
+	if params.User == "" {
+		params.User = "webhook"
+	}
+	id, err := h.releaser.PostRelease(inst, params)
+	if err != nil {
+		logger.Log("err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Log("webhook", "release", "release_id", id, "user", params.User)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(triggerResponse{ReleaseID: id})
+}
@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+)
+
+type recordingReleaser struct {
+	released []jobs.ReleaseJobParams
+}
+
+func (r *recordingReleaser) PostRelease(_ flux.InstanceID, params jobs.ReleaseJobParams) (jobs.JobID, error) {
+	r.released = append(r.released, params)
+	return jobs.JobID("release"), nil
+}
+
+func TestTriggerHandlerOnlyTakesWhatToRelease(t *testing.T) {
+	releaser := &recordingReleaser{}
+	h := NewTriggerHandler(releaser, func(flux.InstanceID) (flux.UnsafeInstanceConfig, error) {
+		return flux.UnsafeInstanceConfig{
+			Webhooks: &flux.WebhooksConfig{Triggers: true, Secrets: []string{"secret"}},
+		}, nil
+	}, nil, log.NewNopLogger())
+
+	body := []byte(`{
+		"ServiceSpecs": ["default/helloworld"],
+		"ImageSpec": "<all latest>",
+		"Kind": "execute",
+		"CompletedActions": ["clone", "commit_and_push"],
+		"Plan": [{"Name": "printf", "Description": "Nothing to do."}],
+		"ChangeTicket": "CHG123",
+		"Skipped": [{"Service": "default/helloworld", "Reason": "locked"}]
+	}`)
+	req, err := http.NewRequest("POST", "/inst/release", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Sign(req, body, []string{"secret"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected OK, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if len(releaser.released) != 1 {
+		t.Fatalf("expected one release, got %+v", releaser.released)
+	}
+	params := releaser.released[0]
+	if len(params.ServiceSpecs) != 1 || params.ServiceSpecs[0] != "default/helloworld" || params.Kind != flux.ReleaseKindExecute || params.User != "webhook" {
+		t.Errorf("expected the release asked for, got %+v", params)
+	}
+	if params.CompletedActions != nil || params.Plan != nil || params.ChangeTicket != "" || params.Skipped != nil {
+		t.Errorf("expected flux's own release parameters to be left out, got %+v", params)
+	}
+}
+
+func TestTriggerHandlerRefusesInvalidRelease(t *testing.T) {
+	for _, body := range []string{
+		`{"ServiceSpecs": ["not a service"], "ImageSpec": "<all latest>", "Kind": "execute"}`,
+		`{"ServiceSpecs": ["default/helloworld"], "ImageSpec": "", "Kind": "execute"}`,
+		`{"ServiceSpecs": ["default/helloworld"], "ImageSpec": "<all latest>", "Kind": "now"}`,
+	} {
+		releaser := &recordingReleaser{}
+		h := NewTriggerHandler(releaser, func(flux.InstanceID) (flux.UnsafeInstanceConfig, error) {
+			return flux.UnsafeInstanceConfig{
+				Webhooks: &flux.WebhooksConfig{Triggers: true, Secrets: []string{"secret"}},
+			}, nil
+		}, nil, log.NewNopLogger())
+		req, err := http.NewRequest("POST", "/inst/release", bytes.NewReader([]byte(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Sign(req, []byte(body), []string{"secret"}, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected %s to be refused, got %d: %s", body, rec.Code, rec.Body.String())
+		}
+		if len(releaser.released) != 0 {
+			t.Errorf("expected nothing released for %s, got %+v", body, releaser.released)
+		}
+	}
+}
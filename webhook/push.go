@@ -0,0 +1,189 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+)
+
+// Syncer brings an instance up to date with its config repo, given
+// the revision pushed.
+type Syncer interface {
+	SyncConfigRepo(_ flux.InstanceID, revision string) (jobs.JobID, error)
+}
+
+// PushHandler receives the push events GitHub and GitLab send when the
+// config repo is pushed to, at "<instance>" under the path it's served
+// at, so that instances are synced with their config repos as soon as
+// they change. GitHub events are verified by their signature, made
+// with one of the instance's webhook secrets; GitLab events carry the
+// secret itself. Pushes to branches other than that of the config
+// repo are ignored.
+type PushHandler struct {
+	syncer  Syncer
+	configs ConfigGetter
+	logger  log.Logger
+}
+
+func NewPushHandler(syncer Syncer, configs ConfigGetter, logger log.Logger) *PushHandler {
+	return &PushHandler{
+		syncer:  syncer,
+		configs: configs,
+		logger:  logger,
+	}
+}
+
+const (
+	githubEventHeader     = "X-GitHub-Event"
+	githubSignatureHeader = "X-Hub-Signature"     // "sha1=<hex>"
+	githubSignature256    = "X-Hub-Signature-256" // "sha256=<hex>"
+	gitlabEventHeader     = "X-Gitlab-Event"
+	gitlabTokenHeader     = "X-Gitlab-Token"
+)
+
+// pushEvent has the fields of push events common to GitHub and GitLab.
+type pushEvent struct {
+	Ref   string `json:"ref"`
+	After string `json:"after"`
+}
+
+// deletedRevision is what "after" is when a branch is deleted.
+const deletedRevision = "0000000000000000000000000000000000000000"
+
+type pushResponse struct {
+	SyncID jobs.JobID `json:"sync_id,omitempty"`
+	Status string     `json:"status"`
+}
+
+func (h *PushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 1 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	inst := flux.InstanceID(parts[0])
+	logger := log.NewContext(h.logger).With("instance", inst)
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.configs(inst)
+	if err != nil {
+		logger.Log("err", errors.Wrap(err, "getting instance config"))
+		http.Error(w, "unknown instance", http.StatusNotFound)
+		return
+	}
+	if settings.Webhooks == nil || !settings.Webhooks.GitPush {
+		http.Error(w, "git push webhooks are not enabled for this instance", http.StatusNotFound)
+		return
+	}
+	event, err := verifyPush(r.Header, body, settings.Webhooks.Secrets)
+	if err != nil {
+		logger.Log("err", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	switch event {
+	case "push", "Push Hook":
+	case "ping":
+		respondPush(w, pushResponse{Status: "pong"})
+		return
+	default:
+		respondPush(w, pushResponse{Status: fmt.Sprintf("ignored %q event", event)})
+		return
+	}
+
+	var push pushEvent
+	if err := json.Unmarshal(body, &push); err != nil {
+		http.Error(w, errors.Wrap(err, "decoding push event").Error(), http.StatusBadRequest)
+		return
+	}
+	branch := settings.Git.Branch
+	if branch == "" {
+		branch = "master"
+	}
+	if push.Ref != "refs/heads/"+branch || push.After == deletedRevision {
+		respondPush(w, pushResponse{Status: fmt.Sprintf("ignored push to %s", push.Ref)})
+		return
+	}
+
+	id, err := h.syncer.SyncConfigRepo(inst, push.After)
+	switch err {
+	case nil:
+		logger.Log("webhook", "push", "revision", push.After, "sync_id", id)
+		respondPush(w, pushResponse{SyncID: id, Status: "syncing"})
+	case jobs.ErrJobAlreadyQueued:
+		respondPush(w, pushResponse{Status: "already queued"})
+	default:
+		logger.Log("err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func respondPush(w http.ResponseWriter, res pushResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(res)
+}
+
+// verifyPush checks that a push event was sent by someone with one of
+// the secrets, and gives the kind of event.
+func verifyPush(header http.Header, body []byte, secrets []string) (string, error) {
+	if event := header.Get(gitlabEventHeader); event != "" {
+		token := header.Get(gitlabTokenHeader)
+		if token == "" {
+			return "", ErrNoSignature
+		}
+		for _, secret := range secrets {
+			if hmac.Equal([]byte(token), []byte(secret)) {
+				return event, nil
+			}
+		}
+		return "", ErrBadSignature
+	}
+
+	event := header.Get(githubEventHeader)
+	if event == "" {
+		return "", errors.New("not a GitHub or GitLab event")
+	}
+	var (
+		sig     string
+		newHash func() hash.Hash
+	)
+	if s := header.Get(githubSignature256); strings.HasPrefix(s, "sha256=") {
+		sig, newHash = strings.TrimPrefix(s, "sha256="), sha256.New
+	} else if s := header.Get(githubSignatureHeader); strings.HasPrefix(s, "sha1=") {
+		sig, newHash = strings.TrimPrefix(s, "sha1="), sha1.New
+	} else {
+		return "", ErrNoSignature
+	}
+	for _, secret := range secrets {
+		mac := hmac.New(newHash, []byte(secret))
+		mac.Write(body)
+		if hmac.Equal([]byte(sig), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+			return event, nil
+		}
+	}
+	return "", ErrBadSignature
+}
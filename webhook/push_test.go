@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+)
+
+type recordingSyncer struct {
+	synced []string
+}
+
+func (s *recordingSyncer) SyncConfigRepo(_ flux.InstanceID, revision string) (jobs.JobID, error) {
+	s.synced = append(s.synced, revision)
+	return jobs.JobID("sync"), nil
+}
+
+func githubPush(t *testing.T, body, secret string) *http.Request {
+	req, err := http.NewRequest("POST", "/inst", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	req.Header.Set(githubEventHeader, "push")
+	req.Header.Set(githubSignature256, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestPushHandler(t *testing.T) {
+	syncer := &recordingSyncer{}
+	h := NewPushHandler(syncer, func(flux.InstanceID) (flux.UnsafeInstanceConfig, error) {
+		return flux.UnsafeInstanceConfig{
+			Git:      flux.GitConfig{Branch: "deploy"},
+			Webhooks: &flux.WebhooksConfig{GitPush: true, Secrets: []string{"secret"}},
+		}, nil
+	}, log.NewNopLogger())
+
+	gitlab, err := http.NewRequest("POST", "/inst", bytes.NewBufferString(`{"ref":"refs/heads/deploy","after":"def456"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitlab.Header.Set(gitlabEventHeader, "Push Hook")
+	gitlab.Header.Set(gitlabTokenHeader, "secret")
+
+	for i, c := range []struct {
+		req    *http.Request
+		status int
+	}{
+		{githubPush(t, `{"ref":"refs/heads/deploy","after":"abc123"}`, "secret"), http.StatusOK},
+		{gitlab, http.StatusOK},
+		{githubPush(t, `{"ref":"refs/heads/master","after":"abc124"}`, "secret"), http.StatusOK}, // ignored
+		{githubPush(t, `{"ref":"refs/heads/deploy","after":"abc125"}`, "wrong"), http.StatusUnauthorized},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, c.req)
+		if w.Code != c.status {
+			t.Errorf("%d: expected status %d, got %d: %s", i, c.status, w.Code, w.Body.String())
+		}
+	}
+	if len(syncer.synced) != 2 || syncer.synced[0] != "abc123" || syncer.synced[1] != "def456" {
+		t.Errorf("expected the pushes to the branch to be synced, got %v", syncer.synced)
+	}
+}
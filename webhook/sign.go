@@ -0,0 +1,175 @@
+// Package webhook signs the webhook requests flux sends, and verifies
+// those it's sent, with secrets shared with the other end.
+//
+// A request is signed by its timestamp, a nonce, and its body, with
+// HMAC-SHA256. Requests are refused if the timestamp is too far from
+// now, or if the nonce has been seen before, so they can't be
+// replayed.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	TimestampHeader = "X-Flux-Timestamp" // in seconds since the epoch
+	NonceHeader     = "X-Flux-Nonce"
+	SignatureHeader = "X-Flux-Signature" // "v1=<hex>", comma-separated if there's more than one
+
+	signatureVersion = "v1"
+	// MaxAge is how far from now a request's timestamp may be.
+	MaxAge = 5 * time.Minute
+)
+
+var (
+	ErrNoSignature  = errors.New("request is not signed")
+	ErrBadSignature = errors.New("request signature does not match")
+	ErrReplayed     = errors.New("request has been seen before")
+)
+
+// Sign sets the headers of a request, with the body given, to sign it
+// with each of the secrets, so whoever it's sent to need only have
+// one of them.
+func Sign(req *http.Request, body []byte, secrets []string, now time.Time) error {
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+	stamp := strconv.FormatInt(now.Unix(), 10)
+	var sigs []string
+	for _, secret := range secrets {
+		sigs = append(sigs, signatureVersion+"="+signature(secret, stamp, nonce, body))
+	}
+	req.Header.Set(TimestampHeader, stamp)
+	req.Header.Set(NonceHeader, nonce)
+	req.Header.Set(SignatureHeader, strings.Join(sigs, ","))
+	return nil
+}
+
+func signature(secret, stamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s:%s:%s:", signatureVersion, stamp, nonce)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generating nonce")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NonceStore remembers the nonces of requests verified, so that they
+// can't be replayed. Replicas receiving the same webhooks must share
+// a store (e.g., an SQLNonceStore), or a request could be replayed to
+// each of them.
+type NonceStore interface {
+	// Seen records the nonce, to be remembered until the time given,
+	// and says whether it had already been recorded. Nonces which can
+	// be forgotten by now may be.
+	Seen(nonce string, until, now time.Time) (bool, error)
+}
+
+// memoryNonces keeps nonces in memory, so only refuses requests
+// replayed to the same process.
+type memoryNonces struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time // when each nonce seen can be forgotten
+}
+
+func (m *memoryNonces) Seen(nonce string, until, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for n, u := range m.nonces {
+		if now.After(u) {
+			delete(m.nonces, n)
+		}
+	}
+	if _, seen := m.nonces[nonce]; seen {
+		return true, nil
+	}
+	m.nonces[nonce] = until
+	return false, nil
+}
+
+// Verifier checks the signatures of requests received, and that they
+// haven't been received before.
+type Verifier struct {
+	now    func() time.Time
+	nonces NonceStore
+}
+
+// NewVerifier makes a verifier which remembers nonces in the store
+// given; if that's nil, in memory, which is only enough for a single
+// replica.
+func NewVerifier(nonces NonceStore) *Verifier {
+	if nonces == nil {
+		nonces = &memoryNonces{nonces: map[string]time.Time{}}
+	}
+	return &Verifier{
+		now:    time.Now,
+		nonces: nonces,
+	}
+}
+
+// Verify checks that the request, with the body given, was signed
+// with one of the secrets, recently, and hasn't been seen before. The
+// scope keeps the nonces of different senders (e.g., instances) apart.
+func (v *Verifier) Verify(scope string, header http.Header, body []byte, secrets []string) error {
+	stamp, nonce, sigs := header.Get(TimestampHeader), header.Get(NonceHeader), header.Get(SignatureHeader)
+	if stamp == "" || nonce == "" || sigs == "" {
+		return ErrNoSignature
+	}
+	seconds, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "parsing request timestamp")
+	}
+	now := v.now()
+	if age := now.Sub(time.Unix(seconds, 0)); age > MaxAge || age < -MaxAge {
+		return fmt.Errorf("request timestamp %s is too far from now", stamp)
+	}
+
+	if !matchesAny(sigs, secrets, stamp, nonce, body) {
+		return ErrBadSignature
+	}
+
+	// Only remember nonces of requests which are signed, so they
+	// can't be filled up by anyone. Once the timestamp is too old,
+	// the request would be refused anyway.
+	seen, err := v.nonces.Seen(scope+"/"+nonce, time.Unix(seconds, 0).Add(MaxAge), now)
+	if err != nil {
+		return errors.Wrap(err, "checking request nonce")
+	}
+	if seen {
+		return ErrReplayed
+	}
+	return nil
+}
+
+func matchesAny(header string, secrets []string, stamp, nonce string, body []byte) bool {
+	for _, sig := range strings.Split(header, ",") {
+		parts := strings.SplitN(strings.TrimSpace(sig), "=", 2)
+		if len(parts) != 2 || parts[0] != signatureVersion {
+			continue
+		}
+		for _, secret := range secrets {
+			if hmac.Equal([]byte(parts[1]), []byte(signature(secret, stamp, nonce, body))) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func signed(t *testing.T, body []byte, secrets []string, at time.Time) http.Header {
+	req, err := http.NewRequest("POST", "http://example.com/hook", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Sign(req, body, secrets, at); err != nil {
+		t.Fatal(err)
+	}
+	return req.Header
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	body := []byte(`{"Kind":"event"}`)
+
+	for i, c := range []struct {
+		signedWith []string
+		at         time.Time
+		ok         bool
+	}{
+		{[]string{"secret"}, now, true},
+		{[]string{"other secret"}, now, false},
+		{[]string{"new secret", "secret"}, now, true}, // rotating
+		{[]string{"secret"}, now.Add(-time.Hour), false},
+		{[]string{"secret"}, now.Add(time.Hour), false},
+	} {
+		v := NewVerifier(nil)
+		v.now = func() time.Time { return now }
+		err := v.Verify("inst", signed(t, body, c.signedWith, c.at), body, []string{"secret"})
+		if c.ok && err != nil {
+			t.Errorf("%d: expected request to be verified, got %v", i, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("%d: expected request to be refused", i)
+		}
+	}
+}
+
+func TestVerifyTamperedBody(t *testing.T) {
+	v := NewVerifier(nil)
+	header := signed(t, []byte("release a"), []string{"secret"}, time.Now())
+	if err := v.Verify("inst", header, []byte("release b"), []string{"secret"}); err != ErrBadSignature {
+		t.Errorf("expected ErrBadSignature, got %v", err)
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	v := NewVerifier(nil)
+	body := []byte("release")
+	header := signed(t, body, []string{"secret"}, time.Now())
+	if err := v.Verify("inst", header, body, []string{"secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify("inst", header, body, []string{"secret"}); err != ErrReplayed {
+		t.Errorf("expected ErrReplayed, got %v", err)
+	}
+	// The same nonce from another sender is another request.
+	if err := v.Verify("other", header, body, []string{"secret"}); err != nil {
+		t.Errorf("expected request for another scope to be verified, got %v", err)
+	}
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	v := NewVerifier(nil)
+	if err := v.Verify("inst", http.Header{}, nil, []string{"secret"}); err != ErrNoSignature {
+		t.Errorf("expected ErrNoSignature, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"database/sql"
+	"time"
+
+	_ "github.com/cznic/ql/driver"
+	_ "github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// SQLNonceStore keeps the nonces of webhook requests in the
+// webhook_nonces table, so that replicas sharing the DB refuse
+// requests replayed to any of them.
+type SQLNonceStore struct {
+	conn *sql.DB
+}
+
+func NewSQLNonceStore(driver, datasource string) (*SQLNonceStore, error) {
+	conn, err := sql.Open(driver, datasource)
+	if err != nil {
+		return nil, err
+	}
+	s := &SQLNonceStore{conn: conn}
+	return s, s.sanityCheck()
+}
+
+func (s *SQLNonceStore) Seen(nonce string, until, now time.Time) (bool, error) {
+	if _, err := s.conn.Exec(`DELETE FROM webhook_nonces WHERE expires < $1`, now); err != nil {
+		return false, errors.Wrap(err, "forgetting old nonces")
+	}
+	// The nonce is unique, so recording it fails if it's been seen,
+	// whichever replica saw it.
+	_, err := s.conn.Exec(`INSERT INTO webhook_nonces (nonce, expires) VALUES ($1, $2)`, nonce, until)
+	if err == nil {
+		return false, nil
+	}
+	var n int
+	if qerr := s.conn.QueryRow(`SELECT count(*) FROM webhook_nonces WHERE nonce = $1`, nonce).Scan(&n); qerr == nil && n > 0 {
+		return true, nil
+	}
+	return false, errors.Wrap(err, "recording nonce")
+}
+
+func (s *SQLNonceStore) sanityCheck() error {
+	_, err := s.conn.Query(`SELECT nonce FROM webhook_nonces LIMIT 1`)
+	if err != nil {
+		return errors.Wrap(err, "failed sanity check for webhook_nonces table")
+	}
+	return nil
+}
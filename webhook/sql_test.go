@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux/db"
+)
+
+func newNonceStore(t *testing.T) *SQLNonceStore {
+	f, err := ioutil.TempFile("", "fluxy-testdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbsource := "file://" + f.Name()
+	if _, err = db.Migrate(dbsource, "../db/migrations"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSQLNonceStore("ql", dbsource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSQLNonceStore(t *testing.T) {
+	s := newNonceStore(t)
+	now := time.Now()
+
+	for i, c := range []struct {
+		nonce string
+		now   time.Time
+		seen  bool
+	}{
+		{"inst/a", now, false},
+		{"inst/a", now, true},
+		{"inst/b", now, false},
+		// Once it's expired, it's forgotten
+		{"inst/a", now.Add(2 * MaxAge), false},
+	} {
+		seen, err := s.Seen(c.nonce, c.now.Add(MaxAge), c.now)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if seen != c.seen {
+			t.Errorf("%d: expected seen %v for %s, got %v", i, c.seen, c.nonce, seen)
+		}
+	}
+}
+
+func TestVerifyReplayToAnotherReplica(t *testing.T) {
+	s := newNonceStore(t)
+	body := []byte("release")
+	header := signed(t, body, []string{"secret"}, time.Now())
+	if err := NewVerifier(s).Verify("inst", header, body, []string{"secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewVerifier(s).Verify("inst", header, body, []string{"secret"}); err != ErrReplayed {
+		t.Errorf("expected ErrReplayed from a verifier sharing the store, got %v", err)
+	}
+}